@@ -0,0 +1,164 @@
+package strata
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+	"time"
+)
+
+// ============================================================================
+// PUBLIC API - Panic-free entrypoints for embedding and fuzzing
+// ============================================================================
+
+type RunOptions struct {
+	Stdout        io.Writer
+	Stderr        io.Writer
+	Stdin         io.Reader
+	MaxSteps      int
+	MaxDepth      int
+	SkipTypeCheck bool
+	Deterministic bool
+	Seed          int64
+	Epoch         time.Time
+	LogFile       string
+	PrintLowered  bool
+	Args          []string
+	// Sandbox, when set, limits the script to the capabilities it grants.
+	Sandbox *InterpreterOptions
+	// Quiet drops the runner's own messages, such as the timing line and
+	// crash report notices. Errors are still reported.
+	Quiet bool
+	// CrashReports writes a crash report for every error the script stops
+	// with. Without it reports are written only for internal errors.
+	CrashReports bool
+	// Time prints how long the run took. Without it the time is printed
+	// only when stderr is a terminal and Quiet is not set.
+	Time bool
+	// JSONDiagnostics reports errors as one JSON object per line instead
+	// of source excerpts.
+	JSONDiagnostics bool
+	// MaxMemory and MaxOutput are the run's quotas in bytes; zero means
+	// unlimited.
+	MaxMemory int64
+	MaxOutput int64
+	// Workspace, when set, runs the target within the member of that name
+	// of the workspace around the current directory.
+	Workspace string
+}
+
+// stderr is where the runner reports errors: Stderr if set, else os.Stderr.
+func (opts RunOptions) stderr() io.Writer {
+	if opts.Stderr != nil {
+		return opts.Stderr
+	}
+	return os.Stderr
+}
+
+// status is where the runner writes its own messages, which Quiet drops.
+func (opts RunOptions) status() io.Writer {
+	if opts.Quiet {
+		return io.Discard
+	}
+	return opts.stderr()
+}
+
+// report writes err, found in fileName, in the format the options select.
+func (opts RunOptions) report(err error, fileName, source string) {
+	if opts.JSONDiagnostics {
+		fmt.Fprint(opts.stderr(), RenderErrorJSON(err, fileName, source))
+		return
+	}
+	fmt.Fprint(opts.stderr(), RenderError(err, fileName, source))
+}
+
+// showTime reports whether a finished run prints how long it took.
+func (opts RunOptions) showTime() bool {
+	if opts.Time {
+		return true
+	}
+	if opts.Quiet || opts.Stderr != nil {
+		return false
+	}
+	info, err := os.Stderr.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Configure applies the options to a freshly created interpreter.
+func (opts RunOptions) Configure(interp *Interpreter) {
+	if opts.Stdout != nil {
+		interp.Stdout = opts.Stdout
+	}
+	if opts.Stderr != nil {
+		interp.Stderr = opts.Stderr
+	}
+	if opts.Stdin != nil {
+		interp.Stdin = opts.Stdin
+	}
+	interp.MaxSteps = opts.MaxSteps
+	interp.Args = opts.Args
+	if opts.MaxDepth > 0 {
+		interp.MaxDepth = opts.MaxDepth
+	}
+	if opts.MaxMemory > 0 || opts.MaxOutput > 0 {
+		interp.SetQuotas(opts.MaxMemory, opts.MaxOutput)
+	}
+	if opts.Sandbox != nil {
+		interp.Restrict(*opts.Sandbox)
+	}
+	if opts.Deterministic {
+		epoch := opts.Epoch
+		if epoch.IsZero() {
+			epoch = time.Unix(0, 0).UTC()
+		}
+		interp.SetDeterministic(opts.Seed, epoch)
+	}
+}
+
+// InternalError reports a Go panic recovered inside the front-end or the
+// interpreter. It always indicates a bug in Strata rather than in the script.
+type InternalError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *InternalError) Error() string {
+	return fmt.Sprintf("internal error: %v", e.Value)
+}
+
+func recoverInternalError(err *error) {
+	if r := recover(); r != nil {
+		*err = &InternalError{Value: r, Stack: debug.Stack()}
+	}
+}
+
+// ParseSource parses source into statements. It never panics.
+func ParseSource(source string) (statements []*Stmt, err error) {
+	defer recoverInternalError(&err)
+	return NewParser(source).Parse()
+}
+
+// ParseReader parses source streamed from r without reading it into memory
+// first. It never panics.
+func ParseReader(r io.Reader) (statements []*Stmt, err error) {
+	defer recoverInternalError(&err)
+	return NewParserReader(r).Parse()
+}
+
+// RunSource parses, checks and executes source. It never panics.
+func RunSource(source string, opts RunOptions) (err error) {
+	defer recoverInternalError(&err)
+	statements, err := NewParser(source).Parse()
+	if err != nil {
+		return err
+	}
+	if !opts.SkipTypeCheck {
+		if err := NewTypeChecker().Check(statements); err != nil {
+			return err
+		}
+	}
+	interp := NewInterpreter()
+	opts.Configure(interp)
+	return interp.Interpret(statements)
+}
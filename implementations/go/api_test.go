@@ -0,0 +1,135 @@
+package strata
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRunFlagsShapeRunnerOutput(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(dir)
+	os.WriteFile("ok.str", []byte("import io from std::io\nio.print(\"hi\")\n"), 0644)
+	os.WriteFile("crash.str", []byte(`import io from std::io
+func boom(n: int) => int {
+  return n / 0
+}
+io.print(boom(1))
+`), 0644)
+	os.WriteFile("typo.str", []byte("let x: int = \"s\"\n"), 0644)
+
+	run := func(args ...string) (int, string, string) {
+		t.Helper()
+		opts, rest, err := ParseRunFlags(args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out, errs strings.Builder
+		opts.Stdout, opts.Stderr = &out, &errs
+		code := RunProject(rest[0], opts)
+		return code, out.String(), errs.String()
+	}
+
+	if code, out, errs := run("ok.str"); code != 0 || out != "hi\n" || errs != "" {
+		t.Errorf("a plain run gave %d, %q, %q", code, out, errs)
+	}
+	if code, out, errs := run("--time", "ok.str"); code != 0 || out != "hi\n" || !regexp.MustCompile(`^Executed in [0-9.]+ms\n$`).MatchString(errs) {
+		t.Errorf("--time gave %d, %q, %q", code, out, errs)
+	}
+
+	code, _, errs := run("crash.str")
+	if code != 1 || !strings.Contains(errs, "Error: division by zero") || strings.Contains(errs, "Crash report") {
+		t.Errorf("a script error gave %d, %q, want the error without a crash report", code, errs)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".strata", "crash")); err == nil {
+		t.Error("a script error wrote a crash report")
+	}
+	code, _, errs = run("--sandbox", "--crash-report", "crash.str")
+	if code != 1 || !strings.Contains(errs, "Strata crash report") || strings.Contains(errs, "Crash report written to") {
+		t.Errorf("--sandbox --crash-report gave %d, %q, want the report on stderr", code, errs)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".strata", "crash")); err == nil {
+		t.Error("a sandboxed run wrote a crash report")
+	}
+	code, _, errs = run("--crash-report", "crash.str")
+	if code != 1 || !strings.Contains(errs, "Error: division by zero") || !strings.Contains(errs, "Crash report written to") {
+		t.Errorf("--crash-report gave %d, %q", code, errs)
+	}
+	code, _, errs = run("--crash-report", "--quiet", "crash.str")
+	if code != 1 || !strings.Contains(errs, "Error: division by zero") || strings.Contains(errs, "Crash report") {
+		t.Errorf("--quiet gave %d, %q, want the error without the crash notice", code, errs)
+	}
+
+	code, _, errs = run("--json-diagnostics", "--quiet", "crash.str")
+	var diag map[string]interface{}
+	if err := json.Unmarshal([]byte(errs), &diag); code != 1 || err != nil {
+		t.Fatalf("--json-diagnostics gave %d, %q: %v", code, errs, err)
+	}
+	stack, _ := diag["callStack"].([]interface{})
+	if diag["code"] != string(ErrDivisionByZero) || diag["file"] != "crash.str" || diag["line"] != 3.0 || len(stack) != 1 ||
+		stack[0].(map[string]interface{})["function"] != "boom" || stack[0].(map[string]interface{})["line"] != 5.0 {
+		t.Errorf("the runtime error is %v", diag)
+	}
+	code, _, errs = run("--json-diagnostics", "typo.str")
+	diag = nil
+	if err := json.Unmarshal([]byte(errs), &diag); code != 1 || err != nil {
+		t.Fatalf("--json-diagnostics on a type error gave %d, %q: %v", code, errs, err)
+	}
+	if diag["code"] != string(ErrTypeMismatch) || diag["line"] != 1.0 || diag["column"] != 14.0 || diag["endColumn"] != 17.0 {
+		t.Errorf("the type error is %v", diag)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".strata", "crash")); err != nil {
+		t.Errorf("no crash reports were written: %v", err)
+	}
+}
+
+func TestDeterministicRunsRepeat(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	script := filepath.Join(t.TempDir(), "golden.str")
+	os.WriteFile(script, []byte(`import io from std::io
+import random from std::random
+import time from std::time
+io.print(random.int(0, 1000000))
+io.print(random.uuid())
+io.print(time.timestamp())
+io.print(now())
+for (k in {"b": 1, "a": 2, "c": 3}) { io.print(k) }
+`), 0644)
+	run := func(args ...string) string {
+		t.Helper()
+		opts, rest, err := ParseRunFlags(append(args, script))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out strings.Builder
+		opts.Stdout, opts.Quiet = &out, true
+		if code := RunProject(rest[0], opts); code != 0 {
+			t.Fatalf("%v exited with %d", args, code)
+		}
+		return out.String()
+	}
+
+	golden := run("--deterministic", "--seed=7", "--epoch=2024-01-02T03:04:05Z")
+	if again := run("--deterministic", "--seed=7", "--epoch=2024-01-02T03:04:05Z"); again != golden {
+		t.Errorf("two deterministic runs differ:\n%s---\n%s", golden, again)
+	}
+	lines := strings.Split(golden, "\n")
+	if len(lines) != 8 || lines[2] != "1704164645" || lines[3] != "1704164645000" || strings.Join(lines[4:7], "") != "abc" {
+		t.Errorf("the clock or map order is not fixed:\n%s", golden)
+	}
+	if other := strings.Split(run("--deterministic", "--seed=8", "--epoch=2024-01-02T03:04:05Z"), "\n"); other[0] == lines[0] || other[1] == lines[1] {
+		t.Error("another seed drew the same numbers")
+	}
+	if epoch := strings.Split(run("--deterministic"), "\n")[2]; epoch != "0" {
+		t.Errorf("without --epoch the clock reads %s, want the Unix epoch", epoch)
+	}
+	if _, _, err := ParseRunFlags([]string{"--epoch=yesterday", script}); err == nil {
+		t.Error("an unparsable --epoch was accepted")
+	}
+}
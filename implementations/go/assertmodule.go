@@ -0,0 +1,120 @@
+package strata
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ============================================================================
+// STD::ASSERT - Assertions and failure counting for script tests
+// ============================================================================
+
+// A failed assertion raises an E0015 runtime error at the call site, which
+// try/catch can catch like any other. Every failure is also counted, so a
+// test runner written in Strata can run its tests inside try blocks and
+// report assert.failures() at the end.
+
+// assertionError counts a failure and builds the error it raises. The
+// optional message argument at pos is put before the description.
+func assertionError(failures *int64, args []interface{}, pos int, format string, values ...interface{}) error {
+	*failures++
+	description := fmt.Sprintf(format, values...)
+	if len(args) > pos && args[pos] != nil {
+		description = strings.TrimSuffix(toString(args[pos])+": "+description, ": ")
+	}
+	if description == "" {
+		return newError(ErrAssertion, "assertion failed")
+	}
+	return newError(ErrAssertion, "assertion failed: %s", description)
+}
+
+func assertModule(i *Interpreter) map[string]interface{} {
+	var failures, passes int64
+	pass := func() (interface{}, error) {
+		passes++
+		return nil, nil
+	}
+	condition := func(name string, want bool) NativeFunc {
+		return func(args []interface{}) (interface{}, error) {
+			if err := wantArgs(name, args, 1); err != nil {
+				return nil, err
+			}
+			if got, ok := args[0].(bool); !ok || got != want {
+				return nil, assertionError(&failures, args, 1, "expected %t, got %s", want, formatElement(args[0]))
+			}
+			return pass()
+		}
+	}
+	return map[string]interface{}{
+		"equal": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("equal", args, 2); err != nil {
+				return nil, err
+			}
+			if !valuesEqual(args[0], args[1]) {
+				return nil, assertionError(&failures, args, 2, "expected %s, got %s", formatElement(args[1]), formatElement(args[0]))
+			}
+			return pass()
+		}),
+		"notEqual": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("notEqual", args, 2); err != nil {
+				return nil, err
+			}
+			if valuesEqual(args[0], args[1]) {
+				return nil, assertionError(&failures, args, 2, "expected a value other than %s", formatElement(args[1]))
+			}
+			return pass()
+		}),
+		"true":  condition("true", true),
+		"false": condition("false", false),
+		"approx": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("approx", args, 2); err != nil {
+				return nil, err
+			}
+			for _, arg := range args[:2] {
+				if !isNumber(arg) && !isInteger(arg) {
+					return nil, newError(ErrTypeMismatch, "approx expects numbers, got %s", describeValue(arg))
+				}
+			}
+			eps := 1e-9
+			if len(args) > 2 {
+				eps = toFloat(args[2])
+			}
+			a, b := toFloat(args[0]), toFloat(args[1])
+			if math.IsNaN(a) || math.IsNaN(b) || math.Abs(a-b) > eps {
+				return nil, assertionError(&failures, args, 3, "expected %s within %g, got %s", formatValue(args[1]), eps, formatValue(args[0]))
+			}
+			return pass()
+		}),
+		"throws": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("throws", args, 1); err != nil {
+				return nil, err
+			}
+			depth := len(i.CallStack)
+			_, err := i.callValue("throws", args[0], nil)
+			if err == nil {
+				return nil, assertionError(&failures, args, 1, "expected the function to throw")
+			}
+			value, ok := caughtValue(err)
+			if !ok {
+				return nil, err
+			}
+			i.CallStack = i.CallStack[:depth]
+			passes++
+			return value, nil
+		}),
+		"fail": NativeFunc(func(args []interface{}) (interface{}, error) {
+			return nil, assertionError(&failures, args, 0, "")
+		}),
+		"failures": NativeFunc(func(args []interface{}) (interface{}, error) {
+			return failures, nil
+		}),
+		"passes": NativeFunc(func(args []interface{}) (interface{}, error) {
+			return passes, nil
+		}),
+		"reset": NativeFunc(func(args []interface{}) (interface{}, error) {
+			failures, passes = 0, 0
+			return nil, nil
+		}),
+	}
+}
@@ -0,0 +1,159 @@
+package strata
+
+import (
+	"math/rand"
+	"reflect"
+)
+
+// ============================================================================
+// ASYNC - async functions, await and std::promise
+// ============================================================================
+
+// Calling a function declared `async func` starts its body on a goroutine
+// and returns a promise straight away. `await` waits for a promise and
+// yields its value, or raises the error the function failed with; awaiting
+// any other value yields it unchanged. The body runs in a worker interpreter
+// like those of std::parallel: it starts from a copy of the caller's globals,
+// of the scopes the function closes over and of its arguments, and shares
+// only output and the promises passed to it. Work that is never awaited may
+// be cut short when the script ends.
+
+// Promise is the eventual result of an async call.
+type Promise struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+func newPromise() *Promise {
+	return &Promise{done: make(chan struct{})}
+}
+
+func (p *Promise) String() string {
+	return "<promise>"
+}
+
+// settle records the result and wakes everything waiting for it.
+func (p *Promise) settle(value interface{}, err error) {
+	p.value, p.err = value, err
+	close(p.done)
+}
+
+// Await blocks until the promise settles and returns its result.
+func (p *Promise) Await() (interface{}, error) {
+	<-p.done
+	return p.value, p.err
+}
+
+// awaitValue is `await value`.
+func awaitValue(value interface{}) (interface{}, error) {
+	if p, ok := value.(*Promise); ok {
+		return p.Await()
+	}
+	return value, nil
+}
+
+// await is `await value` in a run: waiting on a promise counts as waiting
+// for deadlock detection.
+func (t *tasks) await(value interface{}) (interface{}, error) {
+	p, ok := value.(*Promise)
+	if !ok {
+		return value, nil
+	}
+	if _, _, _, err := t.wait([]reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(p.done)}}); err != nil {
+		return nil, err
+	}
+	return p.value, p.err
+}
+
+// startAsync calls the async function fn on a worker and returns the
+// promise of its result. Everything the worker needs is copied before
+// startAsync returns, so args may be reused afterwards.
+func (i *Interpreter) startAsync(name string, fn *FuncDef, args []interface{}) *Promise {
+	w, c := i.fork()
+	// The worker runs the body as an ordinary function, while calls it
+	// makes to fn itself still start new ones.
+	body := *c.value(fn).(*FuncDef)
+	if body.Decl != nil {
+		decl := *body.Decl
+		decl.Async = false
+		body.Decl = &decl
+	}
+	copied := make([]interface{}, len(args))
+	for idx, arg := range args {
+		copied[idx] = c.value(arg)
+	}
+	w.Rand = rand.New(rand.NewSource(i.Rand.Int63()))
+	w.Location = i.Location
+	p := newPromise()
+	i.tasks.start()
+	go func() {
+		defer i.tasks.stop()
+		p.settle(w.callWorker(func() (interface{}, error) {
+			return w.callFunction(name, &body, copied)
+		}))
+	}()
+	return p
+}
+
+func promiseModule() map[string]interface{} {
+	return map[string]interface{}{
+		// all settles with the values of every item once all have settled,
+		// or with the error of the first failed item in list order.
+		"all": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("all", args, 1); err != nil {
+				return nil, err
+			}
+			items, err := listArg("all", args[0])
+			if err != nil {
+				return nil, err
+			}
+			p := newPromise()
+			go func() {
+				values := make([]interface{}, len(items))
+				var failed error
+				for idx, item := range items {
+					if values[idx], err = awaitValue(item); err != nil && failed == nil {
+						failed = err
+					}
+				}
+				if failed != nil {
+					p.settle(nil, failed)
+					return
+				}
+				p.settle(values, nil)
+			}()
+			return p, nil
+		}),
+		// race settles like whichever item settles first.
+		"race": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("race", args, 1); err != nil {
+				return nil, err
+			}
+			items, err := listArg("race", args[0])
+			if err != nil {
+				return nil, err
+			}
+			if len(items) == 0 {
+				return nil, newError(ErrInvalidOperation, "race expects at least one promise")
+			}
+			type result struct {
+				value interface{}
+				err   error
+			}
+			first := make(chan result, len(items))
+			for _, item := range items {
+				go func(item interface{}) {
+					value, err := awaitValue(item)
+					first <- result{value, err}
+				}(item)
+			}
+			p := newPromise()
+			go func() {
+				r := <-first
+				p.settle(r.value, r.err)
+			}()
+			return p, nil
+		}),
+	}
+}
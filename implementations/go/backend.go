@@ -0,0 +1,208 @@
+package strata
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ============================================================================
+// BACKENDS - The targets strata build translates programs for
+// ============================================================================
+
+// A Backend translates a checked program into source files for another
+// toolchain. `strata build --target=NAME` uses the backend registered under
+// NAME, so a Go package can add a target by registering one from an init
+// function, as plugins add modules.
+//
+// The first file Generate returns is the program; the rest, such as a
+// runtime library, go next to it under their names. A backend that also
+// implements NativeBackend compiles those files to a binary. Otherwise
+// they are the build's output.
+type Backend interface {
+	Name() string
+	Generate(statements []*Stmt) ([]OutputFile, error)
+}
+
+// NativeBackend is a Backend whose output is compiled to a binary.
+type NativeBackend interface {
+	Backend
+	// Compile builds opts.Output from the generated files, written to
+	// dir, with the program at source.
+	Compile(source, dir string, opts BuildOptions, stderr io.Writer) error
+}
+
+// OutputFile is a file a backend generates. The program has a SourceMap
+// when the backend can map its lines to the source.
+type OutputFile struct {
+	Name      string
+	Content   string
+	SourceMap *SourceMap
+}
+
+var (
+	backendsMu sync.Mutex
+	backends   = map[string]Backend{
+		"c":    cBackend{},
+		"js":   jsBackend{},
+		"llvm": llvmBackend{},
+	}
+)
+
+// RegisterBackend makes b available as a build target. It panics if b has
+// no name or a backend with the same name is already registered.
+func RegisterBackend(b Backend) {
+	if b == nil || b.Name() == "" {
+		panic("strata: invalid backend: it needs a name")
+	}
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if _, dup := backends[b.Name()]; dup {
+		panic("strata: backend registered twice: " + b.Name())
+	}
+	backends[b.Name()] = b
+}
+
+// Backends returns the names of the registered backends in order.
+func Backends() []string {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupBackend returns the backend registered under name.
+func LookupBackend(name string) (Backend, bool) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	b, ok := backends[name]
+	return b, ok
+}
+
+// withRuntime returns the program followed by the files of a runtime, in
+// order of name.
+func withRuntime(program OutputFile, runtime map[string]string) []OutputFile {
+	files := []OutputFile{program}
+	names := make([]string, 0, len(runtime))
+	for name := range runtime {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		files = append(files, OutputFile{Name: name, Content: runtime[name]})
+	}
+	return files
+}
+
+// runTool runs a step of a build, passing on what it prints to stderr.
+func runTool(stderr io.Writer, what, tool string, args ...string) error {
+	cmd := exec.Command(tool, args...)
+	cmd.Stdout = stderr
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed to compile %s: %v", filepath.Base(tool), what, err)
+	}
+	return nil
+}
+
+// cBackend translates programs to C with CGenerator and compiles them
+// together with the C runtime.
+type cBackend struct{}
+
+func (cBackend) Name() string { return "c" }
+
+func (cBackend) Generate(statements []*Stmt) ([]OutputFile, error) {
+	g := NewCGenerator()
+	code, err := g.Generate(statements)
+	if err != nil {
+		return nil, err
+	}
+	return withRuntime(OutputFile{Name: "main.c", Content: code + "\n", SourceMap: g.SourceMap()}, CRuntimeFiles()), nil
+}
+
+func (cBackend) Compile(source, dir string, opts BuildOptions, stderr io.Writer) error {
+	compiler, err := findCompiler(opts.Compiler)
+	if err != nil {
+		return err
+	}
+	return runTool(stderr, "the generated C", compiler, "-O2", "-o", opts.Output, source, filepath.Join(dir, "strata_runtime.c"), "-lm")
+}
+
+// jsBackend translates programs to a JavaScript module that imports the
+// JavaScript runtime.
+type jsBackend struct{}
+
+func (jsBackend) Name() string { return "js" }
+
+func (jsBackend) Generate(statements []*Stmt) ([]OutputFile, error) {
+	g := NewJSGenerator()
+	code, err := g.Generate(statements)
+	if err != nil {
+		return nil, err
+	}
+	return withRuntime(OutputFile{Name: "main.js", Content: code + "\n", SourceMap: g.SourceMap()}, JSRuntimeFiles()), nil
+}
+
+// llvmBackend lowers programs to LLVM IR, which clang compiles with the C
+// runtime, or without clang opt optimizes, llc compiles and the C compiler
+// links.
+type llvmBackend struct{}
+
+func (llvmBackend) Name() string { return "llvm" }
+
+func (llvmBackend) Generate(statements []*Stmt) ([]OutputFile, error) {
+	g := NewLLVMGenerator()
+	code, err := g.Generate(statements)
+	if err != nil {
+		return nil, err
+	}
+	return withRuntime(OutputFile{Name: "main.ll", Content: code, SourceMap: g.SourceMap()}, CRuntimeFiles()), nil
+}
+
+func (llvmBackend) Compile(source, dir string, opts BuildOptions, stderr io.Writer) error {
+	runtimeSource := filepath.Join(dir, "strata_runtime.c")
+	if clang, err := exec.LookPath("clang"); err == nil {
+		return runTool(stderr, "the generated LLVM IR", clang, "-O2", "-Wno-override-module", "-o", opts.Output, source, runtimeSource, "-lm")
+	}
+	optimizer, optErr := exec.LookPath("opt")
+	llc, llcErr := exec.LookPath("llc")
+	if optErr != nil || llcErr != nil {
+		return fmt.Errorf("the llvm target needs clang, or opt and llc, on the PATH")
+	}
+	compiler, err := findCompiler(opts.Compiler)
+	if err != nil {
+		return err
+	}
+	work, err := os.MkdirTemp("", "strata-llvm")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(work)
+	bitcode := filepath.Join(work, "main.bc")
+	object := filepath.Join(work, "main.o")
+	if err := runTool(stderr, "the generated LLVM IR", optimizer, "-O2", "-o", bitcode, source); err != nil {
+		return err
+	}
+	if err := runTool(stderr, "the optimized LLVM IR", llc, "-O2", "-filetype=obj", "-relocation-model=pic", "-o", object, bitcode); err != nil {
+		return err
+	}
+	return runTool(stderr, "the C runtime", compiler, "-O2", "-o", opts.Output, object, runtimeSource, "-lm")
+}
+
+// targetList names the registered backends for messages, as "c, js or llvm".
+func targetList() string {
+	names := Backends()
+	if len(names) == 1 {
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
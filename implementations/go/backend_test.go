@@ -0,0 +1,126 @@
+package strata
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// outlineBackend lists a program's top-level statements, one per line.
+type outlineBackend struct{}
+
+func (outlineBackend) Name() string { return "outline" }
+
+func (outlineBackend) Generate(statements []*Stmt) ([]OutputFile, error) {
+	var b strings.Builder
+	for _, stmt := range statements {
+		b.WriteString(string(stmt.Kind) + " " + stmt.Name + "\n")
+	}
+	return []OutputFile{{Name: "main.txt", Content: b.String()}, {Name: "README", Content: "outline\n"}}, nil
+}
+
+func TestBuildUsesRegisteredBackend(t *testing.T) {
+	if _, ok := LookupBackend("outline"); !ok {
+		RegisterBackend(outlineBackend{})
+	}
+	opts, _, err := parseBuildFlags([]string{"--target=outline"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	entry := filepath.Join(dir, "app.str")
+	if err := os.WriteFile(entry, []byte("let x: int = 1\nfunc f() => void {\n}\nf()\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	project, err := LoadProject(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Output = filepath.Join(dir, "app.txt")
+	written, err := Build(project, opts, os.Stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != 2 || written[0] != opts.Output || written[1] != filepath.Join(dir, "README") {
+		t.Errorf("build wrote %v", written)
+	}
+	if out, _ := os.ReadFile(opts.Output); string(out) != "let x\nfunction f\nexpression \n" {
+		t.Errorf("build output is %q", out)
+	}
+
+	if _, _, err := parseBuildFlags([]string{"--target=cobol"}); err == nil || !strings.Contains(err.Error(), "use c, js, llvm or outline") {
+		t.Errorf("unknown target gave %v", err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a backend twice did not panic")
+		}
+	}()
+	RegisterBackend(outlineBackend{})
+}
+
+func TestBackendsAgreeOnEquality(t *testing.T) {
+	source := `import io from std::io
+let xs: list<int> = [1, 2]
+io.print(xs == [1, 2])
+io.print(xs != [1, 2])
+io.print(xs == [2, 1])
+io.print([[1], [2.0]] == [[1], [2]])
+let m: map<string, int> = {"a": 1, "b": 2}
+io.print(m == {"b": 2, "a": 1})
+io.print(m != {"a": 1})
+let v: any = xs
+io.print(v == [1, 2])
+io.print("ab" == "a" + "b")
+`
+	var want strings.Builder
+	if err := RunSource(source, RunOptions{Stdout: &want}); err != nil {
+		t.Fatal(err)
+	}
+	if want.String() != "true\nfalse\nfalse\ntrue\ntrue\ntrue\ntrue\ntrue\n" {
+		t.Fatalf("the interpreter printed\n%s", want.String())
+	}
+	statements, err := ParseSource(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	js, err := NewJSGenerator().Generate(statements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := runJS(t, js); got != want.String() {
+		t.Errorf("the JavaScript build printed\n%s", got)
+	}
+	if got := runC(t, generateC(t, source)); got != want.String() {
+		t.Errorf("the C build printed\n%s", got)
+	}
+}
+
+func TestIndexErrorsNameTheReceiver(t *testing.T) {
+	source := `import io from std::io
+let s: string = "héllo"
+let xs: list<int> = [1, 2]
+try { io.print(s[5]) } catch (e) { io.print(e) }
+try { io.print(xs[5]) } catch (e) { io.print(e) }
+`
+	var got strings.Builder
+	if err := RunSource(source, RunOptions{Stdout: &got}); err != nil {
+		t.Fatal(err)
+	}
+	want := "index 5 out of range for string of length 5\nindex 5 out of range for array of length 2\n"
+	if got.String() != want {
+		t.Errorf("the interpreter printed\n%s", got.String())
+	}
+	statements, err := ParseSource(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	js, err := NewJSGenerator().Generate(statements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := runJS(t, js); got != want {
+		t.Errorf("the JavaScript build printed\n%s", got)
+	}
+}
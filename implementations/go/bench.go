@@ -0,0 +1,280 @@
+package strata
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime/metrics"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// BENCHMARKS - strata bench runs bench_* functions and compares baselines
+// ============================================================================
+
+// BenchOptions configures strata bench on top of the usual run flags.
+type BenchOptions struct {
+	Run RunOptions
+	// Time is how long each benchmark is measured for, after warmup.
+	Time time.Duration
+	// Filter, when set, keeps only benchmarks whose names contain it.
+	Filter string
+	// Baseline and Save name JSON files to compare against and to write.
+	Baseline string
+	Save     string
+	// Threshold, when positive, fails the run if any benchmark got slower
+	// than its baseline by more than this many percent.
+	Threshold float64
+}
+
+// BenchResult is one benchmark's measurement, as saved in a baseline file.
+type BenchResult struct {
+	Iterations  int64   `json:"iterations"`
+	NsPerOp     float64 `json:"ns_per_op"`
+	AllocsPerOp float64 `json:"allocs_per_op"`
+	BytesPerOp  float64 `json:"bytes_per_op"`
+}
+
+const defaultBenchTime = time.Second
+
+// parseBenchFlags takes the bench-only flags out of args and hands the rest
+// to ParseRunFlags.
+func parseBenchFlags(args []string) (BenchOptions, []string, error) {
+	opts := BenchOptions{Time: defaultBenchTime}
+	var runArgs []string
+	for idx := 0; idx < len(args); idx++ {
+		arg := args[idx]
+		if arg == "--" || !strings.HasPrefix(arg, "--") {
+			runArgs = append(runArgs, args[idx:]...)
+			break
+		}
+		name, value, hasValue := strings.Cut(arg, "=")
+		switch {
+		case name == "--benchtime" && hasValue:
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return opts, nil, fmt.Errorf("invalid --benchtime: %s", value)
+			}
+			opts.Time = d
+		case name == "--filter" && hasValue:
+			opts.Filter = value
+		case name == "--baseline" && hasValue:
+			opts.Baseline = value
+		case name == "--save" && hasValue:
+			opts.Save = value
+		case name == "--threshold" && hasValue:
+			percent, err := strconv.ParseFloat(value, 64)
+			if err != nil || percent <= 0 {
+				return opts, nil, fmt.Errorf("invalid --threshold: %s", value)
+			}
+			opts.Threshold = percent
+		default:
+			runArgs = append(runArgs, arg)
+		}
+	}
+	run, rest, err := ParseRunFlags(runArgs)
+	opts.Run = run
+	return opts, rest, err
+}
+
+// heapAllocs returns the cumulative count and size of heap allocations.
+func heapAllocs() (objects, bytes uint64) {
+	samples := []metrics.Sample{{Name: "/gc/heap/allocs:objects"}, {Name: "/gc/heap/allocs:bytes"}}
+	metrics.Read(samples)
+	if samples[0].Value.Kind() == metrics.KindUint64 {
+		objects = samples[0].Value.Uint64()
+	}
+	if samples[1].Value.Kind() == metrics.KindUint64 {
+		bytes = samples[1].Value.Uint64()
+	}
+	return objects, bytes
+}
+
+// benchFunctions lists the script's bench_* functions in name order.
+func benchFunctions(i *Interpreter, filter string) []string {
+	var names []string
+	for name := range i.rootEnv().Functions {
+		if strings.HasPrefix(name, "bench_") && strings.Contains(name, filter) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// runBenchmark calls fn n times and returns the elapsed time.
+func (i *Interpreter) runBenchmark(name string, fn *FuncDef, n int64) (time.Duration, error) {
+	depth := len(i.CallStack)
+	start := time.Now()
+	for iter := int64(0); iter < n; iter++ {
+		if _, err := i.callFunction(name, fn, nil); err != nil {
+			i.CallStack = i.CallStack[:depth]
+			return 0, err
+		}
+	}
+	return time.Since(start), nil
+}
+
+// measure warms fn up, then runs it in growing batches, as go test -bench
+// does, until one batch takes at least d.
+func (i *Interpreter) measure(name string, fn *FuncDef, d time.Duration) (BenchResult, error) {
+	if len(fn.Params) > 0 {
+		return BenchResult{}, fmt.Errorf("%s must not take parameters", name)
+	}
+	if _, err := i.runBenchmark(name, fn, warmupIterations(i, name, fn, d)); err != nil {
+		return BenchResult{}, err
+	}
+	n := int64(1)
+	for {
+		objects, bytes := heapAllocs()
+		elapsed, err := i.runBenchmark(name, fn, n)
+		if err != nil {
+			return BenchResult{}, err
+		}
+		objectsAfter, bytesAfter := heapAllocs()
+		if elapsed >= d || n >= 1e9 {
+			return BenchResult{
+				Iterations:  n,
+				NsPerOp:     float64(elapsed.Nanoseconds()) / float64(n),
+				AllocsPerOp: float64(objectsAfter-objects) / float64(n),
+				BytesPerOp:  float64(bytesAfter-bytes) / float64(n),
+			}, nil
+		}
+		// Aim 20% past d from the last batch's rate, growing at most 100x.
+		next := int64(1.2 * float64(d) / float64(elapsed+1) * float64(n))
+		if next > 100*n {
+			next = 100 * n
+		}
+		if next <= n {
+			next = n + 1
+		}
+		n = next
+	}
+}
+
+// warmupIterations is how many calls fill about a tenth of the benchmark
+// time, judged from one timed call.
+func warmupIterations(i *Interpreter, name string, fn *FuncDef, d time.Duration) int64 {
+	elapsed, err := i.runBenchmark(name, fn, 1)
+	if err != nil || elapsed <= 0 {
+		return 1
+	}
+	n := int64(d / 10 / elapsed)
+	if n < 1 {
+		return 1
+	}
+	if n > 1e6 {
+		return 1e6
+	}
+	return n
+}
+
+func loadBaseline(path string) (map[string]BenchResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	baseline := map[string]BenchResult{}
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return baseline, nil
+}
+
+// percentChange formats how much now differs from then, e.g. "+12.5%".
+func percentChange(now, then float64) string {
+	if then == 0 {
+		return "~"
+	}
+	return fmt.Sprintf("%+.1f%%", (now-then)/then*100)
+}
+
+// RunBenchmarks runs the bench_* functions of the program at target and
+// writes a line per benchmark to out. It reports whether every benchmark
+// ran and none regressed past the threshold.
+func RunBenchmarks(target string, opts BenchOptions, out io.Writer) (bool, error) {
+	var baseline map[string]BenchResult
+	if opts.Baseline != "" {
+		var err error
+		if baseline, err = loadBaseline(opts.Baseline); err != nil {
+			return false, err
+		}
+	}
+	project := loadProjectOrReport(target, opts.Run)
+	if project == nil {
+		return false, nil
+	}
+	entry := project.EntryModule()
+	interp := NewInterpreter()
+	opts.Run.Configure(interp)
+	interp.UseProject(project)
+	if err := interp.Interpret(entry.Statements); err != nil {
+		opts.Run.report(err, project.RelPath(entry.Path), entry.Source)
+		return false, nil
+	}
+	names := benchFunctions(interp, opts.Filter)
+	if len(names) == 0 {
+		fmt.Fprintln(out, "no bench_* functions found")
+		return true, nil
+	}
+	width := 0
+	for _, name := range names {
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+	ok := true
+	results := map[string]BenchResult{}
+	for _, name := range names {
+		result, err := interp.measure(name, interp.rootEnv().Functions[name], opts.Time)
+		if err != nil {
+			fmt.Fprintf(out, "%-*s  FAIL\n", width, name)
+			opts.Run.report(err, project.RelPath(entry.Path), entry.Source)
+			ok = false
+			continue
+		}
+		results[name] = result
+		line := fmt.Sprintf("%-*s  %10d  %14.1f ns/op  %10.1f allocs/op  %12.1f B/op", width, name, result.Iterations, result.NsPerOp, result.AllocsPerOp, result.BytesPerOp)
+		if then, found := baseline[name]; found {
+			change := percentChange(result.NsPerOp, then.NsPerOp)
+			line += fmt.Sprintf("  %s time, %s allocs", change, percentChange(result.AllocsPerOp, then.AllocsPerOp))
+			if opts.Threshold > 0 && then.NsPerOp > 0 && (result.NsPerOp-then.NsPerOp)/then.NsPerOp*100 > opts.Threshold {
+				line += "  REGRESSION"
+				ok = false
+			}
+		}
+		fmt.Fprintln(out, line)
+	}
+	if opts.Save != "" {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return false, err
+		}
+		if err := os.WriteFile(opts.Save, append(data, '\n'), 0644); err != nil {
+			return false, err
+		}
+	}
+	return ok, nil
+}
+
+// BenchProject runs `strata bench` with args and returns its exit code.
+func BenchProject(args []string) int {
+	opts, rest, err := parseBenchFlags(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	ok, err := RunBenchmarks(targetArg(rest), opts, os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if !ok {
+		return 1
+	}
+	return 0
+}
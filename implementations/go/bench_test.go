@@ -0,0 +1,63 @@
+package strata
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBenchComparesAgainstBaseline(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	program := filepath.Join(dir, "main.str")
+	os.WriteFile(program, []byte(`func bench_add() => int {
+  return 1 + 2
+}
+func helper() => int {
+  return 0
+}
+`), 0644)
+	saved := filepath.Join(dir, "saved.json")
+
+	var out strings.Builder
+	ok, err := RunBenchmarks(program, BenchOptions{Time: 10 * time.Millisecond, Save: saved}, &out)
+	if err != nil || !ok {
+		t.Fatalf("the first run failed: ok=%v err=%v\n%s", ok, err, out.String())
+	}
+	if !strings.HasPrefix(out.String(), "bench_add ") || strings.Contains(out.String(), "helper") || strings.Contains(out.String(), "time,") {
+		t.Errorf("the first run printed %q", out.String())
+	}
+	baseline, err := loadBaseline(saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, found := baseline["bench_add"]; !found || len(baseline) != 1 || result.Iterations <= 0 || result.NsPerOp <= 0 {
+		t.Fatalf("saved %v", baseline)
+	}
+
+	out.Reset()
+	ok, err = RunBenchmarks(program, BenchOptions{Time: 10 * time.Millisecond, Baseline: saved, Threshold: 1e9}, &out)
+	if err != nil || !ok {
+		t.Errorf("comparing against its own baseline failed: ok=%v err=%v\n%s", ok, err, out.String())
+	}
+	if !strings.Contains(out.String(), " time, ") || strings.Contains(out.String(), "REGRESSION") {
+		t.Errorf("the comparison printed %q", out.String())
+	}
+
+	fast := filepath.Join(dir, "fast.json")
+	os.WriteFile(fast, []byte(`{"bench_add": {"iterations": 1, "ns_per_op": 0.001, "allocs_per_op": 0, "bytes_per_op": 0}}`), 0644)
+	out.Reset()
+	ok, err = RunBenchmarks(program, BenchOptions{Time: 10 * time.Millisecond, Baseline: fast, Threshold: 10}, &out)
+	if err != nil || ok {
+		t.Errorf("a slower run passed the threshold: ok=%v err=%v", ok, err)
+	}
+	if !strings.Contains(out.String(), "REGRESSION") {
+		t.Errorf("the regression was not reported: %q", out.String())
+	}
+
+	if _, err := RunBenchmarks(program, BenchOptions{Time: 10 * time.Millisecond, Baseline: filepath.Join(dir, "missing.json")}, &out); err == nil {
+		t.Error("a missing baseline was not an error")
+	}
+}
@@ -0,0 +1,178 @@
+package strata
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// ============================================================================
+// COMMANDS - Packages that install commands written in Strata
+// ============================================================================
+
+// A package provides commands by mapping their names to Strata files in the
+// bin field of its package.json or Strataumfile, or of its version in the
+// registry:
+//
+//	{"name": "colors", "bin": {"colorize": "bin/colorize.str"}}
+//
+// Installing the package links each command into .strata/bin, where the
+// project's scripts find it. `strataum install -g <package>` installs it
+// for the user instead, under ~/.strata/global, and links the commands into
+// ~/.strata/bin, the directory to put on the PATH. A link is a small shell
+// script (a .cmd file on Windows) running the file with strata.
+
+// binDir is where the commands of the packages pm installs are linked.
+func (pm *PackageManager) binDir() string {
+	if pm.globalBin != "" {
+		return pm.globalBin
+	}
+	return pm.WorkspaceRoot + "/.strata/bin"
+}
+
+// packageBin is the commands the package in pkgDir provides, each mapped to
+// the path of its file.
+func packageBin(pkgDir string) (map[string]string, error) {
+	var manifest struct {
+		Bin map[string]string `json:"bin"`
+	}
+	for _, file := range []string{"package.json", "Strataumfile"} {
+		data, err := os.ReadFile(filepath.Join(pkgDir, file))
+		if err != nil {
+			continue
+		}
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", filepath.Join(pkgDir, file), err)
+		}
+		if len(manifest.Bin) > 0 {
+			break
+		}
+	}
+	bins := make(map[string]string, len(manifest.Bin))
+	for command, file := range manifest.Bin {
+		if !validNamePart(command) {
+			return nil, fmt.Errorf("invalid command name %q", command)
+		}
+		path := filepath.Join(pkgDir, filepath.FromSlash(file))
+		rel, err := filepath.Rel(pkgDir, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("command %s runs %s, outside the package", command, file)
+		}
+		if filepath.Ext(path) != ".str" {
+			return nil, fmt.Errorf("command %s runs %s, which is not a .str file", command, file)
+		}
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			return nil, fmt.Errorf("command %s runs %s, which the package does not have", command, file)
+		}
+		bins[command] = path
+	}
+	return bins, nil
+}
+
+// linkBins links the commands of an installed package into binDir.
+func (pm *PackageManager) linkBins(name string) error {
+	pkgDir, err := filepath.Abs(filepath.FromSlash(pm.packagesDir() + "/" + name))
+	if err != nil {
+		return err
+	}
+	bins, err := packageBin(pkgDir)
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	if len(bins) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(pm.binDir(), 0755); err != nil {
+		return err
+	}
+	commands := make([]string, 0, len(bins))
+	for command := range bins {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+	for _, command := range commands {
+		if err := writeShim(filepath.Join(pm.binDir(), command), bins[command]); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Linked %s from %s\n", command, name)
+	}
+	return nil
+}
+
+// unlinkBins removes the links to the commands of an installed package.
+func (pm *PackageManager) unlinkBins(name string) {
+	bins, _ := packageBin(filepath.FromSlash(pm.packagesDir() + "/" + name))
+	for command := range bins {
+		shim := filepath.Join(pm.binDir(), command)
+		if runtime.GOOS == "windows" {
+			shim += ".cmd"
+		}
+		os.Remove(shim)
+	}
+}
+
+// writeShim writes a script at path that runs the Strata file entry with
+// the running strata, passing its arguments on.
+func writeShim(path, entry string) error {
+	strata := "strata"
+	if self, err := os.Executable(); err == nil {
+		strata = self
+	}
+	if runtime.GOOS == "windows" {
+		return os.WriteFile(path+".cmd", []byte(fmt.Sprintf("@\"%s\" \"%s\" %%*\r\n", strata, entry)), 0755)
+	}
+	script := fmt.Sprintf("#!/bin/sh\nexec %s %s \"$@\"\n", shellQuote(strata), shellQuote(entry))
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		return err
+	}
+	return os.Chmod(path, 0755)
+}
+
+// shellQuote quotes s for sh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// GlobalPackageManager manages the packages installed for the user, in
+// ~/.strata/global, with their commands in ~/.strata/bin.
+func GlobalPackageManager() (*PackageManager, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("cannot find the global packages: %v", err)
+	}
+	root := filepath.Join(home, ".strata", "global")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	pm := NewPackageManager(root)
+	pm.Strataumfile.Name = "global"
+	pm.globalBin = filepath.Join(home, ".strata", "bin")
+	return pm, nil
+}
+
+// InstallGlobal installs a package, given as name or name@version, for the
+// user and links its commands into ~/.strata/bin.
+func InstallGlobal(spec string) error {
+	if spec == "" {
+		return fmt.Errorf("usage: strataum install -g <package>[@version]")
+	}
+	name, version := splitPackageSpec(spec)
+	pm, err := GlobalPackageManager()
+	if err != nil {
+		return err
+	}
+	if err := pm.Add(name, version); err != nil {
+		return err
+	}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == pm.globalBin {
+			return nil
+		}
+	}
+	fmt.Printf("  add %s to your PATH to run the commands of global packages\n", pm.globalBin)
+	return nil
+}
@@ -0,0 +1,96 @@
+package strata
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestPackagesInstallCommands(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shims are .cmd files on Windows")
+	}
+	served := tarball(t, map[string]string{
+		"index.str":        "func shout(s: string) => string {\n  return s + \"!\"\n}\n",
+		"bin/colorize.str": "import io from std::io\nimport colors from colors\nio.print(colors.shout(\"hi\"))\n",
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/packages/colors", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name": "colors", "latest": "1.0.0", "versions": {"1.0.0": {"tarball": "/colors.tgz",
+			"bin": {"colorize": "bin/colorize.str"}}}}`))
+	})
+	mux.HandleFunc("/colors.tgz", func(w http.ResponseWriter, r *http.Request) { w.Write(served) })
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	os.MkdirAll(filepath.Join(home, ".strata"), 0755)
+	os.WriteFile(filepath.Join(home, ".strata", "config"), []byte(`{"registry": "`+server.URL+`"}`), 0600)
+
+	if err := InstallGlobal("colors@1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	entry := filepath.Join(home, ".strata", "global", ".strata", "packages", "colors", "bin", "colorize.str")
+	shim, err := os.ReadFile(filepath.Join(home, ".strata", "bin", "colorize"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(shim), "#!/bin/sh\n") || !strings.Contains(string(shim), shellQuote(entry)) {
+		t.Errorf("the shim is %q", shim)
+	}
+	if info, _ := os.Stat(filepath.Join(home, ".strata", "bin", "colorize")); info.Mode()&0111 == 0 {
+		t.Error("the shim is not executable")
+	}
+
+	// The command finds its own package as an import.
+	project, err := LoadProject(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var diags strings.Builder
+	if project.ReportDiagnostics(&diags) > 0 {
+		t.Fatal(diags.String())
+	}
+	var out strings.Builder
+	interp := NewInterpreter()
+	RunOptions{Stdout: &out}.Configure(interp)
+	interp.UseProject(project)
+	if err := interp.Interpret(project.EntryModule().Statements); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "hi!\n" {
+		t.Errorf("colorize printed %q", out.String())
+	}
+
+	global, err := GlobalPackageManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if global.Strataumfile.Dependencies["colors"] != "1.0.0" {
+		t.Errorf("the global packages are %v", global.Strataumfile.Dependencies)
+	}
+	global.Remove("colors")
+	if _, err := os.Stat(filepath.Join(home, ".strata", "bin", "colorize")); !os.IsNotExist(err) {
+		t.Error("removing the package kept its command")
+	}
+
+	// A project's packages link their commands into its .strata/bin.
+	root := t.TempDir()
+	if err := NewPackageManager(root).Add("colors", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, ".strata", "bin", "colorize")); err != nil {
+		t.Error(err)
+	}
+
+	pkgDir := t.TempDir()
+	os.WriteFile(filepath.Join(pkgDir, "package.json"), []byte(`{"bin": {"escape": "../evil.str"}}`), 0644)
+	if _, err := packageBin(pkgDir); err == nil || !strings.Contains(err.Error(), "outside the package") {
+		t.Errorf("a command outside its package gave %v", err)
+	}
+}
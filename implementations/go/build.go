@@ -0,0 +1,234 @@
+package strata
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ============================================================================
+// BUILD - Compiling a program to a native binary or to JavaScript
+// ============================================================================
+
+// `strata build [file.str] [-o out] [--target=NAME] [--cc=compiler]
+// [--emit-source]` checks the program and translates its entry module,
+// less the code it can never run, with the backend registered as the
+// target, c by default. The c backend translates it to C and compiles that
+// together with the C runtime; the experimental llvm backend lowers it to
+// LLVM IR instead. Their sources go to a temporary directory that is
+// removed after, unless --emit-source (or --emit-c, or --emit-llvm) keeps
+// them next to the binary, the program as out.c or out.ll.
+//
+// A backend that does not compile, such as js, writes its program to the
+// output, out.js by default for js, and what else it generates next to it.
+// Wherever the program is left, its source map goes beside it, as
+// out.js.map or out.c.map.
+
+// BuildOptions configures a build.
+type BuildOptions struct {
+	// Output is the file to write, by default the entry module's name in
+	// the current directory.
+	Output string
+	// Compiler is the C compiler to run, by default $CC or the first of
+	// cc, gcc and clang on the PATH.
+	Compiler string
+	// EmitSource keeps the generated sources beside the binary.
+	EmitSource bool
+	// Target names the backend, "c" when empty.
+	Target string
+}
+
+// parseBuildFlags splits the flags of strata build from the positional
+// arguments.
+func parseBuildFlags(args []string) (BuildOptions, []string, error) {
+	opts := BuildOptions{Target: "c"}
+	var rest []string
+	for idx := 0; idx < len(args); idx++ {
+		arg := args[idx]
+		name, value, hasValue := strings.Cut(arg, "=")
+		switch {
+		case arg == "-o" || arg == "--output":
+			if idx+1 >= len(args) {
+				return opts, nil, fmt.Errorf("%s needs a file name", arg)
+			}
+			idx++
+			opts.Output = args[idx]
+		case (name == "-o" || name == "--output") && hasValue:
+			opts.Output = value
+		case name == "--cc" && hasValue:
+			opts.Compiler = value
+		case arg == "--emit-source" || arg == "--emit-c" || arg == "--emit-llvm":
+			opts.EmitSource = true
+		case name == "--target" && hasValue:
+			if _, ok := LookupBackend(value); !ok {
+				return opts, nil, fmt.Errorf("unknown target %s; use %s", value, targetList())
+			}
+			opts.Target = value
+		case strings.HasPrefix(arg, "-"):
+			return opts, nil, fmt.Errorf("unknown flag: %s", arg)
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return opts, rest, nil
+}
+
+// findCompiler resolves the C compiler to build with.
+func findCompiler(name string) (string, error) {
+	if name == "" {
+		name = os.Getenv("CC")
+	}
+	if name != "" {
+		path, err := exec.LookPath(name)
+		if err != nil {
+			return "", fmt.Errorf("C compiler %s not found", name)
+		}
+		return path, nil
+	}
+	for _, candidate := range []string{"cc", "gcc", "clang"} {
+		if path, err := exec.LookPath(candidate); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no C compiler found; install cc, gcc or clang, or name one with --cc")
+}
+
+// defaultOutput is the file a build of entry writes when not told: the
+// binary, or for a backend that does not compile its program, named with
+// the program's extension.
+func defaultOutput(entry string, program OutputFile, native bool) string {
+	name := strings.TrimSuffix(filepath.Base(entry), ".str")
+	if !native {
+		return name + filepath.Ext(program.Name)
+	}
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// Build translates the entry module of a checked project with the backend
+// opts.Target names and, if it is a NativeBackend, compiles the result to
+// opts.Output, passing on what the compiler prints to stderr. It returns
+// the files it leaves, the output first.
+func Build(project *Project, opts BuildOptions, stderr io.Writer) ([]string, error) {
+	entry := project.EntryModule()
+	if opts.Target == "" {
+		opts.Target = "c"
+	}
+	backend, ok := LookupBackend(opts.Target)
+	if !ok {
+		return nil, fmt.Errorf("unknown target %s; use %s", opts.Target, targetList())
+	}
+	files, err := backend.Generate(eliminateDeadCode(entry.Statements))
+	if err != nil {
+		return nil, err
+	}
+	native, isNative := backend.(NativeBackend)
+	if opts.Output == "" {
+		opts.Output = defaultOutput(entry.Path, files[0], isNative)
+	}
+	if !isNative {
+		return writeOutputFiles(opts.Output, filepath.Dir(opts.Output), files, entry.Path)
+	}
+
+	dir := filepath.Dir(opts.Output)
+	source := opts.Output + filepath.Ext(files[0].Name)
+	if !opts.EmitSource {
+		if dir, err = os.MkdirTemp("", "strata-build"); err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		source = filepath.Join(dir, files[0].Name)
+	}
+	written, err := writeOutputFiles(source, dir, files, entry.Path)
+	if err != nil {
+		return nil, err
+	}
+	if err := native.Compile(source, dir, opts, stderr); err != nil {
+		return nil, err
+	}
+	if !opts.EmitSource {
+		written = nil
+	}
+	return append([]string{opts.Output}, written...), nil
+}
+
+// writeOutputFiles writes the program to program, with its source map
+// beside it, and the other files to dir, and returns their paths. source
+// is the module the program was generated from.
+func writeOutputFiles(program, dir string, files []OutputFile, source string) ([]string, error) {
+	var written []string
+	for idx, file := range files {
+		path := filepath.Join(dir, file.Name)
+		if idx == 0 {
+			path = program
+		}
+		if err := os.WriteFile(path, []byte(file.Content), 0644); err != nil {
+			return nil, err
+		}
+		written = append(written, path)
+		if idx == 0 && file.SourceMap != nil {
+			mapPath, err := writeSourceMap(path, source, file.SourceMap)
+			if err != nil {
+				return nil, err
+			}
+			written = append(written, mapPath)
+		}
+	}
+	return written, nil
+}
+
+// writeSourceMap saves the map of the program at path, generated from
+// source, as path.map.
+func writeSourceMap(path, source string, m *SourceMap) (string, error) {
+	mapPath := path + ".map"
+	saved := *m
+	saved.File = filepath.Base(path)
+	saved.Source = source
+	if abs, err := filepath.Abs(source); err == nil {
+		if dir, err := filepath.Abs(filepath.Dir(mapPath)); err == nil {
+			if rel, err := filepath.Rel(dir, abs); err == nil {
+				saved.Source = filepath.ToSlash(rel)
+			}
+		}
+	}
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return "", err
+	}
+	return mapPath, os.WriteFile(mapPath, append(data, '\n'), 0644)
+}
+
+// BuildProject runs `strata build` with args and returns its exit code.
+func BuildProject(args []string) int {
+	opts, rest, err := parseBuildFlags(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	project := loadProjectOrReport(targetArg(rest), RunOptions{})
+	if project == nil {
+		return 1
+	}
+	written, err := Build(project, opts, os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	backend, _ := LookupBackend(opts.Target)
+	if _, native := backend.(NativeBackend); native {
+		fmt.Printf("✓ Checked %d module(s), built %s\n", len(project.Order), written[0])
+		if len(written) > 1 {
+			fmt.Printf("  kept %s\n", strings.Join(written[1:], ", "))
+		}
+	} else {
+		fmt.Printf("✓ Checked %d module(s), wrote %s\n", len(project.Order), strings.Join(written, ", "))
+	}
+	return 0
+}
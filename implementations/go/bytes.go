@@ -0,0 +1,218 @@
+package strata
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"unicode/utf8"
+)
+
+// ============================================================================
+// STD::BYTES - Binary data
+// ============================================================================
+
+// Bytes is the runtime value of the bytes type: an immutable sequence of
+// bytes. Indexing gives an int from 0 to 255, slicing gives bytes, and len
+// counts bytes. readFile(path, "bytes") and file.read(path, "bytes") return
+// bytes, and writeFile and file.write write them as they are.
+type Bytes []byte
+
+func (b Bytes) String() string {
+	return "<bytes " + hex.EncodeToString(b) + ">"
+}
+
+// byteEncodings lists the encodings fromString and toString accept.
+const byteEncodings = "utf-8, latin1, ascii, hex or base64"
+
+// encodeString converts s to bytes in the named encoding.
+func encodeString(s, encoding string) (Bytes, error) {
+	switch strings.ToLower(encoding) {
+	case "utf-8", "utf8":
+		return Bytes(s), nil
+	case "latin1", "ascii":
+		limit := rune(0xff)
+		if strings.ToLower(encoding) == "ascii" {
+			limit = 0x7f
+		}
+		out := make(Bytes, 0, len(s))
+		for _, r := range s {
+			if r > limit {
+				return nil, newError(ErrInvalidOperation, "%q cannot be encoded as %s", r, encoding)
+			}
+			out = append(out, byte(r))
+		}
+		return out, nil
+	case "hex":
+		out, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, newError(ErrInvalidOperation, "invalid hex string: %v", err)
+		}
+		return out, nil
+	case "base64":
+		out, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, newError(ErrInvalidOperation, "invalid base64 string: %v", err)
+		}
+		return out, nil
+	}
+	return nil, newError(ErrInvalidOperation, "unknown encoding %q", encoding).withHint("use " + byteEncodings)
+}
+
+// decodeBytes converts b to a string in the named encoding. Invalid UTF-8
+// becomes the replacement character.
+func decodeBytes(b Bytes, encoding string) (string, error) {
+	switch strings.ToLower(encoding) {
+	case "utf-8", "utf8":
+		return strings.ToValidUTF8(string(b), string(utf8.RuneError)), nil
+	case "latin1", "ascii":
+		runes := make([]rune, len(b))
+		for idx, c := range b {
+			if c > 0x7f && strings.ToLower(encoding) == "ascii" {
+				return "", newError(ErrInvalidOperation, "byte %d is 0x%02x, which is not ascii", idx, c)
+			}
+			runes[idx] = rune(c)
+		}
+		return string(runes), nil
+	case "hex":
+		return hex.EncodeToString(b), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString(b), nil
+	}
+	return "", newError(ErrInvalidOperation, "unknown encoding %q", encoding).withHint("use " + byteEncodings)
+}
+
+// bytesFrom converts a string (as UTF-8), bytes, or a list of ints from 0 to
+// 255 to bytes.
+func bytesFrom(name string, v interface{}) (Bytes, error) {
+	switch val := v.(type) {
+	case Bytes:
+		return val, nil
+	case string:
+		return Bytes(val), nil
+	}
+	items, ok := listItems(v)
+	if !ok {
+		return nil, newError(ErrTypeMismatch, "%s expects bytes, a string or a list of ints, got %s", name, describeValue(v))
+	}
+	out := make(Bytes, len(items))
+	for idx, item := range items {
+		n, ok := item.(int64)
+		if !ok || n < 0 || n > 255 {
+			return nil, newError(ErrInvalidOperation, "%s: element %d is %s, not a byte from 0 to 255", name, idx, formatElement(item))
+		}
+		out[idx] = byte(n)
+	}
+	return out, nil
+}
+
+// encodingArg is the optional encoding argument at pos, utf-8 by default.
+func encodingArg(args []interface{}, pos int) string {
+	if len(args) > pos {
+		return toString(args[pos])
+	}
+	return "utf-8"
+}
+
+func bytesModule() map[string]interface{} {
+	return map[string]interface{}{
+		"from": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("from", args, 1); err != nil {
+				return nil, err
+			}
+			return bytesFrom("from", args[0])
+		}),
+		"fromString": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("fromString", args, 1); err != nil {
+				return nil, err
+			}
+			return encodeString(toString(args[0]), encodingArg(args, 1))
+		}),
+		"toString": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("toString", args, 1); err != nil {
+				return nil, err
+			}
+			b, err := bytesFrom("toString", args[0])
+			if err != nil {
+				return nil, err
+			}
+			return decodeBytes(b, encodingArg(args, 1))
+		}),
+		"fromHex": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("fromHex", args, 1); err != nil {
+				return nil, err
+			}
+			return encodeString(toString(args[0]), "hex")
+		}),
+		"toHex": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("toHex", args, 1); err != nil {
+				return nil, err
+			}
+			b, err := bytesFrom("toHex", args[0])
+			if err != nil {
+				return nil, err
+			}
+			return hex.EncodeToString(b), nil
+		}),
+		"toList": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("toList", args, 1); err != nil {
+				return nil, err
+			}
+			b, err := bytesFrom("toList", args[0])
+			if err != nil {
+				return nil, err
+			}
+			items := make([]interface{}, len(b))
+			for idx, c := range b {
+				items[idx] = int64(c)
+			}
+			return items, nil
+		}),
+		"slice": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("slice", args, 2); err != nil {
+				return nil, err
+			}
+			b, err := bytesFrom("slice", args[0])
+			if err != nil {
+				return nil, err
+			}
+			var end interface{}
+			if len(args) > 2 {
+				end = args[2]
+			}
+			return sliceValue(b, args[1], end)
+		}),
+		"concat": NativeFunc(func(args []interface{}) (interface{}, error) {
+			out := Bytes{}
+			for _, arg := range args {
+				b, err := bytesFrom("concat", arg)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, b...)
+			}
+			return out, nil
+		}),
+		"indexOf": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("indexOf", args, 2); err != nil {
+				return nil, err
+			}
+			b, err := bytesFrom("indexOf", args[0])
+			if err != nil {
+				return nil, err
+			}
+			needle, ok := args[1].(int64)
+			if ok {
+				if needle < 0 || needle > 255 {
+					return int64(-1), nil
+				}
+				return int64(bytes.IndexByte(b, byte(needle))), nil
+			}
+			sub, err := bytesFrom("indexOf", args[1])
+			if err != nil {
+				return nil, err
+			}
+			return int64(bytes.Index(b, sub)), nil
+		}),
+	}
+}
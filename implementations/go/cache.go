@@ -0,0 +1,106 @@
+package strata
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ============================================================================
+// MODULE CACHE - Parsed and checked modules keyed by content hash
+// ============================================================================
+
+type ModuleCache struct {
+	Dir string
+}
+
+type cachedModule struct {
+	Statements []*Stmt
+	Errors     []StrataError
+}
+
+func NewModuleCache(root string) *ModuleCache {
+	return &ModuleCache{Dir: filepath.Join(root, ".strata", "cache")}
+}
+
+// buildStamp identifies the running compiler so that entries written by a
+// different build, whose AST may differ, are never loaded.
+var buildStamp = sync.OnceValue(func() string {
+	stamp := Version
+	if exe, err := os.Executable(); err == nil {
+		if info, err := os.Stat(exe); err == nil {
+			stamp += fmt.Sprintf("\x00%d\x00%d", info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return stamp
+})
+
+func (c *ModuleCache) key(source string) string {
+	sum := sha256.Sum256([]byte(buildStamp() + "\x00" + source))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *ModuleCache) path(source string) string {
+	return filepath.Join(c.Dir, c.key(source)+".gob")
+}
+
+// Load returns the cached statements and diagnostics for source, if present.
+func (c *ModuleCache) Load(source string) ([]*Stmt, []error, bool) {
+	data, err := os.ReadFile(c.path(source))
+	if err != nil {
+		return nil, nil, false
+	}
+	var entry cachedModule
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&entry); err != nil {
+		return nil, nil, false
+	}
+	// gob leaves out the resolver's slots, which are unexported, so lay the
+	// functions out again as the parser would have.
+	resolveProgram(entry.Statements)
+	var errs []error
+	for idx := range entry.Errors {
+		errs = append(errs, &entry.Errors[idx])
+	}
+	return entry.Statements, errs, true
+}
+
+// Store records the result of parsing and checking source. Failures are
+// ignored: the cache is only an optimisation.
+func (c *ModuleCache) Store(source string, statements []*Stmt, errs []error) {
+	entry := cachedModule{Statements: statements}
+	for _, err := range errs {
+		diag := StrataError{Message: err.Error()}
+		var located *StrataError
+		if errors.As(err, &located) {
+			diag = *located
+		}
+		entry.Errors = append(entry.Errors, diag)
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(entry); err != nil {
+		return
+	}
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(c.Dir, "entry-*.tmp")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(buf.Bytes())
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path(source))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+}
@@ -0,0 +1,90 @@
+package strata
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestModuleCacheKeepsResolvedSlots(t *testing.T) {
+	statements, err := ParseSource("func add(a: int, b: int) => int {\n  let sum: int = a + b\n  return sum\n}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := NewModuleCache(t.TempDir())
+	cache.Store("source", statements, nil)
+	loaded, _, ok := cache.Load("source")
+	if !ok || len(loaded) != 1 {
+		t.Fatalf("the cache missed: %v, %d statements", ok, len(loaded))
+	}
+	fn := loaded[0]
+	if fn.layout == nil || len(fn.layout.names) != 3 {
+		t.Fatalf("the cached function has no slot layout: %+v", fn.layout)
+	}
+	var slots []int
+	Inspect(fn, func(n Node) bool {
+		if e, ok := n.(*Expr); ok && e.Kind == ExprIdentifier {
+			slots = append(slots, e.addr.slot)
+		}
+		return true
+	})
+	if len(slots) != 3 || slots[0] != 1 || slots[1] != 2 || slots[2] != 3 {
+		t.Errorf("the cached identifiers have slots %v, want [1 2 3]", slots)
+	}
+}
+
+func TestProjectsOnlyReprocessChangedModules(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"Strataumfile": `{"name": "app"}`,
+		"main.str":     "import lib from \"./lib.str\"\nlet n: int = lib.one\n",
+		"lib.str":      "let one: int = 1\nlet bad: string = one\n",
+	})
+	// load reports which modules were parsed and which came from the cache.
+	load := func() (parsed, cached []string, diagnostics string) {
+		t.Helper()
+		var events bytes.Buffer
+		PhaseLog = NewPhaseLogger(&events)
+		defer func() { PhaseLog = nil }()
+		project, err := LoadProject(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(strings.TrimSpace(events.String()), "\n") {
+			var event PhaseEvent
+			json.Unmarshal([]byte(line), &event)
+			switch event.Phase {
+			case "parse":
+				parsed = append(parsed, event.Module)
+			case "cache":
+				cached = append(cached, event.Module)
+			}
+		}
+		sort.Strings(parsed)
+		sort.Strings(cached)
+		var out strings.Builder
+		project.ReportDiagnostics(&out)
+		return parsed, cached, out.String()
+	}
+
+	parsed, cached, first := load()
+	if strings.Join(parsed, " ") != "lib.str main.str" || len(cached) != 0 {
+		t.Fatalf("a cold load parsed %v and loaded %v from the cache", parsed, cached)
+	}
+	parsed, cached, second := load()
+	if len(parsed) != 0 || strings.Join(cached, " ") != "lib.str main.str" {
+		t.Errorf("a warm load parsed %v and loaded %v from the cache", parsed, cached)
+	}
+	if second != first || !strings.Contains(second, "lib.str:2:19") {
+		t.Errorf("cached diagnostics differ:\n%s---\n%s", first, second)
+	}
+
+	os.WriteFile(filepath.Join(root, "main.str"), []byte("import lib from \"./lib.str\"\nlet m: int = lib.one + 1\n"), 0644)
+	if parsed, cached, _ := load(); strings.Join(parsed, " ") != "main.str" || strings.Join(cached, " ") != "lib.str" {
+		t.Errorf("after editing main.str the load parsed %v and loaded %v from the cache", parsed, cached)
+	}
+}
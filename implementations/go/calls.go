@@ -0,0 +1,198 @@
+package strata
+
+// ============================================================================
+// CALL CHECKING - Argument counts and types for function and method calls
+// ============================================================================
+
+// signatureOf builds a builtin's FuncEntry from type names.
+func signatureOf(returns string, params ...string) FuncEntry {
+	entry := FuncEntry{ReturnType: parseTypeAnnotation(returns)}
+	for _, p := range params {
+		entry.Params = append(entry.Params, parseTypeAnnotation(p))
+	}
+	return entry
+}
+
+// builtinSignatures types the builtins whose parameters and results are
+// fixed. Builtins missing here are checked for arity only, at runtime.
+var builtinSignatures = map[string]FuncEntry{
+	"strlen":      signatureOf("int", "string"),
+	"substr":      signatureOf("string", "string", "int", "int"),
+	"toUpperCase": signatureOf("string", "string"),
+	"toLowerCase": signatureOf("string", "string"),
+	"trim":        signatureOf("string", "string"),
+	"split":       signatureOf("list<string>", "string", "string"),
+	"join":        signatureOf("string", "list", "string"),
+	"startsWith":  signatureOf("bool", "string", "string"),
+	"endsWith":    signatureOf("bool", "string", "string"),
+	"includes":    signatureOf("bool", "string", "string"),
+	"indexOf":     signatureOf("int", "string", "string"),
+	"replace":     signatureOf("string", "string", "string", "string"),
+	"replaceAll":  signatureOf("string", "string", "string", "string"),
+	"repeat":      signatureOf("string", "string", "int"),
+	"len":         signatureOf("int", "any"),
+	"abs":         signatureOf("float", "float"),
+	"sqrt":        signatureOf("float", "float"),
+	"pow":         signatureOf("float", "float", "float"),
+	"sin":         signatureOf("float", "float"),
+	"cos":         signatureOf("float", "float"),
+	"tan":         signatureOf("float", "float"),
+	"exp":         signatureOf("float", "float"),
+	"log":         signatureOf("float", "float"),
+	"floor":       signatureOf("int", "float"),
+	"ceil":        signatureOf("int", "float"),
+	"round":       signatureOf("int", "float"),
+	"max":         {Params: []TypeDef{TypeRegistry["float"], TypeRegistry["float"], TypeRegistry["float"]}, ReturnType: TypeRegistry["float"], Variadic: true},
+	"min":         {Params: []TypeDef{TypeRegistry["float"], TypeRegistry["float"], TypeRegistry["float"]}, ReturnType: TypeRegistry["float"], Variadic: true},
+	"typeof":      signatureOf("string", "any"),
+	"parseInt":    {Params: []TypeDef{TypeRegistry["string"], TypeRegistry["int"]}, ReturnType: TypeRegistry["int"], Variadic: true},
+	"parseFloat":  signatureOf("float", "string"),
+	"channel":     {Params: []TypeDef{TypeRegistry["int"]}, ReturnType: TypeRegistry["channel"], Variadic: true},
+	"format":      {Params: []TypeDef{TypeRegistry["string"], TypeRegistry["any"]}, ReturnType: TypeRegistry["string"], Variadic: true},
+	"toString":    signatureOf("string", "any"),
+	"toBoolean":   signatureOf("bool", "any"),
+	"isOk":        signatureOf("bool", "result"),
+	"isErr":       signatureOf("bool", "result"),
+	"isSome":      signatureOf("bool", "option"),
+	"isNone":      signatureOf("bool", "option"),
+}
+
+// intPreserving lists the builtins whose result is an int when every
+// argument is.
+var intPreserving = map[string]bool{"abs": true, "max": true, "min": true}
+
+// callType is the type of a call's result.
+func (tc *TypeChecker) callType(expr *Expr, name string, entry FuncEntry) TypeDef {
+	if !intPreserving[name] || expr.Func.Kind != ExprIdentifier {
+		return entry.ReturnType
+	}
+	if _, declared := tc.Env.GetFunction(name); declared {
+		return entry.ReturnType
+	}
+	for _, arg := range expr.Args {
+		if t := tc.inferType(arg); t.Kind != KindPrimitive || t.Primitive != TypeInt {
+			return entry.ReturnType
+		}
+	}
+	return TypeRegistry["int"]
+}
+
+// funcEntry is the signature a function declaration gives its name.
+func (tc *TypeChecker) funcEntry(stmt *Stmt) FuncEntry {
+	entry := FuncEntry{ReturnType: tc.resolveType(stmt.ReturnType)}
+	for _, p := range stmt.Params {
+		entry.Params = append(entry.Params, tc.resolveType(p.Type))
+		entry.Variadic = p.Variadic
+	}
+	if stmt.Async {
+		result := entry.ReturnType
+		entry.ReturnType = TypeDef{Kind: KindPrimitive, Primitive: TypePromise, InnerType: &result}
+	}
+	return entry
+}
+
+// callSignature returns the signature of the function expr calls and a name
+// for messages. Calls through variables and modules have no known signature.
+func (tc *TypeChecker) callSignature(expr *Expr) (FuncEntry, string, bool) {
+	switch callee := expr.Func; callee.Kind {
+	case ExprIdentifier:
+		if _, isVar := tc.Env.Lookup(callee.Name); isVar {
+			return FuncEntry{}, "", false
+		}
+		if entry, ok := tc.Env.GetFunction(callee.Name); ok {
+			return entry, callee.Name, true
+		}
+		if class, ok := tc.Classes[callee.Name]; ok {
+			entry := FuncEntry{ReturnType: TypeDef{Kind: KindClass, Name: callee.Name}}
+			if init := classMethod(class, "init"); init != nil {
+				initEntry := tc.funcEntry(init)
+				entry.Params, entry.Variadic = initEntry.Params, initEntry.Variadic
+			}
+			return entry, callee.Name, true
+		}
+		entry, ok := builtinSignatures[callee.Name]
+		return entry, callee.Name, ok
+	case ExprMember:
+		object := tc.inferType(callee.Object)
+		if object.Kind != KindClass {
+			return FuncEntry{}, "", false
+		}
+		if method := classMethod(tc.Classes[object.Name], callee.Property); method != nil {
+			return tc.funcEntry(method), object.Name + "." + callee.Property, true
+		}
+	}
+	return FuncEntry{}, "", false
+}
+
+func classMethod(class *Stmt, name string) *Stmt {
+	if class == nil {
+		return nil
+	}
+	for _, member := range class.Body {
+		if member.Kind == StmtFunction && member.Name == name {
+			return member
+		}
+	}
+	return nil
+}
+
+// checkCalls verifies the argument count and types of every call in expr
+// whose callee has a known signature.
+func (tc *TypeChecker) checkCalls(expr *Expr) error {
+	if expr == nil {
+		return nil
+	}
+	if expr.Kind == ExprCall {
+		if entry, name, ok := tc.callSignature(expr); ok {
+			if err := tc.checkCall(expr, name, entry); err != nil {
+				return err
+			}
+			// the arguments were checked against the parameters above
+			return tc.checkCalls(expr.Func)
+		}
+	}
+	for _, child := range exprChildren(expr) {
+		if err := tc.checkCalls(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tc *TypeChecker) checkCall(expr *Expr, name string, entry FuncEntry) error {
+	fixed := len(entry.Params)
+	if entry.Variadic {
+		fixed--
+	}
+	spread := false
+	for idx, arg := range expr.Args {
+		if arg.Kind == ExprSpread {
+			// a spread's length is only known at runtime
+			spread = true
+			if err := tc.checkExpression(arg.Operand, TypeDef{Kind: KindPrimitive, Primitive: TypeAny}); err != nil {
+				return err
+			}
+			continue
+		}
+		param := TypeDef{Kind: KindPrimitive, Primitive: TypeAny}
+		switch {
+		case spread:
+		case idx < fixed:
+			param = entry.Params[idx]
+		case entry.Variadic:
+			param = entry.Params[fixed]
+		}
+		if err := tc.checkExpression(arg, param); err != nil {
+			diag := diagnose(err, ErrTypeMismatch, arg.Location)
+			return newError(ErrTypeMismatch, "argument %d of %s: %s", idx+1, name, diag.Message).at(diag.Location)
+		}
+	}
+	switch {
+	case spread:
+	case entry.Variadic && len(expr.Args) < fixed:
+		return newError(ErrArity, "%s expects at least %d argument(s), got %d", name, fixed, len(expr.Args)).at(expr.Location)
+	case !entry.Variadic && len(expr.Args) != fixed:
+		return newError(ErrArity, "%s expects %d argument(s), got %d", name, fixed, len(expr.Args)).at(expr.Location)
+	}
+	return nil
+}
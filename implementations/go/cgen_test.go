@@ -0,0 +1,263 @@
+package strata
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// generateC parses source and translates it with CGenerator.
+func generateC(t *testing.T, source string) string {
+	t.Helper()
+	statements, err := ParseSource(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := NewCGenerator().Generate(statements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// runtimeDir writes the C runtime to a temporary directory and returns it,
+// along with the C compiler, skipping the test when none is installed.
+func runtimeDir(t *testing.T) (cc, dir string) {
+	t.Helper()
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no C compiler")
+	}
+	dir = t.TempDir()
+	for name, content := range CRuntimeFiles() {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cc, dir
+}
+
+// compileC checks that code compiles warning-free, when a C compiler is
+// installed.
+func compileC(t *testing.T, code string) {
+	t.Helper()
+	cc, dir := runtimeDir(t)
+	cmd := exec.Command(cc, "-Wall", "-Werror", "-fsyntax-only", "-I", dir, "-x", "c", "-")
+	cmd.Stdin = strings.NewReader(code)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v\n%s\n%s", err, out, code)
+	}
+}
+
+// runC compiles code with the runtime and returns what the program prints.
+func runC(t *testing.T, code string) string {
+	t.Helper()
+	cc, dir := runtimeDir(t)
+	source, binary := filepath.Join(dir, "main.c"), filepath.Join(dir, "main")
+	if err := os.WriteFile(source, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+	build := exec.Command(cc, "-Wall", "-Werror", "-o", binary, source, filepath.Join(dir, "strata_runtime.c"), "-lm")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("%v\n%s\n%s", err, out, code)
+	}
+	out, err := exec.Command(binary).Output()
+	if err != nil {
+		t.Fatalf("%v\n%s", err, code)
+	}
+	return string(out)
+}
+
+func TestCGeneratorFunctionsAndControlFlow(t *testing.T) {
+	code := generateC(t, `func fib(n: int) => int {
+  if (n < 2) { return n }
+  return fib(n - 1) + fib(n - 2)
+}
+func sign(n: int) => int {
+  if (n < 0) { return 0 - 1 } else if (n == 0) { return 0 } else { return 1 }
+}
+func reset() => void { return }
+var total: int = 0
+var i: int = 0
+while (i < 10) {
+  i = i + 1
+  if (i % 2 == 0) { continue }
+  total = total + fib(i)
+}
+for (var j: int = 0; j < 5; j = j + 1) {
+  if (j == 3) { break }
+  total = total + sign(j)
+} else {
+  total = 0
+}
+reset()
+`)
+	for _, want := range []string{
+		"long long fib(long long n);",
+		"void reset(void) {\n    return;\n}",
+		"} else if ((n == 0)) {",
+		"for (; (j < 5); j = (j + 1)) {",
+		"strata_broke_1 = 1;\n            break;",
+		"if (!strata_broke_1) {",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code lacks %q:\n%s", want, code)
+		}
+	}
+	compileC(t, code)
+}
+
+func TestCGeneratorRuntimeMatchesInterpreter(t *testing.T) {
+	source := `import io from std::io
+import math from std::math
+func greet(name: string) => string {
+  return "Hello, " + name + "!"
+}
+let words: list<string> = split("a,b,c", ",")
+var shout: string = ""
+var i: int = 0
+while (i < len(words)) {
+  shout = shout + toUpperCase(words[i])
+  i = i + 1
+}
+var ages: map<string, int> = {"ann": 31, "bob": 27}
+ages["cy"] = 40
+var mixed: list = [1, "two", 3.5, true]
+mixed[0] = 10
+io.print(greet("C"))
+io.print(shout + " " + join(words, "-"))
+io.print(ages["ann"] + ages["cy"])
+io.print(ages)
+io.print(mixed)
+io.print(len(ages))
+io.print(substr("strata", 1, 4) + " " + replaceAll("a-b-c", "-", "+"))
+io.print(strlen("héllo") == 5)
+io.print(math.sqrt(16.0) + 0.5)
+io.print(floor(2.7) + abs(0 - 3))
+io.print(toString(7) + "\"quoted\"\tand tabbed")
+`
+	var want strings.Builder
+	if err := RunSource(source, RunOptions{Stdout: &want}); err != nil {
+		t.Fatal(err)
+	}
+	code := generateC(t, source)
+	if got := runC(t, code); got != want.String() {
+		t.Errorf("compiled program printed\n%s\nthe interpreter\n%s\n%s", got, want.String(), code)
+	}
+}
+
+func TestCGeneratorLiterals(t *testing.T) {
+	source := `import io from std::io
+var half: float = 1.0 / 2
+var scaled: float = 3
+var done: bool = false
+if (true) { done = !done }
+io.print(half)
+io.print(scaled / 2)
+io.print(5000000000 * 2)
+io.print(done)
+func twice(n: int) => int {
+  return n * 2
+}
+let big: int = 10000000000
+io.print(twice(big))
+`
+	var want strings.Builder
+	if err := RunSource(source, RunOptions{Stdout: &want}); err != nil {
+		t.Fatal(err)
+	}
+	code := generateC(t, source)
+	for _, want := range []string{"half = (1.0 / 2);", "scaled = 3.0;", "5000000000LL", "done = 0;", "static long long big;", "long long twice(long long n)", "if (1) {"} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code lacks %q:\n%s", want, code)
+		}
+	}
+	if got := runC(t, code); got != want.String() {
+		t.Errorf("compiled program printed\n%s\nthe interpreter\n%s\n%s", got, want.String(), code)
+	}
+
+	source = `import io from std::io
+let c: char = 'a'
+let quote: char = '\''
+let accent: char = '\u00e9'
+var chars: list = [c, accent]
+io.print("" + c + quote + accent)
+io.print(c == 'a')
+io.print(chars)
+`
+	want.Reset()
+	if err := RunSource(source, RunOptions{Stdout: &want}); err != nil {
+		t.Fatal(err)
+	}
+	code = generateC(t, source)
+	for _, want := range []string{"c = 'a';", `quote = '\'';`, "accent = 233;"} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code lacks %q:\n%s", want, code)
+		}
+	}
+	if got := runC(t, code); got != want.String() {
+		t.Errorf("compiled program printed\n%s\nthe interpreter\n%s\n%s", got, want.String(), code)
+	}
+}
+
+func TestBuildCompilesABinary(t *testing.T) {
+	if _, err := exec.LookPath("cc"); err != nil {
+		t.Skip("no C compiler")
+	}
+	dir := t.TempDir()
+	entry := filepath.Join(dir, "hello.str")
+	source := "import io from std::io\nio.print(\"built \" + toString(6 * 7))\n"
+	if err := os.WriteFile(entry, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	project, err := LoadProject(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "hello")
+	var stderr strings.Builder
+	if _, err := Build(project, BuildOptions{Output: output, EmitSource: true}, &stderr); err != nil {
+		t.Fatalf("%v\n%s", err, stderr.String())
+	}
+	for _, kept := range []string{"hello.c", "hello.c.map", "strata_runtime.c", "strata_runtime.h"} {
+		if _, err := os.Stat(filepath.Join(dir, kept)); err != nil {
+			t.Errorf("--emit-source did not keep %s", kept)
+		}
+	}
+	out, err := exec.Command(output).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "built 42\n" {
+		t.Errorf("binary printed %q", out)
+	}
+}
+
+func TestCGeneratorRejectsWhatItCannotExpress(t *testing.T) {
+	for _, tc := range []struct {
+		source, message string
+		line, column    int
+	}{
+		{"class C {\n  var n: int = 0\n}\n", "class statements are not supported", 1, 1},
+		{"func outer() => int {\n  func add(a: int) => int {\n    return a\n  }\n  return add(1)\n}\n", "function statements are not supported", 2, 3},
+		{"func add(a: int) => int {\n  return a\n}\nlet f: any = add\n", "function values are not supported", 4, 14},
+		{"let c: any = 1\nc.inc(1)\n", "cannot call inc", 2, 1},
+	} {
+		statements, err := ParseSource(tc.source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = NewCGenerator().Generate(statements)
+		var diag *StrataError
+		if !errors.As(err, &diag) || !strings.Contains(diag.Message, tc.message) {
+			t.Errorf("%q: got error %v, want %q", tc.source, err, tc.message)
+			continue
+		}
+		if diag.Location.Line != tc.line || diag.Location.Column != tc.column {
+			t.Errorf("%q: error at %d:%d, want %d:%d", tc.source, diag.Location.Line, diag.Location.Column, tc.line, tc.column)
+		}
+	}
+}
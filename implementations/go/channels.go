@@ -0,0 +1,299 @@
+package strata
+
+import (
+	"reflect"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// CHANNELS - spawn, channel values and select
+// ============================================================================
+
+// `spawn f(args)` calls the Strata function f on a worker, as calling an
+// async function does, and returns the promise of its result, so awaiting
+// it joins the worker. Workers and their caller talk over channels.
+// channel() makes an unbuffered channel and channel(n) one that buffers n
+// values; their methods are send, receive and close, which behave as Go's.
+// receive yields null once the channel is closed and drained. A value is
+// copied as it is sent, so the receiver never shares a list, map or object
+// with the sender.
+//
+// select waits until one of its cases can send or receive, and runs it:
+//
+//	select {
+//	  msg = inbox.receive() => io.print(msg)
+//	  outbox.send(next) => { sent = sent + 1 }
+//	  _ => io.print("nothing ready")
+//	}
+//
+// The `_` case runs when no other case is ready; without one select blocks.
+//
+// A run in which every task, the main program and each spawned or async
+// worker, is waiting on a channel or a promise can never go on, so the waits
+// fail with a deadlock error instead of hanging, as Go's runtime would.
+
+// Channel carries values between interpreters.
+type Channel struct {
+	ch chan interface{}
+}
+
+func newChannel(capacity int) *Channel {
+	return &Channel{ch: make(chan interface{}, capacity)}
+}
+
+func (c *Channel) String() string {
+	return "<channel>"
+}
+
+// channelBuiltin is channel([capacity]).
+func channelBuiltin(args []interface{}) interface{} {
+	if len(args) == 0 {
+		return newChannel(0)
+	}
+	n, ok := args[0].(int64)
+	if !ok || n < 0 {
+		return newError(ErrInvalidOperation, "channel expects a capacity of zero or more, got %s", formatValue(args[0]))
+	}
+	return newChannel(int(n))
+}
+
+// sendable copies value for sending to another interpreter.
+func sendable(value interface{}) interface{} {
+	c := &isolation{copies: make(map[interface{}]interface{}), data: true}
+	return c.value(value)
+}
+
+// member returns one of the channel's methods, whose waits count in t.
+func (c *Channel) member(name string, t *tasks) (interface{}, error) {
+	switch name {
+	case "send":
+		return NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("send", args, 1); err != nil {
+				return nil, err
+			}
+			return nil, c.send(sendable(args[0]), t)
+		}), nil
+	case "receive":
+		return NativeFunc(func(args []interface{}) (interface{}, error) {
+			return c.receive(t)
+		}), nil
+	case "close":
+		return NativeFunc(func(args []interface{}) (interface{}, error) {
+			return nil, c.close()
+		}), nil
+	}
+	return nil, newError(ErrUndefined, "channel has no member %s", name)
+}
+
+// send reports sending on a closed channel, which panics in Go, as an error.
+func (c *Channel) send(value interface{}, t *tasks) (err error) {
+	defer func() {
+		if recover() != nil {
+			err = newError(ErrInvalidOperation, "send on closed channel")
+		}
+	}()
+	_, _, _, err = t.wait([]reflect.SelectCase{{Dir: reflect.SelectSend, Chan: reflect.ValueOf(c.ch), Send: reflect.ValueOf(&value).Elem()}})
+	return err
+}
+
+// receive waits for a value, or yields null once the channel is closed and
+// drained.
+func (c *Channel) receive(t *tasks) (interface{}, error) {
+	_, value, ok, err := t.wait([]reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.ch)}})
+	if err != nil || !ok {
+		return nil, err
+	}
+	return value.Interface(), nil
+}
+
+func (c *Channel) close() (err error) {
+	defer func() {
+		if recover() != nil {
+			err = newError(ErrInvalidOperation, "channel is already closed")
+		}
+	}()
+	close(c.ch)
+	return nil
+}
+
+// isChannelOp reports whether expr is a call of send or receive on some
+// object, the only expressions a select case may wait on.
+func isChannelOp(expr *Expr) bool {
+	if expr.Kind != ExprCall || expr.Func.Kind != ExprMember {
+		return false
+	}
+	switch expr.Func.Property {
+	case "send":
+		return len(expr.Args) == 1
+	case "receive":
+		return len(expr.Args) == 0
+	}
+	return false
+}
+
+// interpretSelect runs a select statement. The channels and the values to
+// send are evaluated first, in order, then the statement waits for a case
+// to proceed and runs its body in a scope of its own.
+func (i *Interpreter) interpretSelect(stmt *Stmt) (err error) {
+	var cases []reflect.SelectCase
+	var arms []MatchCase
+	var fallback *MatchCase
+	for idx, c := range stmt.Cases {
+		if c.Pattern.Wildcard {
+			fallback = &stmt.Cases[idx]
+			continue
+		}
+		op := c.Pattern.Value
+		obj, err := i.evaluateExpression(op.Func.Object)
+		if err != nil {
+			return err
+		}
+		ch, ok := obj.(*Channel)
+		if !ok {
+			return i.locate(newError(ErrTypeMismatch, "select expects a channel, got %s", describeValue(obj)), op.Location)
+		}
+		selectCase := reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch.ch)}
+		if op.Func.Property == "send" {
+			value, err := i.evaluateExpression(op.Args[0])
+			if err != nil {
+				return err
+			}
+			value = sendable(value)
+			selectCase.Dir = reflect.SelectSend
+			selectCase.Send = reflect.ValueOf(&value).Elem()
+		}
+		cases = append(cases, selectCase)
+		arms = append(arms, c)
+	}
+	if fallback != nil {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectDefault})
+	}
+	if len(cases) == 0 {
+		return newError(ErrInvalidOperation, "select has no cases")
+	}
+
+	defer func() {
+		if recover() != nil {
+			err = newError(ErrInvalidOperation, "send on closed channel")
+		}
+	}()
+	var chosen int
+	var received reflect.Value
+	var ok bool
+	if fallback != nil {
+		chosen, received, ok = reflect.Select(cases)
+	} else if chosen, received, ok, err = i.tasks.wait(cases); err != nil {
+		return i.locate(err, stmt.Location)
+	}
+
+	env := i.Env
+	defer func() { i.Env = env }()
+	i.Env = newScope(env, nil)
+	if chosen == len(arms) {
+		return i.runBlock(fallback.Body)
+	}
+	arm := arms[chosen]
+	if len(arm.Pattern.Bindings) > 0 {
+		var value interface{}
+		if ok {
+			value = received.Interface()
+		}
+		i.Env.Set(arm.Pattern.Bindings[0], value, false)
+	}
+	return i.runBlock(arm.Body)
+}
+
+// deadlockGrace is how long every task must have been waiting, with none
+// resuming, before the run counts as deadlocked. Two tasks meeting on an
+// unbuffered channel both count as waiting for the moment before the
+// exchange.
+const deadlockGrace = 50 * time.Millisecond
+
+// tasks counts the tasks of a run, the interpreters that can still make
+// progress, and how many of them are waiting in wait. It is shared by an
+// interpreter and its workers. A nil tasks counts nothing.
+type tasks struct {
+	mu      sync.Mutex
+	running int
+	waiting int
+	// changes counts the tasks that resumed, started or stopped, so a
+	// deadlock check can tell whether anything moved since it was set.
+	changes  int
+	deadlock chan struct{}
+}
+
+// newTasks returns the tasks of a run, counting the main program.
+func newTasks() *tasks {
+	return &tasks{running: 1, deadlock: make(chan struct{})}
+}
+
+// start counts a task about to run on a goroutine of its own.
+func (t *tasks) start() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.running++
+	t.changes++
+}
+
+// stop counts a task as finished.
+func (t *tasks) stop() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.running--
+	t.changes++
+	t.check()
+}
+
+// check, with t.mu held, arranges for the waits to fail if every task is
+// still waiting, and nothing has resumed, after deadlockGrace.
+func (t *tasks) check() {
+	if t.running == 0 || t.waiting < t.running {
+		return
+	}
+	changes := t.changes
+	time.AfterFunc(deadlockGrace, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.changes == changes && t.running > 0 && t.waiting >= t.running {
+			close(t.deadlock)
+			t.deadlock = make(chan struct{})
+		}
+	})
+}
+
+// wait is reflect.Select over cases, which must not have a default, except
+// that it fails when every task of the run is waiting.
+func (t *tasks) wait(cases []reflect.SelectCase) (int, reflect.Value, bool, error) {
+	ready := append(cases[:len(cases):len(cases)], reflect.SelectCase{Dir: reflect.SelectDefault})
+	if chosen, value, ok := reflect.Select(ready); chosen < len(cases) {
+		return chosen, value, ok, nil
+	}
+	if t == nil {
+		chosen, value, ok := reflect.Select(cases)
+		return chosen, value, ok, nil
+	}
+	t.mu.Lock()
+	t.waiting++
+	t.check()
+	deadlock := t.deadlock
+	t.mu.Unlock()
+	chosen, value, ok := reflect.Select(append(cases[:len(cases):len(cases)], reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(deadlock)}))
+	t.mu.Lock()
+	t.waiting--
+	t.changes++
+	t.mu.Unlock()
+	if chosen == len(cases) {
+		// A case that became ready as the deadlock was declared still wins.
+		if chosen, value, ok = reflect.Select(ready); chosen == len(cases) {
+			return chosen, value, ok, newError(ErrInvalidOperation, "deadlock: every task is waiting on a channel or a promise")
+		}
+	}
+	return chosen, value, ok, nil
+}
@@ -0,0 +1,106 @@
+package strata
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ============================================================================
+// CHECK - strata check parses and type-checks without running anything
+// ============================================================================
+
+// CheckTarget parses and type-checks target and every module it imports,
+// printing all diagnostics to w. A directory is checked as a project: its
+// entrypoint, if it has one, and then every other .str file below it, so
+// modules nothing imports yet are checked too. Hidden directories such as
+// .strata are skipped. It returns the number of modules checked and of
+// errors found.
+func CheckTarget(target string, w io.Writer) (modules, errs int, err error) {
+	info, err := os.Stat(target)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !info.IsDir() {
+		project, err := LoadProject(target)
+		if err != nil {
+			return 0, 0, err
+		}
+		return len(project.Order), project.ReportDiagnostics(w), nil
+	}
+
+	root, err := filepath.Abs(target)
+	if err != nil {
+		return 0, 0, err
+	}
+	project := &Project{Root: root, Modules: make(map[string]*SourceModule)}
+	if _, err := os.Stat(filepath.Join(root, "Strataumfile")); err == nil {
+		project.Cache = NewModuleCache(root)
+	}
+	files, err := sourceFiles(root)
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, entry, err := resolveEntrypoint(root); err == nil {
+		project.Entry = entry
+		files = append([]string{entry}, files...)
+	}
+	var order []string
+	seen := make(map[string]bool)
+	for _, file := range files {
+		if _, loaded := project.Modules[file]; loaded {
+			continue
+		}
+		if err := project.loadAll(file); err != nil {
+			return 0, 0, err
+		}
+		for _, path := range project.Order {
+			if !seen[path] {
+				seen[path] = true
+				order = append(order, path)
+			}
+		}
+	}
+	project.Order = order
+	return len(order), project.ReportDiagnostics(w), nil
+}
+
+// sourceFiles lists the .str files below dir in path order, leaving out
+// hidden directories.
+func sourceFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && path != dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() && strings.HasSuffix(path, ".str") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// CheckProject runs `strata check` on target, printing the diagnostics and
+// a summary, and returns its exit code.
+func CheckProject(target string) int {
+	modules, errs, err := CheckTarget(target, os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if errs > 0 {
+		fmt.Fprintf(os.Stderr, "✗ Found %d error(s) in %d module(s)\n", errs, modules)
+		return 1
+	}
+	fmt.Printf("✓ Checked %d module(s), no errors\n", modules)
+	return 0
+}
@@ -0,0 +1,64 @@
+package strata
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckCountsErrorsAcrossAProject(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	root := t.TempDir()
+	files := map[string]string{
+		"main.str": `import io from std::io
+import util from util
+io.print(util.twice(2))
+let wrong: string = 1
+`,
+		"util.str": `func twice(n: int) => int {
+  return n * 2
+}
+let bad: int = "x"
+`,
+		"orphan.str":       "let flag: bool = 0\n",
+		"ok.str":           "let fine: int = 1\n",
+		".strata/skip.str": "let skipped: int = \"never checked\"\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+
+	var out strings.Builder
+	modules, errs, err := CheckTarget(root, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if modules != 4 || errs != 3 {
+		t.Errorf("checked %d modules with %d errors, want 4 and 3:\n%s", modules, errs, out.String())
+	}
+	for _, want := range []string{"main.str:4:", "util.str:4:", "orphan.str:1:"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("no diagnostic at %s in:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "skip.str") {
+		t.Errorf("a hidden directory was checked:\n%s", out.String())
+	}
+
+	modules, errs, err = CheckTarget(filepath.Join(root, "main.str"), &out)
+	if err != nil || modules != 2 || errs != 2 {
+		t.Errorf("checking main.str gave %d modules, %d errors, %v; want its import too", modules, errs, err)
+	}
+	if code := CheckProject(root); code != 1 {
+		t.Errorf("check with errors exited %d", code)
+	}
+	if code := CheckProject(filepath.Join(root, "ok.str")); code != 0 {
+		t.Errorf("check without errors exited %d", code)
+	}
+	if code := CheckProject(filepath.Join(root, "missing.str")); code != 1 {
+		t.Errorf("check of a missing file exited %d", code)
+	}
+}
@@ -0,0 +1,191 @@
+package strata
+
+import "strings"
+
+// ============================================================================
+// CLASSES - Class declarations, instances, methods and this
+// ============================================================================
+
+// ClassType is the runtime value bound to a class's name. Calling it
+// constructs an instance: fields get their initial values and the init
+// method, if any, receives the call's arguments.
+type ClassType struct {
+	Name    string
+	Fields  []*Stmt
+	Methods map[string]*FuncDef
+	// Scope is where the class was declared; field initializers run there.
+	Scope *Environment
+}
+
+func (c *ClassType) String() string {
+	return "<class " + c.Name + ">"
+}
+
+// Instance is an object created from a class. Fields declared with var can
+// be reassigned through any reference to the instance.
+type Instance struct {
+	Class  *ClassType
+	Fields map[string]*VarEntry
+}
+
+func (o *Instance) String() string {
+	parts := make([]string, len(o.Class.Fields))
+	for idx, field := range o.Class.Fields {
+		parts[idx] = field.Name + ": " + formatElement(o.Fields[field.Name].Value)
+	}
+	return o.Class.Name + "{" + strings.Join(parts, ", ") + "}"
+}
+
+// declareClass builds the class a StmtClass describes. Methods close over
+// the scope the class is declared in.
+func (i *Interpreter) declareClass(stmt *Stmt) *ClassType {
+	class := &ClassType{Name: stmt.Name, Methods: make(map[string]*FuncDef), Scope: i.Env}
+	for _, member := range stmt.Body {
+		if member.Kind == StmtLet {
+			class.Fields = append(class.Fields, member)
+			continue
+		}
+		method := &FuncDef{Name: member.Name, Body: member.Body, Closure: i.Env, Module: i.module, Decl: member}
+		for _, p := range member.Params {
+			method.Params = append(method.Params, p.Name)
+			method.Variadic = p.Variadic
+		}
+		class.Methods[member.Name] = method
+	}
+	return class
+}
+
+// instantiate creates an instance of class and runs its init method.
+func (i *Interpreter) instantiate(class *ClassType, args []interface{}) (interface{}, error) {
+	obj := &Instance{Class: class, Fields: make(map[string]*VarEntry)}
+	env := i.Env
+	i.Env = class.Scope
+	for _, field := range class.Fields {
+		value, err := i.evaluateExpression(field.Value)
+		if err != nil {
+			i.Env = env
+			return nil, err
+		}
+		obj.Fields[field.Name] = &VarEntry{Value: value, Mutable: field.Mutable}
+	}
+	i.Env = env
+	init, ok := class.Methods["init"]
+	if !ok {
+		if len(args) > 0 {
+			return nil, newError(ErrArity, "%s expects 0 argument(s), got %d", class.Name, len(args))
+		}
+		return obj, nil
+	}
+	if _, err := i.callFunction(class.Name+".init", obj.bind(init), args); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// bind returns method with this set to the instance.
+func (o *Instance) bind(method *FuncDef) *FuncDef {
+	env := NewEnvironment()
+	env.Parent = method.Closure
+	env.Set("this", o, false)
+	bound := *method
+	bound.Closure = env
+	return &bound
+}
+
+// member reads a field or a bound method.
+func (o *Instance) member(name string) (interface{}, error) {
+	if entry, ok := o.Fields[name]; ok {
+		return entry.Value, nil
+	}
+	if method, ok := o.Class.Methods[name]; ok {
+		return o.bind(method), nil
+	}
+	return nil, newError(ErrUndefined, "%s has no member %s", o.Class.Name, name)
+}
+
+// fieldEntry returns the field a member expression such as `this.count`
+// names, for assignment.
+func (i *Interpreter) fieldEntry(target *Expr) (*VarEntry, error) {
+	obj, err := i.evaluateExpression(target.Object)
+	if err != nil {
+		return nil, err
+	}
+	instance, ok := obj.(*Instance)
+	if !ok {
+		return nil, newError(ErrInvalidOperation, "cannot assign property %s of %s", target.Property, describeValue(obj))
+	}
+	entry, ok := instance.Fields[target.Property]
+	if !ok {
+		return nil, newError(ErrUndefined, "%s has no field %s", instance.Class.Name, target.Property)
+	}
+	if !entry.Mutable {
+		return nil, newError(ErrImmutable, "cannot modify immutable field: %s", target.Property).withHint("declare the field with var to allow modification")
+	}
+	return entry, nil
+}
+
+// assignMember stores value in an instance field.
+func (i *Interpreter) assignMember(target *Expr, value interface{}) error {
+	entry, err := i.fieldEntry(target)
+	if err != nil {
+		return err
+	}
+	entry.Value = value
+	return nil
+}
+
+func (tc *TypeChecker) checkClass(stmt *Stmt) error {
+	if _, exists := tc.Classes[stmt.Name]; exists {
+		return newError(ErrDuplicate, "class %s is already declared", stmt.Name)
+	}
+	seen := make(map[string]bool)
+	for _, member := range stmt.Body {
+		if seen[member.Name] {
+			return newError(ErrDuplicate, "duplicate member %s in class %s", member.Name, stmt.Name)
+		}
+		seen[member.Name] = true
+	}
+	tc.Classes[stmt.Name] = stmt
+	for _, member := range stmt.Body {
+		if member.Kind == StmtLet {
+			if err := tc.checkExpression(member.Value, tc.resolveType(member.Type)); err != nil {
+				return err
+			}
+		}
+	}
+
+	var methods []*Stmt
+	for _, member := range stmt.Body {
+		if member.Kind == StmtFunction {
+			methods = append(methods, member)
+		}
+	}
+	return tc.checkScope(methods, func() error {
+		tc.Env.Vars["this"] = TypeEnvEntry{Type: TypeDef{Kind: KindClass, Name: stmt.Name}}
+		return nil
+	})
+}
+
+// classType infers the type of a constructor call or of a field read from a
+// class-typed value.
+func (tc *TypeChecker) classType(expr *Expr) (TypeDef, bool) {
+	if expr.Kind == ExprCall && expr.Func.Kind == ExprIdentifier {
+		if _, ok := tc.Classes[expr.Func.Name]; ok {
+			return TypeDef{Kind: KindClass, Name: expr.Func.Name}, true
+		}
+	}
+	if expr.Kind != ExprMember {
+		return TypeDef{}, false
+	}
+	object := tc.inferType(expr.Object)
+	class, ok := tc.Classes[object.Name]
+	if object.Kind != KindClass || !ok {
+		return TypeDef{}, false
+	}
+	for _, member := range class.Body {
+		if member.Kind == StmtLet && member.Name == expr.Property {
+			return tc.resolveType(member.Type), true
+		}
+	}
+	return TypeDef{}, false
+}
@@ -0,0 +1,220 @@
+// Command strata runs, checks, builds and packages Strata programs.
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	strata "strata-compiler"
+)
+
+func main() {
+	strata.LoadPluginPath()
+	args := os.Args[1:]
+
+	if len(args) > 0 {
+		command := args[0]
+		pm := strata.NewPackageManager("")
+
+		switch command {
+		case "init":
+			if err := strata.InitCommand(args[1:], os.Stdin); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "install":
+			pkgName, global := "", false
+			for _, arg := range args[1:] {
+				if arg == "-g" || arg == "--global" {
+					global = true
+				} else if pkgName == "" {
+					pkgName = arg
+				}
+			}
+			var err error
+			if global {
+				err = strata.InstallGlobal(pkgName)
+			} else {
+				err = pm.Install(pkgName)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "add":
+			if len(args) < 2 {
+				fmt.Fprintln(os.Stderr, "Usage: strataum add <package> [version]")
+				os.Exit(1)
+			}
+			version := "latest"
+			if len(args) > 2 {
+				version = args[2]
+			}
+			if err := pm.Add(args[1], version); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "remove":
+			if len(args) > 2 && (args[1] == "-g" || args[1] == "--global") {
+				global, err := strata.GlobalPackageManager()
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				pm, args = global, args[1:]
+			}
+			if len(args) < 2 {
+				fmt.Fprintln(os.Stderr, "Usage: strataum remove [-g] <package>")
+				os.Exit(1)
+			}
+			pm.Remove(args[1])
+			return
+		case "list":
+			pm.List()
+			return
+		case "verify":
+			if err := pm.Verify(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "vendor":
+			if err := pm.Vendor(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "run":
+			if pm.ScriptRequested(args[1:]) {
+				code, err := pm.RunScript(args[1], args[2:], os.Stdin, os.Stdout, os.Stderr)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				}
+				os.Exit(code)
+			}
+		case "login":
+			if err := strata.LoginCommand(pm, args[1:], os.Stdin); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "logout":
+			registry := ""
+			if len(args) > 1 {
+				registry = args[1]
+			}
+			if err := pm.Logout(registry); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "info":
+			if len(args) > 1 {
+				if err := pm.PackageInfo(os.Stdout, args[1]); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				return
+			}
+			pm.Info()
+			return
+		case "search":
+			if err := strata.SearchCommand(pm, args[1:], os.Stdout); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "new":
+			name, template := "", ""
+			for idx := 1; idx < len(args); idx++ {
+				arg := args[idx]
+				if strings.HasPrefix(arg, "--template=") {
+					template = strings.TrimPrefix(arg, "--template=")
+				} else if arg == "--template" && idx+1 < len(args) {
+					idx++
+					template = args[idx]
+				} else if name == "" {
+					name = arg
+				}
+			}
+			if name == "" {
+				fmt.Fprintf(os.Stderr, "Usage: strata new <name> [--template=%s]\n", strings.Join(strata.TemplateNames(), "|"))
+				os.Exit(1)
+			}
+			if err := strata.NewProject(name, template); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: strata <file.str>, strata repl, or strataum <command>")
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "repl":
+		strata.NewREPL(os.Stdout).Run(os.Stdin)
+		return
+	case "run":
+		opts, rest := mustParseRunFlags(args[1:])
+		os.Exit(strata.RunProject(targetArg(rest), opts))
+	case "build":
+		os.Exit(strata.BuildProject(args[1:]))
+	case "bench":
+		os.Exit(strata.BenchProject(args[1:]))
+	case "check":
+		os.Exit(strata.CheckProject(targetArg(args[1:])))
+	case "debug":
+		os.Exit(strata.DebugProgram())
+	case "ast", "tokens":
+		os.Exit(strata.DumpCommand(args[0], args[1:]))
+	case "fmt":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "Usage: strata fmt <file.str>")
+			os.Exit(1)
+		}
+		formatted, err := strata.FormatFile(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(formatted)
+		return
+	}
+	opts, rest := mustParseRunFlags(args)
+	if len(rest) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: strata [flags] <file.str>, strata [flags] -, or strata [flags] -e <code>")
+		os.Exit(1)
+	}
+	switch rest[0] {
+	case "-":
+		os.Exit(strata.RunStdin(opts))
+	case "-e":
+		os.Exit(strata.RunInlineCode(rest[1:], opts))
+	}
+	os.Exit(strata.RunProject(rest[0], opts))
+}
+
+// mustParseRunFlags is strata.ParseRunFlags, exiting on a bad flag.
+func mustParseRunFlags(args []string) (strata.RunOptions, []string) {
+	opts, rest, err := strata.ParseRunFlags(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return opts, rest
+}
+
+func targetArg(args []string) string {
+	if len(args) > 0 {
+		return args[0]
+	}
+	return "."
+}
@@ -0,0 +1,411 @@
+package strata
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ============================================================================
+// CODE GENERATION - The scope and static types the backends share
+// ============================================================================
+
+// The C and JavaScript generators both need to know the static types of
+// expressions: C to pick representations, JavaScript to keep integer
+// division and the formatting of concatenated values as the interpreter has
+// them. codegenScope tracks the variables, functions and imported modules in
+// scope while a program is generated and infers types from them, a cheaper
+// and more forgiving inference than the type checker's, which has already
+// passed the program.
+
+// codegenScope holds what is in scope at the point being generated.
+type codegenScope struct {
+	// globals and locals type the variables in scope, functions the
+	// top-level functions and modules the imported modules by alias.
+	globals   map[string]TypeDef
+	locals    map[string]TypeDef
+	functions map[string]*Stmt
+	modules   map[string]string
+}
+
+// enter starts generating a program.
+func (g *codegenScope) enter(statements []*Stmt) {
+	g.globals = make(map[string]TypeDef)
+	g.locals = nil
+	g.functions = make(map[string]*Stmt)
+	g.modules = make(map[string]string)
+	for _, stmt := range statements {
+		switch stmt.Kind {
+		case StmtFunction:
+			g.functions[stmt.Name] = stmt
+		case StmtImport:
+			g.modules[stmt.Name] = stmt.Module
+		}
+	}
+}
+
+// declaredVariable is a variable declared by a let statement or a for-in
+// loop.
+type declaredVariable struct {
+	Name string
+	Type TypeDef
+}
+
+// declareVariables adds the variables statements declare, in nested blocks
+// too but not in nested functions, to the innermost scope: the locals in a
+// function, else the globals. Each is typed as it is reached, so one
+// declared from another gets its type. It returns those new to the scope.
+func (g *codegenScope) declareVariables(statements []*Stmt) []declaredVariable {
+	scope := g.locals
+	if scope == nil {
+		scope = g.globals
+	}
+	var vars []declaredVariable
+	seen := make(map[string]bool)
+	declare := func(name string, t TypeDef) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		if _, existed := scope[name]; !existed {
+			vars = append(vars, declaredVariable{Name: name, Type: t})
+		}
+		scope[name] = t
+	}
+	var walk func(statements []*Stmt)
+	walk = func(statements []*Stmt) {
+		for _, stmt := range statements {
+			if stmt == nil {
+				continue
+			}
+			switch stmt.Kind {
+			case StmtLet:
+				if stmt.Names == nil {
+					t := stmt.Type
+					if t.Kind == "" {
+						t = g.typeOf(stmt.Value)
+					}
+					declare(stmt.Name, t)
+				}
+			case StmtForIn:
+				declare(stmt.Name, iteratedType(g.typeOf(stmt.Value)))
+			case StmtFunction, StmtClass:
+				continue
+			}
+			if stmt.Init != nil {
+				walk([]*Stmt{stmt.Init})
+			}
+			walk(stmt.Then)
+			walk(stmt.Else)
+			walk(stmt.Body)
+		}
+	}
+	walk(statements)
+	return vars
+}
+
+// variable looks up the type of a variable in scope.
+func (g *codegenScope) variable(name string) (TypeDef, bool) {
+	if t, ok := g.locals[name]; ok {
+		return t, true
+	}
+	t, ok := g.globals[name]
+	return t, ok
+}
+
+func (g *codegenScope) varType(name string) TypeDef {
+	t, _ := g.variable(name)
+	return t
+}
+
+// module is the module an expression names through an import alias, if any.
+func (g *codegenScope) module(expr *Expr) string {
+	if expr == nil || expr.Kind != ExprIdentifier {
+		return ""
+	}
+	if _, shadowed := g.variable(expr.Name); shadowed {
+		return ""
+	}
+	switch spec := g.modules[expr.Name]; spec {
+	case "std::io", "std::math", "std::text":
+		return spec
+	}
+	return ""
+}
+
+// calledFunction is the top-level function a call calls, if any.
+func (g *codegenScope) calledFunction(expr *Expr) (*Stmt, bool) {
+	if expr.Func.Kind != ExprIdentifier {
+		return nil, false
+	}
+	if _, shadowed := g.variable(expr.Func.Name); shadowed {
+		return nil, false
+	}
+	fn, ok := g.functions[expr.Func.Name]
+	return fn, ok
+}
+
+// builtinName is the builtin a call calls, if any.
+func (g *codegenScope) builtinName(expr *Expr) string {
+	if expr.Func.Kind != ExprIdentifier {
+		return ""
+	}
+	if _, builtin := builtinArity[expr.Func.Name]; !builtin {
+		return ""
+	}
+	if _, shadowed := g.variable(expr.Func.Name); shadowed {
+		return ""
+	}
+	if _, declared := g.functions[expr.Func.Name]; declared {
+		return ""
+	}
+	return expr.Func.Name
+}
+
+// typeOf infers the static type of expr as far as the backends need it.
+// It is the zero TypeDef where unknown.
+func (g *codegenScope) typeOf(expr *Expr) TypeDef {
+	if expr == nil {
+		return TypeRegistry["void"]
+	}
+	switch expr.Kind {
+	case ExprLiteral:
+		switch expr.Value.(type) {
+		case string:
+			if expr.Type.Kind == KindPrimitive && expr.Type.Primitive == TypeChar {
+				return TypeRegistry["char"]
+			}
+			return TypeRegistry["string"]
+		case float64:
+			return TypeRegistry["float"]
+		case bool:
+			return TypeRegistry["bool"]
+		case complex128:
+			return TypeRegistry["complex"]
+		case nil:
+			return TypeRegistry["any"]
+		}
+		return TypeRegistry["int"]
+	case ExprIdentifier:
+		return g.varType(expr.Name)
+	case ExprBinary:
+		switch expr.Op {
+		case "==", "!=", "<", ">", "<=", ">=", "&&", "||":
+			return TypeRegistry["bool"]
+		}
+		left, right := g.typeOf(expr.Left), g.typeOf(expr.Right)
+		if expr.Op == "+" && (cKind(left) == "string" || cKind(right) == "string") {
+			return TypeRegistry["string"]
+		}
+		return arithmeticType(left, right)
+	case ExprUnary:
+		if expr.Op == "!" {
+			return TypeRegistry["bool"]
+		}
+		return g.typeOf(expr.Operand)
+	case ExprCall:
+		return g.callType(expr)
+	case ExprMember:
+		if g.module(expr.Object) == "std::math" {
+			return TypeRegistry["float"]
+		}
+	case ExprIndex:
+		container := g.typeOf(expr.Object)
+		switch cKind(container) {
+		case "string":
+			return container
+		case "list":
+			if container.InnerType != nil {
+				return *container.InnerType
+			}
+		case "map":
+			if len(container.Types) == 2 {
+				return container.Types[1]
+			}
+		}
+		return TypeRegistry["any"]
+	case ExprArray:
+		list := TypeRegistry["list"]
+		if len(expr.Elements) > 0 {
+			inner := g.typeOf(expr.Elements[0])
+			list.InnerType = &inner
+		}
+		return list
+	case ExprMap:
+		m := TypeRegistry["map"]
+		if len(expr.Elements) > 0 {
+			m.Types = []TypeDef{TypeRegistry["string"], g.typeOf(expr.Elements[0])}
+		}
+		return m
+	}
+	return TypeDef{}
+}
+
+// callType is the type of a call's result.
+func (g *codegenScope) callType(expr *Expr) TypeDef {
+	if expr.Func.Kind == ExprMember {
+		switch g.module(expr.Func.Object) {
+		case "std::io":
+			return TypeRegistry["void"]
+		case "std::math":
+			return TypeRegistry["float"]
+		case "std::text":
+			if expr.Func.Property == "length" {
+				return TypeRegistry["int"]
+			}
+			return builtinSignatures[expr.Func.Property].ReturnType
+		}
+		return TypeDef{}
+	}
+	if fn, ok := g.calledFunction(expr); ok {
+		return returnType(fn)
+	}
+	name := g.builtinName(expr)
+	entry, ok := builtinSignatures[name]
+	if !ok {
+		return TypeDef{}
+	}
+	if name == "abs" && len(expr.Args) == 1 && cKind(g.typeOf(expr.Args[0])) == "int" {
+		return TypeRegistry["int"]
+	}
+	return entry.ReturnType
+}
+
+// ============================================================================
+// EMITTER - The line output and control flow the C and JavaScript backends share
+// ============================================================================
+
+// generatorError records the first construct a backend cannot express, so
+// the generator can carry on without checking at every step.
+type generatorError struct {
+	// target names the backend in messages, such as "c".
+	target string
+	err    error
+}
+
+// failed records the error unless one already was.
+func (e *generatorError) failed(loc Location, format string, args ...interface{}) {
+	if e.err == nil {
+		e.err = newError(ErrInvalidOperation, e.target+" target: "+format, args...).at(loc)
+	}
+}
+
+// emitterLanguage is what an emitter needs from the generator it belongs to.
+type emitterLanguage interface {
+	generateStatement(stmt *Stmt)
+	generateExpression(expr *Expr) string
+	// assignment is an assignment statement as an expression.
+	assignment(stmt *Stmt) string
+}
+
+// loopFlags spells, as format strings, the flag a loop with an else block
+// sets on break: its name from a number, its declaration, false, and
+// setting it.
+type loopFlags struct {
+	name, declare, set string
+}
+
+// emitter writes a program as lines of code at an indentation. It keeps
+// the break flags of the enclosing loops, innermost last, "" for a loop
+// without an else block.
+type emitter struct {
+	code   []string
+	indent int
+	loops  []string
+	labels int
+	lang   emitterLanguage
+	flags  loopFlags
+	generatorError
+	lineMap
+}
+
+func newEmitter(target string, lang emitterLanguage, flags loopFlags) emitter {
+	return emitter{lang: lang, flags: flags, generatorError: generatorError{target: target}}
+}
+
+// reset starts a program.
+func (e *emitter) reset() {
+	e.code = []string{}
+	e.indent = 0
+	e.loops = nil
+	e.labels = 0
+	e.err = nil
+	e.lineMap.reset()
+}
+
+// fail records the first error and returns a placeholder expression.
+func (e *emitter) fail(loc Location, format string, args ...interface{}) string {
+	e.failed(loc, format, args...)
+	return "0"
+}
+
+// line appends a line of code at the current indentation.
+func (e *emitter) line(format string, args ...interface{}) {
+	e.mark(len(e.code))
+	e.code = append(e.code, strings.Repeat("    ", e.indent)+fmt.Sprintf(format, args...))
+}
+
+// block generates statements one level further in.
+func (e *emitter) block(statements []*Stmt) {
+	e.indent++
+	for _, stmt := range statements {
+		e.lang.generateStatement(stmt)
+	}
+	e.indent--
+}
+
+// elseChain closes an if statement, turning an else block that holds just
+// another if into `else if`.
+func (e *emitter) elseChain(elseBody []*Stmt) {
+	for len(elseBody) == 1 && elseBody[0].Kind == StmtIf {
+		next := elseBody[0]
+		e.line("} else if (%s) {", e.lang.generateExpression(next.Condition))
+		e.block(next.Then)
+		elseBody = next.Else
+	}
+	if len(elseBody) > 0 {
+		e.line("} else {")
+		e.block(elseBody)
+	}
+	e.line("}")
+}
+
+// loop generates a loop with emit, and its else block, which runs unless
+// the loop was left by break.
+func (e *emitter) loop(stmt *Stmt, emit func()) {
+	flag := ""
+	if len(stmt.Else) > 0 {
+		e.labels++
+		flag = fmt.Sprintf(e.flags.name, e.labels)
+		e.line(e.flags.declare, flag)
+	}
+	e.loops = append(e.loops, flag)
+	emit()
+	e.loops = e.loops[:len(e.loops)-1]
+	if flag != "" {
+		e.line("if (!%s) {", flag)
+		e.block(stmt.Else)
+		e.line("}")
+	}
+}
+
+// breakLoop leaves the innermost loop, setting its flag if it has one.
+func (e *emitter) breakLoop() {
+	if len(e.loops) > 0 && e.loops[len(e.loops)-1] != "" {
+		e.line(e.flags.set, e.loops[len(e.loops)-1])
+	}
+	e.line("break;")
+}
+
+// clause is a simple statement in the header of a for loop.
+func (e *emitter) clause(stmt *Stmt) string {
+	if stmt == nil {
+		return ""
+	}
+	switch stmt.Kind {
+	case StmtAssignment:
+		return e.lang.assignment(stmt)
+	case StmtExpression:
+		return e.lang.generateExpression(stmt.Expr)
+	}
+	return ""
+}
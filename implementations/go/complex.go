@@ -0,0 +1,56 @@
+package strata
+
+import "math/cmplx"
+
+// ============================================================================
+// COMPLEX NUMBERS - complex128 arithmetic and the std::complex module
+// ============================================================================
+
+func isComplex(v interface{}) bool {
+	_, ok := v.(complex128)
+	return ok
+}
+
+// toComplex widens ints and floats to complex numbers with no imaginary part.
+func toComplex(v interface{}) complex128 {
+	if z, ok := v.(complex128); ok {
+		return z
+	}
+	return complex(toFloat(v), 0)
+}
+
+func evalComplexOp(op string, left, right complex128) (interface{}, error) {
+	switch op {
+	case "+":
+		return left + right, nil
+	case "-":
+		return left - right, nil
+	case "*":
+		return left * right, nil
+	case "/":
+		if right == 0 {
+			return nil, newError(ErrDivisionByZero, "complex division by zero")
+		}
+		return left / right, nil
+	case "==":
+		return left == right, nil
+	case "!=":
+		return left != right, nil
+	}
+	return nil, newError(ErrInvalidOperation, "operator %s is not defined for complex numbers", op)
+}
+
+func complexModule() map[string]interface{} {
+	return map[string]interface{}{
+		"new":   func(re, im float64) complex128 { return complex(re, im) },
+		"polar": func(r, theta float64) complex128 { return cmplx.Rect(r, theta) },
+		"real":  func(z complex128) float64 { return real(z) },
+		"imag":  func(z complex128) float64 { return imag(z) },
+		"abs":   func(z complex128) float64 { return cmplx.Abs(z) },
+		"arg":   func(z complex128) float64 { return cmplx.Phase(z) },
+		"conj":  func(z complex128) complex128 { return cmplx.Conj(z) },
+		"sqrt":  func(z complex128) complex128 { return cmplx.Sqrt(z) },
+		"exp":   func(z complex128) complex128 { return cmplx.Exp(z) },
+		"log":   func(z complex128) complex128 { return cmplx.Log(z) },
+	}
+}
@@ -0,0 +1,42 @@
+package strata
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestComplexNumbers(t *testing.T) {
+	source := `import io from std::io
+import complex from std::complex
+let z: complex = 3+4i
+let w: complex = z * 2i - 1
+io.print(z)
+io.print(w)
+io.print(complex.abs(z))
+io.print(complex.conj(z))
+io.print(complex.arg(1i))
+io.print(complex.polar(2, 0))
+io.print(complex.real(w) + complex.imag(w))
+io.print(complex.sqrt(-4 + 0i))
+io.print(z == 3+4i)
+io.print(z != w)
+`
+	var out strings.Builder
+	if err := RunSource(source, RunOptions{Stdout: &out}); err != nil {
+		t.Fatal(err)
+	}
+	want := "(3+4i)\n(-9+6i)\n5\n(3-4i)\n1.5707963267948966\n(2+0i)\n-3\n(0+2i)\ntrue\ntrue\n"
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+
+	for src, message := range map[string]string{
+		"let z: complex = 1i / 0i": "complex division by zero",
+		"let b: bool = 1i < 2i":    "operator < is not defined for complex numbers",
+		"import complex from std::complex\nlet p: complex = complex.polar(1)": "polar expects 2 argument(s), got 1",
+	} {
+		if err := RunSource(src, RunOptions{Stdout: &out}); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("%q gave %v, want %q", src, err, message)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package strata
+
+// ============================================================================
+// CONSTANTS - Compile-time evaluation of const declarations
+// ============================================================================
+
+// constFolder evaluates operators with the interpreter's own semantics, so a
+// folded constant has exactly the value the expression would have at runtime.
+var constFolder = &Interpreter{}
+
+// checkConst folds a const initializer into a literal and records its value
+// so later constants and assignments can refer to it.
+func (tc *TypeChecker) checkConst(stmt *Stmt, declared TypeDef) error {
+	if err := tc.checkExpression(stmt.Value, declared); err != nil {
+		return err
+	}
+	value, err := tc.constValue(stmt.Value)
+	if err != nil {
+		return newError(ErrNotConstant, "const %s must be initialized with a constant expression: %v", stmt.Name, err)
+	}
+	stmt.Value = &Expr{Kind: ExprLiteral, Value: value, Type: tc.inferType(stmt.Value), Location: stmt.Value.Location}
+	tc.Env.Vars[stmt.Name] = TypeEnvEntry{Type: declared, Const: true, Value: value}
+	return nil
+}
+
+// constValue evaluates expr at check time. Literals, earlier constants and
+// operators applied to them are constant; anything else is not.
+func (tc *TypeChecker) constValue(expr *Expr) (interface{}, error) {
+	switch expr.Kind {
+	case ExprLiteral:
+		return expr.Value, nil
+	case ExprIdentifier:
+		if entry, ok := tc.Env.Lookup(expr.Name); ok && entry.Const {
+			return entry.Value, nil
+		}
+		return nil, newError(ErrNotConstant, "%s is not a constant", expr.Name)
+	case ExprUnary:
+		operand, err := tc.constValue(expr.Operand)
+		if err != nil {
+			return nil, err
+		}
+		return constFolder.evalUnaryOp(expr.Op, operand)
+	case ExprBinary:
+		left, err := tc.constValue(expr.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := tc.constValue(expr.Right)
+		if err != nil {
+			return nil, err
+		}
+		if expr.Op == "??" {
+			if isNullish(left) {
+				return right, nil
+			}
+			return left, nil
+		}
+		return constFolder.evalBinaryOp(expr.Op, left, right)
+	}
+	return nil, newError(ErrNotConstant, "%s expressions are not constant", expr.Kind)
+}
@@ -0,0 +1,129 @@
+package strata
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// CRASH REPORTS - Dump interpreter state when a script aborts or panics
+// ============================================================================
+
+// The runner writes a report when the interpreter panics or fails with an
+// InternalError, and, under --crash-report, whenever a script stops with an
+// error.
+
+const crashExcerptContext = 2
+
+type CrashReport struct {
+	Reason    string
+	FilePath  string
+	Source    string
+	Location  Location
+	CallStack []StackFrame
+	GoStack   []byte
+	Time      time.Time
+}
+
+func NewCrashReport(reason, filePath, source string, interp *Interpreter) *CrashReport {
+	report := &CrashReport{
+		Reason:   reason,
+		FilePath: filePath,
+		Source:   source,
+		Time:     time.Now(),
+	}
+	if interp != nil {
+		report.Location = interp.Location
+		report.CallStack = append([]StackFrame(nil), interp.CallStack...)
+	}
+	return report
+}
+
+func (r *CrashReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Strata crash report\n")
+	fmt.Fprintf(&b, "===================\n")
+	fmt.Fprintf(&b, "Version: %s\n", Version)
+	fmt.Fprintf(&b, "Go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&b, "Time: %s\n", r.Time.Format(time.RFC3339))
+	fmt.Fprintf(&b, "File: %s\n", r.FilePath)
+	fmt.Fprintf(&b, "Reason: %s\n", r.Reason)
+
+	b.WriteString("\nSource excerpt:\n")
+	b.WriteString(r.excerpt())
+
+	b.WriteString("\nStrata stack:\n")
+	if len(r.CallStack) == 0 {
+		b.WriteString("  <top level>\n")
+	}
+	for idx := len(r.CallStack) - 1; idx >= 0; idx-- {
+		frame := r.CallStack[idx]
+		fmt.Fprintf(&b, "  %s() called from line %d\n", frame.Function, frame.CallSite.Line)
+	}
+
+	b.WriteString("\nGo stack:\n")
+	if len(r.GoStack) == 0 {
+		b.WriteString("  <not captured: script error>\n")
+	} else {
+		b.Write(r.GoStack)
+	}
+	return b.String()
+}
+
+func (r *CrashReport) excerpt() string {
+	if r.Location.Line == 0 || r.Source == "" {
+		return "  <no location recorded>\n"
+	}
+	lines := strings.Split(r.Source, "\n")
+	start := r.Location.Line - crashExcerptContext
+	if start < 1 {
+		start = 1
+	}
+	end := r.Location.Line + crashExcerptContext
+	if end > len(lines) {
+		end = len(lines)
+	}
+	var b strings.Builder
+	for n := start; n <= end; n++ {
+		marker := " "
+		if n == r.Location.Line {
+			marker = ">"
+		}
+		fmt.Fprintf(&b, "%s %4d | %s\n", marker, n, strings.TrimRight(lines[n-1], "\r"))
+	}
+	return b.String()
+}
+
+// Write stores the report under dir and returns the path of the created file.
+func (r *CrashReport) Write(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("crash-%s.txt", r.Time.Format("20060102-150405.000"))
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(r.String()), 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// reportCrash writes report under .strata/crash and says where to the
+// runner's status output. A sandboxed run without filesystem access prints
+// the report there instead, so the script's failure cannot touch the disk.
+func reportCrash(report *CrashReport, opts RunOptions) {
+	w := opts.status()
+	if opts.Sandbox != nil && !opts.Sandbox.AllowFS {
+		fmt.Fprintf(w, "\n%s", report)
+		return
+	}
+	path, err := report.Write(filepath.Join(".strata", "crash"))
+	if err != nil {
+		fmt.Fprintf(w, "Could not write crash report: %v\n", err)
+		return
+	}
+	fmt.Fprintf(w, "Crash report written to %s\n", path)
+}
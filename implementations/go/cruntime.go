@@ -0,0 +1,442 @@
+package strata
+
+import (
+	_ "embed"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ============================================================================
+// C RUNTIME - The library generated C calls for strings, lists and builtins
+// ============================================================================
+
+// C has no strings, lists or maps to speak of, so CGenerator emits calls
+// into runtime/strata_runtime.c for them: concatenation and comparison of
+// strings, the string and math builtins, lists and maps of boxed values
+// (StrataValue), comparing those by value, and printing. A program is compiled together with the
+// runtime, which `strata build` writes next to the generated C.
+//
+// Values keep their static types in C: int, double, int for bool, int for
+// the code point of a char, char* for string, StrataList* and StrataMap*
+// for lists and maps. They are boxed
+// as they go into a list, a map or a variable of type any, and unboxed, with
+// a check of their kind, as they come out.
+
+//go:embed runtime/strata_runtime.h
+var cRuntimeHeader string
+
+//go:embed runtime/strata_runtime.c
+var cRuntimeSource string
+
+// CRuntimeFiles returns the runtime library generated C is compiled with,
+// by file name.
+func CRuntimeFiles() map[string]string {
+	return map[string]string{
+		"strata_runtime.h": cRuntimeHeader,
+		"strata_runtime.c": cRuntimeSource,
+	}
+}
+
+// cBuiltin is the runtime function a builtin translates to, with the types
+// its arguments are converted to.
+type cBuiltin struct {
+	name   string
+	params []string
+}
+
+var cBuiltins = map[string]cBuiltin{
+	"strlen":      {"strata_strlen", []string{"string"}},
+	"length":      {"strata_strlen", []string{"string"}},
+	"substr":      {"strata_substr", []string{"string", "int", "int"}},
+	"toUpperCase": {"strata_upper", []string{"string"}},
+	"toLowerCase": {"strata_lower", []string{"string"}},
+	"trim":        {"strata_trim", []string{"string"}},
+	"startsWith":  {"strata_starts_with", []string{"string", "string"}},
+	"endsWith":    {"strata_ends_with", []string{"string", "string"}},
+	"includes":    {"strata_includes", []string{"string", "string"}},
+	"indexOf":     {"strata_index_of", []string{"string", "string"}},
+	"repeat":      {"strata_repeat", []string{"string", "int"}},
+	"split":       {"strata_split", []string{"string", "string"}},
+	"join":        {"strata_join", []string{"list", "string"}},
+	"parseInt":    {"strata_parse_int", []string{"string"}},
+	"parseFloat":  {"strata_parse_float", []string{"string"}},
+	"sqrt":        {"sqrt", []string{"float"}},
+	"sin":         {"sin", []string{"float"}},
+	"cos":         {"cos", []string{"float"}},
+	"tan":         {"tan", []string{"float"}},
+	"asin":        {"asin", []string{"float"}},
+	"acos":        {"acos", []string{"float"}},
+	"atan":        {"atan", []string{"float"}},
+	"atan2":       {"atan2", []string{"float", "float"}},
+	"exp":         {"exp", []string{"float"}},
+	"log":         {"log", []string{"float"}},
+	"log10":       {"log10", []string{"float"}},
+	"log2":        {"log2", []string{"float"}},
+	"pow":         {"pow", []string{"float", "float"}},
+	"floor":       {"floor", []string{"float"}},
+	"ceil":        {"ceil", []string{"float"}},
+	"round":       {"round", []string{"float"}},
+	"trunc":       {"trunc", []string{"float"}},
+}
+
+// cMathConstants are the constants of std::math.
+var cMathConstants = map[string]string{
+	"PI": "3.141592653589793",
+	"E":  "2.718281828459045",
+}
+
+// cKind classifies t by how C represents it, following typeToCString.
+func cKind(t TypeDef) string {
+	if t.Kind != KindPrimitive {
+		return "int"
+	}
+	switch t.Primitive {
+	case TypeFloat:
+		return "float"
+	case TypeBool:
+		return "bool"
+	case TypeString:
+		return "string"
+	case TypeList, TypeArray:
+		return "list"
+	case TypeMap, TypeDict:
+		return "map"
+	case TypeAny:
+		return "any"
+	case TypeVoid:
+		return "void"
+	case TypeComplex:
+		return "complex"
+	case TypeChar:
+		return "char"
+	}
+	return "int"
+}
+
+// cZero is the value a variable of type t starts with.
+func cZero(t TypeDef) string {
+	switch cKind(t) {
+	case "string", "list", "map":
+		return "NULL"
+	case "any":
+		return "strata_null()"
+	}
+	return "0"
+}
+
+// cLiteral writes a literal as C. Floats always have a decimal point or an
+// exponent, so 1.0 stays a double in C arithmetic, integers beyond the range
+// of a C int are long long, booleans are 1 and 0 and chars are quoted.
+func cLiteral(expr *Expr) string {
+	switch value := expr.Value.(type) {
+	case nil:
+		return "strata_null()"
+	case string:
+		if expr.Type.Kind == KindPrimitive && expr.Type.Primitive == TypeChar {
+			for _, c := range value {
+				return cChar(c)
+			}
+		}
+		return cString(value)
+	case bool:
+		if value {
+			return "1"
+		}
+		return "0"
+	case int:
+		return cInt(int64(value), expr.Type)
+	case int64:
+		return cInt(value, expr.Type)
+	case float64:
+		return cFloat(value)
+	case complex128:
+		return fmt.Sprintf("(%s * I)", cFloat(imag(value)))
+	}
+	return fmt.Sprintf("%v", expr.Value)
+}
+
+// cInt writes an integer literal of type t, which may make it a float or a
+// char.
+func cInt(i int64, t TypeDef) string {
+	switch {
+	case t.Kind == KindPrimitive && t.Primitive == TypeFloat:
+		return cFloat(float64(i))
+	case t.Kind == KindPrimitive && t.Primitive == TypeChar:
+		return cChar(rune(i))
+	case i > math.MaxInt32 || i < math.MinInt32:
+		return strconv.FormatInt(i, 10) + "LL"
+	}
+	return strconv.FormatInt(i, 10)
+}
+
+// cFloat writes a float literal, with math.h naming the infinities and NaN.
+func cFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "INFINITY"
+	case math.IsInf(f, -1):
+		return "(-INFINITY)"
+	case math.IsNaN(f):
+		return "NAN"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eE") {
+		s += ".0"
+	}
+	return s
+}
+
+// cChar writes c as a C character literal, for the int holding a char's
+// code point. A character beyond ASCII is written as its code point.
+func cChar(c rune) string {
+	switch {
+	case c == '\\' || c == '\'':
+		return `'\` + string(c) + `'`
+	case c == '\n':
+		return `'\n'`
+	case c == '\t':
+		return `'\t'`
+	case c == '\r':
+		return `'\r'`
+	case c == 0:
+		return `'\0'`
+	case c < 0x20 || c == 0x7f:
+		return fmt.Sprintf(`'\%03o'`, c)
+	case c > 0x7f:
+		return strconv.Itoa(int(c))
+	}
+	return "'" + string(c) + "'"
+}
+
+// cString quotes s as a C string literal. Control characters are written
+// in octal, and a ? after another escaped so it cannot start a trigraph.
+func cString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for idx := 0; idx < len(s); idx++ {
+		c := s[idx]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\t':
+			b.WriteString(`\t`)
+		case c == '?' && idx > 0 && s[idx-1] == '?':
+			b.WriteString(`\?`)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, `\%03o`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// box converts the value of expr to a StrataValue.
+func (g *CGenerator) box(expr *Expr) string {
+	code := g.generateExpression(expr)
+	switch cKind(g.typeOf(expr)) {
+	case "float":
+		return fmt.Sprintf("strata_float(%s)", code)
+	case "bool":
+		return fmt.Sprintf("strata_bool(%s)", code)
+	case "char":
+		return fmt.Sprintf("strata_string(strata_char_str(%s))", code)
+	case "string":
+		return fmt.Sprintf("strata_string(%s)", code)
+	case "list":
+		return fmt.Sprintf("strata_list_value(%s)", code)
+	case "map":
+		return fmt.Sprintf("strata_map_value(%s)", code)
+	case "any":
+		return code
+	}
+	return fmt.Sprintf("strata_int(%s)", code)
+}
+
+// unbox converts code, a StrataValue, to the C representation of t.
+func unbox(code string, t TypeDef) string {
+	switch cKind(t) {
+	case "float":
+		return fmt.Sprintf("strata_as_float(%s)", code)
+	case "bool":
+		return fmt.Sprintf("strata_as_bool(%s)", code)
+	case "char":
+		return fmt.Sprintf("strata_as_char(%s)", code)
+	case "string":
+		return fmt.Sprintf("strata_as_string(%s)", code)
+	case "list":
+		return fmt.Sprintf("strata_as_list(%s)", code)
+	case "map":
+		return fmt.Sprintf("strata_as_map(%s)", code)
+	case "any":
+		return code
+	}
+	return fmt.Sprintf("strata_as_int(%s)", code)
+}
+
+// valueAs generates expr for storing where a value of type want goes,
+// boxing or unboxing it as needed.
+func (g *CGenerator) valueAs(expr *Expr, want TypeDef) string {
+	have := cKind(g.typeOf(expr))
+	switch {
+	case expr.Kind == ExprLiteral && have == "int" && cKind(want) != "any":
+		// An integer literal takes the type it is stored as: 3 in a
+		// float is 3.0.
+		if i, ok := expr.Value.(int64); ok {
+			return cInt(i, want)
+		}
+	case cKind(want) == "any" && have != "any":
+		return g.box(expr)
+	case have == "any" && cKind(want) != "any":
+		return unbox(g.generateExpression(expr), want)
+	}
+	return g.generateExpression(expr)
+}
+
+// stringify generates expr converted to a string, as print shows it.
+func (g *CGenerator) stringify(expr *Expr) string {
+	code := g.generateExpression(expr)
+	switch cKind(g.typeOf(expr)) {
+	case "string":
+		return code
+	case "int":
+		return fmt.Sprintf("strata_int_str(%s)", code)
+	case "float":
+		return fmt.Sprintf("strata_float_str(%s)", code)
+	case "bool":
+		return fmt.Sprintf("strata_bool_str(%s)", code)
+	case "char":
+		return fmt.Sprintf("strata_char_str(%s)", code)
+	}
+	return fmt.Sprintf("strata_value_str(%s)", g.box(expr))
+}
+
+// binary generates a binary expression, through the runtime for strings and
+// for comparing lists, maps and values of type any.
+func (g *CGenerator) binary(expr *Expr) string {
+	left, right := g.typeOf(expr.Left), g.typeOf(expr.Right)
+	strs := cKind(left) == "string" || cKind(right) == "string"
+	values := false
+	for _, kind := range []string{cKind(left), cKind(right)} {
+		values = values || kind == "list" || kind == "map" || kind == "any"
+	}
+	switch {
+	case (expr.Op == "==" || expr.Op == "!=") && values:
+		eq := fmt.Sprintf("strata_value_eq(%s, %s)", g.box(expr.Left), g.box(expr.Right))
+		if expr.Op == "!=" {
+			return "(!" + eq + ")"
+		}
+		return eq
+	case expr.Op == "+" && strs:
+		return fmt.Sprintf("strata_concat(%s, %s)", g.stringify(expr.Left), g.stringify(expr.Right))
+	case expr.Op == "==" && strs:
+		return fmt.Sprintf("strata_str_eq(%s, %s)", g.generateExpression(expr.Left), g.generateExpression(expr.Right))
+	case expr.Op == "!=" && strs:
+		return fmt.Sprintf("(!strata_str_eq(%s, %s))", g.generateExpression(expr.Left), g.generateExpression(expr.Right))
+	case (expr.Op == "<" || expr.Op == ">" || expr.Op == "<=" || expr.Op == ">=") && strs:
+		return fmt.Sprintf("(strata_str_cmp(%s, %s) %s 0)", g.generateExpression(expr.Left), g.generateExpression(expr.Right), expr.Op)
+	case expr.Op == "%" && (cKind(left) == "float" || cKind(right) == "float"):
+		return fmt.Sprintf("fmod(%s, %s)", g.generateExpression(expr.Left), g.generateExpression(expr.Right))
+	}
+	return fmt.Sprintf("(%s %s %s)", g.generateExpression(expr.Left), expr.Op, g.generateExpression(expr.Right))
+}
+
+// index generates reading an element of a list, map or string.
+func (g *CGenerator) index(expr *Expr) string {
+	obj := g.generateExpression(expr.Object)
+	switch cKind(g.typeOf(expr.Object)) {
+	case "list":
+		return unbox(fmt.Sprintf("strata_list_get(%s, %s)", obj, g.valueAs(expr.Index, TypeRegistry["int"])), g.typeOf(expr))
+	case "map":
+		return unbox(fmt.Sprintf("strata_map_get(%s, %s)", obj, g.valueAs(expr.Index, TypeRegistry["string"])), g.typeOf(expr))
+	case "string":
+		return fmt.Sprintf("strata_char_at(%s, %s)", obj, g.valueAs(expr.Index, TypeRegistry["int"]))
+	}
+	return fmt.Sprintf("%s[%s]", obj, g.generateExpression(expr.Index))
+}
+
+// moduleConstant generates a constant of std::math such as math.PI.
+func (g *CGenerator) moduleConstant(expr *Expr) (string, bool) {
+	if g.module(expr.Object) != "std::math" {
+		return "", false
+	}
+	constant, ok := cMathConstants[expr.Property]
+	return constant, ok
+}
+
+// runtimeCall generates a call of a builtin or a standard library function
+// as a call into the runtime or math.h. It reports false for any other call.
+func (g *CGenerator) runtimeCall(expr *Expr) (string, bool) {
+	name := g.builtinName(expr)
+	if expr.Func.Kind == ExprMember {
+		switch g.module(expr.Func.Object) {
+		case "std::io":
+			name = "io." + expr.Func.Property
+		case "std::math":
+			name = "math." + expr.Func.Property
+		case "std::text":
+			name = expr.Func.Property
+		}
+	}
+	args := expr.Args
+	switch name {
+	case "io.print", "io.println":
+		if len(args) == 1 {
+			return fmt.Sprintf("strata_print(%s)", g.stringify(args[0])), true
+		}
+	case "math.abs":
+		if len(args) == 1 {
+			return fmt.Sprintf("fabs(%s)", g.valueAs(args[0], TypeRegistry["float"])), true
+		}
+	case "abs":
+		if len(args) == 1 && cKind(g.typeOf(args[0])) == "int" {
+			return fmt.Sprintf("llabs(%s)", g.generateExpression(args[0])), true
+		}
+		if len(args) == 1 {
+			return fmt.Sprintf("fabs(%s)", g.valueAs(args[0], TypeRegistry["float"])), true
+		}
+	case "floor", "ceil", "round":
+		// The builtins round to an int; std::math's keep a float.
+		if len(args) == 1 {
+			return fmt.Sprintf("((long long)%s(%s))", name, g.valueAs(args[0], TypeRegistry["float"])), true
+		}
+	case "len":
+		if len(args) == 1 {
+			switch cKind(g.typeOf(args[0])) {
+			case "string":
+				return fmt.Sprintf("strata_strlen(%s)", g.generateExpression(args[0])), true
+			case "list":
+				return fmt.Sprintf("strata_list_len(%s)", g.generateExpression(args[0])), true
+			case "map":
+				return fmt.Sprintf("strata_map_len(%s)", g.generateExpression(args[0])), true
+			}
+		}
+	case "toString":
+		if len(args) == 1 {
+			return g.stringify(args[0]), true
+		}
+	case "replace", "replaceAll":
+		if len(args) == 3 {
+			all := 0
+			if name == "replaceAll" {
+				all = 1
+			}
+			return fmt.Sprintf("strata_replace(%s, %s, %s, %d)", g.valueAs(args[0], TypeRegistry["string"]), g.valueAs(args[1], TypeRegistry["string"]), g.valueAs(args[2], TypeRegistry["string"]), all), true
+		}
+	}
+	builtin, ok := cBuiltins[strings.TrimPrefix(name, "math.")]
+	if !ok || len(args) != len(builtin.params) {
+		return "", false
+	}
+	code := make([]string, len(args))
+	for idx, arg := range args {
+		code[idx] = g.valueAs(arg, TypeRegistry[builtin.params[idx]])
+	}
+	return fmt.Sprintf("%s(%s)", builtin.name, strings.Join(code, ", ")), true
+}
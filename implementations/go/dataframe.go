@@ -0,0 +1,615 @@
+package strata
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ============================================================================
+// DATAFRAME - Tabular data with CSV import/export and the std::dataframe module
+// ============================================================================
+
+type DataFrame struct {
+	Columns []string
+	Rows    [][]interface{}
+}
+
+func (df *DataFrame) columnIndex(name string) (int, error) {
+	for idx, col := range df.Columns {
+		if col == name {
+			return idx, nil
+		}
+	}
+	return -1, newError(ErrUndefined, "dataframe has no column %q", name)
+}
+
+// derive returns an empty frame with the given columns, sharing nothing with df.
+func (df *DataFrame) derive(columns []string) *DataFrame {
+	return &DataFrame{Columns: append([]string(nil), columns...)}
+}
+
+// String renders the frame as an aligned text table.
+func (df *DataFrame) String() string {
+	widths := make([]int, len(df.Columns))
+	cells := make([][]string, len(df.Rows))
+	for idx, col := range df.Columns {
+		widths[idx] = len(col)
+	}
+	for r, row := range df.Rows {
+		cells[r] = make([]string, len(row))
+		for c, value := range row {
+			cells[r][c] = formatCell(value)
+			if len(cells[r][c]) > widths[c] {
+				widths[c] = len(cells[r][c])
+			}
+		}
+	}
+	var b strings.Builder
+	writeRow := func(values []string) {
+		var line strings.Builder
+		for c, value := range values {
+			if c > 0 {
+				line.WriteString("  ")
+			}
+			fmt.Fprintf(&line, "%-*s", widths[c], value)
+		}
+		b.WriteString(strings.TrimRight(line.String(), " "))
+		b.WriteString("\n")
+	}
+	writeRow(df.Columns)
+	for _, row := range cells {
+		writeRow(row)
+	}
+	fmt.Fprintf(&b, "[%d rows x %d columns]", len(df.Rows), len(df.Columns))
+	return b.String()
+}
+
+func formatCell(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return toString(value)
+}
+
+// parseCell infers a cell's type from its CSV text: int, float, bool, null
+// for an empty field, and string otherwise.
+func parseCell(text string) interface{} {
+	if text == "" {
+		return nil
+	}
+	if v, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return v
+	}
+	if v, err := strconv.ParseFloat(text, 64); err == nil {
+		return v
+	}
+	if text == "true" || text == "false" {
+		return text == "true"
+	}
+	return text
+}
+
+func ParseCSV(text string) (*DataFrame, error) {
+	reader := csv.NewReader(strings.NewReader(text))
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return &DataFrame{}, nil
+	}
+	df := &DataFrame{Columns: records[0]}
+	for _, record := range records[1:] {
+		row := make([]interface{}, len(record))
+		for idx, field := range record {
+			row[idx] = parseCell(field)
+		}
+		df.Rows = append(df.Rows, row)
+	}
+	return df, nil
+}
+
+func (df *DataFrame) CSV() (string, error) {
+	var b strings.Builder
+	writer := csv.NewWriter(&b)
+	writer.Write(df.Columns)
+	for _, row := range df.Rows {
+		record := make([]string, len(row))
+		for idx, value := range row {
+			record[idx] = formatCell(value)
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+	return b.String(), writer.Error()
+}
+
+// compareValues orders numbers numerically and everything else by its text,
+// with null before any value.
+func compareValues(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	if isNumber(a) && isNumber(b) {
+		x, y := toFloat(a), toFloat(b)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(toString(a), toString(b))
+}
+
+func isNumber(v interface{}) bool {
+	switch v.(type) {
+	case int64, float64:
+		return true
+	}
+	return false
+}
+
+func (df *DataFrame) Select(columns []string) (*DataFrame, error) {
+	indexes := make([]int, len(columns))
+	for idx, name := range columns {
+		col, err := df.columnIndex(name)
+		if err != nil {
+			return nil, err
+		}
+		indexes[idx] = col
+	}
+	result := df.derive(columns)
+	for _, row := range df.Rows {
+		selected := make([]interface{}, len(indexes))
+		for idx, col := range indexes {
+			selected[idx] = row[col]
+		}
+		result.Rows = append(result.Rows, selected)
+	}
+	return result, nil
+}
+
+func (df *DataFrame) Filter(column, op string, value interface{}) (*DataFrame, error) {
+	col, err := df.columnIndex(column)
+	if err != nil {
+		return nil, err
+	}
+	var keep func(cell interface{}) bool
+	switch op {
+	case "==":
+		keep = func(cell interface{}) bool { return compareValues(cell, value) == 0 }
+	case "!=":
+		keep = func(cell interface{}) bool { return compareValues(cell, value) != 0 }
+	case "<":
+		keep = func(cell interface{}) bool { return cell != nil && compareValues(cell, value) < 0 }
+	case "<=":
+		keep = func(cell interface{}) bool { return cell != nil && compareValues(cell, value) <= 0 }
+	case ">":
+		keep = func(cell interface{}) bool { return compareValues(cell, value) > 0 }
+	case ">=":
+		keep = func(cell interface{}) bool { return compareValues(cell, value) >= 0 }
+	case "contains":
+		keep = func(cell interface{}) bool { return cell != nil && strings.Contains(toString(cell), toString(value)) }
+	default:
+		return nil, newError(ErrInvalidOperation, "unknown filter operator %q", op)
+	}
+	result := df.derive(df.Columns)
+	for _, row := range df.Rows {
+		if keep(row[col]) {
+			result.Rows = append(result.Rows, row)
+		}
+	}
+	return result, nil
+}
+
+func (df *DataFrame) Sort(column string, descending bool) (*DataFrame, error) {
+	col, err := df.columnIndex(column)
+	if err != nil {
+		return nil, err
+	}
+	result := df.derive(df.Columns)
+	result.Rows = append(result.Rows, df.Rows...)
+	sort.SliceStable(result.Rows, func(a, b int) bool {
+		cmp := compareValues(result.Rows[a][col], result.Rows[b][col])
+		if descending {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+	return result, nil
+}
+
+// aggregate reduces values with one of sum, mean, min, max or count. Nulls
+// are skipped.
+func aggregate(op string, values []interface{}) (interface{}, error) {
+	var present []interface{}
+	for _, v := range values {
+		if v != nil {
+			present = append(present, v)
+		}
+	}
+	switch op {
+	case "count":
+		return int64(len(present)), nil
+	case "sum", "mean":
+		sum := 0.0
+		allInts := true
+		for _, v := range present {
+			if !isNumber(v) {
+				return nil, newError(ErrTypeMismatch, "cannot %s non-numeric value %v", op, v)
+			}
+			_, isInt := v.(int64)
+			allInts = allInts && isInt
+			sum += toFloat(v)
+		}
+		if op == "mean" {
+			if len(present) == 0 {
+				return math.NaN(), nil
+			}
+			return sum / float64(len(present)), nil
+		}
+		if allInts {
+			return int64(sum), nil
+		}
+		return sum, nil
+	case "min", "max":
+		var best interface{}
+		for _, v := range present {
+			cmp := compareValues(v, best)
+			if best == nil || (op == "min" && cmp < 0) || (op == "max" && cmp > 0) {
+				best = v
+			}
+		}
+		return best, nil
+	}
+	return nil, newError(ErrInvalidOperation, "unknown aggregate %q", op)
+}
+
+// GroupBy groups rows by key and aggregates column in each group. Groups
+// appear in the order their key is first seen.
+func (df *DataFrame) GroupBy(key, op, column string) (*DataFrame, error) {
+	keyCol, err := df.columnIndex(key)
+	if err != nil {
+		return nil, err
+	}
+	valueCol, err := df.columnIndex(column)
+	if err != nil {
+		return nil, err
+	}
+	var order []string
+	keys := map[string]interface{}{}
+	groups := map[string][]interface{}{}
+	for _, row := range df.Rows {
+		id := fmt.Sprintf("%T:%v", row[keyCol], row[keyCol])
+		if _, seen := groups[id]; !seen {
+			order = append(order, id)
+			keys[id] = row[keyCol]
+		}
+		groups[id] = append(groups[id], row[valueCol])
+	}
+	result := df.derive([]string{key, op + "_" + column})
+	for _, id := range order {
+		value, err := aggregate(op, groups[id])
+		if err != nil {
+			return nil, err
+		}
+		result.Rows = append(result.Rows, []interface{}{keys[id], value})
+	}
+	return result, nil
+}
+
+// Join matches rows of df and other on equal values of column. An inner join
+// keeps matched rows only; a left join keeps every row of df, filling the
+// other frame's columns with null.
+func (df *DataFrame) Join(other *DataFrame, column, how string) (*DataFrame, error) {
+	if how != "inner" && how != "left" {
+		return nil, newError(ErrInvalidOperation, "unknown join type %q", how)
+	}
+	leftCol, err := df.columnIndex(column)
+	if err != nil {
+		return nil, err
+	}
+	rightCol, err := other.columnIndex(column)
+	if err != nil {
+		return nil, err
+	}
+	columns := append([]string(nil), df.Columns...)
+	for idx, name := range other.Columns {
+		if idx == rightCol {
+			continue
+		}
+		if _, err := df.columnIndex(name); err == nil {
+			name = name + "_right"
+		}
+		columns = append(columns, name)
+	}
+	result := df.derive(columns)
+	for _, left := range df.Rows {
+		matched := false
+		for _, right := range other.Rows {
+			if compareValues(left[leftCol], right[rightCol]) != 0 || left[leftCol] == nil {
+				continue
+			}
+			matched = true
+			row := append([]interface{}(nil), left...)
+			for idx, value := range right {
+				if idx != rightCol {
+					row = append(row, value)
+				}
+			}
+			result.Rows = append(result.Rows, row)
+		}
+		if !matched && how == "left" {
+			row := append([]interface{}(nil), left...)
+			for len(row) < len(columns) {
+				row = append(row, nil)
+			}
+			result.Rows = append(result.Rows, row)
+		}
+	}
+	return result, nil
+}
+
+func (df *DataFrame) Head(n int) *DataFrame {
+	if n < 0 {
+		n = 0
+	}
+	if n > len(df.Rows) {
+		n = len(df.Rows)
+	}
+	result := df.derive(df.Columns)
+	result.Rows = append(result.Rows, df.Rows[:n]...)
+	return result
+}
+
+// FromRecords builds a frame from a list of maps. Columns are the sorted
+// union of the record keys.
+func FromRecords(records []interface{}) (*DataFrame, error) {
+	seen := map[string]bool{}
+	var columns []string
+	for idx, record := range records {
+		fields, ok := record.(map[string]interface{})
+		if !ok {
+			return nil, newError(ErrTypeMismatch, "record %d is %s, not a map", idx, describeValue(record))
+		}
+		for name := range fields {
+			if !seen[name] {
+				seen[name] = true
+				columns = append(columns, name)
+			}
+		}
+	}
+	sort.Strings(columns)
+	df := &DataFrame{Columns: columns}
+	for _, record := range records {
+		fields := record.(map[string]interface{})
+		row := make([]interface{}, len(columns))
+		for idx, name := range columns {
+			row[idx] = fields[name]
+		}
+		df.Rows = append(df.Rows, row)
+	}
+	return df, nil
+}
+
+func frameArg(name string, args []interface{}, idx int) (*DataFrame, error) {
+	if idx >= len(args) {
+		return nil, newError(ErrTypeMismatch, "%s expects a dataframe as argument %d", name, idx+1)
+	}
+	df, ok := args[idx].(*DataFrame)
+	if !ok {
+		return nil, newError(ErrTypeMismatch, "%s expects a dataframe as argument %d, got %s", name, idx+1, describeValue(args[idx]))
+	}
+	return df, nil
+}
+
+func wantArgs(name string, args []interface{}, n int) error {
+	if len(args) < n {
+		return newError(ErrArity, "%s expects %d argument(s), got %d", name, n, len(args))
+	}
+	return nil
+}
+
+func stringArgs(values []interface{}) []string {
+	if len(values) == 1 {
+		if list := toStringSlice(values[0]); list != nil {
+			return list
+		}
+	}
+	result := make([]string, len(values))
+	for idx, v := range values {
+		result[idx] = toString(v)
+	}
+	return result
+}
+
+func dataframeModule(i *Interpreter) map[string]interface{} {
+	return map[string]interface{}{
+		"fromCSV": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("fromCSV", args, 1); err != nil {
+				return nil, err
+			}
+			data, err := os.ReadFile(toString(args[0]))
+			if err != nil {
+				return nil, err
+			}
+			return ParseCSV(string(data))
+		}),
+		"parseCSV": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("parseCSV", args, 1); err != nil {
+				return nil, err
+			}
+			return ParseCSV(toString(args[0]))
+		}),
+		"fromRecords": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("fromRecords", args, 1); err != nil {
+				return nil, err
+			}
+			records, ok := args[0].([]interface{})
+			if !ok {
+				return nil, newError(ErrTypeMismatch, "fromRecords expects a list of maps, got %s", describeValue(args[0]))
+			}
+			return FromRecords(records)
+		}),
+		"toCSV": NativeFunc(func(args []interface{}) (interface{}, error) {
+			df, err := frameArg("toCSV", args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return df.CSV()
+		}),
+		"writeCSV": NativeFunc(func(args []interface{}) (interface{}, error) {
+			df, err := frameArg("writeCSV", args, 0)
+			if err != nil {
+				return nil, err
+			}
+			if err := wantArgs("writeCSV", args, 2); err != nil {
+				return nil, err
+			}
+			text, err := df.CSV()
+			if err != nil {
+				return nil, err
+			}
+			if err := i.usage.write(int64(len(text))); err != nil {
+				return nil, err
+			}
+			return os.WriteFile(toString(args[1]), []byte(text), 0644) == nil, nil
+		}),
+		"columns": NativeFunc(func(args []interface{}) (interface{}, error) {
+			df, err := frameArg("columns", args, 0)
+			if err != nil {
+				return nil, err
+			}
+			names := make([]interface{}, len(df.Columns))
+			for idx, name := range df.Columns {
+				names[idx] = name
+			}
+			return names, nil
+		}),
+		"count": NativeFunc(func(args []interface{}) (interface{}, error) {
+			df, err := frameArg("count", args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return int64(len(df.Rows)), nil
+		}),
+		"column": NativeFunc(func(args []interface{}) (interface{}, error) {
+			df, err := frameArg("column", args, 0)
+			if err != nil {
+				return nil, err
+			}
+			if err := wantArgs("column", args, 2); err != nil {
+				return nil, err
+			}
+			col, err := df.columnIndex(toString(args[1]))
+			if err != nil {
+				return nil, err
+			}
+			values := make([]interface{}, len(df.Rows))
+			for idx, row := range df.Rows {
+				values[idx] = row[col]
+			}
+			return values, nil
+		}),
+		"select": NativeFunc(func(args []interface{}) (interface{}, error) {
+			df, err := frameArg("select", args, 0)
+			if err != nil {
+				return nil, err
+			}
+			if err := wantArgs("select", args, 2); err != nil {
+				return nil, err
+			}
+			return df.Select(stringArgs(args[1:]))
+		}),
+		"filter": NativeFunc(func(args []interface{}) (interface{}, error) {
+			df, err := frameArg("filter", args, 0)
+			if err != nil {
+				return nil, err
+			}
+			if err := wantArgs("filter", args, 4); err != nil {
+				return nil, err
+			}
+			return df.Filter(toString(args[1]), toString(args[2]), args[3])
+		}),
+		"sort": NativeFunc(func(args []interface{}) (interface{}, error) {
+			df, err := frameArg("sort", args, 0)
+			if err != nil {
+				return nil, err
+			}
+			if err := wantArgs("sort", args, 2); err != nil {
+				return nil, err
+			}
+			descending := len(args) > 2 && toBool(args[2])
+			return df.Sort(toString(args[1]), descending)
+		}),
+		"groupBy": NativeFunc(func(args []interface{}) (interface{}, error) {
+			df, err := frameArg("groupBy", args, 0)
+			if err != nil {
+				return nil, err
+			}
+			if err := wantArgs("groupBy", args, 4); err != nil {
+				return nil, err
+			}
+			return df.GroupBy(toString(args[1]), toString(args[2]), toString(args[3]))
+		}),
+		"aggregate": NativeFunc(func(args []interface{}) (interface{}, error) {
+			df, err := frameArg("aggregate", args, 0)
+			if err != nil {
+				return nil, err
+			}
+			if err := wantArgs("aggregate", args, 3); err != nil {
+				return nil, err
+			}
+			col, err := df.columnIndex(toString(args[2]))
+			if err != nil {
+				return nil, err
+			}
+			values := make([]interface{}, len(df.Rows))
+			for idx, row := range df.Rows {
+				values[idx] = row[col]
+			}
+			return aggregate(toString(args[1]), values)
+		}),
+		"join": NativeFunc(func(args []interface{}) (interface{}, error) {
+			left, err := frameArg("join", args, 0)
+			if err != nil {
+				return nil, err
+			}
+			right, err := frameArg("join", args, 1)
+			if err != nil {
+				return nil, err
+			}
+			if err := wantArgs("join", args, 3); err != nil {
+				return nil, err
+			}
+			how := "inner"
+			if len(args) > 3 {
+				how = toString(args[3])
+			}
+			return left.Join(right, toString(args[2]), how)
+		}),
+		"head": NativeFunc(func(args []interface{}) (interface{}, error) {
+			df, err := frameArg("head", args, 0)
+			if err != nil {
+				return nil, err
+			}
+			n := int64(5)
+			if len(args) > 1 {
+				n = toInt(args[1])
+			}
+			return df.Head(int(n)), nil
+		}),
+	}
+}
@@ -0,0 +1,53 @@
+package strata
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDataframeWrangling(t *testing.T) {
+	source := `import io from std::io
+import df from std::dataframe
+let sales: dataframe = df.parseCSV("region,item,amount\nnorth,pen,3\nsouth,ink,10\nnorth,ink,5\neast,pen,1\n")
+let regions: dataframe = df.fromRecords([{"region": "north", "manager": "Ada"}, {"region": "south", "manager": "Lin"}])
+io.print(df.columns(sales))
+io.print(df.count(df.filter(sales, "amount", ">", 2)))
+io.print(df.column(df.sort(sales, "amount", true), "item"))
+io.print(df.toCSV(df.groupBy(sales, "region", "sum", "amount")))
+io.print(df.aggregate(sales, "mean", "amount"))
+io.print(df.toCSV(df.select(df.join(sales, regions, "region"), "manager", "amount")))
+io.print(df.count(df.join(sales, regions, "region", "left")))
+io.print(df.head(sales, 1))
+`
+	var out strings.Builder
+	if err := RunSource(source, RunOptions{Stdout: &out}); err != nil {
+		t.Fatal(err)
+	}
+	want := `["region", "item", "amount"]
+3
+["ink", "ink", "pen", "pen"]
+region,sum_amount
+north,8
+south,10
+east,1
+
+4.75
+manager,amount
+Ada,3
+Lin,10
+Ada,5
+
+4
+region  item  amount
+north   pen   3
+[1 rows x 3 columns]
+`
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+
+	err := RunSource("import df from std::dataframe\nlet d: dataframe = df.parseCSV(\"a\\n1\\n\")\nlet c: list = df.column(d, \"b\")\n", RunOptions{Stdout: &out})
+	if err == nil || !strings.Contains(err.Error(), `dataframe has no column "b"`) {
+		t.Errorf("reading a missing column gave %v", err)
+	}
+}
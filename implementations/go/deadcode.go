@@ -0,0 +1,158 @@
+package strata
+
+// ============================================================================
+// DEAD CODE - Dropping what a built program can never run
+// ============================================================================
+
+// `strata build` runs eliminateDeadCode over the entry module before handing
+// it to a backend, so that generated C, JavaScript and IR carry only what
+// the program can reach:
+//
+//   - an if, while or for whose condition is a constant keeps only the
+//     branch that runs, spliced into the enclosing block, which is safe as
+//     variables live until the end of their function;
+//   - statements after a return, break, continue or throw in the same block
+//     go, except declarations;
+//   - top-level functions that nothing reachable refers to go, and with
+//     them anything only they referred to;
+//   - imports whose alias nothing refers to go.
+//
+// References are found by name, so a local variable that shadows a
+// function keeps the function: the pass only ever errs on keeping code.
+
+// eliminateDeadCode returns the program without the code it can never run.
+// The statements given are left as they are.
+func eliminateDeadCode(statements []*Stmt) []*Stmt {
+	statements = pruneBlock(statements)
+	functions := make(map[string][]*Stmt)
+	var pending []*Stmt
+	for _, stmt := range statements {
+		switch stmt.Kind {
+		case StmtFunction:
+			functions[stmt.Name] = append(functions[stmt.Name], stmt)
+		case StmtImport:
+		default:
+			pending = append(pending, stmt)
+		}
+	}
+	used := make(map[string]bool)
+	for len(pending) > 0 {
+		stmt := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		Inspect(stmt, func(n Node) bool {
+			if expr, ok := n.(*Expr); ok && expr.Kind == ExprIdentifier && !used[expr.Name] {
+				used[expr.Name] = true
+				pending = append(pending, functions[expr.Name]...)
+			}
+			return true
+		})
+	}
+	var kept []*Stmt
+	for _, stmt := range statements {
+		if (stmt.Kind == StmtFunction || stmt.Kind == StmtImport) && !used[stmt.Name] {
+			continue
+		}
+		kept = append(kept, stmt)
+	}
+	return kept
+}
+
+// pruneBlock drops the unreachable statements and branches of a block.
+func pruneBlock(block []*Stmt) []*Stmt {
+	if block == nil {
+		return nil
+	}
+	kept := []*Stmt{}
+	ended := false
+	for _, stmt := range block {
+		if stmt == nil {
+			continue
+		}
+		if ended {
+			switch stmt.Kind {
+			case StmtFunction, StmtClass, StmtEnum, StmtInterface, StmtImport:
+				kept = append(kept, pruneStmt(stmt)...)
+			}
+			continue
+		}
+		for _, pruned := range pruneStmt(stmt) {
+			kept = append(kept, pruned)
+			switch pruned.Kind {
+			case StmtReturn, StmtBreak, StmtContinue, StmtThrow:
+				ended = true
+			}
+		}
+	}
+	return kept
+}
+
+// pruneStmt returns what stmt comes to with its dead branches dropped: a
+// copy of it, or the statements of the branch that always runs.
+func pruneStmt(stmt *Stmt) []*Stmt {
+	switch stmt.Kind {
+	case StmtIf:
+		if value, ok := constantCondition(stmt.Condition); ok {
+			if value {
+				return pruneBlock(stmt.Then)
+			}
+			return pruneBlock(stmt.Else)
+		}
+	case StmtWhile:
+		if value, ok := constantCondition(stmt.Condition); ok && !value {
+			return pruneBlock(stmt.Else)
+		}
+	case StmtFor:
+		if value, ok := constantCondition(stmt.Condition); ok && !value {
+			var init []*Stmt
+			if stmt.Init != nil {
+				init = append(init, stmt.Init)
+			}
+			return append(init, pruneBlock(stmt.Else)...)
+		}
+	}
+	pruned := *stmt
+	pruned.Then = pruneBlock(stmt.Then)
+	pruned.Else = pruneBlock(stmt.Else)
+	pruned.Body = pruneBlock(stmt.Body)
+	pruned.Catch = pruneBlock(stmt.Catch)
+	pruned.Finally = pruneBlock(stmt.Finally)
+	if stmt.Cases != nil {
+		pruned.Cases = make([]MatchCase, len(stmt.Cases))
+		for idx, c := range stmt.Cases {
+			pruned.Cases[idx] = MatchCase{Pattern: c.Pattern, Body: pruneBlock(c.Body)}
+		}
+	}
+	return []*Stmt{&pruned}
+}
+
+// constantCondition is the value of a condition that does not depend on
+// anything the program computes, such as `false` or `!true && x`.
+func constantCondition(expr *Expr) (bool, bool) {
+	if expr == nil {
+		return false, false
+	}
+	switch expr.Kind {
+	case ExprLiteral:
+		value, ok := expr.Value.(bool)
+		return value, ok
+	case ExprUnary:
+		if expr.Op == "!" {
+			value, ok := constantCondition(expr.Operand)
+			return !value, ok
+		}
+	case ExprBinary:
+		if expr.Op != "&&" && expr.Op != "||" {
+			break
+		}
+		left, ok := constantCondition(expr.Left)
+		if !ok {
+			break
+		}
+		// The right operand decides only when the left does not.
+		if left == (expr.Op == "||") {
+			return left, true
+		}
+		return constantCondition(expr.Right)
+	}
+	return false, false
+}
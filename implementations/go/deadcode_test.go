@@ -0,0 +1,71 @@
+package strata
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEliminateDeadCode(t *testing.T) {
+	source := `import io from std::io
+import math from std::math
+func helper(n: int) => int {
+  return n + 1
+}
+func unused() => int {
+  return helper(1)
+}
+func used(n: int) => int {
+  if (false) {
+    return unused()
+  }
+  return helper(n)
+  io.print("after return")
+}
+func onlyInDeadBranch() => void {
+}
+if (!true && used(1) > 0) {
+  onlyInDeadBranch()
+} else {
+  io.print(used(2))
+}
+while (false) {
+  io.print("never")
+} else {
+  io.print("loop else")
+}
+`
+	statements, err := ParseSource(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := NewJSGenerator().Generate(eliminateDeadCode(statements))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, gone := range []string{"math", "unused", "onlyInDeadBranch", "after return", "never", "if ("} {
+		if strings.Contains(code, gone) {
+			t.Errorf("generated code keeps %q:\n%s", gone, code)
+		}
+	}
+	for _, kept := range []string{"function helper", "function used", "io.print(used(2));", `io.print("loop else");`} {
+		if !strings.Contains(code, kept) {
+			t.Errorf("generated code lacks %q:\n%s", kept, code)
+		}
+	}
+	if len(statements) != 8 || len(statements[4].Body) != 3 {
+		t.Error("eliminateDeadCode changed the statements it was given")
+	}
+
+	var want, got strings.Builder
+	if err := RunSource(source, RunOptions{Stdout: &want}); err != nil {
+		t.Fatal(err)
+	}
+	interp := NewInterpreter()
+	RunOptions{Stdout: &got}.Configure(interp)
+	if err := interp.Interpret(eliminateDeadCode(statements)); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("the pruned program printed\n%s\nthe whole one\n%s", got.String(), want.String())
+	}
+}
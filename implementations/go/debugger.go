@@ -0,0 +1,689 @@
+package strata
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ============================================================================
+// DEBUGGER - Breakpoints and stepping, served over the Debug Adapter Protocol
+// ============================================================================
+
+// Debugger pauses an interpreter at breakpoints and steps. The interpreter
+// calls pause before every statement; while paused it blocks, running the
+// inspection requests the adapter sends it until one of them resumes it.
+type Debugger struct {
+	mu          sync.Mutex
+	breakpoints map[string]map[int]bool
+	mode        stepMode
+	// depth is the call depth the current step started at.
+	depth          int
+	last           debugPosition
+	pauseRequested bool
+	stopOnEntry    bool
+	terminated     bool
+	paused         bool
+	evaluating     bool
+	actions        chan debugAction
+	// stopped is called, on the interpreter's goroutine, each time it
+	// pauses.
+	stopped func(reason string)
+}
+
+type stepMode int
+
+const (
+	stepContinue stepMode = iota
+	stepIn
+	stepOver
+	stepOut
+)
+
+type debugPosition struct {
+	file  string
+	line  int
+	depth int
+}
+
+// debugAction is sent to a paused interpreter: either work to run while it
+// stays paused, or the step mode to resume with.
+type debugAction struct {
+	inspect   func()
+	resume    stepMode
+	terminate bool
+}
+
+func NewDebugger() *Debugger {
+	return &Debugger{breakpoints: make(map[string]map[int]bool), actions: make(chan debugAction)}
+}
+
+// SetBreakpoints replaces the breakpoints in file.
+func (d *Debugger) SetBreakpoints(file string, lines []int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	set := make(map[int]bool, len(lines))
+	for _, line := range lines {
+		set[line] = true
+	}
+	d.breakpoints[canonicalPath(file)] = set
+}
+
+func canonicalPath(file string) string {
+	if abs, err := filepath.Abs(file); err == nil {
+		return filepath.Clean(abs)
+	}
+	return file
+}
+
+// currentFile is the path of the file the interpreter is executing.
+func (i *Interpreter) currentFile() string {
+	if i.module != nil {
+		return i.module.Path
+	}
+	return i.File
+}
+
+// pause is called before each statement. It returns an ExitError once the
+// session has been terminated.
+func (d *Debugger) pause(i *Interpreter, stmt *Stmt) error {
+	if stmt.Location.Line == 0 {
+		return nil
+	}
+	pos := debugPosition{file: canonicalPath(i.currentFile()), line: stmt.Location.Line, depth: len(i.CallStack)}
+	d.mu.Lock()
+	if d.terminated {
+		d.mu.Unlock()
+		return &ExitError{Code: 0}
+	}
+	if d.evaluating {
+		d.mu.Unlock()
+		return nil
+	}
+	moved := pos != d.last
+	d.last = pos
+	reason := ""
+	switch {
+	case d.stopOnEntry:
+		reason = "entry"
+	case d.pauseRequested:
+		reason = "pause"
+	case !moved:
+	case d.breakpoints[pos.file][pos.line]:
+		reason = "breakpoint"
+	case d.mode == stepIn,
+		d.mode == stepOver && pos.depth <= d.depth,
+		d.mode == stepOut && pos.depth < d.depth:
+		reason = "step"
+	}
+	if reason == "" {
+		d.mu.Unlock()
+		return nil
+	}
+	d.pauseRequested, d.stopOnEntry = false, false
+	d.paused = true
+	d.mu.Unlock()
+
+	d.stopped(reason)
+	for action := range d.actions {
+		if action.inspect != nil {
+			action.inspect()
+			continue
+		}
+		d.mu.Lock()
+		d.paused = false
+		d.mode = action.resume
+		d.depth = pos.depth
+		d.mu.Unlock()
+		if action.terminate {
+			return &ExitError{Code: 0}
+		}
+		return nil
+	}
+	return nil
+}
+
+// whilePaused runs fn on the interpreter's goroutine and reports whether the
+// interpreter was paused to run it.
+func (d *Debugger) whilePaused(fn func()) bool {
+	d.mu.Lock()
+	paused := d.paused
+	d.mu.Unlock()
+	if !paused {
+		return false
+	}
+	done := make(chan struct{})
+	d.actions <- debugAction{inspect: func() { fn(); close(done) }}
+	<-done
+	return true
+}
+
+// resume continues a paused interpreter with mode, returning false if it
+// was not paused.
+func (d *Debugger) resume(mode stepMode) bool {
+	d.mu.Lock()
+	paused := d.paused
+	d.mu.Unlock()
+	if paused {
+		d.actions <- debugAction{resume: mode}
+	}
+	return paused
+}
+
+// Terminate stops the program at its next statement.
+func (d *Debugger) Terminate() {
+	d.mu.Lock()
+	d.terminated = true
+	paused := d.paused
+	d.mu.Unlock()
+	if paused {
+		d.actions <- debugAction{terminate: true}
+	}
+}
+
+// debugFrame is one entry of a paused interpreter's call stack, innermost
+// first.
+type debugFrame struct {
+	Name     string
+	File     string
+	Location Location
+	Env      *Environment
+}
+
+func (i *Interpreter) debugFrames() []debugFrame {
+	frames := []debugFrame{{Location: i.Location, File: i.currentFile(), Env: i.Env}}
+	for idx := len(i.CallStack) - 1; idx >= 0; idx-- {
+		frame := i.CallStack[idx]
+		frames[len(frames)-1].Name = frame.Function
+		file := i.File
+		if frame.Module != nil {
+			file = frame.Module.Path
+		}
+		frames = append(frames, debugFrame{Location: frame.CallSite, File: file, Env: frame.Env})
+	}
+	frames[len(frames)-1].Name = "<main>"
+	return frames
+}
+
+// evaluateIn evaluates an expression typed into the debugger in env. Any
+// function it calls runs without stopping at breakpoints.
+func (i *Interpreter) evaluateIn(d *Debugger, source string, env *Environment) (value interface{}, err error) {
+	defer recoverInternalError(&err)
+	statements, err := ParseSource(source)
+	if err != nil {
+		return nil, err
+	}
+	if len(statements) != 1 || statements[0].Kind != StmtExpression {
+		return nil, errors.New("only expressions can be evaluated")
+	}
+	d.mu.Lock()
+	d.evaluating = true
+	d.mu.Unlock()
+	savedEnv, savedDepth, savedFlow, savedLocation := i.Env, len(i.CallStack), i.ControlFlow, i.Location
+	defer func() {
+		i.Env, i.CallStack, i.ControlFlow, i.Location = savedEnv, i.CallStack[:savedDepth], savedFlow, savedLocation
+		d.mu.Lock()
+		d.evaluating = false
+		d.mu.Unlock()
+	}()
+	i.Env = env
+	return i.evaluateExpression(statements[0].Expr)
+}
+
+// ----------------------------------------------------------------------------
+// Debug Adapter Protocol
+// ----------------------------------------------------------------------------
+
+type dapMessage struct {
+	Seq        int             `json:"seq"`
+	Type       string          `json:"type"`
+	Command    string          `json:"command,omitempty"`
+	Arguments  json.RawMessage `json:"arguments,omitempty"`
+	RequestSeq int             `json:"request_seq,omitempty"`
+	Success    *bool           `json:"success,omitempty"`
+	Message    string          `json:"message,omitempty"`
+	Event      string          `json:"event,omitempty"`
+	Body       interface{}     `json:"body,omitempty"`
+}
+
+// DebugAdapter serves one debugging session over DAP. Requests are read and
+// answered on one goroutine; the program runs on another.
+type DebugAdapter struct {
+	in       *bufio.Reader
+	out      io.Writer
+	writeMu  sync.Mutex
+	seq      int
+	debugger *Debugger
+	program  string
+	args     []string
+	entry    bool
+	done     chan struct{}
+	// handles maps variablesReference numbers to scopes and values. They
+	// are only valid until the program resumes.
+	handles []interface{}
+	frames  []debugFrame
+	interp  *Interpreter
+}
+
+func NewDebugAdapter(in io.Reader, out io.Writer) *DebugAdapter {
+	return &DebugAdapter{in: bufio.NewReader(in), out: out, debugger: NewDebugger()}
+}
+
+func (a *DebugAdapter) read() (*dapMessage, error) {
+	length := -1
+	for {
+		line, err := a.in.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(name, "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("invalid Content-Length: %s", value)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("missing Content-Length header")
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(a.in, body); err != nil {
+		return nil, err
+	}
+	var msg dapMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+func (a *DebugAdapter) send(msg dapMessage) {
+	a.writeMu.Lock()
+	defer a.writeMu.Unlock()
+	a.seq++
+	msg.Seq = a.seq
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(a.out, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+func (a *DebugAdapter) event(name string, body interface{}) {
+	a.send(dapMessage{Type: "event", Event: name, Body: body})
+}
+
+func (a *DebugAdapter) respond(req *dapMessage, body interface{}) {
+	success := true
+	a.send(dapMessage{Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: &success, Body: body})
+}
+
+func (a *DebugAdapter) fail(req *dapMessage, format string, args ...interface{}) {
+	success := false
+	a.send(dapMessage{Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: &success, Message: fmt.Sprintf(format, args...)})
+}
+
+// outputWriter forwards program output to the client as output events.
+type outputWriter struct {
+	adapter  *DebugAdapter
+	category string
+}
+
+func (w outputWriter) Write(p []byte) (int, error) {
+	w.adapter.event("output", map[string]interface{}{"category": w.category, "output": string(p)})
+	return len(p), nil
+}
+
+// Serve handles requests until the client disconnects.
+func (a *DebugAdapter) Serve() error {
+	a.debugger.stopped = func(reason string) {
+		a.event("stopped", map[string]interface{}{"reason": reason, "threadId": 1, "allThreadsStopped": true})
+	}
+	for {
+		req, err := a.read()
+		if err == io.EOF {
+			a.debugger.Terminate()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if req.Type != "request" {
+			continue
+		}
+		if !a.handle(req) {
+			return nil
+		}
+	}
+}
+
+// handle answers one request and reports whether the session goes on.
+func (a *DebugAdapter) handle(req *dapMessage) bool {
+	switch req.Command {
+	case "initialize":
+		a.respond(req, map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsEvaluateForHovers":        true,
+			"supportsTerminateRequest":         true,
+		})
+		a.event("initialized", nil)
+	case "launch":
+		var args struct {
+			Program     string   `json:"program"`
+			Args        []string `json:"args"`
+			StopOnEntry bool     `json:"stopOnEntry"`
+		}
+		if err := json.Unmarshal(req.Arguments, &args); err != nil || args.Program == "" {
+			a.fail(req, "launch needs a program")
+			return true
+		}
+		a.program, a.args, a.entry = args.Program, args.Args, args.StopOnEntry
+		a.respond(req, nil)
+	case "setBreakpoints":
+		var args struct {
+			Source struct {
+				Path string `json:"path"`
+			} `json:"source"`
+			Breakpoints []struct {
+				Line int `json:"line"`
+			} `json:"breakpoints"`
+		}
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			a.fail(req, "invalid arguments: %v", err)
+			return true
+		}
+		lines := make([]int, len(args.Breakpoints))
+		verified := make([]interface{}, len(args.Breakpoints))
+		for idx, bp := range args.Breakpoints {
+			lines[idx] = bp.Line
+			verified[idx] = map[string]interface{}{"verified": true, "line": bp.Line}
+		}
+		a.debugger.SetBreakpoints(args.Source.Path, lines)
+		a.respond(req, map[string]interface{}{"breakpoints": verified})
+	case "setExceptionBreakpoints":
+		a.respond(req, map[string]interface{}{"breakpoints": []interface{}{}})
+	case "configurationDone":
+		if a.program == "" {
+			a.fail(req, "launch must come before configurationDone")
+			return true
+		}
+		a.respond(req, nil)
+		a.start()
+	case "threads":
+		a.respond(req, map[string]interface{}{"threads": []interface{}{map[string]interface{}{"id": 1, "name": "main"}}})
+	case "stackTrace":
+		a.stackTrace(req)
+	case "scopes":
+		a.scopes(req)
+	case "variables":
+		a.variables(req)
+	case "evaluate":
+		a.evaluate(req)
+	case "continue", "next", "stepIn", "stepOut":
+		mode := map[string]stepMode{"continue": stepContinue, "next": stepOver, "stepIn": stepIn, "stepOut": stepOut}[req.Command]
+		a.handles, a.frames = nil, nil
+		if !a.debugger.resume(mode) {
+			a.fail(req, "the program is not paused")
+			return true
+		}
+		a.respond(req, map[string]interface{}{"allThreadsContinued": true})
+	case "pause":
+		a.debugger.mu.Lock()
+		a.debugger.pauseRequested = true
+		a.debugger.mu.Unlock()
+		a.respond(req, nil)
+	case "disconnect", "terminate":
+		a.debugger.Terminate()
+		if a.done != nil {
+			<-a.done
+		}
+		a.respond(req, nil)
+		return req.Command != "disconnect"
+	default:
+		a.fail(req, "unsupported request: %s", req.Command)
+	}
+	return true
+}
+
+// start runs the program on its own goroutine, reporting its output, its
+// errors and its exit as events.
+func (a *DebugAdapter) start() {
+	a.done = make(chan struct{})
+	a.debugger.stopOnEntry = a.entry
+	go func() {
+		defer close(a.done)
+		code := a.run()
+		a.event("exited", map[string]interface{}{"exitCode": code})
+		a.event("terminated", nil)
+	}()
+}
+
+func (a *DebugAdapter) run() (code int) {
+	stderr := outputWriter{adapter: a, category: "stderr"}
+	project, err := LoadProject(a.program)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	if project.ReportDiagnostics(stderr) > 0 {
+		return 1
+	}
+	entry := project.EntryModule()
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(stderr, "Internal error: %v\n", r)
+			code = 2
+		}
+	}()
+	interp := NewInterpreter()
+	RunOptions{Stdout: outputWriter{adapter: a, category: "stdout"}, Stderr: stderr, Args: a.args}.Configure(interp)
+	interp.UseProject(project)
+	interp.Debugger = a.debugger
+	a.interp = interp
+	err = interp.Interpret(entry.Statements)
+	var exit *ExitError
+	if errors.As(err, &exit) {
+		return exit.Code
+	}
+	if err != nil {
+		fmt.Fprint(stderr, RenderError(err, project.RelPath(entry.Path), entry.Source))
+		return 1
+	}
+	return 0
+}
+
+// reference registers v for a variablesReference.
+func (a *DebugAdapter) reference(v interface{}) int {
+	a.handles = append(a.handles, v)
+	return len(a.handles)
+}
+
+func (a *DebugAdapter) stackTrace(req *dapMessage) {
+	var frames []interface{}
+	if !a.debugger.whilePaused(func() {
+		a.frames = a.interp.debugFrames()
+		for idx, frame := range a.frames {
+			frames = append(frames, map[string]interface{}{
+				"id":     idx + 1,
+				"name":   frame.Name,
+				"line":   frame.Location.Line,
+				"column": frame.Location.Column,
+				"source": map[string]interface{}{"name": filepath.Base(frame.File), "path": frame.File},
+			})
+		}
+	}) {
+		a.fail(req, "the program is not paused")
+		return
+	}
+	a.respond(req, map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)})
+}
+
+// frameArg returns the frame a request's frameId names, or nil.
+func (a *DebugAdapter) frameArg(raw json.RawMessage) *debugFrame {
+	var args struct {
+		FrameID int `json:"frameId"`
+	}
+	json.Unmarshal(raw, &args)
+	if args.FrameID < 1 || args.FrameID > len(a.frames) {
+		return nil
+	}
+	return &a.frames[args.FrameID-1]
+}
+
+// scopes lists a frame's environment chain, innermost first; the outermost
+// is the globals.
+func (a *DebugAdapter) scopes(req *dapMessage) {
+	frame := a.frameArg(req.Arguments)
+	if frame == nil {
+		a.fail(req, "unknown frame")
+		return
+	}
+	var scopes []interface{}
+	a.debugger.whilePaused(func() {
+		for env, depth := frame.Env, 0; env != nil; env, depth = env.Parent, depth+1 {
+			name := "Locals"
+			switch {
+			case env.Parent == nil:
+				name = "Globals"
+			case depth > 0:
+				name = fmt.Sprintf("Enclosing %d", depth)
+			}
+			scopes = append(scopes, map[string]interface{}{
+				"name":               name,
+				"variablesReference": a.reference(env),
+				"expensive":          env.Parent == nil,
+			})
+		}
+	})
+	a.respond(req, map[string]interface{}{"scopes": scopes})
+}
+
+func (a *DebugAdapter) variables(req *dapMessage) {
+	var args struct {
+		Ref int `json:"variablesReference"`
+	}
+	json.Unmarshal(req.Arguments, &args)
+	if args.Ref < 1 || args.Ref > len(a.handles) {
+		a.fail(req, "unknown variablesReference %d", args.Ref)
+		return
+	}
+	variables := []interface{}{}
+	a.debugger.whilePaused(func() {
+		add := func(name string, value interface{}) {
+			variables = append(variables, a.variable(name, value))
+		}
+		switch v := a.handles[args.Ref-1].(type) {
+		case *Environment:
+			vars := v.bindings()
+			for _, name := range varNames(vars) {
+				add(name, vars[name].Value)
+			}
+		case []interface{}:
+			for idx, item := range v {
+				add(strconv.Itoa(idx), item)
+			}
+		case Tuple:
+			for idx, item := range v {
+				add(strconv.Itoa(idx), item)
+			}
+		case map[string]interface{}:
+			for _, key := range a.interp.iterationKeys(v) {
+				add(key, v[key])
+			}
+		case *Instance:
+			for _, name := range varNames(v.Fields) {
+				add(name, v.Fields[name].Value)
+			}
+		}
+	})
+	a.respond(req, map[string]interface{}{"variables": variables})
+}
+
+// variable describes one value, giving collections and instances a
+// reference so the client can expand them.
+func (a *DebugAdapter) variable(name string, value interface{}) map[string]interface{} {
+	ref := 0
+	switch v := value.(type) {
+	case []interface{}:
+		if len(v) > 0 {
+			ref = a.reference(v)
+		}
+	case Tuple:
+		if len(v) > 0 {
+			ref = a.reference(v)
+		}
+	case map[string]interface{}:
+		if len(v) > 0 {
+			ref = a.reference(v)
+		}
+	case *Instance:
+		ref = a.reference(v)
+	}
+	return map[string]interface{}{"name": name, "value": formatElement(value), "type": describeValue(value), "variablesReference": ref}
+}
+
+func (a *DebugAdapter) evaluate(req *dapMessage) {
+	var args struct {
+		Expression string `json:"expression"`
+	}
+	json.Unmarshal(req.Arguments, &args)
+	frame := a.frameArg(req.Arguments)
+	var result map[string]interface{}
+	var evalErr error
+	if !a.debugger.whilePaused(func() {
+		env := a.interp.Env
+		if frame != nil {
+			env = frame.Env
+		}
+		value, err := a.interp.evaluateIn(a.debugger, args.Expression, env)
+		var located *RuntimeError
+		if errors.As(err, &located) {
+			err = located.Err
+		}
+		if err != nil {
+			evalErr = err
+			return
+		}
+		v := a.variable("", value)
+		result = map[string]interface{}{"result": v["value"], "type": v["type"], "variablesReference": v["variablesReference"]}
+	}) {
+		a.fail(req, "the program is not paused")
+		return
+	}
+	if evalErr != nil {
+		a.fail(req, "%v", evalErr)
+		return
+	}
+	a.respond(req, result)
+}
+
+// varNames lists the names in a scope or an instance's fields in order.
+func varNames(vars map[string]*VarEntry) []string {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DebugProgram runs `strata debug`, serving the Debug Adapter Protocol on
+// stdin and stdout, and returns its exit code.
+func DebugProgram() int {
+	if err := NewDebugAdapter(os.Stdin, os.Stdout).Serve(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,159 @@
+package strata
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dapClient drives a DebugAdapter as an editor would, over in-memory pipes.
+type dapClient struct {
+	t        *testing.T
+	requests io.Writer
+	messages chan map[string]interface{}
+	seq      int
+	output   strings.Builder
+}
+
+func newDAPClient(t *testing.T) *dapClient {
+	clientIn, adapterOut := io.Pipe()
+	adapterIn, clientOut := io.Pipe()
+	c := &dapClient{t: t, requests: clientOut, messages: make(chan map[string]interface{}, 64)}
+	go NewDebugAdapter(adapterIn, adapterOut).Serve()
+	go func() {
+		in := bufio.NewReader(clientIn)
+		for {
+			header, err := in.ReadString('\n')
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			length, _ := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(header, "Content-Length:")))
+			in.ReadString('\n')
+			body := make([]byte, length)
+			io.ReadFull(in, body)
+			var msg map[string]interface{}
+			json.Unmarshal(body, &msg)
+			c.messages <- msg
+		}
+	}()
+	t.Cleanup(func() {
+		clientOut.Close()
+		adapterOut.Close()
+	})
+	return c
+}
+
+// request sends a request and returns the body of its response, failing
+// the test if it did not succeed.
+func (c *dapClient) request(command string, args interface{}) map[string]interface{} {
+	c.t.Helper()
+	c.seq++
+	data, _ := json.Marshal(map[string]interface{}{"seq": c.seq, "type": "request", "command": command, "arguments": args})
+	fmt.Fprintf(c.requests, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	msg := c.await("response", command)
+	if msg["success"] != true {
+		c.t.Fatalf("%s failed: %v", command, msg["message"])
+	}
+	body, _ := msg["body"].(map[string]interface{})
+	return body
+}
+
+// await returns the next response to command or event of that name,
+// collecting program output on the way.
+func (c *dapClient) await(kind, name string) map[string]interface{} {
+	c.t.Helper()
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case msg, ok := <-c.messages:
+			if !ok {
+				c.t.Fatalf("the adapter closed before %s %s", kind, name)
+			}
+			if msg["type"] == "event" && msg["event"] == "output" {
+				c.output.WriteString(msg["body"].(map[string]interface{})["output"].(string))
+			}
+			if msg["type"] == kind && (msg["command"] == name || msg["event"] == name) {
+				return msg
+			}
+		case <-timeout:
+			c.t.Fatalf("timed out waiting for %s %s", kind, name)
+		}
+	}
+}
+
+// stoppedAt waits for the program to stop and returns the reason and the
+// stack frames, innermost first.
+func (c *dapClient) stoppedAt() (string, []interface{}) {
+	c.t.Helper()
+	reason := c.await("event", "stopped")["body"].(map[string]interface{})["reason"].(string)
+	return reason, c.request("stackTrace", map[string]interface{}{"threadId": 1})["stackFrames"].([]interface{})
+}
+
+func TestDebugAdapterSession(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	program := filepath.Join(t.TempDir(), "main.str")
+	os.WriteFile(program, []byte(`import io from std::io
+func double(n: int) => int {
+  let d: int = n * 2
+  return d
+}
+let x: int = 20
+let y: int = double(x)
+io.print(y + 2)
+`), 0644)
+
+	c := newDAPClient(t)
+	c.request("initialize", map[string]interface{}{"adapterID": "strata"})
+	c.await("event", "initialized")
+	c.request("launch", map[string]interface{}{"program": program})
+	set := c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]interface{}{"path": program},
+		"breakpoints": []interface{}{map[string]interface{}{"line": 3}},
+	})
+	if bps := set["breakpoints"].([]interface{}); len(bps) != 1 || bps[0].(map[string]interface{})["verified"] != true {
+		t.Errorf("setBreakpoints answered %v", set)
+	}
+	c.request("configurationDone", nil)
+
+	reason, frames := c.stoppedAt()
+	if reason != "breakpoint" || len(frames) != 2 {
+		t.Fatalf("stopped for %s with frames %v", reason, frames)
+	}
+	top, caller := frames[0].(map[string]interface{}), frames[1].(map[string]interface{})
+	if top["name"] != "double" || top["line"] != 3.0 || caller["name"] != "<main>" || caller["line"] != 7.0 {
+		t.Errorf("the stack is %v", frames)
+	}
+	if got := c.request("evaluate", map[string]interface{}{"expression": "n + 1", "frameId": 1})["result"]; got != "21" {
+		t.Errorf("n + 1 evaluated to %v", got)
+	}
+	if got := c.request("evaluate", map[string]interface{}{"expression": "x", "frameId": 2})["result"]; got != "20" {
+		t.Errorf("x in the caller evaluated to %v", got)
+	}
+
+	c.request("next", map[string]interface{}{"threadId": 1})
+	reason, frames = c.stoppedAt()
+	if line := frames[0].(map[string]interface{})["line"]; reason != "step" || line != 4.0 {
+		t.Errorf("next stopped for %s at line %v, want a step to line 4", reason, line)
+	}
+	if got := c.request("evaluate", map[string]interface{}{"expression": "d", "frameId": 1})["result"]; got != "40" {
+		t.Errorf("d evaluated to %v", got)
+	}
+
+	c.request("continue", map[string]interface{}{"threadId": 1})
+	exited := c.await("event", "exited")["body"].(map[string]interface{})
+	if exited["exitCode"] != 0.0 {
+		t.Errorf("the program exited with %v", exited["exitCode"])
+	}
+	if c.output.String() != "42\n" {
+		t.Errorf("the program printed %q", c.output.String())
+	}
+	c.request("disconnect", nil)
+}
@@ -0,0 +1,386 @@
+package strata
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ============================================================================
+// DIAGNOSTICS - Front-end and runtime errors with source excerpts
+// ============================================================================
+
+const diagnosticContext = 1
+
+// traceFrames is how many of the innermost and of the outermost calls a
+// trace shows; the frames between are summarised, so deep recursion does
+// not bury the error.
+const traceFrames = 8
+
+// ErrorCode identifies the kind of a StrataError, so editors and tests can
+// match on errors without parsing their messages.
+type ErrorCode string
+
+const (
+	ErrSyntax           ErrorCode = "E0001"
+	ErrUndefined        ErrorCode = "E0002"
+	ErrTypeMismatch     ErrorCode = "E0003"
+	ErrArity            ErrorCode = "E0004"
+	ErrImmutable        ErrorCode = "E0005"
+	ErrDuplicate        ErrorCode = "E0006"
+	ErrNotConstant      ErrorCode = "E0007"
+	ErrIndex            ErrorCode = "E0008"
+	ErrDivisionByZero   ErrorCode = "E0009"
+	ErrPattern          ErrorCode = "E0010"
+	ErrImport           ErrorCode = "E0011"
+	ErrInvalidOperation ErrorCode = "E0012"
+	ErrOverflow         ErrorCode = "E0013"
+	ErrPermission       ErrorCode = "E0014"
+	ErrAssertion        ErrorCode = "E0015"
+)
+
+// StrataError is an error raised by the parser, checker or interpreter. The
+// parser and checker pin it to the position it was found at and collect
+// them instead of stopping at the first; runtime errors are positioned by
+// the RuntimeError wrapping them.
+type StrataError struct {
+	Code     ErrorCode
+	Message  string
+	Hint     string
+	Location Location
+}
+
+func newError(code ErrorCode, format string, args ...interface{}) *StrataError {
+	return &StrataError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func (e *StrataError) Error() string {
+	if e.Location.Line == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%s at line %d, column %d", e.Message, e.Location.Line, e.Location.Column)
+}
+
+// at sets where the error was found.
+func (e *StrataError) at(loc Location) *StrataError {
+	e.Location = loc
+	return e
+}
+
+// withHint adds a suggestion for fixing the error.
+func (e *StrataError) withHint(hint string) *StrataError {
+	e.Hint = hint
+	return e
+}
+
+// Diagnostics is the error returned when parsing or checking finds problems:
+// all of them, in the order they were found.
+type Diagnostics []*StrataError
+
+func (d Diagnostics) Error() string {
+	messages := make([]string, len(d))
+	for idx, diag := range d {
+		messages[idx] = diag.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// diagnose returns err as a StrataError positioned at loc unless it already
+// has a position. Errors from outside the pipeline get code.
+func diagnose(err error, code ErrorCode, loc Location) *StrataError {
+	var diag *StrataError
+	if !errors.As(err, &diag) {
+		diag = &StrataError{Code: code, Message: err.Error()}
+	}
+	if diag.Location.Line == 0 {
+		diag.Location = loc
+	}
+	return diag
+}
+
+// errorList splits a Diagnostics error into its diagnostics.
+func errorList(err error) []error {
+	var diags Diagnostics
+	if !errors.As(err, &diags) {
+		return []error{err}
+	}
+	errs := make([]error, len(diags))
+	for idx, diag := range diags {
+		errs[idx] = diag
+	}
+	return errs
+}
+
+// hintLine renders the hint err carries, if any.
+func hintLine(err error) string {
+	var se *StrataError
+	if !errors.As(err, &se) || se.Hint == "" {
+		return ""
+	}
+	return "  = hint: " + se.Hint + "\n"
+}
+
+type RuntimeError struct {
+	Err       error
+	Location  Location
+	CallStack []StackFrame
+	// Module is the imported file the error occurred in, or nil for the
+	// entry file.
+	Module *UserModule
+	// File names the file the error occurred in, or is empty when the
+	// source did not come from a file.
+	File string
+}
+
+// Error reports the message, where it happened and the calls that led
+// there, as in "undefined variable: x at foo.str:12:5 in compute() called
+// from main".
+func (e *RuntimeError) Error() string {
+	msg := fmt.Sprintf("%v at line %d, column %d", e.Err, e.Location.Line, e.Location.Column)
+	if e.File != "" {
+		msg = fmt.Sprintf("%v at %s:%d:%d", e.Err, e.File, e.Location.Line, e.Location.Column)
+	}
+	if trace := e.Trace(); trace != "" {
+		msg += " " + trace
+	}
+	return msg
+}
+
+// Trace describes the call stack innermost first, or is empty for an error
+// at the top level.
+func (e *RuntimeError) Trace() string {
+	if len(e.CallStack) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "in %s()", e.CallStack[len(e.CallStack)-1].Function)
+	eachFrame(len(e.CallStack)-1, func(idx, omitted int) {
+		if omitted > 0 {
+			fmt.Fprintf(&b, " ... %d more calls ...", omitted)
+			return
+		}
+		fmt.Fprintf(&b, " called from %s()", e.CallStack[idx].Function)
+	})
+	b.WriteString(" called from main")
+	return b.String()
+}
+
+// eachFrame visits the frame indexes below n, innermost first, reporting a
+// run of frames left out of a long trace once with omitted set to its length.
+func eachFrame(n int, visit func(idx, omitted int)) {
+	for idx := n - 1; idx >= 0; idx-- {
+		if n > 2*traceFrames && idx == n-traceFrames-1 {
+			omitted := n - 2*traceFrames
+			visit(idx, omitted)
+			idx -= omitted - 1
+			continue
+		}
+		visit(idx, 0)
+	}
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+// locate attaches loc and the current call chain to err unless an inner
+// expression has already done so.
+func (i *Interpreter) locate(err error, loc Location) error {
+	if err == nil || loc.Line == 0 {
+		return err
+	}
+	var located *RuntimeError
+	if errors.As(err, &located) {
+		return err
+	}
+	located = &RuntimeError{Err: err, Location: loc, CallStack: append([]StackFrame(nil), i.CallStack...), Module: i.module}
+	if i.module != nil {
+		located.File = i.module.Name
+	} else if i.File != "" {
+		located.File = filepath.Base(i.File)
+	}
+	return located
+}
+
+// RenderError formats err for the terminal. Runtime errors and diagnostics
+// get the source lines around the failure with the failing expression
+// underlined, and runtime errors the call chain too; other errors are
+// printed as-is. Errors raised inside an imported module are shown against
+// that module's source.
+func RenderError(err error, fileName, source string) string {
+	var diags Diagnostics
+	if errors.As(err, &diags) {
+		var b strings.Builder
+		for _, diag := range diags {
+			b.WriteString(RenderError(diag, fileName, source))
+		}
+		return b.String()
+	}
+	var diag *StrataError
+	if errors.As(err, &diag) && diag.Location.Line > 0 {
+		return fmt.Sprintf("Error: %s\n  --> %s:%d:%d\n%s%s", diag.Message, fileName, diag.Location.Line, diag.Location.Column, renderExcerpt(source, diag.Location), hintLine(diag))
+	}
+	var rt *RuntimeError
+	if !errors.As(err, &rt) {
+		return fmt.Sprintf("Error: %v\n", err)
+	}
+	location := fileName
+	if rt.Module != nil {
+		location, source = rt.Module.Name, rt.Module.Source
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Error: %v\n", rt.Err)
+	fmt.Fprintf(&b, "  --> %s:%d:%d\n", location, rt.Location.Line, rt.Location.Column)
+	b.WriteString(renderExcerpt(source, rt.Location))
+	b.WriteString(hintLine(rt.Err))
+	if len(rt.CallStack) > 0 {
+		b.WriteString("call chain:\n")
+		eachFrame(len(rt.CallStack), func(idx, omitted int) {
+			if omitted > 0 {
+				fmt.Fprintf(&b, "  ... %d more calls ...\n", omitted)
+				return
+			}
+			frame := rt.CallStack[idx]
+			caller := fileName
+			if frame.Module != nil {
+				caller = frame.Module.Name
+			}
+			fmt.Fprintf(&b, "  in %s() called from %s:%d\n", frame.Function, caller, frame.CallSite.Line)
+		})
+	}
+	return b.String()
+}
+
+// jsonDiagnostic is the shape of one error under --json-diagnostics.
+type jsonDiagnostic struct {
+	Code      ErrorCode   `json:"code,omitempty"`
+	Message   string      `json:"message"`
+	Hint      string      `json:"hint,omitempty"`
+	File      string      `json:"file,omitempty"`
+	Line      int         `json:"line,omitempty"`
+	Column    int         `json:"column,omitempty"`
+	EndLine   int         `json:"endLine,omitempty"`
+	EndColumn int         `json:"endColumn,omitempty"`
+	Offset    int         `json:"offset,omitempty"`
+	EndOffset int         `json:"endOffset,omitempty"`
+	CallStack []jsonFrame `json:"callStack,omitempty"`
+}
+
+type jsonFrame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+func (d *jsonDiagnostic) describe(err error, loc Location) {
+	var diag *StrataError
+	if errors.As(err, &diag) {
+		d.Code, d.Message, d.Hint = diag.Code, diag.Message, diag.Hint
+	} else {
+		d.Message = err.Error()
+	}
+	d.Line, d.Column, d.EndLine, d.EndColumn = loc.Line, loc.Column, loc.EndLine, loc.EndColumn
+	d.Offset, d.EndOffset = loc.Offset, loc.EndOffset
+}
+
+// RenderErrorJSON formats err as RenderError does, but as one JSON object
+// per line for editors and CI tools.
+func RenderErrorJSON(err error, fileName, source string) string {
+	var diags Diagnostics
+	if errors.As(err, &diags) {
+		var b strings.Builder
+		for _, diag := range diags {
+			b.WriteString(RenderErrorJSON(diag, fileName, source))
+		}
+		return b.String()
+	}
+	d := jsonDiagnostic{File: fileName}
+	var rt *RuntimeError
+	if errors.As(err, &rt) {
+		d.describe(rt.Err, rt.Location)
+		if rt.Module != nil {
+			d.File = rt.Module.Name
+		}
+		for idx := len(rt.CallStack) - 1; idx >= 0; idx-- {
+			frame := jsonFrame{Function: rt.CallStack[idx].Function, File: fileName, Line: rt.CallStack[idx].CallSite.Line}
+			if rt.CallStack[idx].Module != nil {
+				frame.File = rt.CallStack[idx].Module.Name
+			}
+			d.CallStack = append(d.CallStack, frame)
+		}
+	} else {
+		var diag *StrataError
+		if errors.As(err, &diag) {
+			d.describe(diag, diag.Location)
+		} else {
+			d.describe(err, Location{})
+		}
+	}
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(d)
+	return b.String()
+}
+
+func renderExcerpt(source string, loc Location) string {
+	lines := strings.Split(source, "\n")
+	if loc.Line < 1 || loc.Line > len(lines) {
+		return ""
+	}
+	first := loc.Line - diagnosticContext
+	if first < 1 {
+		first = 1
+	}
+	last := loc.Line + diagnosticContext
+	if last > len(lines) {
+		last = len(lines)
+	}
+	width := len(fmt.Sprint(last))
+	gutter := strings.Repeat(" ", width)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s |\n", gutter)
+	for n := first; n <= last; n++ {
+		line := strings.TrimRight(lines[n-1], "\r")
+		fmt.Fprintf(&b, "%*d | %s\n", width, n, line)
+		if n == loc.Line {
+			fmt.Fprintf(&b, "%s | %s\n", gutter, underline(line, loc))
+		}
+	}
+	fmt.Fprintf(&b, "%s |\n", gutter)
+	return b.String()
+}
+
+// underline returns caret markers under the columns spanned by loc on its
+// first line, copying tabs from the source so the carets stay aligned.
+// Columns count runes, matching the lexer.
+func underline(line string, loc Location) string {
+	runes := []rune(line)
+	start := loc.Column - 1
+	if start < 0 {
+		start = 0
+	}
+	if start > len(runes) {
+		start = len(runes)
+	}
+	end := len(runes)
+	if loc.EndLine == loc.Line && loc.EndColumn-1 > start && loc.EndColumn-1 <= len(runes) {
+		end = loc.EndColumn - 1
+	}
+	width := end - start
+	if width < 1 {
+		width = 1
+	}
+	var pad strings.Builder
+	for _, c := range runes[:start] {
+		if c == '\t' {
+			pad.WriteByte('\t')
+		} else {
+			pad.WriteByte(' ')
+		}
+	}
+	return pad.String() + strings.Repeat("^", width)
+}
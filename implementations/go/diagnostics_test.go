@@ -0,0 +1,51 @@
+package strata
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRuntimeErrorsShowTheSourceAndCallChain(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	script := filepath.Join(t.TempDir(), "crash.str")
+	os.WriteFile(script, []byte(`import io from std::io
+func inner(n: int) => int {
+  let d: int = n - 1
+  return 10 / d
+}
+func outer(n: int) => int {
+  return inner(n) + 1
+}
+io.print(outer(1))
+`), 0644)
+	var errs strings.Builder
+	if code := RunProject(script, RunOptions{Stderr: &errs, Quiet: true}); code != 1 {
+		t.Fatalf("the run exited with %d", code)
+	}
+	want := `Error: division by zero
+  --> crash.str:4:10
+  |
+3 |   let d: int = n - 1
+4 |   return 10 / d
+  |          ^^^^^^
+5 | }
+  |
+call chain:
+  in inner() called from crash.str:7
+  in outer() called from crash.str:9
+`
+	if errs.String() != want {
+		t.Errorf("rendered\n%s\nwant\n%s", errs.String(), want)
+	}
+}
+
+func TestRenderErrorAlignsCaretsWithTheSource(t *testing.T) {
+	source := "let a: int = 1\n\tlet s: string = \"héllo\" + 1"
+	err := newError(ErrTypeMismatch, "type mismatch").at(Location{Line: 2, Column: 18, EndLine: 2, EndColumn: 25})
+	want := "Error: type mismatch\n  --> u.str:2:18\n  |\n1 | let a: int = 1\n2 | \tlet s: string = \"héllo\" + 1\n  | \t                ^^^^^^^\n  |\n"
+	if got := RenderError(err, "u.str", source); got != want {
+		t.Errorf("rendered\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,150 @@
+package strata
+
+// ============================================================================
+// STD::DICT - Keys, values, lookups and merges of map values
+// ============================================================================
+
+// Like std::list, every function returns a new value and leaves its argument
+// unchanged. Keys are listed in the order a for loop visits them.
+
+func dictModule(i *Interpreter) map[string]interface{} {
+	return map[string]interface{}{
+		"keys": NativeFunc(func(args []interface{}) (interface{}, error) {
+			m, err := dictArg("keys", args, 1)
+			if err != nil {
+				return nil, err
+			}
+			keys := []interface{}{}
+			for _, key := range i.iterationKeys(m) {
+				keys = append(keys, key)
+			}
+			return keys, nil
+		}),
+		"values": NativeFunc(func(args []interface{}) (interface{}, error) {
+			m, err := dictArg("values", args, 1)
+			if err != nil {
+				return nil, err
+			}
+			values := []interface{}{}
+			for _, key := range i.iterationKeys(m) {
+				values = append(values, m[key])
+			}
+			return values, nil
+		}),
+		"entries": NativeFunc(func(args []interface{}) (interface{}, error) {
+			m, err := dictArg("entries", args, 1)
+			if err != nil {
+				return nil, err
+			}
+			entries := []interface{}{}
+			for _, key := range i.iterationKeys(m) {
+				entries = append(entries, Tuple{key, m[key]})
+			}
+			return entries, nil
+		}),
+		"has": NativeFunc(func(args []interface{}) (interface{}, error) {
+			m, err := dictArg("has", args, 2)
+			if err != nil {
+				return nil, err
+			}
+			key, err := keyArg("has", args[1])
+			if err != nil {
+				return nil, err
+			}
+			_, present := m[key]
+			return present, nil
+		}),
+		"get": NativeFunc(func(args []interface{}) (interface{}, error) {
+			m, err := dictArg("get", args, 2)
+			if err != nil {
+				return nil, err
+			}
+			key, err := keyArg("get", args[1])
+			if err != nil {
+				return nil, err
+			}
+			if value, present := m[key]; present {
+				return value, nil
+			}
+			if len(args) > 2 {
+				return args[2], nil
+			}
+			return nil, nil
+		}),
+		"merge": NativeFunc(func(args []interface{}) (interface{}, error) {
+			merged := make(map[string]interface{})
+			for idx := range args {
+				m, ok := args[idx].(map[string]interface{})
+				if !ok {
+					return nil, newError(ErrTypeMismatch, "merge expects maps, got %s as argument %d", describeValue(args[idx]), idx+1)
+				}
+				for key, value := range m {
+					merged[key] = value
+				}
+			}
+			return merged, nil
+		}),
+		"delete": NativeFunc(func(args []interface{}) (interface{}, error) {
+			m, err := dictArg("delete", args, 2)
+			if err != nil {
+				return nil, err
+			}
+			key, err := keyArg("delete", args[1])
+			if err != nil {
+				return nil, err
+			}
+			rest := make(map[string]interface{}, len(m))
+			for k, value := range m {
+				if k != key {
+					rest[k] = value
+				}
+			}
+			return rest, nil
+		}),
+		"fromEntries": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("fromEntries", args, 1); err != nil {
+				return nil, err
+			}
+			entries, err := listArg("fromEntries", args[0])
+			if err != nil {
+				return nil, err
+			}
+			m := make(map[string]interface{}, len(entries))
+			for _, entry := range entries {
+				pair, ok := entry.(Tuple)
+				if !ok {
+					pair, ok = listItems(entry)
+				}
+				if !ok || len(pair) != 2 {
+					return nil, newError(ErrTypeMismatch, "fromEntries expects (key, value) pairs, got %s", formatValue(entry))
+				}
+				key, err := keyArg("fromEntries", pair[0])
+				if err != nil {
+					return nil, err
+				}
+				m[key] = pair[1]
+			}
+			return m, nil
+		}),
+	}
+}
+
+// dictArg checks that args has at least n values and that the first is a map.
+func dictArg(name string, args []interface{}, n int) (map[string]interface{}, error) {
+	if err := wantArgs(name, args, n); err != nil {
+		return nil, err
+	}
+	m, ok := args[0].(map[string]interface{})
+	if !ok {
+		return nil, newError(ErrTypeMismatch, "%s expects a map, got %s", name, describeValue(args[0]))
+	}
+	return m, nil
+}
+
+func keyArg(name string, v interface{}) (string, error) {
+	key, ok := v.(string)
+	if !ok {
+		return "", newError(ErrIndex, "%s: map key must be string, got %s", name, describeValue(v))
+	}
+	return key, nil
+}
@@ -0,0 +1,346 @@
+package strata
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ============================================================================
+// DUMPS - strata tokens and strata ast, for tooling and parser debugging
+// ============================================================================
+
+// astNode is the serializable form of a statement, an expression or a match
+// arm. Attrs hold its scalar properties and Children its sub-trees, in
+// source order.
+type astNode struct {
+	Kind     string
+	Location Location
+	Attrs    map[string]interface{}
+	Children []astChild
+}
+
+type astChild struct {
+	Label string
+	Nodes []*astNode
+	// List marks a field holding a list of nodes, even when it has just one.
+	List bool
+}
+
+func newASTNode(kind string, loc Location) *astNode {
+	return &astNode{Kind: kind, Location: loc, Attrs: make(map[string]interface{})}
+}
+
+// attr records a property unless it holds its zero value.
+func (n *astNode) attr(name string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return
+		}
+	case bool:
+		if !v {
+			return
+		}
+	case []string:
+		if len(v) == 0 {
+			return
+		}
+	case TypeDef:
+		if v.Kind == "" {
+			return
+		}
+		value = v.String()
+	}
+	n.Attrs[name] = value
+}
+
+func (n *astNode) child(label string, node *astNode) {
+	if node != nil {
+		n.Children = append(n.Children, astChild{Label: label, Nodes: []*astNode{node}})
+	}
+}
+
+func (n *astNode) block(label string, statements []*Stmt) {
+	if len(statements) == 0 {
+		return
+	}
+	nodes := make([]*astNode, len(statements))
+	for idx, stmt := range statements {
+		nodes[idx] = stmtNode(stmt)
+	}
+	n.Children = append(n.Children, astChild{Label: label, Nodes: nodes, List: true})
+}
+
+func stmtNode(stmt *Stmt) *astNode {
+	if stmt == nil {
+		return nil
+	}
+	n := newASTNode(string(stmt.Kind), stmt.Location)
+	n.attr("name", stmt.Name)
+	n.attr("names", stmt.Names)
+	n.attr("type", stmt.Type)
+	n.attr("mutable", stmt.Mutable)
+	n.attr("const", stmt.Const)
+	n.attr("target", stmt.Target)
+	n.attr("module", stmt.Module)
+	n.attr("catchName", stmt.CatchName)
+	if len(stmt.Params) > 0 {
+		params := make([]string, len(stmt.Params))
+		for idx, p := range stmt.Params {
+			params[idx] = p.Name + ": " + p.Type.String()
+			if p.Variadic {
+				params[idx] = "..." + params[idx]
+			}
+		}
+		n.attr("params", params)
+		n.attr("returnType", stmt.ReturnType)
+	}
+	if len(stmt.Variants) > 0 {
+		variants := make([]string, len(stmt.Variants))
+		for idx, v := range stmt.Variants {
+			fields := make([]string, len(v.Fields))
+			for f, t := range v.Fields {
+				fields[f] = t.String()
+			}
+			variants[idx] = v.Name
+			if len(fields) > 0 {
+				variants[idx] += "(" + strings.Join(fields, ", ") + ")"
+			}
+		}
+		n.attr("variants", variants)
+	}
+	n.child("targetExpr", exprNode(stmt.TargetExpr))
+	n.child("value", exprNode(stmt.Value))
+	n.child("expr", exprNode(stmt.Expr))
+	n.child("init", stmtNode(stmt.Init))
+	n.child("condition", exprNode(stmt.Condition))
+	n.child("update", stmtNode(stmt.Update))
+	n.block("then", stmt.Then)
+	n.block("body", stmt.Body)
+	n.block("else", stmt.Else)
+	n.block("catch", stmt.Catch)
+	n.block("finally", stmt.Finally)
+	if len(stmt.Cases) > 0 {
+		cases := make([]*astNode, len(stmt.Cases))
+		for idx, c := range stmt.Cases {
+			arm := newASTNode("case", Location{})
+			arm.attr("wildcard", c.Pattern.Wildcard)
+			arm.attr("enum", c.Pattern.Enum)
+			arm.attr("tag", c.Pattern.Tag)
+			arm.attr("bindings", c.Pattern.Bindings)
+			arm.child("value", exprNode(c.Pattern.Value))
+			arm.block("body", c.Body)
+			cases[idx] = arm
+		}
+		n.Children = append(n.Children, astChild{Label: "cases", Nodes: cases, List: true})
+	}
+	return n
+}
+
+func exprNode(expr *Expr) *astNode {
+	if expr == nil {
+		return nil
+	}
+	n := newASTNode(string(expr.Kind), expr.Location)
+	if expr.Kind == ExprLiteral {
+		n.Attrs["value"] = formatLiteral(expr.Value)
+	}
+	n.attr("name", expr.Name)
+	n.attr("op", expr.Op)
+	n.attr("property", expr.Property)
+	n.attr("keys", expr.Keys)
+	n.attr("optional", expr.Optional)
+	n.attr("interpolated", expr.Interpolated)
+	n.child("left", exprNode(expr.Left))
+	n.child("right", exprNode(expr.Right))
+	n.child("operand", exprNode(expr.Operand))
+	n.child("func", exprNode(expr.Func))
+	n.child("object", exprNode(expr.Object))
+	n.child("index", exprNode(expr.Index))
+	for _, list := range []struct {
+		label string
+		exprs []*Expr
+	}{{"args", expr.Args}, {"elements", expr.Elements}} {
+		if len(list.exprs) == 0 {
+			continue
+		}
+		nodes := make([]*astNode, len(list.exprs))
+		for idx, e := range list.exprs {
+			nodes[idx] = exprNode(e)
+		}
+		n.Children = append(n.Children, astChild{Label: list.label, Nodes: nodes, List: true})
+	}
+	return n
+}
+
+func locationJSON(loc Location) map[string]int {
+	return map[string]int{
+		"line": loc.Line, "column": loc.Column, "endLine": loc.EndLine, "endColumn": loc.EndColumn,
+		"offset": loc.Offset, "endOffset": loc.EndOffset,
+	}
+}
+
+func (n *astNode) MarshalJSON() ([]byte, error) {
+	out := map[string]interface{}{"kind": n.Kind}
+	if n.Location.Line > 0 {
+		out["loc"] = locationJSON(n.Location)
+	}
+	for name, value := range n.Attrs {
+		out[name] = value
+	}
+	for _, c := range n.Children {
+		if c.List {
+			out[c.Label] = c.Nodes
+		} else {
+			out[c.Label] = c.Nodes[0]
+		}
+	}
+	return json.Marshal(out)
+}
+
+// writeTree prints n as an indented outline, one node per line.
+func (n *astNode) writeTree(w io.Writer, indent, label string) {
+	line := indent + label + n.Kind
+	names := make([]string, 0, len(n.Attrs))
+	for name := range n.Attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := n.Attrs[name]
+		if list, ok := value.([]string); ok {
+			value = "[" + strings.Join(list, ", ") + "]"
+		}
+		line += fmt.Sprintf(" %s=%v", name, value)
+	}
+	if n.Location.Line > 0 {
+		line += fmt.Sprintf(" @%d:%d-%d:%d", n.Location.Line, n.Location.Column, n.Location.EndLine, n.Location.EndColumn)
+	}
+	fmt.Fprintln(w, line)
+	for _, c := range n.Children {
+		if !c.List {
+			c.Nodes[0].writeTree(w, indent+"  ", c.Label+": ")
+			continue
+		}
+		fmt.Fprintf(w, "%s  %s:\n", indent, c.Label)
+		for _, node := range c.Nodes {
+			node.writeTree(w, indent+"    ", "")
+		}
+	}
+}
+
+// DumpAST writes the parsed program as JSON or as a tree.
+func DumpAST(source, format string, w io.Writer) error {
+	statements, err := ParseSource(source)
+	if err != nil {
+		return err
+	}
+	nodes := make([]*astNode, len(statements))
+	for idx, stmt := range statements {
+		nodes[idx] = stmtNode(stmt)
+	}
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(nodes, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	case "tree":
+		for _, node := range nodes {
+			node.writeTree(w, "", "")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown format %q (use json or tree)", format)
+}
+
+var templatePartNames = map[TemplatePart]string{TemplateHead: "head", TemplateMiddle: "middle", TemplateTail: "tail"}
+
+// DumpTokens writes the token stream, one token per line or as JSON.
+func DumpTokens(source, format string, w io.Writer) (err error) {
+	defer recoverInternalError(&err)
+	lexer := NewLexer(source)
+	var tokens []map[string]interface{}
+	for token := lexer.NextToken(); token != nil; token = lexer.NextToken() {
+		entry := map[string]interface{}{"kind": string(token.Kind), "value": token.Value, "loc": locationJSON(token.Location)}
+		if part, ok := templatePartNames[token.Template]; ok {
+			entry["template"] = part
+		}
+		if token.Doc != "" {
+			entry["doc"] = token.Doc
+		}
+		tokens = append(tokens, entry)
+	}
+	if err := lexer.Err(); err != nil {
+		return err
+	}
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(tokens, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	case "text":
+		for _, token := range tokens {
+			loc := token["loc"].(map[string]int)
+			line := fmt.Sprintf("%d:%d-%d:%d\t%s\t%q", loc["line"], loc["column"], loc["endLine"], loc["endColumn"], token["kind"], token["value"])
+			if part, ok := token["template"]; ok {
+				line += "\ttemplate=" + part.(string)
+			}
+			if doc, ok := token["doc"]; ok {
+				line += fmt.Sprintf("\tdoc=%q", doc)
+			}
+			fmt.Fprintln(w, line)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown format %q (use text or json)", format)
+}
+
+// DumpCommand runs strata ast or strata tokens on the file in args.
+func DumpCommand(command string, args []string) int {
+	format, path := "tree", ""
+	if command == "tokens" {
+		format = "text"
+	}
+	for idx := 0; idx < len(args); idx++ {
+		switch arg := args[idx]; {
+		case strings.HasPrefix(arg, "--format="):
+			format = strings.TrimPrefix(arg, "--format=")
+		case arg == "--format" && idx+1 < len(args):
+			idx++
+			format = args[idx]
+		case path == "" && !strings.HasPrefix(arg, "--"):
+			path = arg
+		default:
+			fmt.Fprintf(os.Stderr, "Error: unexpected argument: %s\n", arg)
+			return 1
+		}
+	}
+	if path == "" {
+		fmt.Fprintf(os.Stderr, "Usage: strata %s <file.str> [--format=%s]\n", command, map[string]string{"ast": "json|tree", "tokens": "text|json"}[command])
+		return 1
+	}
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	dump := DumpAST
+	if command == "tokens" {
+		dump = DumpTokens
+	}
+	if err := dump(string(source), format, os.Stdout); err != nil {
+		fmt.Fprint(os.Stderr, RenderError(err, path, string(source)))
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,80 @@
+package strata
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDumpASTAsJSON(t *testing.T) {
+	var out strings.Builder
+	if err := DumpAST("let x: int = 1 + 2\nreturn x\n", "json", &out); err != nil {
+		t.Fatal(err)
+	}
+	var got interface{}
+	if err := json.Unmarshal([]byte(out.String()), &got); err != nil {
+		t.Fatalf("not JSON: %v\n%s", err, out.String())
+	}
+	var want interface{}
+	json.Unmarshal([]byte(`[
+		{"kind": "let", "name": "x", "type": "int",
+		 "loc": {"line": 1, "column": 1, "endLine": 1, "endColumn": 19, "offset": 0, "endOffset": 18},
+		 "value": {"kind": "binary", "op": "+",
+		   "loc": {"line": 1, "column": 14, "endLine": 1, "endColumn": 19, "offset": 13, "endOffset": 18},
+		   "left": {"kind": "literal", "value": "1",
+		     "loc": {"line": 1, "column": 14, "endLine": 1, "endColumn": 15, "offset": 13, "endOffset": 14}},
+		   "right": {"kind": "literal", "value": "2",
+		     "loc": {"line": 1, "column": 18, "endLine": 1, "endColumn": 19, "offset": 17, "endOffset": 18}}}},
+		{"kind": "return",
+		 "loc": {"line": 2, "column": 1, "endLine": 2, "endColumn": 9, "offset": 19, "endOffset": 27},
+		 "value": {"kind": "identifier", "name": "x",
+		   "loc": {"line": 2, "column": 8, "endLine": 2, "endColumn": 9, "offset": 26, "endOffset": 27}}}
+	]`), &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%s", out.String())
+	}
+}
+
+func TestDumpASTAsTree(t *testing.T) {
+	var out strings.Builder
+	source := "func f(a: int) => int {\n  return a\n}\n"
+	if err := DumpAST(source, "tree", &out); err != nil {
+		t.Fatal(err)
+	}
+	want := `function name=f params=[a: int] returnType=int @1:1-3:2
+  body:
+    return @2:3-2:11
+      value: identifier name=a @2:10-2:11
+`
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+	if err := DumpAST(source, "xml", &out); err == nil || !strings.Contains(err.Error(), `unknown format "xml"`) {
+		t.Errorf("an unknown format gave %v", err)
+	}
+	if err := DumpAST("let = 1\n", "json", &out); err == nil {
+		t.Error("a syntax error was dumped")
+	}
+}
+
+func TestDumpTokens(t *testing.T) {
+	var out strings.Builder
+	if err := DumpTokens("let x: int = 1\n", "text", &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "1:1-1:4\tkeyword\t\"let\"\n1:5-1:6\tident\t\"x\"\n1:6-1:7\tpunct\t\":\"\n") {
+		t.Errorf("got\n%s", out.String())
+	}
+	out.Reset()
+	if err := DumpTokens("x", "json", &out); err != nil {
+		t.Fatal(err)
+	}
+	var tokens []map[string]interface{}
+	if err := json.Unmarshal([]byte(out.String()), &tokens); err != nil || len(tokens) == 0 {
+		t.Fatalf("not a JSON list: %v\n%s", err, out.String())
+	}
+	if tokens[0]["kind"] != "ident" || tokens[0]["value"] != "x" || tokens[0]["loc"].(map[string]interface{})["endOffset"] != 1.0 {
+		t.Errorf("the first token is %v", tokens[0])
+	}
+}
@@ -0,0 +1,208 @@
+package strata
+
+import "strings"
+
+// ============================================================================
+// ENUMS - Enum declarations, payload variants and their type checking
+// ============================================================================
+
+// EnumType is the runtime value bound to an enum's name. Its members are
+// the unit variants and the constructors of payload variants.
+type EnumType struct {
+	Name     string
+	Variants []EnumVariant
+}
+
+func (e *EnumType) String() string {
+	return "<enum " + e.Name + ">"
+}
+
+func (e *EnumType) variant(name string) (EnumVariant, bool) {
+	return findVariant(e.Variants, name)
+}
+
+func findVariant(variants []EnumVariant, name string) (EnumVariant, bool) {
+	for _, v := range variants {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return EnumVariant{}, false
+}
+
+// EnumValue is one variant of an enum together with its payload.
+type EnumValue struct {
+	Enum   string
+	Tag    string
+	Values []interface{}
+}
+
+func (v EnumValue) String() string {
+	name := v.Enum + "." + v.Tag
+	if len(v.Values) == 0 {
+		return name
+	}
+	parts := make([]string, len(v.Values))
+	for idx, value := range v.Values {
+		parts[idx] = formatElement(value)
+	}
+	return name + "(" + strings.Join(parts, ", ") + ")"
+}
+
+// member returns a unit variant's value or a payload variant's constructor.
+func (e *EnumType) member(name string) (interface{}, error) {
+	variant, ok := e.variant(name)
+	if !ok {
+		return nil, newError(ErrUndefined, "enum %s has no variant %s", e.Name, name)
+	}
+	if len(variant.Fields) == 0 {
+		return EnumValue{Enum: e.Name, Tag: name}, nil
+	}
+	return NativeFunc(func(args []interface{}) (interface{}, error) {
+		if len(args) != len(variant.Fields) {
+			return nil, newError(ErrArity, "%s.%s expects %d value(s), got %d", e.Name, name, len(variant.Fields), len(args))
+		}
+		return EnumValue{Enum: e.Name, Tag: name, Values: append([]interface{}(nil), args...)}, nil
+	}), nil
+}
+
+// matchEnum destructures value against an enum pattern such as
+// `Shape.Rect(w, h)`, binding the payload in the current scope.
+func (i *Interpreter) matchEnum(pattern MatchPattern, value interface{}) (bool, error) {
+	v, ok := value.(EnumValue)
+	if !ok || v.Enum != pattern.Enum || v.Tag != pattern.Tag {
+		return false, nil
+	}
+	if len(pattern.Bindings) != len(v.Values) {
+		return false, newError(ErrPattern, "pattern %s.%s binds %d value(s), but the variant has %d", pattern.Enum, pattern.Tag, len(pattern.Bindings), len(v.Values))
+	}
+	for idx, name := range pattern.Bindings {
+		if name != "_" {
+			i.Env.Set(name, v.Values[idx], false)
+		}
+	}
+	return true, nil
+}
+
+func (tc *TypeChecker) checkEnum(stmt *Stmt) error {
+	if _, exists := tc.Enums[stmt.Name]; exists {
+		return newError(ErrDuplicate, "enum %s is already declared", stmt.Name)
+	}
+	seen := make(map[string]bool)
+	for _, v := range stmt.Variants {
+		if seen[v.Name] {
+			return newError(ErrDuplicate, "duplicate variant %s in enum %s", v.Name, stmt.Name)
+		}
+		seen[v.Name] = true
+	}
+	tc.Enums[stmt.Name] = stmt.Variants
+	return nil
+}
+
+// resolveType turns an annotation naming a declared enum, class or interface
+// into its type.
+func (tc *TypeChecker) resolveType(t TypeDef) TypeDef {
+	if t.Kind == KindPrimitive && t.Primitive == TypeAny && t.Name != "" {
+		if _, ok := tc.Enums[t.Name]; ok {
+			return TypeDef{Kind: KindEnum, Name: t.Name}
+		}
+		if _, ok := tc.Classes[t.Name]; ok {
+			return TypeDef{Kind: KindClass, Name: t.Name}
+		}
+		if _, ok := tc.Interfaces[t.Name]; ok {
+			return TypeDef{Kind: KindInterface, Name: t.Name}
+		}
+	}
+	return t
+}
+
+// enumVariant reports the enum variant expr refers to, as in `Color.Red`.
+// The enum name is empty when expr is not an enum member.
+func (tc *TypeChecker) enumVariant(expr *Expr) (string, EnumVariant, error) {
+	if expr == nil || expr.Kind != ExprMember || expr.Object == nil || expr.Object.Kind != ExprIdentifier {
+		return "", EnumVariant{}, nil
+	}
+	variants, ok := tc.Enums[expr.Object.Name]
+	if !ok {
+		return "", EnumVariant{}, nil
+	}
+	variant, ok := findVariant(variants, expr.Property)
+	if !ok {
+		return "", EnumVariant{}, newError(ErrUndefined, "enum %s has no variant %s", expr.Object.Name, expr.Property).at(expr.Location)
+	}
+	return expr.Object.Name, variant, nil
+}
+
+// enumType infers the type of a unit variant or a payload constructor call.
+func (tc *TypeChecker) enumType(expr *Expr) (TypeDef, bool) {
+	target, call := expr, false
+	if expr.Kind == ExprCall {
+		target, call = expr.Func, true
+	}
+	enum, variant, err := tc.enumVariant(target)
+	if err != nil || enum == "" || call != (len(variant.Fields) > 0) {
+		return TypeDef{}, false
+	}
+	return TypeDef{Kind: KindEnum, Name: enum}, true
+}
+
+// checkEnumUses verifies every variant referenced in expr exists and that
+// payload constructors receive values of the declared types.
+func (tc *TypeChecker) checkEnumUses(expr *Expr) error {
+	if expr == nil {
+		return nil
+	}
+	switch expr.Kind {
+	case ExprMember:
+		if _, _, err := tc.enumVariant(expr); err != nil {
+			return err
+		}
+	case ExprCall:
+		enum, variant, err := tc.enumVariant(expr.Func)
+		if err != nil {
+			return err
+		}
+		if enum != "" {
+			if len(expr.Args) != len(variant.Fields) {
+				return newError(ErrArity, "%s.%s expects %d value(s), got %d", enum, variant.Name, len(variant.Fields), len(expr.Args)).at(expr.Location)
+			}
+			for idx, arg := range expr.Args {
+				if err := tc.checkExpression(arg, tc.resolveType(variant.Fields[idx])); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	for _, child := range exprChildren(expr) {
+		if err := tc.checkEnumUses(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bindPattern declares the variables a match arm binds.
+func (tc *TypeChecker) bindPattern(pattern MatchPattern) error {
+	if pattern.Enum == "" {
+		for _, name := range pattern.Bindings {
+			tc.Env.Vars[name] = TypeEnvEntry{Type: TypeDef{Kind: KindPrimitive, Primitive: TypeAny}}
+		}
+		return nil
+	}
+	variants, ok := tc.Enums[pattern.Enum]
+	if !ok {
+		return newError(ErrUndefined, "undefined enum: %s", pattern.Enum)
+	}
+	variant, ok := findVariant(variants, pattern.Tag)
+	if !ok {
+		return newError(ErrPattern, "enum %s has no variant %s", pattern.Enum, pattern.Tag)
+	}
+	if len(pattern.Bindings) != len(variant.Fields) {
+		return newError(ErrPattern, "pattern %s.%s binds %d value(s), but the variant has %d", pattern.Enum, pattern.Tag, len(pattern.Bindings), len(variant.Fields))
+	}
+	for idx, name := range pattern.Bindings {
+		tc.Env.Vars[name] = TypeEnvEntry{Type: tc.resolveType(variant.Fields[idx])}
+	}
+	return nil
+}
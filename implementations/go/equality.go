@@ -0,0 +1,103 @@
+package strata
+
+import "bytes"
+
+// ============================================================================
+// EQUALITY - Type-aware comparison for == and !=
+// ============================================================================
+
+// valuesEqual reports whether two runtime values are equal. Numbers compare
+// by value whatever their representation, collections compare element by
+// element, and values of different kinds, such as 1 and "1", are never
+// equal. Functions, classes and instances are equal only to themselves.
+func valuesEqual(left, right interface{}) bool {
+	if left == nil || right == nil {
+		return left == nil && right == nil
+	}
+	if isNumber(left) || isInteger(left) {
+		switch {
+		case isInteger(left) && isInteger(right):
+			return toInt(left) == toInt(right)
+		case isNumber(right) || isInteger(right):
+			return toFloat(left) == toFloat(right)
+		}
+		return false
+	}
+	switch l := left.(type) {
+	case string:
+		r, ok := right.(string)
+		return ok && l == r
+	case bool:
+		r, ok := right.(bool)
+		return ok && l == r
+	case []interface{}, []string:
+		items, _ := listItems(left)
+		r, ok := listItems(right)
+		return ok && itemsEqual(items, r)
+	case Tuple:
+		r, ok := right.(Tuple)
+		return ok && itemsEqual(l, r)
+	case map[string]interface{}:
+		r, ok := right.(map[string]interface{})
+		if !ok || len(l) != len(r) {
+			return false
+		}
+		for key, value := range l {
+			other, present := r[key]
+			if !present || !valuesEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	case *Matrix:
+		r, ok := right.(*Matrix)
+		if !ok || l.Rows != r.Rows || l.Cols != r.Cols {
+			return false
+		}
+		for idx := range l.Data {
+			if l.Data[idx] != r.Data[idx] {
+				return false
+			}
+		}
+		return true
+	case Bytes:
+		r, ok := right.(Bytes)
+		return ok && bytes.Equal(l, r)
+	case Variant:
+		r, ok := right.(Variant)
+		return ok && l.Tag == r.Tag && valuesEqual(l.Value, r.Value)
+	case EnumValue:
+		r, ok := right.(EnumValue)
+		return ok && l.Enum == r.Enum && l.Tag == r.Tag && itemsEqual(l.Values, r.Values)
+	case *FuncDef, *ClassType, *Instance, *InterfaceType, *EnumType, *DataFrame, *Socket, *Listener, *Pattern, *FileHandle:
+		return left == right
+	}
+	return false
+}
+
+// listItems returns the elements of a list value as []interface{}.
+func listItems(v interface{}) ([]interface{}, bool) {
+	switch list := v.(type) {
+	case []interface{}:
+		return list, true
+	case []string:
+		items := make([]interface{}, len(list))
+		for idx, s := range list {
+			items[idx] = s
+		}
+		return items, true
+	}
+	return nil, false
+}
+
+func itemsEqual(left, right []interface{}) bool {
+	if len(left) != len(right) {
+		return false
+	}
+	for idx := range left {
+		if !valuesEqual(left[idx], right[idx]) {
+			return false
+		}
+	}
+	return true
+}
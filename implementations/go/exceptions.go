@@ -0,0 +1,148 @@
+package strata
+
+import (
+	"errors"
+)
+
+// ============================================================================
+// EXCEPTIONS - throw, try/catch/finally and catchable runtime errors
+// ============================================================================
+
+// ThrownError carries a value raised by a `throw` statement while it unwinds
+// through expression evaluation and function calls.
+type ThrownError struct {
+	Value interface{}
+}
+
+func (e *ThrownError) Error() string {
+	return "uncaught exception: " + displayValue(e.Value)
+}
+
+// LimitError reports that a resource limit was exceeded. It cannot be caught
+// by Strata code.
+type LimitError struct {
+	Message string
+}
+
+func (e *LimitError) Error() string {
+	return e.Message
+}
+
+// pendingThrow converts an exception raised at statement level into an error
+// and clears it from the control flow.
+func (i *Interpreter) pendingThrow() error {
+	if i.ControlFlow.Type != CFThrow {
+		return nil
+	}
+	err, _ := i.ControlFlow.Value.(error)
+	i.ControlFlow = ControlFlow{Type: CFNone}
+	return err
+}
+
+// isFatal reports whether err aborts the script without running catch or
+// finally blocks: internal errors, exceeded limits and quotas, and os.exit.
+func isFatal(err error) bool {
+	var internal *InternalError
+	var limit *LimitError
+	var quota *QuotaError
+	var exit *ExitError
+	return errors.As(err, &internal) || errors.As(err, &limit) || errors.As(err, &quota) || errors.As(err, &exit)
+}
+
+// caughtValue returns the value a catch clause binds for err, and false when
+// err must not be caught: fatal errors, and ? propagation returning from the
+// enclosing function.
+func caughtValue(err error) (interface{}, bool) {
+	if isFatal(err) {
+		return nil, false
+	}
+	if _, ok := propagatedValue(err); ok {
+		return nil, false
+	}
+	var thrown *ThrownError
+	if errors.As(err, &thrown) {
+		return thrown.Value, true
+	}
+	var located *RuntimeError
+	if errors.As(err, &located) {
+		return located.Err.Error(), true
+	}
+	return err.Error(), true
+}
+
+// runLoopBody runs one iteration of a loop body. It reports whether the loop
+// must stop: on break, which it consumes, or on a pending return or throw.
+func (i *Interpreter) runLoopBody(body []*Stmt) (bool, error) {
+	for _, stmt := range body {
+		if err := i.interpretStatement(stmt); err != nil {
+			return true, err
+		}
+		switch i.ControlFlow.Type {
+		case CFBreak:
+			i.ControlFlow.Type = CFNone
+			return true, nil
+		case CFContinue:
+			i.ControlFlow.Type = CFNone
+			return false, nil
+		case CFReturn, CFThrow:
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (i *Interpreter) runBlock(statements []*Stmt) error {
+	for _, stmt := range statements {
+		if err := i.interpretStatement(stmt); err != nil {
+			return err
+		}
+		if i.ControlFlow.Type != CFNone {
+			return nil
+		}
+	}
+	return nil
+}
+
+// interpretTry runs a try statement. Errors and throws from the body are
+// handed to the catch block; the finally block always runs, and a return,
+// break or throw inside it replaces whatever was pending.
+func (i *Interpreter) interpretTry(stmt *Stmt) error {
+	depth := len(i.CallStack)
+	env := i.Env
+
+	err := i.runBlock(stmt.Body)
+	if err == nil {
+		err = i.pendingThrow()
+	}
+	if err != nil && stmt.Catch != nil {
+		if value, ok := caughtValue(err); ok {
+			i.CallStack = i.CallStack[:depth]
+			i.Env = newScope(env, nil)
+			if stmt.CatchName != "" {
+				i.Env.Set(stmt.CatchName, value, false)
+			}
+			err = i.runBlock(stmt.Catch)
+			if err == nil {
+				err = i.pendingThrow()
+			}
+			i.Env = env
+		}
+	}
+
+	if stmt.Finally == nil {
+		return err
+	}
+	if isFatal(err) {
+		return err
+	}
+	pending := i.ControlFlow
+	i.ControlFlow = ControlFlow{Type: CFNone}
+	if finallyErr := i.runBlock(stmt.Finally); finallyErr != nil {
+		return finallyErr
+	}
+	if i.ControlFlow.Type != CFNone {
+		return nil
+	}
+	i.ControlFlow = pending
+	return err
+}
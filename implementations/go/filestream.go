@@ -0,0 +1,230 @@
+package strata
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// ============================================================================
+// STD::FILE - Streaming file handles
+// ============================================================================
+
+// FileHandle is an open file returned by file.open or file.lines. Its
+// methods are readLine, readChunk, write, seek and close; reads go through a
+// buffer, which is discarded whenever the position moves.
+type FileHandle struct {
+	file   *os.File
+	reader *bufio.Reader
+	closed bool
+	// closeAtEOF is set for handles made by lines, which close themselves
+	// once the last line has been read and then keep reading null.
+	closeAtEOF bool
+	// usage is the quota writes count against.
+	usage *usage
+}
+
+func (h *FileHandle) String() string {
+	return "<file " + h.file.Name() + ">"
+}
+
+// fileModes maps the modes open accepts to os.OpenFile flags.
+var fileModes = map[string]int{
+	"r":  os.O_RDONLY,
+	"r+": os.O_RDWR,
+	"w":  os.O_WRONLY | os.O_CREATE | os.O_TRUNC,
+	"w+": os.O_RDWR | os.O_CREATE | os.O_TRUNC,
+	"a":  os.O_WRONLY | os.O_CREATE | os.O_APPEND,
+	"a+": os.O_RDWR | os.O_CREATE | os.O_APPEND,
+}
+
+// openFile opens path in mode, returning nil if the file cannot be opened.
+func openFile(path, mode string) (*FileHandle, error) {
+	flags, ok := fileModes[mode]
+	if !ok {
+		return nil, newError(ErrInvalidOperation, "open: unknown mode %q", mode).withHint("use r, r+, w, w+, a or a+")
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, nil
+	}
+	return &FileHandle{file: f, reader: bufio.NewReader(f)}, nil
+}
+
+// rewind moves the file position back over input the buffer has read ahead
+// but nobody has consumed, so writes and seeks start where reading stopped.
+func (h *FileHandle) rewind() error {
+	if buffered := h.reader.Buffered(); buffered > 0 {
+		if _, err := h.file.Seek(int64(-buffered), io.SeekCurrent); err != nil {
+			return err
+		}
+	}
+	h.reader.Reset(h.file)
+	return nil
+}
+
+func (h *FileHandle) close() error {
+	if h.closed {
+		return nil
+	}
+	h.closed = true
+	return h.file.Close()
+}
+
+// member returns one of the handle's methods.
+func (h *FileHandle) member(name string) (interface{}, error) {
+	method, ok := map[string]func(args []interface{}) (interface{}, error){
+		"readLine":  h.readLine,
+		"readChunk": h.readChunk,
+		"write":     h.write,
+		"seek":      h.seek,
+		"close": func(args []interface{}) (interface{}, error) {
+			if err := h.close(); err != nil {
+				return nil, fileError("close", err)
+			}
+			return nil, nil
+		},
+	}[name]
+	if !ok {
+		return nil, newError(ErrUndefined, "file has no member %s", name)
+	}
+	return NativeFunc(func(args []interface{}) (interface{}, error) {
+		if h.closed && h.closeAtEOF && strings.HasPrefix(name, "read") {
+			return nil, nil
+		}
+		if h.closed && name != "close" {
+			return nil, newError(ErrInvalidOperation, "%s: file is closed", name)
+		}
+		return method(args)
+	}), nil
+}
+
+// readLine returns the next line without its line ending, or null at the
+// end of the file.
+func (h *FileHandle) readLine(args []interface{}) (interface{}, error) {
+	line, err := h.reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, fileError("readLine", err)
+	}
+	if err == io.EOF && line == "" {
+		if h.closeAtEOF {
+			h.close()
+		}
+		return nil, nil
+	}
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), nil
+}
+
+// readChunk returns up to size bytes, or null at the end of the file.
+func (h *FileHandle) readChunk(args []interface{}) (interface{}, error) {
+	if err := wantArgs("readChunk", args, 1); err != nil {
+		return nil, err
+	}
+	size, ok := args[0].(int64)
+	if !ok || size <= 0 {
+		return nil, newError(ErrInvalidOperation, "readChunk: size must be a positive int, got %s", formatValue(args[0]))
+	}
+	if err := h.usage.reserve(size); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	n, err := io.ReadFull(h.reader, buf)
+	if n == 0 && err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, fileError("readChunk", err)
+	}
+	return string(buf[:n]), nil
+}
+
+// write writes a string and returns the number of bytes written.
+func (h *FileHandle) write(args []interface{}) (interface{}, error) {
+	if err := wantArgs("write", args, 1); err != nil {
+		return nil, err
+	}
+	if err := h.rewind(); err != nil {
+		return nil, fileError("write", err)
+	}
+	content := toString(args[0])
+	if err := h.usage.write(int64(len(content))); err != nil {
+		return nil, err
+	}
+	n, err := h.file.WriteString(content)
+	if err != nil {
+		return nil, fileError("write", err)
+	}
+	return int64(n), nil
+}
+
+// seek moves to offset bytes from the start, or from "current" or "end"
+// when a second argument names them, and returns the new position.
+func (h *FileHandle) seek(args []interface{}) (interface{}, error) {
+	if err := wantArgs("seek", args, 1); err != nil {
+		return nil, err
+	}
+	offset, ok := args[0].(int64)
+	if !ok {
+		return nil, newError(ErrTypeMismatch, "seek expects an int offset, got %s", describeValue(args[0]))
+	}
+	whence := io.SeekStart
+	if len(args) > 1 {
+		switch toString(args[1]) {
+		case "start":
+		case "current":
+			whence = io.SeekCurrent
+		case "end":
+			whence = io.SeekEnd
+		default:
+			return nil, newError(ErrInvalidOperation, "seek: unknown origin %q", toString(args[1])).withHint(`use "start", "current" or "end"`)
+		}
+	}
+	if err := h.rewind(); err != nil {
+		return nil, fileError("seek", err)
+	}
+	pos, err := h.file.Seek(offset, whence)
+	if err != nil {
+		return nil, fileError("seek", err)
+	}
+	return pos, nil
+}
+
+func fileError(name string, err error) error {
+	if pathErr, ok := err.(*os.PathError); ok {
+		err = pathErr.Err
+	}
+	return newError(ErrInvalidOperation, "%s failed: %v", name, err)
+}
+
+func fileStreamFunctions(i *Interpreter) map[string]interface{} {
+	return map[string]interface{}{
+		"open": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("open", args, 1); err != nil {
+				return nil, err
+			}
+			mode := "r"
+			if len(args) > 1 {
+				mode = toString(args[1])
+			}
+			handle, err := openFile(toString(args[0]), mode)
+			if handle == nil {
+				return nil, err
+			}
+			handle.usage = i.usage
+			return handle, nil
+		}),
+		"lines": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("lines", args, 1); err != nil {
+				return nil, err
+			}
+			handle, _ := openFile(toString(args[0]), "r")
+			if handle == nil {
+				return nil, nil
+			}
+			handle.closeAtEOF = true
+			return handle, nil
+		}),
+	}
+}
@@ -0,0 +1,236 @@
+package strata
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ============================================================================
+// STD::FILE - Directory listing, globbing, walking, copying and metadata
+// ============================================================================
+
+// Like the rest of std::file, these functions report failure through their
+// result (null or false) rather than by raising, except walk, which passes on
+// any error raised by its callback, and copy, which stops the run when it
+// exceeds the output quota. Paths in results use forward slashes.
+
+// globFiles returns the paths matching pattern in sorted order. Segments are
+// matched as by filepath.Match, and a segment of ** matches any number of
+// directories, including none.
+func globFiles(pattern string) ([]string, error) {
+	pattern = filepath.ToSlash(pattern)
+	segments := strings.Split(pattern, "/")
+	// The static prefix holds no wildcards, so only it needs to be walked.
+	static := 0
+	for static < len(segments)-1 && !strings.ContainsAny(segments[static], "*?[") {
+		static++
+	}
+	base := strings.Join(segments[:static], "/")
+	if base == "" && static > 0 {
+		base = "/"
+	}
+	root := base
+	if root == "" {
+		root = "."
+	}
+	rest := segments[static:]
+	for _, segment := range rest {
+		if _, err := path.Match(segment, ""); err != nil {
+			return nil, newError(ErrInvalidOperation, "glob: invalid pattern %q", pattern)
+		}
+	}
+	matches := []string{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root {
+				return err
+			}
+			return nil
+		}
+		rel, _ := filepath.Rel(root, p)
+		if rel == "." {
+			return nil
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if globMatch(rest, parts) {
+			matches = append(matches, path.Join(base, filepath.ToSlash(rel)))
+		}
+		if d.IsDir() && !globPrefix(rest, parts) {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// globMatch reports whether the path segments parts match the pattern
+// segments exactly.
+func globMatch(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+	if pattern[0] == "**" {
+		for skip := 0; skip <= len(parts); skip++ {
+			if globMatch(pattern[1:], parts[skip:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], parts[0])
+	return ok && globMatch(pattern[1:], parts[1:])
+}
+
+// globPrefix reports whether some path below the directory parts could still
+// match the pattern, so the walk knows whether to descend into it.
+func globPrefix(pattern, parts []string) bool {
+	if len(parts) == 0 {
+		return len(pattern) > 0
+	}
+	if len(pattern) == 0 {
+		return false
+	}
+	if pattern[0] == "**" {
+		return true
+	}
+	ok, _ := path.Match(pattern[0], parts[0])
+	return ok && globPrefix(pattern[1:], parts[1:])
+}
+
+// copyPath copies the file or directory tree at src to dst, counting the
+// bytes copied against u's output quota.
+func copyPath(src, dst string, u *usage) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return copyFile(src, dst, info.Mode().Perm(), u)
+	}
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, p)
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return copyFile(p, target, info.Mode().Perm(), u)
+	})
+}
+
+func copyFile(src, dst string, perm os.FileMode, u *usage) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(quotaWriter{u, out}, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func fileSystemFunctions(i *Interpreter) map[string]interface{} {
+	return map[string]interface{}{
+		"list": func(dir string) interface{} {
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				return nil
+			}
+			names := make([]interface{}, len(entries))
+			for idx, entry := range entries {
+				names[idx] = entry.Name()
+			}
+			return names
+		},
+		"glob": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("glob", args, 1); err != nil {
+				return nil, err
+			}
+			matches, err := globFiles(toString(args[0]))
+			if err != nil {
+				if _, ok := err.(*StrataError); ok {
+					return nil, err
+				}
+				return nil, nil
+			}
+			paths := make([]interface{}, len(matches))
+			for idx, match := range matches {
+				paths[idx] = match
+			}
+			return paths, nil
+		}),
+		"walk": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("walk", args, 2); err != nil {
+				return nil, err
+			}
+			root := toString(args[0])
+			if info, err := os.Stat(root); err != nil || !info.IsDir() {
+				return false, nil
+			}
+			var paths []string
+			filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+				if err == nil && p != root {
+					paths = append(paths, filepath.ToSlash(p))
+				}
+				return nil
+			})
+			for _, p := range paths {
+				if _, err := i.callValue("walk", args[1], []interface{}{p}); err != nil {
+					return nil, err
+				}
+			}
+			return true, nil
+		}),
+		"copy": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("copy", args, 2); err != nil {
+				return nil, err
+			}
+			err := copyPath(toString(args[0]), toString(args[1]), i.usage)
+			if quota := i.usage.failed(); quota != nil {
+				return nil, quota
+			}
+			return err == nil, nil
+		}),
+		"move": func(src, dst string) bool {
+			return os.Rename(src, dst) == nil
+		},
+		"size": func(path string) interface{} {
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil
+			}
+			return info.Size()
+		},
+		"modTime": func(path string) interface{} {
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil
+			}
+			return info.ModTime().UnixMilli()
+		},
+	}
+}
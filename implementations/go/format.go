@@ -0,0 +1,172 @@
+package strata
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ============================================================================
+// FORMATTING - printf-style format() and padding helpers for std::text
+// ============================================================================
+
+// formatString implements format(template, args...). A directive is
+// %[flags][width][.precision]verb with the flags -, +, 0, space and #, and
+// the verbs:
+//
+//	%s  the value as io.print shows it    %v  the value as a literal
+//	%d  an int                            %x %X %o %b  an int in base 16, 8, 2
+//	%f  a fixed-point number              %e %g  an exponent or compact number
+//	%%  a literal percent sign
+//
+// Widths and precisions are checked against u's memory quota before fmt
+// pads to them.
+func formatString(template string, args []interface{}, u *usage) (string, error) {
+	var out strings.Builder
+	next := 0
+	for pos := 0; pos < len(template); pos++ {
+		c := template[pos]
+		if c != '%' {
+			out.WriteByte(c)
+			continue
+		}
+		end := pos + 1
+		for end < len(template) && strings.IndexByte("-+0 #.0123456789", template[end]) >= 0 {
+			end++
+		}
+		if end == len(template) {
+			return "", newError(ErrInvalidOperation, "format: unterminated directive %q", template[pos:])
+		}
+		spec, verb := template[pos:end], template[end]
+		pos = end
+		if verb == '%' {
+			out.WriteByte('%')
+			continue
+		}
+		if next >= len(args) {
+			return "", newError(ErrArity, "format: missing argument for %s%c", spec, verb)
+		}
+		arg, err := formatArg(verb, args[next])
+		if err != nil {
+			return "", err
+		}
+		next++
+		if err := u.reserve(int64(out.Len()) + directiveWidth(spec)); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&out, spec+string(verb), arg)
+	}
+	if next < len(args) {
+		return "", newError(ErrArity, "format: %d argument(s) given but the template uses %d", len(args), next)
+	}
+	return out.String(), nil
+}
+
+// directiveWidth is the sum of the width and precision in spec, the most a
+// directive pads its argument by.
+func directiveWidth(spec string) int64 {
+	var total, n int64
+	for idx := 0; idx <= len(spec); idx++ {
+		if idx < len(spec) && spec[idx] >= '0' && spec[idx] <= '9' && n < 1<<32 {
+			n = n*10 + int64(spec[idx]-'0')
+			continue
+		}
+		total += n
+		n = 0
+	}
+	return total
+}
+
+// formatArg converts value to the Go value fmt expects for verb.
+func formatArg(verb byte, value interface{}) (interface{}, error) {
+	switch verb {
+	case 's':
+		return displayValue(value), nil
+	case 'v':
+		return formatElement(value), nil
+	case 'd', 'x', 'X', 'o', 'b':
+		if !isInteger(value) {
+			return nil, newError(ErrTypeMismatch, "format: %%%c expects an int, got %s", verb, describeValue(value))
+		}
+		return toInt(value), nil
+	case 'f', 'F', 'e', 'E', 'g', 'G':
+		if !isNumber(value) && !isInteger(value) {
+			return nil, newError(ErrTypeMismatch, "format: %%%c expects a number, got %s", verb, describeValue(value))
+		}
+		return toFloat(value), nil
+	}
+	return nil, newError(ErrInvalidOperation, "format: unknown verb %%%c", verb).withHint("use %s, %v, %d, %x, %o, %b, %f, %e or %g")
+}
+
+// padString pads s with repetitions of pad to width runes, at the start or
+// the end. Strings already that wide are returned unchanged, and padding
+// that would not fit in u's memory quota is an error.
+func padString(s string, width int64, pad string, atStart bool, u *usage) (string, error) {
+	missing := width - int64(utf8.RuneCountInString(s))
+	if missing <= 0 || pad == "" {
+		return s, nil
+	}
+	if err := u.reserve(int64(len(s)) + missing); err != nil {
+		return "", err
+	}
+	reps := missing/int64(utf8.RuneCountInString(pad)) + 1
+	padding := []rune(strings.Repeat(pad, int(reps)))[:missing]
+	if atStart {
+		return string(padding) + s, nil
+	}
+	return s + string(padding), nil
+}
+
+func textFormatFunctions(i *Interpreter) map[string]interface{} {
+	pad := func(name string, atStart bool) NativeFunc {
+		return func(args []interface{}) (interface{}, error) {
+			if err := wantArgs(name, args, 2); err != nil {
+				return nil, err
+			}
+			width, ok := args[1].(int64)
+			if !ok {
+				return nil, newError(ErrTypeMismatch, "%s expects an int width, got %s", name, describeValue(args[1]))
+			}
+			fill := " "
+			if len(args) > 2 {
+				fill = toString(args[2])
+			}
+			return padString(toString(args[0]), width, fill, atStart, i.usage)
+		}
+	}
+	return map[string]interface{}{
+		"format": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("format", args, 1); err != nil {
+				return nil, err
+			}
+			return formatString(toString(args[0]), args[1:], i.usage)
+		}),
+		"padStart": pad("padStart", true),
+		"padEnd":   pad("padEnd", false),
+		"reverse": func(s string) string {
+			runes := []rune(s)
+			for l, r := 0, len(runes)-1; l < r; l, r = l+1, r-1 {
+				runes[l], runes[r] = runes[r], runes[l]
+			}
+			return string(runes)
+		},
+		"chars": func(s string) interface{} {
+			chars := []interface{}{}
+			for _, r := range s {
+				chars = append(chars, string(r))
+			}
+			return chars
+		},
+		"codePointAt": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("codePointAt", args, 2); err != nil {
+				return nil, err
+			}
+			runes := []rune(toString(args[0]))
+			pos, err := stringPosition(args[1], len(runes))
+			if err != nil {
+				return nil, err
+			}
+			return int64(runes[pos]), nil
+		}),
+	}
+}
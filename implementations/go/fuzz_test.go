@@ -0,0 +1,129 @@
+package strata
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var fuzzSeeds = []string{
+	"let x: int = 1 + 2 * 3",
+	"import io from std::io\nio.print(\"hi\")",
+	"func f(a: int, b: int) => int { return a + b }\nf(1, 2)",
+	"var i: int = 0\nwhile (i < 3) { i = i + 1 }",
+	"for (var i: int = 0; i < 3; i = i + 1) { if (i == 1) { continue } else { break } }",
+	"let s: string = \"a\\tb\"",
+	"import m from std::math\nm.sqrt(4)",
+	"import x from \"./other.str\"",
+	"let",
+	"func",
+	"import",
+	"(((",
+	"\"",
+	"let z: int = 1 % 0",
+	"substr(\"abc\", 5, 1)",
+	"repeat(\"a\", 0 - 1)",
+	"strlen()",
+	"import t from std::text\nt.repeat(\"a\")",
+	"import m from std::math\nm.nope(1)",
+	"let s: string = \"a ${1 + 2} ${\"b ${3}\"} \\${c}\"",
+	"\"${",
+	"\"${}\"",
+	"class C { var n: int = 0  func init(n: int) => void { this.n = n } }\nlet c: C = C(1)\nc.n = c.n + 1",
+	"interface I { func f() => int }\nclass K { func f() => int { return 1 } }\nlet k: I = K()\nk is I",
+	"let m: map<string, list<int>> = {\"a\": [1]}\nlet x: int = m[\"a\"][0]",
+	"let a: int = )\nfunc g() => int {\n  let b: int = (\n  }\n}\nlet c: bool = 1",
+	"let a: i8 = 127\nlet b: int = 9223372036854775807 * 2 / (a - 127) % -1",
+	"let s: string = \"héllo\"\nlet t: string = s[1:3] + s[:1] + s[4:] + s[0]\nlet xs: list = [1, 2][:]",
+	"import io from std::io\nlet name: string = input(\"name? \")\nio.print(readLine())\nio.print(io.readAll())",
+	"import os from std::os\nlet args: list = os.args()\ntry { os.setEnv(\"A\", os.platform()) } catch (e) { os.exit(len(args)) }",
+	"import random from std::random\nrandom.seed(7)\nlet xs: list = random.shuffle([1, 2, 3])\nlet n: int = random.int(0, 10) + random.choice(xs)\nlet id: string = random.uuid()",
+	"import list from std::list\nfunc inc(x: int) => int { return x + 1 }\nfunc add(a: int, b: int) => int { return a + b }\nlet xs: list = list.sort(list.unique(list.flatten([[3, 1], 2, [1]])))\nlet n: int = list.reduce(list.map(xs, inc), add, 0)",
+	"import dict from std::dict\nlet m: map = dict.merge({\"a\": 1}, dict.fromEntries([(\"b\", 2)]))\nlet ks: list = dict.keys(dict.delete(m, \"a\"))\nlet v: int = dict.get(m, \"c\", 0)",
+	"import text from std::text\nlet s: string = format(\"%-5s|%05.1f|%x|%v%%\", \"a\", 2.5, 255, [1])\nlet t: string = text.padStart(text.reverse(s), 20, \"*\") + text.chars(s)[0]",
+	"import regex from std::regex\nlet p: any = regex.compile(\"(a+)(b)?\")\nlet all: list = regex.matchAll(\"aab ab a\", p)\nlet g: any = regex.groups(\"xaab\", p)\nlet r: string = regex.replace(\"aab\", \"(a+)\", \"<$1>\")",
+	"import yaml from std::yaml\nimport toml from std::toml\nlet y: any = yaml.parse(\"a: [1, {b: c}]\\nd:\\n  - e\\n  - |\\n    f\\n\")\nlet t: any = toml.parse(\"x = 1\\n[t]\\ny = [\\\"z\\\"]\\n[[u]]\\n\")\nlet s: string = yaml.stringify(t) + toml.stringify(y)",
+	"import matrix from std::matrix\nlet a: any = matrix.from([[4, 7], [2, 6]])\nio.print(matrix.determinant(a))\nio.print(matrix.multiply(a, matrix.inverse(a)))\n",
+	"import file from std::file\nio.print(file.glob(\"src/**/*.str\"))\nio.print(file.list(\".\"))\n",
+	"import file from std::file\nlet h: any = file.open(\"notes.txt\", \"w+\")\nh.write(\"one\\ntwo\")\nh.seek(0)\nio.print(h.readLine())\nio.print(h.readChunk(2))\nh.close()\n",
+	"import bytes from std::bytes\nlet b: bytes = bytes.fromHex(\"cafe00\")\nio.print(b[1:], len(b), b[0])\nio.print(bytes.toString(bytes.concat(b, \"x\"), \"base64\"))\n",
+	"import log from std::log\nlog.setLevel(\"debug\")\nlog.setTimestamps(false)\nlog.debug(\"x\", 1, [2])\nlog.warn(log.level())\nlog.toFile(\"app.log\")\n",
+	"import assert from std::assert\nfunc boom() => int { throw \"x\" }\nassert.equal([1], [1])\nassert.approx(0.1 + 0.2, 0.3)\nio.print(assert.throws(boom))\ntry { assert.true(false, \"no\") } catch (e) { io.print(e) }\nio.print(assert.failures())\n",
+	"#!/usr/bin/env strata\nimport io from std::io\nio.print(1)\n",
+	"import io from std::io\nvar g: int = 1\nfunc f(flag: bool) => int {\n  if (flag) { var g: int = 10 }\n  g = g + 1\n  try { throw g } catch (g) { io.print(g) }\n  return g\n}\nio.print(f(false))\nio.print(f(true))\n",
+	"import io from std::io\nfunc f(a: int, b: int) => int { return a - b }\nio.print(f(f(5, 1), f(f(9, 2), 3)), f(...[7, 2]))\n",
+	"import parallel from std::parallel\nfunc sq(x: int) => int { return x * x }\nlet ys: list = parallel.map([1, 2, 3], sq, 2)\nparallel.each(ys, sq)\n",
+	"import promise from std::promise\nasync func twice(n: int) => int { return n * 2 }\nlet p: promise<int> = twice(4)\nlet all: list = await promise.all([p, twice(1), 3])\nlet first: int = await promise.race([p])\n",
+	"let c: channel = channel(0)\nc.send(1)\n",
+	"let c: channel = channel(1)\nc.send(1)\nselect {\n  v = c.receive() => { c.close() }\n  _ => { }\n}\nfunc f(x: int) => int { return x }\nlet p: promise<int> = spawn f(2)\n",
+	"select{_=>}\nmatch (1) {_=>}",
+	"var t: int = 0\nfor (x in [1, 2]) { t = t + x } else { t = 0 }\nfor (c in iter(\"ab\")) { }\nfor (n in range(0, 3)) { if (n > 1) { break } }",
+}
+
+func addSeeds(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	matches, _ := filepath.Glob(filepath.Join("..", "..", "examples", "*.str"))
+	for _, path := range matches {
+		if data, err := os.ReadFile(path); err == nil {
+			f.Add(string(data))
+		}
+	}
+}
+
+func failOnInternalError(t *testing.T, source string, err error) {
+	var internal *InternalError
+	if errors.As(err, &internal) {
+		t.Fatalf("panic on input %q: %v\n%s", source, internal.Value, internal.Stack)
+	}
+}
+
+func FuzzParseSource(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, source string) {
+		statements, err := ParseSource(source)
+		failOnInternalError(t, source, err)
+		if err != nil {
+			return
+		}
+		// An identity rewrite must reach every node and change nothing.
+		var walked, rewritten int
+		for _, stmt := range statements {
+			Inspect(stmt, func(n Node) bool {
+				if n != nil {
+					walked++
+				}
+				return true
+			})
+		}
+		before := FormatProgram(statements)
+		statements = RewriteBlock(statements, func(n Node) Node {
+			rewritten++
+			return n
+		})
+		if after := FormatProgram(statements); after != before || walked != rewritten {
+			t.Fatalf("identity rewrite changed the program (%d nodes walked, %d rewritten):\n%s\n---\n%s", walked, rewritten, before, after)
+		}
+	})
+}
+
+// fuzzUnsafeNames keeps fuzzed programs from importing the example scripts.
+// The sandbox keeps them away from the filesystem.
+var fuzzUnsafeNames = []string{"../"}
+
+func FuzzRunSource(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, source string) {
+		for _, name := range fuzzUnsafeNames {
+			if strings.Contains(source, name) {
+				t.Skip()
+			}
+		}
+		err := RunSource(source, RunOptions{Stdout: io.Discard, Stderr: io.Discard, Stdin: strings.NewReader("Ada\n42\n"), MaxSteps: 10000, MaxMemory: 1 << 24, MaxOutput: 1 << 16, Sandbox: &InterpreterOptions{}})
+		failOnInternalError(t, source, err)
+	})
+}
@@ -0,0 +1,217 @@
+package strata
+
+import "strings"
+
+// ============================================================================
+// PARAMETERIZED TYPES - list<int>, map<string, float>, option<string>
+// ============================================================================
+
+// typeParams lists how many parameters each parameterized type takes. One
+// parameter is stored in InnerType, several in Types.
+var typeParams = map[PrimitiveType]int{
+	TypeList: 1, TypeArray: 1, TypeSet: 1, TypeOption: 1, TypePromise: 1,
+	TypeMap: 2, TypeDict: 2, TypeResult: 2,
+	TypeTuple: -1,
+}
+
+// parseGeneric parses an annotation such as `map<string, list<int>>`.
+func parseGeneric(token string) (TypeDef, bool) {
+	open := strings.Index(token, "<")
+	if open <= 0 || !strings.HasSuffix(token, ">") {
+		return TypeDef{}, false
+	}
+	base, ok := TypeRegistry[token[:open]]
+	want, generic := typeParams[base.Primitive]
+	if !ok || !generic {
+		return TypeDef{}, false
+	}
+	var params []TypeDef
+	for _, arg := range splitTypeArgs(token[open+1 : len(token)-1]) {
+		params = append(params, parseTypeAnnotation(arg))
+	}
+	switch {
+	case want == 1 && len(params) == 1:
+		base.InnerType = &params[0]
+	case want == len(params) || (want < 0 && len(params) > 0):
+		base.Types = params
+	default:
+		return TypeDef{}, false
+	}
+	return base, true
+}
+
+// splitTypeArgs splits `string, map<string, int>` at its top-level commas.
+func splitTypeArgs(args string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for idx, r := range args {
+		switch r {
+		case '<':
+			depth++
+		case '>':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(args[start:idx]))
+				start = idx + 1
+			}
+		}
+	}
+	return append(parts, strings.TrimSpace(args[start:]))
+}
+
+// typeArgsString renders the parameters of t, such as `<string, float>`.
+func typeArgsString(t TypeDef) string {
+	if t.InnerType != nil {
+		return "<" + t.InnerType.String() + ">"
+	}
+	if len(t.Types) == 0 {
+		return ""
+	}
+	parts := make([]string, len(t.Types))
+	for idx, param := range t.Types {
+		parts[idx] = param.String()
+	}
+	return "<" + strings.Join(parts, ", ") + ">"
+}
+
+// paramsCompatible compares the element types of two collection types. A
+// collection without parameters, such as a bare `list`, matches any.
+func paramsCompatible(actual, expected TypeDef) bool {
+	if actual.InnerType != nil && expected.InnerType != nil {
+		return typeCompatible(*actual.InnerType, *expected.InnerType)
+	}
+	if len(actual.Types) == 0 || len(expected.Types) == 0 {
+		return true
+	}
+	if len(actual.Types) != len(expected.Types) {
+		return false
+	}
+	for idx := range actual.Types {
+		if !typeCompatible(actual.Types[idx], expected.Types[idx]) {
+			return false
+		}
+	}
+	return true
+}
+
+// elementType is the type of a value read from a collection of type t by
+// indexing, or any when t does not say.
+func elementType(t TypeDef, index *Expr) TypeDef {
+	switch {
+	case isListType(t.Primitive) && t.InnerType != nil:
+		return *t.InnerType
+	case isMapType(t.Primitive) && len(t.Types) == 2:
+		return t.Types[1]
+	case t.Primitive == TypeString && t.Kind == KindPrimitive:
+		return TypeRegistry["char"]
+	case t.Primitive == TypeTuple && index != nil && index.Kind == ExprLiteral:
+		if pos, ok := index.Value.(int64); ok && pos >= 0 && int(pos) < len(t.Types) {
+			return t.Types[pos]
+		}
+	}
+	return TypeDef{Kind: KindPrimitive, Primitive: TypeAny}
+}
+
+// elementsAre reports whether every element of a list or value of a map has
+// the element type t declares, so `xs is list<int>` looks inside xs.
+func elementsAre(value interface{}, t TypeDef) bool {
+	element := elementType(t, nil)
+	if element.Primitive == TypeAny && element.Kind == KindPrimitive {
+		return true
+	}
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if !valueIs(item, element) {
+				return false
+			}
+		}
+	case []string:
+		for _, item := range v {
+			if !valueIs(item, element) {
+				return false
+			}
+		}
+	case map[string]interface{}:
+		for _, item := range v {
+			if !valueIs(item, element) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// literalType infers `list<T>` for an array literal whose elements all have
+// the same type.
+func (tc *TypeChecker) literalType(expr *Expr) TypeDef {
+	t := expr.Type
+	if len(expr.Elements) == 0 {
+		return t
+	}
+	first := tc.inferType(expr.Elements[0])
+	for _, element := range expr.Elements {
+		if element.Kind == ExprSpread || tc.inferType(element).String() != first.String() || first.Primitive == TypeAny {
+			return t
+		}
+	}
+	t.InnerType = &first
+	return t
+}
+
+// checkElements checks each element of an array or map literal against the
+// element type expected of it.
+func (tc *TypeChecker) checkElements(expr *Expr, expected TypeDef) error {
+	element := elementType(expected, nil)
+	if expr.Kind == ExprMap && len(expected.Types) == 2 && !typeCompatible(TypeRegistry["string"], expected.Types[0]) {
+		return newError(ErrTypeMismatch, "map keys are strings, but %s expects %s keys", expected, expected.Types[0]).at(expr.Location)
+	}
+	for _, item := range expr.Elements {
+		if item.Kind == ExprSpread {
+			continue
+		}
+		if err := tc.checkExpression(item, element); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkIndexing verifies that every index in expr suits the collection it
+// reads from: lists, tuples and strings take int positions, maps take string
+// keys and slice bounds are ints.
+func (tc *TypeChecker) checkIndexing(expr *Expr) error {
+	if expr == nil {
+		return nil
+	}
+	if expr.Kind == ExprIndex {
+		object, index := tc.inferType(expr.Object), tc.inferType(expr.Index)
+		intType, stringType := TypeRegistry["int"], TypeRegistry["string"]
+		if (isListType(object.Primitive) || object.Primitive == TypeTuple || object.Primitive == TypeString) && !typeCompatible(index, intType) {
+			return newError(ErrIndex, "%s index must be int, got %s", object, index).at(expr.Index.Location)
+		}
+		if isMapType(object.Primitive) && !typeCompatible(index, stringType) {
+			return newError(ErrIndex, "%s key must be string, got %s", object, index).at(expr.Index.Location)
+		}
+	}
+	if expr.Kind == ExprSlice {
+		for _, bound := range []*Expr{expr.Left, expr.Right} {
+			if bound != nil && !typeCompatible(tc.inferType(bound), TypeRegistry["int"]) {
+				return newError(ErrIndex, "slice bounds must be int, got %s", tc.inferType(bound)).at(bound.Location)
+			}
+		}
+	}
+	for _, child := range exprChildren(expr) {
+		if err := tc.checkIndexing(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exprChildren lists the subexpressions of expr.
+func exprChildren(expr *Expr) []*Expr {
+	children := append([]*Expr{expr.Left, expr.Right, expr.Operand, expr.Func, expr.Object, expr.Index}, expr.Args...)
+	return append(children, expr.Elements...)
+}
@@ -0,0 +1,123 @@
+package strata
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// ============================================================================
+// STD::HTTP::SERVER - Serving HTTP requests with a Strata handler function
+// ============================================================================
+
+// A handler receives a request map with method, path, query, headers and
+// body, and returns either a response map with status, headers and body or
+// just the body as a string. Requests are handled one at a time because the
+// interpreter is not safe for concurrent use.
+
+func httpServerModule(i *Interpreter) map[string]interface{} {
+	return map[string]interface{}{
+		"listen": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("listen", args, 2); err != nil {
+				return nil, err
+			}
+			port, ok := args[0].(int64)
+			if !ok {
+				return nil, newError(ErrTypeMismatch, "listen expects an int port, got %s", describeValue(args[0]))
+			}
+			if describeValue(args[1]) != "function" {
+				return nil, newError(ErrTypeMismatch, "listen expects a handler function, got %s", describeValue(args[1]))
+			}
+			return nil, i.serveHTTP(fmt.Sprintf(":%d", port), args[1])
+		}),
+	}
+}
+
+// serveHTTP blocks serving requests on addr until the server fails or a
+// handler raises a fatal error, such as os.exit, which it returns.
+func (i *Interpreter) serveHTTP(addr string, handler interface{}) error {
+	var mu sync.Mutex
+	var fatal error
+	server := &http.Server{Addr: addr}
+	server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if fatal != nil {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		depth := len(i.CallStack)
+		response, err := i.callValue("handler", handler, []interface{}{requestValue(r)})
+		if err != nil {
+			i.CallStack = i.CallStack[:depth]
+			if isFatal(err) {
+				fatal = err
+				go server.Close()
+			} else {
+				fmt.Fprintf(i.Stderr, "Error: %s %s: %v\n", r.Method, r.URL.Path, err)
+			}
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		writeResponse(w, response)
+	})
+	// The server is a task of its own while it serves: a handler waiting
+	// on a channel may be woken by the next request.
+	i.tasks.start()
+	err := server.ListenAndServe()
+	i.tasks.stop()
+	mu.Lock()
+	defer mu.Unlock()
+	if fatal != nil {
+		return fatal
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return newError(ErrInvalidOperation, "http server: %v", err)
+}
+
+// requestValue converts an incoming request to the map a handler receives.
+// Repeated query parameters and headers keep their first value.
+func requestValue(r *http.Request) map[string]interface{} {
+	body, _ := io.ReadAll(r.Body)
+	query := make(map[string]interface{})
+	for name, values := range r.URL.Query() {
+		query[name] = values[0]
+	}
+	headers := make(map[string]interface{})
+	for name, values := range r.Header {
+		headers[name] = values[0]
+	}
+	return map[string]interface{}{
+		"method":  r.Method,
+		"path":    r.URL.Path,
+		"query":   query,
+		"headers": headers,
+		"body":    string(body),
+	}
+}
+
+// writeResponse sends a handler's result. A map sets the status, headers and
+// body; any other value is sent as the body with status 200.
+func writeResponse(w http.ResponseWriter, response interface{}) {
+	status := int64(http.StatusOK)
+	body := response
+	if m, ok := response.(map[string]interface{}); ok {
+		if code, ok := m["status"].(int64); ok {
+			status = code
+		}
+		if headers, ok := m["headers"].(map[string]interface{}); ok {
+			for name, value := range headers {
+				w.Header().Set(name, displayValue(value))
+			}
+		}
+		body = m["body"]
+	}
+	w.WriteHeader(int(status))
+	if body != nil {
+		io.WriteString(w, displayValue(body))
+	}
+}
@@ -0,0 +1,77 @@
+package strata
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// freePort returns a port nothing on the loopback interface listens on.
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestHTTPServerRunsStrataHandler(t *testing.T) {
+	port := strconv.Itoa(freePort(t))
+	source := `import server from std::http::server
+import os from std::os
+func handle(req: any) => any {
+  if (req["path"] == "/stop") {
+    os.exit(3)
+  }
+  return {"status": 201, "headers": {"X-Name": req["query"]["name"]}, "body": req["method"] + " " + req["path"] + " " + req["body"]}
+}
+server.listen(` + port + `, handle)
+`
+	done := make(chan error, 1)
+	go func() { done <- RunSource(source, RunOptions{}) }()
+
+	url := "http://127.0.0.1:" + port
+	var resp *http.Response
+	var err error
+	for attempt := 0; attempt < 100; attempt++ {
+		if resp, err = http.Post(url+"/echo?name=ann", "text/plain", strings.NewReader("hi")); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 201 || resp.Header.Get("X-Name") != "ann" || string(body) != "POST /echo hi" {
+		t.Errorf("got %d %v %q", resp.StatusCode, resp.Header, body)
+	}
+
+	// os.exit in a handler stops the server and ends the run.
+	if resp, err := http.Get(url + "/stop"); err == nil {
+		resp.Body.Close()
+	}
+	select {
+	case err := <-done:
+		var exit *ExitError
+		if !errors.As(err, &exit) || exit.Code != 3 {
+			t.Errorf("the run ended with %v, want exit code 3", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the server did not stop")
+	}
+
+	err = RunSource(source, RunOptions{Sandbox: &InterpreterOptions{}})
+	var diag *StrataError
+	if !errors.As(err, &diag) || diag.Code != ErrPermission {
+		t.Errorf("listening in the sandbox gave %v, want a permission error", err)
+	}
+}
@@ -0,0 +1,84 @@
+package strata
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ============================================================================
+// INLINE SCRIPTS - strata - and strata -e run code without a source file
+// ============================================================================
+
+// RunStdin runs the program read from standard input, as in
+// `cat script.str | strata -`. The script's own io.read calls then see
+// end of input.
+func RunStdin(opts RunOptions) int {
+	source, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		opts.report(err, "<stdin>", "")
+		return 1
+	}
+	return runInline("<stdin>", string(source), opts, false)
+}
+
+// RunInlineCode runs `strata -e <code> [args...]`. When the code ends in an
+// expression, its value is printed, so `strata -e "2 ** 10"` works like a
+// calculator.
+func RunInlineCode(args []string, opts RunOptions) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: strata -e <code> [args...]")
+		return 1
+	}
+	opts.Args = args[1:]
+	return runInline("<eval>", args[0], opts, true)
+}
+
+// runInline parses, checks and runs source that has no file behind it.
+// Imports resolve against the working directory, and runtime errors are
+// reported without writing a crash report.
+func runInline(name, source string, opts RunOptions, echo bool) int {
+	statements, err := ParseSource(source)
+	if err == nil && !opts.SkipTypeCheck {
+		err = NewTypeChecker().Check(statements)
+	}
+	if err != nil {
+		opts.report(err, name, source)
+		return 1
+	}
+	interp := NewInterpreter()
+	opts.Configure(interp)
+	var last *Stmt
+	if n := len(statements); echo && n > 0 && statements[n-1].Kind == StmtExpression {
+		statements, last = statements[:n-1], statements[n-1]
+	}
+	err = interp.Interpret(statements)
+	if err == nil && last != nil && interp.ControlFlow.Type == CFNone {
+		err = interp.echo(last)
+	}
+	var exit *ExitError
+	if errors.As(err, &exit) {
+		return exit.Code
+	}
+	if err != nil {
+		opts.report(err, name, source)
+		return 1
+	}
+	return 0
+}
+
+// echo evaluates an expression statement and prints its value unless it is
+// null, so calls made only for their output print nothing more.
+func (i *Interpreter) echo(stmt *Stmt) (err error) {
+	defer recoverInternalError(&err)
+	i.Location = stmt.Location
+	value, err := i.evaluateExpression(stmt.Expr)
+	if err == nil {
+		err = i.pendingThrow()
+	}
+	if err == nil && value != nil {
+		fmt.Fprintln(i.Stdout, formatValue(value))
+	}
+	return err
+}
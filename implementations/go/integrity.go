@@ -0,0 +1,161 @@
+package strata
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ============================================================================
+// INTEGRITY - Checksums that catch tampered or corrupted packages
+// ============================================================================
+
+// Installing a package records a checksum of its directory in the lock file
+// as "sha256:<hex>". The checksum covers the path and contents of every
+// file, so an edited, added or deleted file changes it. It is checked when
+// a locked version is installed again, by `strataum verify`, and before a
+// project loads a module from an installed or vendored package.
+
+// packageChecksum is the checksum of the package installed in dir.
+func packageChecksum(dir string) (string, error) {
+	sum := sha256.New()
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return fmt.Errorf("%s is not a regular file", filepath.ToSlash(rel))
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		content := sha256.New()
+		if _, err := io.Copy(content, file); err != nil {
+			return err
+		}
+		fmt.Fprintf(sum, "%s\x00%x\n", filepath.ToSlash(rel), content.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// verifyPackage checks the package installed in dir against the checksum
+// locked for it.
+func verifyPackage(name string, lock *LockPackage, dir string) error {
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("%s@%s is not installed", name, lock.Version)
+	}
+	actual, err := packageChecksum(dir)
+	if err != nil {
+		return fmt.Errorf("%s@%s cannot be read: %v", name, lock.Version, err)
+	}
+	if actual != lock.Integrity {
+		return fmt.Errorf("%s@%s has been modified: the lock file expects %s, the package is %s", name, lock.Version, lock.Integrity, actual)
+	}
+	return nil
+}
+
+// Verify checks every locked package against its checksum and reports each
+// one. Packages locked before checksums were recorded are reported but do
+// not fail.
+func (pm *PackageManager) Verify() error {
+	names := make([]string, 0, len(pm.LockFile.Packages))
+	for name := range pm.LockFile.Packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		fmt.Println("No packages to verify.")
+		return nil
+	}
+	failed := 0
+	for _, name := range names {
+		lock := pm.LockFile.Packages[name]
+		if lock.Integrity == "" {
+			fmt.Printf("? %s@%s has no checksum; reinstall it to record one\n", name, lock.Version)
+			continue
+		}
+		// A vendored copy is checked like an installed one; a project with
+		// its packages vendored need not have them installed.
+		installed, vendored := pm.packagesDir()+"/"+name, pm.vendorDir()+"/"+name
+		places := []string{installed}
+		if _, err := os.Stat(vendored); err == nil {
+			places = []string{vendored}
+			if _, err := os.Stat(installed); err == nil {
+				places = append(places, installed)
+			}
+		}
+		for _, dir := range places {
+			where := ""
+			if dir == vendored {
+				where = " in vendor/"
+			}
+			if err := verifyPackage(name, lock, dir); err != nil {
+				fmt.Printf("✗ %v%s\n", err, where)
+				failed++
+				continue
+			}
+			fmt.Printf("✓ %s@%s%s\n", name, lock.Version, where)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d package(s) failed verification; run strataum install to restore them", failed)
+	}
+	return nil
+}
+
+// verifyPackageModule checks, before a module is loaded from a package
+// installed or vendored in the project, that the package matches the lock
+// file. Each package is checked once per project.
+func (p *Project) verifyPackageModule(path string) error {
+	p.verifyMu.Lock()
+	defer p.verifyMu.Unlock()
+	if p.lock == nil {
+		pm := NewPackageManager(p.Root)
+		p.lock = pm.LockFile.Packages
+		p.packageDirs = []string{filepath.FromSlash(pm.vendorDir()), filepath.FromSlash(pm.packagesDir())}
+	}
+	for _, packages := range p.packageDirs {
+		rel, err := filepath.Rel(packages, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		name := parts[0]
+		if strings.HasPrefix(name, "@") && len(parts) > 2 {
+			name += "/" + parts[1]
+		}
+		dir := filepath.Join(packages, filepath.FromSlash(name))
+		if err, done := p.verified[dir]; done {
+			return err
+		}
+		var checked error
+		if lock := p.lock[name]; lock != nil && lock.Integrity != "" {
+			checked = verifyPackage(name, lock, dir)
+		}
+		if p.verified == nil {
+			p.verified = make(map[string]error)
+		}
+		p.verified[dir] = checked
+		return checked
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package strata
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLockedPackagesAreVerified(t *testing.T) {
+	served := tarball(t, map[string]string{"package/index.str": "func hello() => string {\n  return \"hello\"\n}\n"})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/packages/greet", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name": "greet", "latest": "1.0.0", "versions": {"1.0.0": {"tarball": "/greet.tgz"}}}`))
+	})
+	mux.HandleFunc("/greet.tgz", func(w http.ResponseWriter, r *http.Request) { w.Write(served) })
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	t.Setenv("HOME", t.TempDir())
+	root := t.TempDir()
+	pm := NewPackageManager(root)
+	pm.Strataumfile.Registry = server.URL
+	if err := pm.Add("greet", "1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	lock := pm.LockFile.Packages["greet"]
+	if lock == nil || !strings.HasPrefix(lock.Integrity, "sha256:") {
+		t.Fatalf("greet locked as %+v, want a checksum", lock)
+	}
+	if err := NewPackageManager(root).Verify(); err != nil {
+		t.Fatalf("verify after install: %v", err)
+	}
+
+	main := filepath.Join(root, "main.str")
+	os.WriteFile(main, []byte("import greet from \"./.strata/packages/greet/index.str\"\n"), 0644)
+	if _, err := LoadProject(main); err != nil {
+		t.Fatalf("loading an intact package: %v", err)
+	}
+
+	index := filepath.Join(root, ".strata", "packages", "greet", "index.str")
+	os.WriteFile(index, []byte("func hello() => string {\n  return \"pwned\"\n}\n"), 0644)
+	if err := NewPackageManager(root).Verify(); err == nil {
+		t.Error("verify passed a modified package")
+	}
+	project, err := LoadProject(main)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report strings.Builder
+	project.ReportDiagnostics(&report)
+	if !strings.Contains(report.String(), "greet@1.0.0 has been modified") {
+		t.Errorf("loading a modified package reported %q", report.String())
+	}
+
+	// Installing again restores the package as it was locked, and refuses
+	// a registry that now serves something else.
+	pm = NewPackageManager(root)
+	pm.Strataumfile.Registry = server.URL
+	if err := pm.Install(""); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewPackageManager(root).Verify(); err != nil {
+		t.Fatalf("verify after reinstall: %v", err)
+	}
+	os.RemoveAll(filepath.Dir(index))
+	served = tarball(t, map[string]string{"index.str": "let changed: int = 1\n"})
+	err = pm.Install("")
+	if err == nil || !strings.Contains(err.Error(), "does not match the lock file") {
+		t.Errorf("installing a changed tarball: got %v", err)
+	}
+}
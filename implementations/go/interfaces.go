@@ -0,0 +1,120 @@
+package strata
+
+import "strings"
+
+// ============================================================================
+// INTERFACES - Interface declarations and structural conformance
+// ============================================================================
+
+// InterfaceType is the runtime value bound to an interface's name. A value
+// satisfies it when it has a method of each name and arity, whatever class
+// declared it.
+type InterfaceType struct {
+	Name    string
+	Methods []*Stmt
+}
+
+func (t *InterfaceType) String() string {
+	return "<interface " + t.Name + ">"
+}
+
+func (t *InterfaceType) satisfiedBy(value interface{}) bool {
+	instance, ok := value.(*Instance)
+	if !ok {
+		return false
+	}
+	for _, sig := range t.Methods {
+		method, ok := instance.Class.Methods[sig.Name]
+		if !ok || len(method.Params) != len(sig.Params) {
+			return false
+		}
+	}
+	return true
+}
+
+// lookupInterface returns the interface bound to name, if any.
+func (i *Interpreter) lookupInterface(name string) (*InterfaceType, bool) {
+	entry, err := i.Env.Lookup(name)
+	if err != nil {
+		return nil, false
+	}
+	iface, ok := entry.Value.(*InterfaceType)
+	return iface, ok
+}
+
+func (tc *TypeChecker) checkInterface(stmt *Stmt) error {
+	if _, exists := tc.Interfaces[stmt.Name]; exists {
+		return newError(ErrDuplicate, "interface %s is already declared", stmt.Name)
+	}
+	seen := make(map[string]bool)
+	for _, sig := range stmt.Body {
+		if seen[sig.Name] {
+			return newError(ErrDuplicate, "duplicate method %s in interface %s", sig.Name, stmt.Name)
+		}
+		seen[sig.Name] = true
+	}
+	tc.Interfaces[stmt.Name] = stmt
+	return nil
+}
+
+// conforms reports why a value of type actual cannot be used where the
+// interface expected is required, or nil when it can. Classes and other
+// interfaces conform when they declare every method with compatible
+// parameter and return types.
+func (tc *TypeChecker) conforms(actual, expected TypeDef) error {
+	if actual.Primitive == TypeAny {
+		return nil
+	}
+	var methods []*Stmt
+	switch actual.Kind {
+	case KindClass:
+		for _, member := range tc.Classes[actual.Name].Body {
+			if member.Kind == StmtFunction {
+				methods = append(methods, member)
+			}
+		}
+	case KindInterface:
+		methods = tc.Interfaces[actual.Name].Body
+	default:
+		return newError(ErrTypeMismatch, "type mismatch: expected %s, got %s", expected, actual)
+	}
+	for _, want := range tc.Interfaces[expected.Name].Body {
+		var have *Stmt
+		for _, m := range methods {
+			if m.Name == want.Name {
+				have = m
+			}
+		}
+		if have == nil {
+			return newError(ErrTypeMismatch, "%s does not implement %s: missing method %s", actual, expected, want.Name)
+		}
+		if !tc.sameSignature(have, want) {
+			return newError(ErrTypeMismatch, "%s does not implement %s: method %s is %s, want %s", actual, expected, want.Name, signature(have), signature(want))
+		}
+	}
+	return nil
+}
+
+// sameSignature reports whether method have can stand in for want: it takes
+// the same number of parameters, accepts what want accepts and returns what
+// want returns.
+func (tc *TypeChecker) sameSignature(have, want *Stmt) bool {
+	if len(have.Params) != len(want.Params) {
+		return false
+	}
+	for idx, param := range want.Params {
+		if !typeCompatible(tc.resolveType(param.Type), tc.resolveType(have.Params[idx].Type)) {
+			return false
+		}
+	}
+	return typeCompatible(tc.resolveType(have.ReturnType), tc.resolveType(want.ReturnType))
+}
+
+// signature renders a method's parameter and return types for messages.
+func signature(method *Stmt) string {
+	params := make([]string, len(method.Params))
+	for idx, p := range method.Params {
+		params[idx] = p.Type.String()
+	}
+	return "(" + strings.Join(params, ", ") + ") => " + method.ReturnType.String()
+}
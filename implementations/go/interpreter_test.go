@@ -0,0 +1,661 @@
+package strata
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Benchmarks for the interpreter's hot paths, next to the lexer and parser
+// ones in lexer_test.go. Run them with `go test -run xxx -bench . -benchmem`
+// and compare allocs/op across changes.
+
+const fibSource = `func fib(n: int) => int {
+  if (n < 2) { return n }
+  return fib(n - 1) + fib(n - 2)
+}
+let result: int = fib(20)
+`
+
+const stringBuildSource = `var s: string = ""
+var i: int = 0
+while (i < 2000) {
+  s = s + "${i}," + 1.5 + true
+  i = i + 1
+}
+let n: int = len(s)
+`
+
+const loopSource = `func sum(n: int) => int {
+  var total: int = 0
+  var i: int = 0
+  while (i < n) {
+    if (i % 3 == 0 || i == n) { total = total + i }
+    i = i + 1
+  }
+  return total
+}
+let result: int = sum(20000)
+`
+
+func benchmarkRun(b *testing.B, source string) {
+	b.ReportAllocs()
+	statements, err := ParseSource(source)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for n := 0; n < b.N; n++ {
+		interp := NewInterpreter()
+		interp.Stdout = io.Discard
+		if err := interp.Interpret(statements); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFib(b *testing.B)         { benchmarkRun(b, fibSource) }
+func BenchmarkStringBuild(b *testing.B) { benchmarkRun(b, stringBuildSource) }
+func BenchmarkLoop(b *testing.B)        { benchmarkRun(b, loopSource) }
+
+func TestParallelMapIsolatesWorkers(t *testing.T) {
+	source := `import io from std::io
+import parallel from std::parallel
+var calls: int = 0
+var shared: list = [0]
+func work(n: int) => int {
+  calls = calls + 1
+  shared[0] = n
+  return n * n
+}
+io.print(parallel.map([1, 2, 3, 4, 5], work, 3))
+io.print(calls)
+io.print(shared)
+`
+	var out strings.Builder
+	if err := RunSource(source, RunOptions{Stdout: &out}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "[1, 4, 9, 16, 25]\n0\n[0]\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestAwaitAsyncResultsAndErrors(t *testing.T) {
+	source := `import io from std::io
+import promise from std::promise
+async func square(n: int) => int {
+  if (n < 0) { throw "negative" }
+  return n * n
+}
+let p: promise<int> = square(3)
+io.print(await p + await p)
+io.print(await promise.all([square(1), square(2), 5]))
+try {
+  await square(-1)
+} catch (e) {
+  io.print(e)
+}
+`
+	var out strings.Builder
+	if err := RunSource(source, RunOptions{Stdout: &out}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "18\n[1, 4, 5]\nnegative\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestSpawnChannelsAndSelect(t *testing.T) {
+	source := `import io from std::io
+func produce(out: channel, n: int) => int {
+  var k: int = 0
+  while (k < n) {
+    out.send(k * k)
+    k = k + 1
+  }
+  out.close()
+  return n
+}
+let ch: channel = channel()
+let done: promise<int> = spawn produce(ch, 4)
+var total: int = 0
+var msg: any = ch.receive()
+while (msg != null) {
+  total = total + msg
+  msg = ch.receive()
+}
+io.print(total)
+io.print(await done)
+let box: channel = channel(1)
+select {
+  m = box.receive() => io.print(m)
+  _ => io.print("empty")
+}
+box.send([1, 2])
+select {
+  box.send(3) => io.print("sent")
+  m = box.receive() => io.print(m)
+}
+`
+	var out strings.Builder
+	if err := RunSource(source, RunOptions{Stdout: &out}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "14\n4\nempty\n[1, 2]\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestDeadlockedChannelsFail(t *testing.T) {
+	for _, source := range []string{
+		"let c: channel = channel(0)\nc.send(1)\n",
+		"let c: channel = channel(1)\nlet v: any = c.receive()\n",
+		"let c: channel = channel()\nselect {\n  v = c.receive() => { }\n}\n",
+		"func f(c: channel) => int {\n  c.send(1)\n  return 1\n}\nlet c: channel = channel()\nlet p: promise<int> = spawn f(c)\nlet n: int = await p\n",
+		"func f(c: channel) => int {\n  return c.receive()\n}\nlet c: channel = channel()\nlet p: promise<int> = spawn f(c)\nfor (v in c) { }\n",
+	} {
+		done := make(chan error, 1)
+		go func() { done <- RunSource(source, RunOptions{}) }()
+		select {
+		case err := <-done:
+			if err == nil || !strings.Contains(err.Error(), "deadlock") {
+				t.Errorf("%q: got %v, want a deadlock error", source, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%q: still waiting after 5s", source)
+		}
+	}
+}
+
+func TestForInIteratorProtocol(t *testing.T) {
+	source := `import io from std::io
+class Countdown {
+  var n: int = 0
+  func init(n: int) => void { this.n = n }
+  func next() => any {
+    if (this.n == 0) { return None() }
+    this.n = this.n - 1
+    return Some(this.n + 1)
+  }
+}
+class Bag {
+  var items: list = []
+  func init(items: list) => void { this.items = items }
+  func iter() => any { return iter(this.items) }
+}
+var out: string = ""
+for (c in "ab") { out = out + c }
+for (k in {"y": 1, "x": 2}) { out = out + k }
+for (n in range(0, 3)) { out = out + toString(n) }
+for (n in Countdown(2)) { out = out + toString(n) }
+for (s in Bag(["p", "q"])) { out = out + s } else { out = out + "." }
+io.print(out)
+`
+	var out strings.Builder
+	if err := RunSource(source, RunOptions{Stdout: &out}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "abxy01221pq.\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestDictListsKeysInLoopOrder(t *testing.T) {
+	source := `import io from std::io
+import dict from std::dict
+let m: map = {"kiwi": 1, "apple": 2, "fig": 3, "date": 4, "banana": 5, "cherry": 6, "elder": 7}
+var looped: string = ""
+for (k in m) { looped = looped + k + " " }
+io.print(looped)
+io.print(dict.keys(m))
+io.print(dict.values(m))
+io.print(dict.entries(m)[0])
+`
+	for run := 0; run < 5; run++ {
+		var out strings.Builder
+		if err := RunSource(source, RunOptions{Stdout: &out}); err != nil {
+			t.Fatal(err)
+		}
+		keys := `["apple", "banana", "cherry", "date", "elder", "fig", "kiwi"]`
+		if want := "apple banana cherry date elder fig kiwi \n" + keys + "\n[2, 5, 6, 4, 7, 3, 1]\n(\"apple\", 2)\n"; out.String() != want {
+			t.Fatalf("got %q, want %q", out.String(), want)
+		}
+	}
+}
+
+func TestQuotasStopTheRun(t *testing.T) {
+	dir := filepath.ToSlash(t.TempDir())
+	os.WriteFile(dir+"/big.txt", []byte(strings.Repeat("x", 1000)), 0644)
+	for _, tc := range []struct {
+		name     string
+		source   string
+		opts     RunOptions
+		resource string
+		// written is a file the run writes, which must stay within the quota.
+		written string
+	}{
+		{"memory", `var s: string = "x"
+while (true) { try { s = s + s } catch (e) { } }`, RunOptions{MaxMemory: 1 << 16}, "memory", ""},
+		{"output", `import io from std::io
+while (true) { try { io.print("spam") } catch (e) { } }`, RunOptions{MaxOutput: 100}, "output", ""},
+		{"log file", `import log from std::log
+log.toFile("` + dir + `/run.log")
+while (true) { try { log.info("spam") } catch (e) { } }`, RunOptions{MaxOutput: 100}, "output", dir + "/run.log"},
+		{"csv", `import df from std::dataframe
+let frame: any = df.fromRecords([{"name": "` + strings.Repeat("x", 200) + `"}])
+while (true) { try { df.writeCSV(frame, "` + dir + `/out.csv") } catch (e) { } }`, RunOptions{MaxOutput: 100}, "output", dir + "/out.csv"},
+		{"copy", `import file from std::file
+while (true) { try { file.copy("` + dir + `/big.txt", "` + dir + `/copy.txt") } catch (e) { } }`, RunOptions{MaxOutput: 100}, "output", dir + "/copy.txt"},
+		{"repeat", `import text from std::text
+let s: string = text.repeat("abc", 1000000000)`, RunOptions{MaxMemory: 1 << 16}, "memory", ""},
+		{"pad", `import text from std::text
+let s: string = text.padStart("x", 1000000000, "ab")`, RunOptions{MaxMemory: 1 << 16}, "memory", ""},
+		{"format", `import text from std::text
+let s: string = text.format("%900000d", 1)`, RunOptions{MaxMemory: 1 << 16}, "memory", ""},
+		{"replaceAll", `import text from std::text
+let s: string = text.replaceAll("` + strings.Repeat("x", 1000) + `", "x", "` + strings.Repeat("y", 1000) + `")`, RunOptions{MaxMemory: 1 << 16}, "memory", ""},
+		{"matrix", `import matrix from std::matrix
+let m: any = matrix.zeros(100000, 100000)`, RunOptions{MaxMemory: 1 << 16}, "memory", ""},
+	} {
+		var out strings.Builder
+		tc.opts.Stdout = &out
+		err := RunSource(tc.source, tc.opts)
+		var quota *QuotaError
+		if !errors.As(err, &quota) || quota.Resource != tc.resource {
+			t.Errorf("%s: got %v, want a %s quota error", tc.name, err, tc.resource)
+		}
+		if out.Len() > 100 {
+			t.Errorf("%s: wrote %d bytes past the quota", tc.name, out.Len())
+		}
+		if info, err := os.Stat(tc.written); err == nil && info.Size() > 100 {
+			t.Errorf("%s: wrote %d bytes to %s past the quota", tc.name, info.Size(), tc.written)
+		}
+	}
+}
+
+func TestImportInstalledPackages(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"main.str": `import io from std::io
+import colors from colors
+import lib from "@corp/lib"
+io.print(colors.red("hi") + lib.name)
+`,
+		".strata/packages/colors/package.json": `{"name": "colors", "main": "src/colors.str"}`,
+		".strata/packages/colors/src/colors.str": `import ansi from ansi
+func red(s: string) => string {
+  return ansi.wrap(31, s)
+}
+`,
+		".strata/packages/ansi/index.str": `func wrap(code: int, s: string) => string {
+  return "<" + code + ">" + s
+}
+`,
+		".strata/packages/@corp/lib/index.str": `let name: string = "!"
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+	project, err := LoadProject(filepath.Join(root, "main.str"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(project.Order) != 4 {
+		t.Errorf("loaded %v, want the entry and three package modules", project.Order)
+	}
+	var out strings.Builder
+	interp := NewInterpreter()
+	RunOptions{Stdout: &out}.Configure(interp)
+	interp.UseProject(project)
+	if err := interp.Interpret(project.EntryModule().Statements); err != nil {
+		t.Fatal(err)
+	}
+	if want := "<31>hi!\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestExceptionsPropagateAcrossCalls(t *testing.T) {
+	source := `import io from std::io
+var trail: string = ""
+func inner(n: int) => int {
+  try {
+    if (n > 1) { throw "too big: " + n }
+    return n
+  } finally {
+    trail = trail + "inner " + n + ";"
+  }
+}
+func outer(n: int) => int {
+  return inner(n) * 10
+}
+try {
+  io.print(outer(1))
+  io.print(outer(5))
+  io.print("unreachable")
+} catch (e) {
+  io.print("caught " + e)
+} finally {
+  io.print("finally")
+}
+io.print(trail)
+try {
+  let z: int = 1 % 0
+} catch (e) {
+  io.print("runtime error caught")
+}
+func rethrow() => void {
+  try { throw "first" } catch (e) { throw e + " again" }
+}
+try { rethrow() } catch (e) { io.print(e) }
+throw "uncaught"
+`
+	var out strings.Builder
+	err := RunSource(source, RunOptions{Stdout: &out})
+	if want := "10\ncaught too big: 5\nfinally\ninner 1;inner 5;\nruntime error caught\nfirst again\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+	var thrown *ThrownError
+	if !errors.As(err, &thrown) || thrown.Value != "uncaught" {
+		t.Errorf("got %v, want the uncaught exception", err)
+	}
+}
+
+func TestResultPropagationOperator(t *testing.T) {
+	source := `import io from std::io
+var reached: int = 0
+func parse(s: string) => result<int, string> {
+  if (s == "") { return Err("empty") }
+  return Ok(strlen(s))
+}
+func total(a: string, b: string) => result<int, string> {
+  let x: int = parse(a)?
+  let y: int = parse(b)?
+  reached = reached + 1
+  return Ok(x + y)
+}
+func first(xs: list) => option<any> {
+  if (len(xs) == 0) { return None }
+  return Some(xs[0])
+}
+io.print(total("ab", "cde"))
+io.print(total("ab", ""))
+io.print(reached)
+match (total("", "x")) {
+  Ok(n) => { io.print("sum " + n) }
+  Err(e) => { io.print("error " + e) }
+}
+match (first([])) {
+  Some(v) => { io.print(v) }
+  None => { io.print("nothing") }
+}
+io.print(first([7]))
+`
+	var out strings.Builder
+	if err := RunSource(source, RunOptions{Stdout: &out}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Ok(5)\nErr(\"empty\")\n1\nerror empty\nnothing\nSome(7)\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestEnumPayloadsMatch(t *testing.T) {
+	source := `import io from std::io
+enum Shape { Circle(float), Rect(float, float), Empty }
+func area(s: Shape) => float {
+  match (s) {
+    Shape.Circle(r) => { return 3.0 * r * r }
+    Shape.Rect(w, h) => { return w * h }
+    Shape.Empty => { return 0.0 }
+  }
+  return 0.0
+}
+io.print(area(Shape.Circle(2.0)))
+io.print(area(Shape.Rect(2.0, 3.5)))
+io.print(area(Shape.Empty))
+io.print(Shape.Rect(1.0, 2.0) == Shape.Rect(1.0, 2.0))
+io.print(Shape.Rect(1.0, 2.0) == Shape.Rect(2.0, 1.0))
+io.print(Shape.Circle(1.5))
+`
+	var out strings.Builder
+	if err := RunSource(source, RunOptions{Stdout: &out}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "12\n7\n0\ntrue\nfalse\nShape.Circle(1.5)\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+
+	for _, tc := range []struct {
+		source string
+		code   ErrorCode
+	}{
+		{"enum Shape { Circle(float) }\nlet s: Shape = Shape.Circle(1.0, 2.0)", ErrArity},
+		{"enum Shape { Circle(float) }\nlet s: Shape = Shape.Square", ErrUndefined},
+		{"enum Shape { Circle(float) }\nlet s: Shape = Shape.Circle(\"big\")", ErrTypeMismatch},
+	} {
+		if err := RunSource(tc.source, RunOptions{}); errorCode(err) != tc.code {
+			t.Errorf("%q: got %v, want code %s", tc.source, err, tc.code)
+		}
+	}
+}
+
+// errorCode is the code of err, or of the first diagnostic it lists.
+func errorCode(err error) ErrorCode {
+	var diags Diagnostics
+	if errors.As(err, &diags) && len(diags) > 0 {
+		return diags[0].Code
+	}
+	var diag *StrataError
+	if errors.As(err, &diag) {
+		return diag.Code
+	}
+	return ""
+}
+
+func TestCallSignaturesAreChecked(t *testing.T) {
+	add := "func add(a: int, b: int) => int { return a + b }\n"
+	for _, tc := range []struct {
+		source, message string
+		code            ErrorCode
+		line, column    int
+	}{
+		{add + "add(1)", "add expects 2 argument(s), got 1", ErrArity, 2, 1},
+		{add + "let s: string = add(1, 2)", "expected string, got int", ErrTypeMismatch, 2, 17},
+		{add + "add(1, \"two\")", "argument 2 of add: type mismatch: expected int, got string", ErrTypeMismatch, 2, 8},
+		{"let n: int = strlen(5)", "argument 1 of strlen", ErrTypeMismatch, 1, 21},
+		{"let n: int = len()", "len expects 1 argument(s), got 0", ErrArity, 1, 14},
+	} {
+		err := RunSource(tc.source, RunOptions{})
+		var diags Diagnostics
+		if !errors.As(err, &diags) || errorCode(err) != tc.code || !strings.Contains(diags[0].Message, tc.message) {
+			t.Errorf("%q: got %v, want %s %q", tc.source, err, tc.code, tc.message)
+			continue
+		}
+		if loc := diags[0].Location; loc.Line != tc.line || loc.Column != tc.column {
+			t.Errorf("%q: error at %d:%d, want %d:%d", tc.source, loc.Line, loc.Column, tc.line, tc.column)
+		}
+	}
+	if err := RunSource(add+"let n: int = add(1, 2) + add(...[3, 4])", RunOptions{}); err != nil {
+		t.Errorf("well-typed calls gave %v", err)
+	}
+}
+
+func TestTypedEquality(t *testing.T) {
+	source := `import io from std::io
+io.print(1 == "1")
+io.print(1 == 1.0)
+io.print("a" != "a")
+io.print(true == 1)
+io.print([1, [2, "x"]] == [1, [2, "x"]])
+io.print([1, 2] == [2, 1])
+io.print({"a": [1], "b": 2} == {"b": 2, "a": [1]})
+io.print({"a": 1} == {"a": "1"})
+io.print(null == null)
+io.print(null == 0)
+`
+	var out strings.Builder
+	if err := RunSource(source, RunOptions{Stdout: &out}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "false\ntrue\nfalse\nfalse\ntrue\nfalse\ntrue\nfalse\ntrue\nfalse\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestSizedIntegerArithmeticIsRangeChecked(t *testing.T) {
+	source := `import io from std::io
+let a: u8 = 0
+let b: u8 = 200
+let c: i8 = 100
+func dec(x: u8) => int {
+  return x - 1
+}
+try { io.print(a - 1) } catch (e) { io.print(e) }
+try { io.print(b + b) } catch (e) { io.print(e) }
+try { io.print(c * 2) } catch (e) { io.print(e) }
+try { io.print(dec(a)) } catch (e) { io.print(e) }
+io.print(b - 100 + 1)
+io.print(-c)
+try { io.print(abs(-9223372036854775807 - 1)) } catch (e) { io.print(e) }
+try { io.print(-(-9223372036854775807 - 1)) } catch (e) { io.print(e) }
+`
+	var out strings.Builder
+	if err := RunSource(source, RunOptions{Stdout: &out}); err != nil {
+		t.Fatal(err)
+	}
+	want := "value -1 overflows u8\nvalue 400 overflows u8\nvalue 200 overflows i8\nvalue -1 overflows u8\n101\n-100\n" +
+		"integer overflow: abs(-9223372036854775808)\ninteger overflow: -(-9223372036854775808)\n"
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+	err := RunSource("let x: u64 = 18446744073709551615\n", RunOptions{})
+	var diags Diagnostics
+	if !errors.As(err, &diags) || len(diags) != 1 || !strings.Contains(diags[0].Hint, "u64 included") {
+		t.Errorf("a u64 literal past int64 gave %v, want it rejected with a hint", err)
+	}
+}
+
+func TestRecursionDepthLimit(t *testing.T) {
+	source := `import io from std::io
+func down(n: int) => int {
+  return down(n + 1)
+}
+try {
+  down(0)
+} catch (e) {
+  io.print("caught")
+}
+`
+	var out strings.Builder
+	err := RunSource(source, RunOptions{Stdout: &out, MaxDepth: 50})
+	var limit *LimitError
+	if !errors.As(err, &limit) || limit.Message != "maximum recursion depth exceeded (50 calls)" {
+		t.Fatalf("got %v, want the recursion limit", err)
+	}
+	if out.Len() > 0 {
+		t.Errorf("the limit was caught: %q", out.String())
+	}
+	var runtime *RuntimeError
+	if !errors.As(err, &runtime) {
+		t.Fatalf("got %T, want a located error with its call stack", err)
+	}
+	if len(runtime.CallStack) != 50 || runtime.CallStack[0].Function != "down" {
+		t.Errorf("got a call stack of %d frames", len(runtime.CallStack))
+	}
+}
+
+func TestListLiterals(t *testing.T) {
+	source := `import io from std::io
+var xs: list<int> = [1, 2, 3]
+io.print(xs[0])
+io.print(len(xs))
+xs[1] = 20
+io.print(xs)
+let nested: list = [[1, 2], [], ["a", true]]
+io.print(nested[2][0])
+io.print(len(nested[1]))
+`
+	var out strings.Builder
+	if err := RunSource(source, RunOptions{Stdout: &out}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "1\n3\n[1, 20, 3]\na\n0\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+	for src, message := range map[string]string{
+		"let xs: list<int> = [1, \"two\"]":               "type mismatch: expected int, got string",
+		"let xs: list<int> = [1, 2]\nlet n: int = xs[2]": "index 2 out of range for array of length 2",
+	} {
+		if err := RunSource(src, RunOptions{Stdout: &out}); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("%q gave %v, want %q", src, err, message)
+		}
+	}
+}
+
+func TestMapLiterals(t *testing.T) {
+	source := `import io from std::io
+var m: map<string, int> = {"a": 1, "b": 2}
+io.print(m["a"])
+m["c"] = 3
+m["a"] = m["a"] + 10
+io.print(m)
+io.print(len(m))
+let nested: map = {"inner": {"x": [1, 2]}}
+io.print(nested["inner"]["x"][1])
+io.print(m["missing"])
+`
+	var out strings.Builder
+	if err := RunSource(source, RunOptions{Stdout: &out}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "1\n{\"a\": 11, \"b\": 2, \"c\": 3}\n3\n2\nnull\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+	for src, message := range map[string]string{
+		"let m: map<string, int> = {\"a\": \"x\"}": "type mismatch: expected int, got string",
+		"let m: map = {a: 1}":                      "map keys must be string literals",
+	} {
+		if err := RunSource(src, RunOptions{Stdout: &out}); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("%q gave %v, want %q", src, err, message)
+		}
+	}
+}
+
+func TestFunctionsAreValues(t *testing.T) {
+	source := `import io from std::io
+func double(n: int) => int { return n * 2 }
+func inc(n: int) => int { return n + 1 }
+func apply(f: any, n: int) => int { return f(n) }
+func twice(f: any) => any {
+  func run(n: int) => int { return f(f(n)) }
+  return run
+}
+let g: any = double
+io.print(g(4))
+io.print(apply(inc, 1))
+let fs: list = [double, inc]
+io.print(fs[1](10))
+let ops: map = {"d": double}
+io.print(ops["d"](7))
+io.print(twice(double)(3))
+io.print(double)
+`
+	var out strings.Builder
+	if err := RunSource(source, RunOptions{Stdout: &out}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "8\n2\n11\n14\n12\n<func double>\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+	if err := RunSource("let x: any = 1\nlet y: any = x(2)\n", RunOptions{Stdout: &out}); err == nil || !strings.Contains(err.Error(), "not a function: int") {
+		t.Errorf("calling an int gave %v", err)
+	}
+}
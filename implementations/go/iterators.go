@@ -0,0 +1,246 @@
+package strata
+
+import "unicode/utf8"
+
+// ============================================================================
+// ITERATORS - The protocol for-in loops consume
+// ============================================================================
+
+// `for (x in xs) { ... }` asks xs for an iterator and binds x to each value
+// it yields. Lists, tuples and bytes yield their items, strings their
+// characters, maps their keys in sorted order, file handles their lines and
+// channels what they receive until closed. range(a, b) in a for-in header
+// counts without building the list.
+//
+// An object is iterable when its class has an iter() method returning an
+// iterator, or is an iterator itself when it has next(). next returns
+// Some(value) or None, or a map {value, done}. iter(xs) returns the
+// built-in iterator over any iterable value, whose next returns an option,
+// so a class can hand out the iterator of the list it wraps.
+
+// Iterator yields values until ok is false.
+type Iterator interface {
+	Next() (value interface{}, ok bool, err error)
+}
+
+type listIterator struct {
+	items []interface{}
+	pos   int
+}
+
+func (it *listIterator) Next() (interface{}, bool, error) {
+	if it.pos >= len(it.items) {
+		return nil, false, nil
+	}
+	it.pos++
+	return it.items[it.pos-1], true, nil
+}
+
+type stringIterator struct {
+	s   string
+	pos int
+}
+
+func (it *stringIterator) Next() (interface{}, bool, error) {
+	if it.pos >= len(it.s) {
+		return nil, false, nil
+	}
+	r, size := utf8.DecodeRuneInString(it.s[it.pos:])
+	it.pos += size
+	return string(r), true, nil
+}
+
+type rangeIterator struct {
+	next, end int64
+}
+
+func (it *rangeIterator) Next() (interface{}, bool, error) {
+	if it.next >= it.end {
+		return nil, false, nil
+	}
+	it.next++
+	return it.next - 1, true, nil
+}
+
+// funcIterator adapts a function such as a file's readLine that returns
+// null once exhausted.
+type funcIterator func() (interface{}, error)
+
+func (f funcIterator) Next() (interface{}, bool, error) {
+	value, err := f()
+	return value, value != nil && err == nil, err
+}
+
+// objectIterator calls the next method of a Strata object.
+type objectIterator struct {
+	i    *Interpreter
+	next interface{}
+	name string
+}
+
+func (it *objectIterator) Next() (interface{}, bool, error) {
+	result, err := it.i.callValue(it.name+".next", it.next, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	switch r := result.(type) {
+	case Variant:
+		switch r.Tag {
+		case "Some":
+			return r.Value, true, nil
+		case "None":
+			return nil, false, nil
+		}
+	case map[string]interface{}:
+		if done, ok := r["done"].(bool); ok {
+			return r["value"], !done, nil
+		}
+	}
+	return nil, false, newError(ErrTypeMismatch, "%s.next must return an option or {value, done}, got %s", it.name, describeValue(result))
+}
+
+// IteratorValue is the Strata value iter() returns. Its next method returns
+// Some(value) or None.
+type IteratorValue struct {
+	it Iterator
+}
+
+func (v *IteratorValue) String() string {
+	return "<iterator>"
+}
+
+func (v *IteratorValue) member(name string) (interface{}, error) {
+	if name != "next" {
+		return nil, newError(ErrUndefined, "iterator has no member %s", name)
+	}
+	return NativeFunc(func(args []interface{}) (interface{}, error) {
+		value, ok, err := v.it.Next()
+		if err != nil || !ok {
+			return Variant{Tag: "None"}, err
+		}
+		return Variant{Tag: "Some", Value: value}, nil
+	}), nil
+}
+
+// iterate returns an iterator over value, or an error if it has none.
+func (i *Interpreter) iterate(value interface{}) (Iterator, error) {
+	switch v := value.(type) {
+	case *IteratorValue:
+		return v.it, nil
+	case []interface{}:
+		return &listIterator{items: v}, nil
+	case Tuple:
+		return &listIterator{items: v}, nil
+	case []string:
+		items := make([]interface{}, len(v))
+		for idx, s := range v {
+			items[idx] = s
+		}
+		return &listIterator{items: items}, nil
+	case Bytes:
+		items := make([]interface{}, len(v))
+		for idx, b := range v {
+			items[idx] = int64(b)
+		}
+		return &listIterator{items: items}, nil
+	case string:
+		return &stringIterator{s: v}, nil
+	case map[string]interface{}:
+		keys := i.iterationKeys(v)
+		items := make([]interface{}, len(keys))
+		for idx, key := range keys {
+			items[idx] = key
+		}
+		return &listIterator{items: items}, nil
+	case *FileHandle:
+		return funcIterator(func() (interface{}, error) {
+			if v.closed {
+				return nil, nil
+			}
+			return v.readLine(nil)
+		}), nil
+	case *Channel:
+		return funcIterator(func() (interface{}, error) {
+			return v.receive(i.tasks)
+		}), nil
+	case *Instance:
+		if method, ok := v.Class.Methods["next"]; ok {
+			return &objectIterator{i: i, next: v.bind(method), name: v.Class.Name}, nil
+		}
+		if method, ok := v.Class.Methods["iter"]; ok {
+			it, err := i.callValue(v.Class.Name+".iter", v.bind(method), nil)
+			if err != nil {
+				return nil, err
+			}
+			if inner, ok := it.(*Instance); ok && inner == v {
+				return nil, newError(ErrTypeMismatch, "%s.iter returned the object itself, which has no next method", v.Class.Name)
+			}
+			return i.iterate(it)
+		}
+	}
+	return nil, newError(ErrTypeMismatch, "%s is not iterable", describeValue(value)).withHint("iterate a list, string, map, file, channel or an object with iter() or next()")
+}
+
+// interpretForIn runs `for (name in iterable) { ... } else { ... }`. The
+// loop variable lives in the enclosing scope, as one declared in the
+// initializer of a counting for loop does.
+func (i *Interpreter) interpretForIn(stmt *Stmt) error {
+	it, err := i.forInIterator(stmt.Value)
+	if err != nil {
+		return i.locate(err, stmt.Value.Location)
+	}
+	for {
+		if err := i.step(); err != nil {
+			return err
+		}
+		value, ok, err := it.Next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		i.Env.Set(stmt.Name, value, false)
+		if stop, err := i.runLoopBody(stmt.Body); stop || err != nil {
+			return err
+		}
+	}
+	return i.runBlock(stmt.Else)
+}
+
+// forInIterator evaluates the iterable of a for-in loop, counting a call of
+// the range builtin lazily.
+func (i *Interpreter) forInIterator(expr *Expr) (Iterator, error) {
+	if expr.Kind == ExprCall && expr.Func.Kind == ExprIdentifier && expr.Func.Name == "range" && len(expr.Args) == 2 && i.Env.lookup("range") == nil {
+		bounds, err := i.evaluateArgs(expr.Args)
+		if err != nil {
+			return nil, err
+		}
+		return &rangeIterator{next: toInt(bounds[0]), end: toInt(bounds[1])}, nil
+	}
+	value, err := i.evaluateExpression(expr)
+	if err != nil {
+		return nil, err
+	}
+	return i.iterate(value)
+}
+
+// iteratedType is the type of the values a for-in loop over t binds.
+func iteratedType(t TypeDef) TypeDef {
+	switch t.Primitive {
+	case TypeString:
+		return t
+	case TypeList, TypeArray, TypeSet:
+		if t.InnerType != nil {
+			return *t.InnerType
+		}
+	case TypeMap, TypeDict:
+		if len(t.Types) == 2 {
+			return t.Types[0]
+		}
+		return TypeDef{Kind: KindPrimitive, Primitive: TypeString}
+	case TypeBytes:
+		return TypeDef{Kind: KindPrimitive, Primitive: TypeInt}
+	}
+	return TypeDef{Kind: KindPrimitive, Primitive: TypeAny}
+}
@@ -0,0 +1,634 @@
+package strata
+
+import (
+	_ "embed"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ============================================================================
+// JS GENERATOR - Translating programs to JavaScript modules
+// ============================================================================
+
+// JSGenerator translates a program to an ES module for browsers and Node.
+// Functions, classes and control flow map onto their JavaScript
+// counterparts one to one, so the output reads much like the source. What
+// JavaScript does differently goes through runtime/strata_runtime.js, which
+// the module imports as strata: printing and comparing lists and maps,
+// integer division, checked indexing and the builtins, and the io, math and
+// text modules.
+//
+// Strata variables live until the end of their function, not their block,
+// so those first declared inside a nested block are declared with let at the
+// top of the function. Statements with no JavaScript equivalent are left as
+// comments saying so, and such expressions throw when evaluated.
+//
+// Ints are JavaScript numbers, which hold integers exactly only up to 2^53.
+// Int literals past that are rejected, and +, - and * on ints go through
+// strata.int, which throws an overflow error where a result leaves that
+// range instead of printing a rounded number.
+type JSGenerator struct {
+	// classes are the classes the program declares, called with new.
+	classes map[string]bool
+	// declared holds the variables of the function being generated
+	// declared so far, and counts how often each is declared in it.
+	declared map[string]bool
+	counts   map[string]int
+	emitter
+	codegenScope
+}
+
+//go:embed runtime/strata_runtime.js
+var jsRuntimeSource string
+
+// JSRuntimeFiles returns the runtime library generated JavaScript imports,
+// by file name.
+func JSRuntimeFiles() map[string]string {
+	return map[string]string{"strata_runtime.js": jsRuntimeSource}
+}
+
+// jsBuiltins are the builtins the JavaScript runtime provides.
+var jsBuiltins = map[string]bool{
+	"strlen": true, "len": true, "substr": true, "toUpperCase": true, "toLowerCase": true,
+	"trim": true, "split": true, "join": true, "startsWith": true, "endsWith": true,
+	"includes": true, "indexOf": true, "replace": true, "replaceAll": true, "repeat": true,
+	"toString": true, "parseInt": true, "parseFloat": true, "range": true, "typeof": true,
+	"abs": true, "sqrt": true, "pow": true, "sin": true, "cos": true, "tan": true,
+	"asin": true, "acos": true, "atan": true, "atan2": true, "exp": true, "log": true,
+	"log10": true, "log2": true, "floor": true, "ceil": true, "round": true, "trunc": true,
+	"max": true, "min": true,
+}
+
+// jsModules are the standard library modules the JavaScript runtime provides.
+var jsModules = map[string]string{"std::io": "io", "std::math": "math", "std::text": "text"}
+
+func NewJSGenerator() *JSGenerator {
+	g := &JSGenerator{}
+	g.emitter = newEmitter("js", g, loopFlags{name: "$broke%d", declare: "let %s = false;", set: "%s = true;"})
+	return g
+}
+
+// Generate returns the module for a program, or the first construct the
+// JavaScript target cannot express.
+func (g *JSGenerator) Generate(statements []*Stmt) (string, error) {
+	g.reset()
+	g.enter(statements)
+	g.classes = make(map[string]bool)
+	collectClasses(statements, g.classes)
+	g.declareVariables(statements)
+	g.code = append(g.code, "// Generated by strata build --target=js.")
+	g.code = append(g.code, `import * as strata from "./strata_runtime.js";`)
+	g.code = append(g.code, "")
+	g.declared, g.counts = make(map[string]bool), make(map[string]int)
+	g.body(statements)
+	for len(g.code) > 0 && g.code[len(g.code)-1] == "" {
+		g.code = g.code[:len(g.code)-1]
+	}
+	if g.err != nil {
+		return "", g.err
+	}
+	return strings.Join(g.code, "\n"), nil
+}
+
+// collectClasses records the names of the classes statements declare.
+func collectClasses(statements []*Stmt, classes map[string]bool) {
+	for _, stmt := range statements {
+		if stmt == nil {
+			continue
+		}
+		if stmt.Kind == StmtClass {
+			classes[stmt.Name] = true
+		}
+		collectClasses(stmt.Then, classes)
+		collectClasses(stmt.Else, classes)
+		collectClasses(stmt.Body, classes)
+		collectClasses(stmt.Catch, classes)
+		collectClasses(stmt.Finally, classes)
+	}
+}
+
+// blank separates declarations at the top level with an empty line.
+func (g *JSGenerator) blank() {
+	if g.indent == 0 && len(g.code) > 0 && g.code[len(g.code)-1] != "" {
+		g.code = append(g.code, "")
+	}
+}
+
+// body generates the statements of a function or the program, first
+// declaring the variables they declare in nested blocks.
+func (g *JSGenerator) body(statements []*Stmt) {
+	var hoisted []string
+	var walk func(statements []*Stmt, nested bool)
+	walk = func(statements []*Stmt, nested bool) {
+		for _, stmt := range statements {
+			if stmt == nil {
+				continue
+			}
+			switch stmt.Kind {
+			case StmtLet:
+				for _, name := range letNames(stmt) {
+					g.counts[name]++
+					if nested && !g.declared[name] {
+						g.declared[name] = true
+						hoisted = append(hoisted, name)
+					}
+				}
+			case StmtForIn:
+				// The loop variable outlives the loop.
+				if !g.declared[stmt.Name] {
+					g.declared[stmt.Name] = true
+					hoisted = append(hoisted, stmt.Name)
+				}
+			case StmtFunction, StmtClass:
+				continue
+			}
+			if stmt.Init != nil {
+				walk([]*Stmt{stmt.Init}, nested)
+			}
+			walk(stmt.Then, true)
+			walk(stmt.Else, true)
+			walk(stmt.Body, true)
+			walk(stmt.Catch, true)
+			walk(stmt.Finally, true)
+		}
+	}
+	walk(statements, false)
+	imports := 0
+	for imports < len(statements) && statements[imports] != nil && statements[imports].Kind == StmtImport {
+		g.generateStatement(statements[imports])
+		imports++
+	}
+	if len(hoisted) > 0 {
+		g.line("let %s;", strings.Join(hoisted, ", "))
+	}
+	for _, stmt := range statements[imports:] {
+		g.generateStatement(stmt)
+	}
+}
+
+// letNames are the variables a let statement declares.
+func letNames(stmt *Stmt) []string {
+	if stmt.Names != nil {
+		return stmt.Names
+	}
+	return []string{stmt.Name}
+}
+
+// function generates a function declaration, or a method when method is
+// set. Nested functions see the variables of those around them.
+func (g *JSGenerator) function(fn *Stmt, method bool) {
+	locals, declared, counts := g.locals, g.declared, g.counts
+	g.locals = make(map[string]TypeDef)
+	for name, t := range locals {
+		g.locals[name] = t
+	}
+	g.declared, g.counts = make(map[string]bool), make(map[string]int)
+	params := make([]string, len(fn.Params))
+	for idx, p := range fn.Params {
+		g.locals[p.Name] = p.Type
+		g.declared[p.Name] = true
+		params[idx] = p.Name
+		if p.Variadic {
+			params[idx] = "..." + p.Name
+		}
+	}
+	g.declareVariables(fn.Body)
+
+	keyword := "function "
+	if method {
+		keyword = ""
+	}
+	if fn.Async {
+		keyword = "async " + keyword
+	}
+	g.line("%s%s(%s) {", keyword, fn.Name, strings.Join(params, ", "))
+	g.indent++
+	g.body(fn.Body)
+	g.indent--
+	g.line("}")
+	g.locals, g.declared, g.counts = locals, declared, counts
+}
+
+// class generates a class. Fields are set in the constructor, which passes
+// its arguments on to init.
+func (g *JSGenerator) class(stmt *Stmt) {
+	var fields, methods []*Stmt
+	hasInit := false
+	for _, member := range stmt.Body {
+		if member.Kind == StmtFunction {
+			methods = append(methods, member)
+			hasInit = hasInit || member.Name == "init"
+		} else {
+			fields = append(fields, member)
+		}
+	}
+	g.line("class %s {", stmt.Name)
+	g.indent++
+	if len(fields) > 0 || hasInit {
+		params := ""
+		if hasInit {
+			params = "...args"
+		}
+		g.line("constructor(%s) {", params)
+		g.indent++
+		for _, field := range fields {
+			g.line("this.%s = %s;", field.Name, g.initialValue(field))
+		}
+		if hasInit {
+			g.line("this.init(...args);")
+		}
+		g.indent--
+		g.line("}")
+	}
+	for _, method := range methods {
+		g.function(method, true)
+	}
+	g.indent--
+	g.line("}")
+}
+
+// initialValue is the value a let statement initializes its variable to.
+func (g *JSGenerator) initialValue(stmt *Stmt) string {
+	if stmt.Value != nil {
+		return g.generateExpression(stmt.Value)
+	}
+	switch jsKind(stmt.Type) {
+	case "int", "float":
+		return "0"
+	case "bool":
+		return "false"
+	case "string":
+		return `""`
+	}
+	return "null"
+}
+
+func (g *JSGenerator) generateStatement(stmt *Stmt) {
+	if stmt == nil {
+		return
+	}
+	defer g.track(stmt.Location)()
+	switch stmt.Kind {
+	case StmtImport:
+		if name, ok := jsModules[stmt.Module]; ok {
+			g.line("const %s = strata.%s;", stmt.Name, name)
+			return
+		}
+		g.line("/* unsupported in JavaScript: import of %s */", stmt.Module)
+	case StmtFunction:
+		g.blank()
+		g.function(stmt, false)
+		g.blank()
+	case StmtClass:
+		g.blank()
+		g.class(stmt)
+		g.blank()
+	case StmtLet:
+		g.let(stmt)
+	case StmtAssignment:
+		g.line("%s;", g.assignment(stmt))
+	case StmtExpression:
+		expr := g.generateExpression(stmt.Expr)
+		if strings.HasPrefix(expr, "{") {
+			expr = "(" + expr + ")"
+		}
+		g.line("%s;", expr)
+	case StmtIf:
+		g.line("if (%s) {", g.generateExpression(stmt.Condition))
+		g.block(stmt.Then)
+		g.elseChain(stmt.Else)
+	case StmtWhile:
+		g.loop(stmt, func() {
+			g.line("while (%s) {", g.generateExpression(stmt.Condition))
+			g.block(stmt.Body)
+			g.line("}")
+		})
+	case StmtDoWhile:
+		g.loop(stmt, func() {
+			g.line("do {")
+			g.block(stmt.Body)
+			g.line("} while (%s);", g.generateExpression(stmt.Condition))
+		})
+	case StmtFor:
+		g.generateStatement(stmt.Init)
+		g.loop(stmt, func() {
+			g.line("for (; %s; %s) {", g.generateExpression(stmt.Condition), g.clause(stmt.Update))
+			g.block(stmt.Body)
+			g.line("}")
+		})
+	case StmtForIn:
+		g.loop(stmt, func() {
+			g.line("for (%s of strata.iterate(%s)) {", stmt.Name, g.generateExpression(stmt.Value))
+			g.block(stmt.Body)
+			g.line("}")
+		})
+	case StmtBreak:
+		g.breakLoop()
+	case StmtContinue:
+		g.line("continue;")
+	case StmtReturn:
+		if stmt.Value == nil {
+			g.line("return;")
+		} else {
+			g.line("return %s;", g.generateExpression(stmt.Value))
+		}
+	case StmtThrow:
+		g.line("throw %s;", g.generateExpression(stmt.Value))
+	case StmtTry:
+		g.line("try {")
+		g.block(stmt.Body)
+		if stmt.Catch != nil {
+			g.line("} catch ($thrown) {")
+			if stmt.CatchName != "" {
+				g.indent++
+				g.line("const %s = strata.caught($thrown);", stmt.CatchName)
+				g.indent--
+			}
+			g.block(stmt.Catch)
+		}
+		if stmt.Finally != nil {
+			g.line("} finally {")
+			g.block(stmt.Finally)
+		}
+		g.line("}")
+	default:
+		g.line("/* unsupported in JavaScript: %s statement */", stmt.Kind)
+	}
+}
+
+// let declares a variable where it is first declared at the top of a
+// function, as const when it is declared only there and never reassigned,
+// and assigns it elsewhere.
+func (g *JSGenerator) let(stmt *Stmt) {
+	target := stmt.Name
+	if stmt.Names != nil {
+		g.line("/* unsupported in JavaScript: destructuring let statement */")
+		return
+	}
+	value := g.initialValue(stmt)
+	if g.declared[target] {
+		g.line("%s = %s;", target, value)
+		return
+	}
+	g.declared[target] = true
+	keyword := "let"
+	if !stmt.Mutable && g.counts[target] <= 1 {
+		keyword = "const"
+	}
+	g.line("%s %s = %s;", keyword, target, value)
+}
+
+// assignment is an assignment statement as an expression.
+func (g *JSGenerator) assignment(stmt *Stmt) string {
+	value := g.generateExpression(stmt.Value)
+	target := stmt.TargetExpr
+	switch {
+	case target == nil:
+		return fmt.Sprintf("%s = %s", stmt.Target, value)
+	case target.Kind == ExprIndex:
+		return fmt.Sprintf("%s[%s] = %s", g.operand(target.Object), g.generateExpression(target.Index), value)
+	}
+	return fmt.Sprintf("%s = %s", g.generateExpression(target), value)
+}
+
+// jsKind classifies t as cKind does, but keeps unknown types apart, as
+// the JavaScript generator must not assume them to be ints.
+func jsKind(t TypeDef) string {
+	if t.Kind == "" {
+		return "unknown"
+	}
+	if t.Kind == KindPrimitive && (isIntegerType(t.Primitive) || isFloatType(t.Primitive)) {
+		if isFloatType(t.Primitive) {
+			return "float"
+		}
+		return "int"
+	}
+	return cKind(t)
+}
+
+// scalar reports whether values of kind compare and print the same in
+// JavaScript as in Strata.
+func scalar(kind string) bool {
+	return kind == "int" || kind == "bool" || kind == "string"
+}
+
+// operand generates expr for use as the operand of a postfix operator,
+// parenthesized unless it is a primary expression.
+func (g *JSGenerator) operand(expr *Expr) string {
+	code := g.generateExpression(expr)
+	switch expr.Kind {
+	case ExprBinary, ExprUnary, ExprAwait:
+		return "(" + code + ")"
+	}
+	return code
+}
+
+// side generates an operand of a binary operator op, parenthesized where
+// JavaScript would otherwise group it differently.
+func (g *JSGenerator) side(expr *Expr, op string, right bool) string {
+	code := g.generateExpression(expr)
+	if expr.Kind != ExprBinary || expr.Interpolated {
+		return code
+	}
+	prec, inner := binaryPrecedence(op), binaryPrecedence(expr.Op)
+	// JavaScript refuses ?? next to && or || without parentheses.
+	mixed := (op == "??") != (expr.Op == "??")
+	if inner < prec || (right && inner == prec) || mixed {
+		return "(" + code + ")"
+	}
+	return code
+}
+
+// text generates expr converted to a string, as print shows it.
+func (g *JSGenerator) text(expr *Expr) string {
+	code := g.generateExpression(expr)
+	if kind := jsKind(g.typeOf(expr)); kind == "string" || kind == "int" || kind == "bool" {
+		return code
+	}
+	return fmt.Sprintf("strata.str(%s)", code)
+}
+
+func (g *JSGenerator) binary(expr *Expr) string {
+	if expr.Interpolated {
+		return g.template(expr)
+	}
+	leftKind, rightKind := jsKind(g.typeOf(expr.Left)), jsKind(g.typeOf(expr.Right))
+	left, right := g.side(expr.Left, expr.Op, false), g.side(expr.Right, expr.Op, true)
+	switch expr.Op {
+	case "+":
+		if leftKind == "string" || rightKind == "string" {
+			if leftKind != "string" {
+				left = g.text(expr.Left)
+			}
+			if rightKind != "string" {
+				right = g.text(expr.Right)
+			}
+		}
+	case "==", "!=":
+		if !scalar(leftKind) && leftKind != "float" || !scalar(rightKind) && rightKind != "float" {
+			if expr.Op == "!=" {
+				return fmt.Sprintf("!strata.equal(%s, %s)", g.generateExpression(expr.Left), g.generateExpression(expr.Right))
+			}
+			return fmt.Sprintf("strata.equal(%s, %s)", g.generateExpression(expr.Left), g.generateExpression(expr.Right))
+		}
+		return fmt.Sprintf("%s %s= %s", left, expr.Op, right)
+	case "/":
+		switch {
+		case leftKind == "int" && rightKind == "int":
+			return fmt.Sprintf("strata.idiv(%s, %s)", g.generateExpression(expr.Left), g.generateExpression(expr.Right))
+		case leftKind != "float" && rightKind != "float":
+			// Unknown operands divide as ints when both are.
+			return fmt.Sprintf("strata.div(%s, %s)", g.generateExpression(expr.Left), g.generateExpression(expr.Right))
+		}
+	case "-", "*":
+		if leftKind == "int" && rightKind == "int" {
+			return fmt.Sprintf("strata.int(%s %s %s)", left, expr.Op, right)
+		}
+	}
+	if expr.Op == "+" && leftKind == "int" && rightKind == "int" {
+		return fmt.Sprintf("strata.int(%s + %s)", left, right)
+	}
+	return fmt.Sprintf("%s %s %s", left, expr.Op, right)
+}
+
+// template generates the concatenation built from an interpolated string
+// as a template literal.
+func (g *JSGenerator) template(expr *Expr) string {
+	var operands []*Expr
+	for ; expr.Kind == ExprBinary && expr.Interpolated; expr = expr.Left {
+		operands = append(operands, expr.Right)
+	}
+	operands = append(operands, expr)
+	var b strings.Builder
+	b.WriteByte('`')
+	for idx := len(operands) - 1; idx >= 0; idx-- {
+		if (len(operands)-1-idx)%2 == 0 {
+			text, _ := operands[idx].Value.(string)
+			b.WriteString(jsEscape(text, '`'))
+		} else {
+			b.WriteString("${" + g.text(operands[idx]) + "}")
+		}
+	}
+	b.WriteByte('`')
+	return b.String()
+}
+
+// jsString quotes s as a JavaScript string literal.
+func jsString(s string) string {
+	return `"` + jsEscape(s, '"') + `"`
+}
+
+// jsEscape escapes s for a literal quoted with quote, escaping ${ too in
+// template literals.
+func jsEscape(s string, quote byte) string {
+	var b strings.Builder
+	for idx := 0; idx < len(s); idx++ {
+		c := s[idx]
+		switch {
+		case c == quote || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '$' && quote == '`' && idx+1 < len(s) && s[idx+1] == '{':
+			b.WriteString(`\$`)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\t':
+			b.WriteString(`\t`)
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func (g *JSGenerator) arguments(args []*Expr) string {
+	code := make([]string, len(args))
+	for idx, arg := range args {
+		code[idx] = g.generateExpression(arg)
+	}
+	return strings.Join(code, ", ")
+}
+
+// maxSafeInteger is JavaScript's Number.MAX_SAFE_INTEGER, the largest
+// integer a number holds exactly.
+const maxSafeInteger = 1<<53 - 1
+
+func (g *JSGenerator) generateExpression(expr *Expr) string {
+	if expr == nil {
+		return ""
+	}
+	switch expr.Kind {
+	case ExprLiteral:
+		switch v := expr.Value.(type) {
+		case string:
+			return jsString(v)
+		case nil:
+			return "null"
+		case int64:
+			if v > maxSafeInteger || v < -maxSafeInteger {
+				return g.fail(expr.Location, "%d is beyond the integers a JavaScript number holds exactly (±%d)", v, int64(maxSafeInteger))
+			}
+		case float64:
+			return strconv.FormatFloat(v, 'g', -1, 64)
+		case complex128:
+			return `strata.unsupported("complex numbers")`
+		}
+		return fmt.Sprintf("%v", expr.Value)
+	case ExprIdentifier:
+		return expr.Name
+	case ExprBinary:
+		return g.binary(expr)
+	case ExprUnary:
+		operand := g.generateExpression(expr.Operand)
+		switch expr.Operand.Kind {
+		case ExprBinary, ExprUnary, ExprAwait:
+			operand = "(" + operand + ")"
+		}
+		return expr.Op + operand
+	case ExprAwait:
+		return "await " + g.operand(expr.Operand)
+	case ExprCall:
+		args := g.arguments(expr.Args)
+		if expr.Func.Kind == ExprIdentifier {
+			if _, shadowed := g.variable(expr.Func.Name); !shadowed && g.classes[expr.Func.Name] {
+				return fmt.Sprintf("new %s(%s)", expr.Func.Name, args)
+			}
+			if name := g.builtinName(expr); name != "" {
+				if !jsBuiltins[name] {
+					return fmt.Sprintf("strata.unsupported(%s)", jsString(name))
+				}
+				if name == "typeof" {
+					return fmt.Sprintf("strata.typeOf(%s)", args)
+				}
+				return fmt.Sprintf("strata.%s(%s)", name, args)
+			}
+		}
+		return fmt.Sprintf("%s(%s)", g.operand(expr.Func), args)
+	case ExprMember:
+		if expr.Optional {
+			return fmt.Sprintf("%s?.%s", g.operand(expr.Object), expr.Property)
+		}
+		return fmt.Sprintf("%s.%s", g.operand(expr.Object), expr.Property)
+	case ExprIndex:
+		return fmt.Sprintf("strata.index(%s, %s)", g.generateExpression(expr.Object), g.generateExpression(expr.Index))
+	case ExprSpread:
+		return "..." + g.operand(expr.Operand)
+	case ExprArray:
+		return "[" + g.arguments(expr.Elements) + "]"
+	case ExprMap:
+		if len(expr.Keys) == 0 {
+			return "{}"
+		}
+		entries := make([]string, len(expr.Keys))
+		for idx, key := range expr.Keys {
+			entries[idx] = jsString(key) + ": " + g.generateExpression(expr.Elements[idx])
+		}
+		return "{ " + strings.Join(entries, ", ") + " }"
+	}
+	return fmt.Sprintf("strata.unsupported(%s)", jsString(string(expr.Kind)+" expressions"))
+}
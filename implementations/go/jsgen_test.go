@@ -0,0 +1,153 @@
+package strata
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runJS runs a generated module with Node next to the runtime and returns
+// what it prints, skipping the test when Node is not installed.
+func runJS(t *testing.T, code string) string {
+	t.Helper()
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("no node")
+	}
+	dir := t.TempDir()
+	files := JSRuntimeFiles()
+	files["main.js"] = code
+	files["package.json"] = `{"type": "module"}`
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out, err := exec.Command(node, filepath.Join(dir, "main.js")).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v\n%s\n%s", err, out, code)
+	}
+	return string(out)
+}
+
+func TestJSGeneratorMatchesInterpreter(t *testing.T) {
+	source := `import io from std::io
+class Counter {
+  var count: int = 0
+  var label: string = "c"
+  func init(label: string) => void {
+    this.label = label
+  }
+  func add(n: int) => void {
+    this.count = this.count + n
+  }
+}
+func adder(n: int) => int {
+  func add(x: int) => int {
+    return x + n
+  }
+  return add(10)
+}
+let c: Counter = Counter("hits")
+c.add(3)
+c.add(4)
+io.print(c)
+io.print(adder(5))
+var total: int = 0
+for (var i: int = 0; i < 5; i = i + 1) {
+  let sq: int = i * i
+  total = total + sq
+}
+io.print("total ${total}, ${7 / 2} and ${7.0 / 2}")
+var words: list<string> = split("a b c", " ")
+for (w in words) {
+  if (w == "c") { break }
+  io.print(w + "!")
+} else {
+  io.print("not reached")
+}
+var m: map<string, int> = {"b": 2, "a": 1}
+m["c"] = 3
+io.print(m)
+io.print([1, [2]] == [1, [2]])
+try {
+  io.print(words[10])
+} catch (e) {
+  io.print("caught: " + e)
+}
+`
+	statements, err := ParseSource(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := NewJSGenerator().Generate(statements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"let sq, w;",
+		"const c = new Counter(\"hits\");",
+		"function adder(n) {\n    function add(x) {",
+		"`total ${total}, ${strata.idiv(7, 2)} and ${strata.str(7 / 2)}`",
+		"for (w of strata.iterate(words)) {",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code lacks %q:\n%s", want, code)
+		}
+	}
+	var want strings.Builder
+	if err := RunSource(source, RunOptions{Stdout: &want}); err != nil {
+		t.Fatal(err)
+	}
+	if got := runJS(t, code); got != want.String() {
+		t.Errorf("generated module printed\n%s\nthe interpreter\n%s\n%s", got, want.String(), code)
+	}
+}
+
+func TestJSGeneratorRejectsUnsafeIntegers(t *testing.T) {
+	source := `import io from std::io
+let limit: int = 9007199254740991
+io.print(limit)
+io.print(-9007199254740991)
+io.print(limit - 1 + 1)
+try { io.print(limit + 2) } catch (e) { io.print(e) }
+try { io.print(-limit * 3) } catch (e) { io.print(e) }
+`
+	statements, err := ParseSource(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := NewJSGenerator().Generate(statements)
+	if err != nil {
+		t.Fatalf("the largest safe integer was rejected: %v", err)
+	}
+	overflow := "integer overflow: the result is beyond the integers a JavaScript number holds exactly\n"
+	if got := runJS(t, code); got != "9007199254740991\n-9007199254740991\n9007199254740991\n"+overflow+overflow {
+		t.Errorf("generated module printed %q", got)
+	}
+
+	for _, tc := range []struct {
+		source       string
+		line, column int
+	}{
+		{"import io from std::io\nio.print(9007199254740993)\n", 2, 10},
+		{"let low: int = -9007199254740992\n", 1, 17},
+	} {
+		statements, err := ParseSource(tc.source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = NewJSGenerator().Generate(statements)
+		var diag *StrataError
+		if !errors.As(err, &diag) || !strings.Contains(diag.Message, "beyond the integers a JavaScript number holds exactly") {
+			t.Errorf("%q: got error %v", tc.source, err)
+			continue
+		}
+		if diag.Location.Line != tc.line || diag.Location.Column != tc.column {
+			t.Errorf("%q: error at %d:%d, want %d:%d", tc.source, diag.Location.Line, diag.Location.Column, tc.line, tc.column)
+		}
+	}
+}
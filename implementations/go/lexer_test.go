@@ -0,0 +1,321 @@
+package strata
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func tokenize(source string) []*Token {
+	lexer := NewLexer(source)
+	var tokens []*Token
+	for token := lexer.NextToken(); token != nil; token = lexer.NextToken() {
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+func TestLexerColumnsCountRunes(t *testing.T) {
+	tokens := tokenize("let s: string = \"héllo→\" + x")
+	want := []struct {
+		value  string
+		column int
+	}{
+		{"let", 1}, {"s", 5}, {":", 6}, {"string", 8}, {"=", 15},
+		{"héllo→", 17}, {"+", 26}, {"x", 28},
+	}
+	if len(tokens) != len(want) {
+		t.Fatalf("got %d tokens, want %d", len(tokens), len(want))
+	}
+	for idx, w := range want {
+		tok := tokens[idx]
+		if tok.Value != w.value || tok.Location.Column != w.column {
+			t.Errorf("token %d = %q at column %d, want %q at column %d",
+				idx, tok.Value, tok.Location.Column, w.value, w.column)
+		}
+	}
+	if end := tokens[5].Location.EndColumn; end != 25 {
+		t.Errorf("string literal ends at column %d, want 25", end)
+	}
+}
+
+func TestLexerUnicodeIdentifiers(t *testing.T) {
+	tokens := tokenize("let größe = 名前 + x٣ → _ñ")
+	want := []struct {
+		kind   TokenKind
+		value  string
+		column int
+	}{
+		{TokenKeyword, "let", 1}, {TokenIdent, "größe", 5}, {TokenOperator, "=", 11}, {TokenIdent, "名前", 13},
+		{TokenOperator, "+", 16}, {TokenIdent, "x٣", 18}, {TokenPunct, "→", 21}, {TokenIdent, "_ñ", 23},
+	}
+	if len(tokens) != len(want) {
+		t.Fatalf("got %d tokens, want %d", len(tokens), len(want))
+	}
+	for idx, w := range want {
+		tok := tokens[idx]
+		if tok.Kind != w.kind || tok.Value != w.value || tok.Location.Column != w.column {
+			t.Errorf("token %d = %s %q at column %d, want %s %q at column %d",
+				idx, tok.Kind, tok.Value, tok.Location.Column, w.kind, w.value, w.column)
+		}
+	}
+
+	var out strings.Builder
+	source := "import io from std::io\nfunc doppelt(größe: int) => int {\n  return größe * 2\n}\nlet 名前: string = \"日本\"\nio.print(名前 + toString(doppelt(21)))\n"
+	if err := RunSource(source, RunOptions{Stdout: &out}); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "日本42\n" {
+		t.Errorf("printed %q", out.String())
+	}
+}
+
+func TestLexerTokenKinds(t *testing.T) {
+	tokens := tokenize(`if (x >= 1.5) { io.print("if") }`)
+	want := []TokenKind{
+		TokenKeyword, TokenPunct, TokenIdent, TokenOperator, TokenNumber, TokenPunct,
+		TokenPunct, TokenIdent, TokenPunct, TokenIdent, TokenPunct, TokenString, TokenPunct, TokenPunct,
+	}
+	if len(tokens) != len(want) {
+		t.Fatalf("got %d tokens, want %d", len(tokens), len(want))
+	}
+	for idx, kind := range want {
+		if tokens[idx].Kind != kind {
+			t.Errorf("token %d (%q) is %s, want %s", idx, tokens[idx].Value, tokens[idx].Kind, kind)
+		}
+	}
+}
+
+func TestLexerSkipsShebang(t *testing.T) {
+	tokens := tokenize("#!/usr/bin/env strata\nlet x = 1")
+	if len(tokens) != 4 || tokens[0].Value != "let" || tokens[0].Location.Line != 2 {
+		t.Fatalf("got %d tokens starting with %q, want let on line 2", len(tokens), tokens[0].Value)
+	}
+}
+
+func TestLexerComments(t *testing.T) {
+	tokens := tokenize("let /* a /* nested */ comment */ x = 1 // done\n/// Adds one.\n///\n///   Indented.\n//// not a doc\nfunc f() {}")
+	var values []string
+	for _, tok := range tokens {
+		values = append(values, tok.Value)
+	}
+	if got := strings.Join(values, " "); got != "let x = 1 func f ( ) { }" {
+		t.Fatalf("got tokens %q", got)
+	}
+	if doc := tokens[4].Doc; doc != "Adds one.\n\n  Indented." {
+		t.Errorf("func has doc %q", doc)
+	}
+	if tokens[5].Doc != "" || tokens[0].Doc != "" {
+		t.Error("a doc comment attached to more than the token after it")
+	}
+
+	_, err := ParseSource("let x = 1\n/* never /* closed */\n")
+	var diag *StrataError
+	if !errors.As(err, &diag) || !strings.Contains(diag.Error(), "unterminated block comment") || diag.Location.Line != 2 {
+		t.Errorf("an unterminated comment gave %v", err)
+	}
+	if braceDepth("func f() { /* } */\n") != 1 || braceDepth("/* {\n") != 1 || braceDepth("// {\nlet x = 1\n") != 0 {
+		t.Error("the REPL counts braces in comments")
+	}
+}
+
+func TestNumericLiterals(t *testing.T) {
+	for source, want := range map[string]interface{}{
+		"0xFF": int64(255), "0o755": int64(493), "0b1010": int64(10), "1_000_000": int64(1000000),
+		"007": int64(7), "1.5e-3": 1.5e-3, "2E3": 2000.0, "1_0.2_5": 10.25, "2.5i": complex(0, 2.5),
+	} {
+		statements, err := ParseSource(source)
+		if err != nil {
+			t.Errorf("%s: %v", source, err)
+			continue
+		}
+		if got := statements[0].Expr.Value; got != want {
+			t.Errorf("%s is %#v, want %#v", source, got, want)
+		}
+	}
+	for source, want := range map[string]string{
+		"1.2.3": "invalid number 1.2.3", "0xG": "invalid number 0xG", "1__0": "_ must separate digits",
+		"9223372036854775808": "does not fit in 64 bits", "1e999": "too large",
+	} {
+		if _, err := ParseSource("let x: int = " + source); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s gave %v, want %q", source, err, want)
+		}
+	}
+}
+
+func TestCharLiteralsAndEscapes(t *testing.T) {
+	tokens := tokenize(`'a' '\n' '\u00e9' '\'' "q\u{1F600}\0\$\'" '{'`)
+	want := []string{"a", "\n", "é", "'", "q😀\x00$'", "{"}
+	if len(tokens) != len(want) {
+		t.Fatalf("got %d tokens, want %d", len(tokens), len(want))
+	}
+	for idx, value := range want {
+		if tokens[idx].Value != value {
+			t.Errorf("token %d is %q, want %q", idx, tokens[idx].Value, value)
+		}
+	}
+	if tokens[0].Kind != TokenChar || tokens[4].Kind != TokenString {
+		t.Errorf("kinds are %s and %s", tokens[0].Kind, tokens[4].Kind)
+	}
+	statements, err := ParseSource("let c: char = 'x'\nlet open: char = '{'\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := statements[0].Value; value.Value != "x" || value.Type.Primitive != TypeChar {
+		t.Errorf("'x' parsed as %#v", value)
+	}
+
+	for source, want := range map[string]string{
+		`let s: string = "a\qb"`:     "1:19: unknown escape sequence \\q",
+		`let s: string = "\u12"`:     "invalid unicode escape",
+		`let s: string = "\u{D800}"`: "U+D800 is not a character",
+		`let c: char = ''`:           "empty character literal",
+		`let c: char = 'ab'`:         "holds more than one character",
+		"let c: char = 'a\n":         "unterminated character literal",
+	} {
+		_, err := ParseSource(source)
+		var diag *StrataError
+		if !errors.As(err, &diag) {
+			t.Errorf("%s gave %v", source, err)
+			continue
+		}
+		if got := fmt.Sprintf("%d:%d: %s", diag.Location.Line, diag.Location.Column, diag.Message); !strings.Contains(got, want) {
+			t.Errorf("%s gave %q, want %q", source, got, want)
+		}
+	}
+}
+
+func TestParseReaderMatchesParseSource(t *testing.T) {
+	data, err := os.ReadFile("../../examples/18_algorithms.str")
+	if err != nil {
+		t.Skip(err)
+	}
+	source := string(data) + "let s: string = \"日本語 → ✓\"\n"
+	want, err := ParseSource(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseReader(iotest.OneByteReader(strings.NewReader(source)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("streamed parse differs from in-memory parse")
+	}
+}
+
+func TestParseReaderReportsReadErrors(t *testing.T) {
+	_, err := ParseReader(iotest.TimeoutReader(strings.NewReader("let x: int = 1\n")))
+	if err != iotest.ErrTimeout {
+		t.Errorf("got %v, want %v", err, iotest.ErrTimeout)
+	}
+}
+
+func TestParseErrorsCarryCodesAndPositions(t *testing.T) {
+	_, err := ParseSource("let a: int = )\nlet b: int = 1\nlet c: int = 2 +\n")
+	var diags Diagnostics
+	if !errors.As(err, &diags) {
+		t.Fatalf("got %v, want Diagnostics", err)
+	}
+	var got []Location
+	for _, diag := range diags {
+		if diag.Code != ErrSyntax {
+			t.Errorf("%v: got code %s, want %s", diag, diag.Code, ErrSyntax)
+		}
+		got = append(got, Location{Line: diag.Location.Line, Column: diag.Location.Column})
+	}
+	want := []Location{{Line: 1, Column: 14}, {Line: 3, Column: 16}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got positions %v, want %v", got, want)
+	}
+}
+
+func TestExportIsASyntaxError(t *testing.T) {
+	_, err := ParseSource("export func init() => void {\n}\nlet export: int = 1\nexport + 1\n")
+	var diags Diagnostics
+	if !errors.As(err, &diags) || len(diags) != 1 {
+		t.Fatalf("got %v, want one diagnostic", err)
+	}
+	if diag := diags[0]; diag.Code != ErrSyntax || diag.Location.Line != 1 || !strings.Contains(diag.Hint, "remove export") {
+		t.Errorf("got %v at line %d with hint %q", diag, diag.Location.Line, diag.Hint)
+	}
+}
+
+func TestNodesCarrySpans(t *testing.T) {
+	source := "let s: string = \"né\"\nlet n: int = s + \"!\"\nlet xs: list<int> = [1, 2]\nlet y: int = xs[\"0\"]\n"
+	statements, err := ParseSource(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range statements {
+		loc := stmt.Location
+		if loc.EndLine != loc.Line || !strings.HasPrefix(source[loc.Offset:], "let ") || source[loc.EndOffset] != '\n' {
+			t.Errorf("statement spans %q", source[loc.Offset:loc.EndOffset])
+		}
+	}
+	value := statements[1].Value.Location
+	if got := source[value.Offset:value.EndOffset]; got != `s + "!"` || value.Column != 14 || value.EndColumn != 21 {
+		t.Errorf("the value spans %q from column %d to %d", got, value.Column, value.EndColumn)
+	}
+	streamed, err := ParseReader(iotest.OneByteReader(strings.NewReader(source)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(streamed, statements) {
+		t.Error("streamed locations differ from in-memory ones")
+	}
+
+	var diags Diagnostics
+	if !errors.As(NewTypeChecker().Check(statements), &diags) || len(diags) != 2 {
+		t.Fatalf("got %v, want two diagnostics", diags)
+	}
+	want := []Location{{Line: 2, Column: 14}, {Line: 4, Column: 17}}
+	for idx, diag := range diags {
+		if diag.Location.Line != want[idx].Line || diag.Location.Column != want[idx].Column {
+			t.Errorf("%s is at %d:%d, want %d:%d", diag.Message, diag.Location.Line, diag.Location.Column, want[idx].Line, want[idx].Column)
+		}
+	}
+}
+
+func benchmarkSource(b *testing.B, unicode bool) string {
+	data, err := os.ReadFile("../../examples/01_basic_types.str")
+	if err != nil {
+		b.Skip(err)
+	}
+	source := string(data)
+	if unicode {
+		source += "let greeting: string = \"héllo wörld → ✓ 日本語\"\n"
+	}
+	return strings.Repeat(source, 50)
+}
+
+func benchmarkTokenize(b *testing.B, source string) {
+	b.SetBytes(int64(len(source)))
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		tokenize(source)
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	source := benchmarkSource(b, false)
+	b.SetBytes(int64(len(source)))
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		if _, err := NewParser(source).Parse(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTokenizeASCII(b *testing.B) {
+	benchmarkTokenize(b, benchmarkSource(b, false))
+}
+
+func BenchmarkTokenizeUnicode(b *testing.B) {
+	benchmarkTokenize(b, benchmarkSource(b, true))
+}
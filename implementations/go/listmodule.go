@@ -0,0 +1,241 @@
+package strata
+
+import "sort"
+
+// ============================================================================
+// STD::LIST - map, filter, reduce, sort and other operations on lists
+// ============================================================================
+
+// Every function returns a new list and leaves its argument unchanged.
+// Callbacks are any function value, such as the name of a declared function.
+
+func listModule(i *Interpreter) map[string]interface{} {
+	// each calls fn on the items of args[0] in order until visit returns
+	// false.
+	each := func(name string, args []interface{}, visit func(item, result interface{}) bool) error {
+		if err := wantArgs(name, args, 2); err != nil {
+			return err
+		}
+		items, err := listArg(name, args[0])
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			result, err := i.callValue(name, args[1], []interface{}{item})
+			if err != nil {
+				return err
+			}
+			if !visit(item, result) {
+				break
+			}
+		}
+		return nil
+	}
+	return map[string]interface{}{
+		"map": NativeFunc(func(args []interface{}) (interface{}, error) {
+			mapped := []interface{}{}
+			err := each("map", args, func(item, result interface{}) bool {
+				mapped = append(mapped, result)
+				return true
+			})
+			return mapped, err
+		}),
+		"filter": NativeFunc(func(args []interface{}) (interface{}, error) {
+			kept := []interface{}{}
+			err := each("filter", args, func(item, result interface{}) bool {
+				if toBool(result) {
+					kept = append(kept, item)
+				}
+				return true
+			})
+			return kept, err
+		}),
+		"find": NativeFunc(func(args []interface{}) (interface{}, error) {
+			var found interface{}
+			err := each("find", args, func(item, result interface{}) bool {
+				if toBool(result) {
+					found = item
+					return false
+				}
+				return true
+			})
+			return found, err
+		}),
+		"some": NativeFunc(func(args []interface{}) (interface{}, error) {
+			matched := false
+			err := each("some", args, func(item, result interface{}) bool {
+				matched = toBool(result)
+				return !matched
+			})
+			return matched, err
+		}),
+		"every": NativeFunc(func(args []interface{}) (interface{}, error) {
+			all := true
+			err := each("every", args, func(item, result interface{}) bool {
+				all = toBool(result)
+				return all
+			})
+			return all, err
+		}),
+		"reduce": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("reduce", args, 2); err != nil {
+				return nil, err
+			}
+			items, err := listArg("reduce", args[0])
+			if err != nil {
+				return nil, err
+			}
+			var acc interface{}
+			if len(args) > 2 {
+				acc = args[2]
+			} else if len(items) == 0 {
+				return nil, newError(ErrInvalidOperation, "reduce of an empty list with no initial value")
+			} else {
+				acc, items = items[0], items[1:]
+			}
+			for _, item := range items {
+				if acc, err = i.callValue("reduce", args[1], []interface{}{acc, item}); err != nil {
+					return nil, err
+				}
+			}
+			return acc, nil
+		}),
+		"sort": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("sort", args, 1); err != nil {
+				return nil, err
+			}
+			items, err := listArg("sort", args[0])
+			if err != nil {
+				return nil, err
+			}
+			sorted := append([]interface{}{}, items...)
+			compare := orderValues
+			if len(args) > 1 {
+				compare = func(a, b interface{}) (int, error) {
+					result, err := i.callValue("sort", args[1], []interface{}{a, b})
+					if err != nil {
+						return 0, err
+					}
+					if !isNumber(result) && !isInteger(result) {
+						return 0, newError(ErrTypeMismatch, "sort comparator must return a number, got %s", describeValue(result))
+					}
+					return compareNumbers(result, int64(0)), nil
+				}
+			}
+			sort.SliceStable(sorted, func(a, b int) bool {
+				if err != nil {
+					return false
+				}
+				var order int
+				order, err = compare(sorted[a], sorted[b])
+				return order < 0
+			})
+			if err != nil {
+				return nil, err
+			}
+			return sorted, nil
+		}),
+		"reverse": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("reverse", args, 1); err != nil {
+				return nil, err
+			}
+			items, err := listArg("reverse", args[0])
+			if err != nil {
+				return nil, err
+			}
+			reversed := make([]interface{}, len(items))
+			for idx, item := range items {
+				reversed[len(items)-1-idx] = item
+			}
+			return reversed, nil
+		}),
+		"zip": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("zip", args, 2); err != nil {
+				return nil, err
+			}
+			left, err := listArg("zip", args[0])
+			if err != nil {
+				return nil, err
+			}
+			right, err := listArg("zip", args[1])
+			if err != nil {
+				return nil, err
+			}
+			n := len(left)
+			if len(right) < n {
+				n = len(right)
+			}
+			pairs := make([]interface{}, n)
+			for idx := range pairs {
+				pairs[idx] = Tuple{left[idx], right[idx]}
+			}
+			return pairs, nil
+		}),
+		"flatten": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("flatten", args, 1); err != nil {
+				return nil, err
+			}
+			items, err := listArg("flatten", args[0])
+			if err != nil {
+				return nil, err
+			}
+			flat := []interface{}{}
+			for _, item := range items {
+				if inner, ok := listItems(item); ok {
+					flat = append(flat, inner...)
+				} else {
+					flat = append(flat, item)
+				}
+			}
+			return flat, nil
+		}),
+		"unique": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("unique", args, 1); err != nil {
+				return nil, err
+			}
+			items, err := listArg("unique", args[0])
+			if err != nil {
+				return nil, err
+			}
+			seen := []interface{}{}
+		items:
+			for _, item := range items {
+				for _, prev := range seen {
+					if valuesEqual(item, prev) {
+						continue items
+					}
+				}
+				seen = append(seen, item)
+			}
+			return seen, nil
+		}),
+	}
+}
+
+func listArg(name string, v interface{}) ([]interface{}, error) {
+	items, ok := listItems(v)
+	if !ok {
+		return nil, newError(ErrTypeMismatch, "%s expects a list, got %s", name, describeValue(v))
+	}
+	return items, nil
+}
+
+// orderValues is the default order of sort: numbers by value and strings
+// lexicographically.
+func orderValues(a, b interface{}) (int, error) {
+	if (isNumber(a) || isInteger(a)) && (isNumber(b) || isInteger(b)) {
+		return compareNumbers(a, b), nil
+	}
+	if l, ok := a.(string); ok {
+		if r, ok := b.(string); ok {
+			switch {
+			case l < r:
+				return -1, nil
+			case l > r:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	return 0, newError(ErrTypeMismatch, "cannot order %s and %s", describeValue(a), describeValue(b)).withHint("pass a comparator function to sort")
+}
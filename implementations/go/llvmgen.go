@@ -0,0 +1,910 @@
+package strata
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ============================================================================
+// LLVM GENERATOR - Lowering typed numeric programs to LLVM IR
+// ============================================================================
+
+// The llvm target is experimental. It lowers programs whose every variable,
+// parameter and return value is an int, float, bool or string to textual
+// LLVM IR, which `strata build --target=llvm` optimizes and compiles to a
+// native binary. The C runtime supplies strings and printing. Anything
+// outside that subset - lists, maps, classes, closures, exceptions - is an
+// error rather than a silent fallback, so what builds runs at full speed.
+//
+// Variables live in stack slots (globals in global variables) that the
+// optimizer promotes to registers. Ints are i64, floats double, bools i1
+// and strings i8* pointers into the runtime's heap. The IR uses typed
+// pointers, which LLVM 14 requires and later versions still read.
+
+// llvmValue is a lowered expression: the IR operand and the Strata kind
+// of its value, "int", "float", "bool", "string" or "void", or an IR type
+// such as "i32" for what a runtime function returns as a C int.
+type llvmValue struct {
+	ref  string
+	kind string
+}
+
+// llvmLoop is where break and continue jump to in the innermost loop.
+type llvmLoop struct {
+	breakLabel    string
+	continueLabel string
+}
+
+// LLVMGenerator translates a program to an LLVM IR module.
+type LLVMGenerator struct {
+	body       strings.Builder
+	defs       []string
+	strs       []string
+	strIndex   map[string]string
+	declares   map[string]string
+	slots      map[string]llvmValue
+	globalVars map[string]llvmValue
+	loops      []llvmLoop
+	temps      int
+	blocks     int
+	current    string
+	terminated bool
+	fn         *Stmt
+	// bodyLines counts the lines of the body being generated, defLines
+	// those of the definitions before it and prelude the lines of the
+	// module before the definitions, for the source map.
+	bodyLines int
+	defLines  int
+	prelude   int
+	generatorError
+	codegenScope
+	lineMap
+}
+
+func NewLLVMGenerator() *LLVMGenerator {
+	return &LLVMGenerator{generatorError: generatorError{target: "llvm"}}
+}
+
+// llvmType is the IR type of a value of kind.
+func llvmType(kind string) string {
+	switch kind {
+	case "int":
+		return "i64"
+	case "float":
+		return "double"
+	case "bool":
+		return "i1"
+	case "string":
+		return "i8*"
+	}
+	return kind
+}
+
+// llvmZero is the value a slot of kind starts with.
+func llvmZero(kind string) string {
+	switch kind {
+	case "float":
+		return "0.0"
+	case "bool":
+		return "false"
+	case "string":
+		return "null"
+	}
+	return "0"
+}
+
+// llvmKind is the kind t lowers to, or "" when the llvm target cannot
+// represent it.
+func llvmKind(t TypeDef) string {
+	if t.Kind != KindPrimitive {
+		return ""
+	}
+	switch t.Primitive {
+	case TypeInt, TypeI64:
+		return "int"
+	case TypeFloat, TypeF64:
+		return "float"
+	case TypeBool:
+		return "bool"
+	case TypeString:
+		return "string"
+	case TypeVoid:
+		return "void"
+	}
+	return ""
+}
+
+// llvmName quotes an identifier for IR when it has characters a bare one
+// cannot.
+func llvmName(sigil, name string) string {
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '.') {
+			return sigil + `"` + name + `"`
+		}
+	}
+	return sigil + name
+}
+
+// llvmFloat writes f exactly, as IR wants a double constant.
+func llvmFloat(f float64) string {
+	return fmt.Sprintf("0x%016X", math.Float64bits(f))
+}
+
+// llvmRuntimeReturns are the kinds the C runtime functions behind the
+// builtins return. The math functions of libm return floats.
+var llvmRuntimeReturns = map[string]string{
+	"strata_strlen":      "int",
+	"strata_substr":      "string",
+	"strata_upper":       "string",
+	"strata_lower":       "string",
+	"strata_trim":        "string",
+	"strata_starts_with": "i32",
+	"strata_ends_with":   "i32",
+	"strata_includes":    "i32",
+	"strata_index_of":    "int",
+	"strata_repeat":      "string",
+	"strata_parse_int":   "int",
+	"strata_parse_float": "float",
+}
+
+// fail records the first error and returns a placeholder value.
+func (g *LLVMGenerator) fail(loc Location, format string, args ...interface{}) llvmValue {
+	g.failed(loc, format, args...)
+	return llvmValue{ref: "undef", kind: "int"}
+}
+
+// Generate returns the IR for a program, or the first construct the llvm
+// target cannot lower.
+func (g *LLVMGenerator) Generate(statements []*Stmt) (string, error) {
+	g.enter(statements)
+	g.defs = nil
+	g.strs = nil
+	g.strIndex = make(map[string]string)
+	g.declares = make(map[string]string)
+	g.globalVars = make(map[string]llvmValue)
+	g.err = nil
+	g.reset()
+	g.defLines = 0
+
+	var globals []string
+	for _, v := range g.declare(statements) {
+		ref := llvmName("@", "var."+v.Name)
+		kind := llvmKind(v.Type)
+		g.globalVars[v.Name] = llvmValue{ref: ref, kind: kind}
+		globals = append(globals, fmt.Sprintf("%s = internal global %s %s", ref, llvmType(kind), llvmZero(kind)))
+	}
+	var main []*Stmt
+	for _, stmt := range statements {
+		switch stmt.Kind {
+		case StmtImport:
+			if g.module(&Expr{Kind: ExprIdentifier, Name: stmt.Name}) == "" {
+				g.fail(stmt.Location, "cannot import %s", stmt.Module)
+			}
+		case StmtFunction:
+			g.function(stmt)
+		default:
+			main = append(main, stmt)
+		}
+	}
+	g.begin(nil)
+	g.block(main)
+	g.emit("ret i32 0")
+	g.define(fmt.Sprintf("define i32 @main() {\n%s}", g.body.String()))
+	if g.err != nil {
+		return "", g.err
+	}
+
+	var b strings.Builder
+	b.WriteString("; Generated by strata build --target=llvm.\n\n")
+	for _, section := range [][]string{g.strs, globals, g.sortedDeclares()} {
+		if len(section) > 0 {
+			b.WriteString(strings.Join(section, "\n"))
+			b.WriteString("\n\n")
+		}
+	}
+	g.prelude = strings.Count(b.String(), "\n")
+	b.WriteString(strings.Join(g.defs, "\n\n"))
+	b.WriteString("\n")
+	return b.String(), nil
+}
+
+func (g *LLVMGenerator) sortedDeclares() []string {
+	var lines []string
+	for _, line := range g.declares {
+		lines = append(lines, line)
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// declare adds the variables statements declare to the innermost scope and
+// returns those new to it. Each needs a type the target can lower, and a
+// for-in loop has to count over range.
+func (g *LLVMGenerator) declare(statements []*Stmt) []declaredVariable {
+	scope := g.locals
+	if scope == nil {
+		scope = g.globals
+	}
+	var vars []declaredVariable
+	add := func(stmt *Stmt, t TypeDef) {
+		kind := llvmKind(t)
+		if kind == "" || kind == "void" {
+			g.fail(stmt.Location, "%s has type %s; only int, float, bool and string are supported", stmt.Name, t.String())
+			return
+		}
+		if prev, existed := scope[stmt.Name]; existed {
+			if llvmKind(prev) != kind {
+				g.fail(stmt.Location, "%s is declared again with type %s", stmt.Name, t.String())
+			}
+			return
+		}
+		scope[stmt.Name] = t
+		vars = append(vars, declaredVariable{Name: stmt.Name, Type: t})
+	}
+	var walk func(statements []*Stmt)
+	walk = func(statements []*Stmt) {
+		for _, stmt := range statements {
+			if stmt == nil {
+				continue
+			}
+			switch stmt.Kind {
+			case StmtLet:
+				if stmt.Names != nil {
+					g.fail(stmt.Location, "destructuring is not supported")
+					continue
+				}
+				add(stmt, stmt.Type)
+			case StmtForIn:
+				if !isRangeCall(stmt.Value) {
+					g.fail(stmt.Location, "for-in loops must count over range(start, end)")
+				}
+				add(stmt, TypeRegistry["int"])
+			case StmtFunction, StmtClass:
+				continue
+			}
+			if stmt.Init != nil {
+				walk([]*Stmt{stmt.Init})
+			}
+			walk(stmt.Then)
+			walk(stmt.Else)
+			walk(stmt.Body)
+		}
+	}
+	walk(statements)
+	return vars
+}
+
+func isRangeCall(expr *Expr) bool {
+	return expr != nil && expr.Kind == ExprCall && expr.Func.Kind == ExprIdentifier && expr.Func.Name == "range" && len(expr.Args) == 2
+}
+
+// begin starts the body of fn, or of main when fn is nil.
+func (g *LLVMGenerator) begin(fn *Stmt) {
+	g.fn = fn
+	g.body.Reset()
+	g.bodyLines = 0
+	g.temps = 0
+	g.blocks = 0
+	g.loops = nil
+	g.slots = make(map[string]llvmValue)
+	g.label("entry")
+}
+
+// function lowers a top-level function to a definition.
+func (g *LLVMGenerator) function(fn *Stmt) {
+	if fn.Async {
+		g.fail(fn.Location, "async function %s is not supported", fn.Name)
+	}
+	ret := llvmKind(returnType(fn))
+	if ret == "" {
+		g.fail(fn.Location, "%s returns %s; only int, float, bool, string and void are supported", fn.Name, fn.ReturnType.String())
+		ret = "void"
+	}
+	defer g.track(fn.Location)()
+	g.begin(fn)
+	g.locals = make(map[string]TypeDef)
+	defer func() { g.locals = nil }()
+	var params []string
+	for _, param := range fn.Params {
+		kind := llvmKind(param.Type)
+		if kind == "" || kind == "void" || param.Variadic {
+			g.fail(fn.Location, "parameter %s of %s has type %s; only int, float, bool and string are supported", param.Name, fn.Name, param.Type.String())
+			continue
+		}
+		arg := llvmName("%", "arg."+param.Name)
+		params = append(params, llvmType(kind)+" "+arg)
+		slot := g.slot(param.Name, kind)
+		g.emit("store %s %s, %s* %s", llvmType(kind), arg, llvmType(kind), slot.ref)
+		g.locals[param.Name] = param.Type
+	}
+	for _, v := range g.declare(fn.Body) {
+		g.slot(v.Name, llvmKind(v.Type))
+	}
+	g.block(fn.Body)
+	if ret == "void" {
+		g.emit("ret void")
+	} else {
+		g.emit("ret %s %s", llvmType(ret), llvmZero(ret))
+	}
+	g.define(fmt.Sprintf("define internal %s %s(%s) {\n%s}", llvmType(ret), llvmName("@", "fn."+fn.Name), strings.Join(params, ", "), g.body.String()))
+}
+
+// define adds a finished definition: its first line, the body and the
+// closing brace, and the blank line after.
+func (g *LLVMGenerator) define(def string) {
+	g.defs = append(g.defs, def)
+	g.defLines += g.bodyLines + 3
+}
+
+// slot allocates the stack slot of a local variable.
+func (g *LLVMGenerator) slot(name, kind string) llvmValue {
+	slot := llvmValue{ref: llvmName("%", "var."+name), kind: kind}
+	g.emit("%s = alloca %s", slot.ref, llvmType(kind))
+	g.slots[name] = slot
+	return slot
+}
+
+// lookup finds the slot a variable lives in.
+func (g *LLVMGenerator) lookup(name string) (llvmValue, bool) {
+	if slot, ok := g.slots[name]; ok {
+		return slot, true
+	}
+	slot, ok := g.globalVars[name]
+	return slot, ok
+}
+
+// open starts an unreachable block when the current one has ended, so
+// there is a block to write into.
+func (g *LLVMGenerator) open() {
+	if g.terminated {
+		g.label(g.newLabel("dead"))
+	}
+}
+
+// emit writes an instruction into the current block.
+func (g *LLVMGenerator) emit(format string, args ...interface{}) {
+	g.open()
+	g.mark(g.defLines + 1 + g.bodyLines)
+	g.bodyLines++
+	g.body.WriteString("  ")
+	fmt.Fprintf(&g.body, format, args...)
+	g.body.WriteString("\n")
+	if strings.HasPrefix(format, "br ") || strings.HasPrefix(format, "ret") || format == "unreachable" {
+		g.terminated = true
+	}
+}
+
+func (g *LLVMGenerator) temp() string {
+	g.temps++
+	return fmt.Sprintf("%%t%d", g.temps)
+}
+
+// value emits an instruction producing a value of kind.
+func (g *LLVMGenerator) value(kind, format string, args ...interface{}) llvmValue {
+	ref := g.temp()
+	g.emit("%s = "+format, append([]interface{}{ref}, args...)...)
+	return llvmValue{ref: ref, kind: kind}
+}
+
+func (g *LLVMGenerator) newLabel(name string) string {
+	g.blocks++
+	return fmt.Sprintf("%s%d", name, g.blocks)
+}
+
+// label starts a block, falling through into it from the current one.
+func (g *LLVMGenerator) label(name string) {
+	if !g.terminated && name != "entry" {
+		g.emit("br label %%%s", name)
+	}
+	fmt.Fprintf(&g.body, "%s:\n", name)
+	g.bodyLines++
+	g.current = name
+	g.terminated = false
+}
+
+func (g *LLVMGenerator) branch(cond llvmValue, then, els string) {
+	g.emit("br i1 %s, label %%%s, label %%%s", cond.ref, then, els)
+}
+
+// stringConstant is a pointer to a global holding s.
+func (g *LLVMGenerator) stringConstant(s string) llvmValue {
+	name, ok := g.strIndex[s]
+	if !ok {
+		name = fmt.Sprintf("@str.%d", len(g.strs))
+		g.strIndex[s] = name
+		var b strings.Builder
+		for idx := 0; idx < len(s); idx++ {
+			c := s[idx]
+			if c >= 0x20 && c < 0x7f && c != '"' && c != '\\' {
+				b.WriteByte(c)
+			} else {
+				fmt.Fprintf(&b, "\\%02X", c)
+			}
+		}
+		g.strs = append(g.strs, fmt.Sprintf("%s = private unnamed_addr constant [%d x i8] c\"%s\\00\"", name, len(s)+1, b.String()))
+	}
+	array := fmt.Sprintf("[%d x i8]", len(s)+1)
+	return llvmValue{ref: fmt.Sprintf("getelementptr inbounds (%s, %s* %s, i64 0, i64 0)", array, array, name), kind: "string"}
+}
+
+// call calls a function of the C runtime or libm, declaring it, and
+// returns its result as kind.
+func (g *LLVMGenerator) call(kind, name string, args ...llvmValue) llvmValue {
+	types := make([]string, len(args))
+	operands := make([]string, len(args))
+	for idx, arg := range args {
+		types[idx] = llvmType(arg.kind)
+		operands[idx] = types[idx] + " " + arg.ref
+	}
+	g.declares[name] = fmt.Sprintf("declare %s @%s(%s)", llvmType(kind), name, strings.Join(types, ", "))
+	if kind == "void" {
+		g.emit("call void @%s(%s)", name, strings.Join(operands, ", "))
+		return llvmValue{kind: "void"}
+	}
+	return g.value(kind, "call %s @%s(%s)", llvmType(kind), name, strings.Join(operands, ", "))
+}
+
+// panic stops the program with message as the interpreter would.
+func (g *LLVMGenerator) panic(message llvmValue) {
+	g.call("void", "strata_panic", message)
+	g.emit("unreachable")
+}
+
+func (g *LLVMGenerator) block(statements []*Stmt) {
+	for _, stmt := range statements {
+		g.statement(stmt)
+	}
+}
+
+func (g *LLVMGenerator) statement(stmt *Stmt) {
+	if stmt == nil {
+		return
+	}
+	defer g.track(stmt.Location)()
+	switch stmt.Kind {
+	case StmtLet:
+		if slot, ok := g.lookup(stmt.Name); ok && stmt.Names == nil {
+			g.store(slot, g.expression(stmt.Value), stmt.Location)
+		}
+	case StmtAssignment:
+		if stmt.TargetExpr != nil {
+			g.fail(stmt.Location, "only variables can be assigned")
+			return
+		}
+		slot, ok := g.lookup(stmt.Target)
+		if !ok {
+			g.fail(stmt.Location, "unknown variable %s", stmt.Target)
+			return
+		}
+		g.store(slot, g.expression(stmt.Value), stmt.Location)
+	case StmtExpression:
+		g.expression(stmt.Expr)
+	case StmtIf:
+		then, els, end := g.newLabel("then"), g.newLabel("else"), g.newLabel("endif")
+		g.branch(g.condition(stmt.Condition), then, els)
+		g.label(then)
+		g.block(stmt.Then)
+		g.emit("br label %%%s", end)
+		g.label(els)
+		g.block(stmt.Else)
+		g.label(end)
+	case StmtWhile:
+		cond, body := g.newLabel("while"), g.newLabel("body")
+		g.label(cond)
+		g.loop(stmt, cond, func(exit string) {
+			g.branch(g.condition(stmt.Condition), body, exit)
+			g.label(body)
+			g.block(stmt.Body)
+			g.emit("br label %%%s", cond)
+		})
+	case StmtDoWhile:
+		body, cond := g.newLabel("do"), g.newLabel("cond")
+		g.label(body)
+		g.loop(stmt, cond, func(exit string) {
+			g.block(stmt.Body)
+			g.label(cond)
+			g.branch(g.condition(stmt.Condition), body, exit)
+		})
+	case StmtFor:
+		g.statement(stmt.Init)
+		cond, body, update := g.newLabel("for"), g.newLabel("body"), g.newLabel("update")
+		g.label(cond)
+		g.loop(stmt, update, func(exit string) {
+			if stmt.Condition != nil {
+				g.branch(g.condition(stmt.Condition), body, exit)
+			}
+			g.label(body)
+			g.block(stmt.Body)
+			g.label(update)
+			g.statement(stmt.Update)
+			g.emit("br label %%%s", cond)
+		})
+	case StmtForIn:
+		g.forRange(stmt)
+	case StmtBreak, StmtContinue:
+		if len(g.loops) == 0 {
+			g.fail(stmt.Location, "%s outside a loop", stmt.Kind)
+			return
+		}
+		loop := g.loops[len(g.loops)-1]
+		if stmt.Kind == StmtBreak {
+			g.emit("br label %%%s", loop.breakLabel)
+		} else {
+			g.emit("br label %%%s", loop.continueLabel)
+		}
+	case StmtReturn:
+		g.ret(stmt)
+	default:
+		g.fail(stmt.Location, "%s statements are not supported", stmt.Kind)
+	}
+}
+
+// loop lowers the body of a loop given where continue goes. Leaving the
+// loop normally runs its else block; break skips it.
+func (g *LLVMGenerator) loop(stmt *Stmt, continueLabel string, body func(exit string)) {
+	els, end := g.newLabel("loopelse"), g.newLabel("endloop")
+	g.loops = append(g.loops, llvmLoop{breakLabel: end, continueLabel: continueLabel})
+	body(els)
+	g.loops = g.loops[:len(g.loops)-1]
+	g.label(els)
+	g.block(stmt.Else)
+	g.label(end)
+}
+
+// forRange lowers `for (i in range(start, end))` to a counting loop. The
+// bounds are evaluated once, as the interpreter builds the list once.
+func (g *LLVMGenerator) forRange(stmt *Stmt) {
+	slot, ok := g.lookup(stmt.Name)
+	if !ok || !isRangeCall(stmt.Value) {
+		return
+	}
+	start := g.convert(g.expression(stmt.Value.Args[0]), "int", stmt.Location)
+	end := g.convert(g.expression(stmt.Value.Args[1]), "int", stmt.Location)
+	// The counter is a register carried round the loop by a phi, so the
+	// body assigning the variable does not change the iterations.
+	g.open()
+	entry := g.current
+	cond, body, next := g.newLabel("forin"), g.newLabel("body"), g.newLabel("next")
+	counter, step := g.temp(), g.temp()
+	g.label(cond)
+	g.emit("%s = phi i64 [ %s, %%%s ], [ %s, %%%s ]", counter, start.ref, entry, step, next)
+	g.loop(stmt, next, func(exit string) {
+		g.branch(g.value("bool", "icmp slt i64 %s, %s", counter, end.ref), body, exit)
+		g.label(body)
+		g.emit("store i64 %s, i64* %s", counter, slot.ref)
+		g.block(stmt.Body)
+		g.label(next)
+		g.emit("%s = add i64 %s, 1", step, counter)
+		g.emit("br label %%%s", cond)
+	})
+}
+
+func (g *LLVMGenerator) ret(stmt *Stmt) {
+	if g.fn == nil {
+		g.fail(stmt.Location, "return outside a function")
+		return
+	}
+	kind := llvmKind(returnType(g.fn))
+	if stmt.Value == nil || kind == "void" {
+		if stmt.Value != nil {
+			g.expression(stmt.Value)
+		}
+		if kind == "void" {
+			g.emit("ret void")
+		} else {
+			g.emit("ret %s %s", llvmType(kind), llvmZero(kind))
+		}
+		return
+	}
+	v := g.convert(g.expression(stmt.Value), kind, stmt.Location)
+	g.emit("ret %s %s", llvmType(kind), v.ref)
+}
+
+func (g *LLVMGenerator) store(slot, v llvmValue, loc Location) {
+	v = g.convert(v, slot.kind, loc)
+	g.emit("store %s %s, %s* %s", llvmType(slot.kind), v.ref, llvmType(slot.kind), slot.ref)
+}
+
+// convert converts v to kind, which may only widen an int to a float.
+func (g *LLVMGenerator) convert(v llvmValue, kind string, loc Location) llvmValue {
+	switch {
+	case v.kind == kind:
+		return v
+	case v.kind == "int" && kind == "float":
+		return g.value("float", "sitofp i64 %s to double", v.ref)
+	case v.kind == "i32" && kind == "bool":
+		return g.value("bool", "icmp ne i32 %s, 0", v.ref)
+	}
+	return g.fail(loc, "cannot use a %s as a %s", v.kind, kind)
+}
+
+func (g *LLVMGenerator) condition(expr *Expr) llvmValue {
+	if expr == nil {
+		return llvmValue{ref: "true", kind: "bool"}
+	}
+	return g.convert(g.expression(expr), "bool", expr.Location)
+}
+
+// stringify formats v as print shows it.
+func (g *LLVMGenerator) stringify(v llvmValue, loc Location) llvmValue {
+	switch v.kind {
+	case "string":
+		return v
+	case "int":
+		return g.call("string", "strata_int_str", v)
+	case "float":
+		return g.call("string", "strata_float_str", v)
+	case "bool":
+		return g.call("string", "strata_bool_str", g.value("i32", "zext i1 %s to i32", v.ref))
+	}
+	return g.fail(loc, "cannot format a %s", v.kind)
+}
+
+func (g *LLVMGenerator) expression(expr *Expr) llvmValue {
+	if expr == nil {
+		return llvmValue{kind: "void"}
+	}
+	switch expr.Kind {
+	case ExprLiteral:
+		switch value := expr.Value.(type) {
+		case int:
+			return llvmValue{ref: fmt.Sprint(value), kind: "int"}
+		case int64:
+			return llvmValue{ref: fmt.Sprint(value), kind: "int"}
+		case float64:
+			return llvmValue{ref: llvmFloat(value), kind: "float"}
+		case bool:
+			return llvmValue{ref: fmt.Sprint(value), kind: "bool"}
+		case string:
+			return g.stringConstant(value)
+		}
+		return g.fail(expr.Location, "literal %v is not supported", expr.Value)
+	case ExprIdentifier:
+		slot, ok := g.lookup(expr.Name)
+		if !ok {
+			return g.fail(expr.Location, "%s cannot be used as a value", expr.Name)
+		}
+		return g.value(slot.kind, "load %s, %s* %s", llvmType(slot.kind), llvmType(slot.kind), slot.ref)
+	case ExprMember:
+		if g.module(expr.Object) == "std::math" {
+			switch expr.Property {
+			case "PI":
+				return llvmValue{ref: llvmFloat(math.Pi), kind: "float"}
+			case "E":
+				return llvmValue{ref: llvmFloat(math.E), kind: "float"}
+			}
+		}
+	case ExprBinary:
+		return g.binary(expr)
+	case ExprUnary:
+		operand := g.expression(expr.Operand)
+		switch {
+		case expr.Op == "!" && operand.kind == "bool":
+			return g.value("bool", "xor i1 %s, true", operand.ref)
+		case expr.Op == "-" && operand.kind == "int":
+			overflow, ok := g.newLabel("overflow"), g.newLabel("nooverflow")
+			g.branch(g.value("bool", "icmp eq i64 %s, %d", operand.ref, int64(math.MinInt64)), overflow, ok)
+			g.label(overflow)
+			g.panic(g.call("string", "strata_concat", g.stringConstant("integer overflow: -"), g.stringify(operand, expr.Location)))
+			g.label(ok)
+			return g.value("int", "sub i64 0, %s", operand.ref)
+		case expr.Op == "-" && operand.kind == "float":
+			return g.value("float", "fneg double %s", operand.ref)
+		}
+		return g.fail(expr.Location, "cannot apply %s to a %s", expr.Op, operand.kind)
+	case ExprCall:
+		return g.callExpression(expr)
+	case ExprIndex:
+		object := g.expression(expr.Object)
+		if object.kind == "string" {
+			index := g.convert(g.expression(expr.Index), "int", expr.Location)
+			return g.call("string", "strata_char_at", object, index)
+		}
+		return g.fail(expr.Location, "cannot index a %s", object.kind)
+	}
+	return g.fail(expr.Location, "%s expressions are not supported", expr.Kind)
+}
+
+var llvmIntPredicates = map[string]string{"==": "eq", "!=": "ne", "<": "slt", ">": "sgt", "<=": "sle", ">=": "sge"}
+var llvmFloatPredicates = map[string]string{"==": "oeq", "!=": "une", "<": "olt", ">": "ogt", "<=": "ole", ">=": "oge"}
+
+func (g *LLVMGenerator) binary(expr *Expr) llvmValue {
+	if expr.Op == "&&" || expr.Op == "||" {
+		return g.logical(expr)
+	}
+	left, right := g.expression(expr.Left), g.expression(expr.Right)
+	strs := left.kind == "string" || right.kind == "string"
+	switch {
+	case expr.Op == "+" && strs:
+		return g.call("string", "strata_concat", g.stringify(left, expr.Location), g.stringify(right, expr.Location))
+	case strs && left.kind == right.kind && llvmIntPredicates[expr.Op] != "":
+		cmp := g.call("i32", "strata_str_cmp", left, right)
+		return g.value("bool", "icmp %s i32 %s, 0", llvmIntPredicates[expr.Op], cmp.ref)
+	case left.kind == "bool" && right.kind == "bool" && (expr.Op == "==" || expr.Op == "!="):
+		return g.value("bool", "icmp %s i1 %s, %s", llvmIntPredicates[expr.Op], left.ref, right.ref)
+	}
+	numeric := func(kind string) bool { return kind == "int" || kind == "float" }
+	if !numeric(left.kind) || !numeric(right.kind) {
+		return g.fail(expr.Location, "cannot apply %s to a %s and a %s", expr.Op, left.kind, right.kind)
+	}
+	if left.kind == "float" || right.kind == "float" {
+		left, right = g.convert(left, "float", expr.Location), g.convert(right, "float", expr.Location)
+		if predicate, ok := llvmFloatPredicates[expr.Op]; ok {
+			return g.value("bool", "fcmp %s double %s, %s", predicate, left.ref, right.ref)
+		}
+		op := map[string]string{"+": "fadd", "-": "fsub", "*": "fmul", "/": "fdiv", "%": "frem"}[expr.Op]
+		if op == "" {
+			return g.fail(expr.Location, "cannot apply %s to floats", expr.Op)
+		}
+		if op == "frem" {
+			zero, nonzero := g.newLabel("remzero"), g.newLabel("rem")
+			g.branch(g.value("bool", "fcmp oeq double %s, 0.0", right.ref), zero, nonzero)
+			g.label(zero)
+			g.panic(g.stringConstant("modulo by zero"))
+			g.label(nonzero)
+		}
+		return g.value("float", "%s double %s, %s", op, left.ref, right.ref)
+	}
+	if predicate, ok := llvmIntPredicates[expr.Op]; ok {
+		return g.value("bool", "icmp %s i64 %s, %s", predicate, left.ref, right.ref)
+	}
+	switch expr.Op {
+	case "+", "-", "*":
+		intrinsic := map[string]string{"+": "sadd", "-": "ssub", "*": "smul"}[expr.Op]
+		name := "llvm." + intrinsic + ".with.overflow.i64"
+		g.declares[name] = "declare { i64, i1 } @" + name + "(i64, i64)"
+		pair := g.value("{ i64, i1 }", "call { i64, i1 } @%s(i64 %s, i64 %s)", name, left.ref, right.ref)
+		overflow, ok := g.newLabel("overflow"), g.newLabel("nooverflow")
+		g.branch(g.value("bool", "extractvalue { i64, i1 } %s, 1", pair.ref), overflow, ok)
+		g.label(overflow)
+		g.overflow(left, expr.Op, right)
+		g.label(ok)
+		return g.value("int", "extractvalue { i64, i1 } %s, 0", pair.ref)
+	case "/", "%":
+		message := "division by zero"
+		if expr.Op == "%" {
+			message = "modulo by zero"
+		}
+		zero, nonzero := g.newLabel("divzero"), g.newLabel("div")
+		g.branch(g.value("bool", "icmp eq i64 %s, 0", right.ref), zero, nonzero)
+		g.label(zero)
+		g.panic(g.stringConstant(message))
+		g.label(nonzero)
+		// MinInt64 / -1 overflows, and MinInt64 % -1 is 0, which srem
+		// by 1 gives without the undefined behaviour.
+		min := g.value("bool", "icmp eq i64 %s, %d", left.ref, int64(math.MinInt64))
+		minusOne := g.value("bool", "icmp eq i64 %s, -1", right.ref)
+		both := g.value("bool", "and i1 %s, %s", min.ref, minusOne.ref)
+		if expr.Op == "%" {
+			divisor := g.value("int", "select i1 %s, i64 1, i64 %s", both.ref, right.ref)
+			return g.value("int", "srem i64 %s, %s", left.ref, divisor.ref)
+		}
+		overflow, ok := g.newLabel("overflow"), g.newLabel("nooverflow")
+		g.branch(both, overflow, ok)
+		g.label(overflow)
+		g.overflow(left, expr.Op, right)
+		g.label(ok)
+		return g.value("int", "sdiv i64 %s, %s", left.ref, right.ref)
+	}
+	return g.fail(expr.Location, "cannot apply %s to ints", expr.Op)
+}
+
+// overflow stops the program with the message the interpreter gives when
+// left op right overflows.
+func (g *LLVMGenerator) overflow(left llvmValue, op string, right llvmValue) {
+	message := g.stringConstant("integer overflow: ")
+	for _, part := range []llvmValue{left, g.stringConstant(" " + op + " "), right} {
+		message = g.call("string", "strata_concat", message, g.stringify(part, Location{}))
+	}
+	g.panic(message)
+}
+
+// logical lowers && and || so the right operand runs only when needed.
+func (g *LLVMGenerator) logical(expr *Expr) llvmValue {
+	left := g.condition(expr.Left)
+	g.open()
+	from := g.current
+	rhs, end := g.newLabel("rhs"), g.newLabel("endlogic")
+	short := "false"
+	if expr.Op == "&&" {
+		g.branch(left, rhs, end)
+	} else {
+		short = "true"
+		g.branch(left, end, rhs)
+	}
+	g.label(rhs)
+	right := g.condition(expr.Right)
+	g.open()
+	rightFrom := g.current
+	g.emit("br label %%%s", end)
+	g.label(end)
+	return g.value("bool", "phi i1 [ %s, %%%s ], [ %s, %%%s ]", short, from, right.ref, rightFrom)
+}
+
+// callExpression lowers a call of a top-level function, a builtin or a
+// function of std::io, std::math or std::text.
+func (g *LLVMGenerator) callExpression(expr *Expr) llvmValue {
+	if fn, ok := g.calledFunction(expr); ok {
+		if len(expr.Args) != len(fn.Params) {
+			return g.fail(expr.Location, "%s takes %d arguments", fn.Name, len(fn.Params))
+		}
+		operands := make([]string, len(expr.Args))
+		for idx, arg := range expr.Args {
+			v := g.convert(g.expression(arg), llvmKind(fn.Params[idx].Type), arg.Location)
+			operands[idx] = llvmType(v.kind) + " " + v.ref
+		}
+		kind := llvmKind(returnType(fn))
+		name := llvmName("@", "fn."+fn.Name)
+		if kind == "void" {
+			g.emit("call void %s(%s)", name, strings.Join(operands, ", "))
+			return llvmValue{kind: "void"}
+		}
+		return g.value(kind, "call %s %s(%s)", llvmType(kind), name, strings.Join(operands, ", "))
+	}
+
+	name := g.builtinName(expr)
+	if expr.Func.Kind == ExprMember {
+		switch g.module(expr.Func.Object) {
+		case "std::io":
+			name = "io." + expr.Func.Property
+		case "std::math":
+			name = "math." + expr.Func.Property
+		case "std::text":
+			name = expr.Func.Property
+		}
+	}
+	if name == "" {
+		return g.fail(expr.Location, "only top-level functions, builtins and standard modules can be called")
+	}
+	args := make([]llvmValue, len(expr.Args))
+	for idx, arg := range expr.Args {
+		args[idx] = g.expression(arg)
+	}
+	float := func(v llvmValue) llvmValue { return g.convert(v, "float", expr.Location) }
+	switch {
+	case (name == "io.print" || name == "io.println") && len(args) == 1:
+		return g.call("void", "strata_print", g.stringify(args[0], expr.Location))
+	case name == "abs" && len(args) == 1 && args[0].kind == "int":
+		return g.call("int", "llabs", args[0])
+	case (name == "abs" || name == "math.abs") && len(args) == 1:
+		return g.call("float", "fabs", float(args[0]))
+	case (name == "floor" || name == "ceil" || name == "round") && len(args) == 1:
+		// The builtins round to an int; std::math's keep a float.
+		rounded := g.call("float", name, float(args[0]))
+		return g.value("int", "fptosi double %s to i64", rounded.ref)
+	case name == "len" && len(args) == 1 && args[0].kind == "string":
+		return g.call("int", "strata_strlen", args[0])
+	case name == "toString" && len(args) == 1:
+		return g.stringify(args[0], expr.Location)
+	case (name == "replace" || name == "replaceAll") && len(args) == 3:
+		all := llvmValue{ref: "0", kind: "i32"}
+		if name == "replaceAll" {
+			all.ref = "1"
+		}
+		for idx := range args {
+			args[idx] = g.convert(args[idx], "string", expr.Location)
+		}
+		return g.call("string", "strata_replace", args[0], args[1], args[2], all)
+	}
+	builtin, ok := cBuiltins[strings.TrimPrefix(name, "math.")]
+	if !ok || len(args) != len(builtin.params) {
+		return g.fail(expr.Location, "%s is not supported", name)
+	}
+	kind, runtime := llvmRuntimeReturns[builtin.name]
+	if !runtime {
+		kind = "float"
+	}
+	for idx, param := range builtin.params {
+		if llvmKind(TypeRegistry[param]) == "" {
+			return g.fail(expr.Location, "%s is not supported", name)
+		}
+		args[idx] = g.convert(args[idx], param, expr.Location)
+	}
+	result := g.call(kind, builtin.name, args...)
+	if kind == "i32" {
+		return g.convert(result, "bool", expr.Location)
+	}
+	return result
+}
@@ -0,0 +1,120 @@
+package strata
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// haveLLVM reports whether the llvm target can compile here.
+func haveLLVM() bool {
+	if _, err := exec.LookPath("clang"); err == nil {
+		return true
+	}
+	for _, tool := range []string{"opt", "llc", "cc"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func TestLLVMBuildMatchesInterpreter(t *testing.T) {
+	if !haveLLVM() {
+		t.Skip("no LLVM toolchain")
+	}
+	source := `import io from std::io
+import math from std::math
+func fib(n: int) => int {
+  if (n < 2) { return n }
+  return fib(n - 1) + fib(n - 2)
+}
+func isPrime(n: int) => bool {
+  if (n < 2) { return false }
+  var d: int = 2
+  while (d * d <= n) {
+    if (n % d == 0) { return false }
+    d = d + 1
+  }
+  return true
+}
+var count: int = 0
+for (i in range(0, 100)) {
+  if (isPrime(i) && i % 10 != 3) { count = count + 1 }
+}
+io.print("${count} primes, fib ${fib(20)}")
+io.print(math.sqrt(2.0) * 2 + 7 / 2 - 7.0 / 2)
+var k: int = 0
+do {
+  k = k + 3
+  if (k == 6) { continue }
+  io.print(k)
+} while (k < 12)
+while (k > 100) {
+  k = 0
+} else {
+  io.print("done at " + toString(k))
+}
+let s: string = "héllo"
+io.print(toUpperCase("strata") + s[1] + len(s) + (s == "héllo"))
+let big: int = 9223372036854775807
+io.print(big + 1)
+`
+	dir := t.TempDir()
+	entry := filepath.Join(dir, "numbers.str")
+	if err := os.WriteFile(entry, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	project, err := LoadProject(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "numbers")
+	var stderr strings.Builder
+	if _, err := Build(project, BuildOptions{Output: output, Target: "llvm", EmitSource: true}, &stderr); err != nil {
+		t.Fatalf("%v\n%s", err, stderr.String())
+	}
+	ir, err := os.ReadFile(output + ".ll")
+	if err != nil {
+		t.Fatalf("--emit-source did not keep the IR: %v", err)
+	}
+	for _, want := range []string{"define internal i64 @fn.fib(i64 %arg.n)", "@llvm.sadd.with.overflow.i64", "define i32 @main()"} {
+		if !strings.Contains(string(ir), want) {
+			t.Errorf("IR lacks %q:\n%s", want, ir)
+		}
+	}
+
+	var want strings.Builder
+	runErr := RunSource(source, RunOptions{Stdout: &want})
+	if runErr == nil {
+		t.Fatal("the interpreter did not stop on the overflow")
+	}
+	got, err := exec.Command(output).Output()
+	if _, exited := err.(*exec.ExitError); !exited {
+		t.Fatalf("the binary did not stop on the overflow: %v", err)
+	}
+	if string(got) != want.String() {
+		t.Errorf("binary printed\n%s\nthe interpreter\n%s", got, want.String())
+	}
+}
+
+func TestLLVMGeneratorRejectsWhatItCannotLower(t *testing.T) {
+	for _, tc := range []struct{ source, message string }{
+		{"var xs: list<int> = [1]\n", "xs has type list<int>"},
+		{"func f(x: any) => int {\n  return 1\n}\n", "parameter x of f has type any"},
+		{"var n: int = 0\nfor (c in \"abc\") {\n  n = n + 1\n}\n", "for-in loops must count over range"},
+		{"import fs from std::fs\n", "cannot import std::fs"},
+		{"var n: int = 0\ntry {\n  n = 1\n} catch (e) {\n  n = 2\n}\n", "try statements are not supported"},
+	} {
+		statements, err := ParseSource(tc.source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = NewLLVMGenerator().Generate(statements)
+		if err == nil || !strings.Contains(err.Error(), tc.message) {
+			t.Errorf("%q: got error %v, want %q", tc.source, err, tc.message)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package strata
+
+import (
+	"encoding/json"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// INTERNAL LOGGING - Structured per-phase timings and counters
+// ============================================================================
+
+// PhaseLog is the process-wide structured logger. It is nil unless enabled
+// with --log-json, and every method is safe to call on a nil logger.
+var PhaseLog *PhaseLogger
+
+type PhaseLogger struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+type PhaseEvent struct {
+	Time       string           `json:"time"`
+	Phase      string           `json:"phase"`
+	Module     string           `json:"module,omitempty"`
+	DurationMs float64          `json:"duration_ms"`
+	Counters   map[string]int64 `json:"counters,omitempty"`
+}
+
+func NewPhaseLogger(out io.Writer) *PhaseLogger {
+	return &PhaseLogger{out: out}
+}
+
+func (l *PhaseLogger) Enabled() bool {
+	return l != nil
+}
+
+// Phase records that phase finished for module (empty for whole-run phases).
+func (l *PhaseLogger) Phase(phase, module string, start time.Time, counters map[string]int64) {
+	if l == nil {
+		return
+	}
+	l.PhaseDuration(phase, module, time.Since(start), counters)
+}
+
+// PhaseDuration records that phase took d for module, for phases that do
+// not run in one stretch, such as lexing interleaved with parsing.
+func (l *PhaseLogger) PhaseDuration(phase, module string, d time.Duration, counters map[string]int64) {
+	if l == nil {
+		return
+	}
+	event := PhaseEvent{
+		Time:       time.Now().UTC().Format(time.RFC3339Nano),
+		Phase:      phase,
+		Module:     module,
+		DurationMs: float64(d.Nanoseconds()) / 1e6,
+		Counters:   counters,
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(append(data, '\n'))
+}
+
+// Allocations returns the cumulative heap allocation count, or 0 when logging
+// is disabled so that callers don't pay for ReadMemStats.
+func (l *PhaseLogger) Allocations() int64 {
+	if l == nil {
+		return 0
+	}
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return int64(stats.Mallocs)
+}
+
+func countStatements(statements []*Stmt) int64 {
+	var count int64
+	for _, stmt := range statements {
+		if stmt == nil {
+			continue
+		}
+		count++
+		count += countStatements(stmt.Then)
+		count += countStatements(stmt.Else)
+		count += countStatements(stmt.Body)
+		count += countStatements(stmt.Catch)
+		count += countStatements(stmt.Finally)
+		for _, c := range stmt.Cases {
+			count += countStatements(c.Body)
+		}
+		if stmt.Init != nil {
+			count += countStatements([]*Stmt{stmt.Init})
+		}
+		if stmt.Update != nil {
+			count += countStatements([]*Stmt{stmt.Update})
+		}
+	}
+	return count
+}
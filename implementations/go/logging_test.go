@@ -0,0 +1,67 @@
+package strata
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// phaseEvents runs the project whose entry is main under --log-json and
+// returns the modules each phase was logged for, in order.
+func phaseEvents(t *testing.T, files map[string]string) map[string][]string {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	for name, content := range files {
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+	logFile := filepath.Join(dir, "phases.jsonl")
+	defer func() { PhaseLog = nil }()
+	if code := RunProject(filepath.Join(dir, "main.str"), RunOptions{LogFile: logFile, Quiet: true}); code != 0 {
+		t.Fatalf("the run exited with %d", code)
+	}
+	f, err := os.Open(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	phases := make(map[string][]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event PhaseEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("%q is not a phase event: %v", scanner.Text(), err)
+		}
+		phases[event.Phase] = append(phases[event.Phase], event.Module)
+		if event.Phase == "lex" && (event.Counters["tokens"] == 0 || event.Counters["bytes"] == 0) {
+			t.Errorf("the lex event has counters %v", event.Counters)
+		}
+	}
+	return phases
+}
+
+func TestPhaseLogTimesLexingApartFromParsing(t *testing.T) {
+	phases := phaseEvents(t, map[string]string{
+		"main.str": "import lib from \"./lib.str\"\nlet x: int = 1\n",
+		"lib.str":  "let y: int = 2\n",
+	})
+	for _, phase := range []string{"lex", "parse", "check"} {
+		if len(phases[phase]) != 2 {
+			t.Errorf("%s was logged for %v, want both modules", phase, phases[phase])
+		}
+	}
+}
+
+func TestPhaseLogEvaluatesEachModule(t *testing.T) {
+	phases := phaseEvents(t, map[string]string{
+		"main.str": "import a from \"./a.str\"\nimport b from \"./b.str\"\n",
+		"a.str":    "import b from \"./b.str\"\nlet x: int = 1\n",
+		"b.str":    "let y: int = 2\n",
+	})
+	want := []string{"b.str", "a.str", "main.str"}
+	if got := phases["eval"]; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("eval was logged for %v, want %v", got, want)
+	}
+}
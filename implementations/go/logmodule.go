@@ -0,0 +1,121 @@
+package strata
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// STD::LOG - Leveled script logging to stderr or a file
+// ============================================================================
+
+// logLevels orders the levels std::log understands. Messages below the
+// minimum level are dropped; "off" drops everything.
+var logLevels = []string{"debug", "info", "warn", "error", "off"}
+
+func logLevelIndex(name string) (int, bool) {
+	for idx, level := range logLevels {
+		if level == strings.ToLower(name) {
+			return idx, true
+		}
+	}
+	return 0, false
+}
+
+// scriptLogger is the state behind one interpreter's std::log. It writes to
+// the interpreter's stderr unless toFile has redirected it.
+type scriptLogger struct {
+	level      int
+	timestamps bool
+	file       *os.File
+}
+
+// write emits one line such as `2024-05-01T12:00:00Z WARN  disk almost full`.
+func (l *scriptLogger) write(i *Interpreter, level int, args []interface{}) error {
+	if level < l.level {
+		return nil
+	}
+	parts := make([]string, len(args))
+	for idx, arg := range args {
+		parts[idx] = displayValue(arg)
+	}
+	var line strings.Builder
+	if l.timestamps {
+		line.WriteString(i.Clock().UTC().Format(time.RFC3339) + " ")
+	}
+	fmt.Fprintf(&line, "%-5s %s\n", strings.ToUpper(logLevels[level]), strings.Join(parts, " "))
+	var out io.Writer = i.Stderr
+	if l.file != nil {
+		// Stderr counts against the output quota itself; the file does not.
+		out = quotaWriter{i.usage, l.file}
+	}
+	if _, err := io.WriteString(out, line.String()); err != nil {
+		if quota := i.usage.failed(); quota != nil {
+			return quota
+		}
+		return newError(ErrInvalidOperation, "log: %v", err)
+	}
+	return nil
+}
+
+func (l *scriptLogger) closeFile() {
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+}
+
+func logModule(i *Interpreter) map[string]interface{} {
+	logger := &scriptLogger{level: 1, timestamps: true}
+	emit := func(level int) NativeFunc {
+		return func(args []interface{}) (interface{}, error) {
+			return nil, logger.write(i, level, args)
+		}
+	}
+	return map[string]interface{}{
+		"debug": emit(0),
+		"info":  emit(1),
+		"warn":  emit(2),
+		"error": emit(3),
+		"setLevel": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("setLevel", args, 1); err != nil {
+				return nil, err
+			}
+			level, ok := logLevelIndex(toString(args[0]))
+			if !ok {
+				return nil, newError(ErrInvalidOperation, "unknown log level %q", toString(args[0])).withHint("use " + strings.Join(logLevels, ", "))
+			}
+			logger.level = level
+			return nil, nil
+		}),
+		"level": NativeFunc(func(args []interface{}) (interface{}, error) {
+			return logLevels[logger.level], nil
+		}),
+		"setTimestamps": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("setTimestamps", args, 1); err != nil {
+				return nil, err
+			}
+			logger.timestamps = toBool(args[0])
+			return nil, nil
+		}),
+		"toFile": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("toFile", args, 1); err != nil {
+				return nil, err
+			}
+			f, err := os.OpenFile(toString(args[0]), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+			if err != nil {
+				return false, nil
+			}
+			logger.closeFile()
+			logger.file = f
+			return true, nil
+		}),
+		"toStderr": NativeFunc(func(args []interface{}) (interface{}, error) {
+			logger.closeFile()
+			return nil, nil
+		}),
+	}
+}
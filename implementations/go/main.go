@@ -1,15 +1,24 @@
-package main
+package strata
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"math"
+	"math/rand"
 	"os"
+	"reflect"
 	"regexp"
+	"runtime/debug"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
+	"unicode/utf8"
 )
 
 // ============================================================================
@@ -45,12 +54,14 @@ const (
 	TypeOption    PrimitiveType = "option"
 	TypeResult    PrimitiveType = "result"
 	TypePromise   PrimitiveType = "promise"
+	TypeChannel   PrimitiveType = "channel"
 	TypeNull      PrimitiveType = "null"
 	TypeUndefined PrimitiveType = "undefined"
 	TypeRegex     PrimitiveType = "regex"
 	TypePattern   PrimitiveType = "pattern"
 	TypeComplex   PrimitiveType = "complex"
 	TypeMatrix    PrimitiveType = "matrix"
+	TypeBytes     PrimitiveType = "bytes"
 	TypeDataframe PrimitiveType = "dataframe"
 	TypeCallable  PrimitiveType = "callable"
 	TypeLambda    PrimitiveType = "lambda"
@@ -65,6 +76,8 @@ const (
 	KindInterface TypeDefKind = "interface"
 	KindOptional  TypeDefKind = "optional"
 	KindGeneric   TypeDefKind = "generic"
+	KindEnum      TypeDefKind = "enum"
+	KindClass     TypeDefKind = "class"
 )
 
 type TypeDef struct {
@@ -104,12 +117,14 @@ var TypeRegistry = map[string]TypeDef{
 	"option":    {Kind: KindPrimitive, Primitive: TypeOption},
 	"result":    {Kind: KindPrimitive, Primitive: TypeResult},
 	"promise":   {Kind: KindPrimitive, Primitive: TypePromise},
+	"channel":   {Kind: KindPrimitive, Primitive: TypeChannel},
 	"null":      {Kind: KindPrimitive, Primitive: TypeNull},
 	"undefined": {Kind: KindPrimitive, Primitive: TypeUndefined},
 	"regex":     {Kind: KindPrimitive, Primitive: TypeRegex},
 	"pattern":   {Kind: KindPrimitive, Primitive: TypePattern},
 	"complex":   {Kind: KindPrimitive, Primitive: TypeComplex},
 	"matrix":    {Kind: KindPrimitive, Primitive: TypeMatrix},
+	"bytes":     {Kind: KindPrimitive, Primitive: TypeBytes},
 	"dataframe": {Kind: KindPrimitive, Primitive: TypeDataframe},
 	"callable":  {Kind: KindPrimitive, Primitive: TypeCallable},
 	"lambda":    {Kind: KindPrimitive, Primitive: TypeLambda},
@@ -124,23 +139,74 @@ func parseTypeAnnotation(token string) TypeDef {
 		inner := parseTypeAnnotation(token[:len(token)-1])
 		return TypeDef{Kind: KindOptional, InnerType: &inner}
 	}
-	return TypeDef{Kind: KindPrimitive, Primitive: TypeAny}
+	if t, ok := parseGeneric(token); ok {
+		return t
+	}
+	// unknown names check as any but keep their name for user-declared types
+	return TypeDef{Kind: KindPrimitive, Primitive: TypeAny, Name: token}
+}
+
+func (t TypeDef) String() string {
+	switch t.Kind {
+	case KindOptional:
+		if t.InnerType != nil {
+			return t.InnerType.String() + "?"
+		}
+	case KindPrimitive:
+		if t.Primitive == TypeAny && t.Name != "" {
+			return t.Name
+		}
+		return string(t.Primitive) + typeArgsString(t)
+	}
+	if t.Name != "" {
+		return t.Name
+	}
+	return string(t.Kind)
+}
+
+// isListType reports whether p is one of the interchangeable sequence types.
+func isListType(p PrimitiveType) bool {
+	return p == TypeArray || p == TypeList
+}
+
+// isMapType reports whether p is one of the interchangeable map types.
+func isMapType(p PrimitiveType) bool {
+	return p == TypeMap || p == TypeDict
 }
 
 func typeCompatible(actual, expected TypeDef) bool {
 	if expected.Primitive == TypeAny || actual.Primitive == TypeAny {
 		return true
 	}
+	if expected.Kind == KindOptional && expected.InnerType != nil {
+		if actual.Kind == KindOptional && actual.InnerType != nil {
+			return typeCompatible(*actual.InnerType, *expected.InnerType)
+		}
+		return actual.Primitive == TypeNull || typeCompatible(actual, *expected.InnerType)
+	}
+	if actual.Kind == KindEnum || expected.Kind == KindEnum || actual.Kind == KindClass || expected.Kind == KindClass ||
+		actual.Kind == KindInterface || expected.Kind == KindInterface {
+		return actual.Kind == expected.Kind && actual.Name == expected.Name
+	}
 	if actual.Kind == KindPrimitive && expected.Kind == KindPrimitive {
 		if actual.Primitive == expected.Primitive {
-			return true
+			return paramsCompatible(actual, expected)
 		}
-		if actual.Primitive == TypeInt && expected.Primitive == TypeFloat {
+		if numericConversion(actual.Primitive, expected.Primitive) {
 			return true
 		}
 		if actual.Primitive == TypeChar && expected.Primitive == TypeString {
 			return true
 		}
+		if (actual.Primitive == TypeInt || actual.Primitive == TypeFloat) && expected.Primitive == TypeComplex {
+			return true
+		}
+		if isListType(actual.Primitive) && isListType(expected.Primitive) {
+			return paramsCompatible(actual, expected)
+		}
+		if isMapType(actual.Primitive) && isMapType(expected.Primitive) {
+			return paramsCompatible(actual, expected)
+		}
 		return false
 	}
 	return false
@@ -150,19 +216,85 @@ func typeCompatible(actual, expected TypeDef) bool {
 // LOCATION TRACKING
 // ============================================================================
 
+// Location is the span of source a token or AST node covers. Lines and
+// columns count from 1, columns in runes; EndLine and EndColumn are just
+// past the last character. Offset and EndOffset are the same span in bytes
+// from the start of the file, for tools that slice the source directly.
 type Location struct {
-	Line   int
-	Column int
-	Source string
+	Line      int
+	Column    int
+	EndLine   int
+	EndColumn int
+	Offset    int
+	EndOffset int
+	Source    string
 }
 
 // ============================================================================
 // LEXER
 // ============================================================================
 
+type TokenKind string
+
+const (
+	TokenKeyword  TokenKind = "keyword"
+	TokenIdent    TokenKind = "ident"
+	TokenNumber   TokenKind = "number"
+	TokenString   TokenKind = "string"
+	TokenChar     TokenKind = "char"
+	TokenOperator TokenKind = "operator"
+	TokenPunct    TokenKind = "punct"
+)
+
+// TemplatePart marks the pieces of an interpolated string. A string
+// containing `${` is lexed as a head, the tokens of each embedded expression,
+// then a middle for every further `${` and finally a tail.
+type TemplatePart int
+
+const (
+	TemplateNone TemplatePart = iota
+	TemplateHead
+	TemplateMiddle
+	TemplateTail
+)
+
+// Token is a classified lexeme. String and char tokens hold the unescaped
+// literal contents without their quotes. Doc holds the /// comments just before
+// the token, without their slashes, a line each.
 type Token struct {
+	Kind     TokenKind
 	Value    string
+	Template TemplatePart
 	Location Location
+	Doc      string
+}
+
+// quoted reports whether the token is a string or character literal, whose
+// value is never a keyword or symbol.
+func (t *Token) quoted() bool {
+	return t.Kind == TokenString || t.Kind == TokenChar
+}
+
+var keywords = map[string]bool{
+	"import": true, "let": true, "const": true, "var": true, "func": true,
+	"return": true, "if": true, "else": true, "while": true, "for": true,
+	"break": true, "continue": true, "true": true, "false": true,
+	"try": true, "catch": true, "finally": true, "throw": true,
+	"enum": true, "null": true, "do": true, "is": true, "class": true, "interface": true,
+	"async": true, "await": true, "spawn": true,
+}
+
+// exportable holds the keywords that begin a declaration, which other
+// languages let export precede.
+var exportable = map[string]bool{
+	"let": true, "const": true, "var": true, "func": true, "async": true,
+	"class": true, "interface": true, "enum": true,
+}
+
+var operatorTokens = map[string]bool{
+	"==": true, "!=": true, "<=": true, ">=": true, "||": true, "&&": true, "??": true,
+	"++": true, "--": true, "+": true, "-": true, "*": true, "/": true,
+	"%": true, "<": true, ">": true, "=": true, "!": true, "~": true,
 }
 
 type Lexer struct {
@@ -171,6 +303,17 @@ type Lexer struct {
 	line      int
 	column    int
 	lineStart int
+	reader    io.Reader
+	err       error
+	// base is the byte offset in the file of input[0], which moves as
+	// fill discards the lines already lexed.
+	base int
+	// templates holds the brace depth of each open `${` expression.
+	templates []int
+	// tokens is the unused rest of the block new tokens are taken from.
+	tokens []Token
+	// doc collects the /// comments for the next token.
+	doc []string
 }
 
 func NewLexer(input string) *Lexer {
@@ -183,26 +326,80 @@ func NewLexer(input string) *Lexer {
 	}
 }
 
-func (l *Lexer) peek() byte {
-	if l.pos >= len(l.input) {
-		return 0
+// NewLexerReader lexes source read incrementally from r. Only the current
+// line and a small read-ahead are kept in memory.
+func NewLexerReader(r io.Reader) *Lexer {
+	return &Lexer{reader: r, line: 1, column: 1}
+}
+
+// Err returns the first error reported by the underlying reader, or the
+// first malformed comment, literal or escape, if any.
+func (l *Lexer) Err() error {
+	return l.err
+}
+
+const lexerChunkSize = 4096
+
+// fill makes at least n bytes past pos available when reading from an
+// io.Reader, first discarding input before the current line.
+func (l *Lexer) fill(n int) {
+	if l.reader == nil || l.pos+n <= len(l.input) {
+		return
+	}
+	if l.lineStart > 0 {
+		l.base += l.lineStart
+		l.input = l.input[l.lineStart:]
+		l.pos -= l.lineStart
+		l.lineStart = 0
+	}
+	buf := make([]byte, lexerChunkSize)
+	for l.pos+n > len(l.input) {
+		count, err := l.reader.Read(buf)
+		l.input += string(buf[:count])
+		if err != nil {
+			if err != io.EOF {
+				l.err = err
+			}
+			l.reader = nil
+			return
+		}
+	}
+}
+
+// runeAt decodes the rune starting offset bytes past pos, taking a fast path
+// for ASCII. Invalid UTF-8 decodes as utf8.RuneError with a width of one byte.
+func (l *Lexer) runeAt(offset int) (rune, int) {
+	l.fill(offset + utf8.UTFMax)
+	pos := l.pos + offset
+	if pos >= len(l.input) {
+		return 0, 0
+	}
+	if c := l.input[pos]; c < utf8.RuneSelf {
+		return rune(c), 1
 	}
-	return l.input[l.pos]
+	return utf8.DecodeRuneInString(l.input[pos:])
+}
+
+func (l *Lexer) peek() rune {
+	ch, _ := l.runeAt(0)
+	return ch
 }
 
-func (l *Lexer) peekNext() byte {
-	if l.pos+1 >= len(l.input) {
+func (l *Lexer) peekNext() rune {
+	_, width := l.runeAt(0)
+	if width == 0 {
 		return 0
 	}
-	return l.input[l.pos+1]
+	ch, _ := l.runeAt(width)
+	return ch
 }
 
-func (l *Lexer) advance() byte {
-	if l.pos >= len(l.input) {
+func (l *Lexer) advance() rune {
+	ch, width := l.runeAt(0)
+	if width == 0 {
 		return 0
 	}
-	ch := l.input[l.pos]
-	l.pos++
+	l.pos += width
 	if ch == '\n' {
 		l.line++
 		l.column = 1
@@ -213,6 +410,29 @@ func (l *Lexer) advance() byte {
 	return ch
 }
 
+// newToken returns token at a stable address. Tokens are allocated in
+// blocks, since a parse makes one every few bytes of source.
+func (l *Lexer) newToken(token Token) *Token {
+	if len(l.tokens) == 0 {
+		l.tokens = make([]Token, 64)
+	}
+	t := &l.tokens[0]
+	l.tokens = l.tokens[1:]
+	*t = token
+	return t
+}
+
+// mark returns the position as an offset into the current line, which
+// stays valid when fill discards the input before it. text returns the
+// input from a mark on the same line up to the position.
+func (l *Lexer) mark() int {
+	return l.pos - l.lineStart
+}
+
+func (l *Lexer) text(mark int) string {
+	return l.input[l.lineStart+mark : l.pos]
+}
+
 func (l *Lexer) getLocation() Location {
 	end := l.pos
 	if end > len(l.input) {
@@ -221,96 +441,357 @@ func (l *Lexer) getLocation() Location {
 	return Location{
 		Line:   l.line,
 		Column: l.column,
+		Offset: l.base + l.pos,
 		Source: l.input[l.lineStart:end],
 	}
 }
 
 func (l *Lexer) NextToken() *Token {
-	for l.peek() == ' ' || l.peek() == '\n' || l.peek() == '\r' || l.peek() == '\t' {
-		l.advance()
+	token := l.scanToken()
+	if token != nil {
+		token.Location.EndLine = l.line
+		token.Location.EndColumn = l.column
+		token.Location.EndOffset = l.base + l.pos
+		if len(l.doc) > 0 {
+			token.Doc = strings.Join(l.doc, "\n")
+			l.doc = l.doc[:0]
+		}
 	}
+	return token
+}
 
-	if l.peek() == '/' && l.peekNext() == '/' {
+func (l *Lexer) scanToken() *Token {
+	// A #! line at the very start lets scripts run as executables.
+	if l.line == 1 && l.column == 1 && l.peek() == '#' && l.peekNext() == '!' {
 		for l.peek() != 0 && l.peek() != '\n' {
 			l.advance()
 		}
-		return l.NextToken()
 	}
-
+	l.skipTrivia()
 	if l.peek() == 0 {
 		return nil
 	}
 
 	loc := l.getLocation()
 
-	twoCharOps := []string{"==", "!=", "<=", ">=", "=>", "||", "&&", "++", "--", "::"}
+	l.fill(3)
+	if strings.HasPrefix(l.input[l.pos:], "...") {
+		l.advance()
+		l.advance()
+		l.advance()
+		return l.newToken(Token{Kind: TokenPunct, Value: "...", Location: loc})
+	}
+
+	twoCharOps := []string{"==", "!=", "<=", ">=", "=>", "||", "&&", "++", "--", "::", "??", "?."}
 	if l.pos+1 < len(l.input) {
 		twoChar := l.input[l.pos : l.pos+2]
 		for _, op := range twoCharOps {
 			if twoChar == op {
 				l.advance()
 				l.advance()
-				return &Token{Value: twoChar, Location: loc}
+				return l.newToken(Token{Kind: symbolKind(twoChar), Value: twoChar, Location: loc})
 			}
 		}
 	}
 
-	if isAlpha(l.peek()) || l.peek() == '_' {
-		var word strings.Builder
-		for isAlphaNum(l.peek()) || l.peek() == '_' {
-			word.WriteByte(l.advance())
+	if isIdentStart(l.peek()) {
+		start := l.mark()
+		for isIdentChar(l.peek()) {
+			l.advance()
+		}
+		word := l.text(start)
+		kind := TokenIdent
+		if keywords[word] {
+			kind = TokenKeyword
+		}
+		return l.newToken(Token{Kind: kind, Value: word, Location: loc})
+	}
+
+	if n := len(l.templates); n > 0 {
+		switch l.peek() {
+		case '{':
+			l.templates[n-1]++
+		case '}':
+			if l.templates[n-1] == 0 {
+				l.templates = l.templates[:n-1]
+				l.advance()
+				return l.readString(loc, true)
+			}
+			l.templates[n-1]--
 		}
-		return &Token{Value: word.String(), Location: loc}
 	}
 
 	if l.peek() == '"' {
 		l.advance()
-		var str strings.Builder
-		for l.peek() != 0 && l.peek() != '"' {
-			if l.peek() == '\\' {
+		return l.readString(loc, false)
+	}
+
+	if l.peek() == '\'' {
+		l.advance()
+		return l.readChar(loc)
+	}
+
+	if isDigit(l.peek()) {
+		return l.readNumber(loc)
+	}
+
+	start := l.mark()
+	var ch string
+	if r := l.advance(); r < utf8.RuneSelf {
+		ch = l.text(start)
+	} else {
+		ch = string(r)
+	}
+	return l.newToken(Token{Kind: symbolKind(ch), Value: ch, Location: loc})
+}
+
+// skipTrivia skips whitespace and comments: // to the end of the line and
+// /* */, which nest. The text of /// comments is kept for the next token;
+// a line of four or more slashes is an ordinary comment.
+func (l *Lexer) skipTrivia() {
+	for {
+		switch {
+		case l.peek() == ' ' || l.peek() == '\n' || l.peek() == '\r' || l.peek() == '\t':
+			l.advance()
+		case l.peek() == '/' && l.peekNext() == '/':
+			l.advance()
+			l.advance()
+			doc := l.peek() == '/' && l.peekNext() != '/'
+			if doc {
 				l.advance()
-				escaped := l.advance()
-				if escaped == 'n' {
-					str.WriteByte('\n')
-				} else if escaped == 't' {
-					str.WriteByte('\t')
-				} else if escaped == 'r' {
-					str.WriteByte('\r')
-				} else {
-					str.WriteByte(escaped)
-				}
-			} else {
-				str.WriteByte(l.advance())
 			}
+			start := l.mark()
+			for l.peek() != 0 && l.peek() != '\n' {
+				l.advance()
+			}
+			if doc {
+				text := strings.TrimSuffix(l.text(start), "\r")
+				l.doc = append(l.doc, strings.TrimPrefix(text, " "))
+			}
+		case l.peek() == '/' && l.peekNext() == '*':
+			l.blockComment()
+		default:
+			return
 		}
-		if l.peek() == '"' {
+	}
+}
+
+// blockComment skips a /* */ comment, and the comments nested in it.
+func (l *Lexer) blockComment() {
+	loc := l.getLocation()
+	depth := 0
+	for {
+		switch {
+		case l.peek() == 0:
+			l.fail(loc, "unterminated block comment")
+			return
+		case l.peek() == '/' && l.peekNext() == '*':
+			l.advance()
+			l.advance()
+			depth++
+		case l.peek() == '*' && l.peekNext() == '/':
+			l.advance()
+			l.advance()
+			if depth--; depth == 0 {
+				return
+			}
+		default:
 			l.advance()
 		}
-		return &Token{Value: "\"" + str.String() + "\"", Location: loc}
 	}
+}
 
-	if isDigit(l.peek()) {
-		var num strings.Builder
-		for isDigit(l.peek()) || l.peek() == '.' {
-			num.WriteByte(l.advance())
+// readNumber lexes a number: decimal digits with an optional fraction and
+// exponent, as in 1.5e-3, or an integer after 0x, 0o or 0b, any of them
+// with _ between digits, and an i after a decimal for an imaginary number.
+// The token keeps the digits as written, and a malformed number such as
+// 1.2.3 or 0xG is lexed whole for the parser to reject.
+func (l *Lexer) readNumber(loc Location) *Token {
+	start := l.mark()
+	if l.peek() == '0' && strings.ContainsRune("xXoObB", l.peekNext()) {
+		l.advance()
+		l.advance()
+		for isIdentChar(l.peek()) {
+			l.advance()
+		}
+		return l.newToken(Token{Kind: TokenNumber, Value: l.text(start), Location: loc})
+	}
+	decimal := func() {
+		for isDigit(l.peek()) || l.peek() == '_' {
+			l.advance()
+		}
+	}
+	decimal()
+	if l.peek() == '.' && isDigit(l.peekNext()) {
+		l.advance()
+		decimal()
+	}
+	if l.peek() == 'e' || l.peek() == 'E' {
+		next := l.peekNext()
+		if after, _ := l.runeAt(2); isDigit(next) || (next == '+' || next == '-') && isDigit(after) {
+			l.advance()
+			if next == '+' || next == '-' {
+				l.advance()
+			}
+			decimal()
 		}
-		return &Token{Value: num.String(), Location: loc}
 	}
+	for l.peek() == '.' && isDigit(l.peekNext()) {
+		l.advance()
+		decimal()
+	}
+	if l.peek() == 'i' && !isIdentChar(l.peekNext()) {
+		l.advance()
+	}
+	return l.newToken(Token{Kind: TokenNumber, Value: l.text(start), Location: loc})
+}
 
-	ch := l.advance()
-	return &Token{Value: string(ch), Location: loc}
+// readString lexes string contents after the opening quote, or after the
+// closing brace of an interpolated expression when resuming is set. It stops
+// at the closing quote or at an unescaped `${`.
+func (l *Lexer) readString(loc Location, resuming bool) *Token {
+	var str strings.Builder
+	for l.peek() != 0 && l.peek() != '"' {
+		if l.peek() == '$' && l.peekNext() == '{' {
+			l.advance()
+			l.advance()
+			l.templates = append(l.templates, 0)
+			part := TemplateHead
+			if resuming {
+				part = TemplateMiddle
+			}
+			return l.newToken(Token{Kind: TokenString, Value: str.String(), Template: part, Location: loc})
+		}
+		if l.peek() == '\\' {
+			str.WriteRune(l.readEscape())
+		} else {
+			str.WriteRune(l.advance())
+		}
+	}
+	if l.peek() == '"' {
+		l.advance()
+	}
+	part := TemplateNone
+	if resuming {
+		part = TemplateTail
+	}
+	return l.newToken(Token{Kind: TokenString, Value: str.String(), Template: part, Location: loc})
 }
 
-func isAlpha(c byte) bool {
-	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+// readChar lexes a character literal after its opening quote: one
+// character or escape sequence and the closing quote.
+func (l *Lexer) readChar(loc Location) *Token {
+	var chars []rune
+	for l.peek() != 0 && l.peek() != '\'' && l.peek() != '\n' {
+		if l.peek() == '\\' {
+			chars = append(chars, l.readEscape())
+		} else {
+			chars = append(chars, l.advance())
+		}
+	}
+	if l.peek() == '\'' {
+		l.advance()
+	} else {
+		l.fail(loc, "unterminated character literal")
+	}
+	switch {
+	case len(chars) == 0:
+		l.fail(loc, "empty character literal")
+	case len(chars) > 1:
+		l.fail(loc, "character literal '%s' holds more than one character", string(chars))
+	}
+	return l.newToken(Token{Kind: TokenChar, Value: string(chars), Location: loc})
 }
 
-func isDigit(c byte) bool {
-	return c >= '0' && c <= '9'
+// readEscape lexes an escape sequence in a string or character literal:
+// \n, \t, \r, \0, \\, \", \', \$ (which keeps ${ from interpolating), and
+// \u followed by four hex digits or by one to six in braces, as in \u{1F600}.
+// An unknown escape is an error reported at its backslash.
+func (l *Lexer) readEscape() rune {
+	loc := l.getLocation()
+	l.advance()
+	switch c := l.advance(); c {
+	case 'n':
+		return '\n'
+	case 't':
+		return '\t'
+	case 'r':
+		return '\r'
+	case '0':
+		return 0
+	case '\\', '"', '\'', '$':
+		return c
+	case 'u':
+		braced := l.peek() == '{'
+		if braced {
+			l.advance()
+		}
+		var code rune
+		digits := 0
+		for digits < 6 && isHexDigit(l.peek()) && (braced || digits < 4) {
+			code = code*16 + hexValue(l.advance())
+			digits++
+		}
+		if braced && l.peek() == '}' && digits > 0 {
+			l.advance()
+		} else if braced || digits < 4 {
+			l.fail(loc, "invalid unicode escape: use \\u and four hex digits, or \\u{...}")
+			return utf8.RuneError
+		}
+		if !utf8.ValidRune(code) {
+			l.fail(loc, "invalid unicode escape: U+%X is not a character", code)
+			return utf8.RuneError
+		}
+		return code
+	case 0:
+		l.fail(loc, "unterminated escape sequence")
+		return 0
+	default:
+		l.fail(loc, "unknown escape sequence \\%c", c)
+		return c
+	}
+}
+
+// fail records a lexical error at loc unless one came before it.
+func (l *Lexer) fail(loc Location, format string, args ...interface{}) {
+	if l.err == nil {
+		l.err = newError(ErrSyntax, format, args...).at(loc)
+	}
+}
+
+func isHexDigit(c rune) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func hexValue(c rune) rune {
+	switch {
+	case isDigit(c):
+		return c - '0'
+	case c >= 'a':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
+
+func symbolKind(symbol string) TokenKind {
+	if operatorTokens[symbol] {
+		return TokenOperator
+	}
+	return TokenPunct
+}
+
+// isIdentStart reports whether an identifier may begin with c: a letter
+// of any script or _. Digits of any script may follow.
+func isIdentStart(c rune) bool {
+	return unicode.IsLetter(c) || c == '_'
+}
+
+func isIdentChar(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_'
 }
 
-func isAlphaNum(c byte) bool {
-	return isAlpha(c) || isDigit(c)
+func isDigit(c rune) bool {
+	return c >= '0' && c <= '9'
 }
 
 // ============================================================================
@@ -326,6 +807,16 @@ const (
 	ExprUnary      ExprKind = "unary"
 	ExprCall       ExprKind = "call"
 	ExprMember     ExprKind = "member"
+	ExprArray      ExprKind = "array"
+	ExprIndex      ExprKind = "index"
+	ExprSlice      ExprKind = "slice"
+	ExprMap        ExprKind = "map"
+	ExprPropagate  ExprKind = "propagate"
+	ExprSpread     ExprKind = "spread"
+	ExprTuple      ExprKind = "tuple"
+	ExprIs         ExprKind = "is"
+	ExprAwait      ExprKind = "await"
+	ExprSpawn      ExprKind = "spawn"
 )
 
 type Expr struct {
@@ -341,6 +832,16 @@ type Expr struct {
 	Args     []*Expr
 	Object   *Expr
 	Property string
+	Elements []*Expr
+	Keys     []string
+	Index    *Expr
+	// Optional marks a member access written `obj?.field`.
+	Optional bool
+	// Interpolated marks the concatenation built from an interpolated string.
+	Interpolated bool
+	Location     Location
+	// addr is the slot of the variable an identifier names, if resolved.
+	addr varAddress
 }
 
 type StmtKind string
@@ -352,25 +853,62 @@ const (
 	StmtIf         StmtKind = "if"
 	StmtWhile      StmtKind = "while"
 	StmtFor        StmtKind = "for"
+	StmtForIn      StmtKind = "for_in"
 	StmtReturn     StmtKind = "return"
 	StmtBreak      StmtKind = "break"
 	StmtContinue   StmtKind = "continue"
 	StmtFunction   StmtKind = "function"
 	StmtImport     StmtKind = "import"
+	StmtThrow      StmtKind = "throw"
+	StmtTry        StmtKind = "try"
+	StmtMatch      StmtKind = "match"
+	StmtSelect     StmtKind = "select"
+	StmtEnum       StmtKind = "enum"
+	StmtClass      StmtKind = "class"
+	StmtInterface  StmtKind = "interface"
+	StmtDoWhile    StmtKind = "do_while"
 )
 
+// MatchPattern is one arm of a match statement: `_`, a variant such as
+// `Ok(v)` or `None`, an enum variant such as `Shape.Rect(w, h)`, or a value
+// compared with ==.
+type MatchPattern struct {
+	Wildcard bool
+	Enum     string
+	Tag      string
+	Bindings []string
+	Value    *Expr
+}
+
+// EnumVariant is one case of an enum declaration with its payload types.
+type EnumVariant struct {
+	Name   string
+	Fields []TypeDef
+}
+
+type MatchCase struct {
+	Pattern MatchPattern
+	Body    []*Stmt
+}
+
+// Param is a function parameter. A variadic parameter, written `...name`,
+// is always last and collects the remaining arguments into an array.
 type Param struct {
-	Name string
-	Type TypeDef
+	Name     string
+	Type     TypeDef
+	Variadic bool
 }
 
 type Stmt struct {
 	Kind       StmtKind
 	Name       string
+	Names      []string // destructured names of `let (a, b): tuple = ...`
 	Type       TypeDef
 	Value      *Expr
 	Mutable    bool
+	Const      bool
 	Target     string
+	TargetExpr *Expr
 	Expr       *Expr
 	Condition  *Expr
 	Then       []*Stmt
@@ -381,187 +919,876 @@ type Stmt struct {
 	Params     []Param
 	ReturnType TypeDef
 	Module     string
+	CatchName  string
+	Catch      []*Stmt
+	Finally    []*Stmt
+	Cases      []MatchCase
+	Variants   []EnumVariant
+	Async      bool
+	Location   Location
+	// layout gives a function's variables their slots, and addr is the
+	// slot an assignment's target lives in, if resolved.
+	layout *scopeLayout
+	addr   varAddress
 }
 
 // ============================================================================
 // PARSER
 // ============================================================================
 
+// Parser pulls tokens from the lexer on demand, buffering only as many as
+// lookahead requires.
 type Parser struct {
-	tokens []*Token
-	pos    int
+	lexer       *Lexer
+	buffer      []*Token
+	previous    *Token
+	consumed    int
+	diagnostics Diagnostics
+	// timeLexer makes the parser add the time spent in the lexer up in
+	// lexTime, so the phase log can report lexing apart from parsing.
+	timeLexer bool
+	lexTime   time.Duration
 }
 
 func NewParser(input string) *Parser {
-	lexer := NewLexer(input)
-	var tokens []*Token
-	for {
-		token := lexer.NextToken()
+	return NewParserFromLexer(NewLexer(input))
+}
+
+// NewParserReader parses source streamed from r.
+func NewParserReader(r io.Reader) *Parser {
+	return NewParserFromLexer(NewLexerReader(r))
+}
+
+func NewParserFromLexer(lexer *Lexer) *Parser {
+	return &Parser{lexer: lexer}
+}
+
+// lookahead returns the token n positions past the current one, or nil at
+// end of input.
+func (p *Parser) lookahead(n int) *Token {
+	for len(p.buffer) <= n {
+		var start time.Time
+		if p.timeLexer {
+			start = time.Now()
+		}
+		token := p.lexer.NextToken()
+		if p.timeLexer {
+			p.lexTime += time.Since(start)
+		}
 		if token == nil {
-			break
+			return nil
 		}
-		tokens = append(tokens, token)
+		p.buffer = append(p.buffer, token)
 	}
-	return &Parser{tokens: tokens, pos: 0}
+	return p.buffer[n]
 }
 
 func (p *Parser) current() *Token {
-	if p.pos >= len(p.tokens) {
-		return nil
-	}
-	return p.tokens[p.pos]
+	return p.lookahead(0)
 }
 
 func (p *Parser) advance() {
-	p.pos++
+	if p.current() == nil {
+		return
+	}
+	p.previous = p.buffer[0]
+	copy(p.buffer, p.buffer[1:])
+	p.buffer[len(p.buffer)-1] = nil
+	p.buffer = p.buffer[:len(p.buffer)-1]
+	p.consumed++
+}
+
+// TokenCount returns the number of tokens consumed so far.
+func (p *Parser) TokenCount() int {
+	return p.consumed
+}
+
+// at reports whether the current token is the given keyword, identifier,
+// operator or punctuation. String and character literals never match, so
+// "if" as a string is not mistaken for the keyword.
+func (p *Parser) at(value string) bool {
+	tok := p.current()
+	return tok != nil && !tok.quoted() && tok.Value == value
+}
+
+func (p *Parser) atKind(kind TokenKind) bool {
+	tok := p.current()
+	return tok != nil && tok.Kind == kind
 }
 
 func (p *Parser) expect(token string) error {
-	if p.current() == nil || p.current().Value != token {
-		line := 0
-		if p.current() != nil {
-			line = p.current().Location.Line
-		}
-		return fmt.Errorf("expected %s at line %d", token, line)
+	if !p.at(token) {
+		return p.errorf(ErrSyntax, "expected %s", token)
 	}
 	p.advance()
 	return nil
 }
 
-func (p *Parser) precedence(op string) int {
-	precs := map[string]int{
-		"||": 1, "&&": 2,
-		"==": 3, "!=": 3,
-		"<": 4, ">": 4, "<=": 4, ">=": 4,
-		"+": 5, "-": 5,
-		"*": 6, "/": 6, "%": 6,
+// errorf creates an error at the current token, or at the last one at end
+// of input.
+func (p *Parser) errorf(code ErrorCode, format string, args ...interface{}) *StrataError {
+	err := newError(code, format, args...)
+	if tok := p.current(); tok != nil {
+		return err.at(tok.Location)
 	}
-	if prec, ok := precs[op]; ok {
-		return prec
+	if p.previous != nil {
+		err.at(p.previous.Location)
 	}
-	return 0
+	return err
 }
 
-func (p *Parser) parseUnary() (*Expr, error) {
-	if p.current() != nil {
-		op := p.current().Value
-		if op == "!" || op == "-" || op == "+" || op == "~" {
-			p.advance()
-			operand, err := p.parseUnary()
-			if err != nil {
-				return nil, err
-			}
-			return &Expr{Kind: ExprUnary, Op: op, Operand: operand}, nil
-		}
+// span extends start to the end of the most recently consumed token.
+func (p *Parser) span(start Location) Location {
+	if p.previous != nil {
+		end := p.previous.Location
+		start.EndLine, start.EndColumn, start.EndOffset = end.EndLine, end.EndColumn, end.EndOffset
 	}
-	return p.parsePrimary()
+	return start
 }
 
-func (p *Parser) parsePrimary() (*Expr, error) {
+func (p *Parser) expectValue(what string) (string, error) {
 	if p.current() == nil {
-		return nil, fmt.Errorf("unexpected end of input")
+		return "", p.errorf(ErrSyntax, "expected %s at end of input", what)
 	}
+	value := p.current().Value
+	p.advance()
+	return value, nil
+}
 
-	token := p.current().Value
-	if token == "" {
-		return nil, fmt.Errorf("unexpected empty token")
+// expectType reads a type name, including the `?` of an optional type such
+// as `int?`.
+func (p *Parser) expectType(what string) (string, error) {
+	name, err := p.expectValue(what)
+	if err != nil {
+		return "", err
 	}
-
-	if len(token) > 0 && isDigit(token[0]) {
+	if p.at("<") {
+		// parameters such as list<int> or map<string, float>
 		p.advance()
-		if strings.Contains(token, ".") {
-			val, _ := strconv.ParseFloat(token, 64)
-			return &Expr{Kind: ExprLiteral, Value: val, Type: TypeDef{Kind: KindPrimitive, Primitive: TypeFloat}}, nil
+		var params []string
+		for p.current() != nil && !p.at(">") {
+			param, err := p.expectType("type parameter")
+			if err != nil {
+				return "", err
+			}
+			params = append(params, param)
+			if !p.at(",") {
+				break
+			}
+			p.advance()
+		}
+		if err := p.expect(">"); err != nil {
+			return "", err
+		}
+		base := name
+		name += "<" + strings.Join(params, ", ") + ">"
+		if _, ok := parseGeneric(name); !ok {
+			return "", newError(ErrSyntax, "invalid type parameters for %s", base).at(p.previous.Location)
 		}
-		val, _ := strconv.ParseInt(token, 10, 64)
-		return &Expr{Kind: ExprLiteral, Value: val, Type: TypeDef{Kind: KindPrimitive, Primitive: TypeInt}}, nil
 	}
-
-	if strings.HasPrefix(token, "\"") {
+	if p.at("?") {
 		p.advance()
-		strVal := token[1 : len(token)-1]
-		return &Expr{Kind: ExprLiteral, Value: strVal, Type: TypeDef{Kind: KindPrimitive, Primitive: TypeString}}, nil
+		name += "?"
 	}
+	return name, nil
+}
+
+var operatorPrecedence = map[string]int{
+	"??": 1,
+	"||": 2, "&&": 3,
+	"==": 4, "!=": 4,
+	"<": 5, ">": 5, "<=": 5, ">=": 5, "is": 5,
+	"+": 6, "-": 6,
+	"*": 7, "/": 7, "%": 7,
+}
+
+func (p *Parser) precedence(op string) int {
+	return operatorPrecedence[op]
+}
 
-	if token == "true" || token == "false" {
+func (p *Parser) parseUnary() (*Expr, error) {
+	if p.at("await") {
+		start := p.current().Location
 		p.advance()
-		return &Expr{Kind: ExprLiteral, Value: token == "true", Type: TypeDef{Kind: KindPrimitive, Primitive: TypeBool}}, nil
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Expr{Kind: ExprAwait, Operand: operand, Location: p.span(start)}, nil
 	}
-
-	if isAlpha(token[0]) || token[0] == '_' {
-		expr := &Expr{Kind: ExprIdentifier, Name: token}
+	if p.at("spawn") {
+		start := p.current().Location
 		p.advance()
+		call, err := p.parsePostfix()
+		if err != nil {
+			return nil, err
+		}
+		if call.Kind != ExprCall {
+			return nil, p.errorf(ErrSyntax, "spawn expects a function call")
+		}
+		return &Expr{Kind: ExprSpawn, Operand: call, Location: p.span(start)}, nil
+	}
+	if p.atKind(TokenOperator) {
+		op := p.current().Value
+		if op == "!" || op == "-" || op == "+" || op == "~" {
+			start := p.current().Location
+			p.advance()
+			operand, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			return &Expr{Kind: ExprUnary, Op: op, Operand: operand, Location: p.span(start)}, nil
+		}
+	}
+	return p.parsePostfix()
+}
 
-		for p.current() != nil && (p.current().Value == "." || p.current().Value == "::") {
-			sep := p.current().Value
-			p.advance()
-			if p.current() == nil {
-				return nil, fmt.Errorf("expected property name after %s", sep)
-			}
-			property := p.current().Value
-			p.advance()
-
-			if p.current() != nil && p.current().Value == "(" {
-				p.advance()
-				var args []*Expr
-				for p.current() != nil && p.current().Value != ")" {
-					arg, err := p.parseBinary(0)
-					if err != nil {
-						return nil, err
-					}
-					args = append(args, arg)
-					if p.current() != nil && p.current().Value == "," {
-						p.advance()
-					}
+// parsePostfix parses a primary expression followed by any number of index
+// and call suffixes such as `grid[1][2]` or `handlers[0](event)`.
+func (p *Parser) parsePostfix() (*Expr, error) {
+	if p.current() == nil {
+		return nil, p.errorf(ErrSyntax, "unexpected end of input")
+	}
+	start := p.current().Location
+	expr, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.at("[") || p.at("(") || p.at("?") || p.at(".") || p.at("?.") {
+		if p.at(".") || p.at("?.") {
+			sep := p.current().Value
+			p.advance()
+			property, err := p.expectValue("property name after " + sep)
+			if err != nil {
+				return nil, err
+			}
+			expr = &Expr{Kind: ExprMember, Object: expr, Property: property, Optional: sep == "?.", Location: p.span(start)}
+			continue
+		}
+		if p.at("?") {
+			p.advance()
+			expr = &Expr{Kind: ExprPropagate, Operand: expr, Location: p.span(start)}
+			continue
+		}
+		if p.at("(") {
+			p.advance()
+			args, err := p.parseList(")")
+			if err != nil {
+				return nil, err
+			}
+			expr = &Expr{Kind: ExprCall, Func: expr, Args: args, Location: p.span(start)}
+			continue
+		}
+		p.advance()
+		var index *Expr
+		if !p.at(":") {
+			if index, err = p.parseBinary(0); err != nil {
+				return nil, err
+			}
+		}
+		if p.at(":") {
+			// a slice: obj[start:end], either bound may be left out
+			p.advance()
+			var end *Expr
+			if !p.at("]") {
+				if end, err = p.parseBinary(0); err != nil {
+					return nil, err
 				}
-				if err := p.expect(")"); err != nil {
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			expr = &Expr{Kind: ExprSlice, Object: expr, Left: index, Right: end, Location: p.span(start)}
+			continue
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		expr = &Expr{Kind: ExprIndex, Object: expr, Index: index, Location: p.span(start)}
+	}
+	return expr, nil
+}
+
+// parseList parses comma-separated expressions up to and including the
+// closing token. A trailing comma is allowed.
+func (p *Parser) parseList(closing string) ([]*Expr, error) {
+	var items []*Expr
+	for p.current() != nil && !p.at(closing) {
+		start := p.current().Location
+		spread := p.at("...")
+		if spread {
+			p.advance()
+		}
+		item, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		if spread {
+			item = &Expr{Kind: ExprSpread, Operand: item, Location: p.span(start)}
+		}
+		items = append(items, item)
+		if !p.at(",") {
+			break
+		}
+		p.advance()
+	}
+	if err := p.expect(closing); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// parseNumber converts the text of a number token to an int64, a float64
+// or, with an i, a complex128 that is purely imaginary.
+func parseNumber(text string) (interface{}, *StrataError) {
+	invalid := newError(ErrSyntax, "invalid number %s", text)
+	if len(text) > 2 && text[0] == '0' && strings.ContainsRune("xXoObB", rune(text[1])) {
+		val, err := strconv.ParseInt(text, 0, 64)
+		if errors.Is(err, strconv.ErrRange) {
+			return nil, intTooLarge(text)
+		}
+		if err != nil {
+			return nil, invalid
+		}
+		return val, nil
+	}
+	digits, imaginary := strings.CutSuffix(text, "i")
+	for idx := 0; idx < len(digits); idx++ {
+		if digits[idx] == '_' && (idx == 0 || idx == len(digits)-1 || !isDigit(rune(digits[idx-1])) || !isDigit(rune(digits[idx+1]))) {
+			return nil, newError(ErrSyntax, "invalid number %s: _ must separate digits", text)
+		}
+	}
+	digits = strings.ReplaceAll(digits, "_", "")
+	if strings.Count(digits, ".") > 1 {
+		return nil, invalid
+	}
+	if imaginary || strings.ContainsAny(digits, ".eE") {
+		val, err := strconv.ParseFloat(digits, 64)
+		if math.IsInf(val, 0) {
+			return nil, newError(ErrSyntax, "number %s is too large for a float", text)
+		}
+		if err != nil && !errors.Is(err, strconv.ErrRange) {
+			return nil, invalid
+		}
+		if imaginary {
+			return complex(0, val), nil
+		}
+		return val, nil
+	}
+	val, err := strconv.ParseInt(digits, 10, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		return nil, intTooLarge(text)
+	}
+	if err != nil {
+		return nil, invalid
+	}
+	return val, nil
+}
+
+// intTooLarge is the error for an integer literal past int64, which u64
+// values are held in too.
+func intTooLarge(text string) *StrataError {
+	return newError(ErrSyntax, "integer %s does not fit in 64 bits", text).withHint("integers, u64 included, are signed 64-bit, at most 9223372036854775807")
+}
+
+func (p *Parser) parsePrimary() (*Expr, error) {
+	if p.current() == nil {
+		return nil, p.errorf(ErrSyntax, "unexpected end of input")
+	}
+
+	kind := p.current().Kind
+	token := p.current().Value
+	start := p.current().Location
+
+	if kind == TokenNumber {
+		value, err := parseNumber(token)
+		if err != nil {
+			return nil, err.at(start)
+		}
+		p.advance()
+		var primitive PrimitiveType
+		switch value.(type) {
+		case complex128:
+			primitive = TypeComplex
+		case float64:
+			primitive = TypeFloat
+		default:
+			primitive = TypeInt
+		}
+		return &Expr{Kind: ExprLiteral, Value: value, Type: TypeDef{Kind: KindPrimitive, Primitive: primitive}, Location: p.span(start)}, nil
+	}
+
+	if kind == TokenString {
+		if p.current().Template == TemplateHead {
+			return p.parseInterpolation(start)
+		}
+		p.advance()
+		return &Expr{Kind: ExprLiteral, Value: token, Type: TypeDef{Kind: KindPrimitive, Primitive: TypeString}, Location: p.span(start)}, nil
+	}
+
+	if kind == TokenChar {
+		p.advance()
+		return &Expr{Kind: ExprLiteral, Value: token, Type: TypeDef{Kind: KindPrimitive, Primitive: TypeChar}, Location: p.span(start)}, nil
+	}
+
+	if kind == TokenKeyword && token == "null" {
+		p.advance()
+		return &Expr{Kind: ExprLiteral, Value: nil, Type: TypeDef{Kind: KindPrimitive, Primitive: TypeNull}, Location: p.span(start)}, nil
+	}
+
+	if kind == TokenKeyword && (token == "true" || token == "false") {
+		p.advance()
+		return &Expr{Kind: ExprLiteral, Value: token == "true", Type: TypeDef{Kind: KindPrimitive, Primitive: TypeBool}, Location: p.span(start)}, nil
+	}
+
+	if kind == TokenIdent {
+		p.advance()
+		expr := &Expr{Kind: ExprIdentifier, Name: token, Location: p.span(start)}
+
+		for p.at(".") || p.at("::") {
+			sep := p.current().Value
+			p.advance()
+			if p.current() == nil {
+				return nil, p.errorf(ErrSyntax, "expected property name after %s", sep)
+			}
+			property := p.current().Value
+			p.advance()
+			memberLoc := p.span(start)
+
+			if p.at("(") {
+				p.advance()
+				args, err := p.parseList(")")
+				if err != nil {
 					return nil, err
 				}
 				expr = &Expr{
-					Kind: ExprCall,
-					Func: &Expr{Kind: ExprMember, Object: expr, Property: property},
-					Args: args,
+					Kind:     ExprCall,
+					Func:     &Expr{Kind: ExprMember, Object: expr, Property: property, Location: memberLoc},
+					Args:     args,
+					Location: p.span(start),
 				}
 			} else {
-				expr = &Expr{Kind: ExprMember, Object: expr, Property: property}
+				expr = &Expr{Kind: ExprMember, Object: expr, Property: property, Location: p.span(start)}
+			}
+		}
+
+		if p.at("(") {
+			p.advance()
+			args, err := p.parseList(")")
+			if err != nil {
+				return nil, err
+			}
+			return &Expr{Kind: ExprCall, Func: expr, Args: args, Location: p.span(start)}, nil
+		}
+
+		return expr, nil
+	}
+
+	if p.at("[") {
+		p.advance()
+		elements, err := p.parseList("]")
+		if err != nil {
+			return nil, err
+		}
+		return &Expr{Kind: ExprArray, Elements: elements, Type: TypeDef{Kind: KindPrimitive, Primitive: TypeArray}, Location: p.span(start)}, nil
+	}
+
+	if p.at("{") {
+		p.advance()
+		return p.parseMapLiteral(start)
+	}
+
+	if p.at("(") {
+		p.advance()
+		if p.at(")") {
+			p.advance()
+			return &Expr{Kind: ExprTuple, Type: TypeDef{Kind: KindPrimitive, Primitive: TypeTuple}, Location: p.span(start)}, nil
+		}
+		expr, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		if p.at(",") {
+			p.advance()
+			rest, err := p.parseList(")")
+			if err != nil {
+				return nil, err
+			}
+			elements := append([]*Expr{expr}, rest...)
+			return &Expr{Kind: ExprTuple, Elements: elements, Type: TypeDef{Kind: KindPrimitive, Primitive: TypeTuple}, Location: p.span(start)}, nil
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	}
+
+	return nil, p.errorf(ErrSyntax, "unexpected token: %s", token)
+}
+
+// isMatchStatement distinguishes `match (x) {` from a call to the match
+// builtin by looking past the balanced parentheses for an opening brace.
+func (p *Parser) isMatchStatement() bool {
+	if tok := p.lookahead(1); tok == nil || tok.quoted() || tok.Value != "(" {
+		return false
+	}
+	depth := 0
+	for n := 1; ; n++ {
+		tok := p.lookahead(n)
+		if tok == nil {
+			return false
+		}
+		if tok.quoted() {
+			continue
+		}
+		switch tok.Value {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				next := p.lookahead(n + 1)
+				return next != nil && next.Kind == TokenPunct && next.Value == "{"
+			}
+		}
+	}
+}
+
+func (p *Parser) parseMatch() (*Stmt, error) {
+	p.advance()
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	subject, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	stmt := &Stmt{Kind: StmtMatch, Value: subject}
+	for p.current() != nil && !p.at("}") {
+		pattern, err := p.parsePattern()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("=>"); err != nil {
+			return nil, err
+		}
+		body, err := p.parseCaseBody()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Cases = append(stmt.Cases, MatchCase{Pattern: pattern, Body: body})
+		if p.at(",") {
+			p.advance()
+		}
+	}
+	if err := p.expect("}"); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// parseCaseBody parses what follows the => of a match or select case: a
+// block or a single statement.
+func (p *Parser) parseCaseBody() ([]*Stmt, error) {
+	if p.at("{") {
+		return p.parseBlock()
+	}
+	single, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	if single == nil {
+		return nil, p.errorf(ErrSyntax, "expected a statement after =>")
+	}
+	return []*Stmt{single}, nil
+}
+
+// parseSelect parses `select { [name =] channel.op(...) => body ... }`,
+// where op is send or receive and only a receive may bind a name.
+func (p *Parser) parseSelect() (*Stmt, error) {
+	p.advance()
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	stmt := &Stmt{Kind: StmtSelect}
+	for p.current() != nil && !p.at("}") {
+		var pattern MatchPattern
+		if p.at("_") {
+			p.advance()
+			pattern.Wildcard = true
+		} else {
+			if next := p.lookahead(1); p.atKind(TokenIdent) && next != nil && !next.quoted() && next.Value == "=" {
+				pattern.Bindings = []string{p.current().Value}
+				p.advance()
+				p.advance()
+			}
+			op, err := p.parsePostfix()
+			if err != nil {
+				return nil, err
+			}
+			if !isChannelOp(op) {
+				return nil, p.errorf(ErrSyntax, "select cases must send or receive on a channel")
+			}
+			if pattern.Bindings != nil && op.Func.Property != "receive" {
+				return nil, p.errorf(ErrSyntax, "only a receive can bind a name in select")
+			}
+			pattern.Value = op
+		}
+		if err := p.expect("=>"); err != nil {
+			return nil, err
+		}
+		body, err := p.parseCaseBody()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Cases = append(stmt.Cases, MatchCase{Pattern: pattern, Body: body})
+		if p.at(",") {
+			p.advance()
+		}
+	}
+	if err := p.expect("}"); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+func (p *Parser) parsePattern() (MatchPattern, error) {
+	tok := p.current()
+	if tok == nil {
+		return MatchPattern{}, p.errorf(ErrSyntax, "expected pattern at end of input")
+	}
+	if tok.Kind == TokenIdent {
+		if tok.Value == "_" {
+			p.advance()
+			return MatchPattern{Wildcard: true}, nil
+		}
+		if binds, ok := variantTags[tok.Value]; ok {
+			p.advance()
+			pattern := MatchPattern{Tag: tok.Value}
+			if binds && p.at("(") {
+				p.advance()
+				name, err := p.expectValue("pattern binding")
+				if err != nil {
+					return MatchPattern{}, err
+				}
+				if err := p.expect(")"); err != nil {
+					return MatchPattern{}, err
+				}
+				pattern.Bindings = []string{name}
 			}
+			return pattern, nil
+		}
+		if p.isEnumPattern() {
+			return p.parseEnumPattern()
+		}
+	}
+	value, err := p.parseUnary()
+	if err != nil {
+		return MatchPattern{}, err
+	}
+	return MatchPattern{Value: value}, nil
+}
+
+// isEnumPattern reports whether the tokens ahead read `Enum.Variant(`.
+// Without a payload list `Enum.Variant` is matched as a value.
+func (p *Parser) isEnumPattern() bool {
+	for n, want := range []string{".", "", "("} {
+		tok := p.lookahead(n + 1)
+		if tok == nil || tok.quoted() || (want != "" && tok.Value != want) {
+			return false
 		}
+	}
+	return true
+}
 
-		if p.current() != nil && p.current().Value == "(" {
+func (p *Parser) parseEnumPattern() (MatchPattern, error) {
+	pattern := MatchPattern{Enum: p.current().Value}
+	p.advance()
+	p.advance()
+	pattern.Tag = p.current().Value
+	p.advance()
+	p.advance()
+	for p.current() != nil && !p.at(")") {
+		name, err := p.expectValue("pattern binding")
+		if err != nil {
+			return MatchPattern{}, err
+		}
+		pattern.Bindings = append(pattern.Bindings, name)
+		if !p.at(",") {
+			break
+		}
+		p.advance()
+	}
+	if err := p.expect(")"); err != nil {
+		return MatchPattern{}, err
+	}
+	return pattern, nil
+}
+
+// parseEnum parses `enum Name { A, B(float), C(float, float) }`.
+func (p *Parser) parseEnum() (*Stmt, error) {
+	p.advance()
+	name, err := p.expectValue("enum name")
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	stmt := &Stmt{Kind: StmtEnum, Name: name}
+	for p.current() != nil && !p.at("}") {
+		variantName, err := p.expectValue("enum variant")
+		if err != nil {
+			return nil, err
+		}
+		variant := EnumVariant{Name: variantName}
+		if p.at("(") {
 			p.advance()
-			var args []*Expr
-			for p.current() != nil && p.current().Value != ")" {
-				arg, err := p.parseBinary(0)
+			for p.current() != nil && !p.at(")") {
+				field, err := p.expectType("payload type")
 				if err != nil {
 					return nil, err
 				}
-				args = append(args, arg)
-				if p.current() != nil && p.current().Value == "," {
-					p.advance()
+				variant.Fields = append(variant.Fields, parseTypeAnnotation(field))
+				if !p.at(",") {
+					break
 				}
+				p.advance()
 			}
 			if err := p.expect(")"); err != nil {
 				return nil, err
 			}
-			return &Expr{Kind: ExprCall, Func: expr, Args: args}, nil
 		}
+		stmt.Variants = append(stmt.Variants, variant)
+		if !p.at(",") {
+			break
+		}
+		p.advance()
+	}
+	if err := p.expect("}"); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// parseLoopElse parses the optional `else { ... }` after a loop, which runs
+// when the loop ends without break.
+// parseForIn parses the rest of `for (name in iterable) { ... }` after the
+// opening parenthesis.
+func (p *Parser) parseForIn() (*Stmt, error) {
+	name := p.current().Value
+	p.advance()
+	p.advance()
+	iterable, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	body, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+	elseBody, err := p.parseLoopElse()
+	if err != nil {
+		return nil, err
+	}
+	return &Stmt{Kind: StmtForIn, Name: name, Value: iterable, Body: body, Else: elseBody}, nil
+}
+
+func (p *Parser) parseLoopElse() ([]*Stmt, error) {
+	if !p.at("else") {
+		return nil, nil
+	}
+	p.advance()
+	return p.parseBlock()
+}
+
+// parseBlock parses a brace-delimited statement list.
+func (p *Parser) parseBlock() ([]*Stmt, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var body []*Stmt
+	for p.current() != nil && !p.at("}") {
+		start := p.consumed
+		stmt, err := p.parseStatement()
+		if err != nil {
+			p.recover(err, start)
+			continue
+		}
+		body = append(body, stmt)
+	}
+	if err := p.expect("}"); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
 
-		return expr, nil
+// parseInterpolation turns `"a ${x} b"` into the concatenation
+// "a " + x + " b". Literal text is kept even when empty, so the chain starts
+// with a string, every embedded value is converted with toString, and the
+// printer can tell text from expressions.
+func (p *Parser) parseInterpolation(start Location) (*Expr, error) {
+	stringLiteral := func(tok *Token) *Expr {
+		return &Expr{Kind: ExprLiteral, Value: tok.Value, Type: TypeDef{Kind: KindPrimitive, Primitive: TypeString}, Location: tok.Location}
+	}
+	expr := stringLiteral(p.current())
+	p.advance()
+	for {
+		value, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		expr = &Expr{Kind: ExprBinary, Op: "+", Left: expr, Right: value, Interpolated: true, Location: p.span(start)}
+		tok := p.current()
+		if tok == nil || tok.Kind != TokenString || (tok.Template != TemplateMiddle && tok.Template != TemplateTail) {
+			return nil, newError(ErrSyntax, "expected } to close interpolation").at(start)
+		}
+		p.advance()
+		expr = &Expr{Kind: ExprBinary, Op: "+", Left: expr, Right: stringLiteral(tok), Interpolated: true, Location: p.span(start)}
+		if tok.Template == TemplateTail {
+			return expr, nil
+		}
 	}
+}
 
-	if token == "(" {
+// parseMapLiteral parses the entries of `{ "key": value, ... }` after the
+// opening brace.
+func (p *Parser) parseMapLiteral(start Location) (*Expr, error) {
+	expr := &Expr{Kind: ExprMap, Type: TypeDef{Kind: KindPrimitive, Primitive: TypeMap}}
+	for p.current() != nil && !p.at("}") {
+		key := p.current()
+		if key.Kind != TokenString || key.Template != TemplateNone {
+			return nil, newError(ErrSyntax, "map keys must be string literals").at(key.Location).withHint("quote the key, as in {\"name\": value}")
+		}
 		p.advance()
-		expr, err := p.parseBinary(0)
-		if err != nil {
+		if err := p.expect(":"); err != nil {
 			return nil, err
 		}
-		if err := p.expect(")"); err != nil {
+		value, err := p.parseBinary(0)
+		if err != nil {
 			return nil, err
 		}
-		return expr, nil
+		expr.Keys = append(expr.Keys, key.Value)
+		expr.Elements = append(expr.Elements, value)
+		if !p.at(",") {
+			break
+		}
+		p.advance()
 	}
-
-	return nil, fmt.Errorf("unexpected token: %s", token)
+	if err := p.expect("}"); err != nil {
+		return nil, err
+	}
+	expr.Location = p.span(start)
+	return expr, nil
 }
 
 func (p *Parser) parseBinary(minPrec int) (*Expr, error) {
@@ -570,7 +1797,17 @@ func (p *Parser) parseBinary(minPrec int) (*Expr, error) {
 		return nil, err
 	}
 
-	for p.current() != nil && p.precedence(p.current().Value) > minPrec {
+	for (p.atKind(TokenOperator) || p.at("is")) && p.precedence(p.current().Value) > minPrec {
+		if p.at("is") {
+			// the right-hand side of is is a type name, not an expression
+			p.advance()
+			typeName, err := p.expectType("type name after is")
+			if err != nil {
+				return nil, err
+			}
+			left = &Expr{Kind: ExprIs, Operand: left, Name: typeName, Location: p.span(left.Location)}
+			continue
+		}
 		op := p.current().Value
 		prec := p.precedence(op)
 		if prec == 0 {
@@ -581,49 +1818,225 @@ func (p *Parser) parseBinary(minPrec int) (*Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		left = &Expr{Kind: ExprBinary, Op: op, Left: left, Right: right}
+		left = &Expr{Kind: ExprBinary, Op: op, Left: left, Right: right, Location: p.span(left.Location)}
 	}
 
 	return left, nil
 }
 
+// Parse parses the whole input. A statement that fails to parse is recorded
+// and skipped, so one run reports every syntax error it can find.
 func (p *Parser) Parse() ([]*Stmt, error) {
 	var statements []*Stmt
 	for p.current() != nil {
+		start := p.consumed
 		stmt, err := p.parseStatement()
 		if err != nil {
-			return nil, err
+			p.recover(err, start)
+			continue
 		}
 		if stmt == nil {
 			break
 		}
 		statements = append(statements, stmt)
 	}
+	if err := p.lexer.Err(); err != nil {
+		return nil, err
+	}
+	if len(p.diagnostics) > 0 {
+		return nil, p.diagnostics
+	}
+	resolveProgram(statements)
 	return statements, nil
 }
 
+// recover records err at the token it was found at and skips to where the
+// next statement is likely to begin: the first token on a later line outside
+// any braces opened since, or the brace closing the enclosing block.
+func (p *Parser) recover(err error, start int) {
+	at := p.current()
+	if at == nil {
+		at = p.previous
+	}
+	var loc Location
+	if at != nil {
+		loc = at.Location
+	}
+	p.diagnostics = append(p.diagnostics, diagnose(err, ErrSyntax, loc))
+	if p.consumed == start {
+		p.advance()
+	}
+	depth := 0
+	for tok := p.current(); tok != nil; tok = p.current() {
+		if depth == 0 && !tok.quoted() && (tok.Value == "}" || tok.Location.Line > p.previous.Location.Line) {
+			return
+		}
+		if !tok.quoted() {
+			switch tok.Value {
+			case "{":
+				depth++
+			case "}":
+				depth--
+			}
+		}
+		p.advance()
+	}
+}
+
+// parseClass parses `class Name { var field: T = value  func method() => T { } }`.
+// Members are field declarations and methods.
+func (p *Parser) parseClass() (*Stmt, error) {
+	p.advance()
+	name, err := p.expectValue("class name")
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range body {
+		if member == nil || (member.Kind != StmtFunction && (member.Kind != StmtLet || member.Names != nil)) {
+			return nil, newError(ErrSyntax, "class %s may only contain fields and methods", name).at(p.previous.Location)
+		}
+	}
+	return &Stmt{Kind: StmtClass, Name: name, Body: body}, nil
+}
+
+// parseSignature parses `func name(params) => type`, the part of a function
+// declaration before its body.
+func (p *Parser) parseSignature() (*Stmt, error) {
+	p.advance()
+	name, err := p.expectValue("function name")
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var params []Param
+	for p.current() != nil && !p.at(")") {
+		if len(params) > 0 && params[len(params)-1].Variadic {
+			return nil, p.errorf(ErrSyntax, "variadic parameter %s must be last", params[len(params)-1].Name)
+		}
+		variadic := p.at("...")
+		if variadic {
+			p.advance()
+		}
+		pname, err := p.expectValue("parameter name")
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		ptype, err := p.expectType("parameter type")
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, Param{Name: pname, Type: parseTypeAnnotation(ptype), Variadic: variadic})
+		if p.at(",") {
+			p.advance()
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("=>"); err != nil {
+		return nil, err
+	}
+	returnTypeStr, err := p.expectType("return type")
+	if err != nil {
+		return nil, err
+	}
+	return &Stmt{
+		Kind:       StmtFunction,
+		Name:       name,
+		Params:     params,
+		ReturnType: parseTypeAnnotation(returnTypeStr),
+	}, nil
+}
+
+// parseInterface parses `interface Name { func method(params) => type }`.
+func (p *Parser) parseInterface() (*Stmt, error) {
+	p.advance()
+	name, err := p.expectValue("interface name")
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	stmt := &Stmt{Kind: StmtInterface, Name: name}
+	for p.current() != nil && !p.at("}") {
+		if !p.at("func") {
+			return nil, p.errorf(ErrSyntax, "interface %s may only contain method signatures", name)
+		}
+		loc := p.current().Location
+		method, err := p.parseSignature()
+		if err != nil {
+			return nil, err
+		}
+		method.Location = loc
+		stmt.Body = append(stmt.Body, method)
+	}
+	if err := p.expect("}"); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
 func (p *Parser) parseStatement() (*Stmt, error) {
 	if p.current() == nil {
 		return nil, nil
 	}
+	loc := p.current().Location
+	stmt, err := p.parseStatementBody()
+	if stmt != nil {
+		stmt.Location = p.span(loc)
+	}
+	return stmt, err
+}
 
-	token := p.current().Value
-	if token == "" || token == "}" {
+func (p *Parser) parseStatementBody() (*Stmt, error) {
+	if p.at("}") {
 		return nil, nil
 	}
+	token := ""
+	if p.atKind(TokenKeyword) {
+		token = p.current().Value
+	}
+
+	// export is not a keyword, but written before a declaration it would
+	// otherwise parse as a stray variable and fail only when run.
+	if p.atKind(TokenIdent) && p.current().Value == "export" {
+		if next := p.lookahead(1); next != nil && next.Kind == TokenKeyword && exportable[next.Value] {
+			return nil, p.errorf(ErrSyntax, "unexpected export").withHint("modules export every top-level name not starting with _; remove export")
+		}
+	}
 
 	if token == "import" {
 		p.advance()
-		name := p.current().Value
-		p.advance()
+		name, err := p.expectValue("module alias")
+		if err != nil {
+			return nil, err
+		}
 		if err := p.expect("from"); err != nil {
 			return nil, err
 		}
 
-		var moduleParts []string
-		moduleParts = append(moduleParts, p.current().Value)
-		p.advance()
-		for p.current() != nil && p.current().Value == "::" {
+		if p.atKind(TokenString) {
+			path := p.current().Value
+			p.advance()
+			return &Stmt{Kind: StmtImport, Name: name, Module: path}, nil
+		}
+
+		first, err := p.expectValue("module name")
+		if err != nil {
+			return nil, err
+		}
+		moduleParts := []string{first}
+		for p.at("::") {
 			p.advance()
 			if p.current() == nil {
 				break
@@ -638,13 +2051,41 @@ func (p *Parser) parseStatement() (*Stmt, error) {
 	if token == "let" || token == "const" || token == "var" {
 		mutable := token == "var"
 		p.advance()
-		name := p.current().Value
-		p.advance()
+		var names []string
+		if p.at("(") {
+			p.advance()
+			for p.current() != nil && !p.at(")") {
+				n, err := p.expectValue("variable name")
+				if err != nil {
+					return nil, err
+				}
+				names = append(names, n)
+				if !p.at(",") {
+					break
+				}
+				p.advance()
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			if len(names) == 0 {
+				return nil, newError(ErrSyntax, "expected variable names to destructure").at(p.previous.Location)
+			}
+		}
+		var name string
+		if names == nil {
+			var err error
+			if name, err = p.expectValue("variable name"); err != nil {
+				return nil, err
+			}
+		}
 		if err := p.expect(":"); err != nil {
 			return nil, err
 		}
-		typeStr := p.current().Value
-		p.advance()
+		typeStr, err := p.expectType("type annotation")
+		if err != nil {
+			return nil, err
+		}
 		if err := p.expect("="); err != nil {
 			return nil, err
 		}
@@ -655,68 +2096,44 @@ func (p *Parser) parseStatement() (*Stmt, error) {
 		return &Stmt{
 			Kind:    StmtLet,
 			Name:    name,
+			Names:   names,
 			Type:    parseTypeAnnotation(typeStr),
 			Value:   value,
 			Mutable: mutable,
+			Const:   token == "const",
 		}, nil
 	}
 
-	if token == "func" {
+	if token == "async" {
 		p.advance()
-		name := p.current().Value
-		p.advance()
-		if err := p.expect("("); err != nil {
-			return nil, err
-		}
-		var params []Param
-		for p.current() != nil && p.current().Value != ")" {
-			pname := p.current().Value
-			p.advance()
-			if err := p.expect(":"); err != nil {
-				return nil, err
-			}
-			ptype := p.current().Value
-			p.advance()
-			params = append(params, Param{Name: pname, Type: parseTypeAnnotation(ptype)})
-			if p.current() != nil && p.current().Value == "," {
-				p.advance()
-			}
-		}
-		if err := p.expect(")"); err != nil {
-			return nil, err
+		if !p.at("func") {
+			return nil, p.errorf(ErrSyntax, "expected func after async")
 		}
-		if err := p.expect("=>"); err != nil {
+		stmt, err := p.parseStatementBody()
+		if err != nil {
 			return nil, err
 		}
-		returnTypeStr := p.current().Value
-		p.advance()
-		if err := p.expect("{"); err != nil {
+		stmt.Async = true
+		return stmt, nil
+	}
+
+	if token == "func" {
+		stmt, err := p.parseSignature()
+		if err != nil {
 			return nil, err
 		}
-		var body []*Stmt
-		for p.current() != nil && p.current().Value != "}" {
-			stmt, err := p.parseStatement()
-			if err != nil {
-				return nil, err
-			}
-			body = append(body, stmt)
-		}
-		if err := p.expect("}"); err != nil {
+		body, err := p.parseBlock()
+		if err != nil {
 			return nil, err
 		}
-		return &Stmt{
-			Kind:       StmtFunction,
-			Name:       name,
-			Params:     params,
-			ReturnType: parseTypeAnnotation(returnTypeStr),
-			Body:       body,
-		}, nil
+		stmt.Body = body
+		return stmt, nil
 	}
 
 	if token == "return" {
 		p.advance()
 		var value *Expr
-		if p.current() != nil && p.current().Value != "}" {
+		if p.current() != nil && !p.at("}") {
 			var err error
 			value, err = p.parseBinary(0)
 			if err != nil {
@@ -742,7 +2159,7 @@ func (p *Parser) parseStatement() (*Stmt, error) {
 			return nil, err
 		}
 		var thenStmts []*Stmt
-		for p.current() != nil && p.current().Value != "}" {
+		for p.current() != nil && !p.at("}") {
 			stmt, err := p.parseStatement()
 			if err != nil {
 				return nil, err
@@ -753,9 +2170,9 @@ func (p *Parser) parseStatement() (*Stmt, error) {
 			return nil, err
 		}
 		var elseStmts []*Stmt
-		if p.current() != nil && p.current().Value == "else" {
+		if p.at("else") {
 			p.advance()
-			if p.current() != nil && p.current().Value == "if" {
+			if p.at("if") {
 				elseIfStmt, err := p.parseStatement()
 				if err != nil {
 					return nil, err
@@ -767,7 +2184,7 @@ func (p *Parser) parseStatement() (*Stmt, error) {
 				if err := p.expect("{"); err != nil {
 					return nil, err
 				}
-				for p.current() != nil && p.current().Value != "}" {
+				for p.current() != nil && !p.at("}") {
 					stmt, err := p.parseStatement()
 					if err != nil {
 						return nil, err
@@ -800,7 +2217,7 @@ func (p *Parser) parseStatement() (*Stmt, error) {
 			return nil, err
 		}
 		var body []*Stmt
-		for p.current() != nil && p.current().Value != "}" {
+		for p.current() != nil && !p.at("}") {
 			stmt, err := p.parseStatement()
 			if err != nil {
 				return nil, err
@@ -810,7 +2227,33 @@ func (p *Parser) parseStatement() (*Stmt, error) {
 		if err := p.expect("}"); err != nil {
 			return nil, err
 		}
-		return &Stmt{Kind: StmtWhile, Condition: condition, Body: body}, nil
+		elseBody, err := p.parseLoopElse()
+		if err != nil {
+			return nil, err
+		}
+		return &Stmt{Kind: StmtWhile, Condition: condition, Body: body, Else: elseBody}, nil
+	}
+
+	if token == "do" {
+		p.advance()
+		body, err := p.parseBlock()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("while"); err != nil {
+			return nil, err
+		}
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		condition, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return &Stmt{Kind: StmtDoWhile, Condition: condition, Body: body}, nil
 	}
 
 	if token == "for" {
@@ -818,18 +2261,21 @@ func (p *Parser) parseStatement() (*Stmt, error) {
 		if err := p.expect("("); err != nil {
 			return nil, err
 		}
+		if next := p.lookahead(1); p.atKind(TokenIdent) && next != nil && next.Kind == TokenIdent && next.Value == "in" {
+			return p.parseForIn()
+		}
 		init, err := p.parseStatement()
 		if err != nil {
 			return nil, err
 		}
-		if p.current() != nil && p.current().Value == ";" {
+		if p.at(";") {
 			p.advance()
 		}
 		condition, err := p.parseBinary(0)
 		if err != nil {
 			return nil, err
 		}
-		if p.current() != nil && p.current().Value == ";" {
+		if p.at(";") {
 			p.advance()
 		}
 		update, err := p.parseStatement()
@@ -839,31 +2285,106 @@ func (p *Parser) parseStatement() (*Stmt, error) {
 		if err := p.expect(")"); err != nil {
 			return nil, err
 		}
-		if err := p.expect("{"); err != nil {
-			return nil, err
+		if err := p.expect("{"); err != nil {
+			return nil, err
+		}
+		var body []*Stmt
+		for p.current() != nil && !p.at("}") {
+			stmt, err := p.parseStatement()
+			if err != nil {
+				return nil, err
+			}
+			body = append(body, stmt)
+		}
+		if err := p.expect("}"); err != nil {
+			return nil, err
+		}
+		elseBody, err := p.parseLoopElse()
+		if err != nil {
+			return nil, err
+		}
+		return &Stmt{Kind: StmtFor, Init: init, Condition: condition, Update: update, Body: body, Else: elseBody}, nil
+	}
+
+	if token == "break" {
+		p.advance()
+		return &Stmt{Kind: StmtBreak}, nil
+	}
+
+	if token == "continue" {
+		p.advance()
+		return &Stmt{Kind: StmtContinue}, nil
+	}
+
+	if p.at("match") && p.isMatchStatement() {
+		return p.parseMatch()
+	}
+
+	if p.at("select") {
+		if next := p.lookahead(1); next != nil && !next.quoted() && next.Value == "{" {
+			return p.parseSelect()
+		}
+	}
+
+	if token == "enum" {
+		return p.parseEnum()
+	}
+
+	if token == "class" {
+		return p.parseClass()
+	}
+
+	if token == "interface" {
+		return p.parseInterface()
+	}
+
+	if token == "throw" {
+		p.advance()
+		value, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		return &Stmt{Kind: StmtThrow, Value: value}, nil
+	}
+
+	if token == "try" {
+		loc := p.current().Location
+		p.advance()
+		body, err := p.parseBlock()
+		if err != nil {
+			return nil, err
+		}
+		stmt := &Stmt{Kind: StmtTry, Body: body}
+		if p.at("catch") {
+			p.advance()
+			if p.at("(") {
+				p.advance()
+				name, err := p.expectValue("catch variable")
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect(")"); err != nil {
+					return nil, err
+				}
+				stmt.CatchName = name
+			}
+			if stmt.Catch, err = p.parseBlock(); err != nil {
+				return nil, err
+			}
+			if stmt.Catch == nil {
+				stmt.Catch = []*Stmt{}
+			}
 		}
-		var body []*Stmt
-		for p.current() != nil && p.current().Value != "}" {
-			stmt, err := p.parseStatement()
-			if err != nil {
+		if p.at("finally") {
+			p.advance()
+			if stmt.Finally, err = p.parseBlock(); err != nil {
 				return nil, err
 			}
-			body = append(body, stmt)
 		}
-		if err := p.expect("}"); err != nil {
-			return nil, err
+		if stmt.Catch == nil && stmt.Finally == nil {
+			return nil, newError(ErrSyntax, "try without catch or finally").at(loc).withHint("add a catch or finally block")
 		}
-		return &Stmt{Kind: StmtFor, Init: init, Condition: condition, Update: update, Body: body}, nil
-	}
-
-	if token == "break" {
-		p.advance()
-		return &Stmt{Kind: StmtBreak}, nil
-	}
-
-	if token == "continue" {
-		p.advance()
-		return &Stmt{Kind: StmtContinue}, nil
+		return stmt, nil
 	}
 
 	expr, err := p.parseBinary(0)
@@ -871,7 +2392,7 @@ func (p *Parser) parseStatement() (*Stmt, error) {
 		return nil, err
 	}
 
-	if p.current() != nil && p.current().Value == "=" && expr.Kind == ExprIdentifier {
+	if p.at("=") && expr.Kind == ExprIdentifier {
 		target := expr.Name
 		p.advance()
 		value, err := p.parseBinary(0)
@@ -881,9 +2402,30 @@ func (p *Parser) parseStatement() (*Stmt, error) {
 		return &Stmt{Kind: StmtAssignment, Target: target, Value: value}, nil
 	}
 
+	if p.at("=") && (expr.Kind == ExprIndex || (expr.Kind == ExprMember && !expr.Optional)) {
+		p.advance()
+		value, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		return &Stmt{Kind: StmtAssignment, Target: rootName(expr), TargetExpr: expr, Value: value}, nil
+	}
+
 	return &Stmt{Kind: StmtExpression, Expr: expr}, nil
 }
 
+// rootName returns the variable an index chain such as `m["a"][0]` starts
+// from, or "" when it does not start from a variable.
+func rootName(expr *Expr) string {
+	for expr != nil && expr.Kind == ExprIndex {
+		expr = expr.Object
+	}
+	if expr != nil && expr.Kind == ExprIdentifier {
+		return expr.Name
+	}
+	return ""
+}
+
 // ============================================================================
 // TYPE CHECKER
 // ============================================================================
@@ -891,108 +2433,272 @@ func (p *Parser) parseStatement() (*Stmt, error) {
 type TypeEnvEntry struct {
 	Type    TypeDef
 	Mutable bool
+	// Const entries carry their value, folded at check time.
+	Const bool
+	Value interface{}
 }
 
 type FuncEntry struct {
 	Params     []TypeDef
 	ReturnType TypeDef
+	Variadic   bool
 }
 
+// TypeEnv is the checker's view of a scope. Scopes nest exactly where the
+// interpreter's Environments do: function bodies, catch blocks and match arms.
 type TypeEnv struct {
 	Vars      map[string]TypeEnvEntry
 	Functions map[string]FuncEntry
 	Parent    *TypeEnv
 }
 
+func NewTypeEnv(parent *TypeEnv) *TypeEnv {
+	return &TypeEnv{Vars: make(map[string]TypeEnvEntry), Functions: make(map[string]FuncEntry), Parent: parent}
+}
+
+// Lookup finds the nearest declaration of name, so inner declarations shadow
+// outer ones.
+func (e *TypeEnv) Lookup(name string) (TypeEnvEntry, bool) {
+	if entry, ok := e.Vars[name]; ok {
+		return entry, true
+	}
+	if e.Parent != nil {
+		return e.Parent.Lookup(name)
+	}
+	return TypeEnvEntry{}, false
+}
+
+func (e *TypeEnv) GetFunction(name string) (FuncEntry, bool) {
+	if entry, ok := e.Functions[name]; ok {
+		return entry, true
+	}
+	if e.Parent != nil {
+		return e.Parent.GetFunction(name)
+	}
+	return FuncEntry{}, false
+}
+
 type TypeChecker struct {
-	Env     *TypeEnv
-	Modules map[string]*TypeEnv
+	Env         *TypeEnv
+	Modules     map[string]*TypeEnv
+	Enums       map[string][]EnumVariant
+	Classes     map[string]*Stmt
+	Interfaces  map[string]*Stmt
+	diagnostics Diagnostics
 }
 
 func NewTypeChecker() *TypeChecker {
 	return &TypeChecker{
-		Env:     &TypeEnv{Vars: make(map[string]TypeEnvEntry), Functions: make(map[string]FuncEntry)},
-		Modules: make(map[string]*TypeEnv),
+		Env:        NewTypeEnv(nil),
+		Modules:    make(map[string]*TypeEnv),
+		Enums:      make(map[string][]EnumVariant),
+		Classes:    make(map[string]*Stmt),
+		Interfaces: make(map[string]*Stmt),
 	}
 }
 
 func (tc *TypeChecker) Check(statements []*Stmt) error {
+	// top-level functions can be called from bodies declared before them
 	for _, stmt := range statements {
-		if err := tc.checkStatement(stmt); err != nil {
-			return err
+		if stmt != nil && stmt.Kind == StmtFunction {
+			tc.Env.Functions[stmt.Name] = tc.funcEntry(stmt)
 		}
 	}
+	tc.diagnostics = nil
+	tc.checkBlock(statements)
+	if len(tc.diagnostics) > 0 {
+		return tc.diagnostics
+	}
 	return nil
 }
 
+// checkBlock checks each statement in turn, recording errors rather than
+// stopping at the first so that one check reports them all.
+func (tc *TypeChecker) checkBlock(block []*Stmt) {
+	for _, stmt := range block {
+		if err := tc.checkStatement(stmt); err != nil {
+			tc.diagnostics = append(tc.diagnostics, diagnose(err, ErrTypeMismatch, stmt.Location))
+		}
+	}
+}
+
 func (tc *TypeChecker) checkStatement(stmt *Stmt) error {
 	switch stmt.Kind {
 	case StmtLet:
-		tc.Env.Vars[stmt.Name] = TypeEnvEntry{Type: stmt.Type, Mutable: stmt.Mutable}
-		return tc.checkExpression(stmt.Value, stmt.Type)
-	case StmtFunction:
-		var params []TypeDef
-		for _, p := range stmt.Params {
-			params = append(params, p.Type)
+		declared := tc.resolveType(stmt.Type)
+		if stmt.Names != nil {
+			return tc.checkDestructure(stmt, declared)
 		}
-		tc.Env.Functions[stmt.Name] = FuncEntry{Params: params, ReturnType: stmt.ReturnType}
-		oldEnv := tc.Env
-		tc.Env = &TypeEnv{Vars: make(map[string]TypeEnvEntry), Functions: make(map[string]FuncEntry), Parent: oldEnv}
-		for _, param := range stmt.Params {
-			tc.Env.Vars[param.Name] = TypeEnvEntry{Type: param.Type, Mutable: false}
+		if stmt.Const {
+			return tc.checkConst(stmt, declared)
 		}
-		for _, s := range stmt.Body {
-			if err := tc.checkStatement(s); err != nil {
-				tc.Env = oldEnv
-				return err
+		tc.Env.Vars[stmt.Name] = TypeEnvEntry{Type: declared, Mutable: stmt.Mutable}
+		return tc.checkExpression(stmt.Value, declared)
+	case StmtEnum:
+		return tc.checkEnum(stmt)
+	case StmtClass:
+		return tc.checkClass(stmt)
+	case StmtInterface:
+		return tc.checkInterface(stmt)
+	case StmtFunction:
+		entry := tc.funcEntry(stmt)
+		tc.Env.Functions[stmt.Name] = entry
+		return tc.checkScope(stmt.Body, func() error {
+			for idx, param := range stmt.Params {
+				paramType := entry.Params[idx]
+				if param.Variadic {
+					paramType = TypeDef{Kind: KindPrimitive, Primitive: TypeArray}
+				}
+				tc.Env.Vars[param.Name] = TypeEnvEntry{Type: paramType, Mutable: false}
 			}
-		}
-		tc.Env = oldEnv
+			return nil
+		})
 	case StmtIf:
 		if err := tc.checkExpression(stmt.Condition, TypeDef{Kind: KindPrimitive, Primitive: TypeBool}); err != nil {
 			return err
 		}
-		for _, s := range stmt.Then {
-			if err := tc.checkStatement(s); err != nil {
+		name, narrowed, inElse := tc.narrowing(stmt.Condition)
+		for branch, block := range [][]*Stmt{stmt.Then, stmt.Else} {
+			if name != "" && (branch == 1) == inElse {
+				if err := tc.checkNarrowed(block, name, narrowed); err != nil {
+					return err
+				}
+				continue
+			}
+			tc.checkBlock(block)
+		}
+	case StmtForIn:
+		if err := tc.checkExpression(stmt.Value, TypeDef{Kind: KindPrimitive, Primitive: TypeAny}); err != nil {
+			return err
+		}
+		tc.Env.Vars[stmt.Name] = TypeEnvEntry{Type: iteratedType(tc.inferType(stmt.Value))}
+		for _, block := range [][]*Stmt{stmt.Body, stmt.Else} {
+			tc.checkBlock(block)
+		}
+	case StmtWhile, StmtDoWhile:
+		if err := tc.checkExpression(stmt.Condition, TypeDef{Kind: KindPrimitive, Primitive: TypeBool}); err != nil {
+			return err
+		}
+		for _, block := range [][]*Stmt{stmt.Body, stmt.Else} {
+			tc.checkBlock(block)
+		}
+	case StmtExpression:
+		return tc.checkExpression(stmt.Expr, TypeDef{Kind: KindPrimitive, Primitive: TypeAny})
+	case StmtTry:
+		for _, block := range [][]*Stmt{stmt.Body, stmt.Finally} {
+			tc.checkBlock(block)
+		}
+		return tc.checkScope(stmt.Catch, func() error {
+			if stmt.CatchName != "" {
+				tc.Env.Vars[stmt.CatchName] = TypeEnvEntry{Type: TypeDef{Kind: KindPrimitive, Primitive: TypeAny}}
+			}
+			return nil
+		})
+	case StmtMatch:
+		for _, c := range stmt.Cases {
+			pattern := c.Pattern
+			if err := tc.checkScope(c.Body, func() error { return tc.bindPattern(pattern) }); err != nil {
 				return err
 			}
 		}
-		for _, s := range stmt.Else {
-			if err := tc.checkStatement(s); err != nil {
+	case StmtSelect:
+		for _, c := range stmt.Cases {
+			if c.Pattern.Value != nil {
+				if err := tc.checkExpression(c.Pattern.Value, TypeDef{Kind: KindPrimitive, Primitive: TypeAny}); err != nil {
+					return err
+				}
+			}
+			bindings := c.Pattern.Bindings
+			if err := tc.checkScope(c.Body, func() error {
+				for _, name := range bindings {
+					tc.Env.Vars[name] = TypeEnvEntry{Type: TypeDef{Kind: KindPrimitive, Primitive: TypeAny}}
+				}
+				return nil
+			}); err != nil {
 				return err
 			}
 		}
-	case StmtWhile:
-		if err := tc.checkExpression(stmt.Condition, TypeDef{Kind: KindPrimitive, Primitive: TypeBool}); err != nil {
-			return err
+	case StmtReturn:
+		tc.markSized(stmt.Value)
+	case StmtAssignment:
+		if entry, ok := tc.Env.Lookup(stmt.Target); ok && entry.Const {
+			return newError(ErrImmutable, "cannot assign to constant: %s", stmt.Target)
 		}
-		for _, s := range stmt.Body {
-			if err := tc.checkStatement(s); err != nil {
+		tc.markSized(stmt.Value)
+		if stmt.TargetExpr != nil && stmt.TargetExpr.Kind == ExprIndex {
+			if err := tc.checkIndexing(stmt.TargetExpr); err != nil {
 				return err
 			}
+			return tc.checkExpression(stmt.Value, tc.inferType(stmt.TargetExpr))
 		}
-	case StmtExpression:
-		return tc.checkExpression(stmt.Expr, TypeDef{Kind: KindPrimitive, Primitive: TypeAny})
 	case StmtImport:
 		// imports are handled at runtime
 	}
 	return nil
 }
 
+// checkScope checks block in a new nested scope, after declare adds the
+// names the scope starts with.
+func (tc *TypeChecker) checkScope(block []*Stmt, declare func() error) error {
+	oldEnv := tc.Env
+	tc.Env = NewTypeEnv(oldEnv)
+	defer func() { tc.Env = oldEnv }()
+	if err := declare(); err != nil {
+		return err
+	}
+	tc.checkBlock(block)
+	return nil
+}
+
 func (tc *TypeChecker) checkExpression(expr *Expr, expectedType TypeDef) error {
+	if err := tc.checkEnumUses(expr); err != nil {
+		return err
+	}
+	if err := tc.checkIndexing(expr); err != nil {
+		return err
+	}
+	if err := tc.checkCalls(expr); err != nil {
+		return err
+	}
+	tc.markSized(expr)
+	if expr.Kind == ExprArray || expr.Kind == ExprMap {
+		if err := tc.checkElements(expr, expectedType); err != nil {
+			return err
+		}
+	}
 	actualType := tc.inferType(expr)
+	if expectedType.Kind == KindInterface {
+		if err := tc.conforms(actualType, expectedType); err != nil {
+			return diagnose(err, ErrTypeMismatch, expr.Location)
+		}
+		return nil
+	}
 	if !typeCompatible(actualType, expectedType) {
-		return fmt.Errorf("type mismatch: expected %s, got %s", expectedType.Primitive, actualType.Primitive)
+		return newError(ErrTypeMismatch, "type mismatch: expected %s, got %s", expectedType, actualType).at(expr.Location)
 	}
 	return nil
 }
 
 func (tc *TypeChecker) inferType(expr *Expr) TypeDef {
 	switch expr.Kind {
-	case ExprLiteral:
+	case ExprLiteral, ExprMap:
 		return expr.Type
+	case ExprArray:
+		return tc.literalType(expr)
+	case ExprIndex:
+		return elementType(tc.inferType(expr.Object), expr.Index)
+	case ExprSlice:
+		return tc.inferType(expr.Object)
+	case ExprIs:
+		return TypeDef{Kind: KindPrimitive, Primitive: TypeBool}
+	case ExprTuple:
+		types := make([]TypeDef, len(expr.Elements))
+		for idx, element := range expr.Elements {
+			types[idx] = tc.inferType(element)
+		}
+		return TypeDef{Kind: KindPrimitive, Primitive: TypeTuple, Types: types}
 	case ExprIdentifier:
-		if entry, ok := tc.Env.Vars[expr.Name]; ok {
+		if entry, ok := tc.Env.Lookup(expr.Name); ok {
 			return entry.Type
 		}
 		return TypeDef{Kind: KindPrimitive, Primitive: TypeAny}
@@ -1001,12 +2707,53 @@ func (tc *TypeChecker) inferType(expr *Expr) TypeDef {
 		case "==", "!=", "<", ">", "<=", ">=", "&&", "||":
 			return TypeDef{Kind: KindPrimitive, Primitive: TypeBool}
 		}
-		return tc.inferType(expr.Left)
+		left := tc.inferType(expr.Left)
+		if expr.Op == "??" {
+			if left.Kind == KindOptional && left.InnerType != nil {
+				return *left.InnerType
+			}
+			if left.Primitive == TypeNull {
+				return tc.inferType(expr.Right)
+			}
+			return left
+		}
+		right := tc.inferType(expr.Right)
+		if right.Primitive == TypeComplex {
+			return right
+		}
+		return arithmeticType(left, right)
 	case ExprUnary:
 		if expr.Op == "!" {
 			return TypeDef{Kind: KindPrimitive, Primitive: TypeBool}
 		}
 		return tc.inferType(expr.Operand)
+	case ExprAwait:
+		operand := tc.inferType(expr.Operand)
+		if operand.Primitive != TypePromise {
+			return operand
+		}
+		if operand.InnerType != nil {
+			return *operand.InnerType
+		}
+		return TypeDef{Kind: KindPrimitive, Primitive: TypeAny}
+	case ExprSpawn:
+		result := tc.inferType(expr.Operand)
+		if result.Primitive == TypePromise {
+			return result
+		}
+		return TypeDef{Kind: KindPrimitive, Primitive: TypePromise, InnerType: &result}
+	case ExprMember, ExprCall:
+		if t, ok := tc.enumType(expr); ok {
+			return t
+		}
+		if t, ok := tc.classType(expr); ok {
+			return t
+		}
+		if expr.Kind == ExprCall {
+			if entry, name, ok := tc.callSignature(expr); ok {
+				return tc.callType(expr, name, entry)
+			}
+		}
 	}
 	return TypeDef{Kind: KindPrimitive, Primitive: TypeAny}
 }
@@ -1022,6 +2769,7 @@ const (
 	CFReturn   ControlFlowType = "return"
 	CFBreak    ControlFlowType = "break"
 	CFContinue ControlFlowType = "continue"
+	CFThrow    ControlFlowType = "throw"
 )
 
 type ControlFlow struct {
@@ -1032,11 +2780,29 @@ type ControlFlow struct {
 type VarEntry struct {
 	Value   interface{}
 	Mutable bool
+	// Type is the declared primitive type values are converted to on
+	// assignment, or empty when the variable has none.
+	Type PrimitiveType
+	// bound marks a function scope's slot that holds a variable.
+	bound bool
 }
 
+// FuncDef is a user-defined function. It is an ordinary runtime value: it
+// can be stored in variables and collections, passed as an argument and
+// called through any expression. Closure is the scope it was declared in.
 type FuncDef struct {
-	Params []string
-	Body   []*Stmt
+	Name    string
+	Params  []string
+	Body    []*Stmt
+	Closure *Environment
+	// Variadic reports whether the last parameter collects extra arguments.
+	Variadic bool
+	// Module is the imported file the function was declared in, or nil for
+	// the entry file.
+	Module *UserModule
+	// Decl is the declaration, whose parameter and return types arguments
+	// and results are converted to; nil for functions built otherwise.
+	Decl *Stmt
 }
 
 type Environment struct {
@@ -1044,6 +2810,10 @@ type Environment struct {
 	Functions map[string]*FuncDef
 	Modules   map[string]interface{}
 	Parent    *Environment
+	// A function call's scope keeps the variables its layout names in
+	// slots rather than in Vars.
+	layout *scopeLayout
+	slots  []VarEntry
 }
 
 func NewEnvironment() *Environment {
@@ -1054,36 +2824,118 @@ func NewEnvironment() *Environment {
 	}
 }
 
-func (e *Environment) Set(name string, value interface{}, mutable bool) {
-	e.Vars[name] = &VarEntry{Value: value, Mutable: mutable}
+// newScope returns an empty scope inside parent, laid out by layout if it
+// is a function call's. Its maps are made on first use.
+func newScope(parent *Environment, layout *scopeLayout) *Environment {
+	env := &Environment{Parent: parent, layout: layout}
+	if layout != nil {
+		env.slots = make([]VarEntry, len(layout.names))
+	}
+	return env
+}
+
+// slotEntry returns the variable in slot, or nil if it is not bound yet.
+func (e *Environment) slotEntry(slot int) *VarEntry {
+	if entry := &e.slots[slot]; entry.bound {
+		return entry
+	}
+	return nil
+}
+
+// Set binds name in this scope and returns the new binding.
+func (e *Environment) Set(name string, value interface{}, mutable bool) *VarEntry {
+	if e.layout != nil {
+		if slot, ok := e.layout.index[name]; ok {
+			entry := &e.slots[slot]
+			*entry = VarEntry{Value: value, Mutable: mutable, bound: true}
+			return entry
+		}
+	}
+	entry := &VarEntry{Value: value, Mutable: mutable}
+	if e.Vars == nil {
+		e.Vars = make(map[string]*VarEntry)
+	}
+	e.Vars[name] = entry
+	return entry
+}
+
+// own returns the binding for name in this scope alone, or nil.
+func (e *Environment) own(name string) *VarEntry {
+	if e.layout != nil {
+		if slot, ok := e.layout.index[name]; ok {
+			return e.slotEntry(slot)
+		}
+	}
+	return e.Vars[name]
+}
+
+// lookup returns the binding for name in this or an enclosing scope, or nil.
+func (e *Environment) lookup(name string) *VarEntry {
+	for env := e; env != nil; env = env.Parent {
+		if entry := env.own(name); entry != nil {
+			return entry
+		}
+	}
+	return nil
+}
+
+// bindings returns every variable bound in this scope alone, by name.
+func (e *Environment) bindings() map[string]*VarEntry {
+	if e.layout == nil {
+		return e.Vars
+	}
+	all := make(map[string]*VarEntry, len(e.Vars)+len(e.slots))
+	for name, entry := range e.Vars {
+		all[name] = entry
+	}
+	for slot := range e.slots {
+		if entry := e.slotEntry(slot); entry != nil {
+			all[e.layout.names[slot]] = entry
+		}
+	}
+	return all
 }
 
 func (e *Environment) Get(name string) (interface{}, error) {
-	if entry, ok := e.Vars[name]; ok {
+	if entry := e.lookup(name); entry != nil {
 		return entry.Value, nil
 	}
-	if e.Parent != nil {
-		return e.Parent.Get(name)
+	return nil, newError(ErrUndefined, "undefined variable: %s", name)
+}
+
+// Lookup returns the binding for name in this or an enclosing scope.
+func (e *Environment) Lookup(name string) (*VarEntry, error) {
+	if entry := e.lookup(name); entry != nil {
+		return entry, nil
 	}
-	return nil, fmt.Errorf("undefined variable: %s", name)
+	return nil, newError(ErrUndefined, "undefined variable: %s", name)
 }
 
 func (e *Environment) Update(name string, value interface{}) error {
-	if entry, ok := e.Vars[name]; ok {
-		if !entry.Mutable {
-			return fmt.Errorf("cannot reassign immutable variable: %s", name)
-		}
-		entry.Value = value
-		return nil
+	return assignEntry(e.lookup(name), name, value)
+}
+
+// assignEntry stores value in the binding entry of the variable name.
+func assignEntry(entry *VarEntry, name string, value interface{}) error {
+	if entry == nil {
+		return newError(ErrUndefined, "undefined variable: %s", name)
 	}
-	if e.Parent != nil {
-		return e.Parent.Update(name, value)
+	if !entry.Mutable {
+		return newError(ErrImmutable, "cannot reassign immutable variable: %s", name).withHint("declare it with var to allow reassignment")
+	}
+	value, err := convertNumber(value, entry.Type)
+	if err != nil {
+		return err
 	}
-	return fmt.Errorf("undefined variable: %s", name)
+	entry.Value = value
+	return nil
 }
 
 func (e *Environment) SetFunction(name string, params []string, body []*Stmt) {
-	e.Functions[name] = &FuncDef{Params: params, Body: body}
+	if e.Functions == nil {
+		e.Functions = make(map[string]*FuncDef)
+	}
+	e.Functions[name] = &FuncDef{Name: name, Params: params, Body: body, Closure: e}
 }
 
 func (e *Environment) GetFunction(name string) *FuncDef {
@@ -1097,6 +2949,9 @@ func (e *Environment) GetFunction(name string) *FuncDef {
 }
 
 func (e *Environment) SetModule(name string, module interface{}) {
+	if e.Modules == nil {
+		e.Modules = make(map[string]interface{})
+	}
 	e.Modules[name] = module
 }
 
@@ -1110,16 +2965,62 @@ func (e *Environment) GetModule(name string) interface{} {
 	return nil
 }
 
+type StackFrame struct {
+	Function string
+	CallSite Location
+	// Module is the imported file containing CallSite, or nil for the entry
+	// file.
+	Module *UserModule
+	// Env is the caller's scope, for debuggers.
+	Env *Environment
+}
+
 type Interpreter struct {
-	Env         *Environment
-	ControlFlow ControlFlow
-	Builtins    map[string]func([]interface{}) interface{}
+	Env           *Environment
+	ControlFlow   ControlFlow
+	Builtins      map[string]func([]interface{}) interface{}
+	CallStack     []StackFrame
+	Location      Location
+	Stdout        io.Writer
+	Stderr        io.Writer
+	Stdin         io.Reader
+	MaxSteps      int
+	MaxDepth      int
+	Options       InterpreterOptions
+	Clock         func() time.Time
+	Rand          *rand.Rand
+	Deterministic bool
+	// File is the entry script's path; relative imports resolve against it.
+	File string
+	// Args are the command-line arguments after the script path.
+	Args []string
+	// Debugger, when set, is consulted before every statement.
+	Debugger *Debugger
+	steps    int
+	modules  *moduleLoader
+	module   *UserModule
+	stdin    *bufio.Reader
+	args     []interface{}
+	// output is held while writing once workers share the output.
+	output *sync.Mutex
+	// usage counts against the quotas SetQuotas sets, if any.
+	usage *usage
+	// tasks counts the run's tasks for deadlock detection.
+	tasks *tasks
 }
 
 func NewInterpreter() *Interpreter {
 	interp := &Interpreter{
 		Env:         NewEnvironment(),
 		ControlFlow: ControlFlow{Type: CFNone},
+		Stdout:      os.Stdout,
+		Stderr:      os.Stderr,
+		Stdin:       os.Stdin,
+		Clock:       time.Now,
+		Rand:        rand.New(rand.NewSource(time.Now().UnixNano())),
+		MaxDepth:    DefaultMaxDepth,
+		Options:     AllowAll,
+		tasks:       newTasks(),
 	}
 	interp.setupStdlib()
 	interp.setupBuiltins()
@@ -1128,8 +3029,27 @@ func NewInterpreter() *Interpreter {
 
 func (i *Interpreter) setupBuiltins() {
 	i.Builtins = map[string]func([]interface{}) interface{}{
-		"strlen":      func(args []interface{}) interface{} { return int64(len(toString(args[0]))) },
-		"substr":      func(args []interface{}) interface{} { s := toString(args[0]); start := toInt(args[1]); end := toInt(args[2]); if end > int64(len(s)) { end = int64(len(s)) }; return s[start:end] },
+		"strlen":      func(args []interface{}) interface{} { return int64(utf8.RuneCountInString(toString(args[0]))) },
+		"len": func(args []interface{}) interface{} {
+			switch v := args[0].(type) {
+			case []interface{}:
+				return int64(len(v))
+			case []string:
+				return int64(len(v))
+			case Tuple:
+				return int64(len(v))
+			case string:
+				return int64(utf8.RuneCountInString(v))
+			case map[string]interface{}:
+				return int64(len(v))
+			case *Matrix:
+				return int64(v.Rows)
+			case Bytes:
+				return int64(len(v))
+			}
+			return newError(ErrInvalidOperation, "len is not defined for %s", describeValue(args[0]))
+		},
+		"substr":      func(args []interface{}) interface{} { return substring(toString(args[0]), toInt(args[1]), toInt(args[2])) },
 		"toUpperCase": func(args []interface{}) interface{} { return strings.ToUpper(toString(args[0])) },
 		"toLowerCase": func(args []interface{}) interface{} { return strings.ToLower(toString(args[0])) },
 		"trim":        func(args []interface{}) interface{} { return strings.TrimSpace(toString(args[0])) },
@@ -1138,11 +3058,11 @@ func (i *Interpreter) setupBuiltins() {
 		"startsWith":  func(args []interface{}) interface{} { return strings.HasPrefix(toString(args[0]), toString(args[1])) },
 		"endsWith":    func(args []interface{}) interface{} { return strings.HasSuffix(toString(args[0]), toString(args[1])) },
 		"includes":    func(args []interface{}) interface{} { return strings.Contains(toString(args[0]), toString(args[1])) },
-		"indexOf":     func(args []interface{}) interface{} { return int64(strings.Index(toString(args[0]), toString(args[1]))) },
+		"indexOf":     func(args []interface{}) interface{} { return runeIndex(toString(args[0]), toString(args[1])) },
 		"replace":     func(args []interface{}) interface{} { return strings.Replace(toString(args[0]), toString(args[1]), toString(args[2]), 1) },
-		"replaceAll":  func(args []interface{}) interface{} { return strings.ReplaceAll(toString(args[0]), toString(args[1]), toString(args[2])) },
-		"repeat":      func(args []interface{}) interface{} { return strings.Repeat(toString(args[0]), int(toInt(args[1]))) },
-		"abs":         func(args []interface{}) interface{} { return math.Abs(toFloat(args[0])) },
+		"replaceAll":  func(args []interface{}) interface{} { s, old, new := toString(args[0]), toString(args[1]), toString(args[2]); if err := i.usage.reserve(replacedSize(s, old, new)); err != nil { return err }; return strings.ReplaceAll(s, old, new) },
+		"repeat":      func(args []interface{}) interface{} { s, n := toString(args[0]), toInt(args[1]); if n < 0 { return newError(ErrInvalidOperation, "repeat count must not be negative") }; if err := i.usage.reserve(int64(len(s)), n); err != nil { return err }; return strings.Repeat(s, int(n)) },
+		"abs":         func(args []interface{}) interface{} { return absolute(args[0]) },
 		"sqrt":        func(args []interface{}) interface{} { return math.Sqrt(toFloat(args[0])) },
 		"pow":         func(args []interface{}) interface{} { return math.Pow(toFloat(args[0]), toFloat(args[1])) },
 		"sin":         func(args []interface{}) interface{} { return math.Sin(toFloat(args[0])) },
@@ -1156,12 +3076,12 @@ func (i *Interpreter) setupBuiltins() {
 		"log":         func(args []interface{}) interface{} { return math.Log(toFloat(args[0])) },
 		"log10":       func(args []interface{}) interface{} { return math.Log10(toFloat(args[0])) },
 		"log2":        func(args []interface{}) interface{} { return math.Log2(toFloat(args[0])) },
-		"ceil":        func(args []interface{}) interface{} { return math.Ceil(toFloat(args[0])) },
-		"floor":       func(args []interface{}) interface{} { return math.Floor(toFloat(args[0])) },
-		"round":       func(args []interface{}) interface{} { return math.Round(toFloat(args[0])) },
+		"ceil":        func(args []interface{}) interface{} { return int64(math.Ceil(toFloat(args[0]))) },
+		"floor":       func(args []interface{}) interface{} { return int64(math.Floor(toFloat(args[0]))) },
+		"round":       func(args []interface{}) interface{} { return int64(math.Round(toFloat(args[0]))) },
 		"trunc":       func(args []interface{}) interface{} { return math.Trunc(toFloat(args[0])) },
-		"max":         func(args []interface{}) interface{} { return math.Max(toFloat(args[0]), toFloat(args[1])) },
-		"min":         func(args []interface{}) interface{} { return math.Min(toFloat(args[0]), toFloat(args[1])) },
+		"max":         func(args []interface{}) interface{} { return extremum(args, func(c int) bool { return c > 0 }) },
+		"min":         func(args []interface{}) interface{} { return extremum(args, func(c int) bool { return c < 0 }) },
 		"gcd": func(args []interface{}) interface{} {
 			a, b := toInt(args[0]), toInt(args[1])
 			if a < 0 {
@@ -1175,19 +3095,22 @@ func (i *Interpreter) setupBuiltins() {
 			}
 			return a
 		},
-		"typeof":    func(args []interface{}) interface{} { return fmt.Sprintf("%T", args[0]) },
+		"typeof":    func(args []interface{}) interface{} { return describeValue(args[0]) },
 		"parseInt":  func(args []interface{}) interface{} { v, _ := strconv.ParseInt(toString(args[0]), 10, 64); return v },
 		"parseFloat": func(args []interface{}) interface{} { v, _ := strconv.ParseFloat(toString(args[0]), 64); return v },
-		"toString":  func(args []interface{}) interface{} { return fmt.Sprintf("%v", args[0]) },
+		"toString":  func(args []interface{}) interface{} { return displayValue(args[0]) },
 		"toBoolean": func(args []interface{}) interface{} { return toBool(args[0]) },
 		"toNumber":  func(args []interface{}) interface{} { return toFloat(args[0]) },
 		"isNaN":     func(args []interface{}) interface{} { return math.IsNaN(toFloat(args[0])) },
 		"isFinite":  func(args []interface{}) interface{} { f := toFloat(args[0]); return !math.IsInf(f, 0) && !math.IsNaN(f) },
-		"now":       func(args []interface{}) interface{} { return time.Now().UnixMilli() },
-		"timestamp": func(args []interface{}) interface{} { return time.Now().Unix() },
+		"now":       func(args []interface{}) interface{} { return i.Clock().UnixMilli() },
+		"timestamp": func(args []interface{}) interface{} { return i.Clock().Unix() },
 		"range": func(args []interface{}) interface{} {
 			start := toInt(args[0])
 			end := toInt(args[1])
+			if err := i.usage.reserve(16, end-start); err != nil {
+				return err
+			}
 			var result []interface{}
 			for i := start; i < end; i++ {
 				result = append(result, i)
@@ -1213,19 +3136,30 @@ func (i *Interpreter) setupBuiltins() {
 			if err != nil {
 				return nil
 			}
+			if len(args) > 1 && toString(args[1]) == "bytes" {
+				return Bytes(data)
+			}
 			return string(data)
 		},
 		"writeFile": func(args []interface{}) interface{} {
-			err := os.WriteFile(toString(args[0]), []byte(toString(args[1])), 0644)
+			content := toString(args[1])
+			if err := i.usage.write(int64(len(content))); err != nil {
+				return err
+			}
+			err := os.WriteFile(toString(args[0]), []byte(content), 0644)
 			return err == nil
 		},
 		"appendFile": func(args []interface{}) interface{} {
+			content := toString(args[1])
+			if err := i.usage.write(int64(len(content))); err != nil {
+				return err
+			}
 			f, err := os.OpenFile(toString(args[0]), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 			if err != nil {
 				return false
 			}
 			defer f.Close()
-			_, err = f.WriteString(toString(args[1]))
+			_, err = f.WriteString(content)
 			return err == nil
 		},
 		"exists": func(args []interface{}) interface{} {
@@ -1258,12 +3192,70 @@ func (i *Interpreter) setupBuiltins() {
 			return re.MatchString(toString(args[0]))
 		},
 	}
+	for name, builtin := range variantBuiltins() {
+		i.Builtins[name] = builtin
+	}
+	for name, builtin := range tupleBuiltins() {
+		i.Builtins[name] = builtin
+	}
+	for name, builtin := range stdinBuiltins(i) {
+		i.Builtins[name] = builtin
+	}
+	i.Builtins["channel"] = channelBuiltin
+	i.Builtins["iter"] = func(args []interface{}) interface{} {
+		it, err := i.iterate(args[0])
+		if err != nil {
+			return err
+		}
+		return &IteratorValue{it: it}
+	}
+	i.Builtins["format"] = func(args []interface{}) interface{} {
+		formatted, err := formatString(toString(args[0]), args[1:], i.usage)
+		if err != nil {
+			return err
+		}
+		return formatted
+	}
+}
+
+// builtinArity is the number of arguments each builtin reads; calls with
+// fewer are rejected before the builtin runs.
+var builtinArity = map[string]int{
+	"strlen": 1, "len": 1, "substr": 3, "toUpperCase": 1, "toLowerCase": 1, "trim": 1,
+	"split": 2, "join": 2, "startsWith": 2, "endsWith": 2, "includes": 2,
+	"indexOf": 2, "replace": 3, "replaceAll": 3, "repeat": 2,
+	"abs": 1, "sqrt": 1, "pow": 2, "sin": 1, "cos": 1, "tan": 1, "asin": 1,
+	"acos": 1, "atan": 1, "atan2": 2, "exp": 1, "log": 1, "log10": 1, "log2": 1,
+	"ceil": 1, "floor": 1, "round": 1, "trunc": 1, "max": 2, "min": 2, "gcd": 2,
+	"typeof": 1, "parseInt": 1, "parseFloat": 1, "toString": 1, "toBoolean": 1,
+	"toNumber": 1, "isNaN": 1, "isFinite": 1, "now": 0, "timestamp": 0,
+	"range": 2, "iter": 1, "hash": 1, "clone": 1, "readFile": 1, "writeFile": 2,
+	"appendFile": 2, "exists": 1, "isFile": 1, "isDirectory": 1, "mkdir": 1,
+	"match": 2, "test": 2, "format": 1,
+	"Ok": 1, "Err": 1, "Some": 1, "None": 0, "isOk": 1, "isErr": 1, "isSome": 1,
+	"isNone": 1, "unwrap": 1, "unwrapOr": 2, "untuple": 1,
+}
+
+// clampRange bounds the slice [start, end) to a string of length n.
+func clampRange(start, end int64, n int) (int64, int64) {
+	if start < 0 {
+		start = 0
+	}
+	if end > int64(n) {
+		end = int64(n)
+	}
+	if start > end {
+		start = end
+	}
+	return start, end
 }
 
 func (i *Interpreter) setupStdlib() {
 	ioModule := map[string]interface{}{
-		"print":   func(value interface{}) interface{} { fmt.Println(value); return nil },
-		"println": func(value interface{}) interface{} { fmt.Println(value); return nil },
+		"print":    func(value interface{}) interface{} { fmt.Fprintln(i.Stdout, displayValue(value)); return nil },
+		"println":  func(value interface{}) interface{} { fmt.Fprintln(i.Stdout, displayValue(value)); return nil },
+		"readLine": NativeFunc(func(args []interface{}) (interface{}, error) { return i.readLine(), nil }),
+		"readAll":  NativeFunc(func(args []interface{}) (interface{}, error) { return i.readAll(), nil }),
 	}
 	i.Env.SetModule("std::io", ioModule)
 	i.Env.SetModule("str", ioModule)
@@ -1285,7 +3277,7 @@ func (i *Interpreter) setupStdlib() {
 		"round":  func(x float64) float64 { return math.Round(x) },
 		"abs":    func(x float64) float64 { return math.Abs(x) },
 		"pow":    func(x, y float64) float64 { return math.Pow(x, y) },
-		"random": func() float64 { return float64(time.Now().UnixNano()%1000000) / 1000000.0 },
+		"random": func() float64 { return i.Rand.Float64() },
 		"PI":     math.Pi,
 		"E":      math.E,
 	}
@@ -1301,26 +3293,62 @@ func (i *Interpreter) setupStdlib() {
 		"startsWith":  func(s, prefix string) bool { return strings.HasPrefix(s, prefix) },
 		"endsWith":    func(s, suffix string) bool { return strings.HasSuffix(s, suffix) },
 		"includes":    func(s, substr string) bool { return strings.Contains(s, substr) },
-		"indexOf":     func(s, substr string) int { return strings.Index(s, substr) },
+		"indexOf":     func(s, substr string) int64 { return runeIndex(s, substr) },
 		"replace":     func(s, old, new string) string { return strings.Replace(s, old, new, 1) },
-		"replaceAll":  func(s, old, new string) string { return strings.ReplaceAll(s, old, new) },
-		"repeat":      func(s string, count int) string { return strings.Repeat(s, count) },
-		"length":      func(s string) int { return len(s) },
+		"replaceAll": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("replaceAll", args, 3); err != nil {
+				return nil, err
+			}
+			s, old, new := toString(args[0]), toString(args[1]), toString(args[2])
+			if err := i.usage.reserve(replacedSize(s, old, new)); err != nil {
+				return nil, err
+			}
+			return strings.ReplaceAll(s, old, new), nil
+		}),
+		"repeat": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("repeat", args, 2); err != nil {
+				return nil, err
+			}
+			s, count := toString(args[0]), toInt(args[1])
+			if count < 0 {
+				count = 0
+			}
+			if err := i.usage.reserve(int64(len(s)), count); err != nil {
+				return nil, err
+			}
+			return strings.Repeat(s, int(count)), nil
+		}),
+		"length":      func(s string) int { return utf8.RuneCountInString(s) },
+	}
+	for name, fn := range textFormatFunctions(i) {
+		textModule[name] = fn
 	}
 	i.Env.SetModule("std::text", textModule)
 
 	fileModule := map[string]interface{}{
-		"read": func(path string) interface{} {
-			data, err := os.ReadFile(path)
+		"read": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("read", args, 1); err != nil {
+				return nil, err
+			}
+			data, err := os.ReadFile(toString(args[0]))
 			if err != nil {
-				return nil
+				return nil, nil
 			}
-			return string(data)
-		},
+			if len(args) > 1 && toString(args[1]) == "bytes" {
+				return Bytes(data), nil
+			}
+			return string(data), nil
+		}),
 		"write": func(path, content string) bool {
+			if i.usage.write(int64(len(content))) != nil {
+				return false
+			}
 			return os.WriteFile(path, []byte(content), 0644) == nil
 		},
 		"append": func(path, content string) bool {
+			if i.usage.write(int64(len(content))) != nil {
+				return false
+			}
 			f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 			if err != nil {
 				return false
@@ -1348,72 +3376,80 @@ func (i *Interpreter) setupStdlib() {
 			return os.MkdirAll(path, 0755) == nil
 		},
 	}
+	for name, fn := range fileSystemFunctions(i) {
+		fileModule[name] = fn
+	}
+	for name, fn := range fileStreamFunctions(i) {
+		fileModule[name] = fn
+	}
 	i.Env.SetModule("std::file", fileModule)
 
 	timeModule := map[string]interface{}{
-		"now":        func() int64 { return time.Now().UnixMilli() },
-		"timestamp":  func() int64 { return time.Now().Unix() },
+		"now":        func() int64 { return i.Clock().UnixMilli() },
+		"timestamp":  func() int64 { return i.Clock().Unix() },
 		"getDate":    func(ms int64) int { return time.UnixMilli(ms).Day() },
 		"getMonth":   func(ms int64) int { return int(time.UnixMilli(ms).Month()) },
 		"getYear":    func(ms int64) int { return time.UnixMilli(ms).Year() },
 		"getHours":   func(ms int64) int { return time.UnixMilli(ms).Hour() },
 		"getMinutes": func(ms int64) int { return time.UnixMilli(ms).Minute() },
 		"getSeconds": func(ms int64) int { return time.UnixMilli(ms).Second() },
-	}
-	i.Env.SetModule("std::time", timeModule)
-
-	regexModule := map[string]interface{}{
-		"match": func(str, pattern string) interface{} {
-			re, err := regexp.Compile(pattern)
-			if err != nil {
-				return nil
-			}
-			return re.FindString(str)
-		},
-		"test": func(str, pattern string) bool {
-			re, err := regexp.Compile(pattern)
-			if err != nil {
-				return false
-			}
-			return re.MatchString(str)
-		},
-		"search": func(str, pattern string) int {
-			re, err := regexp.Compile(pattern)
-			if err != nil {
-				return -1
-			}
-			loc := re.FindStringIndex(str)
-			if loc == nil {
-				return -1
+		"sleep": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("sleep", args, 1); err != nil {
+				return nil, err
 			}
-			return loc[0]
-		},
-		"replace": func(str, pattern, replacement string) string {
-			re, err := regexp.Compile(pattern)
-			if err != nil {
-				return str
+			ms, ok := args[0].(int64)
+			if !ok {
+				return nil, newError(ErrTypeMismatch, "sleep expects an int number of milliseconds, got %s", describeValue(args[0]))
 			}
-			return re.ReplaceAllString(str, replacement)
-		},
+			time.Sleep(time.Duration(ms) * time.Millisecond)
+			return nil, nil
+		}),
 	}
-	i.Env.SetModule("std::regex", regexModule)
+	i.Env.SetModule("std::time", timeModule)
+
+	i.Env.SetModule("std::regex", regexModule())
+	i.Env.SetModule("std::complex", complexModule())
+	i.Env.SetModule("std::dataframe", dataframeModule(i))
 
 	typeModule := map[string]interface{}{
-		"typeof":      func(x interface{}) string { return fmt.Sprintf("%T", x) },
+		"typeof":      func(x interface{}) string { return describeValue(x) },
 		"isNull":      func(x interface{}) bool { return x == nil },
 		"isNumber":    func(x interface{}) bool { _, ok := x.(float64); _, ok2 := x.(int64); return ok || ok2 },
 		"isString":    func(x interface{}) bool { _, ok := x.(string); return ok },
 		"isBoolean":   func(x interface{}) bool { _, ok := x.(bool); return ok },
 		"toNumber":    func(x interface{}) float64 { return toFloat(x) },
-		"toString":    func(x interface{}) string { return fmt.Sprintf("%v", x) },
+		"toString":    func(x interface{}) string { return displayValue(x) },
 		"toBoolean":   func(x interface{}) bool { return toBool(x) },
 		"toInt":       func(x interface{}) int64 { return toInt(x) },
 		"toFloat":     func(x interface{}) float64 { return toFloat(x) },
 	}
 	i.Env.SetModule("std::type", typeModule)
+	i.Env.SetModule("std::os", osModule(i))
+	i.Env.SetModule("std::http::server", httpServerModule(i))
+	i.Env.SetModule("std::net", netModule(i))
+	i.Env.SetModule("std::random", randomModule(i))
+	i.Env.SetModule("std::list", listModule(i))
+	i.Env.SetModule("std::dict", dictModule(i))
+	i.Env.SetModule("std::yaml", yamlModule())
+	i.Env.SetModule("std::toml", tomlModule())
+	i.Env.SetModule("std::matrix", matrixModule(i))
+	i.Env.SetModule("std::bytes", bytesModule())
+	i.Env.SetModule("std::log", logModule(i))
+	i.Env.SetModule("std::assert", assertModule(i))
+	i.Env.SetModule("std::parallel", parallelModule(i))
+	i.Env.SetModule("std::promise", promiseModule())
+	i.setupPlugins()
 }
 
-func (i *Interpreter) Interpret(statements []*Stmt) error {
+// Interpret runs statements to completion. A Go panic anywhere below is
+// recovered and returned as an InternalError located at the statement being
+// executed, so callers never see a crash.
+func (i *Interpreter) Interpret(statements []*Stmt) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = i.locate(&InternalError{Value: r, Stack: debug.Stack()}, i.Location)
+		}
+	}()
 	for _, stmt := range statements {
 		if err := i.interpretStatement(stmt); err != nil {
 			return err
@@ -1422,24 +3458,55 @@ func (i *Interpreter) Interpret(statements []*Stmt) error {
 			break
 		}
 	}
-	return nil
+	return i.pendingThrow()
 }
 
 func (i *Interpreter) interpretStatement(stmt *Stmt) error {
+	if stmt == nil {
+		return nil
+	}
+	if stmt.Location.Line > 0 {
+		i.Location = stmt.Location
+	}
+	if err := i.step(); err != nil {
+		return err
+	}
+	if i.Debugger != nil {
+		if err := i.Debugger.pause(i, stmt); err != nil {
+			return err
+		}
+	}
 	switch stmt.Kind {
 	case StmtLet:
 		value, err := i.evaluateExpression(stmt.Value)
 		if err != nil {
 			return err
 		}
-		i.Env.Set(stmt.Name, value, stmt.Mutable)
+		if stmt.Names != nil {
+			return i.locate(i.destructure(stmt.Names, value, stmt.Mutable), stmt.Location)
+		}
+		if value, err = convertNumber(value, stmt.Type.Primitive); err != nil {
+			return i.locate(err, stmt.Location)
+		}
+		i.Env.Set(stmt.Name, value, stmt.Mutable).Type = stmt.Type.Primitive
 
 	case StmtAssignment:
 		value, err := i.evaluateExpression(stmt.Value)
 		if err != nil {
 			return err
 		}
-		return i.Env.Update(stmt.Target, value)
+		if stmt.TargetExpr != nil && stmt.TargetExpr.Kind == ExprMember {
+			return i.locate(i.assignMember(stmt.TargetExpr, value), stmt.Location)
+		}
+		if stmt.TargetExpr != nil {
+			return i.locate(i.assignIndex(stmt.TargetExpr, value), stmt.Location)
+		}
+		if stmt.addr.slot > 0 {
+			if entry := i.Env.slot(stmt.addr, stmt.Target); entry != nil {
+				return i.locate(assignEntry(entry, stmt.Target, value), stmt.Location)
+			}
+		}
+		return i.locate(i.Env.Update(stmt.Target, value), stmt.Location)
 
 	case StmtExpression:
 		_, err := i.evaluateExpression(stmt.Expr)
@@ -1472,6 +3539,9 @@ func (i *Interpreter) interpretStatement(stmt *Stmt) error {
 
 	case StmtWhile:
 		for {
+			if err := i.step(); err != nil {
+				return err
+			}
 			cond, err := i.evaluateExpression(stmt.Condition)
 			if err != nil {
 				return err
@@ -1479,21 +3549,26 @@ func (i *Interpreter) interpretStatement(stmt *Stmt) error {
 			if !toBool(cond) {
 				break
 			}
-			for _, s := range stmt.Body {
-				if err := i.interpretStatement(s); err != nil {
-					return err
-				}
-				if i.ControlFlow.Type == CFBreak {
-					i.ControlFlow.Type = CFNone
-					return nil
-				}
-				if i.ControlFlow.Type == CFContinue {
-					i.ControlFlow.Type = CFNone
-					break
-				}
-				if i.ControlFlow.Type == CFReturn {
-					return nil
-				}
+			if stop, err := i.runLoopBody(stmt.Body); stop || err != nil {
+				return err
+			}
+		}
+		return i.runBlock(stmt.Else)
+
+	case StmtDoWhile:
+		for {
+			if err := i.step(); err != nil {
+				return err
+			}
+			if stop, err := i.runLoopBody(stmt.Body); stop || err != nil {
+				return err
+			}
+			cond, err := i.evaluateExpression(stmt.Condition)
+			if err != nil {
+				return err
+			}
+			if !toBool(cond) {
+				break
 			}
 		}
 
@@ -1502,6 +3577,9 @@ func (i *Interpreter) interpretStatement(stmt *Stmt) error {
 			return err
 		}
 		for {
+			if err := i.step(); err != nil {
+				return err
+			}
 			cond, err := i.evaluateExpression(stmt.Condition)
 			if err != nil {
 				return err
@@ -1509,26 +3587,17 @@ func (i *Interpreter) interpretStatement(stmt *Stmt) error {
 			if !toBool(cond) {
 				break
 			}
-			for _, s := range stmt.Body {
-				if err := i.interpretStatement(s); err != nil {
-					return err
-				}
-				if i.ControlFlow.Type == CFBreak {
-					i.ControlFlow.Type = CFNone
-					return nil
-				}
-				if i.ControlFlow.Type == CFContinue {
-					i.ControlFlow.Type = CFNone
-					break
-				}
-				if i.ControlFlow.Type == CFReturn {
-					return nil
-				}
+			if stop, err := i.runLoopBody(stmt.Body); stop || err != nil {
+				return err
 			}
 			if err := i.interpretStatement(stmt.Update); err != nil {
 				return err
 			}
 		}
+		return i.runBlock(stmt.Else)
+
+	case StmtForIn:
+		return i.interpretForIn(stmt)
 
 	case StmtReturn:
 		if stmt.Value != nil {
@@ -1546,17 +3615,50 @@ func (i *Interpreter) interpretStatement(stmt *Stmt) error {
 	case StmtContinue:
 		i.ControlFlow.Type = CFContinue
 
+	case StmtThrow:
+		value, err := i.evaluateExpression(stmt.Value)
+		if err != nil {
+			return err
+		}
+		i.ControlFlow = ControlFlow{Type: CFThrow, Value: i.locate(&ThrownError{Value: value}, stmt.Location)}
+
+	case StmtTry:
+		return i.interpretTry(stmt)
+
+	case StmtMatch:
+		return i.interpretMatch(stmt)
+
+	case StmtSelect:
+		return i.interpretSelect(stmt)
+
+	case StmtEnum:
+		i.Env.Set(stmt.Name, &EnumType{Name: stmt.Name, Variants: stmt.Variants}, false)
+
+	case StmtClass:
+		i.Env.Set(stmt.Name, i.declareClass(stmt), false)
+
+	case StmtInterface:
+		i.Env.Set(stmt.Name, &InterfaceType{Name: stmt.Name, Methods: stmt.Body}, false)
+
 	case StmtFunction:
 		var params []string
+		variadic := false
 		for _, p := range stmt.Params {
 			params = append(params, p.Name)
+			variadic = p.Variadic
 		}
 		i.Env.SetFunction(stmt.Name, params, stmt.Body)
+		i.Env.Functions[stmt.Name].Variadic = variadic
+		i.Env.Functions[stmt.Name].Module = i.module
+		i.Env.Functions[stmt.Name].Decl = stmt
 
 	case StmtImport:
 		module := i.Env.GetModule(stmt.Module)
 		if module == nil {
-			return fmt.Errorf("module not found: %s", stmt.Module)
+			var err error
+			if module, err = i.importModule(stmt.Module); err != nil {
+				return i.locate(err, stmt.Location)
+			}
 		}
 		i.Env.Set(stmt.Name, module, false)
 	}
@@ -1567,265 +3669,994 @@ func (i *Interpreter) evaluateExpression(expr *Expr) (interface{}, error) {
 	if expr == nil {
 		return nil, nil
 	}
+	value, err := i.evalExpression(expr)
+	if err != nil {
+		return nil, i.locate(err, expr.Location)
+	}
+	return value, nil
+}
+
+func (i *Interpreter) evalExpression(expr *Expr) (interface{}, error) {
 
 	switch expr.Kind {
 	case ExprLiteral:
 		return expr.Value, nil
 
 	case ExprIdentifier:
-		return i.Env.Get(expr.Name)
+		if expr.addr.slot > 0 {
+			if entry := i.Env.slot(expr.addr, expr.Name); entry != nil {
+				return entry.Value, nil
+			}
+		}
+		if entry := i.Env.lookup(expr.Name); entry != nil {
+			return entry.Value, nil
+		}
+		if fn := i.Env.GetFunction(expr.Name); fn != nil {
+			return fn, nil
+		}
+		if expr.Name == "None" {
+			return NoneValue, nil
+		}
+		if builtin, ok := i.Builtins[expr.Name]; ok {
+			name := expr.Name
+			return NativeFunc(func(args []interface{}) (interface{}, error) {
+				return i.callBuiltin(name, builtin, args)
+			}), nil
+		}
+		return nil, newError(ErrUndefined, "undefined variable: %s", expr.Name)
 
 	case ExprBinary:
 		left, err := i.evaluateExpression(expr.Left)
 		if err != nil {
 			return nil, err
 		}
+		if expr.Op == "??" {
+			if !isNullish(left) {
+				return left, nil
+			}
+			return i.evaluateExpression(expr.Right)
+		}
 		right, err := i.evaluateExpression(expr.Right)
 		if err != nil {
 			return nil, err
 		}
-		return i.evalBinaryOp(expr.Op, left, right)
+		result, err := i.charged(i.evalBinaryOp(expr.Op, left, right))
+		if err != nil || expr.Type.Primitive == "" {
+			return result, err
+		}
+		return convertNumber(result, expr.Type.Primitive)
 
 	case ExprUnary:
 		operand, err := i.evaluateExpression(expr.Operand)
 		if err != nil {
 			return nil, err
 		}
-		return i.evalUnaryOp(expr.Op, operand)
+		result, err := i.evalUnaryOp(expr.Op, operand)
+		if err != nil || expr.Type.Primitive == "" {
+			return result, err
+		}
+		return convertNumber(result, expr.Type.Primitive)
 
 	case ExprCall:
 		if expr.Func.Kind == ExprIdentifier {
 			funcName := expr.Func.Name
-			if builtin, ok := i.Builtins[funcName]; ok {
-				var args []interface{}
-				for _, arg := range expr.Args {
-					val, err := i.evaluateExpression(arg)
+			// a variable holding a function shadows declared functions and builtins
+			if i.Env.lookup(funcName) == nil {
+				if builtin, ok := i.Builtins[funcName]; ok {
+					args, err := i.evaluateArgs(expr.Args)
 					if err != nil {
 						return nil, err
 					}
-					args = append(args, val)
+					return i.callBuiltin(funcName, builtin, args)
 				}
-				return builtin(args), nil
-			}
-
-			if fn := i.Env.GetFunction(funcName); fn != nil {
-				var argVals []interface{}
-				for _, arg := range expr.Args {
-					val, err := i.evaluateExpression(arg)
+				if fn := i.Env.GetFunction(funcName); fn != nil {
+					base := len(i.args)
+					args, err := i.stackArgs(expr.Args)
 					if err != nil {
 						return nil, err
 					}
-					argVals = append(argVals, val)
+					result, err := i.callFunction(funcName, fn, args)
+					i.popArgs(base)
+					return result, err
+				}
+			}
+		}
+
+		fn, err := i.evaluateExpression(expr.Func)
+		if err != nil {
+			return nil, err
+		}
+		if fn == nil && expr.Func.Kind == ExprMember && expr.Func.Optional {
+			// obj?.method() on a null obj skips the call
+			return nil, nil
+		}
+		args, err := i.evaluateArgs(expr.Args)
+		if err != nil {
+			return nil, err
+		}
+		return i.callValue(calleeName(expr.Func), fn, args)
+
+	case ExprArray:
+		return i.charged(i.evaluateArgs(expr.Elements))
+
+	case ExprIs:
+		value, err := i.evaluateExpression(expr.Operand)
+		if err != nil {
+			return nil, err
+		}
+		if iface, ok := i.lookupInterface(expr.Name); ok {
+			return iface.satisfiedBy(value), nil
+		}
+		return valueIs(value, parseTypeAnnotation(expr.Name)), nil
+
+	case ExprTuple:
+		elements, err := i.evaluateArgs(expr.Elements)
+		if err != nil {
+			return nil, err
+		}
+		return i.charged(Tuple(elements), nil)
+
+	case ExprSpread:
+		return nil, newError(ErrSyntax, "spread is only allowed in argument lists and array literals")
+
+	case ExprPropagate:
+		value, err := i.evaluateExpression(expr.Operand)
+		if err != nil {
+			return nil, err
+		}
+		return i.evalPropagate(value)
+
+	case ExprAwait:
+		value, err := i.evaluateExpression(expr.Operand)
+		if err != nil {
+			return nil, err
+		}
+		return i.tasks.await(value)
+
+	case ExprSpawn:
+		call := expr.Operand
+		callee, err := i.evaluateExpression(call.Func)
+		if err != nil {
+			return nil, err
+		}
+		fn, ok := callee.(*FuncDef)
+		if !ok {
+			return nil, newError(ErrTypeMismatch, "spawn expects a Strata function, got %s", describeValue(callee))
+		}
+		args, err := i.evaluateArgs(call.Args)
+		if err != nil {
+			return nil, err
+		}
+		return i.startAsync(calleeName(call.Func), fn, args), nil
+
+	case ExprMap:
+		entries := make(map[string]interface{}, len(expr.Keys))
+		for idx, key := range expr.Keys {
+			value, err := i.evaluateExpression(expr.Elements[idx])
+			if err != nil {
+				return nil, err
+			}
+			entries[key] = value
+		}
+		return i.charged(entries, nil)
+
+	case ExprIndex:
+		obj, err := i.evaluateExpression(expr.Object)
+		if err != nil {
+			return nil, err
+		}
+		index, err := i.evaluateExpression(expr.Index)
+		if err != nil {
+			return nil, err
+		}
+		return indexValue(obj, index)
+
+	case ExprSlice:
+		obj, err := i.evaluateExpression(expr.Object)
+		if err != nil {
+			return nil, err
+		}
+		var bounds [2]interface{}
+		for idx, bound := range []*Expr{expr.Left, expr.Right} {
+			if bound == nil {
+				continue
+			}
+			if bounds[idx], err = i.evaluateExpression(bound); err != nil {
+				return nil, err
+			}
+		}
+		value, err := i.charged(sliceValue(obj, bounds[0], bounds[1]))
+		return value, i.locate(err, expr.Location)
+
+	case ExprMember:
+		obj, err := i.evaluateExpression(expr.Object)
+		if err != nil {
+			return nil, err
+		}
+		if expr.Optional && isNullish(obj) {
+			return nil, nil
+		}
+		if enum, ok := obj.(*EnumType); ok {
+			return enum.member(expr.Property)
+		}
+		if instance, ok := obj.(*Instance); ok {
+			return instance.member(expr.Property)
+		}
+		if handle, ok := obj.(*FileHandle); ok {
+			return handle.member(expr.Property)
+		}
+		if ch, ok := obj.(*Channel); ok {
+			return ch.member(expr.Property, i.tasks)
+		}
+		if it, ok := obj.(*IteratorValue); ok {
+			return it.member(expr.Property)
+		}
+		m, ok := obj.(map[string]interface{})
+		if !ok {
+			return nil, newError(ErrInvalidOperation, "cannot read property %s of %s", expr.Property, describeValue(obj))
+		}
+		value, ok := m[expr.Property]
+		if !ok {
+			return nil, newError(ErrUndefined, "undefined member: %s", expr.Property)
+		}
+		return value, nil
+	}
+
+	return nil, newError(ErrInvalidOperation, "unknown expression kind: %s", expr.Kind)
+}
+
+// callBuiltin runs a builtin after checking its arity. Builtins signal
+// failure by returning an error value.
+func (i *Interpreter) callBuiltin(name string, builtin func([]interface{}) interface{}, args []interface{}) (result interface{}, err error) {
+	if want, ok := builtinArity[name]; ok && len(args) < want {
+		return nil, newError(ErrArity, "%s expects %d argument(s), got %d", name, want, len(args))
+	}
+	defer recoverNative(name, &err)
+	result = builtin(args)
+	if failure, ok := result.(error); ok {
+		return nil, failure
+	}
+	return i.charged(result, nil)
+}
+
+// assignIndex stores value at an index expression such as `m["k"]` or
+// `grid[1][2]`. The collection must be reachable from a var binding or a
+// var field.
+func (i *Interpreter) assignIndex(target *Expr, value interface{}) error {
+	root := target
+	for root.Kind == ExprIndex {
+		root = root.Object
+	}
+	if root.Kind == ExprMember {
+		// `this.items[0] = x` needs items to be a var field
+		if _, err := i.fieldEntry(root); err != nil {
+			return err
+		}
+	} else if name := rootName(target); name == "" {
+		return newError(ErrInvalidOperation, "invalid assignment target")
+	} else if entry, err := i.Env.Lookup(name); err != nil {
+		return err
+	} else if !entry.Mutable {
+		return newError(ErrImmutable, "cannot modify immutable variable: %s", name).withHint("declare it with var to allow modification")
+	}
+	container, err := i.evaluateExpression(target.Object)
+	if err != nil {
+		return err
+	}
+	index, err := i.evaluateExpression(target.Index)
+	if err != nil {
+		return err
+	}
+	return setIndex(container, index, value)
+}
+
+func setIndex(container, index, value interface{}) error {
+	switch c := container.(type) {
+	case map[string]interface{}:
+		key, ok := index.(string)
+		if !ok {
+			return newError(ErrIndex, "map key must be string, got %s", describeValue(index))
+		}
+		c[key] = value
+		return nil
+	case []interface{}:
+		pos, err := listPosition(index, len(c))
+		if err != nil {
+			return err
+		}
+		c[pos] = value
+		return nil
+	case []string:
+		pos, err := listPosition(index, len(c))
+		if err != nil {
+			return err
+		}
+		c[pos] = toString(value)
+		return nil
+	}
+	if _, ok := container.(Tuple); ok {
+		return newError(ErrImmutable, "cannot assign to an element of a tuple")
+	}
+	return newError(ErrIndex, "cannot index %s", describeValue(container))
+}
+
+func (i *Interpreter) evaluateArgs(exprs []*Expr) ([]interface{}, error) {
+	args := make([]interface{}, 0, len(exprs))
+	for _, arg := range exprs {
+		if arg.Kind == ExprSpread {
+			spread, err := i.evaluateSpread(arg)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, spread...)
+			continue
+		}
+		value, err := i.evaluateExpression(arg)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+	return args, nil
+}
+
+// stackArgs evaluates an argument list onto the interpreter's argument
+// stack, which calls to declared functions share instead of each making a
+// slice. The arguments are only valid until popArgs; callFunction copies
+// them into the new scope before running anything that could push more.
+func (i *Interpreter) stackArgs(exprs []*Expr) ([]interface{}, error) {
+	base := len(i.args)
+	for _, arg := range exprs {
+		if arg.Kind == ExprSpread {
+			spread, err := i.evaluateSpread(arg)
+			if err != nil {
+				i.popArgs(base)
+				return nil, err
+			}
+			i.args = append(i.args, spread...)
+			continue
+		}
+		value, err := i.evaluateExpression(arg)
+		if err != nil {
+			i.popArgs(base)
+			return nil, err
+		}
+		i.args = append(i.args, value)
+	}
+	return i.args[base:len(i.args):len(i.args)], nil
+}
+
+// popArgs drops the arguments stacked above base.
+func (i *Interpreter) popArgs(base int) {
+	for idx := base; idx < len(i.args); idx++ {
+		i.args[idx] = nil
+	}
+	i.args = i.args[:base]
+}
+
+// evaluateSpread expands `...list` into its elements.
+func (i *Interpreter) evaluateSpread(expr *Expr) ([]interface{}, error) {
+	value, err := i.evaluateExpression(expr.Operand)
+	if err != nil {
+		return nil, err
+	}
+	switch list := value.(type) {
+	case []interface{}:
+		return list, nil
+	case Tuple:
+		return list, nil
+	case []string:
+		items := make([]interface{}, len(list))
+		for idx, item := range list {
+			items[idx] = item
+		}
+		return items, nil
+	}
+	return nil, i.locate(newError(ErrInvalidOperation, "cannot spread %s", describeValue(value)), expr.Location)
+}
+
+// callFunction runs a user-defined function in a new scope nested inside the
+// one it was declared in, or starts an async one and returns its promise.
+// name is how the call site referred to it.
+func (i *Interpreter) callFunction(name string, fn *FuncDef, args []interface{}) (interface{}, error) {
+	if fn.Decl != nil && fn.Decl.Async {
+		return i.startAsync(name, fn, args), nil
+	}
+	if i.MaxDepth > 0 && len(i.CallStack) >= i.MaxDepth {
+		return nil, i.locate(&LimitError{Message: fmt.Sprintf("maximum recursion depth exceeded (%d calls)", i.MaxDepth)}, i.Location)
+	}
+	oldEnv := i.Env
+	parent := fn.Closure
+	if parent == nil {
+		parent = oldEnv
+	}
+	var layout *scopeLayout
+	if fn.Decl != nil {
+		layout = fn.Decl.layout
+	}
+	i.Env = newScope(parent, layout)
+
+	for idx, param := range fn.Params {
+		if fn.Variadic && idx == len(fn.Params)-1 {
+			rest := []interface{}{}
+			if idx < len(args) {
+				rest = append(rest, args[idx:]...)
+			}
+			i.Env.Set(param, rest, false)
+		} else if idx < len(args) {
+			arg := args[idx]
+			if fn.Decl != nil {
+				var err error
+				if arg, err = convertNumber(arg, fn.Decl.Params[idx].Type.Primitive); err != nil {
+					i.Env = oldEnv
+					return nil, i.locate(err, i.Location)
+				}
+			}
+			i.Env.Set(param, arg, false)
+		}
+	}
+
+	callSite := i.Location
+	i.CallStack = append(i.CallStack, StackFrame{Function: name, CallSite: callSite, Module: i.module, Env: oldEnv})
+	prevModule := i.module
+	i.module = fn.Module
+	defer func() { i.module = prevModule }()
+
+	for _, stmt := range fn.Body {
+		err := i.interpretStatement(stmt)
+		if err == nil {
+			err = i.pendingThrow()
+		}
+		if value, ok := propagatedValue(err); ok {
+			i.Env = oldEnv
+			i.popFrame(callSite)
+			return value, nil
+		}
+		if err != nil {
+			// the frame is left on CallStack so the failing call chain can be reported
+			i.Env = oldEnv
+			return nil, err
+		}
+		if i.ControlFlow.Type == CFReturn {
+			result := i.ControlFlow.Value
+			i.ControlFlow.Type = CFNone
+			i.ControlFlow.Value = nil
+			i.Env = oldEnv
+			if fn.Decl != nil {
+				if result, err = convertNumber(result, fn.Decl.ReturnType.Primitive); err != nil {
+					return nil, i.locate(err, i.Location)
 				}
+			}
+			i.popFrame(callSite)
+			return result, nil
+		}
+	}
+
+	i.Env = oldEnv
+	i.popFrame(callSite)
+	return nil, nil
+}
+
+// indexValue reads element index of an array or key index of a map. Missing
+// map keys read as null.
+func indexValue(obj, index interface{}) (interface{}, error) {
+	if m, ok := obj.(map[string]interface{}); ok {
+		key, ok := index.(string)
+		if !ok {
+			return nil, newError(ErrIndex, "map key must be string, got %s", describeValue(index))
+		}
+		return m[key], nil
+	}
+	switch list := obj.(type) {
+	case []interface{}:
+		pos, err := listPosition(index, len(list))
+		if err != nil {
+			return nil, err
+		}
+		return list[pos], nil
+	case Tuple:
+		pos, err := listPosition(index, len(list))
+		if err != nil {
+			return nil, err
+		}
+		return list[pos], nil
+	case []string:
+		pos, err := listPosition(index, len(list))
+		if err != nil {
+			return nil, err
+		}
+		return list[pos], nil
+	case string:
+		return runeAt(list, index)
+	case *Matrix:
+		pos, err := listPosition(index, list.Rows)
+		if err != nil {
+			return nil, err
+		}
+		return list.row(pos), nil
+	case Bytes:
+		pos, err := listPosition(index, len(list))
+		if err != nil {
+			return nil, err
+		}
+		return int64(list[pos]), nil
+	}
+	return nil, newError(ErrIndex, "cannot index %s", describeValue(obj))
+}
 
-				oldEnv := i.Env
-				i.Env = &Environment{
-					Vars:      make(map[string]*VarEntry),
-					Functions: make(map[string]*FuncDef),
-					Modules:   make(map[string]interface{}),
-					Parent:    oldEnv,
-				}
+// listPosition validates an index into a list of length n.
+func listPosition(index interface{}, n int) (int, error) {
+	return indexPosition(index, n, "array")
+}
 
-				for idx, param := range fn.Params {
-					if idx < len(argVals) {
-						i.Env.Set(param, argVals[idx], false)
-					}
-				}
+// stringPosition validates an index into a string of n characters.
+func stringPosition(index interface{}, n int) (int, error) {
+	return indexPosition(index, n, "string")
+}
 
-				for _, stmt := range fn.Body {
-					if err := i.interpretStatement(stmt); err != nil {
-						i.Env = oldEnv
-						return nil, err
-					}
-					if i.ControlFlow.Type == CFReturn {
-						result := i.ControlFlow.Value
-						i.ControlFlow.Type = CFNone
-						i.ControlFlow.Value = nil
-						i.Env = oldEnv
-						return result, nil
-					}
-				}
+// indexPosition validates an index into a value of n elements, which errors
+// call kind.
+func indexPosition(index interface{}, n int, kind string) (int, error) {
+	pos, ok := index.(int64)
+	if !ok {
+		return 0, newError(ErrIndex, "%s index must be int, got %s", kind, describeValue(index))
+	}
+	if pos < 0 || pos >= int64(n) {
+		return 0, newError(ErrIndex, "index %d out of range for %s of length %d", pos, kind, n)
+	}
+	return int(pos), nil
+}
 
-				i.Env = oldEnv
-				return nil, nil
-			}
-		}
+// callValue calls a function value: a Strata function, a class or a stdlib
+// function. Stdlib modules use it to call functions passed to them.
+func (i *Interpreter) callValue(name string, fn interface{}, args []interface{}) (interface{}, error) {
+	if def, ok := fn.(*FuncDef); ok {
+		return i.callFunction(name, def, args)
+	}
+	if class, ok := fn.(*ClassType); ok {
+		return i.charged(i.instantiate(class, args))
+	}
+	return i.charged(i.callNative(name, fn, args))
+}
 
-		fn, err := i.evaluateExpression(expr.Func)
-		if err != nil {
-			return nil, err
+// NativeFunc is a module function that validates its own arguments. Unlike the
+// fixed-signature Go functions it can take a variable number of arguments and
+// report failures as errors.
+type NativeFunc func(args []interface{}) (interface{}, error)
+
+// callNative invokes a Go function exported by a stdlib module, converting
+// arguments to the types it declares.
+func (i *Interpreter) callNative(name string, fn interface{}, args []interface{}) (result interface{}, err error) {
+	if native, ok := fn.(NativeFunc); ok {
+		defer recoverNative(name, &err)
+		return native(args)
+	}
+	if _, optional := fn.(func(interface{}) interface{}); !optional {
+		if t := reflect.TypeOf(fn); t != nil && t.Kind() == reflect.Func && len(args) < t.NumIn() {
+			return nil, newError(ErrArity, "%s expects %d argument(s), got %d", name, t.NumIn(), len(args))
 		}
-
-		var args []interface{}
-		for _, arg := range expr.Args {
-			val, err := i.evaluateExpression(arg)
-			if err != nil {
-				return nil, err
-			}
-			args = append(args, val)
-		}
-
-		switch f := fn.(type) {
-		case func(interface{}) interface{}:
-			if len(args) > 0 {
-				return f(args[0]), nil
-			}
-			return f(nil), nil
-		case func(float64) float64:
-			return f(toFloat(args[0])), nil
-		case func(float64, float64) float64:
-			return f(toFloat(args[0]), toFloat(args[1])), nil
-		case func(string) string:
-			return f(toString(args[0])), nil
-		case func(string, string) string:
-			return f(toString(args[0]), toString(args[1])), nil
-		case func(string, string, string) string:
-			return f(toString(args[0]), toString(args[1]), toString(args[2])), nil
-		case func(string, string) bool:
-			return f(toString(args[0]), toString(args[1])), nil
-		case func(string, string) int:
-			return int64(f(toString(args[0]), toString(args[1]))), nil
-		case func(string, int) string:
-			return f(toString(args[0]), int(toInt(args[1]))), nil
-		case func(string) int:
-			return int64(f(toString(args[0]))), nil
-		case func(string) bool:
-			return f(toString(args[0])), nil
-		case func(string) interface{}:
-			return f(toString(args[0])), nil
-		case func(string, string) interface{}:
-			return f(toString(args[0]), toString(args[1])), nil
-		case func() int64:
-			return f(), nil
-		case func(int64) int:
-			return int64(f(toInt(args[0]))), nil
-		case func(interface{}) string:
-			return f(args[0]), nil
-		case func(interface{}) bool:
-			return f(args[0]), nil
-		case func(interface{}) float64:
-			return f(args[0]), nil
-		case func(interface{}) int64:
+	}
+	defer recoverNative(name, &err)
+	switch f := fn.(type) {
+	case func(interface{}) interface{}:
+		if len(args) > 0 {
 			return f(args[0]), nil
 		}
+		return f(nil), nil
+	case func(float64) float64:
+		return f(toFloat(args[0])), nil
+	case func(float64, float64) float64:
+		return f(toFloat(args[0]), toFloat(args[1])), nil
+	case func(string) string:
+		return f(toString(args[0])), nil
+	case func(string, string) string:
+		return f(toString(args[0]), toString(args[1])), nil
+	case func(string, string, string) string:
+		return f(toString(args[0]), toString(args[1]), toString(args[2])), nil
+	case func(string, string) bool:
+		return f(toString(args[0]), toString(args[1])), nil
+	case func(string, string) int:
+		return int64(f(toString(args[0]), toString(args[1]))), nil
+	case func(string, int) string:
+		return f(toString(args[0]), int(toInt(args[1]))), nil
+	case func(string) int:
+		return int64(f(toString(args[0]))), nil
+	case func(string) bool:
+		return f(toString(args[0])), nil
+	case func(string) interface{}:
+		return f(toString(args[0])), nil
+	case func(string, string) interface{}:
+		return f(toString(args[0]), toString(args[1])), nil
+	case func() int64:
+		return f(), nil
+	case func() float64:
+		return f(), nil
+	case func(int64) int:
+		return int64(f(toInt(args[0]))), nil
+	case func(interface{}) string:
+		return f(args[0]), nil
+	case func(interface{}) bool:
+		return f(args[0]), nil
+	case func(interface{}) float64:
+		return f(args[0]), nil
+	case func(interface{}) int64:
+		return f(args[0]), nil
+	case func(complex128) float64:
+		return f(toComplex(args[0])), nil
+	case func(complex128) complex128:
+		return f(toComplex(args[0])), nil
+	case func(float64, float64) complex128:
+		return f(toFloat(args[0]), toFloat(args[1])), nil
+	}
 
-		return nil, fmt.Errorf("not a function: %T", fn)
+	return nil, newError(ErrInvalidOperation, "not a function: %s", describeValue(fn))
+}
+
+// recoverNative turns a panic inside native code into an ordinary error.
+func recoverNative(name string, err *error) {
+	if r := recover(); r != nil {
+		*err = newError(ErrInvalidOperation, "%s failed: %v", name, r)
+	}
+}
 
+func calleeName(expr *Expr) string {
+	switch expr.Kind {
+	case ExprIdentifier:
+		return expr.Name
 	case ExprMember:
-		obj, err := i.evaluateExpression(expr.Object)
-		if err != nil {
-			return nil, err
+		return expr.Property
+	}
+	return "function"
+}
+
+// describeValue names a value's Strata type for error messages.
+func describeValue(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case int64:
+		return "int"
+	case float64:
+		return "float"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case complex128:
+		return "complex"
+	case *DataFrame:
+		return "dataframe"
+	case *Socket:
+		return "socket"
+	case *Listener:
+		return "listener"
+	case *Pattern:
+		return "pattern"
+	case *Matrix:
+		return "matrix"
+	case Bytes:
+		return "bytes"
+	case *FileHandle:
+		return "file"
+	case []interface{}, []string:
+		return "array"
+	case Tuple:
+		return "tuple"
+	case *FuncDef, NativeFunc:
+		return "function"
+	case *Promise:
+		return "promise"
+	case *Channel:
+		return "channel"
+	case *IteratorValue:
+		return "iterator"
+	case *EnumType:
+		return "enum"
+	case EnumValue:
+		return v.(EnumValue).Enum
+	case *ClassType:
+		return "class"
+	case *InterfaceType:
+		return "interface"
+	case *Instance:
+		return v.(*Instance).Class.Name
+	case Variant:
+		if v.(Variant).IsResult() {
+			return "result"
 		}
-		if m, ok := obj.(map[string]interface{}); ok {
-			return m[expr.Property], nil
+		return "option"
+	case map[string]interface{}:
+		return "map"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// SetDeterministic fixes the random seed and freezes the clock at epoch so a
+// script produces identical output on every run.
+func (i *Interpreter) SetDeterministic(seed int64, epoch time.Time) {
+	i.Deterministic = true
+	i.Rand = rand.New(rand.NewSource(seed))
+	i.Clock = func() time.Time { return epoch }
+}
+
+// iterationKeys returns the keys of a map value in the order scripts observe
+// them, sorted, whether they loop over the map or ask std::dict for its keys.
+func (i *Interpreter) iterationKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// DefaultMaxDepth bounds the call depth of a script, so runaway recursion
+// fails with an error instead of overflowing the Go stack.
+const DefaultMaxDepth = 10000
+
+func (i *Interpreter) step() error {
+	i.steps++
+	if i.MaxSteps > 0 {
+		if i.steps > i.MaxSteps {
+			return &LimitError{Message: fmt.Sprintf("step limit of %d exceeded", i.MaxSteps)}
 		}
-		return nil, nil
 	}
+	return nil
+}
 
-	return nil, fmt.Errorf("unknown expression kind: %s", expr.Kind)
+func (i *Interpreter) popFrame(callSite Location) {
+	i.CallStack = i.CallStack[:len(i.CallStack)-1]
+	i.Location = callSite
 }
 
 func (i *Interpreter) evalBinaryOp(op string, left, right interface{}) (interface{}, error) {
+	if isComplex(left) || isComplex(right) {
+		return evalComplexOp(op, toComplex(left), toComplex(right))
+	}
 	switch op {
 	case "+":
 		if ls, ok := left.(string); ok {
 			return ls + toString(right), nil
 		}
-		return toFloat(left) + toFloat(right), nil
-	case "-":
-		return toFloat(left) - toFloat(right), nil
-	case "*":
-		return toFloat(left) * toFloat(right), nil
-	case "/":
-		return toFloat(left) / toFloat(right), nil
-	case "%":
-		return int64(toInt(left)) % int64(toInt(right)), nil
+		return evalArithmetic(op, left, right)
+	case "-", "*", "/", "%":
+		return evalArithmetic(op, left, right)
 	case "==":
-		return fmt.Sprintf("%v", left) == fmt.Sprintf("%v", right), nil
+		return valuesEqual(left, right), nil
 	case "!=":
-		return fmt.Sprintf("%v", left) != fmt.Sprintf("%v", right), nil
+		return !valuesEqual(left, right), nil
 	case "<":
-		return toFloat(left) < toFloat(right), nil
+		return compareNumbers(left, right) < 0, nil
 	case ">":
-		return toFloat(left) > toFloat(right), nil
+		return compareNumbers(left, right) > 0, nil
 	case "<=":
-		return toFloat(left) <= toFloat(right), nil
+		return compareNumbers(left, right) <= 0, nil
 	case ">=":
-		return toFloat(left) >= toFloat(right), nil
+		return compareNumbers(left, right) >= 0, nil
 	case "&&":
 		return toBool(left) && toBool(right), nil
 	case "||":
 		return toBool(left) || toBool(right), nil
 	}
-	return nil, fmt.Errorf("unknown operator: %s", op)
+	return nil, newError(ErrInvalidOperation, "unknown operator: %s", op)
 }
 
 func (i *Interpreter) evalUnaryOp(op string, operand interface{}) (interface{}, error) {
+	if z, ok := operand.(complex128); ok && (op == "-" || op == "+") {
+		if op == "-" {
+			return -z, nil
+		}
+		return z, nil
+	}
 	switch op {
 	case "-":
-		return -toFloat(operand), nil
+		return negate(operand)
 	case "+":
+		if isInteger(operand) {
+			return toInt(operand), nil
+		}
 		return toFloat(operand), nil
 	case "!":
 		return !toBool(operand), nil
 	case "~":
 		return ^toInt(operand), nil
 	}
-	return nil, fmt.Errorf("unknown unary operator: %s", op)
+	return nil, newError(ErrInvalidOperation, "unknown unary operator: %s", op)
 }
 
 // ============================================================================
 // C CODE GENERATOR
 // ============================================================================
 
+// CGenerator translates a program to C that calls into the runtime library
+// in runtime/strata_runtime.h. Top-level functions become C functions with
+// the same typed signatures and the remaining top-level statements the body
+// of main. Variables are declared at the top of the function they belong
+// to, globals at file scope, since a Strata block does not scope them.
+// Statements with no C equivalent are left as comments saying so.
 type CGenerator struct {
-	code []string
+	// fn is the function being generated, nil in main.
+	fn *Stmt
+	emitter
+	codegenScope
 }
 
 func NewCGenerator() *CGenerator {
-	return &CGenerator{}
+	g := &CGenerator{}
+	g.emitter = newEmitter("c", g, loopFlags{name: "strata_broke_%d", declare: "int %s = 0;", set: "%s = 1;"})
+	return g
 }
 
-func (g *CGenerator) Generate(statements []*Stmt) string {
-	g.code = []string{}
+// Generate returns the C for a program, or the first construct the C target
+// cannot express.
+func (g *CGenerator) Generate(statements []*Stmt) (string, error) {
+	g.reset()
+	g.enter(statements)
 	g.code = append(g.code, "#include <stdio.h>")
+	g.code = append(g.code, "#include <stdlib.h>")
 	g.code = append(g.code, "#include <math.h>")
-	g.code = append(g.code, "int main() {")
+	g.code = append(g.code, "#include <complex.h>")
+	g.code = append(g.code, `#include "strata_runtime.h"`)
 
+	var functions, body []*Stmt
 	for _, stmt := range statements {
-		g.generateStatement(stmt)
+		switch stmt.Kind {
+		case StmtFunction:
+			functions = append(functions, stmt)
+		case StmtImport:
+			// Known to the scope already; the runtime provides the modules.
+		default:
+			body = append(body, stmt)
+		}
+	}
+	if globals := g.declareVariables(body); len(globals) > 0 {
+		g.code = append(g.code, "")
+		for _, v := range globals {
+			g.line("static %s %s;", g.typeToCString(v.Type), v.Name)
+		}
+	}
+	// Prototypes first, so functions may call each other in any order.
+	if len(functions) > 0 {
+		g.code = append(g.code, "")
+	}
+	for _, fn := range functions {
+		g.line("%s;", g.signature(fn))
+	}
+	for _, fn := range functions {
+		restore := g.track(fn.Location)
+		g.code = append(g.code, "")
+		g.line("%s {", g.signature(fn))
+		g.fn = fn
+		g.locals = make(map[string]TypeDef)
+		for _, p := range fn.Params {
+			g.locals[p.Name] = p.Type
+		}
+		g.indent++
+		for _, v := range g.declareVariables(fn.Body) {
+			g.line("%s %s = %s;", g.typeToCString(v.Type), v.Name, cZero(v.Type))
+		}
+		g.indent--
+		g.block(fn.Body)
+		g.fn, g.locals = nil, nil
+		g.line("}")
+		restore()
 	}
 
-	g.code = append(g.code, "return 0;")
+	g.code = append(g.code, "")
+	g.code = append(g.code, "int main() {")
+	g.block(body)
+	g.indent++
+	g.line("return 0;")
+	g.indent--
 	g.code = append(g.code, "}")
 
-	return strings.Join(g.code, "\n")
+	if g.err != nil {
+		return "", g.err
+	}
+	return strings.Join(g.code, "\n"), nil
+}
+
+// signature is the C declaration of a function statement.
+func (g *CGenerator) signature(fn *Stmt) string {
+	params := make([]string, len(fn.Params))
+	for idx, p := range fn.Params {
+		params[idx] = fmt.Sprintf("%s %s", g.typeToCString(p.Type), p.Name)
+	}
+	if len(params) == 0 {
+		params = []string{"void"}
+	}
+	return fmt.Sprintf("%s %s(%s)", g.typeToCString(returnType(fn)), fn.Name, strings.Join(params, ", "))
+}
+
+// returnType is what fn returns, void when it declares nothing.
+func returnType(fn *Stmt) TypeDef {
+	if fn.ReturnType.Kind == "" {
+		return TypeDef{Kind: KindPrimitive, Primitive: TypeVoid}
+	}
+	return fn.ReturnType
 }
 
 func (g *CGenerator) generateStatement(stmt *Stmt) {
+	if stmt == nil {
+		return
+	}
+	defer g.track(stmt.Location)()
 	switch stmt.Kind {
 	case StmtLet:
-		ctype := g.typeToCString(stmt.Type)
-		value := g.generateExpression(stmt.Value)
-		g.code = append(g.code, fmt.Sprintf("%s %s = %s;", ctype, stmt.Name, value))
+		// Declared up front, so only the initial value is left to assign.
+		if stmt.Names != nil {
+			g.fail(stmt.Location, "destructuring is not supported")
+			return
+		}
+		if stmt.Value != nil {
+			g.line("%s = %s;", stmt.Name, g.valueAs(stmt.Value, g.varType(stmt.Name)))
+		}
+	case StmtAssignment:
+		g.line("%s;", g.assignment(stmt))
 	case StmtExpression:
 		expr := g.generateExpression(stmt.Expr)
-		g.code = append(g.code, fmt.Sprintf("%s;", expr))
+		g.line("%s;", expr)
 	case StmtIf:
-		condition := g.generateExpression(stmt.Condition)
-		g.code = append(g.code, fmt.Sprintf("if (%s) {", condition))
-		for _, s := range stmt.Then {
-			g.generateStatement(s)
-		}
-		g.code = append(g.code, "}")
+		g.line("if (%s) {", g.generateExpression(stmt.Condition))
+		g.block(stmt.Then)
+		g.elseChain(stmt.Else)
+	case StmtWhile:
+		g.loop(stmt, func() {
+			g.line("while (%s) {", g.generateExpression(stmt.Condition))
+			g.block(stmt.Body)
+			g.line("}")
+		})
+	case StmtDoWhile:
+		g.loop(stmt, func() {
+			g.line("do {")
+			g.block(stmt.Body)
+			g.line("} while (%s);", g.generateExpression(stmt.Condition))
+		})
+	case StmtFor:
+		g.generateStatement(stmt.Init)
+		g.loop(stmt, func() {
+			g.line("for (; %s; %s) {", g.generateExpression(stmt.Condition), g.clause(stmt.Update))
+			g.block(stmt.Body)
+			g.line("}")
+		})
+	case StmtBreak:
+		g.breakLoop()
+	case StmtContinue:
+		g.line("continue;")
 	case StmtReturn:
-		if stmt.Value != nil {
-			value := g.generateExpression(stmt.Value)
-			g.code = append(g.code, fmt.Sprintf("return %s;", value))
-		} else {
-			g.code = append(g.code, "return 0;")
+		switch {
+		case g.fn != nil && cKind(returnType(g.fn)) == "void":
+			g.line("return;")
+		case stmt.Value == nil:
+			g.line("return 0;")
+		case g.fn != nil:
+			g.line("return %s;", g.valueAs(stmt.Value, returnType(g.fn)))
+		default:
+			g.line("return %s;", g.generateExpression(stmt.Value))
+		}
+	default:
+		g.fail(stmt.Location, "%s statements are not supported", stmt.Kind)
+	}
+}
+
+// assignment is an assignment statement as a C expression. Elements of
+// lists and maps are set through the runtime.
+func (g *CGenerator) assignment(stmt *Stmt) string {
+	target := stmt.TargetExpr
+	if target == nil {
+		return fmt.Sprintf("%s = %s", stmt.Target, g.valueAs(stmt.Value, g.varType(stmt.Target)))
+	}
+	if target.Kind == ExprIndex {
+		container := g.typeOf(target.Object)
+		obj := g.generateExpression(target.Object)
+		switch cKind(container) {
+		case "list":
+			return fmt.Sprintf("strata_list_set(%s, %s, %s)", obj, g.valueAs(target.Index, TypeRegistry["int"]), g.box(stmt.Value))
+		case "map":
+			return fmt.Sprintf("strata_map_set(%s, %s, %s)", obj, g.valueAs(target.Index, TypeRegistry["string"]), g.box(stmt.Value))
 		}
 	}
+	return fmt.Sprintf("%s = %s", g.generateExpression(target), g.generateExpression(stmt.Value))
 }
 
 func (g *CGenerator) generateExpression(expr *Expr) string {
@@ -1834,46 +4665,88 @@ func (g *CGenerator) generateExpression(expr *Expr) string {
 	}
 	switch expr.Kind {
 	case ExprLiteral:
-		if s, ok := expr.Value.(string); ok {
-			return fmt.Sprintf("\"%s\"", s)
-		}
-		return fmt.Sprintf("%v", expr.Value)
+		return cLiteral(expr)
 	case ExprIdentifier:
+		if _, isVar := g.variable(expr.Name); !isVar && g.functions[expr.Name] != nil {
+			return g.fail(expr.Location, "function values are not supported")
+		}
 		return expr.Name
 	case ExprBinary:
-		left := g.generateExpression(expr.Left)
-		right := g.generateExpression(expr.Right)
-		return fmt.Sprintf("(%s %s %s)", left, expr.Op, right)
+		return g.binary(expr)
 	case ExprUnary:
 		operand := g.generateExpression(expr.Operand)
 		return fmt.Sprintf("(%s%s)", expr.Op, operand)
 	case ExprCall:
-		fn := g.generateExpression(expr.Func)
+		if call, ok := g.runtimeCall(expr); ok {
+			return call
+		}
+		def, ok := g.calledFunction(expr)
+		if !ok {
+			return g.fail(expr.Location, "cannot call %s, which is not a top-level function or a supported builtin", calleeName(expr.Func))
+		}
 		var args []string
-		for _, arg := range expr.Args {
+		for idx, arg := range expr.Args {
+			if idx < len(def.Params) {
+				args = append(args, g.valueAs(arg, def.Params[idx].Type))
+				continue
+			}
 			args = append(args, g.generateExpression(arg))
 		}
-		return fmt.Sprintf("%s(%s)", fn, strings.Join(args, ", "))
+		return fmt.Sprintf("%s(%s)", def.Name, strings.Join(args, ", "))
 	case ExprMember:
-		obj := g.generateExpression(expr.Object)
-		return fmt.Sprintf("%s.%s", obj, expr.Property)
+		if constant, ok := g.moduleConstant(expr); ok {
+			return constant
+		}
+		return g.fail(expr.Location, "cannot read .%s, as objects are not supported", expr.Property)
+	case ExprIndex:
+		return g.index(expr)
+	case ExprArray:
+		if len(expr.Elements) == 0 {
+			return "strata_list_new()"
+		}
+		items := make([]string, len(expr.Elements))
+		for idx, element := range expr.Elements {
+			items[idx] = g.box(element)
+		}
+		return fmt.Sprintf("strata_list_of(%d, %s)", len(items), strings.Join(items, ", "))
+	case ExprMap:
+		if len(expr.Keys) == 0 {
+			return "strata_map_new()"
+		}
+		entries := make([]string, len(expr.Keys))
+		for idx, key := range expr.Keys {
+			entries[idx] = cString(key) + ", " + g.box(expr.Elements[idx])
+		}
+		return fmt.Sprintf("strata_map_of(%d, %s)", len(entries), strings.Join(entries, ", "))
 	}
-	return ""
+	return g.fail(expr.Location, "%s expressions are not supported", expr.Kind)
 }
 
 func (g *CGenerator) typeToCString(t TypeDef) string {
 	if t.Kind == KindPrimitive {
 		switch t.Primitive {
 		case TypeInt:
-			return "int"
+			// Strata ints are 64-bit.
+			return "long long"
 		case TypeFloat:
 			return "double"
 		case TypeBool:
 			return "int"
 		case TypeChar:
-			return "char"
+			// A code point, which a C char is too small for.
+			return "int"
 		case TypeString:
 			return "char*"
+		case TypeComplex:
+			return "double complex"
+		case TypeVoid:
+			return "void"
+		case TypeList, TypeArray:
+			return "StrataList*"
+		case TypeMap, TypeDict:
+			return "StrataMap*"
+		case TypeAny:
+			return "StrataValue"
 		}
 	}
 	return "int"
@@ -1886,14 +4759,21 @@ func (g *CGenerator) typeToCString(t TypeDef) string {
 type StrataumfileConfig struct {
 	Name         string            `json:"name"`
 	Version      string            `json:"version"`
+	Description  string            `json:"description,omitempty"`
+	License      string            `json:"license,omitempty"`
 	Registry     string            `json:"registry,omitempty"`
+	Main         string            `json:"main,omitempty"`
+	Bin          map[string]string `json:"bin,omitempty"`
 	Dependencies map[string]string `json:"dependencies,omitempty"`
+	Workspaces   []string          `json:"workspaces,omitempty"`
+	Scripts      map[string]string `json:"scripts,omitempty"`
 }
 
 type LockPackage struct {
 	Version   string `json:"version"`
 	Installed bool   `json:"installed"`
 	Timestamp string `json:"timestamp"`
+	Integrity string `json:"integrity,omitempty"`
 }
 
 type LockFile struct {
@@ -1904,17 +4784,28 @@ type LockFile struct {
 }
 
 type PackageManager struct {
-	ProjectRoot  string
-	Strataumfile StrataumfileConfig
-	LockFile     LockFile
+	ProjectRoot string
+	// WorkspaceRoot is the root of the workspace the project is a member
+	// of, where the lock file and packages are shared, or ProjectRoot.
+	WorkspaceRoot string
+	Strataumfile  StrataumfileConfig
+	LockFile      LockFile
+	config        *UserConfig
+	registries    map[string]*RegistryClient
+	// globalBin is where a global install links the commands of its
+	// packages; see binDir.
+	globalBin string
 }
 
 func NewPackageManager(projectRoot string) *PackageManager {
 	if projectRoot == "" {
 		projectRoot, _ = os.Getwd()
 	}
-	pm := &PackageManager{ProjectRoot: projectRoot}
+	pm := &PackageManager{ProjectRoot: projectRoot, WorkspaceRoot: projectRoot}
 	pm.loadStrataumfile()
+	if root := findWorkspaceRoot(projectRoot); root != "" {
+		pm.WorkspaceRoot = root
+	}
 	pm.loadLockFile()
 	return pm
 }
@@ -1933,7 +4824,7 @@ func (pm *PackageManager) loadStrataumfile() {
 }
 
 func (pm *PackageManager) loadLockFile() {
-	path := pm.ProjectRoot + "/Strataumfile.lock"
+	path := pm.WorkspaceRoot + "/Strataumfile.lock"
 	data, err := os.ReadFile(path)
 	if err != nil {
 		pm.LockFile = LockFile{Locked: false, Packages: make(map[string]*LockPackage)}
@@ -1953,70 +4844,134 @@ func (pm *PackageManager) saveStrataumfile() {
 }
 
 func (pm *PackageManager) saveLockFile() {
-	path := pm.ProjectRoot + "/Strataumfile.lock"
+	path := pm.WorkspaceRoot + "/Strataumfile.lock"
 	pm.LockFile.Timestamp = time.Now().Format(time.RFC3339)
 	data, _ := json.MarshalIndent(pm.LockFile, "", "  ")
 	os.WriteFile(path, data, 0644)
 	fmt.Printf("✓ Locked dependencies in %s\n", path)
 }
 
-func (pm *PackageManager) Install(packageName string) {
-	packagesDir := pm.ProjectRoot + "/.strata/packages"
+func (pm *PackageManager) Install(packageName string) error {
+	packagesDir := pm.packagesDir()
 	os.MkdirAll(packagesDir, 0755)
 
+	installed := make(map[string]bool)
 	if packageName != "" {
-		pm.installPackage(packageName, packagesDir, "")
+		if err := pm.installPackage(packageName, packagesDir, "", installed); err != nil {
+			return err
+		}
+		if err := pm.linkBins(packageName); err != nil {
+			return err
+		}
 	} else {
-		if len(pm.Strataumfile.Dependencies) == 0 {
+		deps, err := pm.dependencies()
+		if err != nil {
+			return err
+		}
+		if len(deps) == 0 {
 			fmt.Println("No dependencies to install.")
-			return
+			return nil
 		}
-		for pkg, version := range pm.Strataumfile.Dependencies {
-			pm.installPackage(pkg, packagesDir, version)
+		pkgs := make([]string, 0, len(deps))
+		for pkg := range deps {
+			pkgs = append(pkgs, pkg)
+		}
+		sort.Strings(pkgs)
+		for _, pkg := range pkgs {
+			if err := pm.installPackage(pkg, packagesDir, deps[pkg], installed); err != nil {
+				return err
+			}
+			if err := pm.linkBins(pkg); err != nil {
+				return err
+			}
 		}
 	}
 	pm.saveLockFile()
 	fmt.Println("✓ Installation complete")
+	return nil
 }
 
-func (pm *PackageManager) installPackage(packageName, packagesDir, version string) {
-	if version == "" {
-		version = "1.0.0"
+// installPackage fetches a package from the registry, and then what it
+// depends on, skipping packages already installed by this run.
+func (pm *PackageManager) installPackage(packageName, packagesDir, version string, installed map[string]bool) error {
+	if installed[packageName] {
+		return nil
+	}
+	installed[packageName] = true
+	client, err := pm.registryClient(packageName)
+	if err != nil {
+		return err
+	}
+	meta, err := client.Metadata(packageName)
+	if err != nil {
+		return err
+	}
+	resolved, err := meta.Resolve(version)
+	if err != nil {
+		return err
 	}
 	pkgDir := packagesDir + "/" + packageName
-	os.MkdirAll(pkgDir, 0755)
-
-	moduleContent := fmt.Sprintf(`// %s module (v%s)
-export func init() => void {
-    io.print("%s loaded")
-}
-`, packageName, version, packageName)
-	os.WriteFile(pkgDir+"/index.str", []byte(moduleContent), 0644)
 
-	pkgInfo := map[string]string{"name": packageName, "version": version, "main": "index.str"}
-	data, _ := json.MarshalIndent(pkgInfo, "", "  ")
-	os.WriteFile(pkgDir+"/package.json", data, 0644)
+	// A locked version must come out as it was locked: either it is still
+	// installed intact or the download has to match its checksum.
+	expect := ""
+	if lock := pm.LockFile.Packages[packageName]; lock != nil && lock.Version == resolved {
+		expect = lock.Integrity
+	}
+	if expect != "" && verifyPackage(packageName, pm.LockFile.Packages[packageName], pkgDir) == nil {
+		fmt.Printf("✓ %s@%s is up to date\n", packageName, resolved)
+	} else {
+		integrity, err := client.Download(meta, resolved, pkgDir, expect)
+		if err != nil {
+			return err
+		}
+		pm.LockFile.Packages[packageName] = &LockPackage{
+			Version:   resolved,
+			Installed: true,
+			Timestamp: time.Now().Format(time.RFC3339),
+			Integrity: integrity,
+		}
+		fmt.Printf("✓ Installed %s@%s\n", packageName, resolved)
+	}
 
-	pm.LockFile.Packages[packageName] = &LockPackage{
-		Version:   version,
-		Installed: true,
-		Timestamp: time.Now().Format(time.RFC3339),
+	deps := meta.Versions[resolved].Dependencies
+	names := make([]string, 0, len(deps))
+	for name := range deps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := pm.installPackage(name, packagesDir, deps[name], installed); err != nil {
+			return fmt.Errorf("%s@%s depends on %s: %v", packageName, resolved, name, err)
+		}
 	}
-	fmt.Printf("✓ Installed %s@%s\n", packageName, version)
+	return nil
 }
 
-func (pm *PackageManager) Add(packageName, version string) {
+func (pm *PackageManager) Add(packageName, version string) error {
 	if version == "" {
 		version = "latest"
 	}
+	if pm.isWorkspaceMember(packageName) {
+		pm.Strataumfile.Dependencies[packageName] = workspaceVersion
+		pm.saveStrataumfile()
+		fmt.Printf("✓ Added %s from the workspace\n", packageName)
+		return nil
+	}
+	packagesDir := pm.packagesDir()
+	os.MkdirAll(packagesDir, 0755)
+	if err := pm.installPackage(packageName, packagesDir, version, make(map[string]bool)); err != nil {
+		return err
+	}
+	if err := pm.linkBins(packageName); err != nil {
+		return err
+	}
+
 	pm.Strataumfile.Dependencies[packageName] = version
 	pm.saveStrataumfile()
-
-	packagesDir := pm.ProjectRoot + "/.strata/packages"
-	os.MkdirAll(packagesDir, 0755)
-	pm.installPackage(packageName, packagesDir, version)
 	pm.saveLockFile()
 	fmt.Printf("✓ Added %s@%s\n", packageName, version)
+	return nil
 }
 
 func (pm *PackageManager) Remove(packageName string) {
@@ -2024,7 +4979,13 @@ func (pm *PackageManager) Remove(packageName string) {
 		delete(pm.Strataumfile.Dependencies, packageName)
 		pm.saveStrataumfile()
 
-		pkgDir := pm.ProjectRoot + "/.strata/packages/" + packageName
+		// Other members of a workspace may still need the package.
+		if deps, err := pm.dependencies(); err == nil && deps[packageName] != "" {
+			fmt.Printf("✓ Removed %s; the rest of the workspace still uses it\n", packageName)
+			return
+		}
+		pkgDir := pm.packagesDir() + "/" + packageName
+		pm.unlinkBins(packageName)
 		os.RemoveAll(pkgDir)
 
 		delete(pm.LockFile.Packages, packageName)
@@ -2052,29 +5013,33 @@ func (pm *PackageManager) List() {
 	}
 }
 
-func (pm *PackageManager) Init(name, version string) {
-	if version == "" {
-		version = "0.0.1"
+// Init writes the Strataumfile, and a lock file unless the project or its
+// workspace already has one.
+func (pm *PackageManager) Init(strataumfile StrataumfileConfig) {
+	if strataumfile.Version == "" {
+		strataumfile.Version = "0.0.1"
 	}
-	strataumfile := StrataumfileConfig{
-		Name:         name,
-		Version:      version,
-		Registry:     "https://registry.stratauim.io",
-		Dependencies: make(map[string]string),
+	if strataumfile.Registry == "" {
+		strataumfile.Registry = DefaultRegistry
+	}
+	if strataumfile.Dependencies == nil {
+		strataumfile.Dependencies = make(map[string]string)
 	}
 	data, _ := json.MarshalIndent(strataumfile, "", "  ")
 	os.WriteFile(pm.ProjectRoot+"/Strataumfile", data, 0644)
 
-	lockFile := LockFile{
-		Locked:    true,
-		Version:   "1.0",
-		Timestamp: time.Now().Format(time.RFC3339),
-		Packages:  make(map[string]*LockPackage),
+	if _, err := os.Stat(pm.WorkspaceRoot + "/Strataumfile.lock"); os.IsNotExist(err) {
+		lockFile := LockFile{
+			Locked:    true,
+			Version:   "1.0",
+			Timestamp: time.Now().Format(time.RFC3339),
+			Packages:  make(map[string]*LockPackage),
+		}
+		data, _ = json.MarshalIndent(lockFile, "", "  ")
+		os.WriteFile(pm.WorkspaceRoot+"/Strataumfile.lock", data, 0644)
 	}
-	data, _ = json.MarshalIndent(lockFile, "", "  ")
-	os.WriteFile(pm.ProjectRoot+"/Strataumfile.lock", data, 0644)
 
-	fmt.Printf("✓ Initialized Strata project: %s\n", name)
+	fmt.Printf("✓ Initialized Strata project: %s\n", strataumfile.Name)
 }
 
 func (pm *PackageManager) Info() {
@@ -2103,9 +5068,71 @@ func toString(v interface{}) string {
 		return val
 	case []byte:
 		return string(val)
+	case Bytes:
+		return string(val)
 	default:
-		return fmt.Sprintf("%v", v)
+		return formatValue(v)
+	}
+}
+
+// formatValue renders a runtime value the way io.print shows it. Strings
+// nested inside collections are quoted.
+func formatValue(v interface{}) string {
+	switch val := v.(type) {
+	case []interface{}:
+		parts := make([]string, len(val))
+		for idx, item := range val {
+			parts[idx] = formatElement(item)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case []string:
+		parts := make([]string, len(val))
+		for idx, item := range val {
+			parts[idx] = strconv.Quote(item)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for key := range val {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		parts := make([]string, len(keys))
+		for idx, key := range keys {
+			parts[idx] = strconv.Quote(key) + ": " + formatElement(val[key])
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	case *FuncDef:
+		return "<func " + val.Name + ">"
+	case NativeFunc:
+		return "<builtin>"
+	case nil:
+		return "null"
+	case string:
+		return val
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case float64:
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// displayValue is formatValue except that a top-level string is shown as-is.
+func displayValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return formatValue(v)
+}
+
+func formatElement(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return strconv.Quote(s)
 	}
+	return formatValue(v)
 }
 
 func toFloat(v interface{}) float64 {
@@ -2152,6 +5179,15 @@ func toInt(v interface{}) int64 {
 	return 0
 }
 
+// isNullish reports whether v is null or None, the values ?? and ?. skip.
+func isNullish(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	variant, ok := v.(Variant)
+	return ok && variant.Tag == "None"
+}
+
 func toBool(v interface{}) bool {
 	if v == nil {
 		return false
@@ -2185,100 +5221,223 @@ func toStringSlice(v interface{}) []string {
 	return nil
 }
 
-func isIdentChar(c rune) bool {
-	return unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_'
-}
-
 // ============================================================================
-// MAIN
+// RUNNER - run flags and the runner behind strata run
 // ============================================================================
 
-func main() {
-	args := os.Args[1:]
+const Version = "1.0.0"
 
+func targetArg(args []string) string {
 	if len(args) > 0 {
-		command := args[0]
-		pm := NewPackageManager("")
+		return args[0]
+	}
+	return "."
+}
 
-		switch command {
-		case "init":
-			projectName := "my-strata-project"
-			version := "0.0.1"
-			if len(args) > 1 {
-				projectName = args[1]
+// ParseRunFlags splits the flags understood by the runner from the positional
+// arguments.
+func ParseRunFlags(args []string) (RunOptions, []string, error) {
+	var opts RunOptions
+	var rest []string
+	var grants InterpreterOptions
+	for idx, arg := range args {
+		name, value, hasValue := strings.Cut(arg, "=")
+		switch {
+		case arg == "--":
+			rest = append(rest, args[idx+1:]...)
+		case !strings.HasPrefix(arg, "--"):
+			// Everything after the script path belongs to the script.
+			rest = append(rest, args[idx:]...)
+		case arg == "--deterministic":
+			opts.Deterministic = true
+		case arg == "--sandbox":
+			opts.Sandbox = &grants
+		case arg == "--allow-fs":
+			grants.AllowFS = true
+		case arg == "--allow-net":
+			grants.AllowNet = true
+		case arg == "--allow-env":
+			grants.AllowEnv = true
+		case name == "--seed" && hasValue:
+			seed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return opts, nil, fmt.Errorf("invalid --seed: %s", value)
 			}
-			if len(args) > 2 {
-				version = args[2]
+			opts.Seed = seed
+		case name == "--max-depth" && hasValue:
+			depth, err := strconv.Atoi(value)
+			if err != nil || depth < 1 {
+				return opts, nil, fmt.Errorf("invalid --max-depth: %s", value)
 			}
-			pm.Init(projectName, version)
-			return
-		case "install":
-			pkgName := ""
-			if len(args) > 1 {
-				pkgName = args[1]
+			opts.MaxDepth = depth
+		case (name == "--max-memory" || name == "--max-output") && hasValue:
+			quota, ok := parseQuota(value)
+			if !ok {
+				return opts, nil, fmt.Errorf("invalid %s: %s", name, value)
 			}
-			pm.Install(pkgName)
-			return
-		case "add":
-			if len(args) < 2 {
-				fmt.Fprintln(os.Stderr, "Usage: strataum add <package> [version]")
-				os.Exit(1)
+			if name == "--max-memory" {
+				opts.MaxMemory = quota
+			} else {
+				opts.MaxOutput = quota
 			}
-			version := "latest"
-			if len(args) > 2 {
-				version = args[2]
+		case name == "--epoch" && hasValue:
+			epoch, err := parseEpoch(value)
+			if err != nil {
+				return opts, nil, err
 			}
-			pm.Add(args[1], version)
-			return
-		case "remove":
-			if len(args) < 2 {
-				fmt.Fprintln(os.Stderr, "Usage: strataum remove <package>")
-				os.Exit(1)
+			opts.Epoch = epoch
+		case arg == "--print-lowered":
+			opts.PrintLowered = true
+		case arg == "--quiet":
+			opts.Quiet = true
+		case arg == "--crash-report":
+			opts.CrashReports = true
+		case arg == "--time":
+			opts.Time = true
+		case arg == "--json-diagnostics":
+			opts.JSONDiagnostics = true
+		case name == "--workspace" && hasValue:
+			opts.Workspace = value
+		case name == "--log-json":
+			opts.LogFile = "-"
+			if hasValue {
+				opts.LogFile = value
 			}
-			pm.Remove(args[1])
-			return
-		case "list":
-			pm.List()
-			return
-		case "info":
-			pm.Info()
-			return
+		default:
+			return opts, nil, fmt.Errorf("unknown flag: %s", arg)
+		}
+		if rest != nil {
+			break
 		}
 	}
-
-	if len(args) == 0 {
-		fmt.Fprintln(os.Stderr, "Usage: strata <file.str> or strataum <command>")
-		os.Exit(1)
+	if opts.Sandbox == nil && grants != (InterpreterOptions{}) {
+		return opts, nil, fmt.Errorf("--allow-fs, --allow-net and --allow-env require --sandbox")
+	}
+	if len(rest) > 1 {
+		opts.Args = rest[1:]
 	}
+	return opts, rest, nil
+}
 
-	startTime := time.Now()
+// enablePhaseLog turns on structured logging to stderr ("-") or to a file.
+func enablePhaseLog(path string) error {
+	switch path {
+	case "":
+		return nil
+	case "-":
+		PhaseLog = NewPhaseLogger(os.Stderr)
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	PhaseLog = NewPhaseLogger(f)
+	return nil
+}
 
-	filePath := args[0]
-	source, err := os.ReadFile(filePath)
+// parseEpoch accepts either Unix seconds or an RFC 3339 timestamp.
+func parseEpoch(value string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0).UTC(), nil
+	}
+	epoch, err := time.Parse(time.RFC3339, value)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		return time.Time{}, fmt.Errorf("invalid --epoch: %s (use Unix seconds or RFC 3339)", value)
 	}
+	return epoch, nil
+}
 
-	parser := NewParser(string(source))
-	statements, err := parser.Parse()
+func loadProjectOrReport(target string, opts RunOptions) *Project {
+	project, err := LoadProject(target)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		opts.report(err, target, "")
+		return nil
 	}
+	if project.reportDiagnostics(opts.stderr(), opts.JSONDiagnostics) > 0 {
+		return nil
+	}
+	return project
+}
 
-	typeChecker := NewTypeChecker()
-	if err := typeChecker.Check(statements); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+// RunProject runs the program or project at target and returns the exit
+// code for `strata run`.
+func RunProject(target string, opts RunOptions) (exitCode int) {
+	startTime := time.Now()
+	if err := enablePhaseLog(opts.LogFile); err != nil {
+		opts.report(err, target, "")
+		return 1
 	}
+	allocs := PhaseLog.Allocations()
 
-	interpreter := NewInterpreter()
-	if err := interpreter.Interpret(statements); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	if opts.Workspace != "" {
+		member, err := workspaceTarget(opts.Workspace, target)
+		if err != nil {
+			opts.report(err, target, "")
+			return 1
+		}
+		target = member
+	}
+	project := loadProjectOrReport(target, opts)
+	if project == nil {
+		return 1
+	}
+	PhaseLog.Phase("frontend", "", startTime, map[string]int64{
+		"modules":     int64(len(project.Order)),
+		"allocations": PhaseLog.Allocations() - allocs,
+	})
+	entry := project.EntryModule()
+	if opts.PrintLowered {
+		fmt.Fprint(opts.stderr(), FormatProgram(entry.Statements))
+	}
+
+	var interpreter *Interpreter
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(opts.stderr(), "Internal error: %v\n", r)
+			report := NewCrashReport(fmt.Sprintf("panic: %v", r), entry.Path, entry.Source, interpreter)
+			report.GoStack = debug.Stack()
+			reportCrash(report, opts)
+			exitCode = 2
+		}
+	}()
+
+	interpreter = NewInterpreter()
+	opts.Configure(interpreter)
+	interpreter.UseProject(project)
+	evalStart, evalAllocs := time.Now(), PhaseLog.Allocations()
+	err := interpreter.Interpret(entry.Statements)
+	PhaseLog.Phase("eval", project.RelPath(entry.Path), evalStart, map[string]int64{
+		"steps":       int64(interpreter.steps),
+		"allocations": PhaseLog.Allocations() - evalAllocs,
+	})
+	var exit *ExitError
+	if errors.As(err, &exit) {
+		return exit.Code
+	}
+	if err != nil {
+		opts.report(err, project.RelPath(entry.Path), entry.Source)
+		var internal *InternalError
+		if !errors.As(err, &internal) && !opts.CrashReports {
+			return 1
+		}
+		report := NewCrashReport(err.Error(), entry.Path, entry.Source, interpreter)
+		var rt *RuntimeError
+		if errors.As(err, &rt) {
+			report.Location = rt.Location
+			report.CallStack = rt.CallStack
+		}
+		if internal != nil {
+			report.GoStack = internal.Stack
+		}
+		reportCrash(report, opts)
+		return 1
 	}
+	PhaseLog.Phase("total", "", startTime, map[string]int64{"allocations": PhaseLog.Allocations() - allocs})
 
-	elapsed := time.Since(startTime)
-	fmt.Fprintf(os.Stderr, "Executed in %.2fms\n", float64(elapsed.Nanoseconds())/1e6)
+	if opts.showTime() {
+		elapsed := time.Since(startTime)
+		fmt.Fprintf(opts.stderr(), "Executed in %.2fms\n", float64(elapsed.Nanoseconds())/1e6)
+	}
+	return 0
 }
@@ -0,0 +1,355 @@
+package strata
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ============================================================================
+// STD::MATRIX - Dense float matrices and linear algebra
+// ============================================================================
+
+// Matrix is the runtime value of the matrix type: a dense, row-major grid of
+// floats. Matrices are immutable; every operation returns a new one.
+type Matrix struct {
+	Rows, Cols int
+	Data       []float64
+}
+
+func newMatrix(rows, cols int) *Matrix {
+	return &Matrix{Rows: rows, Cols: cols, Data: make([]float64, rows*cols)}
+}
+
+func (m *Matrix) at(r, c int) float64 { return m.Data[r*m.Cols+c] }
+
+func (m *Matrix) set(r, c int, v float64) { m.Data[r*m.Cols+c] = v }
+
+// row returns row r as a list value.
+func (m *Matrix) row(r int) []interface{} {
+	row := make([]interface{}, m.Cols)
+	for c := range row {
+		row[c] = m.at(r, c)
+	}
+	return row
+}
+
+func (m *Matrix) String() string {
+	rows := make([]string, m.Rows)
+	for r := range rows {
+		rows[r] = formatValue(m.row(r))
+	}
+	return "matrix[" + strings.Join(rows, ", ") + "]"
+}
+
+func (m *Matrix) size() string { return fmt.Sprintf("%dx%d", m.Rows, m.Cols) }
+
+// matrixFrom builds a matrix from a list of equally long lists of numbers.
+func matrixFrom(v interface{}) (*Matrix, error) {
+	if m, ok := v.(*Matrix); ok {
+		return m, nil
+	}
+	rows, ok := listItems(v)
+	if !ok {
+		return nil, newError(ErrTypeMismatch, "expected a matrix or a list of rows, got %s", describeValue(v))
+	}
+	if len(rows) == 0 {
+		return newMatrix(0, 0), nil
+	}
+	var m *Matrix
+	for r, rowValue := range rows {
+		row, ok := listItems(rowValue)
+		if !ok {
+			return nil, newError(ErrTypeMismatch, "matrix row %d is %s, not a list", r, describeValue(rowValue))
+		}
+		if m == nil {
+			m = newMatrix(len(rows), len(row))
+		}
+		if len(row) != m.Cols {
+			return nil, newError(ErrInvalidOperation, "matrix row %d has %d columns, expected %d", r, len(row), m.Cols)
+		}
+		for c, cell := range row {
+			if !isNumber(cell) && !isInteger(cell) {
+				return nil, newError(ErrTypeMismatch, "matrix element [%d][%d] is %s, not a number", r, c, describeValue(cell))
+			}
+			m.set(r, c, toFloat(cell))
+		}
+	}
+	return m, nil
+}
+
+func (m *Matrix) transpose() *Matrix {
+	t := newMatrix(m.Cols, m.Rows)
+	for r := 0; r < m.Rows; r++ {
+		for c := 0; c < m.Cols; c++ {
+			t.set(c, r, m.at(r, c))
+		}
+	}
+	return t
+}
+
+func (m *Matrix) multiply(o *Matrix) (*Matrix, error) {
+	if m.Cols != o.Rows {
+		return nil, newError(ErrInvalidOperation, "cannot multiply %s and %s matrices", m.size(), o.size()).withHint("the first matrix needs as many columns as the second has rows")
+	}
+	product := newMatrix(m.Rows, o.Cols)
+	for r := 0; r < m.Rows; r++ {
+		for c := 0; c < o.Cols; c++ {
+			var sum float64
+			for k := 0; k < m.Cols; k++ {
+				sum += m.at(r, k) * o.at(k, c)
+			}
+			product.set(r, c, sum)
+		}
+	}
+	return product, nil
+}
+
+// elementwise combines two matrices of the same size cell by cell.
+func (m *Matrix) elementwise(name string, o *Matrix, op func(a, b float64) float64) (*Matrix, error) {
+	if m.Rows != o.Rows || m.Cols != o.Cols {
+		return nil, newError(ErrInvalidOperation, "%s: matrix sizes differ: %s and %s", name, m.size(), o.size())
+	}
+	result := newMatrix(m.Rows, m.Cols)
+	for idx := range m.Data {
+		result.Data[idx] = op(m.Data[idx], o.Data[idx])
+	}
+	return result, nil
+}
+
+func (m *Matrix) requireSquare(name string) error {
+	if m.Rows != m.Cols {
+		return newError(ErrInvalidOperation, "%s needs a square matrix, got %s", name, m.size())
+	}
+	return nil
+}
+
+// eliminate runs Gauss-Jordan elimination with partial pivoting on m,
+// applying the same row operations to aug if it is not nil. It returns the
+// determinant of m.
+func (m *Matrix) eliminate(aug *Matrix) float64 {
+	n := m.Rows
+	a := &Matrix{Rows: n, Cols: n, Data: append([]float64{}, m.Data...)}
+	det := 1.0
+	for col := 0; col < n; col++ {
+		pivot := col
+		for r := col + 1; r < n; r++ {
+			if math.Abs(a.at(r, col)) > math.Abs(a.at(pivot, col)) {
+				pivot = r
+			}
+		}
+		if a.at(pivot, col) == 0 {
+			return 0
+		}
+		if pivot != col {
+			swapRows(a, pivot, col)
+			if aug != nil {
+				swapRows(aug, pivot, col)
+			}
+			det = -det
+		}
+		p := a.at(col, col)
+		det *= p
+		scaleRow(a, col, 1/p)
+		if aug != nil {
+			scaleRow(aug, col, 1/p)
+		}
+		for r := 0; r < n; r++ {
+			if f := a.at(r, col); r != col && f != 0 {
+				subtractRow(a, r, col, f)
+				if aug != nil {
+					subtractRow(aug, r, col, f)
+				}
+			}
+		}
+	}
+	return det
+}
+
+func scaleRow(m *Matrix, r int, k float64) {
+	for c := 0; c < m.Cols; c++ {
+		m.set(r, c, m.at(r, c)*k)
+	}
+}
+
+// subtractRow subtracts f times row src from row dst.
+func subtractRow(m *Matrix, dst, src int, f float64) {
+	for c := 0; c < m.Cols; c++ {
+		m.set(dst, c, m.at(dst, c)-f*m.at(src, c))
+	}
+}
+
+func swapRows(m *Matrix, a, b int) {
+	for c := 0; c < m.Cols; c++ {
+		m.Data[a*m.Cols+c], m.Data[b*m.Cols+c] = m.Data[b*m.Cols+c], m.Data[a*m.Cols+c]
+	}
+}
+
+func identityMatrix(n int) *Matrix {
+	m := newMatrix(n, n)
+	for idx := 0; idx < n; idx++ {
+		m.set(idx, idx, 1)
+	}
+	return m
+}
+
+func matrixModule(i *Interpreter) map[string]interface{} {
+	unary := func(name string, fn func(m *Matrix) (interface{}, error)) NativeFunc {
+		return func(args []interface{}) (interface{}, error) {
+			if err := wantArgs(name, args, 1); err != nil {
+				return nil, err
+			}
+			m, err := matrixFrom(args[0])
+			if err != nil {
+				return nil, err
+			}
+			return fn(m)
+		}
+	}
+	binary := func(name string, fn func(a, b *Matrix) (interface{}, error)) NativeFunc {
+		return func(args []interface{}) (interface{}, error) {
+			if err := wantArgs(name, args, 2); err != nil {
+				return nil, err
+			}
+			a, err := matrixFrom(args[0])
+			if err != nil {
+				return nil, err
+			}
+			b, err := matrixFrom(args[1])
+			if err != nil {
+				return nil, err
+			}
+			return fn(a, b)
+		}
+	}
+	elementwise := func(name string, op func(a, b float64) float64) NativeFunc {
+		return binary(name, func(a, b *Matrix) (interface{}, error) { return a.elementwise(name, b, op) })
+	}
+	size := func(name string, v interface{}) (int, error) {
+		n, ok := v.(int64)
+		if !ok || n < 0 {
+			return 0, newError(ErrInvalidOperation, "%s: matrix size must be a non-negative int, got %s", name, formatValue(v))
+		}
+		return int(n), nil
+	}
+	return map[string]interface{}{
+		"from": unary("from", func(m *Matrix) (interface{}, error) { return m, nil }),
+		"zeros": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("zeros", args, 2); err != nil {
+				return nil, err
+			}
+			rows, err := size("zeros", args[0])
+			if err != nil {
+				return nil, err
+			}
+			cols, err := size("zeros", args[1])
+			if err != nil {
+				return nil, err
+			}
+			if err := i.usage.reserve(8, int64(rows), int64(cols)); err != nil {
+				return nil, err
+			}
+			return newMatrix(rows, cols), nil
+		}),
+		"identity": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("identity", args, 1); err != nil {
+				return nil, err
+			}
+			n, err := size("identity", args[0])
+			if err != nil {
+				return nil, err
+			}
+			if err := i.usage.reserve(8, int64(n), int64(n)); err != nil {
+				return nil, err
+			}
+			return identityMatrix(n), nil
+		}),
+		"toList": unary("toList", func(m *Matrix) (interface{}, error) {
+			rows := make([]interface{}, m.Rows)
+			for r := range rows {
+				rows[r] = m.row(r)
+			}
+			return rows, nil
+		}),
+		"rows": unary("rows", func(m *Matrix) (interface{}, error) { return int64(m.Rows), nil }),
+		"cols": unary("cols", func(m *Matrix) (interface{}, error) { return int64(m.Cols), nil }),
+		"get": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("get", args, 3); err != nil {
+				return nil, err
+			}
+			m, err := matrixFrom(args[0])
+			if err != nil {
+				return nil, err
+			}
+			r, err := listPosition(args[1], m.Rows)
+			if err != nil {
+				return nil, err
+			}
+			c, err := listPosition(args[2], m.Cols)
+			if err != nil {
+				return nil, err
+			}
+			return m.at(r, c), nil
+		}),
+		"transpose": unary("transpose", func(m *Matrix) (interface{}, error) { return m.transpose(), nil }),
+		"multiply":  binary("multiply", func(a, b *Matrix) (interface{}, error) { return a.multiply(b) }),
+		"determinant": unary("determinant", func(m *Matrix) (interface{}, error) {
+			if err := m.requireSquare("determinant"); err != nil {
+				return nil, err
+			}
+			return m.eliminate(nil), nil
+		}),
+		"inverse": unary("inverse", func(m *Matrix) (interface{}, error) {
+			if err := m.requireSquare("inverse"); err != nil {
+				return nil, err
+			}
+			inverse := identityMatrix(m.Rows)
+			if m.eliminate(inverse) == 0 {
+				return nil, newError(ErrInvalidOperation, "matrix is singular and has no inverse")
+			}
+			return inverse, nil
+		}),
+		"add":      elementwise("add", func(a, b float64) float64 { return a + b }),
+		"subtract": elementwise("subtract", func(a, b float64) float64 { return a - b }),
+		"hadamard": elementwise("hadamard", func(a, b float64) float64 { return a * b }),
+		"scale": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("scale", args, 2); err != nil {
+				return nil, err
+			}
+			m, err := matrixFrom(args[0])
+			if err != nil {
+				return nil, err
+			}
+			if !isNumber(args[1]) && !isInteger(args[1]) {
+				return nil, newError(ErrTypeMismatch, "scale expects a number, got %s", describeValue(args[1]))
+			}
+			k := toFloat(args[1])
+			scaled := newMatrix(m.Rows, m.Cols)
+			for idx, v := range m.Data {
+				scaled.Data[idx] = v * k
+			}
+			return scaled, nil
+		}),
+		"map": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("map", args, 2); err != nil {
+				return nil, err
+			}
+			m, err := matrixFrom(args[0])
+			if err != nil {
+				return nil, err
+			}
+			mapped := newMatrix(m.Rows, m.Cols)
+			for idx, v := range m.Data {
+				result, err := i.callValue("map", args[1], []interface{}{v})
+				if err != nil {
+					return nil, err
+				}
+				if !isNumber(result) && !isInteger(result) {
+					return nil, newError(ErrTypeMismatch, "map function must return a number, got %s", describeValue(result))
+				}
+				mapped.Data[idx] = toFloat(result)
+			}
+			return mapped, nil
+		}),
+	}
+}
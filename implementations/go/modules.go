@@ -0,0 +1,230 @@
+package strata
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// USER MODULES - Loading and evaluating imported .str files
+// ============================================================================
+
+// UserModule is an imported Strata file. Its top-level functions and
+// variables become the members of the module object; names starting with an
+// underscore stay private.
+type UserModule struct {
+	Path    string
+	Name    string
+	Source  string
+	Exports map[string]interface{}
+}
+
+type moduleLoader struct {
+	project *Project
+	loaded  map[string]*UserModule
+	loading []string
+}
+
+// UseProject lets imports reuse the modules a project has already parsed
+// and checked instead of reading them again.
+func (i *Interpreter) UseProject(project *Project) {
+	i.loader().project = project
+	i.File = project.Entry
+}
+
+func (i *Interpreter) loader() *moduleLoader {
+	if i.modules == nil {
+		i.modules = &moduleLoader{loaded: make(map[string]*UserModule)}
+	}
+	return i.modules
+}
+
+// userModulePath resolves an import spec to a source file. Paths and specs
+// ending in .str always name a file; a bare name such as `mylib` does when
+// mylib.str exists next to the importing file, and otherwise names an
+// installed package.
+func userModulePath(fromFile, spec string) (string, bool) {
+	if fromFile == "" {
+		fromFile = filepath.Join(".", "main.str")
+	}
+	if isFileImport(spec) {
+		return resolveImportPath(fromFile, spec), true
+	}
+	if strings.Contains(spec, "::") {
+		return "", false
+	}
+	path := resolveImportPath(fromFile, spec)
+	if info, err := os.Stat(path); err != nil || info.IsDir() {
+		return packageModulePath(fromFile, spec)
+	}
+	return path, true
+}
+
+// packageModulePath resolves the name of a package, such as `colors` or
+// `@corp/lib`, to the main file of the package vendored in the vendor/
+// directory of the importing file's project, or else installed in its
+// .strata/packages: the file the "main" field of its package.json names, or
+// index.str. Failing that, it resolves to a member of the workspace the
+// file is in. As packages are installed side by side, a package's own
+// imports find its dependencies by looking in each directory above it.
+func packageModulePath(fromFile, name string) (string, bool) {
+	if !validPackageName(name) {
+		return "", false
+	}
+	dir, err := filepath.Abs(filepath.Dir(fromFile))
+	if err != nil {
+		return "", false
+	}
+	for {
+		candidates := []string{filepath.Join(dir, ".strata", "packages", filepath.FromSlash(name))}
+		// Only a project's vendor/ holds Strata packages.
+		if _, err := os.Stat(filepath.Join(dir, "Strataumfile")); err == nil {
+			candidates = append([]string{filepath.Join(dir, "vendor", filepath.FromSlash(name))}, candidates...)
+		}
+		for _, pkgDir := range candidates {
+			if info, err := os.Stat(pkgDir); err == nil && info.IsDir() {
+				return packageMain(pkgDir)
+			}
+		}
+		if path, ok := workspaceMemberModule(dir, name); ok {
+			return path, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// packageMain is the main file of the package in pkgDir.
+func packageMain(pkgDir string) (string, bool) {
+	main := "index.str"
+	var manifest struct {
+		Main string `json:"main"`
+	}
+	if data, err := os.ReadFile(filepath.Join(pkgDir, "package.json")); err == nil && json.Unmarshal(data, &manifest) == nil && manifest.Main != "" {
+		main = manifest.Main
+	}
+	path := filepath.Join(pkgDir, filepath.FromSlash(main))
+	if rel, err := filepath.Rel(pkgDir, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	if info, err := os.Stat(path); err != nil || info.IsDir() {
+		return "", false
+	}
+	return path, true
+}
+
+// importModule loads, checks and evaluates the file named by spec once per
+// interpreter and returns its module object.
+func (i *Interpreter) importModule(spec string) (interface{}, error) {
+	from := i.File
+	if i.module != nil {
+		from = i.module.Path
+	}
+	path, ok := userModulePath(from, spec)
+	if !ok {
+		return nil, newError(ErrImport, "module not found: %s", spec)
+	}
+	loader := i.loader()
+	if module, ok := loader.loaded[path]; ok {
+		return module.Exports, nil
+	}
+	for idx, loading := range loader.loading {
+		if loading == path {
+			cycle := append(append([]string(nil), loader.loading[idx:]...), path)
+			for n := range cycle {
+				cycle[n] = i.modulePathName(cycle[n])
+			}
+			return nil, newError(ErrImport, "import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	module := &UserModule{Path: path, Name: i.modulePathName(path)}
+	statements, err := loader.parse(module)
+	if err != nil {
+		return nil, newError(ErrImport, "cannot import %s: %v", spec, err)
+	}
+	loader.loading = append(loader.loading, path)
+	defer func() { loader.loading = loader.loading[:len(loader.loading)-1] }()
+
+	env := NewEnvironment()
+	env.Modules = i.rootEnv().Modules
+	prevEnv, prevModule := i.Env, i.module
+	i.Env, i.module = env, module
+	defer func() { i.Env, i.module = prevEnv, prevModule }()
+
+	// Like the entry module's, the eval phase of a module includes the
+	// modules it imports in turn.
+	evalStart, evalSteps, evalAllocs := time.Now(), i.steps, PhaseLog.Allocations()
+	err = i.runBlock(statements)
+	PhaseLog.Phase("eval", i.modulePathName(path), evalStart, map[string]int64{
+		"steps":       int64(i.steps - evalSteps),
+		"allocations": PhaseLog.Allocations() - evalAllocs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := i.pendingThrow(); err != nil {
+		return nil, err
+	}
+	i.ControlFlow = ControlFlow{Type: CFNone}
+
+	module.Exports = make(map[string]interface{})
+	for _, stmt := range statements {
+		if (stmt.Kind != StmtLet && stmt.Kind != StmtFunction && stmt.Kind != StmtClass && stmt.Kind != StmtInterface) || strings.HasPrefix(stmt.Name, "_") {
+			continue
+		}
+		if stmt.Kind == StmtFunction {
+			module.Exports[stmt.Name] = env.Functions[stmt.Name]
+		} else if entry, ok := env.Vars[stmt.Name]; ok {
+			module.Exports[stmt.Name] = entry.Value
+		}
+	}
+	loader.loaded[path] = module
+	return module.Exports, nil
+}
+
+// parse returns the statements of module, reusing the project's front-end
+// results when the file was already loaded with it.
+func (l *moduleLoader) parse(module *UserModule) ([]*Stmt, error) {
+	if l.project != nil {
+		if loaded, ok := l.project.Modules[module.Path]; ok && len(loaded.Errors) == 0 {
+			module.Source = loaded.Source
+			return loaded.Statements, nil
+		}
+	}
+	source, err := os.ReadFile(module.Path)
+	if err != nil {
+		return nil, err
+	}
+	module.Source = string(source)
+	statements, err := ParseSource(module.Source)
+	if err != nil {
+		return nil, err
+	}
+	if err := NewTypeChecker().Check(statements); err != nil {
+		return nil, err
+	}
+	return statements, nil
+}
+
+// modulePathName shortens path relative to the entry file for messages.
+func (i *Interpreter) modulePathName(path string) string {
+	if rel, err := filepath.Rel(filepath.Dir(i.File), path); err == nil && i.File != "" {
+		return rel
+	}
+	return path
+}
+
+func (i *Interpreter) rootEnv() *Environment {
+	env := i.Env
+	for env.Parent != nil {
+		env = env.Parent
+	}
+	return env
+}
@@ -0,0 +1,70 @@
+package strata
+
+// ============================================================================
+// TYPE TESTS - The is operator, typeof names and narrowing in if branches
+// ============================================================================
+
+// typeNames maps annotation names onto the names describeValue reports, so
+// `x is i32` holds for any int and `x is dict` for any map.
+var typeNames = map[PrimitiveType]string{
+	TypeI8: "int", TypeI16: "int", TypeI32: "int", TypeI64: "int",
+	TypeU8: "int", TypeU16: "int", TypeU32: "int", TypeU64: "int",
+	TypeF32: "float", TypeF64: "float",
+	TypeList: "array", TypeDict: "map", TypeVoid: "null",
+	TypeCallable: "function", TypeLambda: "function", TypeClosure: "function",
+}
+
+// valueIs reports whether value has type t at runtime.
+func valueIs(value interface{}, t TypeDef) bool {
+	switch t.Kind {
+	case KindOptional:
+		return value == nil || (t.InnerType != nil && valueIs(value, *t.InnerType))
+	case KindEnum, KindClass:
+		return describeValue(value) == t.Name
+	}
+	if t.Primitive == TypeAny {
+		if t.Name != "" {
+			return describeValue(value) == t.Name
+		}
+		return true
+	}
+	if t.Primitive == TypeChar {
+		s, ok := value.(string)
+		return ok && len([]rune(s)) == 1
+	}
+	name, ok := typeNames[t.Primitive]
+	if !ok {
+		name = string(t.Primitive)
+	}
+	return describeValue(value) == name && elementsAre(value, t)
+}
+
+// narrowing returns the variable an if condition tests with `is` and the
+// type it has in the then branch, or in the else branch for `!(x is T)`.
+func (tc *TypeChecker) narrowing(cond *Expr) (name string, t TypeDef, inElse bool) {
+	if cond != nil && cond.Kind == ExprUnary && cond.Op == "!" {
+		name, t, inElse = tc.narrowing(cond.Operand)
+		return name, t, !inElse
+	}
+	if cond == nil || cond.Kind != ExprIs || cond.Operand == nil || cond.Operand.Kind != ExprIdentifier {
+		return "", TypeDef{}, false
+	}
+	return cond.Operand.Name, tc.resolveType(parseTypeAnnotation(cond.Name)), false
+}
+
+// checkNarrowed checks block with name's type replaced by t, restoring the
+// declared type afterwards.
+func (tc *TypeChecker) checkNarrowed(block []*Stmt, name string, t TypeDef) error {
+	previous, declared := tc.Env.Vars[name]
+	outer, _ := tc.Env.Lookup(name)
+	tc.Env.Vars[name] = TypeEnvEntry{Type: t, Mutable: outer.Mutable, Const: outer.Const, Value: outer.Value}
+	defer func() {
+		if declared {
+			tc.Env.Vars[name] = previous
+		} else {
+			delete(tc.Env.Vars, name)
+		}
+	}()
+	tc.checkBlock(block)
+	return nil
+}
@@ -0,0 +1,212 @@
+package strata
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strconv"
+)
+
+// ============================================================================
+// STD::NET - TCP and UDP sockets
+// ============================================================================
+
+// Socket is a connected TCP or UDP socket, or a UDP socket bound by listen.
+// A bound socket replies to whoever sent the datagram it last received.
+type Socket struct {
+	conn   net.Conn
+	packet net.PacketConn
+	peer   net.Addr
+}
+
+func (s *Socket) String() string {
+	if s.conn != nil {
+		return "<socket " + s.conn.RemoteAddr().String() + ">"
+	}
+	return "<socket " + s.packet.LocalAddr().String() + ">"
+}
+
+// Listener accepts TCP connections.
+type Listener struct {
+	listener net.Listener
+}
+
+func (l *Listener) String() string {
+	return "<listener " + l.listener.Addr().String() + ">"
+}
+
+// defaultReceiveSize is how many bytes receive reads when no size is given.
+const defaultReceiveSize = 4096
+
+func netModule(i *Interpreter) map[string]interface{} {
+	return map[string]interface{}{
+		"connect": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("connect", args, 2); err != nil {
+				return nil, err
+			}
+			protocol, err := protocolArg("connect", args, 2)
+			if err != nil {
+				return nil, err
+			}
+			addr, err := addressArg("connect", toString(args[0]), args[1])
+			if err != nil {
+				return nil, err
+			}
+			conn, err := net.Dial(protocol, addr)
+			if err != nil {
+				return nil, netError("connect", err)
+			}
+			return &Socket{conn: conn}, nil
+		}),
+		"listen": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("listen", args, 1); err != nil {
+				return nil, err
+			}
+			protocol, err := protocolArg("listen", args, 1)
+			if err != nil {
+				return nil, err
+			}
+			addr, err := addressArg("listen", "", args[0])
+			if err != nil {
+				return nil, err
+			}
+			if protocol == "udp" {
+				packet, err := net.ListenPacket(protocol, addr)
+				if err != nil {
+					return nil, netError("listen", err)
+				}
+				return &Socket{packet: packet}, nil
+			}
+			listener, err := net.Listen(protocol, addr)
+			if err != nil {
+				return nil, netError("listen", err)
+			}
+			return &Listener{listener: listener}, nil
+		}),
+		"accept": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("accept", args, 1); err != nil {
+				return nil, err
+			}
+			l, ok := args[0].(*Listener)
+			if !ok {
+				return nil, newError(ErrTypeMismatch, "accept expects a listener, got %s", describeValue(args[0]))
+			}
+			conn, err := l.listener.Accept()
+			if err != nil {
+				return nil, netError("accept", err)
+			}
+			return &Socket{conn: conn}, nil
+		}),
+		"send": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("send", args, 2); err != nil {
+				return nil, err
+			}
+			s, err := socketArg("send", args[0])
+			if err != nil {
+				return nil, err
+			}
+			data := []byte(toString(args[1]))
+			var n int
+			switch {
+			case s.conn != nil:
+				n, err = s.conn.Write(data)
+			case s.peer != nil:
+				n, err = s.packet.WriteTo(data, s.peer)
+			default:
+				return nil, newError(ErrInvalidOperation, "send: socket has no peer until it receives a datagram")
+			}
+			if err != nil {
+				return nil, netError("send", err)
+			}
+			return int64(n), nil
+		}),
+		"receive": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("receive", args, 1); err != nil {
+				return nil, err
+			}
+			s, err := socketArg("receive", args[0])
+			if err != nil {
+				return nil, err
+			}
+			size := int64(defaultReceiveSize)
+			if len(args) > 1 {
+				if size, _ = args[1].(int64); size < 1 {
+					return nil, newError(ErrInvalidOperation, "receive size must be a positive int, got %s", formatValue(args[1]))
+				}
+			}
+			if err := i.usage.reserve(size); err != nil {
+				return nil, err
+			}
+			buf := make([]byte, size)
+			var n int
+			if s.conn != nil {
+				n, err = s.conn.Read(buf)
+			} else {
+				n, s.peer, err = s.packet.ReadFrom(buf)
+			}
+			if errors.Is(err, io.EOF) && n == 0 {
+				return nil, nil
+			}
+			if err != nil {
+				return nil, netError("receive", err)
+			}
+			return string(buf[:n]), nil
+		}),
+		"close": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("close", args, 1); err != nil {
+				return nil, err
+			}
+			var err error
+			switch v := args[0].(type) {
+			case *Listener:
+				err = v.listener.Close()
+			case *Socket:
+				if v.conn != nil {
+					err = v.conn.Close()
+				} else {
+					err = v.packet.Close()
+				}
+			default:
+				return nil, newError(ErrTypeMismatch, "close expects a socket or listener, got %s", describeValue(args[0]))
+			}
+			if err != nil && !errors.Is(err, net.ErrClosed) {
+				return nil, netError("close", err)
+			}
+			return nil, nil
+		}),
+	}
+}
+
+func socketArg(name string, v interface{}) (*Socket, error) {
+	s, ok := v.(*Socket)
+	if !ok {
+		return nil, newError(ErrTypeMismatch, "%s expects a socket, got %s", name, describeValue(v))
+	}
+	return s, nil
+}
+
+// protocolArg reads the optional protocol argument at idx, "tcp" or "udp".
+func protocolArg(name string, args []interface{}, idx int) (string, error) {
+	if idx >= len(args) {
+		return "tcp", nil
+	}
+	switch protocol := toString(args[idx]); protocol {
+	case "tcp", "udp":
+		return protocol, nil
+	}
+	return "", newError(ErrInvalidOperation, "%s: unknown protocol %s", name, formatValue(args[idx])).withHint(`use "tcp" or "udp"`)
+}
+
+func addressArg(name, host string, port interface{}) (string, error) {
+	n, ok := port.(int64)
+	if !ok || n < 0 || n > 65535 {
+		return "", newError(ErrInvalidOperation, "%s: invalid port %s", name, formatValue(port))
+	}
+	return net.JoinHostPort(host, strconv.FormatInt(n, 10)), nil
+}
+
+// netError reports a failed socket operation. Like other runtime errors it
+// can be caught.
+func netError(name string, err error) error {
+	return newError(ErrInvalidOperation, "%s failed: %v", name, err)
+}
@@ -0,0 +1,48 @@
+package strata
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestNetSendsAndReceivesOverLoopback(t *testing.T) {
+	port := strconv.Itoa(freePort(t))
+	source := `import io from std::io
+import net from std::net
+let listener: any = net.listen(` + port + `)
+let client: any = net.connect("127.0.0.1", ` + port + `)
+let conn: any = net.accept(listener)
+net.send(client, "ping")
+io.print(net.receive(conn))
+net.send(conn, "pong")
+io.print(net.receive(client))
+net.close(client)
+io.print(net.receive(conn))
+net.close(conn)
+net.close(listener)
+
+let bound: any = net.listen(` + port + `, "udp")
+let peer: any = net.connect("127.0.0.1", ` + port + `, "udp")
+net.send(peer, "hello")
+io.print(net.receive(bound))
+net.send(bound, "back")
+io.print(net.receive(peer, 2))
+net.close(peer)
+net.close(bound)
+`
+	var out strings.Builder
+	if err := RunSource(source, RunOptions{Stdout: &out}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "ping\npong\nnull\nhello\nba\n"; out.String() != want {
+		t.Errorf("printed %q, want %q", out.String(), want)
+	}
+
+	err := RunSource(source, RunOptions{Sandbox: &InterpreterOptions{}})
+	var diag *StrataError
+	if !errors.As(err, &diag) || diag.Code != ErrPermission {
+		t.Errorf("opening a socket in the sandbox gave %v, want a permission error", err)
+	}
+}
@@ -0,0 +1,262 @@
+package strata
+
+import "math"
+
+// ============================================================================
+// NUMERIC SEMANTICS - Integer arithmetic, float promotion and sized types
+// ============================================================================
+
+// Integers are int64 at runtime and floats float64. An operator applied to
+// two integers produces an integer, checked for overflow, and `/` divides
+// with truncation. Mixing an integer with a float promotes the integer.
+
+// intRanges bounds the values each sized integer type holds. u64 values
+// share the int64 representation, so they are limited to its maximum, and
+// literals past it are rejected like any integer too large for int64.
+// Arithmetic on a sized type is range checked as well as stores: the type
+// checker marks such operations with their type, which the interpreter
+// checks the result against.
+var intRanges = map[PrimitiveType][2]int64{
+	TypeI8:  {math.MinInt8, math.MaxInt8},
+	TypeI16: {math.MinInt16, math.MaxInt16},
+	TypeI32: {math.MinInt32, math.MaxInt32},
+	TypeU8:  {0, math.MaxUint8},
+	TypeU16: {0, math.MaxUint16},
+	TypeU32: {0, math.MaxUint32},
+	TypeU64: {0, math.MaxInt64},
+}
+
+func isIntegerType(p PrimitiveType) bool {
+	_, sized := intRanges[p]
+	return sized || p == TypeInt || p == TypeI64
+}
+
+func isFloatType(p PrimitiveType) bool {
+	return p == TypeFloat || p == TypeF32 || p == TypeF64
+}
+
+// isInteger reports whether v is an integer value.
+func isInteger(v interface{}) bool {
+	switch v.(type) {
+	case int64, int, int32:
+		return true
+	}
+	return false
+}
+
+// numericConversion reports whether a value of type actual may be stored
+// where expected is declared: any integer type converts to another, with
+// the range checked when the value is stored, and integers promote to
+// floats.
+func numericConversion(actual, expected PrimitiveType) bool {
+	if isIntegerType(expected) {
+		return isIntegerType(actual)
+	}
+	return isFloatType(expected) && (isIntegerType(actual) || isFloatType(actual))
+}
+
+// arithmeticType is the type of a numeric binary operation. A plain int
+// takes on the sized integer type it is combined with.
+func arithmeticType(left, right TypeDef) TypeDef {
+	if isFloatType(right.Primitive) && isIntegerType(left.Primitive) {
+		return right
+	}
+	if _, sized := intRanges[right.Primitive]; sized && left.Primitive == TypeInt {
+		return right
+	}
+	return left
+}
+
+// markSized records on each arithmetic operation within expr that works on
+// a sized integer type that type, so its result is range checked.
+func (tc *TypeChecker) markSized(expr *Expr) {
+	if expr == nil {
+		return
+	}
+	for _, child := range exprChildren(expr) {
+		tc.markSized(child)
+	}
+	arithmetic := expr.Kind == ExprUnary && expr.Op == "-"
+	if expr.Kind == ExprBinary {
+		switch expr.Op {
+		case "+", "-", "*", "/", "%":
+			arithmetic = true
+		}
+	}
+	if !arithmetic {
+		return
+	}
+	if t := tc.inferType(expr); t.Kind == KindPrimitive {
+		if _, sized := intRanges[t.Primitive]; sized {
+			expr.Type = t
+		}
+	}
+}
+
+// convertNumber converts value for storage in a variable, parameter or
+// return value declared as t: integers are promoted for float types, f32
+// values are rounded to single precision and sized integers are range
+// checked. Other values are returned unchanged.
+func convertNumber(value interface{}, t PrimitiveType) (interface{}, error) {
+	switch {
+	case isFloatType(t) && isInteger(value):
+		value = float64(toInt(value))
+	case isInteger(value):
+		if bounds, sized := intRanges[t]; sized {
+			if n := toInt(value); n < bounds[0] || n > bounds[1] {
+				return nil, newError(ErrOverflow, "value %d overflows %s", n, t).withHint("the range of " + string(t) + " is " + formatValue(bounds[0]) + " to " + formatValue(bounds[1]))
+			}
+		}
+		return value, nil
+	}
+	if f, ok := value.(float64); ok && t == TypeF32 {
+		return float64(float32(f)), nil
+	}
+	return value, nil
+}
+
+// evalArithmetic applies an arithmetic operator to two numbers.
+func evalArithmetic(op string, left, right interface{}) (interface{}, error) {
+	if isInteger(left) && isInteger(right) {
+		return intArithmetic(op, toInt(left), toInt(right))
+	}
+	l, r := toFloat(left), toFloat(right)
+	switch op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		return l / r, nil
+	}
+	if r == 0 {
+		return nil, newError(ErrDivisionByZero, "modulo by zero")
+	}
+	return math.Mod(l, r), nil
+}
+
+func intArithmetic(op string, l, r int64) (interface{}, error) {
+	var result int64
+	overflow := false
+	switch op {
+	case "+":
+		result = l + r
+		overflow = (l >= 0) == (r >= 0) && (result >= 0) != (l >= 0)
+	case "-":
+		result = l - r
+		overflow = (l >= 0) != (r >= 0) && (result >= 0) != (l >= 0)
+	case "*":
+		result = l * r
+		overflow = l != 0 && (result/l != r || (l == -1 && r == math.MinInt64)) || (r == -1 && l == math.MinInt64)
+	case "/", "%":
+		if r == 0 {
+			if op == "/" {
+				return nil, newError(ErrDivisionByZero, "division by zero")
+			}
+			return nil, newError(ErrDivisionByZero, "modulo by zero")
+		}
+		if l == math.MinInt64 && r == -1 {
+			if op == "%" {
+				return int64(0), nil
+			}
+			overflow = true
+		} else if op == "/" {
+			result = l / r
+		} else {
+			result = l % r
+		}
+	}
+	if overflow {
+		return nil, newError(ErrOverflow, "integer overflow: %d %s %d", l, op, r)
+	}
+	return boxInt(result), nil
+}
+
+// smallInts holds the integers counters and indexes usually take, already
+// boxed, so that arithmetic producing them does not allocate.
+var smallInts = func() (boxed [1024]interface{}) {
+	for n := range boxed {
+		boxed[n] = int64(n)
+	}
+	return boxed
+}()
+
+// boxInt returns n as an interface value, without allocating when it is
+// small and not negative.
+func boxInt(n int64) interface{} {
+	if n >= 0 && n < int64(len(smallInts)) {
+		return smallInts[n]
+	}
+	return n
+}
+
+// compareNumbers orders two numbers, exactly when both are integers.
+func compareNumbers(left, right interface{}) int {
+	if isInteger(left) && isInteger(right) {
+		l, r := toInt(left), toInt(right)
+		switch {
+		case l < r:
+			return -1
+		case l > r:
+			return 1
+		}
+		return 0
+	}
+	l, r := toFloat(left), toFloat(right)
+	switch {
+	case l < r:
+		return -1
+	case l > r:
+		return 1
+	}
+	return 0
+}
+
+// negate is unary minus.
+func negate(operand interface{}) (interface{}, error) {
+	if !isInteger(operand) {
+		return -toFloat(operand), nil
+	}
+	n := toInt(operand)
+	if n == math.MinInt64 {
+		return nil, newError(ErrOverflow, "integer overflow: -(%d)", n)
+	}
+	return -n, nil
+}
+
+// absolute is the abs builtin, which keeps integers integers.
+func absolute(v interface{}) interface{} {
+	if !isInteger(v) {
+		return math.Abs(toFloat(v))
+	}
+	n := toInt(v)
+	if n == math.MinInt64 {
+		return newError(ErrOverflow, "integer overflow: abs(%d)", n)
+	}
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// extremum is the argument better prefers over every other, as an integer
+// when all arguments are integers. It implements max and min.
+func extremum(args []interface{}, better func(int) bool) interface{} {
+	best := args[0]
+	for _, arg := range args[1:] {
+		if better(compareNumbers(arg, best)) {
+			best = arg
+		}
+	}
+	if isInteger(best) {
+		for _, arg := range args {
+			if !isInteger(arg) {
+				return toFloat(best)
+			}
+		}
+		return toInt(best)
+	}
+	return toFloat(best)
+}
@@ -0,0 +1,63 @@
+package strata
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// ============================================================================
+// STD::OS - Script arguments, environment variables, exit and platform
+// ============================================================================
+
+// ExitError is returned when a script calls os.exit. Like a LimitError it
+// cannot be caught; the runner exits with Code.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+func osModule(i *Interpreter) map[string]interface{} {
+	return map[string]interface{}{
+		"args": NativeFunc(func(args []interface{}) (interface{}, error) {
+			list := make([]interface{}, len(i.Args))
+			for idx, arg := range i.Args {
+				list[idx] = arg
+			}
+			return list, nil
+		}),
+		"env": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("env", args, 1); err != nil {
+				return nil, err
+			}
+			value, ok := os.LookupEnv(toString(args[0]))
+			if !ok {
+				return nil, nil
+			}
+			return value, nil
+		}),
+		"setEnv": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("setEnv", args, 2); err != nil {
+				return nil, err
+			}
+			return os.Setenv(toString(args[0]), toString(args[1])) == nil, nil
+		}),
+		"exit": NativeFunc(func(args []interface{}) (interface{}, error) {
+			code := int64(0)
+			if len(args) > 0 {
+				n, ok := args[0].(int64)
+				if !ok {
+					return nil, newError(ErrTypeMismatch, "exit code must be int, got %s", describeValue(args[0]))
+				}
+				code = n
+			}
+			return nil, &ExitError{Code: int(code)}
+		}),
+		"platform": NativeFunc(func(args []interface{}) (interface{}, error) {
+			return runtime.GOOS, nil
+		}),
+	}
+}
@@ -0,0 +1,360 @@
+package strata
+
+import (
+	"io"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// ============================================================================
+// STD::PARALLEL - Calling a function on the items of a list from goroutines
+// ============================================================================
+
+// map and each call a function on every item of a list from a pool of
+// workers, by default one per CPU. Each worker is an interpreter of its own
+// that starts from a copy of the caller's globals and of the scopes the
+// function closes over, so variables it assigns and lists, maps and objects
+// it changes are never seen by the caller or the other workers: what an item
+// contributes is what the function returns for it. Workers share the
+// caller's output, one write at a time, and read no input.
+//
+// Every item runs even when some fail; the error of the first failing item
+// in list order is then raised in the caller. An exceeded limit or os.exit
+// stops the workers from taking more items.
+
+func parallelModule(i *Interpreter) map[string]interface{} {
+	return map[string]interface{}{
+		"map": NativeFunc(func(args []interface{}) (interface{}, error) {
+			return i.parallel("map", args)
+		}),
+		"each": NativeFunc(func(args []interface{}) (interface{}, error) {
+			_, err := i.parallel("each", args)
+			return nil, err
+		}),
+	}
+}
+
+// parallel implements map and each: it calls args[1] on the items of the
+// list args[0] from args[2] workers and returns the results in order.
+func (i *Interpreter) parallel(name string, args []interface{}) ([]interface{}, error) {
+	if err := wantArgs(name, args, 2); err != nil {
+		return nil, err
+	}
+	items, err := listArg(name, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if describeValue(args[1]) != "function" {
+		return nil, newError(ErrTypeMismatch, "%s expects a function, got %s", name, describeValue(args[1]))
+	}
+	workers := runtime.GOMAXPROCS(0)
+	if len(args) > 2 {
+		n, ok := args[2].(int64)
+		if !ok || n < 1 {
+			return nil, newError(ErrInvalidOperation, "%s expects a positive number of workers, got %s", name, formatValue(args[2]))
+		}
+		workers = int(n)
+	}
+	if workers > len(items) {
+		workers = len(items)
+	}
+
+	// Seeds are drawn up front so that random numbers depend on the item
+	// rather than on which worker happens to take it.
+	seeds := make([]int64, len(items))
+	for idx := range seeds {
+		seeds[idx] = i.Rand.Int63()
+	}
+	results := make([]interface{}, len(items))
+	errs := make([]error, len(items))
+	next := make(chan int)
+	var stop sync.Once
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for n := 0; n < workers; n++ {
+		w, c := i.fork()
+		fn := c.value(args[1])
+		wg.Add(1)
+		i.tasks.start()
+		go func() {
+			defer wg.Done()
+			defer i.tasks.stop()
+			for idx := range next {
+				w.Rand = rand.New(rand.NewSource(seeds[idx]))
+				w.Location = i.Location
+				item := items[idx]
+				results[idx], errs[idx] = w.callWorker(func() (interface{}, error) {
+					return w.callValue(name, fn, []interface{}{item})
+				})
+				if errs[idx] != nil && isFatal(errs[idx]) {
+					stop.Do(func() { close(done) })
+				}
+			}
+		}()
+	}
+dispatch:
+	for idx := range items {
+		select {
+		case next <- idx:
+		case <-done:
+			break dispatch
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	var first error
+	for _, err := range errs {
+		if err != nil && isFatal(err) {
+			return nil, err
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	if first != nil {
+		return nil, first
+	}
+	return results, nil
+}
+
+// callWorker runs call on a worker, turning a panic into an InternalError as
+// Interpret does, since nothing above a worker's goroutine would recover it.
+func (i *Interpreter) callWorker(call func() (interface{}, error)) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = i.locate(&InternalError{Value: r, Stack: debug.Stack()}, i.Location)
+		}
+		i.CallStack = i.CallStack[:0]
+		i.ControlFlow = ControlFlow{Type: CFNone}
+	}()
+	if result, err = call(); err != nil {
+		return nil, err
+	}
+	return result, i.pendingThrow()
+}
+
+// fork returns a worker interpreter with the caller's options and a copy of
+// its globals, and the isolation that copies further values into it.
+func (i *Interpreter) fork() (*Interpreter, *isolation) {
+	i.lockOutput()
+	w := &Interpreter{
+		Env:           NewEnvironment(),
+		ControlFlow:   ControlFlow{Type: CFNone},
+		Stdout:        i.Stdout,
+		Stderr:        i.Stderr,
+		Stdin:         strings.NewReader(""),
+		MaxSteps:      i.MaxSteps,
+		MaxDepth:      i.MaxDepth,
+		Options:       i.Options,
+		Clock:         i.Clock,
+		Rand:          rand.New(rand.NewSource(i.Rand.Int63())),
+		Deterministic: i.Deterministic,
+		File:          i.File,
+		Args:          i.Args,
+		module:        i.module,
+		output:        i.output,
+		usage:         i.usage,
+		tasks:         i.tasks,
+	}
+	w.setupStdlib()
+	w.setupBuiltins()
+	w.loader().project = i.loader().project
+
+	c := &isolation{envs: make(map[*Environment]*Environment), copies: make(map[interface{}]interface{})}
+	root, workerRoot := i.rootEnv(), w.Env
+	for spec, module := range root.Modules {
+		if own, ok := workerRoot.Modules[spec]; ok {
+			c.copies[identity(module)] = own
+		}
+	}
+	c.envs[root] = workerRoot
+	c.copies[identity(root.Modules)] = workerRoot.Modules
+	c.fill(workerRoot, root)
+	return w, c
+}
+
+// lockOutput serializes writes to the interpreter's output, which its
+// workers share, once it first has any.
+func (i *Interpreter) lockOutput() {
+	if i.output == nil {
+		i.output = &sync.Mutex{}
+		i.Stdout = lockedWriter{i.output, i.Stdout}
+		i.Stderr = lockedWriter{i.output, i.Stderr}
+	}
+}
+
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (l lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// isolation copies scopes and values into a worker. Each scope, list, map,
+// function, class and object is copied once, so values that share one in
+// the caller share its copy in the worker. Standard modules are replaced by
+// the worker's own, which call back into the worker. An isolation for data
+// alone, as channels use, copies no scopes: it shares functions and classes,
+// and objects keep their class.
+type isolation struct {
+	envs   map[*Environment]*Environment
+	copies map[interface{}]interface{}
+	data   bool
+}
+
+// identity is a map key for the list or map v by the storage it refers to.
+// Empty lists get a key of their own each, since they may share none.
+func identity(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Slice && rv.Len() == 0 {
+		return new(int)
+	}
+	return struct {
+		ptr uintptr
+		len int
+	}{rv.Pointer(), rv.Len()}
+}
+
+func (c *isolation) env(e *Environment) *Environment {
+	if e == nil {
+		return nil
+	}
+	if copied, ok := c.envs[e]; ok {
+		return copied
+	}
+	copied := &Environment{layout: e.layout}
+	c.envs[e] = copied
+	copied.Parent = c.env(e.Parent)
+	if e.Modules != nil {
+		copied.Modules = c.value(e.Modules).(map[string]interface{})
+	}
+	c.fill(copied, e)
+	return copied
+}
+
+// fill copies the variables and functions of e into copied.
+func (c *isolation) fill(copied, e *Environment) {
+	for name, entry := range e.Vars {
+		copied.Set(name, c.value(entry.Value), entry.Mutable).Type = entry.Type
+	}
+	if e.slots != nil {
+		copied.slots = make([]VarEntry, len(e.slots))
+		for idx, entry := range e.slots {
+			entry.Value = c.value(entry.Value)
+			copied.slots[idx] = entry
+		}
+	}
+	for name, fn := range e.Functions {
+		if copied.Functions == nil {
+			copied.Functions = make(map[string]*FuncDef)
+		}
+		copied.Functions[name] = c.value(fn).(*FuncDef)
+	}
+}
+
+func (c *isolation) value(v interface{}) interface{} {
+	switch val := v.(type) {
+	case []interface{}, Tuple, []string, map[string]interface{}:
+		key := identity(val)
+		if copied, ok := c.copies[key]; ok {
+			return copied
+		}
+		return c.collection(key, val)
+	case *FuncDef, *ClassType:
+		if c.data {
+			return v
+		}
+		if copied, ok := c.copies[val]; ok {
+			return copied
+		}
+		return c.object(val)
+	case *Instance:
+		if copied, ok := c.copies[val]; ok {
+			return copied
+		}
+		return c.object(val)
+	case Variant:
+		val.Value = c.value(val.Value)
+		return val
+	case EnumValue:
+		if val.Values != nil {
+			val.Values = c.value(val.Values).([]interface{})
+		}
+		return val
+	}
+	return v
+}
+
+// collection copies a list, tuple or map, recording the copy under key
+// before copying the elements so that a collection containing itself is
+// copied once.
+func (c *isolation) collection(key, v interface{}) interface{} {
+	switch val := v.(type) {
+	case []interface{}:
+		copied := make([]interface{}, len(val))
+		c.copies[key] = copied
+		for idx, item := range val {
+			copied[idx] = c.value(item)
+		}
+		return copied
+	case Tuple:
+		copied := make(Tuple, len(val))
+		c.copies[key] = copied
+		for idx, item := range val {
+			copied[idx] = c.value(item)
+		}
+		return copied
+	case []string:
+		copied := append([]string(nil), val...)
+		c.copies[key] = copied
+		return copied
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(val))
+		c.copies[key] = copied
+		for name, item := range val {
+			copied[name] = c.value(item)
+		}
+		return copied
+	}
+	return v
+}
+
+// object copies a function, class or instance, recording the copy before
+// copying what it refers to.
+func (c *isolation) object(v interface{}) interface{} {
+	switch val := v.(type) {
+	case *FuncDef:
+		copied := *val
+		c.copies[val] = &copied
+		copied.Closure = c.env(val.Closure)
+		return &copied
+	case *ClassType:
+		copied := &ClassType{Name: val.Name, Fields: val.Fields, Methods: make(map[string]*FuncDef, len(val.Methods))}
+		c.copies[val] = copied
+		copied.Scope = c.env(val.Scope)
+		for name, method := range val.Methods {
+			copied.Methods[name] = c.value(method).(*FuncDef)
+		}
+		return copied
+	case *Instance:
+		copied := &Instance{Fields: make(map[string]*VarEntry, len(val.Fields))}
+		c.copies[val] = copied
+		copied.Class = c.value(val.Class).(*ClassType)
+		for name, entry := range val.Fields {
+			field := *entry
+			field.Value = c.value(entry.Value)
+			copied.Fields[name] = &field
+		}
+		return copied
+	}
+	return v
+}
@@ -0,0 +1,127 @@
+package strata
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"plugin"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ============================================================================
+// PLUGINS - Native modules registered from outside the standard library
+// ============================================================================
+
+// A Plugin is a native module that a Go package outside this one adds to
+// every interpreter, such as a database driver. The package registers it
+// from an init function; a binary that imports the package, or a Go plugin
+// .so on STRATA_PLUGIN_PATH that does, makes the module importable.
+type Plugin struct {
+	// Name is what scripts import, such as "std::sqlite". It must contain
+	// "::" so it cannot be mistaken for a file import.
+	Name string
+	// New builds the module's members for one interpreter. Members are
+	// NativeFuncs or any other value a script can hold.
+	New func(i *Interpreter) map[string]interface{}
+	// Requires lists what the module reaches outside the interpreter. In
+	// sandbox mode its functions raise permission errors unless all of it
+	// is granted.
+	Requires InterpreterOptions
+}
+
+var (
+	pluginsMu sync.Mutex
+	plugins   = make(map[string]Plugin)
+)
+
+// RegisterPlugin makes p available to interpreters created afterwards. It
+// panics if p has no name or constructor, or if a plugin with the same name
+// is already registered. Standard modules take precedence over plugins.
+func RegisterPlugin(p Plugin) {
+	if !strings.Contains(p.Name, "::") || p.New == nil {
+		panic(fmt.Sprintf("strata: invalid plugin %q: it needs a name containing :: and a New function", p.Name))
+	}
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	if _, dup := plugins[p.Name]; dup {
+		panic("strata: plugin registered twice: " + p.Name)
+	}
+	plugins[p.Name] = p
+}
+
+// Plugins returns the names of the registered plugins in order.
+func Plugins() []string {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	names := make([]string, 0, len(plugins))
+	for name := range plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pluginCapability is the capability the plugin named spec needs, if any.
+func pluginCapability(spec string) (capability, bool) {
+	pluginsMu.Lock()
+	p, ok := plugins[spec]
+	pluginsMu.Unlock()
+	if !ok || p.Requires == (InterpreterOptions{}) {
+		return capability{}, false
+	}
+	var names, flags []string
+	for _, c := range []capability{capFS, capNet, capEnv} {
+		if c.allowed(p.Requires) {
+			names = append(names, c.name)
+			flags = append(flags, c.flag)
+		}
+	}
+	req := p.Requires
+	return capability{strings.Join(names, " and "), strings.Join(flags, " "), func(opts InterpreterOptions) bool {
+		return (!req.AllowFS || opts.AllowFS) && (!req.AllowNet || opts.AllowNet) && (!req.AllowEnv || opts.AllowEnv)
+	}}, true
+}
+
+// setupPlugins adds the registered plugins' modules to the interpreter.
+func (i *Interpreter) setupPlugins() {
+	for _, name := range Plugins() {
+		if i.Env.GetModule(name) != nil {
+			continue
+		}
+		pluginsMu.Lock()
+		p := plugins[name]
+		pluginsMu.Unlock()
+		i.Env.SetModule(name, p.New(i))
+	}
+}
+
+// LoadPlugins opens every Go plugin (.so) in the directories of path, a
+// list separated like PATH. Opening a plugin runs its init functions, which
+// register its modules.
+func LoadPlugins(path string) error {
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			continue
+		}
+		files, err := filepath.Glob(filepath.Join(dir, "*.so"))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if _, err := plugin.Open(file); err != nil {
+				return fmt.Errorf("loading plugin %s: %v", file, err)
+			}
+		}
+	}
+	return nil
+}
+
+// LoadPluginPath loads the plugins on STRATA_PLUGIN_PATH, warning about any
+// that fail to load.
+func LoadPluginPath() {
+	if err := LoadPlugins(os.Getenv("STRATA_PLUGIN_PATH")); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
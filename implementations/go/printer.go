@@ -0,0 +1,463 @@
+package strata
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ============================================================================
+// PRINTER - Canonical Strata source from an AST
+// ============================================================================
+
+type Printer struct {
+	Indent string
+	out    strings.Builder
+	depth  int
+}
+
+func NewPrinter() *Printer {
+	return &Printer{Indent: "    "}
+}
+
+// FormatProgram renders statements as canonical Strata source using the
+// default indentation.
+func FormatProgram(statements []*Stmt) string {
+	return NewPrinter().Print(statements)
+}
+
+func (pr *Printer) Print(statements []*Stmt) string {
+	pr.out.Reset()
+	pr.depth = 0
+	pr.block(statements)
+	return pr.out.String()
+}
+
+func (pr *Printer) line(text string) {
+	pr.out.WriteString(strings.Repeat(pr.Indent, pr.depth))
+	pr.out.WriteString(text)
+	pr.out.WriteString("\n")
+}
+
+func (pr *Printer) block(statements []*Stmt) {
+	for _, stmt := range statements {
+		if stmt != nil {
+			pr.statement(stmt)
+		}
+	}
+}
+
+func (pr *Printer) body(header string, statements []*Stmt) {
+	pr.line(header + " {")
+	pr.depth++
+	pr.block(statements)
+	pr.depth--
+}
+
+// signature renders `func name(params) => type`.
+func (pr *Printer) signature(stmt *Stmt) string {
+	var params []string
+	for _, p := range stmt.Params {
+		param := fmt.Sprintf("%s: %s", p.Name, p.Type)
+		if p.Variadic {
+			param = "..." + param
+		}
+		params = append(params, param)
+	}
+	signature := fmt.Sprintf("func %s(%s) => %s", stmt.Name, strings.Join(params, ", "), stmt.ReturnType)
+	if stmt.Async {
+		signature = "async " + signature
+	}
+	return signature
+}
+
+func (pr *Printer) statement(stmt *Stmt) {
+	switch stmt.Kind {
+	case StmtIf:
+		pr.ifChain(stmt, "")
+		pr.line("}")
+	case StmtWhile:
+		pr.body(fmt.Sprintf("while (%s)", pr.Expr(stmt.Condition)), stmt.Body)
+		pr.loopElse(stmt)
+	case StmtDoWhile:
+		pr.body("do", stmt.Body)
+		pr.line(fmt.Sprintf("} while (%s)", pr.Expr(stmt.Condition)))
+	case StmtFor:
+		header := fmt.Sprintf("for (%s; %s; %s)", pr.inline(stmt.Init), pr.Expr(stmt.Condition), pr.inline(stmt.Update))
+		pr.body(header, stmt.Body)
+		pr.loopElse(stmt)
+	case StmtForIn:
+		pr.body(fmt.Sprintf("for (%s in %s)", stmt.Name, pr.Expr(stmt.Value)), stmt.Body)
+		pr.loopElse(stmt)
+	case StmtFunction:
+		pr.body(pr.signature(stmt), stmt.Body)
+		pr.line("}")
+	case StmtTry:
+		pr.body("try", stmt.Body)
+		if stmt.Catch != nil {
+			header := "} catch"
+			if stmt.CatchName != "" {
+				header += fmt.Sprintf(" (%s)", stmt.CatchName)
+			}
+			pr.body(header, stmt.Catch)
+		}
+		if stmt.Finally != nil {
+			pr.body("} finally", stmt.Finally)
+		}
+		pr.line("}")
+	case StmtEnum:
+		pr.line(fmt.Sprintf("enum %s {", stmt.Name))
+		pr.depth++
+		for idx, v := range stmt.Variants {
+			text := v.Name
+			if len(v.Fields) > 0 {
+				fields := make([]string, len(v.Fields))
+				for n, field := range v.Fields {
+					fields[n] = field.String()
+				}
+				text += "(" + strings.Join(fields, ", ") + ")"
+			}
+			if idx < len(stmt.Variants)-1 {
+				text += ","
+			}
+			pr.line(text)
+		}
+		pr.depth--
+		pr.line("}")
+	case StmtClass:
+		pr.body("class "+stmt.Name, stmt.Body)
+		pr.line("}")
+	case StmtInterface:
+		pr.line(fmt.Sprintf("interface %s {", stmt.Name))
+		pr.depth++
+		for _, method := range stmt.Body {
+			pr.line(pr.signature(method))
+		}
+		pr.depth--
+		pr.line("}")
+	case StmtMatch:
+		pr.line(fmt.Sprintf("match (%s) {", pr.Expr(stmt.Value)))
+		pr.depth++
+		for _, c := range stmt.Cases {
+			pr.body(pr.pattern(c.Pattern)+" =>", c.Body)
+			pr.line("}")
+		}
+		pr.depth--
+		pr.line("}")
+	case StmtSelect:
+		pr.line("select {")
+		pr.depth++
+		for _, c := range stmt.Cases {
+			head := "_"
+			if !c.Pattern.Wildcard {
+				head = pr.Expr(c.Pattern.Value)
+			}
+			if len(c.Pattern.Bindings) > 0 {
+				head = c.Pattern.Bindings[0] + " = " + head
+			}
+			pr.body(head+" =>", c.Body)
+			pr.line("}")
+		}
+		pr.depth--
+		pr.line("}")
+	default:
+		pr.line(pr.inline(stmt))
+	}
+}
+
+func (pr *Printer) pattern(pattern MatchPattern) string {
+	switch {
+	case pattern.Wildcard:
+		return "_"
+	case pattern.Enum != "":
+		return fmt.Sprintf("%s.%s(%s)", pattern.Enum, pattern.Tag, strings.Join(pattern.Bindings, ", "))
+	case pattern.Bindings != nil:
+		return fmt.Sprintf("%s(%s)", pattern.Tag, strings.Join(pattern.Bindings, ", "))
+	case pattern.Tag != "":
+		return pattern.Tag
+	}
+	return pr.Expr(pattern.Value)
+}
+
+// loopElse closes a loop, printing its else block if it has one.
+func (pr *Printer) loopElse(stmt *Stmt) {
+	if stmt.Else != nil {
+		pr.body("} else", stmt.Else)
+	}
+	pr.line("}")
+}
+
+// ifChain prints an if statement, folding a lone nested if in the else
+// branch into an `else if` clause.
+func (pr *Printer) ifChain(stmt *Stmt, prefix string) {
+	pr.body(fmt.Sprintf("%sif (%s)", prefix, pr.Expr(stmt.Condition)), stmt.Then)
+	if len(stmt.Else) == 0 {
+		return
+	}
+	if len(stmt.Else) == 1 && stmt.Else[0] != nil && stmt.Else[0].Kind == StmtIf {
+		pr.ifChain(stmt.Else[0], "} else ")
+		return
+	}
+	pr.body("} else", stmt.Else)
+}
+
+// inline renders a single-line statement without indentation.
+func (pr *Printer) inline(stmt *Stmt) string {
+	if stmt == nil {
+		return ""
+	}
+	switch stmt.Kind {
+	case StmtLet:
+		keyword := "let"
+		if stmt.Mutable {
+			keyword = "var"
+		} else if stmt.Const {
+			keyword = "const"
+		}
+		name := stmt.Name
+		if stmt.Names != nil {
+			name = "(" + strings.Join(stmt.Names, ", ") + ")"
+		}
+		return fmt.Sprintf("%s %s: %s = %s", keyword, name, stmt.Type, pr.Expr(stmt.Value))
+	case StmtAssignment:
+		target := stmt.Target
+		if stmt.TargetExpr != nil {
+			target = pr.Expr(stmt.TargetExpr)
+		}
+		return fmt.Sprintf("%s = %s", target, pr.Expr(stmt.Value))
+	case StmtExpression:
+		return pr.Expr(stmt.Expr)
+	case StmtReturn:
+		if stmt.Value == nil {
+			return "return"
+		}
+		return "return " + pr.Expr(stmt.Value)
+	case StmtThrow:
+		return "throw " + pr.Expr(stmt.Value)
+	case StmtBreak:
+		return "break"
+	case StmtContinue:
+		return "continue"
+	case StmtImport:
+		module := stmt.Module
+		if isFileImport(module) {
+			module = strconv.Quote(module)
+		}
+		return fmt.Sprintf("import %s from %s", stmt.Name, module)
+	}
+	return fmt.Sprintf("// unsupported statement: %s", stmt.Kind)
+}
+
+func (pr *Printer) Expr(expr *Expr) string {
+	if expr == nil {
+		return ""
+	}
+	switch expr.Kind {
+	case ExprLiteral:
+		if c, ok := expr.Value.(string); ok && expr.Type.Primitive == TypeChar {
+			return quoteChar(c)
+		}
+		return formatLiteral(expr.Value)
+	case ExprIdentifier:
+		return expr.Name
+	case ExprMember:
+		if expr.Optional {
+			return pr.Expr(expr.Object) + "?." + expr.Property
+		}
+		return pr.Expr(expr.Object) + "." + expr.Property
+	case ExprCall:
+		return fmt.Sprintf("%s(%s)", pr.Expr(expr.Func), pr.exprList(expr.Args))
+	case ExprArray:
+		return "[" + pr.exprList(expr.Elements) + "]"
+	case ExprTuple:
+		if len(expr.Elements) == 1 {
+			return "(" + pr.Expr(expr.Elements[0]) + ",)"
+		}
+		return "(" + pr.exprList(expr.Elements) + ")"
+	case ExprMap:
+		parts := make([]string, len(expr.Keys))
+		for idx, key := range expr.Keys {
+			parts[idx] = quoteStrata(key) + ": " + pr.Expr(expr.Elements[idx])
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	case ExprIndex:
+		return fmt.Sprintf("%s[%s]", pr.Expr(expr.Object), pr.Expr(expr.Index))
+	case ExprSlice:
+		var bounds [2]string
+		for idx, bound := range []*Expr{expr.Left, expr.Right} {
+			if bound != nil {
+				bounds[idx] = pr.Expr(bound)
+			}
+		}
+		return fmt.Sprintf("%s[%s:%s]", pr.Expr(expr.Object), bounds[0], bounds[1])
+	case ExprIs:
+		operand := pr.Expr(expr.Operand)
+		if expr.Operand != nil && (expr.Operand.Kind == ExprBinary || expr.Operand.Kind == ExprUnary) {
+			operand = "(" + operand + ")"
+		}
+		return operand + " is " + expr.Name
+	case ExprSpread:
+		return "..." + pr.Expr(expr.Operand)
+	case ExprPropagate:
+		operand := pr.Expr(expr.Operand)
+		if expr.Operand != nil && (expr.Operand.Kind == ExprBinary || expr.Operand.Kind == ExprUnary) {
+			operand = "(" + operand + ")"
+		}
+		return operand + "?"
+	case ExprUnary, ExprAwait, ExprSpawn:
+		operand := pr.Expr(expr.Operand)
+		if expr.Operand != nil && (expr.Operand.Kind == ExprBinary || expr.Operand.Kind == ExprUnary || expr.Operand.Kind == ExprIs || expr.Operand.Kind == ExprAwait) {
+			operand = "(" + operand + ")"
+		}
+		if expr.Kind == ExprAwait {
+			return "await " + operand
+		}
+		if expr.Kind == ExprSpawn {
+			return "spawn " + operand
+		}
+		return expr.Op + operand
+	case ExprBinary:
+		if expr.Interpolated {
+			return pr.interpolation(expr)
+		}
+		prec := binaryPrecedence(expr.Op)
+		left := pr.Expr(expr.Left)
+		if expr.Left != nil && expr.Left.Kind == ExprBinary && binaryPrecedence(expr.Left.Op) < prec {
+			left = "(" + left + ")"
+		}
+		right := pr.Expr(expr.Right)
+		if expr.Right != nil && expr.Right.Kind == ExprBinary && binaryPrecedence(expr.Right.Op) <= prec {
+			right = "(" + right + ")"
+		}
+		return fmt.Sprintf("%s %s %s", left, expr.Op, right)
+	}
+	return fmt.Sprintf("/* unsupported expression: %s */", expr.Kind)
+}
+
+// interpolation prints the concatenation built by parseInterpolation back as
+// an interpolated string. Its operands alternate between literal text and
+// embedded expressions, starting and ending with text.
+func (pr *Printer) interpolation(expr *Expr) string {
+	var operands []*Expr
+	for ; expr.Kind == ExprBinary && expr.Interpolated; expr = expr.Left {
+		operands = append(operands, expr.Right)
+	}
+	operands = append(operands, expr)
+	var b strings.Builder
+	b.WriteByte('"')
+	for idx := len(operands) - 1; idx >= 0; idx-- {
+		if (len(operands)-1-idx)%2 == 0 {
+			text, _ := operands[idx].Value.(string)
+			b.WriteString(escapeStrata(text))
+		} else {
+			b.WriteString("${" + pr.Expr(operands[idx]) + "}")
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func (pr *Printer) exprList(exprs []*Expr) string {
+	parts := make([]string, len(exprs))
+	for idx, expr := range exprs {
+		parts[idx] = pr.Expr(expr)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func binaryPrecedence(op string) int {
+	return operatorPrecedence[op]
+}
+
+func formatLiteral(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return quoteStrata(v)
+	case float64:
+		text := strconv.FormatFloat(v, 'f', -1, 64)
+		if !strings.ContainsAny(text, ".eEn") {
+			text += ".0"
+		}
+		return text
+	case complex128:
+		return formatLiteral(imag(v)) + "i"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// quoteStrata quotes s using only the escapes the Strata lexer understands.
+func quoteStrata(s string) string {
+	return `"` + escapeStrata(s) + `"`
+}
+
+// quoteChar quotes a character as a character literal.
+func quoteChar(c string) string {
+	if c == "'" {
+		return `'\''`
+	}
+	return "'" + escapeStrata(c) + "'"
+}
+
+// escapeStrata escapes s for use inside a string literal, including a `$`
+// that would otherwise start an interpolation.
+func escapeStrata(s string) string {
+	var b strings.Builder
+	for idx, c := range s {
+		switch c {
+		case '$':
+			if strings.HasPrefix(s[idx+1:], "{") {
+				b.WriteByte('\\')
+			}
+			b.WriteRune(c)
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\r':
+			b.WriteString(`\r`)
+		case 0:
+			b.WriteString(`\0`)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// loadFormatConfig reads the format section of the nearest .stratarc, falling
+// back to the defaults written by `strata new`.
+func loadFormatConfig(dir string) FormatConfig {
+	config := defaultToolConfig()
+	data, err := os.ReadFile(filepath.Join(findProjectRoot(dir), ".stratarc"))
+	if err == nil {
+		json.Unmarshal(data, &config)
+	}
+	return config.Format
+}
+
+// FormatFile parses path and returns its canonical source.
+func FormatFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	statements, err := ParseSource(string(data))
+	if err != nil {
+		return "", err
+	}
+	abs, _ := filepath.Abs(path)
+	printer := NewPrinter()
+	if indent := loadFormatConfig(filepath.Dir(abs)).Indent; indent > 0 {
+		printer.Indent = strings.Repeat(" ", indent)
+	}
+	return printer.Print(statements), nil
+}
@@ -0,0 +1,76 @@
+package strata
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrinterWritesCanonicalSource(t *testing.T) {
+	source := "import io from std::io\nfunc   f(a:int,b:int)=>int{ if(a>b){return a-b}else if (a==b) {return 0} else{return (a+b)*2} }\n" +
+		"var xs: list<int> = [1,2,  3]\nlet m: map<string, int> = {\"k\":1}\nfor (x in xs) { io.print(\"x=${x}\\t\") }\nlet n: int = -(1 + 2) * 3\n"
+	want := `import io from std::io
+func f(a: int, b: int) => int {
+    if (a > b) {
+        return a - b
+    } else if (a == b) {
+        return 0
+    } else {
+        return (a + b) * 2
+    }
+}
+var xs: list<int> = [1, 2, 3]
+let m: map<string, int> = {"k": 1}
+for (x in xs) {
+    io.print("x=${x}\t")
+}
+let n: int = -(1 + 2) * 3
+`
+	statements, err := ParseSource(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := FormatProgram(statements); got != want {
+		t.Errorf("printed\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPrinterRoundTripsTheExamples(t *testing.T) {
+	matches, _ := filepath.Glob(filepath.Join("..", "..", "examples", "*.str"))
+	if len(matches) == 0 {
+		t.Skip("no examples")
+	}
+	for _, path := range matches {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		statements, err := ParseSource(string(data))
+		if err != nil {
+			continue
+		}
+		printed := FormatProgram(statements)
+		reparsed, err := ParseSource(printed)
+		if err != nil {
+			t.Errorf("%s: the printed source does not parse: %v\n%s", path, err, printed)
+			continue
+		}
+		if again := FormatProgram(reparsed); again != printed {
+			t.Errorf("%s: printing is not stable:\n%s---\n%s", path, printed, again)
+		}
+	}
+}
+
+func TestPrintLoweredShowsTheEntryModule(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	script := filepath.Join(t.TempDir(), "main.str")
+	os.WriteFile(script, []byte("import io from std::io\nio.print(1+2)\n"), 0644)
+	var out, errs strings.Builder
+	if code := RunProject(script, RunOptions{Stdout: &out, Stderr: &errs, PrintLowered: true, Quiet: true}); code != 0 {
+		t.Fatalf("the run exited with %d: %s", code, errs.String())
+	}
+	if out.String() != "3\n" || errs.String() != "import io from std::io\nio.print(1 + 2)\n" {
+		t.Errorf("--print-lowered printed %q to stdout and %q to stderr", out.String(), errs.String())
+	}
+}
@@ -0,0 +1,302 @@
+package strata
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// PROJECTS - Entrypoint resolution and reachable module discovery
+// ============================================================================
+
+var defaultEntrypoints = []string{"src/main.str", "main.str"}
+
+type SourceModule struct {
+	Path       string
+	Source     string
+	Statements []*Stmt
+	Imports    []string
+	Errors     []error
+
+	importSites []importSite
+	loadErr     error
+}
+
+type importSite struct {
+	Path     string
+	Spec     string
+	Location Location
+}
+
+type Project struct {
+	Root    string
+	Entry   string
+	Modules map[string]*SourceModule
+	Order   []string
+	Cache   *ModuleCache
+
+	// verified holds the result of checking each package directory a
+	// module was loaded from, in one of packageDirs, against lock, the
+	// packages of the lock file.
+	verifyMu    sync.Mutex
+	verified    map[string]error
+	lock        map[string]*LockPackage
+	packageDirs []string
+}
+
+// LoadProject resolves the entrypoint for target (a .str file or a project
+// directory) and parses and type-checks every module reachable through imports.
+func LoadProject(target string) (*Project, error) {
+	root, entry, err := resolveEntrypoint(target)
+	if err != nil {
+		return nil, err
+	}
+	project := &Project{Root: root, Entry: entry, Modules: make(map[string]*SourceModule)}
+	if _, err := os.Stat(filepath.Join(root, "Strataumfile")); err == nil {
+		project.Cache = NewModuleCache(root)
+	}
+	if err := project.loadAll(entry); err != nil {
+		return nil, err
+	}
+	return project, nil
+}
+
+func resolveEntrypoint(target string) (string, string, error) {
+	abs, err := filepath.Abs(target)
+	if err != nil {
+		return "", "", err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", "", err
+	}
+	if !info.IsDir() {
+		return findProjectRoot(filepath.Dir(abs)), abs, nil
+	}
+
+	candidates := defaultEntrypoints
+	if _, err := os.Stat(filepath.Join(abs, "Strataumfile")); err == nil {
+		pm := NewPackageManager(abs)
+		if pm.Strataumfile.Main != "" {
+			candidates = []string{pm.Strataumfile.Main}
+		}
+	}
+	for _, candidate := range candidates {
+		entry := filepath.Join(abs, filepath.FromSlash(candidate))
+		if _, err := os.Stat(entry); err == nil {
+			return abs, entry, nil
+		}
+	}
+	return "", "", fmt.Errorf("no entrypoint found in %s (looked for %s)", target, strings.Join(candidates, ", "))
+}
+
+func findProjectRoot(dir string) string {
+	for current := dir; ; {
+		if _, err := os.Stat(filepath.Join(current, "Strataumfile")); err == nil {
+			return current
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return dir
+		}
+		current = parent
+	}
+}
+
+// loadAll lexes, parses and checks every module reachable from entry. Modules
+// are independent at this stage, so each one is processed on a bounded pool of
+// goroutines as soon as an importer discovers it.
+func (p *Project) loadAll(entry string) error {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		workers = make(chan struct{}, runtime.NumCPU())
+	)
+	var visit func(path string)
+	visit = func(path string) {
+		mu.Lock()
+		if _, seen := p.Modules[path]; seen {
+			mu.Unlock()
+			return
+		}
+		module := &SourceModule{Path: path}
+		p.Modules[path] = module
+		mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			workers <- struct{}{}
+			p.process(module)
+			<-workers
+			for _, site := range module.importSites {
+				visit(site.Path)
+			}
+		}()
+	}
+	visit(entry)
+	wg.Wait()
+
+	if err := p.Modules[entry].loadErr; err != nil {
+		return err
+	}
+	p.Order = p.moduleOrder(entry)
+	for _, path := range p.Order {
+		module := p.Modules[path]
+		for _, site := range module.importSites {
+			if err := p.Modules[site.Path].loadErr; err != nil {
+				module.Errors = append(module.Errors, newError(ErrImport, "cannot import %s: %v", site.Spec, err).at(site.Location))
+			}
+		}
+	}
+	for path, module := range p.Modules {
+		if module.loadErr != nil {
+			delete(p.Modules, path)
+		}
+	}
+	return nil
+}
+
+func (p *Project) process(module *SourceModule) {
+	if err := p.verifyPackageModule(module.Path); err != nil {
+		module.loadErr = err
+		return
+	}
+	source, err := os.ReadFile(module.Path)
+	if err != nil {
+		module.loadErr = err
+		return
+	}
+	module.Source = string(source)
+	p.frontEnd(module)
+
+	for _, stmt := range module.Statements {
+		if stmt.Kind != StmtImport {
+			continue
+		}
+		resolved, ok := userModulePath(module.Path, stmt.Module)
+		if !ok {
+			continue
+		}
+		module.Imports = append(module.Imports, resolved)
+		module.importSites = append(module.importSites, importSite{Path: resolved, Spec: stmt.Module, Location: stmt.Location})
+	}
+}
+
+// moduleOrder lists loaded modules depth-first from entry in import order, so
+// diagnostics come out in the same order regardless of scheduling.
+func (p *Project) moduleOrder(entry string) []string {
+	var order []string
+	seen := make(map[string]bool)
+	var walk func(path string)
+	walk = func(path string) {
+		module := p.Modules[path]
+		if seen[path] || module.loadErr != nil {
+			return
+		}
+		seen[path] = true
+		order = append(order, path)
+		for _, imp := range module.Imports {
+			walk(imp)
+		}
+	}
+	walk(entry)
+	return order
+}
+
+func (p *Project) frontEnd(module *SourceModule) {
+	name := p.RelPath(module.Path)
+	if p.Cache != nil {
+		start := time.Now()
+		if statements, errs, ok := p.Cache.Load(module.Source); ok {
+			module.Statements = statements
+			module.Errors = errs
+			PhaseLog.Phase("cache", name, start, map[string]int64{"hit": 1, "statements": countStatements(statements)})
+			return
+		}
+	}
+
+	start := time.Now()
+	parser := NewParser(module.Source)
+	parser.timeLexer = PhaseLog.Enabled()
+	statements, err := parser.Parse()
+	// The parser pulls tokens as it goes, so lexing is timed from inside
+	// it and the parse phase is what remains.
+	parsing := time.Since(start) - parser.lexTime
+	PhaseLog.PhaseDuration("lex", name, parser.lexTime, map[string]int64{"tokens": int64(parser.TokenCount()), "bytes": int64(len(module.Source))})
+	PhaseLog.PhaseDuration("parse", name, parsing, map[string]int64{"statements": countStatements(statements)})
+	if err != nil {
+		module.Errors = append(module.Errors, errorList(err)...)
+	} else {
+		module.Statements = statements
+		start = time.Now()
+		if err := NewTypeChecker().Check(statements); err != nil {
+			module.Errors = append(module.Errors, errorList(err)...)
+		}
+		PhaseLog.Phase("check", name, start, map[string]int64{"errors": int64(len(module.Errors))})
+	}
+	if p.Cache != nil {
+		p.Cache.Store(module.Source, module.Statements, module.Errors)
+	}
+}
+
+func isFileImport(spec string) bool {
+	return strings.HasSuffix(spec, ".str") || strings.HasPrefix(spec, "./") || strings.HasPrefix(spec, "../") || filepath.IsAbs(spec)
+}
+
+func resolveImportPath(fromFile, spec string) string {
+	path := filepath.FromSlash(spec)
+	if !strings.HasSuffix(path, ".str") {
+		path += ".str"
+	}
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(filepath.Dir(fromFile), path)
+}
+
+func (p *Project) EntryModule() *SourceModule {
+	return p.Modules[p.Entry]
+}
+
+func (p *Project) RelPath(path string) string {
+	if rel, err := filepath.Rel(p.Root, path); err == nil {
+		return rel
+	}
+	return path
+}
+
+// ReportDiagnostics prints every module's errors against its source and
+// returns the number of errors reported.
+func (p *Project) ReportDiagnostics(w io.Writer) int {
+	return p.reportDiagnostics(w, false)
+}
+
+// reportDiagnostics is ReportDiagnostics, writing JSON lines when asJSON
+// is set.
+func (p *Project) reportDiagnostics(w io.Writer, asJSON bool) int {
+	count := 0
+	for _, path := range p.Order {
+		module := p.Modules[path]
+		for _, err := range module.Errors {
+			var diag *StrataError
+			switch {
+			case asJSON:
+				fmt.Fprint(w, RenderErrorJSON(err, p.RelPath(path), module.Source))
+			case errors.As(err, &diag) && diag.Location.Line > 0:
+				fmt.Fprint(w, RenderError(diag, p.RelPath(path), module.Source))
+			default:
+				fmt.Fprintf(w, "%s: %v\n", p.RelPath(path), err)
+			}
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,108 @@
+package strata
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTree writes files, keyed by slash-separated paths, under root.
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestProjectsLoadEveryModuleReachableFromTheEntrypoint(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"Strataumfile":   `{"name": "app", "main": "app/start.str"}`,
+		"main.str":       "this is not the entrypoint\n",
+		"app/start.str":  "import a from \"./lib/a.str\"\nimport b from \"./lib/b.str\"\nimport gone from \"./missing.str\"\nimport io from std::io\nio.print(a.twice(b.one))\n",
+		"app/lib/a.str":  "import b from \"./b.str\"\nfunc twice(n: int) => int {\n  return n * b.one * 2\n}\n",
+		"app/lib/b.str":  "let one: int = 1\nlet bad: string = one\n",
+		"app/unused.str": "let never: int = \"loaded\"\n",
+	})
+
+	project, err := LoadProject(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if project.Root != root || project.Entry != filepath.Join(root, "app", "start.str") {
+		t.Errorf("resolved %s in %s", project.Entry, project.Root)
+	}
+	var order []string
+	for _, path := range project.Order {
+		order = append(order, filepath.ToSlash(project.RelPath(path)))
+	}
+	if want := []string{"app/start.str", "app/lib/a.str", "app/lib/b.str"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("loaded %v, want %v", order, want)
+	}
+	var out strings.Builder
+	if count := project.ReportDiagnostics(&out); count != 2 {
+		t.Errorf("reported %d errors, want 2:\n%s", count, out.String())
+	}
+	missing, mismatch := strings.Index(out.String(), "--> app/start.str:3:1"), strings.Index(out.String(), "--> app/lib/b.str:2:19")
+	if !strings.Contains(out.String(), "cannot import ./missing.str") || missing < 0 || mismatch < missing {
+		t.Errorf("diagnostics are not reported per file in import order:\n%s", out.String())
+	}
+
+	// A file names its own entrypoint and still finds the project root.
+	project, err = LoadProject(filepath.Join(root, "app", "lib", "a.str"))
+	if err != nil || project.Root != root || len(project.Order) != 2 {
+		t.Errorf("loading a.str gave %v, %v", project, err)
+	}
+	if _, err := LoadProject(filepath.Join(root, "app")); err == nil || !strings.Contains(err.Error(), "looked for src/main.str, main.str") {
+		t.Errorf("a directory without an entrypoint gave %v", err)
+	}
+}
+
+func TestConcurrentLoadsReportInImportOrder(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{}
+	var want strings.Builder
+	for idx := 0; idx < 24; idx++ {
+		name := fmt.Sprintf("m%02d.str", idx)
+		// Each module imports the next two, so most are discovered by
+		// several importers at once.
+		var imports string
+		for next := idx + 1; next <= idx+2 && next < 24; next++ {
+			imports += fmt.Sprintf("import m%02d from \"./m%02d.str\"\n", next, next)
+		}
+		files[name] = imports + fmt.Sprintf("let v: string = %d\n", idx)
+		want.WriteString(name + " ")
+	}
+	files["main.str"] = "import m00 from \"./m00.str\"\n"
+	writeTree(t, root, files)
+
+	for run := 0; run < 5; run++ {
+		project, err := LoadProject(filepath.Join(root, "main.str"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out strings.Builder
+		if count := project.ReportDiagnostics(&out); count != 24 {
+			t.Fatalf("reported %d errors, want 24", count)
+		}
+		var got strings.Builder
+		for _, line := range strings.Split(out.String(), "\n") {
+			if _, location, ok := strings.Cut(line, "--> "); ok {
+				name, _, _ := strings.Cut(location, ":")
+				got.WriteString(name + " ")
+			}
+		}
+		if got.String() != want.String() {
+			t.Fatalf("run %d reported errors for %s, want %s", run, got.String(), want.String())
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package strata
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ============================================================================
+// QUOTAS - Memory and output limits for running untrusted scripts
+// ============================================================================
+
+// A memory quota bounds the bytes a run allocates for strings, lists, maps,
+// tuples and objects over its whole life, freed or not, so a script cannot
+// exhaust the host by building ever larger values. Sizes are estimates: a
+// string counts its bytes, a list or tuple 16 bytes per item and a map or
+// object 48 bytes per entry, not counting what the items themselves refer
+// to, which was counted when they were made. An output quota bounds the
+// bytes a run writes to stdout, stderr and files. A run and its workers
+// share both quotas.
+
+// QuotaError reports that a run exceeded its memory or output quota. Like a
+// LimitError it cannot be caught by Strata code.
+type QuotaError struct {
+	// Resource is "memory" or "output".
+	Resource string
+	Limit    int64
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s quota of %d bytes exceeded", e.Resource, e.Limit)
+}
+
+// usage counts what a run has used against its quotas. Its methods accept a
+// nil usage, which has no quotas.
+type usage struct {
+	maxMemory, maxOutput int64
+	memory, output       int64
+	mu                   sync.Mutex
+	exceeded             error
+}
+
+// SetQuotas limits the bytes the run may allocate and write; zero leaves a
+// resource unlimited. It wraps the current Stdout and Stderr, so set them
+// first.
+func (i *Interpreter) SetQuotas(memory, output int64) {
+	i.usage = &usage{maxMemory: memory, maxOutput: output}
+	if output > 0 {
+		i.Stdout = quotaWriter{i.usage, i.Stdout}
+		i.Stderr = quotaWriter{i.usage, i.Stderr}
+	}
+}
+
+// allocate counts n bytes of memory.
+func (u *usage) allocate(n int64) error {
+	if u == nil || u.maxMemory <= 0 {
+		return nil
+	}
+	if atomic.AddInt64(&u.memory, n) > u.maxMemory {
+		return u.exceed(&QuotaError{Resource: "memory", Limit: u.maxMemory})
+	}
+	return nil
+}
+
+// reserve checks, before the host allocates it, that a value of the product
+// of sizes bytes fits in what is left of the memory quota, so a builtin
+// asked for a huge string or list fails without building it. It counts
+// nothing: the value is charged once it is made.
+func (u *usage) reserve(sizes ...int64) error {
+	if u == nil || u.maxMemory <= 0 {
+		return nil
+	}
+	left := u.maxMemory - atomic.LoadInt64(&u.memory)
+	need := int64(1)
+	for _, n := range sizes {
+		if n <= 0 {
+			return nil
+		}
+		if need > left/n {
+			return u.exceed(&QuotaError{Resource: "memory", Limit: u.maxMemory})
+		}
+		need *= n
+	}
+	return nil
+}
+
+// write counts n bytes of output.
+func (u *usage) write(n int64) error {
+	if u == nil || u.maxOutput <= 0 {
+		return nil
+	}
+	if atomic.AddInt64(&u.output, n) > u.maxOutput {
+		return u.exceed(&QuotaError{Resource: "output", Limit: u.maxOutput})
+	}
+	return nil
+}
+
+// exceed records the first quota exceeded, which failed reports from then
+// on even where the function that hit it could not return an error.
+func (u *usage) exceed(err error) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.exceeded == nil {
+		u.exceeded = err
+	}
+	return u.exceeded
+}
+
+func (u *usage) failed() error {
+	if u == nil {
+		return nil
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.exceeded
+}
+
+// charged counts a newly made value against the memory quota and reports
+// any quota exceeded while making it.
+func (i *Interpreter) charged(result interface{}, err error) (interface{}, error) {
+	if i.usage != nil && err == nil {
+		return i.usage.charge(result)
+	}
+	return result, err
+}
+
+func (u *usage) charge(value interface{}) (interface{}, error) {
+	u.allocate(valueSize(value))
+	if err := u.failed(); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// replacedSize is the length of s with every old replaced by new.
+func replacedSize(s, old, new string) int64 {
+	grow := int64(len(new) - len(old))
+	if grow <= 0 {
+		return int64(len(s))
+	}
+	return int64(len(s)) + int64(strings.Count(s, old))*grow
+}
+
+// valueSize estimates the bytes value itself occupies.
+func valueSize(value interface{}) int64 {
+	switch v := value.(type) {
+	case string:
+		return int64(len(v))
+	case Bytes:
+		return int64(len(v))
+	case []interface{}:
+		return 16 * int64(len(v))
+	case Tuple:
+		return 16 * int64(len(v))
+	case []string:
+		return 16 * int64(len(v))
+	case map[string]interface{}:
+		return 48 * int64(len(v))
+	case *Instance:
+		return 48 * int64(len(v.Fields))
+	case *Matrix:
+		return 8 * int64(len(v.Data))
+	}
+	return 0
+}
+
+// quotaWriter counts what is written through it against the output quota,
+// refusing writes that would exceed it.
+type quotaWriter struct {
+	usage *usage
+	w     io.Writer
+}
+
+func (q quotaWriter) Write(p []byte) (int, error) {
+	if err := q.usage.write(int64(len(p))); err != nil {
+		return 0, err
+	}
+	return q.w.Write(p)
+}
+
+// parseQuota parses a byte count such as 65536, 64k, 16m or 1g.
+func parseQuota(value string) (int64, bool) {
+	scales := map[string]int64{"k": 1 << 10, "m": 1 << 20, "g": 1 << 30}
+	scale := int64(1)
+	for suffix, s := range scales {
+		if strings.HasSuffix(strings.ToLower(value), suffix) {
+			scale, value = s, value[:len(value)-1]
+			break
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 1 {
+		return 0, false
+	}
+	return n * scale, true
+}
@@ -0,0 +1,99 @@
+package strata
+
+import (
+	crand "crypto/rand"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// ============================================================================
+// STD::RANDOM - Seedable random numbers, choices, shuffles and UUIDs
+// ============================================================================
+
+// Every function draws from the interpreter's generator, so seed(n) or
+// --deterministic --seed=n makes a run reproducible. uuid() reads
+// crypto/rand unless the run is deterministic.
+
+func randomModule(i *Interpreter) map[string]interface{} {
+	return map[string]interface{}{
+		"seed": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("seed", args, 1); err != nil {
+				return nil, err
+			}
+			n, ok := args[0].(int64)
+			if !ok {
+				return nil, newError(ErrTypeMismatch, "seed expects an int, got %s", describeValue(args[0]))
+			}
+			i.Rand = rand.New(rand.NewSource(n))
+			return nil, nil
+		}),
+		"int": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("int", args, 2); err != nil {
+				return nil, err
+			}
+			lo, okLo := args[0].(int64)
+			hi, okHi := args[1].(int64)
+			if !okLo || !okHi {
+				return nil, newError(ErrTypeMismatch, "int expects int bounds, got %s and %s", describeValue(args[0]), describeValue(args[1]))
+			}
+			if lo > hi {
+				return nil, newError(ErrInvalidOperation, "int: min %d is greater than max %d", lo, hi)
+			}
+			span := uint64(hi) - uint64(lo)
+			if span < math.MaxInt64 {
+				return lo + i.Rand.Int63n(int64(span)+1), nil
+			}
+			// too wide for Int63n: draw until the value falls in range
+			for {
+				if n := i.Rand.Uint64(); n <= span {
+					return int64(uint64(lo) + n), nil
+				}
+			}
+		}),
+		"float": NativeFunc(func(args []interface{}) (interface{}, error) {
+			return i.Rand.Float64(), nil
+		}),
+		"choice": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("choice", args, 1); err != nil {
+				return nil, err
+			}
+			items, ok := listItems(args[0])
+			if !ok {
+				return nil, newError(ErrTypeMismatch, "choice expects a list, got %s", describeValue(args[0]))
+			}
+			if len(items) == 0 {
+				return nil, newError(ErrIndex, "choice from an empty list")
+			}
+			return items[i.Rand.Intn(len(items))], nil
+		}),
+		"shuffle": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("shuffle", args, 1); err != nil {
+				return nil, err
+			}
+			items, ok := listItems(args[0])
+			if !ok {
+				return nil, newError(ErrTypeMismatch, "shuffle expects a list, got %s", describeValue(args[0]))
+			}
+			shuffled := append([]interface{}{}, items...)
+			i.Rand.Shuffle(len(shuffled), func(a, b int) { shuffled[a], shuffled[b] = shuffled[b], shuffled[a] })
+			return shuffled, nil
+		}),
+		"uuid": NativeFunc(func(args []interface{}) (interface{}, error) {
+			return i.uuid()
+		}),
+	}
+}
+
+// uuid returns a random (version 4) UUID.
+func (i *Interpreter) uuid() (string, error) {
+	var b [16]byte
+	if i.Deterministic {
+		i.Rand.Read(b[:])
+	} else if _, err := crand.Read(b[:]); err != nil {
+		return "", newError(ErrInvalidOperation, "uuid failed: %v", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
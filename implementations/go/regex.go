@@ -0,0 +1,119 @@
+package strata
+
+import (
+	"regexp"
+	"unicode/utf8"
+)
+
+// ============================================================================
+// STD::REGEX - Matching, capture groups, replacement and compiled patterns
+// ============================================================================
+
+// Every function takes its pattern either as a string or as a Pattern made by
+// compile. String patterns are compiled once and cached, and an invalid one
+// raises an error. Replacements refer to groups as $1, $2 and so on.
+
+// Pattern is a compiled regular expression.
+type Pattern struct {
+	re *regexp.Regexp
+}
+
+func (p *Pattern) String() string {
+	return "<pattern " + p.re.String() + ">"
+}
+
+// maxCachedPatterns bounds the cache of compiled string patterns; it is
+// emptied when full.
+const maxCachedPatterns = 64
+
+func regexModule() map[string]interface{} {
+	cache := make(map[string]*regexp.Regexp)
+	compile := func(name string, v interface{}) (*regexp.Regexp, error) {
+		if p, ok := v.(*Pattern); ok {
+			return p.re, nil
+		}
+		source, ok := v.(string)
+		if !ok {
+			return nil, newError(ErrTypeMismatch, "%s expects a pattern, got %s", name, describeValue(v))
+		}
+		if re, ok := cache[source]; ok {
+			return re, nil
+		}
+		re, err := regexp.Compile(source)
+		if err != nil {
+			return nil, newError(ErrInvalidOperation, "%s: invalid pattern: %v", name, err)
+		}
+		if len(cache) >= maxCachedPatterns {
+			cache = make(map[string]*regexp.Regexp)
+		}
+		cache[source] = re
+		return re, nil
+	}
+	// matcher wraps a function of a string and a compiled pattern.
+	matcher := func(name string, n int, fn func(str string, re *regexp.Regexp, args []interface{}) interface{}) NativeFunc {
+		return func(args []interface{}) (interface{}, error) {
+			if err := wantArgs(name, args, n); err != nil {
+				return nil, err
+			}
+			re, err := compile(name, args[1])
+			if err != nil {
+				return nil, err
+			}
+			return fn(toString(args[0]), re, args), nil
+		}
+	}
+	return map[string]interface{}{
+		"compile": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("compile", args, 1); err != nil {
+				return nil, err
+			}
+			re, err := compile("compile", args[0])
+			if err != nil {
+				return nil, err
+			}
+			return &Pattern{re: re}, nil
+		}),
+		"match": matcher("match", 2, func(str string, re *regexp.Regexp, args []interface{}) interface{} {
+			return re.FindString(str)
+		}),
+		"test": matcher("test", 2, func(str string, re *regexp.Regexp, args []interface{}) interface{} {
+			return re.MatchString(str)
+		}),
+		"search": matcher("search", 2, func(str string, re *regexp.Regexp, args []interface{}) interface{} {
+			loc := re.FindStringIndex(str)
+			if loc == nil {
+				return int64(-1)
+			}
+			return int64(utf8.RuneCountInString(str[:loc[0]]))
+		}),
+		"replace": matcher("replace", 3, func(str string, re *regexp.Regexp, args []interface{}) interface{} {
+			return re.ReplaceAllString(str, toString(args[2]))
+		}),
+		"groups": matcher("groups", 2, func(str string, re *regexp.Regexp, args []interface{}) interface{} {
+			match := re.FindStringSubmatchIndex(str)
+			if match == nil {
+				return nil
+			}
+			return captures(str, match)[1:]
+		}),
+		"matchAll": matcher("matchAll", 2, func(str string, re *regexp.Regexp, args []interface{}) interface{} {
+			matches := []interface{}{}
+			for _, match := range re.FindAllStringSubmatchIndex(str, -1) {
+				matches = append(matches, captures(str, match))
+			}
+			return matches
+		}),
+	}
+}
+
+// captures lists the text of a match followed by each of its groups, with
+// null for groups that did not participate.
+func captures(str string, match []int) []interface{} {
+	groups := make([]interface{}, len(match)/2)
+	for idx := range groups {
+		if start := match[2*idx]; start >= 0 {
+			groups[idx] = str[start:match[2*idx+1]]
+		}
+	}
+	return groups
+}
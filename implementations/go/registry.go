@@ -0,0 +1,393 @@
+package strata
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// REGISTRY - Fetching packages from a package registry over HTTPS
+// ============================================================================
+
+// A registry serves, for each package, its metadata as JSON at
+// /packages/<name>:
+//
+//	{"name": "colors", "description": "...", "license": "MIT",
+//	 "latest": "1.2.0",
+//	 "versions": {"1.2.0": {"tarball": "/tarballs/colors-1.2.0.tgz",
+//	                        "dependencies": {"ansi": "^2.0.0"},
+//	                        "bin": {"colorize": "bin/colorize.str"}}}}
+//
+// and each version as a gzipped tarball, whose files may sit under a
+// package/ directory as npm lays them out. A tarball URL may be relative to
+// the registry. Registries are reached over HTTPS; plain HTTP is allowed
+// only on the loopback interface, for a registry run locally.
+//
+// A registry may also answer searches at /search?q=<query>&limit=<n>:
+//
+//	{"results": [{"name": "colors", "version": "1.2.0",
+//	              "description": "..."}]}
+
+// DefaultRegistry is the registry a project without one configured uses.
+const DefaultRegistry = "https://registry.stratauim.io"
+
+// maxPackageSize bounds the size of a downloaded tarball.
+const maxPackageSize = 64 << 20
+
+// maxUnpackedSize and maxEntrySize bound what a tarball unpacks to, in all
+// and per file, so a small compressed download cannot fill the disk.
+const (
+	maxUnpackedSize = 256 << 20
+	maxEntrySize    = 64 << 20
+)
+
+// PackageMetadata is what a registry says about a package.
+type PackageMetadata struct {
+	Name        string                    `json:"name"`
+	Description string                    `json:"description,omitempty"`
+	License     string                    `json:"license,omitempty"`
+	Latest      string                    `json:"latest,omitempty"`
+	Versions    map[string]PackageVersion `json:"versions"`
+}
+
+// PackageVersion is one published version of a package.
+type PackageVersion struct {
+	Tarball      string            `json:"tarball"`
+	Main         string            `json:"main,omitempty"`
+	Bin          map[string]string `json:"bin,omitempty"`
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+}
+
+// RegistryClient fetches packages from one registry. A Token, when set, is
+// sent as a bearer token to the registry's host and nowhere else, so that
+// tarballs served from elsewhere never see it.
+type RegistryClient struct {
+	URL   string
+	Token string
+	HTTP  *http.Client
+}
+
+func NewRegistryClient(registry string) *RegistryClient {
+	if registry == "" {
+		registry = DefaultRegistry
+	}
+	return &RegistryClient{
+		URL:  strings.TrimSuffix(registry, "/"),
+		HTTP: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// errPackageNotFound is what a registry's 404 becomes.
+var errPackageNotFound = errors.New("not found")
+
+// get fetches a URL of the registry, at most limit bytes of it.
+func (c *RegistryClient) get(rawURL string, limit int64) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid registry URL %s: %v", rawURL, err)
+	}
+	if u.Scheme != "https" && !(u.Scheme == "http" && isLoopback(u.Hostname())) {
+		return nil, fmt.Errorf("registry %s must use https", c.URL)
+	}
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if registry, err := url.Parse(c.URL); err == nil && c.Token != "" && registry.Host == u.Host {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot reach registry %s: %v", c.URL, err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, errPackageNotFound
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		if c.Token != "" {
+			return nil, fmt.Errorf("registry %s refused the token for %s; run strataum login %s again", c.URL, u.Path, c.URL)
+		}
+		return nil, fmt.Errorf("registry %s requires a login for %s; run strataum login %s", c.URL, u.Path, c.URL)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("registry %s answered %s for %s", c.URL, resp.Status, u.Path)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s from registry %s: %v", u.Path, c.URL, err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s from registry %s is larger than %d bytes", u.Path, c.URL, limit)
+	}
+	return data, nil
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Metadata fetches what the registry knows about a package.
+func (c *RegistryClient) Metadata(name string) (*PackageMetadata, error) {
+	if !validPackageName(name) {
+		return nil, fmt.Errorf("invalid package name %q", name)
+	}
+	data, err := c.get(c.URL+"/packages/"+url.PathEscape(name), 8<<20)
+	if err == errPackageNotFound {
+		return nil, fmt.Errorf("package %s not found in registry %s", name, c.URL)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var meta PackageMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("registry %s sent invalid metadata for %s: %v", c.URL, name, err)
+	}
+	return &meta, nil
+}
+
+// validPackageName accepts names such as colors, http-client and
+// @acme/logging.
+func validPackageName(name string) bool {
+	scope, base, scoped := strings.Cut(name, "/")
+	if scoped {
+		if !strings.HasPrefix(scope, "@") || !validNamePart(scope[1:]) {
+			return false
+		}
+		name = base
+	}
+	return validNamePart(name)
+}
+
+func validNamePart(part string) bool {
+	if part == "" || part[0] == '.' {
+		return false
+	}
+	for _, r := range part {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// Resolve picks the version of a package a requirement asks for: an exact
+// version, "latest" (or "" or "*"), or ^x.y.z or ~x.y.z for the newest with
+// the same major, or major and minor, version.
+func (meta *PackageMetadata) Resolve(requirement string) (string, error) {
+	switch requirement {
+	case "", "latest", "*":
+		if meta.Latest != "" {
+			if _, ok := meta.Versions[meta.Latest]; ok {
+				return meta.Latest, nil
+			}
+		}
+		if newest := meta.newest(func(string) bool { return true }); newest != "" {
+			return newest, nil
+		}
+		return "", fmt.Errorf("package %s has no published versions", meta.Name)
+	}
+	if _, ok := meta.Versions[requirement]; ok {
+		return requirement, nil
+	}
+	if op := requirement[0]; op == '^' || op == '~' {
+		want := parseVersion(requirement[1:])
+		if newest := meta.newest(func(v string) bool {
+			have := parseVersion(v)
+			if have[0] != want[0] || op == '~' && have[1] != want[1] {
+				return false
+			}
+			return compareVersions(v, requirement[1:]) >= 0
+		}); newest != "" {
+			return newest, nil
+		}
+	}
+	return "", fmt.Errorf("package %s has no version matching %s (latest is %s)", meta.Name, requirement, meta.Latest)
+}
+
+// newest is the highest version for which keep is true, or "".
+func (meta *PackageMetadata) newest(keep func(string) bool) string {
+	var versions []string
+	for v := range meta.Versions {
+		if keep(v) {
+			versions = append(versions, v)
+		}
+	}
+	if len(versions) == 0 {
+		return ""
+	}
+	sort.Slice(versions, func(a, b int) bool { return compareVersions(versions[a], versions[b]) < 0 })
+	return versions[len(versions)-1]
+}
+
+// parseVersion reads the major, minor and patch numbers of a version,
+// ignoring a pre-release or build suffix.
+func parseVersion(v string) [3]int {
+	var parts [3]int
+	v, _, _ = strings.Cut(v, "-")
+	v, _, _ = strings.Cut(v, "+")
+	for idx, field := range strings.SplitN(v, ".", 3) {
+		parts[idx], _ = strconv.Atoi(field)
+	}
+	return parts
+}
+
+func compareVersions(a, b string) int {
+	pa, pb := parseVersion(a), parseVersion(b)
+	for idx := range pa {
+		switch {
+		case pa[idx] < pb[idx]:
+			return -1
+		case pa[idx] > pb[idx]:
+			return 1
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+// Download fetches the tarball of a version and unpacks it into dir,
+// replacing what was there only once the whole package is unpacked, and
+// returns the checksum of the package. Given the checksum expected, it
+// refuses a package that does not match.
+func (c *RegistryClient) Download(meta *PackageMetadata, version, dir, expect string) (string, error) {
+	release := meta.Versions[version]
+	if release.Tarball == "" {
+		return "", fmt.Errorf("registry %s lists no tarball for %s@%s", c.URL, meta.Name, version)
+	}
+	base, err := url.Parse(c.URL + "/")
+	if err != nil {
+		return "", fmt.Errorf("invalid registry URL %s: %v", c.URL, err)
+	}
+	ref, err := url.Parse(release.Tarball)
+	if err != nil {
+		return "", fmt.Errorf("registry %s lists an invalid tarball for %s@%s: %v", c.URL, meta.Name, version, err)
+	}
+	data, err := c.get(base.ResolveReference(ref).String(), maxPackageSize)
+	if err == errPackageNotFound {
+		return "", fmt.Errorf("the tarball of %s@%s is missing from registry %s", meta.Name, version, c.URL)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return "", err
+	}
+	staging, err := os.MkdirTemp(filepath.Dir(dir), ".download-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(staging)
+	if err := extractTarball(data, staging); err != nil {
+		return "", fmt.Errorf("unpacking %s@%s: %v", meta.Name, version, err)
+	}
+	manifest := filepath.Join(staging, "package.json")
+	if _, err := os.Stat(manifest); os.IsNotExist(err) {
+		main := release.Main
+		if main == "" {
+			main = "index.str"
+		}
+		fields := map[string]interface{}{"name": meta.Name, "version": version, "main": main}
+		if len(release.Bin) > 0 {
+			fields["bin"] = release.Bin
+		}
+		info, _ := json.MarshalIndent(fields, "", "  ")
+		if err := os.WriteFile(manifest, info, 0644); err != nil {
+			return "", err
+		}
+	}
+	integrity, err := packageChecksum(staging)
+	if err != nil {
+		return "", err
+	}
+	if expect != "" && integrity != expect {
+		return "", fmt.Errorf("%s@%s from registry %s does not match the lock file: expected %s, got %s", meta.Name, version, c.URL, expect, integrity)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return "", err
+	}
+	return integrity, os.Rename(staging, dir)
+}
+
+// extractTarball unpacks a gzipped tarball into dir, dropping a leading
+// package/ directory. Entries that would land outside dir, links and
+// devices are refused, as are files past maxEntrySize or maxUnpackedSize.
+func extractTarball(data []byte, dir string) error {
+	gz, err := gzip.NewReader(strings.NewReader(string(data)))
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	var unpacked int64
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		if name == "package" {
+			continue
+		}
+		name = strings.TrimPrefix(name, "package/")
+		if name == "." {
+			continue
+		}
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("entry %s is outside the package", header.Name)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			unpacked += header.Size
+			if header.Size > maxEntrySize {
+				return fmt.Errorf("entry %s is larger than %d bytes", header.Name, maxEntrySize)
+			}
+			if unpacked > maxUnpackedSize {
+				return fmt.Errorf("package unpacks to more than %d bytes", maxUnpackedSize)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			mode := os.FileMode(0644)
+			if header.Mode&0111 != 0 {
+				mode = 0755
+			}
+			file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+			if err != nil {
+				return err
+			}
+			_, err = io.CopyN(file, tr, header.Size)
+			file.Close()
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("entry %s is not a file or directory", header.Name)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package strata
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func tarball(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestInstallFetchesPackagesFromRegistry(t *testing.T) {
+	colors := tarball(t, map[string]string{
+		"package/index.str":     "func red() => string {\n  return \"red\"\n}\n",
+		"package/package.json":  `{"name": "colors", "version": "1.2.0", "main": "index.str"}`,
+		"package/lib/extra.str": "let x: int = 1\n",
+	})
+	ansi := tarball(t, map[string]string{"index.str": "let code: int = 27\n"})
+	evil := tarball(t, map[string]string{"../escape.str": "oops"})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/packages/colors", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name": "colors", "latest": "1.2.0", "versions": {
+			"1.0.0": {"tarball": "/tarballs/colors-1.0.0.tgz"},
+			"1.2.0": {"tarball": "/tarballs/colors-1.2.0.tgz", "dependencies": {"ansi": "^2.0.0"}}}}`))
+	})
+	mux.HandleFunc("/packages/ansi", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name": "ansi", "versions": {
+			"2.0.0": {"tarball": "tarballs/ansi-2.0.0.tgz"},
+			"2.3.1": {"tarball": "tarballs/ansi-2.3.1.tgz"},
+			"3.0.0": {"tarball": "tarballs/ansi-3.0.0.tgz"}}}`))
+	})
+	mux.HandleFunc("/packages/evil", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name": "evil", "latest": "1.0.0", "versions": {"1.0.0": {"tarball": "/tarballs/evil.tgz"}}}`))
+	})
+	mux.HandleFunc("/tarballs/colors-1.2.0.tgz", func(w http.ResponseWriter, r *http.Request) { w.Write(colors) })
+	mux.HandleFunc("/tarballs/ansi-2.3.1.tgz", func(w http.ResponseWriter, r *http.Request) { w.Write(ansi) })
+	mux.HandleFunc("/tarballs/evil.tgz", func(w http.ResponseWriter, r *http.Request) { w.Write(evil) })
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	t.Setenv("HOME", t.TempDir())
+	root := t.TempDir()
+	pm := NewPackageManager(root)
+	pm.Strataumfile.Registry = server.URL
+	if err := pm.Add("colors", "latest"); err != nil {
+		t.Fatal(err)
+	}
+	packages := filepath.Join(root, ".strata", "packages")
+	for _, file := range []string{"colors/index.str", "colors/package.json", "colors/lib/extra.str", "ansi/index.str", "ansi/package.json"} {
+		if _, err := os.Stat(filepath.Join(packages, file)); err != nil {
+			t.Errorf("missing %s: %v", file, err)
+		}
+	}
+	if lock := pm.LockFile.Packages["colors"]; lock == nil || lock.Version != "1.2.0" {
+		t.Errorf("colors locked as %+v, want 1.2.0", lock)
+	}
+	if lock := pm.LockFile.Packages["ansi"]; lock == nil || lock.Version != "2.3.1" {
+		t.Errorf("ansi locked as %+v, want 2.3.1", lock)
+	}
+	if pm.Strataumfile.Dependencies["colors"] != "latest" {
+		t.Errorf("dependencies = %v", pm.Strataumfile.Dependencies)
+	}
+
+	for _, tc := range []struct{ name, version, want string }{
+		{"missing", "", "package missing not found in registry " + server.URL},
+		{"colors", "9.0.0", "package colors has no version matching 9.0.0"},
+		{"colors", "1.0.0", "the tarball of colors@1.0.0 is missing"},
+		{"evil", "", "entry ../escape.str is outside the package"},
+	} {
+		err := pm.installPackage(tc.name, packages, tc.version, make(map[string]bool))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("installing %s@%s: got %v, want %q", tc.name, tc.version, err, tc.want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(packages, "colors", "index.str")); err != nil {
+		t.Errorf("a failed install removed the installed version: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, ".strata", "escape.str")); err == nil {
+		t.Error("a tarball wrote outside its package")
+	}
+
+	unreachable := NewRegistryClient("http://127.0.0.1:1")
+	if _, err := unreachable.Metadata("colors"); err == nil || !strings.Contains(err.Error(), "cannot reach registry") {
+		t.Errorf("unreachable registry: got %v", err)
+	}
+	if _, err := NewRegistryClient("http://example.com").Metadata("colors"); err == nil || !strings.Contains(err.Error(), "must use https") {
+		t.Errorf("plain http registry: got %v", err)
+	}
+}
+
+func TestExtractTarballCapsUnpackedSize(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "package/huge.bin", Mode: 0644, Size: maxEntrySize + 1, Typeflag: tar.TypeReg})
+	tw.Write(make([]byte, 1<<20))
+	tw.Flush()
+	gz.Close()
+	dir := t.TempDir()
+	err := extractTarball(buf.Bytes(), dir)
+	if err == nil || !strings.Contains(err.Error(), "entry package/huge.bin is larger than") {
+		t.Errorf("got %v, want the oversized entry refused", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "huge.bin")); err == nil {
+		t.Error("the oversized entry was written")
+	}
+}
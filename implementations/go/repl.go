@@ -0,0 +1,266 @@
+package strata
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ============================================================================
+// REPL - Interactive session with meta-commands
+// ============================================================================
+
+const replHelp = `Commands:
+  :load <file>   run a .str file inside the session
+  :type <expr>   show the inferred type of an expression
+  :symbols       list variables, functions and modules defined so far
+  :save <file>   write the session transcript to a .str file
+  :help          show this help
+  :quit          leave the REPL`
+
+type REPL struct {
+	interp     *Interpreter
+	checker    *TypeChecker
+	transcript []string
+	out        io.Writer
+}
+
+func NewREPL(out io.Writer) *REPL {
+	interp := NewInterpreter()
+	interp.Stdout = out
+	return &REPL{interp: interp, checker: NewTypeChecker(), out: out}
+}
+
+func (r *REPL) Run(in io.Reader) {
+	fmt.Fprintf(r.out, "Strata %s REPL. Type :help for commands.\n", Version)
+	scanner := bufio.NewScanner(in)
+	var pending strings.Builder
+	for {
+		if pending.Len() == 0 {
+			fmt.Fprint(r.out, ">>> ")
+		} else {
+			fmt.Fprint(r.out, "... ")
+		}
+		if !scanner.Scan() {
+			fmt.Fprintln(r.out)
+			return
+		}
+		line := scanner.Text()
+		if pending.Len() == 0 && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			if !r.command(strings.TrimSpace(line)) {
+				return
+			}
+			continue
+		}
+		pending.WriteString(line)
+		pending.WriteString("\n")
+		if braceDepth(pending.String()) > 0 {
+			continue
+		}
+		source := pending.String()
+		pending.Reset()
+		if strings.TrimSpace(source) == "" {
+			continue
+		}
+		if r.eval(source, true) {
+			r.transcript = append(r.transcript, strings.TrimRight(source, "\n"))
+		}
+	}
+}
+
+// braceDepth reports how many blocks are still open, ignoring braces inside
+// string literals and comments, so multi-line definitions can be typed
+// naturally. An open block comment counts as an open block.
+func braceDepth(source string) int {
+	depth, comments := 0, 0
+	inString := false
+	for idx := 0; idx < len(source); idx++ {
+		c := source[idx]
+		next := byte(0)
+		if idx+1 < len(source) {
+			next = source[idx+1]
+		}
+		switch {
+		case comments > 0 && c == '/' && next == '*':
+			comments++
+			idx++
+		case comments > 0 && c == '*' && next == '/':
+			comments--
+			idx++
+		case comments > 0:
+		case c == '\\' && inString:
+			idx++
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '/' && next == '/':
+			for idx < len(source) && source[idx] != '\n' {
+				idx++
+			}
+		case c == '/' && next == '*':
+			comments++
+			idx++
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+		}
+	}
+	return depth + comments
+}
+
+// eval runs source in the session and reports whether it succeeded.
+func (r *REPL) eval(source string, echo bool) bool {
+	statements, err := ParseSource(source)
+	if err != nil {
+		fmt.Fprintf(r.out, "Error: %v\n", err)
+		return false
+	}
+	if err := r.checker.Check(statements); err != nil {
+		fmt.Fprintf(r.out, "Error: %v\n", err)
+		return false
+	}
+	for _, stmt := range statements {
+		if echo && stmt.Kind == StmtExpression {
+			value, err := r.interp.evaluateExpression(stmt.Expr)
+			if err != nil {
+				r.recover(err)
+				return false
+			}
+			if value != nil {
+				fmt.Fprintln(r.out, formatValue(value))
+			}
+			continue
+		}
+		err := r.interp.interpretStatement(stmt)
+		if err == nil {
+			err = r.interp.pendingThrow()
+		}
+		if err != nil {
+			r.recover(err)
+			return false
+		}
+		r.interp.ControlFlow = ControlFlow{Type: CFNone}
+	}
+	return true
+}
+
+func (r *REPL) recover(err error) {
+	fmt.Fprintf(r.out, "Error: %v\n", err)
+	r.interp.CallStack = nil
+	r.interp.ControlFlow = ControlFlow{Type: CFNone}
+	for r.interp.Env.Parent != nil {
+		r.interp.Env = r.interp.Env.Parent
+	}
+}
+
+// command executes a meta-command and returns false when the session ends.
+func (r *REPL) command(line string) bool {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	switch name {
+	case ":quit", ":q", ":exit":
+		return false
+	case ":help", ":h":
+		fmt.Fprintln(r.out, replHelp)
+	case ":load", ":l":
+		r.load(arg)
+	case ":type", ":t":
+		r.showType(arg)
+	case ":symbols", ":s":
+		r.listSymbols()
+	case ":save":
+		r.save(arg)
+	default:
+		fmt.Fprintf(r.out, "Unknown command %s (try :help)\n", name)
+	}
+	return true
+}
+
+func (r *REPL) load(path string) {
+	if path == "" {
+		fmt.Fprintln(r.out, "Usage: :load <file>")
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(r.out, "Error: %v\n", err)
+		return
+	}
+	source := string(data)
+	if r.eval(source, false) {
+		r.transcript = append(r.transcript, "// :load "+path, strings.TrimRight(source, "\n"))
+		fmt.Fprintf(r.out, "Loaded %s\n", path)
+	}
+}
+
+func (r *REPL) showType(source string) {
+	if source == "" {
+		fmt.Fprintln(r.out, "Usage: :type <expr>")
+		return
+	}
+	parser := NewParser(source)
+	expr, err := parser.parseBinary(0)
+	if err == nil && parser.current() != nil {
+		err = parser.errorf(ErrSyntax, "unexpected token: %s", parser.current().Value)
+	}
+	if err != nil {
+		fmt.Fprintf(r.out, "Error: %v\n", err)
+		return
+	}
+	fmt.Fprintf(r.out, "%s : %s\n", source, r.checker.inferType(expr))
+}
+
+func (r *REPL) listSymbols() {
+	var lines []string
+	for name, entry := range r.interp.Env.Vars {
+		checked, declared := r.checker.Env.Vars[name]
+		if _, isMap := entry.Value.(map[string]interface{}); isMap && !declared {
+			lines = append(lines, fmt.Sprintf("module %s", name))
+			continue
+		}
+		keyword := "let"
+		if entry.Mutable {
+			keyword = "var"
+		}
+		typ := TypeDef{Kind: KindPrimitive, Primitive: TypeAny}
+		if declared {
+			typ = checked.Type
+		}
+		lines = append(lines, fmt.Sprintf("%s %s: %s = %s", keyword, name, typ, formatValue(entry.Value)))
+	}
+	for name, fn := range r.checker.Env.Functions {
+		var params []string
+		for _, p := range fn.Params {
+			params = append(params, p.String())
+		}
+		lines = append(lines, fmt.Sprintf("func %s(%s) => %s", name, strings.Join(params, ", "), fn.ReturnType))
+	}
+	if len(lines) == 0 {
+		fmt.Fprintln(r.out, "No symbols defined")
+		return
+	}
+	sort.Strings(lines)
+	for _, line := range lines {
+		fmt.Fprintln(r.out, line)
+	}
+}
+
+func (r *REPL) save(path string) {
+	if path == "" {
+		fmt.Fprintln(r.out, "Usage: :save <file>")
+		return
+	}
+	if !strings.HasSuffix(path, ".str") {
+		path += ".str"
+	}
+	content := strings.Join(r.transcript, "\n") + "\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		fmt.Fprintf(r.out, "Error: %v\n", err)
+		return
+	}
+	fmt.Fprintf(r.out, "Saved %d entries to %s\n", len(r.transcript), path)
+}
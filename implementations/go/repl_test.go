@@ -0,0 +1,63 @@
+package strata
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestREPLSessionCommands(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib.str")
+	os.WriteFile(lib, []byte("let n: int = 41\n"), 0644)
+	saved := filepath.Join(dir, "session")
+	session := strings.Join([]string{
+		":load " + lib,
+		"func inc(x: int) => int {",
+		"  // } inside a comment, \"{\" inside a string",
+		"  return x + 1",
+		"}",
+		"inc(n)",
+		":type inc(n) > 1",
+		"missing + 1",
+		":symbols",
+		":save " + saved,
+		":bogus",
+		":quit",
+		"inc(0)",
+	}, "\n")
+
+	var out strings.Builder
+	NewREPL(&out).Run(strings.NewReader(session))
+	for _, want := range []string{
+		"Loaded " + lib,
+		"... ... ... >>> 42\n",
+		"inc(n) > 1 : bool\n",
+		"Error: undefined variable: missing",
+		"func inc(int) => int\nlet n: int = 41\n",
+		"Saved 4 entries to " + saved + ".str",
+		"Unknown command :bogus",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output lacks %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), ">>> 1\n") {
+		t.Error("input after :quit was evaluated")
+	}
+
+	data, err := os.ReadFile(saved + ".str")
+	if err != nil {
+		t.Fatal(err)
+	}
+	transcript := string(data)
+	if !strings.HasPrefix(transcript, "// :load "+lib+"\nlet n: int = 41\nfunc inc") || strings.Contains(transcript, "missing") {
+		t.Errorf("saved transcript:\n%s", transcript)
+	}
+	// The transcript replays to the same result outside the REPL.
+	out.Reset()
+	if err := RunSource("import io from std::io\n"+transcript+"io.print(inc(n))\n", RunOptions{Stdout: &out}); err != nil || out.String() != "42\n" {
+		t.Errorf("replaying the transcript printed %q, %v", out.String(), err)
+	}
+}
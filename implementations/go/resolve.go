@@ -0,0 +1,202 @@
+package strata
+
+// ============================================================================
+// RESOLVER - Slots for function-scope variables, assigned after parsing
+// ============================================================================
+
+// A function call gets a fresh scope, and its parameters and locals are by
+// far the most used variables, so the resolver gives each of them a slot in
+// a per-call array and records on every identifier that names one how many
+// scopes out and at which slot it lives. Reading such a variable is then an
+// index instead of a map lookup per scope up the chain.
+//
+// Scopes stay as dynamic as before: a variable declared in a branch that
+// did not run leaves its slot empty, and the lookup falls back to the
+// enclosing scopes by name. Catch blocks and match arms get scopes of their
+// own, which keep their variables by name; an identifier one of them might
+// bind is left unresolved. Top-level and module scopes keep theirs by name
+// too, since the REPL, imports and the debugger reach into them.
+
+// scopeLayout assigns slots to the variables a function scope declares.
+type scopeLayout struct {
+	names []string
+	index map[string]int
+}
+
+func (l *scopeLayout) declare(name string) {
+	if _, ok := l.index[name]; !ok {
+		l.index[name] = len(l.names)
+		l.names = append(l.names, name)
+	}
+}
+
+// varAddress locates a variable as scopes out from the current one and a
+// 1-based slot; the zero value means unresolved.
+type varAddress struct {
+	depth int
+	slot  int
+}
+
+// resolveProgram lays out every function and method declared in program.
+func resolveProgram(program []*Stmt) {
+	for _, stmt := range program {
+		Inspect(stmt, func(n Node) bool {
+			if s, ok := n.(*Stmt); ok && s.Kind == StmtFunction {
+				resolveFunction(s)
+			}
+			return true
+		})
+	}
+}
+
+// resolveFunction gives fn's parameters and locals slots and addresses
+// the identifiers in its body that refer to them.
+func resolveFunction(fn *Stmt) {
+	layout := &scopeLayout{index: make(map[string]int)}
+	for _, p := range fn.Params {
+		layout.declare(p.Name)
+	}
+	declarations(fn.Body, layout.declare)
+	fn.layout = layout
+	r := &resolver{layout: layout}
+	r.block(fn.Body)
+}
+
+// declarations calls declare for each name statements bind in the scope
+// they run in, including nested blocks that share that scope.
+func declarations(statements []*Stmt, declare func(string)) {
+	for _, stmt := range statements {
+		if stmt == nil {
+			continue
+		}
+		switch stmt.Kind {
+		case StmtLet:
+			if stmt.Names == nil {
+				declare(stmt.Name)
+			}
+			for _, name := range stmt.Names {
+				declare(name)
+			}
+		case StmtImport, StmtEnum, StmtClass, StmtInterface:
+			declare(stmt.Name)
+			continue
+		case StmtFunction:
+			continue
+		case StmtFor:
+			declarations([]*Stmt{stmt.Init}, declare)
+		case StmtForIn:
+			declare(stmt.Name)
+		}
+		for _, block := range [][]*Stmt{stmt.Then, stmt.Else, stmt.Body, stmt.Finally} {
+			declarations(block, declare)
+		}
+	}
+}
+
+type resolver struct {
+	layout *scopeLayout
+	// nested holds the names bound by the catch blocks and match arms
+	// enclosing the current statement, innermost last.
+	nested []map[string]bool
+}
+
+func (r *resolver) address(name string) varAddress {
+	for idx := len(r.nested) - 1; idx >= 0; idx-- {
+		if r.nested[idx][name] {
+			return varAddress{}
+		}
+	}
+	if slot, ok := r.layout.index[name]; ok {
+		return varAddress{depth: len(r.nested), slot: slot + 1}
+	}
+	return varAddress{}
+}
+
+// scope resolves block in a nested scope binding names and whatever the
+// block declares.
+func (r *resolver) scope(names []string, block []*Stmt, also ...*Expr) {
+	bound := make(map[string]bool)
+	for _, name := range names {
+		bound[name] = true
+	}
+	declarations(block, func(name string) { bound[name] = true })
+	r.nested = append(r.nested, bound)
+	for _, expr := range also {
+		r.expr(expr)
+	}
+	r.block(block)
+	r.nested = r.nested[:len(r.nested)-1]
+}
+
+func (r *resolver) block(statements []*Stmt) {
+	for _, stmt := range statements {
+		r.stmt(stmt)
+	}
+}
+
+func (r *resolver) stmt(stmt *Stmt) {
+	if stmt == nil {
+		return
+	}
+	switch stmt.Kind {
+	case StmtFunction, StmtClass, StmtInterface:
+		// Methods and nested functions are laid out on their own, and field
+		// initializers run in the class's scope.
+		return
+	case StmtAssignment:
+		if stmt.TargetExpr == nil {
+			stmt.addr = r.address(stmt.Target)
+		}
+	case StmtTry:
+		r.block(stmt.Body)
+		var names []string
+		if stmt.CatchName != "" {
+			names = append(names, stmt.CatchName)
+		}
+		r.scope(names, stmt.Catch)
+		r.block(stmt.Finally)
+		return
+	case StmtMatch:
+		r.expr(stmt.Value)
+		for _, c := range stmt.Cases {
+			r.scope(c.Pattern.Bindings, c.Body, c.Pattern.Value)
+		}
+		return
+	case StmtSelect:
+		// Channel operations run before the chosen case's scope exists.
+		for _, c := range stmt.Cases {
+			r.expr(c.Pattern.Value)
+			r.scope(c.Pattern.Bindings, c.Body)
+		}
+		return
+	}
+	r.stmt(stmt.Init)
+	for _, expr := range []*Expr{stmt.TargetExpr, stmt.Value, stmt.Expr, stmt.Condition} {
+		r.expr(expr)
+	}
+	r.stmt(stmt.Update)
+	for _, block := range [][]*Stmt{stmt.Then, stmt.Body, stmt.Else} {
+		r.block(block)
+	}
+}
+
+func (r *resolver) expr(expr *Expr) {
+	Inspect(expr, func(n Node) bool {
+		if e, ok := n.(*Expr); ok && e.Kind == ExprIdentifier {
+			e.addr = r.address(e.Name)
+		}
+		return true
+	})
+}
+
+// slot returns the variable at addr, or nil if it is not bound there yet.
+func (e *Environment) slot(addr varAddress, name string) *VarEntry {
+	env := e
+	for depth := addr.depth; depth > 0 && env != nil; depth-- {
+		env = env.Parent
+	}
+	if env == nil || env.layout == nil || addr.slot > len(env.slots) || env.layout.names[addr.slot-1] != name {
+		return nil
+	}
+	return env.slotEntry(addr.slot - 1)
+}
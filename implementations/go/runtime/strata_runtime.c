@@ -0,0 +1,659 @@
+/*
+ * strata_runtime.c - see strata_runtime.h.
+ */
+#include "strata_runtime.h"
+
+#include <ctype.h>
+#include <stdarg.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+void strata_panic(const char *message) {
+    fflush(stdout);
+    fprintf(stderr, "Error: %s\n", message);
+    exit(1);
+}
+
+static void *strata_alloc(size_t size) {
+    void *p = malloc(size ? size : 1);
+    if (!p) {
+        strata_panic("out of memory");
+    }
+    return p;
+}
+
+static void *strata_grow(void *p, size_t size) {
+    p = realloc(p, size ? size : 1);
+    if (!p) {
+        strata_panic("out of memory");
+    }
+    return p;
+}
+
+static char *strata_copy(const char *s, size_t n) {
+    char *out = strata_alloc(n + 1);
+    memcpy(out, s, n);
+    out[n] = '\0';
+    return out;
+}
+
+/* ---- Boxing ------------------------------------------------------------ */
+
+StrataValue strata_null(void) {
+    StrataValue v;
+    v.kind = STRATA_NULL;
+    v.as.i = 0;
+    return v;
+}
+
+StrataValue strata_int(long long i) {
+    StrataValue v;
+    v.kind = STRATA_INT;
+    v.as.i = i;
+    return v;
+}
+
+StrataValue strata_float(double f) {
+    StrataValue v;
+    v.kind = STRATA_FLOAT;
+    v.as.f = f;
+    return v;
+}
+
+StrataValue strata_bool(int b) {
+    StrataValue v;
+    v.kind = STRATA_BOOL;
+    v.as.b = b != 0;
+    return v;
+}
+
+StrataValue strata_string(const char *s) {
+    StrataValue v;
+    v.kind = STRATA_STRING;
+    v.as.s = (char *)s;
+    return v;
+}
+
+StrataValue strata_list_value(StrataList *l) {
+    StrataValue v;
+    v.kind = STRATA_LIST;
+    v.as.l = l;
+    return v;
+}
+
+StrataValue strata_map_value(StrataMap *m) {
+    StrataValue v;
+    v.kind = STRATA_MAP;
+    v.as.m = m;
+    return v;
+}
+
+static const char *strata_kind_name(StrataKind kind) {
+    switch (kind) {
+    case STRATA_NULL:
+        return "null";
+    case STRATA_INT:
+        return "int";
+    case STRATA_FLOAT:
+        return "float";
+    case STRATA_BOOL:
+        return "bool";
+    case STRATA_STRING:
+        return "string";
+    case STRATA_LIST:
+        return "array";
+    case STRATA_MAP:
+        return "map";
+    }
+    return "value";
+}
+
+static void strata_expect(StrataValue v, StrataKind kind) {
+    char message[64];
+    if (v.kind != kind) {
+        snprintf(message, sizeof message, "expected %s, got %s", strata_kind_name(kind), strata_kind_name(v.kind));
+        strata_panic(message);
+    }
+}
+
+long long strata_as_int(StrataValue v) {
+    strata_expect(v, STRATA_INT);
+    return v.as.i;
+}
+
+double strata_as_float(StrataValue v) {
+    if (v.kind == STRATA_INT) {
+        return (double)v.as.i;
+    }
+    strata_expect(v, STRATA_FLOAT);
+    return v.as.f;
+}
+
+int strata_as_bool(StrataValue v) {
+    strata_expect(v, STRATA_BOOL);
+    return v.as.b;
+}
+
+char *strata_as_string(StrataValue v) {
+    strata_expect(v, STRATA_STRING);
+    return v.as.s;
+}
+
+/* strata_as_char unboxes a character, held as a string of one, to its code
+ * point. */
+long long strata_as_char(StrataValue v) {
+    const unsigned char *s = (const unsigned char *)strata_as_string(v);
+    long long c = s[0];
+    int extra = c >= 0xF0 ? 3 : c >= 0xE0 ? 2 : c >= 0xC0 ? 1 : 0;
+    int i;
+    if (extra > 0) {
+        c &= 0x3F >> extra;
+    }
+    for (i = 1; i <= extra && (s[i] & 0xC0) == 0x80; i++) {
+        c = (c << 6) | (s[i] & 0x3F);
+    }
+    return c;
+}
+
+StrataList *strata_as_list(StrataValue v) {
+    strata_expect(v, STRATA_LIST);
+    return v.as.l;
+}
+
+StrataMap *strata_as_map(StrataValue v) {
+    strata_expect(v, STRATA_MAP);
+    return v.as.m;
+}
+
+/* ---- Strings ----------------------------------------------------------- */
+
+/* strata_offset returns the byte offset of character index in s, clamped
+ * to the end of the string. */
+static size_t strata_offset(const char *s, long long index) {
+    size_t pos = 0;
+    while (index > 0 && s[pos]) {
+        pos++;
+        while ((s[pos] & 0xC0) == 0x80) {
+            pos++;
+        }
+        index--;
+    }
+    return pos;
+}
+
+char *strata_concat(const char *a, const char *b) {
+    size_t la = strlen(a), lb = strlen(b);
+    char *out = strata_alloc(la + lb + 1);
+    memcpy(out, a, la);
+    memcpy(out + la, b, lb + 1);
+    return out;
+}
+
+int strata_str_eq(const char *a, const char *b) {
+    return strcmp(a, b) == 0;
+}
+
+int strata_str_cmp(const char *a, const char *b) {
+    return strcmp(a, b);
+}
+
+char *strata_int_str(long long i) {
+    char buf[32];
+    snprintf(buf, sizeof buf, "%lld", i);
+    return strata_copy(buf, strlen(buf));
+}
+
+/* strata_char_str encodes the code point c as UTF-8. */
+char *strata_char_str(long long c) {
+    char buf[4];
+    size_t n;
+    if (c < 0x80) {
+        buf[0] = (char)c;
+        n = 1;
+    } else if (c < 0x800) {
+        buf[0] = (char)(0xC0 | (c >> 6));
+        buf[1] = (char)(0x80 | (c & 0x3F));
+        n = 2;
+    } else if (c < 0x10000) {
+        buf[0] = (char)(0xE0 | (c >> 12));
+        buf[1] = (char)(0x80 | ((c >> 6) & 0x3F));
+        buf[2] = (char)(0x80 | (c & 0x3F));
+        n = 3;
+    } else {
+        buf[0] = (char)(0xF0 | (c >> 18));
+        buf[1] = (char)(0x80 | ((c >> 12) & 0x3F));
+        buf[2] = (char)(0x80 | ((c >> 6) & 0x3F));
+        buf[3] = (char)(0x80 | (c & 0x3F));
+        n = 4;
+    }
+    return strata_copy(buf, n);
+}
+
+/* strata_float_str formats f as the interpreter does: the fewest digits
+ * that read back as f, in exponent form for very large or small values. */
+char *strata_float_str(double f) {
+    char buf[64];
+    int precision, exponent;
+    if (f != f) {
+        return strata_copy("NaN", 3);
+    }
+    if (f == 1.0 / 0.0 || f == -1.0 / 0.0) {
+        return f > 0 ? strata_copy("+Inf", 4) : strata_copy("-Inf", 4);
+    }
+    for (precision = 1; precision < 17; precision++) {
+        snprintf(buf, sizeof buf, "%.*e", precision - 1, f);
+        if (strtod(buf, NULL) == f) {
+            break;
+        }
+    }
+    snprintf(buf, sizeof buf, "%.*e", precision - 1, f);
+    exponent = atoi(strchr(buf, 'e') + 1);
+    if (exponent < -4 || exponent >= 21) {
+        return strata_copy(buf, strlen(buf));
+    }
+    snprintf(buf, sizeof buf, "%.*f", precision - 1 - exponent > 0 ? precision - 1 - exponent : 0, f);
+    return strata_copy(buf, strlen(buf));
+}
+
+char *strata_bool_str(int b) {
+    return b ? strata_copy("true", 4) : strata_copy("false", 5);
+}
+
+static char *strata_quote(const char *s) {
+    size_t n = strlen(s), pos = 0, i;
+    char *out = strata_alloc(2 * n + 3);
+    out[pos++] = '"';
+    for (i = 0; i < n; i++) {
+        if (s[i] == '"' || s[i] == '\\') {
+            out[pos++] = '\\';
+        }
+        out[pos++] = s[i];
+    }
+    out[pos++] = '"';
+    out[pos] = '\0';
+    return out;
+}
+
+/* strata_element_str formats an item of a list or map, quoting strings. */
+static char *strata_element_str(StrataValue v) {
+    if (v.kind == STRATA_STRING) {
+        return strata_quote(v.as.s);
+    }
+    return strata_value_str(v);
+}
+
+static int strata_key_order(const void *a, const void *b) {
+    return strcmp(*(char *const *)a, *(char *const *)b);
+}
+
+char *strata_value_str(StrataValue v) {
+    char *out;
+    long long i;
+    switch (v.kind) {
+    case STRATA_NULL:
+        return strata_copy("null", 4);
+    case STRATA_INT:
+        return strata_int_str(v.as.i);
+    case STRATA_FLOAT:
+        return strata_float_str(v.as.f);
+    case STRATA_BOOL:
+        return strata_bool_str(v.as.b);
+    case STRATA_STRING:
+        return v.as.s;
+    case STRATA_LIST:
+        out = "[";
+        for (i = 0; i < v.as.l->len; i++) {
+            out = strata_concat(out, i ? ", " : "");
+            out = strata_concat(out, strata_element_str(v.as.l->items[i]));
+        }
+        return strata_concat(out, "]");
+    case STRATA_MAP: {
+        /* Keys print in sorted order, as the interpreter prints them. */
+        char **keys = strata_alloc(sizeof(char *) * (size_t)v.as.m->len);
+        memcpy(keys, v.as.m->keys, sizeof(char *) * (size_t)v.as.m->len);
+        qsort(keys, (size_t)v.as.m->len, sizeof(char *), strata_key_order);
+        out = "{";
+        for (i = 0; i < v.as.m->len; i++) {
+            out = strata_concat(out, i ? ", " : "");
+            out = strata_concat(out, strata_quote(keys[i]));
+            out = strata_concat(out, ": ");
+            out = strata_concat(out, strata_element_str(strata_map_get(v.as.m, keys[i])));
+        }
+        free(keys);
+        return strata_concat(out, "}");
+    }
+    }
+    return strata_copy("", 0);
+}
+
+static long long strata_map_find(StrataMap *m, const char *key);
+
+/*
+ * strata_value_eq compares as the interpreter's == does: ints and floats by
+ * number, lists item by item and maps by their keys and values, whatever
+ * order the keys were added in.
+ */
+int strata_value_eq(StrataValue a, StrataValue b) {
+    long long i;
+    if (a.kind == STRATA_NULL || b.kind == STRATA_NULL) {
+        return a.kind == b.kind;
+    }
+    if ((a.kind == STRATA_INT || a.kind == STRATA_FLOAT) && (b.kind == STRATA_INT || b.kind == STRATA_FLOAT)) {
+        if (a.kind == STRATA_INT && b.kind == STRATA_INT) {
+            return a.as.i == b.as.i;
+        }
+        return (a.kind == STRATA_INT ? (double)a.as.i : a.as.f) == (b.kind == STRATA_INT ? (double)b.as.i : b.as.f);
+    }
+    if (a.kind != b.kind) {
+        return 0;
+    }
+    switch (a.kind) {
+    case STRATA_BOOL:
+        return !a.as.b == !b.as.b;
+    case STRATA_STRING:
+        return strcmp(a.as.s, b.as.s) == 0;
+    case STRATA_LIST:
+        if (a.as.l->len != b.as.l->len) {
+            return 0;
+        }
+        for (i = 0; i < a.as.l->len; i++) {
+            if (!strata_value_eq(a.as.l->items[i], b.as.l->items[i])) {
+                return 0;
+            }
+        }
+        return 1;
+    case STRATA_MAP:
+        if (a.as.m->len != b.as.m->len) {
+            return 0;
+        }
+        for (i = 0; i < a.as.m->len; i++) {
+            long long j = strata_map_find(b.as.m, a.as.m->keys[i]);
+            if (j < 0 || !strata_value_eq(a.as.m->values[i], b.as.m->values[j])) {
+                return 0;
+            }
+        }
+        return 1;
+    default:
+        return 0;
+    }
+}
+
+long long strata_strlen(const char *s) {
+    long long n = 0;
+    for (; *s; s++) {
+        if ((*s & 0xC0) != 0x80) {
+            n++;
+        }
+    }
+    return n;
+}
+
+char *strata_substr(const char *s, long long start, long long end) {
+    size_t from, to;
+    if (start < 0) {
+        start = 0;
+    }
+    if (start > end) {
+        start = end;
+    }
+    from = strata_offset(s, start);
+    to = strata_offset(s, end < 0 ? 0 : end);
+    if (to < from) {
+        to = from;
+    }
+    return strata_copy(s + from, to - from);
+}
+
+char *strata_char_at(const char *s, long long index) {
+    char message[96];
+    if (index < 0 || index >= strata_strlen(s)) {
+        snprintf(message, sizeof message, "index %lld out of range for string of length %lld", index, strata_strlen(s));
+        strata_panic(message);
+    }
+    return strata_substr(s, index, index + 1);
+}
+
+char *strata_upper(const char *s) {
+    char *out = strata_copy(s, strlen(s));
+    char *p;
+    for (p = out; *p; p++) {
+        *p = (char)toupper((unsigned char)*p);
+    }
+    return out;
+}
+
+char *strata_lower(const char *s) {
+    char *out = strata_copy(s, strlen(s));
+    char *p;
+    for (p = out; *p; p++) {
+        *p = (char)tolower((unsigned char)*p);
+    }
+    return out;
+}
+
+char *strata_trim(const char *s) {
+    size_t n;
+    while (isspace((unsigned char)*s)) {
+        s++;
+    }
+    n = strlen(s);
+    while (n > 0 && isspace((unsigned char)s[n - 1])) {
+        n--;
+    }
+    return strata_copy(s, n);
+}
+
+int strata_starts_with(const char *s, const char *prefix) {
+    return strncmp(s, prefix, strlen(prefix)) == 0;
+}
+
+int strata_ends_with(const char *s, const char *suffix) {
+    size_t ls = strlen(s), lx = strlen(suffix);
+    return lx <= ls && strcmp(s + ls - lx, suffix) == 0;
+}
+
+int strata_includes(const char *s, const char *sub) {
+    return strstr(s, sub) != NULL;
+}
+
+long long strata_index_of(const char *s, const char *sub) {
+    const char *found = strstr(s, sub);
+    char *prefix;
+    if (!found) {
+        return -1;
+    }
+    prefix = strata_copy(s, (size_t)(found - s));
+    return strata_strlen(prefix);
+}
+
+char *strata_replace(const char *s, const char *old, const char *new_, int all) {
+    size_t lo = strlen(old);
+    char *out = "";
+    const char *found;
+    if (lo == 0) {
+        return strata_copy(s, strlen(s));
+    }
+    while ((found = strstr(s, old)) != NULL) {
+        out = strata_concat(out, strata_copy(s, (size_t)(found - s)));
+        out = strata_concat(out, new_);
+        s = found + lo;
+        if (!all) {
+            break;
+        }
+    }
+    return strata_concat(out, s);
+}
+
+char *strata_repeat(const char *s, long long n) {
+    size_t ls = strlen(s);
+    char *out;
+    long long i;
+    if (n < 0) {
+        strata_panic("repeat count must not be negative");
+    }
+    out = strata_alloc(ls * (size_t)n + 1);
+    for (i = 0; i < n; i++) {
+        memcpy(out + ls * (size_t)i, s, ls);
+    }
+    out[ls * (size_t)n] = '\0';
+    return out;
+}
+
+long long strata_parse_int(const char *s) {
+    return strtoll(s, NULL, 10);
+}
+
+double strata_parse_float(const char *s) {
+    return strtod(s, NULL);
+}
+
+/* ---- Lists ------------------------------------------------------------- */
+
+StrataList *strata_list_new(void) {
+    StrataList *l = strata_alloc(sizeof *l);
+    l->len = 0;
+    l->cap = 0;
+    l->items = NULL;
+    return l;
+}
+
+StrataList *strata_list_of(long long n, ...) {
+    StrataList *l = strata_list_new();
+    va_list args;
+    long long i;
+    va_start(args, n);
+    for (i = 0; i < n; i++) {
+        strata_list_push(l, va_arg(args, StrataValue));
+    }
+    va_end(args);
+    return l;
+}
+
+void strata_list_push(StrataList *l, StrataValue v) {
+    if (l->len == l->cap) {
+        l->cap = l->cap ? 2 * l->cap : 8;
+        l->items = strata_grow(l->items, sizeof(StrataValue) * (size_t)l->cap);
+    }
+    l->items[l->len++] = v;
+}
+
+static void strata_check_index(StrataList *l, long long index) {
+    char message[96];
+    if (index < 0 || index >= l->len) {
+        snprintf(message, sizeof message, "index %lld out of range for array of length %lld", index, l->len);
+        strata_panic(message);
+    }
+}
+
+StrataValue strata_list_get(StrataList *l, long long index) {
+    strata_check_index(l, index);
+    return l->items[index];
+}
+
+void strata_list_set(StrataList *l, long long index, StrataValue v) {
+    strata_check_index(l, index);
+    l->items[index] = v;
+}
+
+long long strata_list_len(StrataList *l) {
+    return l->len;
+}
+
+char *strata_join(StrataList *l, const char *sep) {
+    char *out = "";
+    long long i;
+    for (i = 0; i < l->len; i++) {
+        out = strata_concat(out, i ? sep : "");
+        out = strata_concat(out, strata_value_str(l->items[i]));
+    }
+    return out;
+}
+
+StrataList *strata_split(const char *s, const char *sep) {
+    StrataList *l = strata_list_new();
+    size_t ls = strlen(sep);
+    const char *found;
+    if (ls == 0) {
+        /* An empty separator splits into characters. */
+        long long i, n = strata_strlen(s);
+        for (i = 0; i < n; i++) {
+            strata_list_push(l, strata_string(strata_substr(s, i, i + 1)));
+        }
+        return l;
+    }
+    while ((found = strstr(s, sep)) != NULL) {
+        strata_list_push(l, strata_string(strata_copy(s, (size_t)(found - s))));
+        s = found + ls;
+    }
+    strata_list_push(l, strata_string(strata_copy(s, strlen(s))));
+    return l;
+}
+
+/* ---- Maps -------------------------------------------------------------- */
+
+StrataMap *strata_map_new(void) {
+    StrataMap *m = strata_alloc(sizeof *m);
+    m->len = 0;
+    m->cap = 0;
+    m->keys = NULL;
+    m->values = NULL;
+    return m;
+}
+
+StrataMap *strata_map_of(long long n, ...) {
+    StrataMap *m = strata_map_new();
+    va_list args;
+    long long i;
+    va_start(args, n);
+    for (i = 0; i < n; i++) {
+        const char *key = va_arg(args, const char *);
+        strata_map_set(m, key, va_arg(args, StrataValue));
+    }
+    va_end(args);
+    return m;
+}
+
+static long long strata_map_find(StrataMap *m, const char *key) {
+    long long i;
+    for (i = 0; i < m->len; i++) {
+        if (strcmp(m->keys[i], key) == 0) {
+            return i;
+        }
+    }
+    return -1;
+}
+
+void strata_map_set(StrataMap *m, const char *key, StrataValue v) {
+    long long i = strata_map_find(m, key);
+    if (i >= 0) {
+        m->values[i] = v;
+        return;
+    }
+    if (m->len == m->cap) {
+        m->cap = m->cap ? 2 * m->cap : 8;
+        m->keys = strata_grow(m->keys, sizeof(char *) * (size_t)m->cap);
+        m->values = strata_grow(m->values, sizeof(StrataValue) * (size_t)m->cap);
+    }
+    m->keys[m->len] = strata_copy(key, strlen(key));
+    m->values[m->len++] = v;
+}
+
+StrataValue strata_map_get(StrataMap *m, const char *key) {
+    long long i = strata_map_find(m, key);
+    return i >= 0 ? m->values[i] : strata_null();
+}
+
+int strata_map_has(StrataMap *m, const char *key) {
+    return strata_map_find(m, key) >= 0;
+}
+
+long long strata_map_len(StrataMap *m) {
+    return m->len;
+}
+
+/* ---- Output ------------------------------------------------------------ */
+
+void strata_print(const char *s) {
+    puts(s);
+}
@@ -0,0 +1,120 @@
+/*
+ * strata_runtime.h - the runtime library C generated by `strata build`
+ * calls into: strings, lists, maps, values of type any and the builtins.
+ *
+ * Strings are NUL-terminated UTF-8 and, like lists and maps, are allocated
+ * on the heap and never freed: generated programs are expected to be short
+ * lived. Functions that fail, such as indexing past the end of a list,
+ * print an error and exit with status 1, as the interpreter would.
+ */
+#ifndef STRATA_RUNTIME_H
+#define STRATA_RUNTIME_H
+
+#include <stdbool.h>
+#include <stddef.h>
+
+typedef struct StrataList StrataList;
+typedef struct StrataMap StrataMap;
+
+typedef enum {
+    STRATA_NULL,
+    STRATA_INT,
+    STRATA_FLOAT,
+    STRATA_BOOL,
+    STRATA_STRING,
+    STRATA_LIST,
+    STRATA_MAP
+} StrataKind;
+
+/* StrataValue is a value of any type, as lists and maps hold them. */
+typedef struct {
+    StrataKind kind;
+    union {
+        long long i;
+        double f;
+        int b;
+        char *s;
+        StrataList *l;
+        StrataMap *m;
+    } as;
+} StrataValue;
+
+struct StrataList {
+    long long len;
+    long long cap;
+    StrataValue *items;
+};
+
+/* Maps keep their keys in insertion order and look them up linearly. */
+struct StrataMap {
+    long long len;
+    long long cap;
+    char **keys;
+    StrataValue *values;
+};
+
+void strata_panic(const char *message);
+
+/* Boxing and unboxing. The strata_as_ functions exit on a kind mismatch. */
+StrataValue strata_null(void);
+StrataValue strata_int(long long i);
+StrataValue strata_float(double f);
+StrataValue strata_bool(int b);
+StrataValue strata_string(const char *s);
+StrataValue strata_list_value(StrataList *l);
+StrataValue strata_map_value(StrataMap *m);
+long long strata_as_int(StrataValue v);
+double strata_as_float(StrataValue v);
+int strata_as_bool(StrataValue v);
+char *strata_as_string(StrataValue v);
+long long strata_as_char(StrataValue v);
+StrataList *strata_as_list(StrataValue v);
+StrataMap *strata_as_map(StrataValue v);
+
+/* Strings. Positions and lengths count characters, not bytes. */
+char *strata_concat(const char *a, const char *b);
+int strata_str_eq(const char *a, const char *b);
+int strata_str_cmp(const char *a, const char *b);
+char *strata_int_str(long long i);
+char *strata_float_str(double f);
+char *strata_bool_str(int b);
+char *strata_char_str(long long c);
+char *strata_value_str(StrataValue v);
+int strata_value_eq(StrataValue a, StrataValue b);
+long long strata_strlen(const char *s);
+char *strata_substr(const char *s, long long start, long long end);
+char *strata_char_at(const char *s, long long index);
+char *strata_upper(const char *s);
+char *strata_lower(const char *s);
+char *strata_trim(const char *s);
+int strata_starts_with(const char *s, const char *prefix);
+int strata_ends_with(const char *s, const char *suffix);
+int strata_includes(const char *s, const char *sub);
+long long strata_index_of(const char *s, const char *sub);
+char *strata_replace(const char *s, const char *old, const char *new_, int all);
+char *strata_repeat(const char *s, long long n);
+long long strata_parse_int(const char *s);
+double strata_parse_float(const char *s);
+
+/* Lists. */
+StrataList *strata_list_new(void);
+StrataList *strata_list_of(long long n, ...);
+void strata_list_push(StrataList *l, StrataValue v);
+StrataValue strata_list_get(StrataList *l, long long index);
+void strata_list_set(StrataList *l, long long index, StrataValue v);
+long long strata_list_len(StrataList *l);
+char *strata_join(StrataList *l, const char *sep);
+StrataList *strata_split(const char *s, const char *sep);
+
+/* Maps with string keys. strata_map_of takes n key, value pairs. */
+StrataMap *strata_map_new(void);
+StrataMap *strata_map_of(long long n, ...);
+void strata_map_set(StrataMap *m, const char *key, StrataValue v);
+StrataValue strata_map_get(StrataMap *m, const char *key);
+int strata_map_has(StrataMap *m, const char *key);
+long long strata_map_len(StrataMap *m);
+
+/* Output. */
+void strata_print(const char *s);
+
+#endif
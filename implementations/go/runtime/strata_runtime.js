@@ -0,0 +1,354 @@
+// strata_runtime.js - the runtime library JavaScript generated by
+// `strata build --target=js` imports: formatting and comparison of values,
+// the builtins and the io, math and text modules.
+//
+// Lists are arrays, maps plain objects and instances of Strata classes
+// instances of JavaScript classes. JavaScript has one number type, so an
+// integral float prints as an int would. Failures throw a StrataError with
+// the message the interpreter gives, which is what a catch block binds.
+
+export class StrataError extends Error {}
+
+function fail(message) {
+    throw new StrataError(message);
+}
+
+// caught is the value a catch block binds for what was thrown.
+export function caught(thrown) {
+    return thrown instanceof Error ? thrown.message : thrown;
+}
+
+export function unsupported(what) {
+    fail(what + " is not supported in JavaScript");
+}
+
+function isMap(value) {
+    return value !== null && typeof value === "object" && Object.getPrototypeOf(value) === Object.prototype;
+}
+
+function formatNumber(n) {
+    if (Number.isInteger(n) && Math.abs(n) < 1e21) {
+        return String(n);
+    }
+    if (!Number.isFinite(n)) {
+        return Number.isNaN(n) ? "NaN" : n > 0 ? "+Inf" : "-Inf";
+    }
+    // Shortest digits, in exponent form as Go's %g chooses it.
+    const [mantissa, e] = n.toExponential().split("e");
+    const exp = Number(e);
+    if (exp < -4 || exp >= 6) {
+        return mantissa + "e" + (exp < 0 ? "-" : "+") + String(Math.abs(exp)).padStart(2, "0");
+    }
+    return String(n);
+}
+
+function element(value) {
+    return typeof value === "string" ? JSON.stringify(value) : str(value);
+}
+
+// str formats a value as print shows it.
+export function str(value) {
+    if (value === null || value === undefined) {
+        return "null";
+    }
+    switch (typeof value) {
+    case "string":
+        return value;
+    case "number":
+        return formatNumber(value);
+    case "function":
+        return "<func " + value.name + ">";
+    case "object":
+        break;
+    default:
+        return String(value);
+    }
+    if (Array.isArray(value)) {
+        return "[" + value.map(element).join(", ") + "]";
+    }
+    if (isMap(value)) {
+        const keys = Object.keys(value).sort();
+        return "{" + keys.map((key) => JSON.stringify(key) + ": " + element(value[key])).join(", ") + "}";
+    }
+    const fields = Object.keys(value).map((key) => key + ": " + element(value[key]));
+    return value.constructor.name + "{" + fields.join(", ") + "}";
+}
+
+// equal compares values as == does: numbers by value, lists and maps by
+// their contents and objects by identity.
+export function equal(a, b) {
+    if (a === null || a === undefined || b === null || b === undefined) {
+        return (a === null || a === undefined) && (b === null || b === undefined);
+    }
+    if (Array.isArray(a)) {
+        return Array.isArray(b) && a.length === b.length && a.every((item, i) => equal(item, b[i]));
+    }
+    if (isMap(a)) {
+        if (!isMap(b) || Object.keys(a).length !== Object.keys(b).length) {
+            return false;
+        }
+        return Object.keys(a).every((key) => Object.hasOwn(b, key) && equal(a[key], b[key]));
+    }
+    return a === b;
+}
+
+// int checks the result of int arithmetic: past 2^53 a number no longer
+// holds every integer, so the result would print rounded.
+export function int(n) {
+    if (!Number.isSafeInteger(n)) {
+        fail("integer overflow: the result is beyond the integers a JavaScript number holds exactly");
+    }
+    return n;
+}
+
+export function idiv(a, b) {
+    if (b === 0) {
+        fail("division by zero");
+    }
+    return Math.trunc(a / b);
+}
+
+// div divides as / does on operands of unknown type: as ints when both
+// are integral.
+export function div(a, b) {
+    return Number.isInteger(a) && Number.isInteger(b) ? idiv(a, b) : a / b;
+}
+
+function position(index, n, kind = "array") {
+    if (!Number.isInteger(index)) {
+        fail(kind + " index must be int, got " + typeOf(index));
+    }
+    if (index < 0 || index >= n) {
+        fail("index " + index + " out of range for " + kind + " of length " + n);
+    }
+    return index;
+}
+
+// index reads a list element, a map entry or a string's character.
+export function index(value, i) {
+    if (Array.isArray(value)) {
+        return value[position(i, value.length)];
+    }
+    if (typeof value === "string") {
+        const chars = [...value];
+        return chars[position(i, chars.length, "string")];
+    }
+    if (isMap(value)) {
+        if (typeof i !== "string") {
+            fail("map key must be string, got " + typeOf(i));
+        }
+        return Object.hasOwn(value, i) ? value[i] : null;
+    }
+    fail("cannot index " + typeOf(value));
+}
+
+// iterate yields what a for-in loop over value binds: the items of a
+// list, the characters of a string, the keys of a map in sorted order or
+// the values of an object with next() or iter().
+export function* iterate(value) {
+    if (Array.isArray(value) || typeof value === "string") {
+        yield* value;
+        return;
+    }
+    if (isMap(value)) {
+        yield* Object.keys(value).sort();
+        return;
+    }
+    if (value !== null && typeof value === "object") {
+        if (typeof value.next === "function") {
+            for (;;) {
+                const step = value.next();
+                if (!isMap(step) || step.done) {
+                    return;
+                }
+                yield step.value;
+            }
+        }
+        if (typeof value.iter === "function") {
+            yield* iterate(value.iter());
+            return;
+        }
+    }
+    fail(typeOf(value) + " is not iterable");
+}
+
+// Builtins.
+
+export function typeOf(value) {
+    if (value === null || value === undefined) {
+        return "null";
+    }
+    switch (typeof value) {
+    case "number":
+        return Number.isInteger(value) ? "int" : "float";
+    case "boolean":
+        return "bool";
+    case "string":
+        return "string";
+    case "function":
+        return "function";
+    }
+    if (Array.isArray(value)) {
+        return "array";
+    }
+    return isMap(value) ? "map" : value.constructor.name;
+}
+
+export { typeOf as typeof };
+
+export function strlen(s) {
+    return [...s].length;
+}
+
+export function len(value) {
+    if (typeof value === "string") {
+        return strlen(value);
+    }
+    if (Array.isArray(value)) {
+        return value.length;
+    }
+    if (isMap(value)) {
+        return Object.keys(value).length;
+    }
+    fail("len is not defined for " + typeOf(value));
+}
+
+export function substr(s, start, end) {
+    const chars = [...s];
+    const from = Math.min(Math.max(start, 0), chars.length);
+    const to = Math.min(Math.max(end, from), chars.length);
+    return chars.slice(from, to).join("");
+}
+
+export function toUpperCase(s) {
+    return s.toUpperCase();
+}
+
+export function toLowerCase(s) {
+    return s.toLowerCase();
+}
+
+export function trim(s) {
+    return s.trim();
+}
+
+export function split(s, sep) {
+    return sep === "" ? [...s] : s.split(sep);
+}
+
+export function join(list, sep) {
+    return list.map(str).join(sep);
+}
+
+export function startsWith(s, prefix) {
+    return s.startsWith(prefix);
+}
+
+export function endsWith(s, suffix) {
+    return s.endsWith(suffix);
+}
+
+export function includes(s, sub) {
+    return s.includes(sub);
+}
+
+export function indexOf(s, sub) {
+    const i = s.indexOf(sub);
+    return i < 0 ? -1 : strlen(s.slice(0, i));
+}
+
+export function replace(s, old, replacement) {
+    return s.replace(old, () => replacement);
+}
+
+export function replaceAll(s, old, replacement) {
+    return s.split(old).join(replacement);
+}
+
+export function repeat(s, n) {
+    if (n < 0) {
+        fail("repeat count must not be negative");
+    }
+    return s.repeat(n);
+}
+
+export function toString(value) {
+    return str(value);
+}
+
+export function parseInt(s) {
+    return /^[+-]?\d+$/.test(s) ? Number(s) : 0;
+}
+
+export function parseFloat(s) {
+    const f = Number(s);
+    return s !== "" && s.trim() === s && !Number.isNaN(f) ? f : 0;
+}
+
+export function range(start, end) {
+    const result = [];
+    for (let i = start; i < end; i++) {
+        result.push(i);
+    }
+    return result;
+}
+
+// round rounds half away from zero, as Go does.
+function round(x) {
+    return Math.sign(x) * Math.round(Math.abs(x));
+}
+
+export const abs = Math.abs;
+export const sqrt = Math.sqrt;
+export const pow = Math.pow;
+export const sin = Math.sin;
+export const cos = Math.cos;
+export const tan = Math.tan;
+export const asin = Math.asin;
+export const acos = Math.acos;
+export const atan = Math.atan;
+export const atan2 = Math.atan2;
+export const exp = Math.exp;
+export const log = Math.log;
+export const log10 = Math.log10;
+export const log2 = Math.log2;
+export const trunc = Math.trunc;
+export const max = Math.max;
+export const min = Math.min;
+export { round };
+
+export function floor(x) {
+    return Math.floor(x);
+}
+
+export function ceil(x) {
+    return Math.ceil(x);
+}
+
+// Modules.
+
+export const io = {
+    print(value) {
+        console.log(str(value));
+    },
+    println(value) {
+        console.log(str(value));
+    },
+};
+
+export const math = {
+    sqrt, sin, cos, tan, asin, acos, atan, exp, log, log10, log2, pow,
+    floor: Math.floor,
+    ceil: Math.ceil,
+    round,
+    abs,
+    random: Math.random,
+    PI: Math.PI,
+    E: Math.E,
+};
+
+export const text = {
+    split, join, trim, toUpperCase, toLowerCase, startsWith, endsWith,
+    includes, indexOf, replace, replaceAll, repeat,
+    length: strlen,
+};
@@ -0,0 +1,91 @@
+package strata
+
+// ============================================================================
+// SANDBOX - Capability flags for running untrusted scripts
+// ============================================================================
+
+// InterpreterOptions lists what a script may touch outside the interpreter.
+// The zero value grants nothing; AllowAll is what scripts get by default.
+type InterpreterOptions struct {
+	AllowFS  bool
+	AllowNet bool
+	AllowEnv bool
+}
+
+var AllowAll = InterpreterOptions{AllowFS: true, AllowNet: true, AllowEnv: true}
+
+type capability struct {
+	name string
+	flag string
+	// allowed reports whether opts grant the capability.
+	allowed func(opts InterpreterOptions) bool
+}
+
+var (
+	capFS  = capability{"filesystem", "--allow-fs", func(opts InterpreterOptions) bool { return opts.AllowFS }}
+	capNet = capability{"network", "--allow-net", func(opts InterpreterOptions) bool { return opts.AllowNet }}
+	capEnv = capability{"environment", "--allow-env", func(opts InterpreterOptions) bool { return opts.AllowEnv }}
+)
+
+// guardedBuiltins maps each builtin that reaches outside the interpreter to
+// the capability it needs.
+var guardedBuiltins = map[string]capability{
+	"readFile": capFS, "writeFile": capFS, "appendFile": capFS, "exists": capFS,
+	"isFile": capFS, "isDirectory": capFS, "mkdir": capFS,
+}
+
+// guardedModules maps each stdlib module that reaches outside the
+// interpreter to the capability its functions need, and guardedMembers does
+// the same for single functions of otherwise harmless modules.
+var guardedModules = map[string]capability{
+	"std::file":         capFS,
+	"std::http::server": capNet,
+	"std::net":          capNet,
+}
+
+var guardedMembers = map[string]capability{
+	"std::dataframe.fromCSV": capFS, "std::dataframe.writeCSV": capFS,
+	"std::os.env": capEnv, "std::os.setEnv": capEnv,
+	"std::log.toFile": capFS,
+}
+
+// permissionError is what a function denied by the sandbox raises.
+func permissionError(name string, c capability) error {
+	return newError(ErrPermission, "%s requires %s access, which is disabled in sandbox mode", name, c.name).withHint("run with " + c.flag + " to grant it")
+}
+
+// Restrict replaces the builtins and module functions opts do not allow
+// with ones that raise a permission error.
+func (i *Interpreter) Restrict(opts InterpreterOptions) {
+	i.Options = opts
+	for name, c := range guardedBuiltins {
+		if _, ok := i.Builtins[name]; ok && !c.allowed(opts) {
+			name, c := name, c
+			i.Builtins[name] = func(args []interface{}) interface{} { return permissionError(name, c) }
+		}
+	}
+	root := i.rootEnv()
+	for spec, value := range root.Modules {
+		module, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		restricted := make(map[string]interface{}, len(module))
+		for member, fn := range module {
+			name := spec + "." + member
+			c, guarded := guardedModules[spec]
+			if !guarded {
+				c, guarded = guardedMembers[name]
+			}
+			if !guarded {
+				c, guarded = pluginCapability(spec)
+			}
+			if guarded && !c.allowed(opts) {
+				c := c
+				fn = NativeFunc(func(args []interface{}) (interface{}, error) { return nil, permissionError(name, c) })
+			}
+			restricted[member] = fn
+		}
+		root.Modules[spec] = restricted
+	}
+}
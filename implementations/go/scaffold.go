@@ -0,0 +1,329 @@
+package strata
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ============================================================================
+// PROJECT SCAFFOLDING - `strata new` project templates
+// ============================================================================
+
+type ProjectTemplate struct {
+	Description string
+	Files       map[string]string
+	Scripts     map[string]string
+}
+
+var ProjectTemplates = map[string]ProjectTemplate{
+	"cli": {
+		Description: "command-line program with a main entrypoint",
+		Files: map[string]string{
+			"src/main.str": `import io from std::io
+
+func main() => void {
+    io.print("Hello from {{name}}!")
+}
+
+main()
+`,
+			"tests/main_test.str": `import io from std::io
+
+io.print("{{name}} tests passed")
+`,
+		},
+		Scripts: map[string]string{"start": "strata src/main.str", "test": "strata tests/main_test.str"},
+	},
+	"lib": {
+		Description: "reusable library exposing functions to other projects",
+		Files: map[string]string{
+			"src/main.str": `import io from std::io
+
+func greet(name: string) => string {
+    return "Hello, " + name + "!"
+}
+
+io.print(greet("{{name}}"))
+`,
+			"tests/main_test.str": `import io from std::io
+
+func greet(name: string) => string {
+    return "Hello, " + name + "!"
+}
+
+if (greet("test") == "Hello, test!") {
+    io.print("greet: ok")
+}
+`,
+		},
+		Scripts: map[string]string{"test": "strata tests/main_test.str"},
+	},
+	"web": {
+		Description: "HTTP server with a request handler",
+		Files: map[string]string{
+			"src/app.str": `func handle(request: map) => any {
+    if (request["path"] == "/") {
+        return "Hello from {{name}}!"
+    }
+    return {"status": 404, "body": "Not found: " + request["path"]}
+}
+`,
+			"src/main.str": `import http from std::http::server
+import io from std::io
+import app from "./app.str"
+
+io.print("{{name}} listening on http://localhost:8080")
+http.listen(8080, app.handle)
+`,
+			"tests/main_test.str": `import io from std::io
+import app from "../src/app.str"
+
+if (app.handle({"path": "/"}) == "Hello from {{name}}!") {
+    io.print("handle /: ok")
+}
+let missing: map = app.handle({"path": "/missing"})
+if (missing["status"] == 404) {
+    io.print("handle /missing: ok")
+}
+`,
+		},
+		Scripts: map[string]string{"start": "strata src/main.str", "test": "strata tests/main_test.str"},
+	},
+}
+
+const defaultGitignore = `.strata/
+*.c
+*.o
+*.exe
+`
+
+type ToolConfig struct {
+	Format FormatConfig `json:"format"`
+	Lint   LintConfig   `json:"lint"`
+}
+
+type FormatConfig struct {
+	Indent    int `json:"indent"`
+	LineWidth int `json:"lineWidth"`
+}
+
+type LintConfig struct {
+	Rules map[string]string `json:"rules"`
+}
+
+func defaultToolConfig() ToolConfig {
+	return ToolConfig{
+		Format: FormatConfig{Indent: 4, LineWidth: 100},
+		Lint: LintConfig{Rules: map[string]string{
+			"unused-variable": "warn",
+			"unused-import":   "warn",
+			"shadowing":       "off",
+		}},
+	}
+}
+
+// TemplateNames lists the templates strata new and strataum init accept.
+func TemplateNames() []string {
+	var names []string
+	for name := range ProjectTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewProject creates a ready-to-run project in a new directory called name.
+func NewProject(name, templateName string) error {
+	if templateName == "" {
+		templateName = "cli"
+	}
+	if _, ok := ProjectTemplates[templateName]; !ok {
+		return fmt.Errorf("unknown template: %s (available: %s)", templateName, strings.Join(TemplateNames(), ", "))
+	}
+	if _, err := os.Stat(name); err == nil {
+		return fmt.Errorf("destination already exists: %s", name)
+	}
+
+	root, err := filepath.Abs(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return err
+	}
+	opts := InitOptions{Name: filepath.Base(root), Version: "0.0.1", Template: templateName}
+	if err := InitProject(root, opts, nil, os.Stdout); err != nil {
+		return err
+	}
+	fmt.Printf("✓ Created %s from the %s template\n", name, templateName)
+	fmt.Printf("\n  cd %s\n  strata src/main.str\n", name)
+	return nil
+}
+
+// InitOptions are the answers `strataum init` asks for.
+type InitOptions struct {
+	Name        string
+	Version     string
+	Description string
+	License     string
+	Template    string
+}
+
+// InitProject sets up a project in dir, which may already hold one. It
+// writes the Strataumfile, keeping what an existing one says beyond the
+// answers, and the files of the template that do not exist yet. Given
+// prompts, it first asks for each answer opts leaves empty, offering a
+// default, and reads the replies from prompts.
+func InitProject(dir string, opts InitOptions, prompts io.Reader, out io.Writer) error {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	config, err := readStrataumfile(root)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	defaults := InitOptions{Name: config.Name, Version: config.Version, Description: config.Description, License: config.License, Template: "cli"}
+	if defaults.Name == "" {
+		defaults.Name = filepath.Base(root)
+	}
+	if defaults.Version == "" {
+		defaults.Version = "0.0.1"
+	}
+	if defaults.License == "" {
+		defaults.License = "MIT"
+	}
+	if prompts != nil {
+		replies := bufio.NewReader(prompts)
+		ask := func(answer *string, question, def string) {
+			if *answer != "" {
+				return
+			}
+			if def != "" {
+				question += " (" + def + ")"
+			}
+			fmt.Fprintf(out, "%s: ", question)
+			line, _ := replies.ReadString('\n')
+			*answer = strings.TrimSpace(line)
+		}
+		ask(&opts.Name, "name", defaults.Name)
+		ask(&opts.Version, "version", defaults.Version)
+		ask(&opts.Description, "description", defaults.Description)
+		ask(&opts.License, "license", defaults.License)
+		ask(&opts.Template, "template, one of "+strings.Join(TemplateNames(), ", "), defaults.Template)
+	}
+	fill := func(answer *string, def string) {
+		if *answer == "" {
+			*answer = def
+		}
+	}
+	fill(&opts.Name, defaults.Name)
+	fill(&opts.Version, defaults.Version)
+	fill(&opts.Description, defaults.Description)
+	fill(&opts.License, defaults.License)
+	fill(&opts.Template, defaults.Template)
+	tmpl, ok := ProjectTemplates[opts.Template]
+	if !ok {
+		return fmt.Errorf("unknown template: %s (available: %s)", opts.Template, strings.Join(TemplateNames(), ", "))
+	}
+
+	files := map[string]string{".gitignore": defaultGitignore}
+	for path, content := range tmpl.Files {
+		files[path] = strings.ReplaceAll(content, "{{name}}", opts.Name)
+	}
+	toolConfig, _ := json.MarshalIndent(defaultToolConfig(), "", "  ")
+	files[".stratarc"] = string(toolConfig) + "\n"
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var wrote, kept []string
+	for _, path := range paths {
+		target := filepath.Join(root, filepath.FromSlash(path))
+		if existing, err := os.ReadFile(target); err == nil {
+			// Packages must stay out of version control whatever else an
+			// existing .gitignore says.
+			if path == ".gitignore" && !strings.Contains(string(existing), ".strata/") {
+				if len(existing) > 0 && !strings.HasSuffix(string(existing), "\n") {
+					existing = append(existing, '\n')
+				}
+				if err := os.WriteFile(target, append(existing, ".strata/\n"...), 0644); err != nil {
+					return err
+				}
+			}
+			kept = append(kept, path)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, []byte(files[path]), 0644); err != nil {
+			return err
+		}
+		wrote = append(wrote, path)
+	}
+	if len(wrote) > 0 {
+		fmt.Fprintf(out, "✓ Wrote %s\n", strings.Join(wrote, ", "))
+	}
+	if len(kept) > 0 {
+		fmt.Fprintf(out, "  kept the existing %s\n", strings.Join(kept, ", "))
+	}
+
+	config.Name, config.Version = opts.Name, opts.Version
+	config.Description, config.License = opts.Description, opts.License
+	for name, script := range tmpl.Scripts {
+		if config.Scripts == nil {
+			config.Scripts = make(map[string]string)
+		}
+		if _, ok := config.Scripts[name]; !ok {
+			config.Scripts[name] = script
+		}
+	}
+	NewPackageManager(root).Init(config)
+	return nil
+}
+
+// InitCommand runs `strataum init [name] [version] [--template=T]
+// [--description=D] [--license=L] [--yes]`, asking for the rest when stdin
+// is a terminal and --yes is not given.
+func InitCommand(args []string, stdin *os.File) error {
+	var opts InitOptions
+	interactive := true
+	var positional []string
+	for _, arg := range args {
+		name, value, _ := strings.Cut(arg, "=")
+		switch name {
+		case "--template":
+			opts.Template = value
+		case "--description":
+			opts.Description = value
+		case "--license":
+			opts.License = value
+		case "--yes", "-y":
+			interactive = false
+		default:
+			if strings.HasPrefix(arg, "-") || len(positional) == 2 {
+				return fmt.Errorf("usage: strataum init [name] [version] [--template=%s] [--description=TEXT] [--license=NAME] [--yes]", strings.Join(TemplateNames(), "|"))
+			}
+			positional = append(positional, arg)
+		}
+	}
+	if len(positional) > 0 {
+		opts.Name = positional[0]
+	}
+	if len(positional) > 1 {
+		opts.Version = positional[1]
+	}
+	var prompts io.Reader
+	if info, err := stdin.Stat(); interactive && err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		prompts = stdin
+	}
+	return InitProject(".", opts, prompts, os.Stdout)
+}
@@ -0,0 +1,107 @@
+package strata
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewCreatesARunnableProject(t *testing.T) {
+	root := t.TempDir()
+	hello, other := filepath.Join(root, "hello"), filepath.Join(root, "other")
+	if err := NewProject(hello, ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"Strataumfile", ".gitignore", ".stratarc", "src/main.str", "tests/main_test.str"} {
+		if _, err := os.Stat(filepath.Join(hello, path)); err != nil {
+			t.Errorf("the cli template did not write %s", path)
+		}
+	}
+	config, err := readStrataumfile(hello)
+	if err != nil || config.Name != "hello" || config.Scripts["start"] != "strata src/main.str" {
+		t.Errorf("Strataumfile = %+v, %v", config, err)
+	}
+	var out strings.Builder
+	if code := RunProject(filepath.Join(hello, "src", "main.str"), RunOptions{Stdout: &out}); code != 0 || out.String() != "Hello from hello!\n" {
+		t.Errorf("src/main.str printed %q and exited %d", out.String(), code)
+	}
+
+	if err := NewProject(hello, ""); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("scaffolding over an existing directory gave %v", err)
+	}
+	if err := NewProject(other, "nope"); err == nil || !strings.Contains(err.Error(), "available: cli, lib, web") {
+		t.Errorf("an unknown template gave %v", err)
+	}
+	if _, err := os.Stat(other); err == nil {
+		t.Error("an unknown template still created the directory")
+	}
+}
+
+func TestTemplatesRunTheirTests(t *testing.T) {
+	for _, name := range TemplateNames() {
+		dir := filepath.Join(t.TempDir(), "demo")
+		if err := NewProject(dir, name); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		project, err := LoadProject(filepath.Join(dir, "tests", "main_test.str"))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var diags strings.Builder
+		if project.ReportDiagnostics(&diags) > 0 {
+			t.Fatalf("%s: %s", name, diags.String())
+		}
+		var out strings.Builder
+		interp := NewInterpreter()
+		RunOptions{Stdout: &out}.Configure(interp)
+		interp.UseProject(project)
+		if err := interp.Interpret(project.EntryModule().Statements); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !strings.Contains(out.String(), "ok") && !strings.Contains(out.String(), "passed") {
+			t.Errorf("%s: tests printed %q", name, out.String())
+		}
+	}
+}
+
+func TestInitAsksAndKeepsExistingFiles(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, ".gitignore"), []byte("*.log"), 0644)
+	os.MkdirAll(filepath.Join(root, "src"), 0755)
+	os.WriteFile(filepath.Join(root, "src", "main.str"), []byte("let mine: int = 1\n"), 0644)
+	os.WriteFile(filepath.Join(root, "Strataumfile"), []byte(`{"name": "old", "version": "1.0.0",
+		"dependencies": {"colors": "^1.0.0"}, "scripts": {"start": "mine"}}`), 0644)
+
+	var out strings.Builder
+	replies := strings.NewReader("demo\n\nA demo service\nApache-2.0\nweb\n")
+	if err := InitProject(root, InitOptions{}, replies, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, question := range []string{"name (old): ", "version (1.0.0): ", "description: ", "license (MIT): ", "template, one of cli, lib, web (cli): "} {
+		if !strings.Contains(out.String(), question) {
+			t.Errorf("did not ask %q: %q", question, out.String())
+		}
+	}
+	config, err := readStrataumfile(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Name != "demo" || config.Version != "1.0.0" || config.Description != "A demo service" || config.License != "Apache-2.0" {
+		t.Errorf("Strataumfile says %+v", config)
+	}
+	if config.Dependencies["colors"] != "^1.0.0" || config.Scripts["start"] != "mine" || config.Scripts["test"] == "" {
+		t.Errorf("Strataumfile lost or missed settings: %+v", config)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "src", "main.str")); string(data) != "let mine: int = 1\n" {
+		t.Errorf("init overwrote src/main.str with %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, ".gitignore")); string(data) != "*.log\n.strata/\n" {
+		t.Errorf(".gitignore is %q", data)
+	}
+	for _, file := range []string{"src/app.str", "tests/main_test.str", ".stratarc", "Strataumfile.lock"} {
+		if _, err := os.Stat(filepath.Join(root, file)); err != nil {
+			t.Errorf("missing %s", file)
+		}
+	}
+}
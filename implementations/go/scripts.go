@@ -0,0 +1,100 @@
+package strata
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// ============================================================================
+// SCRIPTS - Project commands strataum run executes
+// ============================================================================
+
+// The scripts of a Strataumfile name shell commands:
+//
+//	{"scripts": {"test": "strata test", "start": "strata src/main.str"}}
+//
+// `strataum run start [args...]` runs one in the project's directory with
+// the arguments appended, through sh (cmd on Windows), and with
+// .strata/bin, the project's and its workspace's, and the directory of
+// strata itself ahead on the PATH. As with npm, scripts named prestart and
+// poststart run before and after start, and the first to fail stops the
+// run.
+
+// ScriptRequested reports whether `run` with args names a script of the
+// project rather than a Strata file or project to run.
+func (pm *PackageManager) ScriptRequested(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	_, ok := pm.Strataumfile.Scripts[args[0]]
+	return ok
+}
+
+// RunScript runs a script with its pre and post scripts and returns the
+// exit code of the first that fails, or 0.
+func (pm *PackageManager) RunScript(name string, args []string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	if _, ok := pm.Strataumfile.Scripts[name]; !ok {
+		names := make([]string, 0, len(pm.Strataumfile.Scripts))
+		for script := range pm.Strataumfile.Scripts {
+			names = append(names, script)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return 1, fmt.Errorf("no script %s: the Strataumfile in %s has no scripts", name, pm.ProjectRoot)
+		}
+		return 1, fmt.Errorf("no script %s; the scripts are %s", name, strings.Join(names, ", "))
+	}
+	for _, step := range []string{"pre" + name, name, "post" + name} {
+		script, ok := pm.Strataumfile.Scripts[step]
+		if !ok {
+			continue
+		}
+		var stepArgs []string
+		if step == name {
+			stepArgs = args
+		}
+		fmt.Fprintf(stderr, "> %s: %s\n", step, script)
+		cmd := scriptCommand(script, stepArgs)
+		cmd.Dir = pm.ProjectRoot
+		cmd.Env = append(os.Environ(), "PATH="+pm.scriptPath(), "STRATA_SCRIPT="+step)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = stdin, stdout, stderr
+		if err := cmd.Run(); err != nil {
+			if exit, ok := err.(*exec.ExitError); ok {
+				return exit.ExitCode(), nil
+			}
+			return 1, fmt.Errorf("cannot run script %s: %v", step, err)
+		}
+	}
+	return 0, nil
+}
+
+// scriptCommand runs script through the shell with args appended.
+func scriptCommand(script string, args []string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", append([]string{"/C", script}, args...)...)
+	}
+	// sh passes the arguments after the script's name on as "$@".
+	return exec.Command("sh", append([]string{"-c", script + ` "$@"`, "sh"}, args...)...)
+}
+
+// scriptPath is the PATH scripts run with. It also holds the directory of
+// the running strata, so that scripts calling strata find it.
+func (pm *PackageManager) scriptPath() string {
+	dirs := []string{filepath.Join(pm.ProjectRoot, ".strata", "bin")}
+	if pm.WorkspaceRoot != pm.ProjectRoot {
+		dirs = append(dirs, filepath.Join(pm.WorkspaceRoot, ".strata", "bin"))
+	}
+	if self, err := os.Executable(); err == nil {
+		dirs = append(dirs, filepath.Dir(self))
+	}
+	if path := os.Getenv("PATH"); path != "" {
+		dirs = append(dirs, path)
+	}
+	return strings.Join(dirs, string(os.PathListSeparator))
+}
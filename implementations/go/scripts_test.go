@@ -0,0 +1,52 @@
+package strata
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunScript(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "Strataumfile"), []byte(`{"name": "app", "scripts": {
+		"pregreet": "echo before",
+		"greet": "hello from $STRATA_SCRIPT:",
+		"postgreet": "echo after",
+		"fail": "exit 3",
+		"postfail": "echo unreachable"}}`), 0644)
+	bin := filepath.Join(root, ".strata", "bin")
+	os.MkdirAll(bin, 0755)
+	os.WriteFile(filepath.Join(bin, "hello"), []byte("#!/bin/sh\necho \"$@\"\n"), 0755)
+
+	pm := NewPackageManager(root)
+	if !pm.ScriptRequested([]string{"greet"}) || pm.ScriptRequested([]string{"main.str"}) {
+		t.Error("ScriptRequested should match only the scripts of the Strataumfile")
+	}
+	var out, errs strings.Builder
+	code, err := pm.RunScript("greet", []string{"a b", "c"}, nil, &out, &errs)
+	if err != nil || code != 0 {
+		t.Fatalf("greet: exit %d, %v: %s", code, err, errs.String())
+	}
+	if want := "before\nfrom greet: a b c\nafter\n"; out.String() != want {
+		t.Errorf("greet printed %q, want %q", out.String(), want)
+	}
+	if !strings.Contains(errs.String(), "> greet: hello from $STRATA_SCRIPT:") {
+		t.Errorf("greet did not echo the script: %q", errs.String())
+	}
+
+	out.Reset()
+	if code, err := pm.RunScript("fail", nil, nil, &out, &errs); err != nil || code != 3 {
+		t.Errorf("fail: exit %d, %v; want exit 3", code, err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("a post script ran after a failure: %q", out.String())
+	}
+	if _, err := pm.RunScript("deploy", nil, nil, &out, &errs); err == nil || !strings.Contains(err.Error(), "the scripts are fail, greet, postfail, postgreet, pregreet") {
+		t.Errorf("unknown script: got %v", err)
+	}
+}
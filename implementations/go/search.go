@@ -0,0 +1,158 @@
+package strata
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// ============================================================================
+// SEARCH - Discovering packages in a registry from the command line
+// ============================================================================
+
+// SearchResult is a package a registry search found.
+type SearchResult struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Search asks the registry for at most limit packages matching query.
+func (c *RegistryClient) Search(query string, limit int) ([]SearchResult, error) {
+	data, err := c.get(c.URL+"/search?q="+url.QueryEscape(query)+"&limit="+strconv.Itoa(limit), 8<<20)
+	if err == errPackageNotFound {
+		return nil, fmt.Errorf("registry %s does not support search", c.URL)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var answer struct {
+		Results []SearchResult `json:"results"`
+	}
+	if err := json.Unmarshal(data, &answer); err != nil {
+		return nil, fmt.Errorf("registry %s sent invalid search results: %v", c.URL, err)
+	}
+	if len(answer.Results) > limit {
+		answer.Results = answer.Results[:limit]
+	}
+	return answer.Results, nil
+}
+
+// Search prints the packages of the project's registry that match query,
+// or of a scope's registry for a query such as @corp/log.
+func (pm *PackageManager) Search(w io.Writer, query string, limit int) error {
+	client, err := pm.registryClient(query)
+	if err != nil {
+		return err
+	}
+	results, err := client.Search(query, limit)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		fmt.Fprintf(w, "No packages in %s match %q\n", client.URL, query)
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tVERSION\tDESCRIPTION")
+	for _, result := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", result.Name, result.Version, result.Description)
+	}
+	return tw.Flush()
+}
+
+// PackageInfo prints what the registry says about a package, spec being
+// its name or name@version; the dependencies shown are those of that
+// version, or of the latest.
+func (pm *PackageManager) PackageInfo(w io.Writer, spec string) error {
+	name, requirement := splitPackageSpec(spec)
+	client, err := pm.registryClient(name)
+	if err != nil {
+		return err
+	}
+	meta, err := client.Metadata(name)
+	if err != nil {
+		return err
+	}
+	version, err := meta.Resolve(requirement)
+	if err != nil {
+		return err
+	}
+
+	versions := make([]string, 0, len(meta.Versions))
+	for v := range meta.Versions {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(a, b int) bool { return compareVersions(versions[a], versions[b]) > 0 })
+	title := meta.Name + "@" + version
+	if meta.Name == "" {
+		title = name + "@" + version
+	}
+	fmt.Fprintf(w, "\n%s\n%s\n", title, strings.Repeat("=", len(title)))
+	if meta.Description != "" {
+		fmt.Fprintf(w, "Description: %s\n", meta.Description)
+	}
+	license := meta.License
+	if license == "" {
+		license = "unknown"
+	}
+	fmt.Fprintf(w, "License: %s\n", license)
+	if meta.Latest != "" {
+		fmt.Fprintf(w, "Latest: %s\n", meta.Latest)
+	}
+	fmt.Fprintf(w, "Versions: %s\n", strings.Join(versions, ", "))
+	deps := meta.Versions[version].Dependencies
+	if len(deps) == 0 {
+		fmt.Fprintln(w, "Dependencies: none")
+		return nil
+	}
+	names := make([]string, 0, len(deps))
+	for dep := range deps {
+		names = append(names, dep)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(w, "Dependencies:")
+	for _, dep := range names {
+		fmt.Fprintf(w, "  %s %s\n", dep, deps[dep])
+	}
+	return nil
+}
+
+// splitPackageSpec splits name@version, where name may be scoped, as in
+// @corp/log@1.0.0. The version is "" when spec has none.
+func splitPackageSpec(spec string) (name, version string) {
+	if at := strings.LastIndex(spec, "@"); at > 0 {
+		return spec[:at], spec[at+1:]
+	}
+	return spec, ""
+}
+
+// SearchCommand runs `strataum search <query> [--limit=N]`.
+func SearchCommand(pm *PackageManager, args []string, w io.Writer) error {
+	limit := 20
+	var terms []string
+	for _, arg := range args {
+		name, value, _ := strings.Cut(arg, "=")
+		switch {
+		case name == "--limit":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid --limit: %s", value)
+			}
+			limit = n
+		case strings.HasPrefix(arg, "-"):
+			return fmt.Errorf("unknown flag: %s", arg)
+		default:
+			terms = append(terms, arg)
+		}
+	}
+	if len(terms) == 0 {
+		return fmt.Errorf("usage: strataum search <query> [--limit=N]")
+	}
+	return pm.Search(w, strings.Join(terms, " "), limit)
+}
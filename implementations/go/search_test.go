@@ -0,0 +1,63 @@
+package strata
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSearchAndPackageInfo(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("q") != "color" || r.URL.Query().Get("limit") != "5" {
+			t.Errorf("searched with %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(`{"results": [{"name": "colors", "version": "1.2.0", "description": "Terminal colors"}]}`))
+	})
+	mux.HandleFunc("/packages/colors", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name": "colors", "description": "Terminal colors", "license": "MIT", "latest": "1.2.0",
+			"versions": {"1.0.0": {"tarball": "/a.tgz"},
+			             "1.2.0": {"tarball": "/b.tgz", "dependencies": {"ansi": "^2.0.0"}}}}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	t.Setenv("HOME", t.TempDir())
+	pm := NewPackageManager(t.TempDir())
+	pm.Strataumfile.Registry = server.URL
+
+	var out strings.Builder
+	if err := SearchCommand(pm, []string{"color", "--limit=5"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "colors") || !strings.Contains(out.String(), "Terminal colors") {
+		t.Errorf("search printed %q", out.String())
+	}
+
+	out.Reset()
+	if err := pm.PackageInfo(&out, "colors"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"colors@1.2.0", "License: MIT", "Versions: 1.2.0, 1.0.0", "  ansi ^2.0.0"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("info printed %q, want %q", out.String(), want)
+		}
+	}
+	out.Reset()
+	if err := pm.PackageInfo(&out, "colors@1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Dependencies: none") {
+		t.Errorf("info of 1.0.0 printed %q", out.String())
+	}
+	if err := pm.PackageInfo(&out, "missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("info of a missing package gave %v", err)
+	}
+
+	pm.Strataumfile.Registry = server.URL + "/old"
+	pm.registries = nil
+	if err := pm.Search(&out, "color", 5); err == nil || !strings.Contains(err.Error(), "does not support search") {
+		t.Errorf("search without the endpoint gave %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package strata
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// ============================================================================
+// SLICING - String indexing and `s[start:end]` slices of strings and lists
+// ============================================================================
+
+// Strings are indexed and sliced by rune, so a multi-byte character is never
+// split: "héllo"[1] is "é" and "héllo"[1:3] is "él".
+
+// runeAt reads the character at pos of s as a one-rune string.
+func runeAt(s string, index interface{}) (interface{}, error) {
+	runes := []rune(s)
+	pos, err := stringPosition(index, len(runes))
+	if err != nil {
+		return nil, err
+	}
+	return string(runes[pos]), nil
+}
+
+// sliceBounds resolves the bounds of a slice of a value of length n. A
+// missing start is 0 and a missing end is n.
+func sliceBounds(start, end interface{}, n int) (int, int, error) {
+	from, to := int64(0), int64(n)
+	for idx, bound := range []interface{}{start, end} {
+		if bound == nil {
+			continue
+		}
+		value, ok := bound.(int64)
+		if !ok {
+			return 0, 0, newError(ErrIndex, "slice bounds must be int, got %s", describeValue(bound))
+		}
+		if idx == 0 {
+			from = value
+		} else {
+			to = value
+		}
+	}
+	if from < 0 || to > int64(n) || from > to {
+		return 0, 0, newError(ErrIndex, "slice [%d:%d] out of range for length %d", from, to, n)
+	}
+	return int(from), int(to), nil
+}
+
+// sliceValue evaluates obj[start:end].
+func sliceValue(obj, start, end interface{}) (interface{}, error) {
+	switch v := obj.(type) {
+	case string:
+		runes := []rune(v)
+		from, to, err := sliceBounds(start, end, len(runes))
+		if err != nil {
+			return nil, err
+		}
+		return string(runes[from:to]), nil
+	case []interface{}:
+		from, to, err := sliceBounds(start, end, len(v))
+		if err != nil {
+			return nil, err
+		}
+		return append([]interface{}{}, v[from:to]...), nil
+	case []string:
+		from, to, err := sliceBounds(start, end, len(v))
+		if err != nil {
+			return nil, err
+		}
+		return append([]string{}, v[from:to]...), nil
+	case Bytes:
+		from, to, err := sliceBounds(start, end, len(v))
+		if err != nil {
+			return nil, err
+		}
+		return append(Bytes{}, v[from:to]...), nil
+	}
+	return nil, newError(ErrIndex, "cannot slice %s", describeValue(obj))
+}
+
+// substring is the substr builtin: the runes of s from start up to end,
+// with the bounds clamped to the string.
+func substring(s string, start, end int64) string {
+	runes := []rune(s)
+	from, to := clampRange(start, end, len(runes))
+	return string(runes[from:to])
+}
+
+// runeIndex is the rune position of the first substr in s, or -1.
+func runeIndex(s, substr string) int64 {
+	pos := strings.Index(s, substr)
+	if pos < 0 {
+		return -1
+	}
+	return int64(utf8.RuneCountInString(s[:pos]))
+}
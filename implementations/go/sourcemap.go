@@ -0,0 +1,125 @@
+package strata
+
+import (
+	"sort"
+	"strings"
+)
+
+// ============================================================================
+// SOURCE MAPS - Tracing generated code back to the Strata it came from
+// ============================================================================
+
+// Each generator notes the location of the statement it is generating
+// against every line it writes. `strata build` saves the result as JSON
+// next to the generated program, out.js.map for out.js, so that an error a
+// JavaScript engine, a C compiler or a debugger reports at a line of the
+// output can be traced to the line of the .str file behind it:
+//
+//	{"file": "out.js", "source": "main.str", "mappings": [
+//	  {"line": 4, "sourceLine": 2, "sourceColumn": 1}, ...]}
+//
+// Lines without a mapping, such as includes and the runtime import, were
+// not generated from any statement.
+
+// SourceMap maps lines of a generated file to the Strata source.
+type SourceMap struct {
+	// File is the generated file and Source the Strata module, relative
+	// to the map.
+	File     string        `json:"file"`
+	Source   string        `json:"source"`
+	Mappings []LineMapping `json:"mappings"`
+}
+
+// LineMapping maps a line of generated code, counting from 1, to where
+// in the source the statement it was generated from starts.
+type LineMapping struct {
+	Line         int `json:"line"`
+	SourceLine   int `json:"sourceLine"`
+	SourceColumn int `json:"sourceColumn"`
+}
+
+// Lookup returns where the code at a line of the generated file came from.
+func (m *SourceMap) Lookup(line int) (Location, bool) {
+	idx := sort.Search(len(m.Mappings), func(idx int) bool { return m.Mappings[idx].Line >= line })
+	if idx == len(m.Mappings) || m.Mappings[idx].Line != line {
+		return Location{}, false
+	}
+	return Location{Line: m.Mappings[idx].SourceLine, Column: m.Mappings[idx].SourceColumn}, true
+}
+
+// lineMap records, for a generator, the location of the statement each
+// line it writes was generated from.
+type lineMap struct {
+	at    Location
+	lines map[int]Location
+}
+
+func (m *lineMap) reset() {
+	m.at = Location{}
+	m.lines = make(map[int]Location)
+}
+
+// track attributes the lines written from now to loc, until the function
+// it returns restores the previous location. Statements nest, so generators
+// defer that to the end of each.
+func (m *lineMap) track(loc Location) func() {
+	prev := m.at
+	if loc.Line > 0 {
+		m.at = loc
+	}
+	return func() { m.at = prev }
+}
+
+// mark attributes the line with the given key to the current location.
+func (m *lineMap) mark(key int) {
+	if m.lines != nil && m.at.Line > 0 {
+		m.lines[key] = m.at
+	}
+}
+
+// sourceMap builds the map, lineOf giving the line of the output a key
+// marked, or 0 if it is not in the output.
+func (m *lineMap) sourceMap(lineOf func(key int) int) *SourceMap {
+	mappings := []LineMapping{}
+	for key, loc := range m.lines {
+		if lineOf(key) == 0 {
+			continue
+		}
+		mappings = append(mappings, LineMapping{Line: lineOf(key), SourceLine: loc.Line, SourceColumn: loc.Column})
+	}
+	sort.Slice(mappings, func(a, b int) bool { return mappings[a].Line < mappings[b].Line })
+	return &SourceMap{Mappings: mappings}
+}
+
+// codeLines maps the index of each entry of code, some of which may hold
+// several lines, to the line of the joined output it starts on, or to 0
+// for an entry since dropped.
+func codeLines(code []string) func(idx int) int {
+	starts := make([]int, len(code))
+	line := 1
+	for idx, text := range code {
+		starts[idx] = line
+		line += 1 + strings.Count(text, "\n")
+	}
+	return func(idx int) int {
+		if idx >= len(starts) {
+			return 0
+		}
+		return starts[idx]
+	}
+}
+
+// SourceMap maps the C the last Generate returned to its source.
+func (g *CGenerator) SourceMap() *SourceMap {
+	return g.sourceMap(codeLines(g.code))
+}
+
+// SourceMap maps the JavaScript the last Generate returned to its source.
+func (g *JSGenerator) SourceMap() *SourceMap {
+	return g.sourceMap(codeLines(g.code))
+}
+
+// SourceMap maps the IR the last Generate returned to its source.
+func (g *LLVMGenerator) SourceMap() *SourceMap {
+	return g.sourceMap(func(key int) int { return g.prelude + key + 1 })
+}
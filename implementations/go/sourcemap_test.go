@@ -0,0 +1,76 @@
+package strata
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSourceMapsPointBackToStatements(t *testing.T) {
+	source := `import io from std::io
+func twice(n: int) => int {
+  let doubled: int = n * 2
+  return doubled
+}
+var total: int = 0
+var i: int = 0
+while (i < 3) {
+  if (i == 1) {
+    io.print("marker")
+  }
+  total = total + twice(i)
+  i = i + 1
+}
+`
+	statements, err := ParseSource(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewCGenerator()
+	cCode, err := c.Generate(statements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	js := NewJSGenerator()
+	jsCode, err := js.Generate(statements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	llvm := NewLLVMGenerator()
+	llvmCode, err := llvm.Generate(statements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each backend writes the print, the doubling and the sum its own way.
+	type marker struct {
+		text string
+		line int
+	}
+	cMarkers := []marker{{`"marker"`, 10}, {"* 2", 3}, {"total + twice", 12}}
+	for _, tc := range []struct {
+		name    string
+		code    string
+		m       *SourceMap
+		markers []marker
+	}{
+		{"c", cCode, c.SourceMap(), cMarkers},
+		{"js", jsCode, js.SourceMap(), cMarkers},
+		{"llvm", llvmCode, llvm.SourceMap(), []marker{{"@strata_print", 10}, {"smul", 3}, {"@var.total", 12}}},
+	} {
+		lines := strings.Split(tc.code, "\n")
+		for _, want := range tc.markers {
+			found := false
+			for idx, text := range lines {
+				if !strings.Contains(text, want.text) {
+					continue
+				}
+				if loc, ok := tc.m.Lookup(idx + 1); ok && loc.Line == want.line {
+					found = true
+					break
+				}
+			}
+			if !found {
+				t.Errorf("%s: no line with %s maps to line %d:\n%s\n%+v", tc.name, want.text, want.line, tc.code, tc.m.Mappings)
+			}
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package strata
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ============================================================================
+// STDIN - input(), readLine() and io.readAll() for interactive scripts
+// ============================================================================
+
+// stdinReader buffers the interpreter's standard input. It is created on the
+// first read so that replacing Stdin before running a script takes effect.
+func (i *Interpreter) stdinReader() *bufio.Reader {
+	if i.stdin == nil {
+		i.stdin = bufio.NewReader(i.Stdin)
+	}
+	return i.stdin
+}
+
+// readLine reads the next line of standard input without its line ending. At
+// the end of input it returns nil, or the last line if it is unterminated.
+func (i *Interpreter) readLine() interface{} {
+	line, err := i.stdinReader().ReadString('\n')
+	if err != nil && line == "" {
+		return nil
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+}
+
+// readAll reads the rest of standard input.
+func (i *Interpreter) readAll() string {
+	data, _ := io.ReadAll(i.stdinReader())
+	return string(data)
+}
+
+func stdinBuiltins(i *Interpreter) map[string]func([]interface{}) interface{} {
+	return map[string]func([]interface{}) interface{}{
+		"input": func(args []interface{}) interface{} {
+			if len(args) > 0 {
+				fmt.Fprint(i.Stdout, displayValue(args[0]))
+			}
+			return i.readLine()
+		},
+		"readLine": func(args []interface{}) interface{} { return i.readLine() },
+	}
+}
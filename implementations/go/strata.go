@@ -0,0 +1,144 @@
+// Package strata implements the Strata language: its lexer, parser, type
+// checker, interpreter and standard library, and the strata command line
+// built on them. Go programs embed the language through Run and New.
+//
+// The stages still share this one package; there are no separate lexer,
+// parser, types and interp packages yet. Splitting them needs the state
+// they share exported first: the resolver's slots on the AST, which the
+// interpreter and the code generators read, and the checker and runtime
+// halves of files such as classes.go and calls.go.
+package strata
+
+import "errors"
+
+// ============================================================================
+// EMBEDDING - Run and Engine, for Go programs that host Strata code
+// ============================================================================
+
+// Run parses, checks and executes src with default options, writing the
+// script's output to os.Stdout.
+func Run(src string) error {
+	return RunSource(src, RunOptions{})
+}
+
+// Engine is an interpreter that lives across calls. Everything Exec runs
+// shares one global scope, so later code sees the variables, functions and
+// imports of earlier code, and the host can read and set globals between
+// calls.
+type Engine struct {
+	interp        *Interpreter
+	checker       *TypeChecker
+	skipTypeCheck bool
+}
+
+// New returns an Engine configured by opts. Args, MaxSteps, the sandbox and
+// the other interpreter options apply to everything it runs.
+func New(opts RunOptions) *Engine {
+	interp := NewInterpreter()
+	opts.Configure(interp)
+	return &Engine{interp: interp, checker: NewTypeChecker(), skipTypeCheck: opts.SkipTypeCheck}
+}
+
+// parse parses and checks src against what the engine has run so far.
+func (e *Engine) parse(src string) ([]*Stmt, error) {
+	statements, err := ParseSource(src)
+	if err != nil {
+		return nil, err
+	}
+	if !e.skipTypeCheck {
+		if err := e.checker.Check(statements); err != nil {
+			return nil, err
+		}
+	}
+	return statements, nil
+}
+
+// recover puts the interpreter back at the top level after a failed or
+// returning run, keeping the globals it defined.
+func (e *Engine) recover() {
+	e.interp.CallStack = nil
+	e.interp.ControlFlow = ControlFlow{Type: CFNone}
+	e.interp.Env = e.interp.rootEnv()
+}
+
+// Exec runs src in the engine's global scope. It never panics.
+func (e *Engine) Exec(src string) (err error) {
+	defer recoverInternalError(&err)
+	defer e.recover()
+	statements, err := e.parse(src)
+	if err != nil {
+		return err
+	}
+	return e.interp.Interpret(statements)
+}
+
+// Eval evaluates a single expression in the global scope and returns its
+// value.
+func (e *Engine) Eval(src string) (value interface{}, err error) {
+	defer recoverInternalError(&err)
+	defer e.recover()
+	statements, err := e.parse(src)
+	if err != nil {
+		return nil, err
+	}
+	if len(statements) != 1 || statements[0].Kind != StmtExpression {
+		return nil, errors.New("only expressions can be evaluated")
+	}
+	e.interp.Location = statements[0].Location
+	if value, err = e.interp.evaluateExpression(statements[0].Expr); err != nil {
+		return nil, err
+	}
+	return value, e.interp.pendingThrow()
+}
+
+// Call calls the global function name, a Strata function or one the host
+// set, with args.
+func (e *Engine) Call(name string, args ...interface{}) (value interface{}, err error) {
+	defer recoverInternalError(&err)
+	defer e.recover()
+	fn, ok := e.Get(name)
+	if !ok {
+		return nil, newError(ErrUndefined, "undefined function: %s", name)
+	}
+	values := make([]interface{}, len(args))
+	for idx, arg := range args {
+		values[idx] = fromGo(arg)
+	}
+	if value, err = e.interp.callValue(name, fn, values); err != nil {
+		return nil, err
+	}
+	return value, e.interp.pendingThrow()
+}
+
+// Get returns the value of the global variable or function name.
+func (e *Engine) Get(name string) (interface{}, bool) {
+	root := e.interp.rootEnv()
+	if fn := root.GetFunction(name); fn != nil {
+		return fn, true
+	}
+	value, err := root.Get(name)
+	return value, err == nil
+}
+
+// Set defines or replaces the global variable name. Go ints and float32s
+// become Strata ints and floats, and a Go function with NativeFunc's
+// signature becomes callable from Strata.
+func (e *Engine) Set(name string, value interface{}) {
+	e.interp.rootEnv().Set(name, fromGo(value), true)
+}
+
+// fromGo converts the Go values hosts commonly pass into the types the
+// interpreter works with.
+func fromGo(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case float32:
+		return float64(v)
+	case func(args []interface{}) (interface{}, error):
+		return NativeFunc(v)
+	}
+	return value
+}
@@ -0,0 +1,42 @@
+package strata
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEngineKeepsGlobalsAcrossCalls(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	var out strings.Builder
+	engine := New(RunOptions{Stdout: &out})
+	engine.Set("scale", 10)
+	engine.Set("shout", func(args []interface{}) (interface{}, error) {
+		return strings.ToUpper(args[0].(string)), nil
+	})
+	if err := engine.Exec("func add(a: int, b: int) => int {\n  return (a + b) * scale\n}\nvar calls: int = 0\n"); err != nil {
+		t.Fatal(err)
+	}
+	args := []interface{}{1, 2}
+	got, err := engine.Call("add", args...)
+	if err != nil || got != int64(30) {
+		t.Fatalf("add(1, 2) = %v, %v", got, err)
+	}
+	if args[0] != 1 || args[1] != 2 {
+		t.Errorf("Call rewrote the caller's arguments to %#v", args)
+	}
+	if got, err := engine.Call("shout", "hi"); err != nil || got != "HI" {
+		t.Errorf("shout(\"hi\") = %v, %v", got, err)
+	}
+	if err := engine.Exec("import io from std::io\ncalls = calls + 1\nio.print(add(2, 2))\n"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := engine.Eval("calls + 1"); err != nil || got != int64(2) {
+		t.Errorf("calls + 1 = %v, %v", got, err)
+	}
+	if out.String() != "40\n" {
+		t.Errorf("printed %q", out.String())
+	}
+	if _, err := engine.Call("missing"); err == nil {
+		t.Error("calling an undefined function succeeded")
+	}
+}
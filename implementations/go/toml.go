@@ -0,0 +1,649 @@
+package strata
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ============================================================================
+// STD::TOML - Parsing and writing TOML documents
+// ============================================================================
+
+// A document parses to a map. Tables and inline tables become maps, arrays
+// become lists, and dates and times are kept as strings.
+
+func tomlModule() map[string]interface{} {
+	return map[string]interface{}{
+		"parse": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("parse", args, 1); err != nil {
+				return nil, err
+			}
+			return ParseTOML(toString(args[0]))
+		}),
+		"stringify": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("stringify", args, 1); err != nil {
+				return nil, err
+			}
+			return StringifyTOML(args[0])
+		}),
+	}
+}
+
+type tomlParser struct {
+	src  string
+	pos  int
+	line int
+}
+
+// ParseTOML parses a TOML document into a map.
+func ParseTOML(src string) (map[string]interface{}, error) {
+	p := &tomlParser{src: src, line: 1}
+	root := make(map[string]interface{})
+	current := root
+	for {
+		p.skipBlank(true)
+		if p.eof() {
+			return root, nil
+		}
+		if p.peek() == '[' {
+			array := strings.HasPrefix(p.src[p.pos:], "[[")
+			p.pos++
+			if array {
+				p.pos++
+			}
+			path, err := p.key()
+			if err != nil {
+				return nil, err
+			}
+			closing := "]"
+			if array {
+				closing = "]]"
+			}
+			if !strings.HasPrefix(p.src[p.pos:], closing) {
+				return nil, p.errorf("expected %s after table name", closing)
+			}
+			p.pos += len(closing)
+			if current, err = p.openTable(root, path, array); err != nil {
+				return nil, err
+			}
+		} else if err := p.keyValue(current); err != nil {
+			return nil, err
+		}
+		if err := p.endOfLine(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *tomlParser) errorf(format string, args ...interface{}) *StrataError {
+	return newError(ErrSyntax, "toml: line %d: "+format, append([]interface{}{p.line}, args...)...)
+}
+
+func (p *tomlParser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *tomlParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+// skipBlank skips spaces, tabs and comments, and newlines too if newlines is
+// set.
+func (p *tomlParser) skipBlank(newlines bool) {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '\n' && newlines:
+			p.pos++
+			p.line++
+		case c == '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) endOfLine() error {
+	p.skipBlank(false)
+	if p.eof() {
+		return nil
+	}
+	if p.peek() != '\n' {
+		return p.errorf("unexpected %q after value", p.peek())
+	}
+	return nil
+}
+
+// key parses a possibly dotted key.
+func (p *tomlParser) key() ([]string, error) {
+	var path []string
+	for {
+		p.skipBlank(false)
+		var part string
+		switch c := p.peek(); {
+		case c == '"' || c == '\'':
+			s, err := p.stringValue()
+			if err != nil {
+				return nil, err
+			}
+			part = s
+		default:
+			start := p.pos
+			for !p.eof() && isBareKeyChar(p.peek()) {
+				p.pos++
+			}
+			if start == p.pos {
+				return nil, p.errorf("expected a key")
+			}
+			part = p.src[start:p.pos]
+		}
+		path = append(path, part)
+		p.skipBlank(false)
+		if p.peek() != '.' {
+			return path, nil
+		}
+		p.pos++
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *tomlParser) keyValue(table map[string]interface{}) error {
+	path, err := p.key()
+	if err != nil {
+		return err
+	}
+	if p.peek() != '=' {
+		return p.errorf("expected = after key %s", strings.Join(path, "."))
+	}
+	p.pos++
+	p.skipBlank(false)
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+	parent, err := p.descend(table, path[:len(path)-1])
+	if err != nil {
+		return err
+	}
+	name := path[len(path)-1]
+	if _, exists := parent[name]; exists {
+		return p.errorf("duplicate key %s", strings.Join(path, "."))
+	}
+	parent[name] = value
+	return nil
+}
+
+// descend walks path from table, creating missing tables. A path through an
+// array of tables continues in its last table.
+func (p *tomlParser) descend(table map[string]interface{}, path []string) (map[string]interface{}, error) {
+	for idx, name := range path {
+		switch next := table[name].(type) {
+		case nil:
+			created := make(map[string]interface{})
+			table[name] = created
+			table = created
+		case map[string]interface{}:
+			table = next
+		case []interface{}:
+			last, ok := lastTable(next)
+			if !ok {
+				return nil, p.errorf("key %s is not a table", strings.Join(path[:idx+1], "."))
+			}
+			table = last
+		default:
+			return nil, p.errorf("key %s is not a table", strings.Join(path[:idx+1], "."))
+		}
+	}
+	return table, nil
+}
+
+func lastTable(list []interface{}) (map[string]interface{}, bool) {
+	if len(list) == 0 {
+		return nil, false
+	}
+	last, ok := list[len(list)-1].(map[string]interface{})
+	return last, ok
+}
+
+// openTable returns the table a [header] or [[header]] line starts.
+func (p *tomlParser) openTable(root map[string]interface{}, path []string, array bool) (map[string]interface{}, error) {
+	if !array {
+		return p.descend(root, path)
+	}
+	parent, err := p.descend(root, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	name := path[len(path)-1]
+	table := make(map[string]interface{})
+	switch existing := parent[name].(type) {
+	case nil:
+		parent[name] = []interface{}{table}
+	case []interface{}:
+		parent[name] = append(existing, table)
+	default:
+		return nil, p.errorf("key %s is not an array of tables", strings.Join(path, "."))
+	}
+	return table, nil
+}
+
+func (p *tomlParser) value() (interface{}, error) {
+	switch c := p.peek(); c {
+	case '"', '\'':
+		return p.stringValue()
+	case '[':
+		return p.array()
+	case '{':
+		return p.inlineTable()
+	case 0:
+		return nil, p.errorf("expected a value")
+	}
+	start := p.pos
+	for !p.eof() && !strings.ContainsRune(" \t\r\n,]}#", rune(p.peek())) {
+		p.pos++
+	}
+	// a date and time may be separated by a space
+	if token := p.src[start:p.pos]; isTOMLDate(token) && p.peek() == ' ' && p.pos+1 < len(p.src) && isDigit(rune(p.src[p.pos+1])) {
+		p.pos++
+		for !p.eof() && !strings.ContainsRune(" \t\r\n,]}#", rune(p.peek())) {
+			p.pos++
+		}
+	}
+	return p.scalar(p.src[start:p.pos])
+}
+
+func isTOMLDate(token string) bool {
+	return len(token) >= 10 && isDigit(rune(token[0])) && token[4] == '-' && token[7] == '-'
+}
+
+func (p *tomlParser) scalar(token string) (interface{}, error) {
+	switch token {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "inf", "+inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	case "nan", "+nan", "-nan":
+		return math.NaN(), nil
+	}
+	if isTOMLDate(token) || len(token) >= 8 && token[2] == ':' && token[5] == ':' {
+		return token, nil
+	}
+	digits := strings.ReplaceAll(token, "_", "")
+	for prefix, base := range map[string]int{"0x": 16, "0o": 8, "0b": 2} {
+		if strings.HasPrefix(digits, prefix) {
+			if n, err := strconv.ParseInt(digits[2:], base, 64); err == nil {
+				return n, nil
+			}
+			return nil, p.errorf("invalid number %s", token)
+		}
+	}
+	if n, err := strconv.ParseInt(digits, 10, 64); err == nil {
+		return n, nil
+	}
+	if strings.ContainsAny(digits, ".eE") {
+		if f, err := strconv.ParseFloat(digits, 64); err == nil {
+			return f, nil
+		}
+	}
+	return nil, p.errorf("invalid value %s", token)
+}
+
+// stringValue parses a basic, literal or multi-line string.
+func (p *tomlParser) stringValue() (string, error) {
+	quote := p.peek()
+	literal := quote == '\''
+	delim := string(quote)
+	if strings.HasPrefix(p.src[p.pos:], strings.Repeat(delim, 3)) {
+		delim = strings.Repeat(delim, 3)
+		p.pos += 3
+		// a newline right after the opening delimiter is trimmed
+		if strings.HasPrefix(p.src[p.pos:], "\r\n") {
+			p.pos += 2
+			p.line++
+		} else if p.peek() == '\n' {
+			p.pos++
+			p.line++
+		}
+	} else {
+		p.pos++
+	}
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		if strings.HasPrefix(p.src[p.pos:], delim) {
+			// a multi-line string may end with up to two quotes of its own
+			run := len(p.src[p.pos:]) - len(strings.TrimLeft(p.src[p.pos:], string(quote)))
+			if extra := run - len(delim); len(delim) == 3 && extra > 0 {
+				if extra > 2 {
+					extra = 2
+				}
+				b.WriteString(strings.Repeat(string(quote), extra))
+				p.pos += extra
+			}
+			p.pos += len(delim)
+			return b.String(), nil
+		}
+		c := p.peek()
+		switch {
+		case c == '\n' && len(delim) == 1:
+			return "", p.errorf("newline in string")
+		case c == '\n':
+			p.line++
+		case c == '\\' && !literal:
+			if len(delim) == 3 && p.lineEndingBackslash() {
+				continue
+			}
+			r, n, err := unescapeSequence(p.src[p.pos:])
+			if err != nil {
+				return "", p.errorf("%v", err)
+			}
+			b.WriteRune(r)
+			p.pos += n
+			continue
+		}
+		b.WriteByte(c)
+		p.pos++
+	}
+}
+
+// lineEndingBackslash skips a backslash at the end of a line in a multi-line
+// basic string, with the whitespace and newlines that follow it.
+func (p *tomlParser) lineEndingBackslash() bool {
+	rest := strings.TrimLeft(p.src[p.pos+1:], " \t\r")
+	if !strings.HasPrefix(rest, "\n") {
+		return false
+	}
+	p.pos = len(p.src) - len(rest)
+	for !p.eof() && strings.ContainsRune(" \t\r\n", rune(p.peek())) {
+		if p.peek() == '\n' {
+			p.line++
+		}
+		p.pos++
+	}
+	return true
+}
+
+func (p *tomlParser) array() ([]interface{}, error) {
+	p.pos++
+	items := []interface{}{}
+	for {
+		p.skipBlank(true)
+		if p.peek() == ']' {
+			p.pos++
+			return items, nil
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, value)
+		p.skipBlank(true)
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return nil, p.errorf("expected , or ] in array")
+		}
+	}
+}
+
+func (p *tomlParser) inlineTable() (map[string]interface{}, error) {
+	p.pos++
+	table := make(map[string]interface{})
+	p.skipBlank(false)
+	if p.peek() == '}' {
+		p.pos++
+		return table, nil
+	}
+	for {
+		if err := p.keyValue(table); err != nil {
+			return nil, err
+		}
+		p.skipBlank(false)
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return table, nil
+		default:
+			return nil, p.errorf("expected , or } in inline table")
+		}
+	}
+}
+
+// unescapeSequence decodes the backslash escape at the start of s, as used
+// by TOML basic strings and YAML double-quoted strings, and returns the
+// number of bytes it spans.
+func unescapeSequence(s string) (rune, int, error) {
+	if len(s) < 2 {
+		return 0, 0, newError(ErrSyntax, "unterminated escape")
+	}
+	simple := map[byte]rune{
+		'b': '\b', 't': '\t', 'n': '\n', 'f': '\f', 'r': '\r', '"': '"', '\\': '\\',
+		'/': '/', '0': 0, 'a': '\a', 'v': '\v', 'e': 0x1b, ' ': ' ', '\'': '\'',
+	}
+	if r, ok := simple[s[1]]; ok {
+		return r, 2, nil
+	}
+	width := map[byte]int{'x': 2, 'u': 4, 'U': 8}[s[1]]
+	if width == 0 || len(s) < 2+width {
+		return 0, 0, newError(ErrSyntax, "invalid escape \\%c", s[1])
+	}
+	code, err := strconv.ParseUint(s[2:2+width], 16, 32)
+	if err != nil || !utf8.ValidRune(rune(code)) {
+		return 0, 0, newError(ErrSyntax, "invalid escape %s", s[:2+width])
+	}
+	return rune(code), 2 + width, nil
+}
+
+// StringifyTOML writes a map as a TOML document. Nested maps become tables
+// and lists of maps become arrays of tables.
+func StringifyTOML(value interface{}) (string, error) {
+	table, ok := value.(map[string]interface{})
+	if !ok {
+		return "", newError(ErrTypeMismatch, "toml: a document must be a map, got %s", describeValue(value))
+	}
+	var b strings.Builder
+	if err := writeTOMLTable(&b, nil, table); err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(b.String(), "\n"), nil
+}
+
+func writeTOMLTable(b *strings.Builder, path []string, table map[string]interface{}) error {
+	keys := make([]string, 0, len(table))
+	for key := range table {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var tables, arrays []string
+	for _, key := range keys {
+		switch v := table[key].(type) {
+		case map[string]interface{}:
+			tables = append(tables, key)
+			continue
+		case []interface{}:
+			if isTableArray(v) {
+				arrays = append(arrays, key)
+				continue
+			}
+		}
+		encoded, err := tomlValue(table[key])
+		if err != nil {
+			return err
+		}
+		b.WriteString(tomlKey(key) + " = " + encoded + "\n")
+	}
+	for _, key := range tables {
+		sub := append(append([]string{}, path...), key)
+		// a table holding only tables needs no header of its own
+		if !onlyTables(table[key].(map[string]interface{})) {
+			b.WriteString("\n[" + tomlPath(sub) + "]\n")
+		}
+		if err := writeTOMLTable(b, sub, table[key].(map[string]interface{})); err != nil {
+			return err
+		}
+	}
+	for _, key := range arrays {
+		sub := append(append([]string{}, path...), key)
+		for _, item := range table[key].([]interface{}) {
+			b.WriteString("\n[[" + tomlPath(sub) + "]]\n")
+			if err := writeTOMLTable(b, sub, item.(map[string]interface{})); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func onlyTables(table map[string]interface{}) bool {
+	for _, value := range table {
+		if _, ok := value.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	return len(table) > 0
+}
+
+func isTableArray(list []interface{}) bool {
+	for _, item := range list {
+		if _, ok := item.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	return len(list) > 0
+}
+
+func tomlPath(path []string) string {
+	parts := make([]string, len(path))
+	for idx, key := range path {
+		parts[idx] = tomlKey(key)
+	}
+	return strings.Join(parts, ".")
+}
+
+func tomlKey(key string) string {
+	for idx := 0; idx < len(key); idx++ {
+		if !isBareKeyChar(key[idx]) {
+			return tomlString(key)
+		}
+	}
+	if key == "" {
+		return `""`
+	}
+	return key
+}
+
+// tomlString quotes s as a TOML basic string.
+func tomlString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r < 0x20 || r == 0x7f:
+			b.WriteString(`\u` + strconv.FormatInt(int64(r)+0x10000, 16)[1:])
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// tomlValue encodes a value on the right of =, writing maps inline.
+func tomlValue(v interface{}) (string, error) {
+	switch val := v.(type) {
+	case string:
+		return tomlString(val), nil
+	case bool:
+		return strconv.FormatBool(val), nil
+	case float64:
+		switch {
+		case math.IsNaN(val):
+			return "nan", nil
+		case math.IsInf(val, 1):
+			return "inf", nil
+		case math.IsInf(val, -1):
+			return "-inf", nil
+		}
+		return floatLiteral(val), nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for key := range val {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		parts := make([]string, len(keys))
+		for idx, key := range keys {
+			encoded, err := tomlValue(val[key])
+			if err != nil {
+				return "", err
+			}
+			parts[idx] = tomlKey(key) + " = " + encoded
+		}
+		if len(parts) == 0 {
+			return "{}", nil
+		}
+		return "{ " + strings.Join(parts, ", ") + " }", nil
+	}
+	if isInteger(v) {
+		return strconv.FormatInt(toInt(v), 10), nil
+	}
+	if items, ok := sequenceItems(v); ok {
+		parts := make([]string, len(items))
+		for idx, item := range items {
+			encoded, err := tomlValue(item)
+			if err != nil {
+				return "", err
+			}
+			parts[idx] = encoded
+		}
+		return "[" + strings.Join(parts, ", ") + "]", nil
+	}
+	return "", newError(ErrTypeMismatch, "toml: cannot encode %s", describeValue(v))
+}
+
+// floatLiteral formats f so that it reads back as a float, not an int.
+func floatLiteral(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eEn") {
+		s += ".0"
+	}
+	return s
+}
+
+// sequenceItems returns the elements of a list or tuple.
+func sequenceItems(v interface{}) ([]interface{}, bool) {
+	if tuple, ok := v.(Tuple); ok {
+		return tuple, true
+	}
+	return listItems(v)
+}
@@ -0,0 +1,103 @@
+package strata
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	for _, tc := range []struct {
+		name, source string
+		want         map[string]interface{}
+	}{
+		{"scalars", "n = 42\nf = 1.5\nok = true\nhex = 0xff\nbig = 1_000", map[string]interface{}{
+			"n": int64(42), "f": 1.5, "ok": true, "hex": int64(255), "big": int64(1000)}},
+		{"quoted scalars stay strings", `zip = "007"` + "\n" + `nothing = "null"` + "\n" + `yes = "true"`, map[string]interface{}{
+			"zip": "007", "nothing": "null", "yes": "true"}},
+		{"basic and literal strings", `basic = "tab\there \u00e9"` + "\n" + `literal = 'C:\path\n'` + "\n" +
+			"multi = \"\"\"\nline one\nline two\"\"\"\nraw = '''\nno \\escapes'''", map[string]interface{}{
+			"basic": "tab\there é", "literal": `C:\path\n`, "multi": "line one\nline two", "raw": `no \escapes`}},
+		{"dotted keys and tables", "a.b = 1\n[server]\nhost = \"x\"\n[server.tls]\non = false\n[\"odd key\"]\nv = 1", map[string]interface{}{
+			"a":       map[string]interface{}{"b": int64(1)},
+			"server":  map[string]interface{}{"host": "x", "tls": map[string]interface{}{"on": false}},
+			"odd key": map[string]interface{}{"v": int64(1)}}},
+		{"arrays of tables", "[[fruit]]\nname = \"apple\"\n[[fruit]]\nname = \"pear\"\ntags = [\"a\", \"b\"]", map[string]interface{}{
+			"fruit": []interface{}{
+				map[string]interface{}{"name": "apple"},
+				map[string]interface{}{"name": "pear", "tags": []interface{}{"a", "b"}}}}},
+		{"inline tables and comments", "point = { x = 1, y = 2 } # origin-ish\n# a comment\n", map[string]interface{}{
+			"point": map[string]interface{}{"x": int64(1), "y": int64(2)}}},
+	} {
+		got, err := ParseTOML(tc.source)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %#v, want %#v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	for _, tc := range []struct{ source, message string }{
+		{"a = 1\na = 2", "line 2: duplicate key a"},
+		{"a = \"open", "line 1: unterminated string"},
+		{"a = 'x'\n[a]", "line 2: key a is not a table"},
+		{"= 1", "line 1: expected a key"},
+	} {
+		if _, err := ParseTOML(tc.source); err == nil || !strings.Contains(err.Error(), tc.message) {
+			t.Errorf("%q: got %v, want an error mentioning %q", tc.source, err, tc.message)
+		}
+	}
+}
+
+func TestStringifyTOML(t *testing.T) {
+	doc := map[string]interface{}{
+		"title":  "say \"hi\"\n",
+		"count":  int64(3),
+		"ratio":  2.0,
+		"zip":    "007",
+		"tags":   []interface{}{"a", int64(1)},
+		"owner":  map[string]interface{}{"name": "ann", "odd key": true},
+		"nested": map[string]interface{}{"inner": map[string]interface{}{"on": false}},
+		"fruit":  []interface{}{map[string]interface{}{"name": "apple"}, map[string]interface{}{"name": "pear"}},
+	}
+	text, err := StringifyTOML(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `count = 3
+ratio = 2.0
+tags = ["a", 1]
+title = "say \"hi\"\n"
+zip = "007"
+
+[nested.inner]
+on = false
+
+[owner]
+name = "ann"
+"odd key" = true
+
+[[fruit]]
+name = "apple"
+
+[[fruit]]
+name = "pear"
+`
+	if text != want {
+		t.Errorf("got\n%s\nwant\n%s", text, want)
+	}
+	back, err := ParseTOML(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back, doc) {
+		t.Errorf("the round trip gave %#v", back)
+	}
+	if _, err := StringifyTOML([]interface{}{int64(1)}); err == nil {
+		t.Error("a list stringified as a document")
+	}
+}
@@ -0,0 +1,75 @@
+package strata
+
+import "strings"
+
+// ============================================================================
+// TUPLES - Fixed-size immutable sequences and destructuring let
+// ============================================================================
+
+// Tuple is the runtime value of `(a, b)`. Unlike arrays its elements cannot
+// be reassigned.
+type Tuple []interface{}
+
+func (t Tuple) String() string {
+	parts := make([]string, len(t))
+	for idx, item := range t {
+		parts[idx] = formatElement(item)
+	}
+	if len(t) == 1 {
+		return "(" + parts[0] + ",)"
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+func tupleBuiltins() map[string]func([]interface{}) interface{} {
+	return map[string]func([]interface{}) interface{}{
+		"tuple": func(args []interface{}) interface{} { return Tuple(append([]interface{}(nil), args...)) },
+		"untuple": func(args []interface{}) interface{} {
+			t, ok := args[0].(Tuple)
+			if !ok {
+				return newError(ErrTypeMismatch, "untuple expects a tuple, got %s", describeValue(args[0]))
+			}
+			return append([]interface{}{}, t...)
+		},
+	}
+}
+
+// destructure binds the elements of a tuple or array to names, skipping `_`.
+func (i *Interpreter) destructure(names []string, value interface{}, mutable bool) error {
+	var items []interface{}
+	switch v := value.(type) {
+	case Tuple:
+		items = v
+	case []interface{}:
+		items = v
+	default:
+		return newError(ErrPattern, "cannot destructure %s", describeValue(value))
+	}
+	if len(items) != len(names) {
+		return newError(ErrPattern, "cannot destructure %d values into %d names", len(items), len(names))
+	}
+	for idx, name := range names {
+		if name != "_" {
+			i.Env.Set(name, items[idx], mutable)
+		}
+	}
+	return nil
+}
+
+func (tc *TypeChecker) checkDestructure(stmt *Stmt, declared TypeDef) error {
+	if err := tc.checkExpression(stmt.Value, declared); err != nil {
+		return err
+	}
+	actual := tc.inferType(stmt.Value)
+	if actual.Primitive == TypeTuple && actual.Types != nil && len(actual.Types) != len(stmt.Names) {
+		return newError(ErrPattern, "cannot destructure %d values into %d names", len(actual.Types), len(stmt.Names))
+	}
+	for idx, name := range stmt.Names {
+		elementType := TypeDef{Kind: KindPrimitive, Primitive: TypeAny}
+		if idx < len(actual.Types) {
+			elementType = actual.Types[idx]
+		}
+		tc.Env.Vars[name] = TypeEnvEntry{Type: elementType, Mutable: stmt.Mutable}
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package strata
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ============================================================================
+// USER CONFIG - Registries, tokens and proxies for strataum
+// ============================================================================
+
+// strataum reads per-user settings from ~/.strata/config, a JSON file that
+// `strataum login` and `strataum logout` maintain and that may be edited by
+// hand:
+//
+//	{"registry": "https://registry.corp.example",
+//	 "scopes": {"@corp": "https://packages.corp.example"},
+//	 "tokens": {"https://packages.corp.example": "..."},
+//	 "proxy": "http://proxy.corp.example:3128"}
+//
+// A package named @corp/... comes from the registry of its scope, any other
+// from the registry of the project's Strataumfile, else the registry here,
+// else DefaultRegistry. Requests to a registry carry its token. Without a
+// proxy here, the HTTPS_PROXY and NO_PROXY environment variables apply.
+
+// UserConfig is the user's strataum configuration.
+type UserConfig struct {
+	Registry string            `json:"registry,omitempty"`
+	Scopes   map[string]string `json:"scopes,omitempty"`
+	Tokens   map[string]string `json:"tokens,omitempty"`
+	Proxy    string            `json:"proxy,omitempty"`
+
+	path string
+}
+
+// LoadUserConfig reads ~/.strata/config, which need not exist.
+func LoadUserConfig() (*UserConfig, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("cannot find the user config: %v", err)
+	}
+	config := &UserConfig{path: filepath.Join(home, ".strata", "config")}
+	data, err := os.ReadFile(config.path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", config.path, err)
+	}
+	return config, nil
+}
+
+// Save writes the config back, readable only by the user as it holds
+// tokens.
+func (c *UserConfig) Save() error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+	data, _ := json.MarshalIndent(c, "", "  ")
+	if err := os.WriteFile(c.path, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Chmod(c.path, 0600)
+}
+
+// RegistryFor is the registry a package comes from in a project whose
+// Strataumfile names project, which may be "".
+func (c *UserConfig) RegistryFor(packageName, project string) string {
+	if scope, _, scoped := strings.Cut(packageName, "/"); scoped && c.Scopes[scope] != "" {
+		return normalizeRegistry(c.Scopes[scope])
+	}
+	switch {
+	case project != "":
+		return normalizeRegistry(project)
+	case c.Registry != "":
+		return normalizeRegistry(c.Registry)
+	}
+	return DefaultRegistry
+}
+
+func normalizeRegistry(registry string) string {
+	return strings.TrimSuffix(registry, "/")
+}
+
+// Client returns a client for a registry with the user's token for it,
+// going through the user's proxy.
+func (c *UserConfig) Client(registry string) (*RegistryClient, error) {
+	client := NewRegistryClient(registry)
+	client.Token = c.Tokens[client.URL]
+	if c.Proxy != "" {
+		proxy, err := url.Parse(c.Proxy)
+		if err != nil || proxy.Host == "" {
+			return nil, fmt.Errorf("invalid proxy %q in %s", c.Proxy, c.path)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = http.ProxyURL(proxy)
+		client.HTTP.Transport = transport
+	}
+	return client, nil
+}
+
+func (pm *PackageManager) userConfig() (*UserConfig, error) {
+	if pm.config == nil {
+		config, err := LoadUserConfig()
+		if err != nil {
+			return nil, err
+		}
+		pm.config = config
+	}
+	return pm.config, nil
+}
+
+// registryClient is the client for the registry a package comes from.
+func (pm *PackageManager) registryClient(packageName string) (*RegistryClient, error) {
+	config, err := pm.userConfig()
+	if err != nil {
+		return nil, err
+	}
+	registry := config.RegistryFor(packageName, pm.Strataumfile.Registry)
+	if client := pm.registries[registry]; client != nil {
+		return client, nil
+	}
+	client, err := config.Client(registry)
+	if err != nil {
+		return nil, err
+	}
+	if pm.registries == nil {
+		pm.registries = make(map[string]*RegistryClient)
+	}
+	pm.registries[registry] = client
+	return client, nil
+}
+
+// Login stores a token for a registry, by default the one the project's
+// unscoped packages come from. Given a scope such as @corp, packages of the
+// scope then come from that registry.
+func (pm *PackageManager) Login(registry, token, scope string) error {
+	config, err := pm.userConfig()
+	if err != nil {
+		return err
+	}
+	if registry == "" {
+		registry = config.RegistryFor("", pm.Strataumfile.Registry)
+	}
+	registry = normalizeRegistry(registry)
+	u, err := url.Parse(registry)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid registry URL %s", registry)
+	}
+	if u.Scheme != "https" && !(u.Scheme == "http" && isLoopback(u.Hostname())) {
+		return fmt.Errorf("registry %s must use https", registry)
+	}
+	if token == "" {
+		return fmt.Errorf("no token given for %s", registry)
+	}
+	if scope != "" {
+		if !strings.HasPrefix(scope, "@") || !validNamePart(scope[1:]) {
+			return fmt.Errorf("invalid scope %q; scopes look like @corp", scope)
+		}
+		if config.Scopes == nil {
+			config.Scopes = make(map[string]string)
+		}
+		config.Scopes[scope] = registry
+	}
+	if config.Tokens == nil {
+		config.Tokens = make(map[string]string)
+	}
+	config.Tokens[registry] = token
+	if err := config.Save(); err != nil {
+		return err
+	}
+	pm.registries = nil
+	fmt.Printf("✓ Logged in to %s\n", registry)
+	if scope != "" {
+		fmt.Printf("✓ Packages in %s come from %s\n", scope, registry)
+	}
+	return nil
+}
+
+// Logout forgets the token for a registry, by default the one the
+// project's unscoped packages come from.
+func (pm *PackageManager) Logout(registry string) error {
+	config, err := pm.userConfig()
+	if err != nil {
+		return err
+	}
+	if registry == "" {
+		registry = config.RegistryFor("", pm.Strataumfile.Registry)
+	}
+	registry = normalizeRegistry(registry)
+	if _, ok := config.Tokens[registry]; !ok {
+		return fmt.Errorf("not logged in to %s", registry)
+	}
+	delete(config.Tokens, registry)
+	if err := config.Save(); err != nil {
+		return err
+	}
+	pm.registries = nil
+	fmt.Printf("✓ Logged out of %s\n", registry)
+	return nil
+}
+
+// LoginCommand runs `strataum login [registry] [--scope=@scope]
+// [--token=TOKEN]`, reading the token from stdin when no flag gives it so
+// that it stays out of the shell history.
+func LoginCommand(pm *PackageManager, args []string, stdin io.Reader) error {
+	registry, token, scope := "", "", ""
+	for _, arg := range args {
+		name, value, _ := strings.Cut(arg, "=")
+		switch name {
+		case "--token":
+			token = value
+		case "--scope":
+			scope = value
+		default:
+			if strings.HasPrefix(arg, "-") || registry != "" {
+				return fmt.Errorf("usage: strataum login [registry] [--scope=@scope] [--token=TOKEN]")
+			}
+			registry = arg
+		}
+	}
+	if token == "" {
+		fmt.Print("Token: ")
+		line, _ := bufio.NewReader(stdin).ReadString('\n')
+		token = strings.TrimSpace(line)
+	}
+	return pm.Login(registry, token, scope)
+}
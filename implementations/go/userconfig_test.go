@@ -0,0 +1,81 @@
+package strata
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrivateRegistriesUseTheUserConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	lib := tarball(t, map[string]string{"index.str": "let x: int = 1\n"})
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("the token was sent to %s", r.Host)
+		}
+		w.Write(lib)
+	}))
+	defer mirror.Close()
+	private := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"name": "@corp/lib", "latest": "1.0.0", "versions": {"1.0.0": {"tarball": "` + mirror.URL + `/lib.tgz"}}}`))
+	}))
+	defer private.Close()
+
+	root := t.TempDir()
+	pm := NewPackageManager(root)
+	if err := LoginCommand(pm, []string{private.URL + "/", "--scope=@corp"}, strings.NewReader("s3cret\n")); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(home, ".strata", "config"))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("config written as %v, %v; want mode 0600", info, err)
+	}
+	pm = NewPackageManager(root)
+	pm.Strataumfile.Registry = mirror.URL
+	if err := pm.Add("@corp/lib", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, ".strata", "packages", "@corp", "lib", "index.str")); err != nil {
+		t.Error(err)
+	}
+
+	if err := pm.Logout(private.URL); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.Logout(private.URL); err == nil || !strings.Contains(err.Error(), "not logged in") {
+		t.Errorf("logging out twice: got %v", err)
+	}
+	pm = NewPackageManager(root)
+	err = pm.installPackage("@corp/lib", filepath.Join(root, ".strata", "packages"), "", make(map[string]bool))
+	if err == nil || !strings.Contains(err.Error(), "requires a login") {
+		t.Errorf("installing after logout: got %v", err)
+	}
+
+	// A proxy in the config carries every request.
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer proxy.Close()
+	config := &UserConfig{Proxy: proxy.URL}
+	client, err := config.Client("http://127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Metadata("colors"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("metadata through the proxy: got %v", err)
+	}
+	if proxied != "http://127.0.0.1:1/packages/colors" {
+		t.Errorf("the proxy was asked for %q", proxied)
+	}
+}
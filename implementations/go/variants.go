@@ -0,0 +1,174 @@
+package strata
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ============================================================================
+// RESULT AND OPTION - Ok/Err/Some/None values, match and the ? operator
+// ============================================================================
+
+// Variant is the runtime value of a result (Ok, Err) or an option (Some,
+// None). None carries no value.
+type Variant struct {
+	Tag   string
+	Value interface{}
+}
+
+var NoneValue = Variant{Tag: "None"}
+
+func (v Variant) String() string {
+	if v.Tag == "None" {
+		return v.Tag
+	}
+	return v.Tag + "(" + formatElement(v.Value) + ")"
+}
+
+func (v Variant) IsResult() bool {
+	return v.Tag == "Ok" || v.Tag == "Err"
+}
+
+// succeeded reports whether v holds a usable value: Ok or Some.
+func (v Variant) succeeded() bool {
+	return v.Tag == "Ok" || v.Tag == "Some"
+}
+
+// variantTags maps each tag to whether its pattern binds a value.
+var variantTags = map[string]bool{"Ok": true, "Err": true, "Some": true, "None": false}
+
+func variantArg(name string, value interface{}) (Variant, error) {
+	v, ok := value.(Variant)
+	if !ok {
+		return Variant{}, newError(ErrTypeMismatch, "%s expects a result or option, got %s", name, describeValue(value))
+	}
+	return v, nil
+}
+
+func variantBuiltins() map[string]func([]interface{}) interface{} {
+	check := func(name string, want func(Variant) bool) func([]interface{}) interface{} {
+		return func(args []interface{}) interface{} {
+			v, err := variantArg(name, args[0])
+			if err != nil {
+				return err
+			}
+			return want(v)
+		}
+	}
+	return map[string]func([]interface{}) interface{}{
+		"Ok":     func(args []interface{}) interface{} { return Variant{Tag: "Ok", Value: args[0]} },
+		"Err":    func(args []interface{}) interface{} { return Variant{Tag: "Err", Value: args[0]} },
+		"Some":   func(args []interface{}) interface{} { return Variant{Tag: "Some", Value: args[0]} },
+		"None":   func(args []interface{}) interface{} { return NoneValue },
+		"isOk":   check("isOk", func(v Variant) bool { return v.Tag == "Ok" }),
+		"isErr":  check("isErr", func(v Variant) bool { return v.Tag == "Err" }),
+		"isSome": check("isSome", func(v Variant) bool { return v.Tag == "Some" }),
+		"isNone": check("isNone", func(v Variant) bool { return v.Tag == "None" }),
+		"unwrap": func(args []interface{}) interface{} {
+			v, err := variantArg("unwrap", args[0])
+			if err != nil {
+				return err
+			}
+			if !v.succeeded() {
+				return newError(ErrInvalidOperation, "called unwrap on %s", v)
+			}
+			return v.Value
+		},
+		"unwrapOr": func(args []interface{}) interface{} {
+			v, err := variantArg("unwrapOr", args[0])
+			if err != nil {
+				return err
+			}
+			if !v.succeeded() {
+				return args[1]
+			}
+			return v.Value
+		},
+	}
+}
+
+// propagation unwinds to the enclosing function when `?` meets an Err or
+// None, which becomes that function's return value.
+type propagation struct {
+	Value Variant
+}
+
+func (p *propagation) Error() string {
+	return fmt.Sprintf("cannot propagate %s outside a function", p.Value)
+}
+
+// evalPropagate implements the postfix ? operator: it unwraps Ok and Some
+// and returns Err and None from the current function.
+func (i *Interpreter) evalPropagate(value interface{}) (interface{}, error) {
+	v, err := variantArg("?", value)
+	if err != nil {
+		return nil, err
+	}
+	if v.succeeded() {
+		return v.Value, nil
+	}
+	return nil, &propagation{Value: v}
+}
+
+// propagatedValue reports whether err is a ? propagation and its value.
+func propagatedValue(err error) (Variant, bool) {
+	if err == nil {
+		return Variant{}, false
+	}
+	var prop *propagation
+	if errors.As(err, &prop) {
+		return prop.Value, true
+	}
+	return Variant{}, false
+}
+
+// matchPattern reports whether value matches pattern, binding the payload of
+// a variant pattern in the current scope.
+func (i *Interpreter) matchPattern(pattern MatchPattern, value interface{}) (bool, error) {
+	switch {
+	case pattern.Wildcard:
+		return true, nil
+	case pattern.Enum != "":
+		return i.matchEnum(pattern, value)
+	case pattern.Tag != "":
+		v, ok := value.(Variant)
+		if !ok || v.Tag != pattern.Tag {
+			return false, nil
+		}
+		for _, name := range pattern.Bindings {
+			if name != "_" {
+				i.Env.Set(name, v.Value, false)
+			}
+		}
+		return true, nil
+	}
+	expected, err := i.evaluateExpression(pattern.Value)
+	if err != nil {
+		return false, err
+	}
+	equal, err := i.evalBinaryOp("==", value, expected)
+	if err != nil {
+		return false, err
+	}
+	return toBool(equal), nil
+}
+
+func (i *Interpreter) interpretMatch(stmt *Stmt) error {
+	subject, err := i.evaluateExpression(stmt.Value)
+	if err != nil {
+		return err
+	}
+	env := i.Env
+	defer func() { i.Env = env }()
+	for _, c := range stmt.Cases {
+		i.Env = newScope(env, nil)
+		matched, err := i.matchPattern(c.Pattern, subject)
+		if err != nil {
+			return err
+		}
+		if matched {
+			return i.runBlock(c.Body)
+		}
+	}
+	return nil
+}
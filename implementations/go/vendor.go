@@ -0,0 +1,80 @@
+package strata
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ============================================================================
+// VENDORING - Keeping a project's packages in its own tree
+// ============================================================================
+
+// `strataum vendor` copies every package of the lock file, checked against
+// its checksum, into vendor/ next to the Strataumfile, the workspace root's
+// in a workspace, replacing what vendor/ held. The directory is meant to be
+// checked in: imports from a project with a vendor/ directory resolve there
+// before .strata/packages, so the project runs without a registry, exactly
+// as locked. Vendored packages are checked against the lock file as
+// installed ones are.
+
+// vendorDir is where the project's packages are vendored.
+func (pm *PackageManager) vendorDir() string {
+	return pm.WorkspaceRoot + "/vendor"
+}
+
+// Vendor copies the locked packages into vendor/.
+func (pm *PackageManager) Vendor() error {
+	names := make([]string, 0, len(pm.LockFile.Packages))
+	for name := range pm.LockFile.Packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		fmt.Println("No packages to vendor.")
+		return nil
+	}
+
+	staging, err := os.MkdirTemp(pm.WorkspaceRoot, ".vendor-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+	for _, name := range names {
+		lock := pm.LockFile.Packages[name]
+		if lock.Integrity == "" {
+			return fmt.Errorf("%s@%s has no checksum; reinstall it before vendoring", name, lock.Version)
+		}
+		// Vendoring again works from vendor/ itself when the packages are
+		// not installed, as on a machine without a registry.
+		src := pm.packagesDir() + "/" + name
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			src = pm.vendorDir() + "/" + name
+		}
+		if err := verifyPackage(name, lock, src); err != nil {
+			return fmt.Errorf("%v; run strataum install first", err)
+		}
+		dst := filepath.Join(staging, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := copyPath(src, dst, nil); err != nil {
+			return err
+		}
+	}
+	if err := os.Chmod(staging, 0755); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(pm.vendorDir()); err != nil {
+		return err
+	}
+	if err := os.Rename(staging, pm.vendorDir()); err != nil {
+		return err
+	}
+	for _, name := range names {
+		fmt.Printf("✓ Vendored %s@%s\n", name, pm.LockFile.Packages[name].Version)
+	}
+	fmt.Printf("✓ Vendored %d package(s) into %s\n", len(names), pm.vendorDir())
+	return nil
+}
@@ -0,0 +1,77 @@
+package strata
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVendoredPackagesAreImportedFirst(t *testing.T) {
+	served := tarball(t, map[string]string{"index.str": "func hello() => string {\n  return \"hello\"\n}\n"})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/packages/greet", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name": "greet", "latest": "1.0.0", "versions": {"1.0.0": {"tarball": "/greet.tgz"}}}`))
+	})
+	mux.HandleFunc("/greet.tgz", func(w http.ResponseWriter, r *http.Request) { w.Write(served) })
+	server := httptest.NewServer(mux)
+
+	t.Setenv("HOME", t.TempDir())
+	root := t.TempDir()
+	pm := NewPackageManager(root)
+	pm.Strataumfile.Registry = server.URL
+	if err := pm.Add("greet", ""); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+	if err := NewPackageManager(root).Vendor(); err != nil {
+		t.Fatal(err)
+	}
+
+	main := filepath.Join(root, "main.str")
+	os.WriteFile(main, []byte("import io from std::io\nimport greet from greet\nio.print(greet.hello())\n"), 0644)
+	run := func() (*Project, string) {
+		project, err := LoadProject(main)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var diags strings.Builder
+		if project.ReportDiagnostics(&diags) > 0 {
+			return project, diags.String()
+		}
+		var out strings.Builder
+		interp := NewInterpreter()
+		RunOptions{Stdout: &out}.Configure(interp)
+		interp.UseProject(project)
+		if err := interp.Interpret(project.EntryModule().Statements); err != nil {
+			t.Fatal(err)
+		}
+		return project, out.String()
+	}
+	project, out := run()
+	if out != "hello\n" || !strings.Contains(strings.Join(project.Order, " "), filepath.Join("vendor", "greet")) {
+		t.Errorf("got %q from %v, want hello from vendor/greet", out, project.Order)
+	}
+
+	// Without the installed packages or the registry, vendor/ is enough.
+	os.RemoveAll(filepath.Join(root, ".strata"))
+	if _, out := run(); out != "hello\n" {
+		t.Errorf("without .strata/packages got %q", out)
+	}
+	if err := NewPackageManager(root).Verify(); err != nil {
+		t.Errorf("verify with only vendor/: %v", err)
+	}
+	if err := NewPackageManager(root).Vendor(); err != nil {
+		t.Errorf("vendoring again from vendor/: %v", err)
+	}
+
+	os.WriteFile(filepath.Join(root, "vendor", "greet", "index.str"), []byte("func hello() => string {\n  return \"bye\"\n}\n"), 0644)
+	if _, out := run(); !strings.Contains(out, "greet@1.0.0 has been modified") {
+		t.Errorf("a modified vendored package gave %q", out)
+	}
+	if err := NewPackageManager(root).Vendor(); err == nil {
+		t.Error("vendored a modified package")
+	}
+}
@@ -0,0 +1,217 @@
+package strata
+
+import "fmt"
+
+// ============================================================================
+// AST WALKING - Walk, Inspect and Rewrite over statements and expressions
+// ============================================================================
+
+// Node is a *Stmt or an *Expr.
+type Node interface {
+	Pos() Location
+}
+
+func (s *Stmt) Pos() Location { return s.Location }
+
+func (e *Expr) Pos() Location { return e.Location }
+
+// A Visitor's Visit method is called for each node Walk reaches. If it
+// returns a non-nil visitor w, Walk visits the node's children with w and
+// then calls w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree rooted at node depth-first, starting with
+// v.Visit(node). Children are visited in a fixed order: a statement's
+// initializer, expressions and condition come before its blocks, and an
+// expression's operands before its arguments and elements.
+func Walk(node Node, v Visitor) {
+	if isNilNode(node) {
+		return
+	}
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	for _, child := range children(node) {
+		Walk(child, v)
+	}
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect walks the tree rooted at node, calling fn for each node. When fn
+// returns false the node's children are skipped. After the children, fn is
+// called with nil.
+func Inspect(node Node, fn func(Node) bool) {
+	Walk(node, inspector(fn))
+}
+
+// Rewrite replaces every node in the tree rooted at node with what fn
+// returns for it, children before their parents, and returns the new root.
+// fn must return an *Expr for an expression and an *Stmt for a statement;
+// returning the node it was given keeps it. Returning nil for a statement
+// in a block drops it from the block. The tree is changed in place.
+func Rewrite(node Node, fn func(Node) Node) Node {
+	if isNilNode(node) {
+		return node
+	}
+	eachChild(node, func(child Node) Node {
+		return Rewrite(child, fn)
+	})
+	return fn(node)
+}
+
+// RewriteBlock rewrites each statement of a block or a whole program, as
+// Rewrite does, and returns the statements that remain.
+func RewriteBlock(statements []*Stmt, fn func(Node) Node) []*Stmt {
+	return rewriteBlock(statements, func(child Node) Node {
+		return Rewrite(child, fn)
+	})
+}
+
+func isNilNode(node Node) bool {
+	switch n := node.(type) {
+	case *Stmt:
+		return n == nil
+	case *Expr:
+		return n == nil
+	}
+	return node == nil
+}
+
+// children lists the children of node in the order eachChild visits them.
+func children(node Node) []Node {
+	var nodes []Node
+	add := func(child Node) {
+		if !isNilNode(child) {
+			nodes = append(nodes, child)
+		}
+	}
+	addBlock := func(block []*Stmt) {
+		for _, stmt := range block {
+			add(stmt)
+		}
+	}
+	switch n := node.(type) {
+	case *Stmt:
+		add(n.Init)
+		add(n.TargetExpr)
+		add(n.Value)
+		add(n.Expr)
+		add(n.Condition)
+		add(n.Update)
+		addBlock(n.Then)
+		addBlock(n.Body)
+		addBlock(n.Else)
+		addBlock(n.Catch)
+		addBlock(n.Finally)
+		for _, c := range n.Cases {
+			add(c.Pattern.Value)
+			addBlock(c.Body)
+		}
+	case *Expr:
+		add(n.Left)
+		add(n.Right)
+		add(n.Operand)
+		add(n.Func)
+		add(n.Object)
+		add(n.Index)
+		for _, arg := range n.Args {
+			add(arg)
+		}
+		for _, element := range n.Elements {
+			add(element)
+		}
+	default:
+		panic(fmt.Sprintf("strata: unexpected node type %T", node))
+	}
+	return nodes
+}
+
+// eachChild replaces every child of node with what fn returns for it. It
+// must reach the same fields as children, in the same order.
+func eachChild(node Node, fn func(Node) Node) {
+	switch n := node.(type) {
+	case *Stmt:
+		n.Init = rewriteStmt(n.Init, fn)
+		n.TargetExpr = rewriteExpr(n.TargetExpr, fn)
+		n.Value = rewriteExpr(n.Value, fn)
+		n.Expr = rewriteExpr(n.Expr, fn)
+		n.Condition = rewriteExpr(n.Condition, fn)
+		n.Update = rewriteStmt(n.Update, fn)
+		n.Then = rewriteBlock(n.Then, fn)
+		n.Body = rewriteBlock(n.Body, fn)
+		n.Else = rewriteBlock(n.Else, fn)
+		n.Catch = rewriteBlock(n.Catch, fn)
+		n.Finally = rewriteBlock(n.Finally, fn)
+		for idx := range n.Cases {
+			n.Cases[idx].Pattern.Value = rewriteExpr(n.Cases[idx].Pattern.Value, fn)
+			n.Cases[idx].Body = rewriteBlock(n.Cases[idx].Body, fn)
+		}
+	case *Expr:
+		n.Left = rewriteExpr(n.Left, fn)
+		n.Right = rewriteExpr(n.Right, fn)
+		n.Operand = rewriteExpr(n.Operand, fn)
+		n.Func = rewriteExpr(n.Func, fn)
+		n.Object = rewriteExpr(n.Object, fn)
+		n.Index = rewriteExpr(n.Index, fn)
+		for idx, arg := range n.Args {
+			n.Args[idx] = rewriteExpr(arg, fn)
+		}
+		for idx, element := range n.Elements {
+			n.Elements[idx] = rewriteExpr(element, fn)
+		}
+	default:
+		panic(fmt.Sprintf("strata: unexpected node type %T", node))
+	}
+}
+
+func rewriteExpr(expr *Expr, fn func(Node) Node) *Expr {
+	if expr == nil {
+		return nil
+	}
+	switch r := fn(expr).(type) {
+	case *Expr:
+		return r
+	case nil:
+		return nil
+	default:
+		panic(fmt.Sprintf("strata: expression rewritten to %T, want *Expr", r))
+	}
+}
+
+func rewriteStmt(stmt *Stmt, fn func(Node) Node) *Stmt {
+	if stmt == nil {
+		return nil
+	}
+	switch r := fn(stmt).(type) {
+	case *Stmt:
+		return r
+	case nil:
+		return nil
+	default:
+		panic(fmt.Sprintf("strata: statement rewritten to %T, want *Stmt", r))
+	}
+}
+
+func rewriteBlock(block []*Stmt, fn func(Node) Node) []*Stmt {
+	if block == nil {
+		return nil
+	}
+	kept := block[:0]
+	for _, stmt := range block {
+		if stmt = rewriteStmt(stmt, fn); stmt != nil {
+			kept = append(kept, stmt)
+		}
+	}
+	return kept
+}
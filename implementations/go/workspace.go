@@ -0,0 +1,252 @@
+package strata
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ============================================================================
+// WORKSPACES - Several packages developed and locked together
+// ============================================================================
+
+// A Strataumfile with a workspaces list makes its directory the root of a
+// workspace whose members are the listed directories, each a project with
+// its own Strataumfile. Entries may be globs:
+//
+//	{"name": "shop", "workspaces": ["packages/*", "tools/cli"]}
+//
+// Members share the root's Strataumfile.lock and .strata/packages: `strataum
+// install` anywhere in the workspace installs what every member depends on
+// once, at the root. Members import each other by name, as they would an
+// installed package, and `strataum add` of a member records it with the
+// version "workspace" instead of fetching it.
+
+// workspaceVersion is the version a dependency on a member is recorded with.
+const workspaceVersion = "workspace"
+
+type workspaceMember struct {
+	Name   string
+	Dir    string
+	Config StrataumfileConfig
+}
+
+// readStrataumfile reads the Strataumfile in dir.
+func readStrataumfile(dir string) (StrataumfileConfig, error) {
+	var config StrataumfileConfig
+	data, err := os.ReadFile(filepath.Join(dir, "Strataumfile"))
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("invalid %s: %v", filepath.Join(dir, "Strataumfile"), err)
+	}
+	return config, nil
+}
+
+// enclosingWorkspace finds the nearest directory from dir up whose
+// Strataumfile declares workspaces.
+func enclosingWorkspace(dir string) (string, StrataumfileConfig, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", StrataumfileConfig{}, false
+	}
+	for {
+		if config, err := readStrataumfile(dir); err == nil && len(config.Workspaces) > 0 {
+			return dir, config, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", StrataumfileConfig{}, false
+		}
+		dir = parent
+	}
+}
+
+// findWorkspaceRoot returns the root of the workspace the project in
+// projectRoot is the root or a member of, or "".
+func findWorkspaceRoot(projectRoot string) string {
+	root, config, ok := enclosingWorkspace(projectRoot)
+	if !ok {
+		return ""
+	}
+	abs, _ := filepath.Abs(projectRoot)
+	if abs == root {
+		return root
+	}
+	members, _ := workspaceMembers(root, config)
+	for _, member := range members {
+		if member.Dir == abs {
+			return root
+		}
+	}
+	return ""
+}
+
+// workspaceMembers lists the members of the workspace at root in order of
+// name. Directories a glob matches without a Strataumfile are not members.
+func workspaceMembers(root string, config StrataumfileConfig) ([]workspaceMember, error) {
+	var members []workspaceMember
+	seen := make(map[string]string)
+	for _, pattern := range config.Workspaces {
+		matches, err := filepath.Glob(filepath.Join(root, filepath.FromSlash(pattern)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid workspace %q: %v", pattern, err)
+		}
+		isGlob := strings.ContainsAny(pattern, "*?[")
+		if len(matches) == 0 && !isGlob {
+			return nil, fmt.Errorf("workspace member %s does not exist", pattern)
+		}
+		for _, dir := range matches {
+			memberConfig, err := readStrataumfile(dir)
+			if os.IsNotExist(err) && isGlob {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("workspace member %s: %v", pattern, err)
+			}
+			name := memberConfig.Name
+			if name == "" {
+				name = filepath.Base(dir)
+			}
+			if other, dup := seen[name]; dup && other != dir {
+				return nil, fmt.Errorf("workspace members %s and %s are both named %s", other, dir, name)
+			}
+			if _, dup := seen[name]; !dup {
+				seen[name] = dir
+				members = append(members, workspaceMember{Name: name, Dir: dir, Config: memberConfig})
+			}
+		}
+	}
+	sort.Slice(members, func(a, b int) bool { return members[a].Name < members[b].Name })
+	return members, nil
+}
+
+// workspaceMemberModule resolves the name of a member of a workspace rooted
+// at dir to its main file: the one its Strataumfile names, else index.str,
+// else its default entrypoint.
+func workspaceMemberModule(dir, name string) (string, bool) {
+	config, err := readStrataumfile(dir)
+	if err != nil || len(config.Workspaces) == 0 {
+		return "", false
+	}
+	members, err := workspaceMembers(dir, config)
+	if err != nil {
+		return "", false
+	}
+	for _, member := range members {
+		if member.Name != name {
+			continue
+		}
+		candidates := append([]string{"index.str"}, defaultEntrypoints...)
+		if member.Config.Main != "" {
+			candidates = []string{member.Config.Main}
+		}
+		for _, candidate := range candidates {
+			path := filepath.Join(member.Dir, filepath.FromSlash(candidate))
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path, true
+			}
+		}
+	}
+	return "", false
+}
+
+// packagesDir is where the project's packages are installed.
+func (pm *PackageManager) packagesDir() string {
+	return pm.WorkspaceRoot + "/.strata/packages"
+}
+
+func (pm *PackageManager) workspace() (StrataumfileConfig, []workspaceMember, error) {
+	if pm.WorkspaceRoot == pm.ProjectRoot && len(pm.Strataumfile.Workspaces) == 0 {
+		return pm.Strataumfile, nil, nil
+	}
+	root, err := readStrataumfile(pm.WorkspaceRoot)
+	if err != nil {
+		return root, nil, err
+	}
+	members, err := workspaceMembers(pm.WorkspaceRoot, root)
+	return root, members, err
+}
+
+func (pm *PackageManager) isWorkspaceMember(name string) bool {
+	_, members, _ := pm.workspace()
+	for _, member := range members {
+		if member.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// dependencies returns what the project, or the whole workspace it is in,
+// needs installed, by package. When members ask for different versions of
+// a package, the root's requirement wins, then that of the member first in
+// order of name.
+func (pm *PackageManager) dependencies() (map[string]string, error) {
+	root, members, err := pm.workspace()
+	if err != nil {
+		return nil, err
+	}
+	isMember := make(map[string]bool)
+	for _, member := range members {
+		isMember[member.Name] = true
+	}
+	deps := make(map[string]string)
+	owners := make(map[string]string)
+	add := func(owner string, config StrataumfileConfig) {
+		names := make([]string, 0, len(config.Dependencies))
+		for name := range config.Dependencies {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			requirement := config.Dependencies[name]
+			if isMember[name] || requirement == workspaceVersion {
+				continue
+			}
+			if have, ok := deps[name]; ok {
+				if have != requirement {
+					fmt.Fprintf(os.Stderr, "Warning: %s needs %s@%s, but the workspace installs %s@%s for %s\n", owner, name, requirement, name, have, owners[name])
+				}
+				continue
+			}
+			deps[name] = requirement
+			owners[name] = owner
+		}
+	}
+	add(root.Name, root)
+	for _, member := range members {
+		add(member.Name, member.Config)
+	}
+	return deps, nil
+}
+
+// workspaceTarget resolves `strata run --workspace=NAME [target]` to the
+// target within the member NAME of the workspace around the current
+// directory.
+func workspaceTarget(name, target string) (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	root, config, ok := enclosingWorkspace(cwd)
+	if !ok {
+		return "", fmt.Errorf("--workspace=%s: %s is not in a workspace", name, cwd)
+	}
+	members, err := workspaceMembers(root, config)
+	if err != nil {
+		return "", err
+	}
+	var names []string
+	for _, member := range members {
+		if member.Name == name {
+			return filepath.Join(member.Dir, target), nil
+		}
+		names = append(names, member.Name)
+	}
+	return "", fmt.Errorf("the workspace at %s has no member %s; its members are %s", root, name, strings.Join(names, ", "))
+}
@@ -0,0 +1,82 @@
+package strata
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWorkspacesShareInstallsAndImportEachOther(t *testing.T) {
+	colors := tarball(t, map[string]string{"index.str": "func paint(s: string) => string {\n  return \"*\" + s + \"*\"\n}\n"})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/packages/colors", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name": "colors", "latest": "1.1.0", "versions": {
+			"1.0.0": {"tarball": "/colors.tgz"}, "1.1.0": {"tarball": "/colors.tgz"}}}`))
+	})
+	mux.HandleFunc("/colors.tgz", func(w http.ResponseWriter, r *http.Request) { w.Write(colors) })
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	t.Setenv("HOME", t.TempDir())
+	root := t.TempDir()
+	files := map[string]string{
+		"Strataumfile": `{"name": "shop", "registry": "` + server.URL + `", "workspaces": ["packages/*"],
+			"dependencies": {"colors": "^1.0.0"}}`,
+		"packages/util/Strataumfile": `{"name": "util", "main": "lib.str"}`,
+		"packages/util/lib.str":      "func shout(s: string) => string {\n  return s + \"!\"\n}\n",
+		"packages/api/Strataumfile": `{"name": "api", "registry": "` + server.URL + `",
+			"dependencies": {"colors": "1.0.0", "util": "workspace"}}`,
+		"packages/api/src/main.str": `import io from std::io
+import util from util
+import colors from colors
+io.print(colors.paint(util.shout("hi")))
+`,
+		"packages/notes/README.md": "not a member\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+	api := filepath.Join(root, "packages", "api")
+
+	pm := NewPackageManager(api)
+	if pm.WorkspaceRoot != root {
+		t.Fatalf("workspace root %s, want %s", pm.WorkspaceRoot, root)
+	}
+	if err := pm.Install(""); err != nil {
+		t.Fatal(err)
+	}
+	if lock := pm.LockFile.Packages["colors"]; lock == nil || lock.Version != "1.1.0" {
+		t.Errorf("colors locked as %+v, want the root's ^1.0.0 as 1.1.0", lock)
+	}
+	if _, err := os.Stat(filepath.Join(root, "Strataumfile.lock")); err != nil {
+		t.Errorf("no shared lock file: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, ".strata", "packages", "colors", "index.str")); err != nil {
+		t.Errorf("colors not hoisted to the root: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(api, ".strata")); err == nil {
+		t.Error("the member got its own packages directory")
+	}
+	if err := NewPackageManager(filepath.Join(root, "packages", "util")).Verify(); err != nil {
+		t.Errorf("verify from another member: %v", err)
+	}
+
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(root)
+	var out, errs strings.Builder
+	if code := RunProject(".", RunOptions{Workspace: "api", Stdout: &out, Stderr: &errs, Quiet: true}); code != 0 {
+		t.Fatalf("run --workspace=api exited %d: %s", code, errs.String())
+	}
+	if want := "*hi!*\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+	if _, err := workspaceTarget("web", "."); err == nil || !strings.Contains(err.Error(), "its members are api, util") {
+		t.Errorf("unknown member: got %v", err)
+	}
+}
@@ -0,0 +1,614 @@
+package strata
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ============================================================================
+// STD::YAML - Parsing and writing YAML documents
+// ============================================================================
+
+// The parser reads the block and flow styles used by configuration files:
+// mappings, sequences, plain and quoted scalars, | and > block scalars and
+// comments. Anchors, tags and multiple documents are not supported. Plain
+// scalars resolve as in YAML 1.2: null, true, false, ints and floats, and
+// anything else is a string.
+
+func yamlModule() map[string]interface{} {
+	return map[string]interface{}{
+		"parse": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("parse", args, 1); err != nil {
+				return nil, err
+			}
+			return ParseYAML(toString(args[0]))
+		}),
+		"stringify": NativeFunc(func(args []interface{}) (interface{}, error) {
+			if err := wantArgs("stringify", args, 1); err != nil {
+				return nil, err
+			}
+			return StringifyYAML(args[0])
+		}),
+	}
+}
+
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// ParseYAML parses a YAML document.
+func ParseYAML(src string) (interface{}, error) {
+	p := &yamlParser{}
+	for idx, raw := range strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n") {
+		text := strings.TrimRight(raw, " \t")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "---" || trimmed == "..." || strings.HasPrefix(trimmed, "%") && len(text) == len(trimmed) {
+			continue
+		}
+		p.lines = append(p.lines, yamlLine{number: idx + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+	p.skipBlank()
+	if p.done() {
+		return nil, nil
+	}
+	value, err := p.node(p.lines[p.pos].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.skipBlank(); !p.done() {
+		return nil, p.errorf("unexpected %s", p.lines[p.pos].text)
+	}
+	return value, nil
+}
+
+func (p *yamlParser) errorf(format string, args ...interface{}) *StrataError {
+	number := 0
+	if p.pos < len(p.lines) {
+		number = p.lines[p.pos].number
+	} else if len(p.lines) > 0 {
+		number = p.lines[len(p.lines)-1].number
+	}
+	return newError(ErrSyntax, "yaml: line %d: "+format, append([]interface{}{number}, args...)...)
+}
+
+func (p *yamlParser) done() bool { return p.pos >= len(p.lines) }
+
+// skipBlank moves past empty and comment-only lines.
+func (p *yamlParser) skipBlank() {
+	for !p.done() && (p.lines[p.pos].text == "" || p.lines[p.pos].text[0] == '#') {
+		p.pos++
+	}
+}
+
+// node parses the block node whose lines start at column indent.
+func (p *yamlParser) node(indent int) (interface{}, error) {
+	line := p.lines[p.pos]
+	if isSequenceEntry(line.text) {
+		return p.sequence(indent)
+	}
+	if _, _, ok := splitMappingEntry(line.text); ok {
+		return p.mapping(indent)
+	}
+	p.pos++
+	return p.inlineValue(line.text, indent)
+}
+
+func isSequenceEntry(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *yamlParser) sequence(indent int) ([]interface{}, error) {
+	items := []interface{}{}
+	for p.skipBlank(); !p.done(); p.skipBlank() {
+		line := p.lines[p.pos]
+		if line.indent != indent || !isSequenceEntry(line.text) {
+			break
+		}
+		rest := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		var item interface{}
+		var err error
+		if rest == "" || rest[0] == '#' {
+			item, err = p.child(indent)
+		} else {
+			// the entry's content starts a node at its own column
+			p.lines[p.pos] = yamlLine{number: line.number, indent: indent + len(line.text) - len(rest), text: rest}
+			item, err = p.node(p.lines[p.pos].indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (p *yamlParser) mapping(indent int) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	for p.skipBlank(); !p.done(); p.skipBlank() {
+		line := p.lines[p.pos]
+		if line.indent != indent {
+			if line.indent > indent {
+				return nil, p.errorf("unexpected indentation")
+			}
+			break
+		}
+		key, rest, ok := splitMappingEntry(line.text)
+		if !ok {
+			return nil, p.errorf("expected a mapping entry, got %s", line.text)
+		}
+		name, err := scalarText(key)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		p.pos++
+		var value interface{}
+		if rest == "" || rest[0] == '#' {
+			value, err = p.child(indent)
+			// a sequence may sit at the same indentation as its key
+			if value == nil && err == nil && !p.done() && p.lines[p.pos].indent == indent && isSequenceEntry(p.lines[p.pos].text) {
+				value, err = p.sequence(indent)
+			}
+		} else {
+			value, err = p.inlineValue(rest, indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[name] = value
+	}
+	return m, nil
+}
+
+// child parses the block nested under a line at indent, or returns nil if
+// the next line is not indented further.
+func (p *yamlParser) child(indent int) (interface{}, error) {
+	if p.skipBlank(); p.done() || p.lines[p.pos].indent <= indent {
+		return nil, nil
+	}
+	return p.node(p.lines[p.pos].indent)
+}
+
+// inlineValue parses the value that follows a key or a sequence dash on the
+// same line, reading on for block scalars, unfinished flow collections and
+// plain scalars continued on more indented lines.
+func (p *yamlParser) inlineValue(text string, indent int) (interface{}, error) {
+	switch text[0] {
+	case '|', '>':
+		return p.blockScalar(text, indent)
+	case '[', '{':
+		for !flowBalanced(text) && !p.done() {
+			text += " " + p.lines[p.pos].text
+			p.pos++
+		}
+	case '"', '\'':
+	default:
+		for !p.done() && p.lines[p.pos].indent > indent && p.lines[p.pos].text != "" && p.lines[p.pos].text[0] != '#' {
+			text += " " + p.lines[p.pos].text
+			p.pos++
+		}
+	}
+	value, rest, err := parseFlow(stripComment(text), false)
+	if err != nil {
+		return nil, p.errorf("%v", err)
+	}
+	if strings.TrimSpace(rest) != "" {
+		return nil, p.errorf("unexpected %s", strings.TrimSpace(rest))
+	}
+	return value, nil
+}
+
+// blockScalar reads a | (literal) or > (folded) scalar.
+func (p *yamlParser) blockScalar(header string, indent int) (string, error) {
+	header = strings.TrimSpace(stripComment(header))
+	folded := header[0] == '>'
+	chomp := byte(0)
+	for _, c := range []byte(header[1:]) {
+		if c == '-' || c == '+' {
+			chomp = c
+		} else if c < '1' || c > '9' {
+			return "", p.errorf("invalid block scalar header %s", header)
+		}
+	}
+	var lines []string
+	blockIndent := -1
+	for ; !p.done(); p.pos++ {
+		line := p.lines[p.pos]
+		if line.text == "" {
+			lines = append(lines, "")
+			continue
+		}
+		if line.indent <= indent {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = line.indent
+		}
+		if line.indent < blockIndent {
+			break
+		}
+		lines = append(lines, strings.Repeat(" ", line.indent-blockIndent)+line.text)
+	}
+	content := strings.Join(lines, "\n")
+	if folded {
+		content = foldLines(lines)
+	}
+	trimmed := strings.TrimRight(content, "\n")
+	switch {
+	case chomp == '-' || trimmed == "":
+		return trimmed, nil
+	case chomp == '+':
+		return content + "\n", nil
+	}
+	return trimmed + "\n", nil
+}
+
+// foldLines joins the lines of a folded scalar: lines are joined by spaces
+// and each empty line becomes a newline. More indented lines keep theirs.
+func foldLines(lines []string) string {
+	var b strings.Builder
+	for idx, line := range lines {
+		if idx > 0 {
+			prev := lines[idx-1]
+			if prev == "" || line == "" || line[0] == ' ' || prev[0] == ' ' {
+				b.WriteByte('\n')
+			} else {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+// splitMappingEntry splits "key: value" at the first colon outside quotes
+// and brackets that is followed by a space or ends the line.
+func splitMappingEntry(text string) (string, string, bool) {
+	if text[0] == '[' || text[0] == '{' || text[0] == '#' {
+		return "", "", false
+	}
+	var quote byte
+	for idx := 0; idx < len(text); idx++ {
+		c := text[idx]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && idx == 0:
+			quote = c
+		case c == '#' && idx > 0 && text[idx-1] == ' ':
+			return "", "", false
+		case c == ':' && (idx+1 == len(text) || text[idx+1] == ' '):
+			return strings.TrimSpace(text[:idx]), strings.TrimSpace(text[idx+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// stripComment removes a trailing # comment outside quotes.
+func stripComment(text string) string {
+	var quote byte
+	for idx := 0; idx < len(text); idx++ {
+		c := text[idx]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				idx++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if idx == 0 || strings.IndexByte(" [{,:", text[idx-1]) >= 0 {
+				quote = c
+			}
+		case c == '#' && (idx == 0 || text[idx-1] == ' '):
+			return strings.TrimRight(text[:idx], " ")
+		}
+	}
+	return text
+}
+
+// flowBalanced reports whether every [ and { in text is closed.
+func flowBalanced(text string) bool {
+	depth := 0
+	var quote byte
+	for idx := 0; idx < len(text); idx++ {
+		c := text[idx]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				idx++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		}
+	}
+	return depth <= 0
+}
+
+// parseFlow parses one flow node from the start of text and returns what
+// follows it. Inside a flow collection, plain scalars end at , ] and }.
+func parseFlow(text string, inFlow bool) (interface{}, string, error) {
+	text = strings.TrimLeft(text, " ")
+	if text == "" {
+		return nil, "", nil
+	}
+	switch text[0] {
+	case '[':
+		items := []interface{}{}
+		rest := strings.TrimLeft(text[1:], " ")
+		for {
+			if rest == "" {
+				return nil, "", newError(ErrSyntax, "unterminated flow sequence")
+			}
+			if rest[0] == ']' {
+				return items, rest[1:], nil
+			}
+			item, after, err := parseFlow(rest, true)
+			if err != nil {
+				return nil, "", err
+			}
+			items = append(items, item)
+			if rest = strings.TrimLeft(after, " "); strings.HasPrefix(rest, ",") {
+				rest = strings.TrimLeft(rest[1:], " ")
+			} else if !strings.HasPrefix(rest, "]") {
+				if rest == "" {
+					return nil, "", newError(ErrSyntax, "unterminated flow sequence")
+				}
+				return nil, "", newError(ErrSyntax, "expected , or ] in flow sequence")
+			}
+		}
+	case '{':
+		m := make(map[string]interface{})
+		rest := strings.TrimLeft(text[1:], " ")
+		for {
+			if rest == "" {
+				return nil, "", newError(ErrSyntax, "unterminated flow mapping")
+			}
+			if rest[0] == '}' {
+				return m, rest[1:], nil
+			}
+			key, after, err := parseFlow(rest, true)
+			if err != nil {
+				return nil, "", err
+			}
+			if after = strings.TrimLeft(after, " "); !strings.HasPrefix(after, ":") {
+				return nil, "", newError(ErrSyntax, "expected : in flow mapping")
+			}
+			value, after, err := parseFlow(after[1:], true)
+			if err != nil {
+				return nil, "", err
+			}
+			m[displayValue(key)] = value
+			if rest = strings.TrimLeft(after, " "); strings.HasPrefix(rest, ",") {
+				rest = strings.TrimLeft(rest[1:], " ")
+			} else if !strings.HasPrefix(rest, "}") {
+				if rest == "" {
+					return nil, "", newError(ErrSyntax, "unterminated flow mapping")
+				}
+				return nil, "", newError(ErrSyntax, "expected , or } in flow mapping")
+			}
+		}
+	case '"', '\'':
+		return quotedScalar(text)
+	}
+	end := len(text)
+	if inFlow {
+		for idx := 0; idx < len(text); idx++ {
+			if c := text[idx]; c == ',' || c == ']' || c == '}' || c == ':' && (idx+1 == len(text) || text[idx+1] == ' ') {
+				end = idx
+				break
+			}
+		}
+	}
+	return resolveScalar(strings.TrimSpace(text[:end])), text[end:], nil
+}
+
+// quotedScalar parses a single- or double-quoted scalar at the start of text.
+func quotedScalar(text string) (string, string, error) {
+	quote := text[0]
+	var b strings.Builder
+	for idx := 1; idx < len(text); idx++ {
+		c := text[idx]
+		switch {
+		case c == quote && quote == '\'' && idx+1 < len(text) && text[idx+1] == '\'':
+			b.WriteByte('\'')
+			idx++
+		case c == quote:
+			return b.String(), text[idx+1:], nil
+		case c == '\\' && quote == '"':
+			r, n, err := unescapeSequence(text[idx:])
+			if err != nil {
+				return "", "", err
+			}
+			b.WriteRune(r)
+			idx += n - 1
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", newError(ErrSyntax, "unterminated quoted scalar")
+}
+
+// scalarText is the string a mapping key denotes.
+func scalarText(text string) (string, error) {
+	if text != "" && (text[0] == '"' || text[0] == '\'') {
+		s, _, err := quotedScalar(text)
+		return s, err
+	}
+	return text, nil
+}
+
+var (
+	yamlInt   = regexp.MustCompile(`^[-+]?[0-9]+$`)
+	yamlFloat = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+)
+
+// resolveScalar gives a plain scalar its type.
+func resolveScalar(text string) interface{} {
+	switch text {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	case ".inf", ".Inf", ".INF", "+.inf", "+.Inf", "+.INF":
+		return math.Inf(1)
+	case "-.inf", "-.Inf", "-.INF":
+		return math.Inf(-1)
+	case ".nan", ".NaN", ".NAN":
+		return math.NaN()
+	}
+	if yamlInt.MatchString(text) {
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return n
+		}
+	}
+	for prefix, base := range map[string]int{"0x": 16, "0o": 8} {
+		if strings.HasPrefix(text, prefix) {
+			if n, err := strconv.ParseInt(text[2:], base, 64); err == nil {
+				return n
+			}
+		}
+	}
+	if yamlFloat.MatchString(text) {
+		if f, err := strconv.ParseFloat(text, 64); err == nil {
+			return f
+		}
+	}
+	return text
+}
+
+// StringifyYAML writes a value as a block-style YAML document.
+func StringifyYAML(value interface{}) (string, error) {
+	var b strings.Builder
+	if err := writeYAML(&b, value, 0); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// writeYAML writes value as lines indented by indent spaces. A collection's
+// first line is written without indentation, so a caller can put it after
+// "- " or "key: ".
+func writeYAML(b *strings.Builder, value interface{}, indent int) error {
+	pad := strings.Repeat(" ", indent)
+	if m, ok := value.(map[string]interface{}); ok && len(m) > 0 {
+		keys := make([]string, 0, len(m))
+		for key := range m {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for idx, key := range keys {
+			if idx > 0 {
+				b.WriteString(pad)
+			}
+			b.WriteString(yamlScalar(key) + ":")
+			if err := writeYAMLChild(b, m[key], indent); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if items, ok := sequenceItems(value); ok && len(items) > 0 {
+		for idx, item := range items {
+			if idx > 0 {
+				b.WriteString(pad)
+			}
+			b.WriteString("-")
+			if isYAMLCollection(item) {
+				b.WriteString(" ")
+				if err := writeYAML(b, item, indent+2); err != nil {
+					return err
+				}
+			} else if err := writeYAMLChild(b, item, indent); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	scalar, err := yamlValue(value)
+	if err != nil {
+		return err
+	}
+	b.WriteString(scalar + "\n")
+	return nil
+}
+
+// writeYAMLChild writes the value after a "key:" or "-" written at indent.
+func writeYAMLChild(b *strings.Builder, value interface{}, indent int) error {
+	if !isYAMLCollection(value) {
+		b.WriteString(" ")
+		return writeYAML(b, value, indent)
+	}
+	b.WriteString("\n" + strings.Repeat(" ", indent+2))
+	return writeYAML(b, value, indent+2)
+}
+
+// isYAMLCollection reports whether v is written in block style: a non-empty
+// map or list.
+func isYAMLCollection(v interface{}) bool {
+	if m, ok := v.(map[string]interface{}); ok {
+		return len(m) > 0
+	}
+	items, ok := sequenceItems(v)
+	return ok && len(items) > 0
+}
+
+func yamlValue(v interface{}) (string, error) {
+	switch val := v.(type) {
+	case nil:
+		return "null", nil
+	case string:
+		return yamlScalar(val), nil
+	case bool:
+		return strconv.FormatBool(val), nil
+	case float64:
+		switch {
+		case math.IsNaN(val):
+			return ".nan", nil
+		case math.IsInf(val, 1):
+			return ".inf", nil
+		case math.IsInf(val, -1):
+			return "-.inf", nil
+		}
+		return floatLiteral(val), nil
+	case map[string]interface{}:
+		return "{}", nil
+	}
+	if isInteger(v) {
+		return strconv.FormatInt(toInt(v), 10), nil
+	}
+	if _, ok := sequenceItems(v); ok {
+		return "[]", nil
+	}
+	return "", newError(ErrTypeMismatch, "yaml: cannot encode %s", describeValue(v))
+}
+
+// yamlScalar writes s plain when it would read back as the same string and
+// double-quoted otherwise.
+func yamlScalar(s string) string {
+	if s == "" || resolveScalar(s) != s || strings.ContainsAny(s, "\n\t\"'\\") ||
+		strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.HasSuffix(s, ":") ||
+		strings.IndexByte("-?:,[]{}#&*!|>%@`", s[0]) >= 0 || s != strings.TrimSpace(s) {
+		return strconv.Quote(s)
+	}
+	return s
+}
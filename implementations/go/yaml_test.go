@@ -0,0 +1,90 @@
+package strata
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	for _, tc := range []struct {
+		name, source string
+		want         interface{}
+	}{
+		{"plain scalars resolve", "n: 42\nf: 1.5\nok: true\nnothing: null\ntilde: ~\nhex: 0x1f\nword: hello world", map[string]interface{}{
+			"n": int64(42), "f": 1.5, "ok": true, "nothing": nil, "tilde": nil, "hex": int64(31), "word": "hello world"}},
+		{"quoted scalars stay strings", "zip: \"007\"\nnothing: 'null'\nyes: \"true\"\nescaped: \"a\\tb\"\nsingle: 'it''s'", map[string]interface{}{
+			"zip": "007", "nothing": "null", "yes": "true", "escaped": "a\tb", "single": "it's"}},
+		{"nested blocks", "server:\n  host: x\n  ports:\n    - 80\n    - 443\nusers:\n  - name: ann\n    admin: true\n  - name: bob\n", map[string]interface{}{
+			"server": map[string]interface{}{"host": "x", "ports": []interface{}{int64(80), int64(443)}},
+			"users": []interface{}{
+				map[string]interface{}{"name": "ann", "admin": true},
+				map[string]interface{}{"name": "bob"}}}},
+		{"flow style", "point: {x: 1, y: \"2\"}\ntags: [a, 'b c', []]", map[string]interface{}{
+			"point": map[string]interface{}{"x": int64(1), "y": "2"},
+			"tags":  []interface{}{"a", "b c", []interface{}{}}}},
+		{"block scalars and comments", "# config\nliteral: |\n  one\n  two\nfolded: >\n  one\n  two\nafter: 1 # trailing\n", map[string]interface{}{
+			"literal": "one\ntwo\n", "folded": "one two\n", "after": int64(1)}},
+		{"top-level sequence", "- 1\n- two\n- [3]", []interface{}{int64(1), "two", []interface{}{int64(3)}}},
+	} {
+		got, err := ParseYAML(tc.source)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %#v, want %#v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestStringifyYAML(t *testing.T) {
+	doc := map[string]interface{}{
+		"zip":     "007",
+		"nothing": "null",
+		"yes":     "true",
+		"plain":   "hello world",
+		"colon":   "a: b",
+		"count":   int64(3),
+		"ratio":   2.0,
+		"none":    nil,
+		"empty":   []interface{}{},
+		"server":  map[string]interface{}{"host": "x", "ports": []interface{}{int64(80), int64(443)}},
+		"users":   []interface{}{map[string]interface{}{"admin": true, "name": "ann"}},
+	}
+	text, err := StringifyYAML(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `colon: "a: b"
+count: 3
+empty: []
+none: null
+nothing: "null"
+plain: hello world
+ratio: 2.0
+server:
+  host: x
+  ports:
+    - 80
+    - 443
+users:
+  - admin: true
+    name: ann
+yes: "true"
+zip: "007"
+`
+	if text != want {
+		t.Errorf("got\n%s\nwant\n%s", text, want)
+	}
+	back, err := ParseYAML(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back, doc) {
+		t.Errorf("the round trip gave %#v", back)
+	}
+	if _, err := StringifyYAML(map[string]interface{}{"f": NativeFunc(nil)}); err == nil || !strings.Contains(err.Error(), "cannot encode") {
+		t.Errorf("stringifying a function gave %v", err)
+	}
+}